@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pojntfx/weron/pkg/wrtccni"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// weron-cni is a CNI plugin which attaches pods to the overlay network of `weron vpn ip`; it is executed by the container runtime, which passes the arguments through the environment and the network configuration through the standard input
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := func() (interface{}, error) {
+		args, err := wrtccni.ParseArgs(os.Getenv)
+		if err != nil {
+			return nil, &wrtccni.Error{
+				CNIVersion: wrtccni.SupportedVersions[len(wrtccni.SupportedVersions)-1],
+				Code:       wrtccni.ErrorCodeInvalidEnvironment,
+				Msg:        err.Error(),
+			}
+		}
+
+		return wrtccni.Execute(args, os.Stdin, ctx)
+	}()
+	if err != nil {
+		if err := json.NewEncoder(os.Stdout).Encode(err); err != nil {
+			panic(err)
+		}
+
+		os.Exit(1)
+	}
+
+	if res != nil {
+		if err := json.NewEncoder(os.Stdout).Encode(res); err != nil {
+			panic(err)
+		}
+	}
+}
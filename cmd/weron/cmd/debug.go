@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	debugAddrFlag = "debug-addr"
+)
+
+// openDebug starts serving the profiling and runtime debugging endpoints if they are enabled
+func openDebug() {
+	addr := viper.GetString(debugAddrFlag)
+	if strings.TrimSpace(addr) == "" {
+		return
+	}
+
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		// Equivalent to /debug/pprof/goroutine?debug=2, which includes the full stack and wait time of every goroutine
+		buf := make([]byte, 1024*1024)
+		for {
+			n := runtime.Stack(buf, true)
+			if n < len(buf) {
+				buf = buf[:n]
+
+				break
+			}
+
+			buf = make([]byte, len(buf)*2)
+		}
+
+		_, _ = rw.Write(buf)
+	})
+
+	log.Info().Str("addr", addr).Msg("Listening for debugging requests")
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("Could not serve debugging requests, stopping")
+		}
+	}()
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var exposeCmd = &cobra.Command{
+	Use:     "expose",
+	Aliases: []string{"exp", "x"},
+	Short:   "Expose services running on peers through ingress peers",
+}
+
+func init() {
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(exposeCmd)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var kvGetCmd = &cobra.Command{
+	Use:     "get [key]",
+	Aliases: []string{"g"},
+	Short:   "Get the value of a key from the community's key-value store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if len(args) != 1 {
+			return errMissingKVKey
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		adapter, err := openKVAdapter(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer adapter.Close()
+
+		go func() {
+			if err := adapter.Wait(); err != nil {
+				panic(err)
+			}
+		}()
+
+		// The store is only synchronized once peers have connected
+		time.Sleep(viper.GetDuration(waitFlag))
+
+		value, ok := adapter.Get(args[0])
+		if !ok {
+			return errKVKeyNotFound
+		}
+
+		fmt.Printf("%s\n", value)
+
+		return nil
+	},
+}
+
+func init() {
+	addKVFlags(kvGetCmd)
+	kvGetCmd.PersistentFlags().Duration(waitFlag, time.Second*10, "Time to wait for peers to synchronize the store")
+
+	viper.AutomaticEnv()
+
+	kvCmd.AddCommand(kvGetCmd)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	deleteFlag = "delete"
+)
+
+var kvSetCmd = &cobra.Command{
+	Use:     "set [key] [value]",
+	Aliases: []string{"s"},
+	Short:   "Set the value of a key in the community's key-value store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if viper.GetBool(deleteFlag) {
+			if len(args) != 1 {
+				return errMissingKVKey
+			}
+		} else if len(args) != 2 {
+			return errMissingKVValue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		adapter, err := openKVAdapter(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer adapter.Close()
+
+		go func() {
+			if err := adapter.Wait(); err != nil {
+				panic(err)
+			}
+		}()
+
+		if viper.GetBool(deleteFlag) {
+			err = adapter.Delete(args[0])
+		} else {
+			err = adapter.Set(args[0], []byte(args[1]))
+		}
+		if err != nil {
+			return err
+		}
+
+		// Peers which connect later are synchronized with the store, so the value has to be kept around for a while
+		log.Info().Str("key", args[0]).Dur("wait", viper.GetDuration(waitFlag)).Msg("Waiting for peers to synchronize the store")
+
+		time.Sleep(viper.GetDuration(waitFlag))
+
+		return nil
+	},
+}
+
+func init() {
+	addKVFlags(kvSetCmd)
+	kvSetCmd.PersistentFlags().Duration(waitFlag, time.Second*10, "Time to wait for peers to synchronize the store before exiting (the value is lost if no peer which stays in the community has received it)")
+	kvSetCmd.PersistentFlags().Bool(deleteFlag, false, "Delete the key instead of setting it")
+
+	viper.AutomaticEnv()
+
+	kvCmd.AddCommand(kvSetCmd)
+}
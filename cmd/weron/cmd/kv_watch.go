@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pojntfx/weron/pkg/wrtckv"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var kvWatchCmd = &cobra.Command{
+	Use:     "watch",
+	Aliases: []string{"w"},
+	Short:   "Print changes to the community's key-value store and keep a replica of it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		adapter, err := openKVAdapter(ctx, func(c wrtckv.Change) {
+			if c.Deleted {
+				fmt.Printf("-%v\n", c.Key)
+
+				return
+			}
+
+			fmt.Printf("+%v=%s\n", c.Key, c.Value)
+		})
+		if err != nil {
+			return err
+		}
+		addInterruptHandler(cancel, adapter, nil)
+
+		return adapter.Wait()
+	},
+}
+
+func init() {
+	addKVFlags(kvWatchCmd)
+
+	viper.AutomaticEnv()
+
+	kvCmd.AddCommand(kvWatchCmd)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/pojntfx/weron/pkg/wrtcsgl"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	fileFlag   = "file"
+	dryRunFlag = "dry-run"
+	pruneFlag  = "prune"
+)
+
+var (
+	errMissingFile = errors.New("missing file")
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+var managerApplyCmd = &cobra.Command{
+	Use:     "apply",
+	Aliases: []string{"apl", "a"},
+	Short:   "Create, update and delete persistent communities and their leases to match a spec",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(fileFlag)) == "" {
+			return errMissingFile
+		}
+
+		var (
+			content []byte
+			err     error
+		)
+		if viper.GetString(fileFlag) == "-" {
+			content, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			content, err = ioutil.ReadFile(viper.GetString(fileFlag))
+		}
+		if err != nil {
+			return err
+		}
+
+		spec := wrtcsgl.Spec{}
+		if err := json.Unmarshal(content, &spec); err != nil {
+			return err
+		}
+
+		if viper.GetBool(pruneFlag) {
+			spec.Prune = true
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		changes, err := manager.Apply(spec, viper.GetBool(dryRunFlag))
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"action", "resource", "community", "id"}); err != nil {
+			return err
+		}
+
+		for _, change := range changes {
+			if err := w.Write([]string{change.Action, change.Resource, change.Community, change.ID}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRemoteFlags(managerApplyCmd.PersistentFlags())
+	managerApplyCmd.PersistentFlags().StringP(fileFlag, "f", "", `Path to a JSON file with the spec to apply, or "-" to read it from stdin (i.e. {"communities":[{"id":"mycommunity","password":"mypassword","leases":[{"id":"myhost","ips":["10.0.0.1/24"],"name":"myhost"}]}]})`)
+	managerApplyCmd.PersistentFlags().Bool(dryRunFlag, false, "Only print the changes which would be made")
+	managerApplyCmd.PersistentFlags().Bool(pruneFlag, false, "Delete persistent communities which are not in the spec (same as setting the prune field of the spec)")
+
+	viper.AutomaticEnv()
+
+	managerCmd.AddCommand(managerApplyCmd)
+}
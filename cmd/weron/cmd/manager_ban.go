@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	errMissingBanTarget = errors.New("missing IP or peer ID")
+)
+
+const (
+	ipFlag   = "ip"
+	peerFlag = "peer"
+)
+
+var managerBanCmd = &cobra.Command{
+	Use:     "ban",
+	Aliases: []string{"bn", "b"},
+	Short:   "Manage bans of abusive clients by IP or peer ID",
+}
+
+func init() {
+	viper.AutomaticEnv()
+
+	managerCmd.AddCommand(managerBanCmd)
+}
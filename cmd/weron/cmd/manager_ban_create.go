@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerBanCreateCmd = &cobra.Command{
+	Use:     "create",
+	Aliases: []string{"ctr", "c", "mk"},
+	Short:   "Ban an IP or peer ID and disconnect its clients",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(ipFlag)) == "" && strings.TrimSpace(viper.GetString(peerFlag)) == "" {
+			return errMissingBanTarget
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		b, err := manager.CreateBan(viper.GetString(ipFlag), viper.GetString(peerFlag), viper.GetDuration(ttlFlag))
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"ip", "peer", "expiresAt"}); err != nil {
+			return err
+		}
+
+		expiresAt := ""
+		if b.ExpiresAt != nil {
+			expiresAt = b.ExpiresAt.Format(time.RFC3339)
+		}
+
+		return w.Write([]string{b.IP, b.PeerID, expiresAt})
+	},
+}
+
+func init() {
+	addRemoteFlags(managerBanCreateCmd.PersistentFlags())
+	managerBanCreateCmd.PersistentFlags().String(ipFlag, "", "IP of the clients to ban (i.e. 192.0.2.1)")
+	managerBanCreateCmd.PersistentFlags().String(peerFlag, "", "ID of the peer to ban if no IP is given (only applies to peers which use selective signaling)")
+	managerBanCreateCmd.PersistentFlags().Duration(ttlFlag, 0, "Time after which the ban is lifted (i.e. 24h) (0 bans permanently)")
+
+	viper.AutomaticEnv()
+
+	managerBanCmd.AddCommand(managerBanCreateCmd)
+}
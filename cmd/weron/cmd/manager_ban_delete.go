@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerBanDeleteCmd = &cobra.Command{
+	Use:     "delete",
+	Aliases: []string{"del", "d", "rm"},
+	Short:   "Lift the ban of an IP or peer ID",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(ipFlag)) == "" && strings.TrimSpace(viper.GetString(peerFlag)) == "" {
+			return errMissingBanTarget
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		return manager.DeleteBan(viper.GetString(ipFlag), viper.GetString(peerFlag))
+	},
+}
+
+func init() {
+	addRemoteFlags(managerBanDeleteCmd.PersistentFlags())
+	managerBanDeleteCmd.PersistentFlags().String(ipFlag, "", "IP to lift the ban of")
+	managerBanDeleteCmd.PersistentFlags().String(peerFlag, "", "ID of the peer to lift the ban of if no IP is given")
+
+	viper.AutomaticEnv()
+
+	managerBanCmd.AddCommand(managerBanDeleteCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerBanListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"lis", "l", "ls"},
+	Short:   "List the active bans",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		bans, err := manager.ListBans()
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"ip", "peer", "expiresAt"}); err != nil {
+			return err
+		}
+
+		for _, b := range bans {
+			expiresAt := ""
+			if b.ExpiresAt != nil {
+				expiresAt = b.ExpiresAt.Format(time.RFC3339)
+			}
+
+			if err := w.Write([]string{b.IP, b.PeerID, expiresAt}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRemoteFlags(managerBanListCmd.PersistentFlags())
+
+	viper.AutomaticEnv()
+
+	managerBanCmd.AddCommand(managerBanListCmd)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pojntfx/weron/pkg/wrtcmgr"
 	"github.com/spf13/cobra"
@@ -21,6 +22,7 @@ var (
 const (
 	communityFlag = "community"
 	passwordFlag  = "password"
+	ttlFlag       = "ttl"
 )
 
 var managerCreateCmd = &cobra.Command{
@@ -59,7 +61,7 @@ var managerCreateCmd = &cobra.Command{
 			ctx,
 		)
 
-		c, err := manager.CreatePersistentCommunity(viper.GetString(communityFlag), viper.GetString(passwordFlag))
+		c, err := manager.CreatePersistentCommunity(viper.GetString(communityFlag), viper.GetString(passwordFlag), viper.GetDuration(ttlFlag))
 		if err != nil {
 			return err
 		}
@@ -67,11 +69,11 @@ var managerCreateCmd = &cobra.Command{
 		w := csv.NewWriter(os.Stdout)
 		defer w.Flush()
 
-		if err := w.Write([]string{"id", "clients", "persistent"}); err != nil {
+		if err := w.Write([]string{"id", "clients", "persistent", "expires"}); err != nil {
 			return err
 		}
 
-		return w.Write([]string{c.ID, fmt.Sprintf("%v", c.Clients), fmt.Sprintf("%v", c.Persistent)})
+		return w.Write([]string{c.ID, fmt.Sprintf("%v", c.Clients), fmt.Sprintf("%v", c.Persistent), formatTime(c.ExpiresAt)})
 	},
 }
 
@@ -79,8 +81,17 @@ func init() {
 	addRemoteFlags(managerCreateCmd.PersistentFlags())
 	managerCreateCmd.PersistentFlags().String(communityFlag, "", "ID of community to create")
 	managerCreateCmd.PersistentFlags().String(passwordFlag, "", "Password for community")
+	managerCreateCmd.PersistentFlags().Duration(ttlFlag, 0, "Time after which the community is deleted and all of its peers are kicked (i.e. 2h) (0 disables expiry)")
 
 	viper.AutomaticEnv()
 
 	managerCmd.AddCommand(managerCreateCmd)
 }
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
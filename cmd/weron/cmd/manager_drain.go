@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerDrainCmd = &cobra.Command{
+	Use:     "drain",
+	Aliases: []string{"dr"},
+	Short:   "Make a signaler stop accepting new clients, wait for pending exchanges to complete, disconnect its clients so that they reconnect elsewhere and exit (i.e. for rolling updates)",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		return manager.Drain()
+	},
+}
+
+func init() {
+	addRemoteFlags(managerDrainCmd.PersistentFlags())
+
+	viper.AutomaticEnv()
+
+	managerCmd.AddCommand(managerDrainCmd)
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	errMissingLease = errors.New("missing lease")
+)
+
+const (
+	leaseFlag = "lease"
+	nameFlag  = "name"
+)
+
+var managerLeaseCmd = &cobra.Command{
+	Use:     "lease",
+	Aliases: []string{"lea", "le"},
+	Short:   "Manage static IP and name reservations for peers in persistent communities",
+}
+
+func init() {
+	viper.AutomaticEnv()
+
+	managerCmd.AddCommand(managerLeaseCmd)
+}
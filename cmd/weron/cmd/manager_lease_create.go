@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strings"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerLeaseCreateCmd = &cobra.Command{
+	Use:     "create",
+	Aliases: []string{"ctr", "c", "mk"},
+	Short:   "Create or update a lease",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(communityFlag)) == "" {
+			return errMissingCommunity
+		}
+
+		if strings.TrimSpace(viper.GetString(leaseFlag)) == "" {
+			return errMissingLease
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		l, err := manager.CreateLease(
+			viper.GetString(communityFlag),
+			viper.GetString(leaseFlag),
+			viper.GetStringSlice(ipsFlag),
+			viper.GetString(nameFlag),
+		)
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"community", "id", "ips", "name"}); err != nil {
+			return err
+		}
+
+		return w.Write([]string{l.Community, l.ID, strings.Join(l.IPs, ","), l.Name})
+	},
+}
+
+func init() {
+	addRemoteFlags(managerLeaseCreateCmd.PersistentFlags())
+	managerLeaseCreateCmd.PersistentFlags().String(communityFlag, "", "ID of persistent community to create the lease in")
+	managerLeaseCreateCmd.PersistentFlags().String(leaseFlag, "", "ID of the lease (i.e. the hostname of the peer)")
+	managerLeaseCreateCmd.PersistentFlags().StringSlice(ipsFlag, []string{}, "Comma-separated list of IP addresses to reserve for the peer (i.e. 2001:db8::1/32,192.0.2.1/24)")
+	managerLeaseCreateCmd.PersistentFlags().String(nameFlag, "", "Name to reserve for the peer")
+
+	viper.AutomaticEnv()
+
+	managerLeaseCmd.AddCommand(managerLeaseCreateCmd)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerLeaseDeleteCmd = &cobra.Command{
+	Use:     "delete",
+	Aliases: []string{"del", "d", "rm"},
+	Short:   "Delete a lease",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(communityFlag)) == "" {
+			return errMissingCommunity
+		}
+
+		if strings.TrimSpace(viper.GetString(leaseFlag)) == "" {
+			return errMissingLease
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		return manager.DeleteLease(viper.GetString(communityFlag), viper.GetString(leaseFlag))
+	},
+}
+
+func init() {
+	addRemoteFlags(managerLeaseDeleteCmd.PersistentFlags())
+	managerLeaseDeleteCmd.PersistentFlags().String(communityFlag, "", "ID of community to delete the lease from")
+	managerLeaseDeleteCmd.PersistentFlags().String(leaseFlag, "", "ID of the lease to delete")
+
+	viper.AutomaticEnv()
+
+	managerLeaseCmd.AddCommand(managerLeaseDeleteCmd)
+}
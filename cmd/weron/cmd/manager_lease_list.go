@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strings"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerLeaseListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"lis", "l", "ls"},
+	Short:   "List the leases of a community",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(communityFlag)) == "" {
+			return errMissingCommunity
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		l, err := manager.ListLeases(viper.GetString(communityFlag))
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"community", "id", "ips", "name"}); err != nil {
+			return err
+		}
+
+		for _, lease := range l {
+			if err := w.Write([]string{lease.Community, lease.ID, strings.Join(lease.IPs, ","), lease.Name}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRemoteFlags(managerLeaseListCmd.PersistentFlags())
+	managerLeaseListCmd.PersistentFlags().String(communityFlag, "", "ID of community to list leases for")
+
+	viper.AutomaticEnv()
+
+	managerLeaseCmd.AddCommand(managerLeaseListCmd)
+}
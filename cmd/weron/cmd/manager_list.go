@@ -28,7 +28,7 @@ var (
 var managerListCmd = &cobra.Command{
 	Use:     "list",
 	Aliases: []string{"lis", "l", "ls"},
-	Short:   "List persistent and ephemeral communities",
+	Short:   "List persistent and ephemeral communities and their usage",
 	PreRunE: validateRemoteFlags,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
@@ -61,12 +61,23 @@ var managerListCmd = &cobra.Command{
 		w := csv.NewWriter(os.Stdout)
 		defer w.Flush()
 
-		if err := w.Write([]string{"id", "clients", "persistent"}); err != nil {
+		if err := w.Write([]string{"id", "clients", "persistent", "expires", "peak", "messages", "bytes", "active", "monthBytes", "suspended"}); err != nil {
 			return err
 		}
 
 		for _, community := range c {
-			if err := w.Write([]string{community.ID, fmt.Sprintf("%v", community.Clients), fmt.Sprintf("%v", community.Persistent)}); err != nil {
+			if err := w.Write([]string{
+				community.ID,
+				fmt.Sprintf("%v", community.Clients),
+				fmt.Sprintf("%v", community.Persistent),
+				formatTime(community.ExpiresAt),
+				fmt.Sprintf("%v", community.PeakClients),
+				fmt.Sprintf("%v", community.Messages),
+				fmt.Sprintf("%v", community.Bytes),
+				formatTime(community.LastActivity),
+				fmt.Sprintf("%v", community.MonthBytes),
+				fmt.Sprintf("%v", community.Suspended),
+			}); err != nil {
 				return err
 			}
 		}
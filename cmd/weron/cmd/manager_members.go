@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var managerMembersCmd = &cobra.Command{
+	Use:     "members",
+	Aliases: []string{"mem", "mbr"},
+	Short:   "List the peers of a community which have connected with their ID (i.e. with --selective-signaling) and when they were last seen",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if strings.TrimSpace(viper.GetString(communityFlag)) == "" {
+			return errMissingCommunity
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		m, err := manager.ListMembers(viper.GetString(communityFlag))
+		if err != nil {
+			return err
+		}
+
+		// Show the most recently seen members first
+		sort.Slice(m, func(i, j int) bool {
+			return m[i].LastSeen.After(m[j].LastSeen)
+		})
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"community", "id", "online", "lastSeen"}); err != nil {
+			return err
+		}
+
+		for _, member := range m {
+			if err := w.Write([]string{member.Community, member.ID, fmt.Sprintf("%v", member.Online), member.LastSeen.Format(time.RFC3339)}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRemoteFlags(managerMembersCmd.PersistentFlags())
+	managerMembersCmd.PersistentFlags().String(communityFlag, "", "ID of community to list members for")
+
+	viper.AutomaticEnv()
+
+	managerCmd.AddCommand(managerMembersCmd)
+}
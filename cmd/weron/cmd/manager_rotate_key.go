@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	graceFlag = "grace"
+)
+
+var managerRotateKeyCmd = &cobra.Command{
+	Use:     "rotate-key <community>",
+	Aliases: []string{"rot", "r"},
+	Short:   "Replace the password of a persistent community with a generated one, which is only shown once",
+	PreRunE: validateRemoteFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(apiPasswordFlag)) == "" {
+			return errMissingAPIPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(apiUsernameFlag)) == "" {
+			return errMissingAPIUsername
+		}
+
+		if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+			return errMissingCommunity
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		manager := wrtcmgr.NewManager(
+			viper.GetString(raddrFlag),
+			viper.GetString(apiUsernameFlag),
+			viper.GetString(apiPasswordFlag),
+			ctx,
+		)
+
+		r, err := manager.RotatePassword(args[0], viper.GetDuration(graceFlag))
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"community", "password", "kickAt"}); err != nil {
+			return err
+		}
+
+		if err := w.Write([]string{r.Community, r.Password, r.KickAt.Format(time.RFC3339)}); err != nil {
+			return err
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRemoteFlags(managerRotateKeyCmd.PersistentFlags())
+	managerRotateKeyCmd.PersistentFlags().Duration(graceFlag, 0, "Time for which clients which have joined with the previous password stay connected, so that they can be reconfigured before they have to join again with the new one (0 kicks them immediately)")
+
+	viper.AutomaticEnv()
+
+	managerCmd.AddCommand(managerRotateKeyCmd)
+}
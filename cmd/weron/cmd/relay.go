@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/pojntfx/weron/pkg/wrtcrly"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var relayCmd = &cobra.Command{
+	Use:     "relay",
+	Aliases: []string{"rly", "r"},
+	Short:   "Start a data relay, which relays payloads between peers which can't establish a direct connection",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		openDebug()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr, err := net.ResolveTCPAddr("tcp", viper.GetString(laddrFlag))
+		if err != nil {
+			return err
+		}
+
+		if port := os.Getenv("PORT"); port != "" {
+			log.Debug().Msg("Using port from PORT env variable")
+
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return err
+			}
+
+			addr.Port = p
+		}
+
+		relay := wrtcrly.NewRelay(
+			addr.String(),
+			&wrtcrly.RelayConfig{
+				Heartbeat:       viper.GetDuration(heartbeatFlag),
+				Token:           viper.GetString(dataRelayTokenFlag),
+				MaxMessageSize:  viper.GetInt64(maxMessageSizeFlag),
+				SendQueueLength: viper.GetInt(sendQueueLengthFlag),
+				TLSCertFile:     viper.GetString(tlsCertFlag),
+				TLSKeyFile:      viper.GetString(tlsKeyFlag),
+				OnConnect: func(raddr, community, id string) {
+					log.Info().
+						Str("address", raddr).
+						Str("community", community).
+						Str("id", id).
+						Msg("Connected to client")
+				},
+				OnDisconnect: func(raddr, community, id string, err interface{}) {
+					log.Info().
+						Str("address", raddr).
+						Str("community", community).
+						Str("id", id).
+						Msg("Disconnected from client")
+				},
+			},
+			ctx,
+		)
+
+		if err := relay.Open(); err != nil {
+			return err
+		}
+		addInterruptHandler(cancel, relay, nil)
+
+		log.Info().
+			Str("address", addr.String()).
+			Msg("Listening")
+
+		return relay.Wait()
+	},
+}
+
+func init() {
+	relayCmd.PersistentFlags().String(laddrFlag, ":1338", "Listening address (can also be set using the PORT env variable)")
+	relayCmd.PersistentFlags().Duration(heartbeatFlag, time.Second*10, "Time to wait for heartbeats")
+	relayCmd.PersistentFlags().String(dataRelayTokenFlag, "", "Bearer token which clients must send to connect (empty allows all clients)")
+	relayCmd.PersistentFlags().Int64(maxMessageSizeFlag, 256*1024, "Maximum size of a message from a client in bytes; clients which send larger messages are disconnected")
+	relayCmd.PersistentFlags().Int(sendQueueLengthFlag, 1024, "Maximum amount of messages to queue for a client; messages to clients which can't keep up are dropped")
+	relayCmd.PersistentFlags().String(tlsCertFlag, "", "Path to the TLS certificate to serve HTTPS with (HTTP is served if empty)")
+	relayCmd.PersistentFlags().String(tlsKeyFlag, "", "Path to the TLS key to serve HTTPS with (HTTP is served if empty)")
+	relayCmd.PersistentFlags().String(debugAddrFlag, "", "Listening address for the runtime debugging endpoints (pprof at /debug/pprof/, expvar at /debug/vars and a dump of all goroutines at /debug/goroutines) (i.e. 127.0.0.1:6060) (empty disables debugging; don't expose this publicly)")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(relayCmd)
+}
@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/internal/secrets"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
@@ -11,8 +15,13 @@ import (
 
 const (
 	verboseFlag = "verbose"
+
+	secretsTimeout = time.Second * 30 // Time to wait for external stores to return secrets
 )
 
+// secretFlags are the flags which accept references to secrets in external stores instead of the secrets themselves (i.e. --key env://WERON_KEY or --ice keychain://weron/turn)
+var secretFlags = []string{keyFlag, passwordFlag, iceFlag, iceServersTokenFlag, dataRelayTokenFlag, apiPasswordFlag, userPasswordFlag, postgresURLFlag, redisURLFlag}
+
 var rootCmd = &cobra.Command{
 	Use:   "weron",
 	Short: "WebRTC Overlay Networks",
@@ -29,6 +38,10 @@ https://github.com/pojntfx/weron`,
 			return err
 		}
 
+		if err := resolveSecrets(cmd); err != nil {
+			return err
+		}
+
 		verbose := viper.GetInt(verboseFlag)
 		if verbose > 5 {
 			boil.DebugMode = true
@@ -57,6 +70,52 @@ https://github.com/pojntfx/weron`,
 	},
 }
 
+// resolveSecrets replaces references to secrets in the command's flags with the secrets from the external stores, so that they never appear on the command line
+func resolveSecrets(cmd *cobra.Command) error {
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+
+	for _, name := range secretFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			continue
+		}
+
+		// Each STUN or TURN server can be a reference, i.e. to keep the credentials of a TURN server in a store
+		if flag.Value.Type() == "stringSlice" {
+			values := viper.GetStringSlice(name)
+
+			resolved := []string{}
+			for _, value := range values {
+				v, err := secrets.Resolve(ctx, value)
+				if err != nil {
+					return err
+				}
+
+				resolved = append(resolved, v)
+			}
+
+			viper.Set(name, resolved)
+
+			continue
+		}
+
+		value := viper.GetString(name)
+		if !secrets.IsReference(value) {
+			continue
+		}
+
+		v, err := secrets.Resolve(ctx, value)
+		if err != nil {
+			return err
+		}
+
+		viper.Set(name, v)
+	}
+
+	return nil
+}
+
 func Execute() error {
 	rootCmd.PersistentFlags().IntP(verboseFlag, "v", 5, "Verbosity level (0 is disabled, default is info, 7 is trace)")
 
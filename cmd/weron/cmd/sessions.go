@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcsess"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	errMissingSessionsFile = errors.New("missing sessions file")
+)
+
+const (
+	sessionsFileFlag      = "sessions-file"
+	sessionsRetentionFlag = "sessions-retention"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:     "sessions",
+	Aliases: []string{"ses"},
+	Short:   "Show the history of the sessions with peers from a session log",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(viper.GetString(sessionsFileFlag)) == "" {
+			return errMissingSessionsFile
+		}
+
+		query := wrtcsess.Query{
+			Community: viper.GetString(communityFlag),
+			Peer:      viper.GetString(peerFlag),
+		}
+
+		if history := viper.GetDuration(historyFlag); history > 0 {
+			query.Since = time.Now().Add(-history)
+		}
+
+		sessions, err := wrtcsess.NewLog(viper.GetString(sessionsFileFlag), nil).Query(query)
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"start", "connected", "end", "duration", "community", "peer", "name", "local", "remote", "relayed", "sent", "received", "reason"}); err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if err := w.Write([]string{
+				session.Start.Format(time.RFC3339),
+				formatTime(session.ConnectedAt),
+				session.End.Format(time.RFC3339),
+				fmt.Sprintf("%v", session.Duration().Round(time.Second)),
+				session.Community,
+				session.PeerID,
+				session.Name,
+				session.LocalCandidate,
+				session.RemoteCandidate,
+				fmt.Sprintf("%v", session.Relayed),
+				fmt.Sprintf("%v", session.BytesSent),
+				fmt.Sprintf("%v", session.BytesReceived),
+				session.Reason,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// openSessions returns the session log if recording sessions is enabled; it is nil otherwise
+func openSessions() *wrtcsess.Log {
+	if strings.TrimSpace(viper.GetString(sessionsFileFlag)) == "" {
+		return nil
+	}
+
+	return wrtcsess.NewLog(
+		viper.GetString(sessionsFileFlag),
+		&wrtcsess.LogConfig{
+			Retention: viper.GetDuration(sessionsRetentionFlag),
+		},
+	)
+}
+
+func init() {
+	sessionsCmd.PersistentFlags().String(sessionsFileFlag, "", "Path to the session log to read, which the VPNs and utilities record into with their --sessions-file flag (i.e. ~/.local/share/weron/sessions.db)")
+	sessionsCmd.PersistentFlags().String(communityFlag, "", "Only show sessions in this community")
+	sessionsCmd.PersistentFlags().String(peerFlag, "", "Only show sessions with the peer with this ID or name")
+	sessionsCmd.PersistentFlags().Duration(historyFlag, time.Hour*24, "Only show sessions which have ended in this duration (i.e. --history=12h) (0 shows all sessions)")
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(sessionsCmd)
+}
@@ -25,6 +25,22 @@ const (
 	apiPasswordFlag          = "api-password"
 	oidcIssuerFlag           = "oidc-issuer"
 	oidcClientIDFlag         = "oidc-client-id"
+	compressionFlag          = "compression"
+	allowedOriginsFlag       = "allowed-origins"
+	introductionWindowFlag   = "introduction-window"
+	maxMessageSizeFlag       = "max-message-size"
+	sendQueueLengthFlag      = "send-queue-length"
+	allowedNetworksFlag      = "allowed-networks"
+	deniedNetworksFlag       = "denied-networks"
+	trustedProxiesFlag       = "trusted-proxies"
+	monthlyQuotaFlag         = "monthly-quota"
+	mailboxTTLFlag           = "mailbox-ttl"
+	mailboxLimitFlag         = "mailbox-limit"
+	maxMailSizeFlag          = "max-mail-size"
+	drainTimeoutFlag         = "drain-timeout"
+	replicasFlag             = "replicas"
+	replicaURLFlag           = "replica-url"
+	webTransportAddrFlag     = "webtransport-laddr"
 )
 
 var signalerCmd = &cobra.Command{
@@ -75,6 +91,8 @@ var signalerCmd = &cobra.Command{
 			return err
 		}
 
+		openDebug()
+
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
@@ -106,6 +124,24 @@ var signalerCmd = &cobra.Command{
 				APIPassword:          viper.GetString(apiPasswordFlag),
 				OIDCIssuer:           viper.GetString(oidcIssuerFlag),
 				OIDCClientID:         viper.GetString(oidcClientIDFlag),
+				Compression:          viper.GetBool(compressionFlag),
+				AllowedOrigins:       viper.GetStringSlice(allowedOriginsFlag),
+				IntroductionWindow:   viper.GetDuration(introductionWindowFlag),
+				MaxMessageSize:       viper.GetInt64(maxMessageSizeFlag),
+				SendQueueLength:      viper.GetInt(sendQueueLengthFlag),
+				AllowedNetworks:      viper.GetStringSlice(allowedNetworksFlag),
+				DeniedNetworks:       viper.GetStringSlice(deniedNetworksFlag),
+				TrustedProxies:       viper.GetStringSlice(trustedProxiesFlag),
+				MonthlyQuota:         viper.GetInt64(monthlyQuotaFlag),
+				MailboxTTL:           viper.GetDuration(mailboxTTLFlag),
+				MailboxLimit:         viper.GetInt(mailboxLimitFlag),
+				MaxMailSize:          viper.GetInt(maxMailSizeFlag),
+				DrainTimeout:         viper.GetDuration(drainTimeoutFlag),
+				Replicas:             viper.GetStringSlice(replicasFlag),
+				ReplicaURL:           viper.GetString(replicaURLFlag),
+				WebTransportAddr:     viper.GetString(webTransportAddrFlag),
+				TLSCertFile:          viper.GetString(tlsCertFlag),
+				TLSKeyFile:           viper.GetString(tlsKeyFlag),
 				OnConnect: func(raddr, community string) {
 					log.Info().
 						Str("address", raddr).
@@ -125,12 +161,19 @@ var signalerCmd = &cobra.Command{
 		if err := signaler.Open(); err != nil {
 			return err
 		}
-		addInterruptHandler(cancel, signaler, nil)
+		// Clients are disconnected gracefully so that they reconnect to another signaler (i.e. during rolling updates)
+		addInterruptHandler(cancel, signaler, signaler.Drain)
 
 		log.Info().
 			Str("address", addr.String()).
 			Msg("Listening")
 
+		if wtAddr := signaler.WebTransportAddr(); wtAddr != nil {
+			log.Info().
+				Str("address", wtAddr.String()).
+				Msg("Listening for WebTransport")
+		}
+
 		return signaler.Wait()
 	},
 }
@@ -146,6 +189,25 @@ func init() {
 	signalerCmd.PersistentFlags().String(apiPasswordFlag, "", "Password for the management API (can also be set using the API_PASSWORD env variable). Ignored if any of the OIDC parameters are set.")
 	signalerCmd.PersistentFlags().String(oidcIssuerFlag, "", "OIDC Issuer (i.e. https://pojntfx.eu.auth0.com/) (can also be set using the OIDC_ISSUER env variable)")
 	signalerCmd.PersistentFlags().String(oidcClientIDFlag, "", "OIDC Client ID (i.e. myoidcclientid) (can also be set using the OIDC_CLIENT_ID env variable)")
+	signalerCmd.PersistentFlags().Bool(compressionFlag, false, "Negotiate permessage-deflate compression with clients that request it")
+	signalerCmd.PersistentFlags().StringSlice(allowedOriginsFlag, []string{}, "Comma-separated list of origins from which browsers may connect and use the management API (i.e. https://example.com,https://app.example.com) (* allows all origins; same-origin requests and non-browser clients are always allowed)")
+	signalerCmd.PersistentFlags().Duration(introductionWindowFlag, 0, "Time to buffer introductions for, so that clients which join shortly after another client still receive its introduction (i.e. 5s) (0 disables buffering)")
+	signalerCmd.PersistentFlags().Int64(maxMessageSizeFlag, 1024*1024, "Maximum size of a message from a client in bytes; clients which send larger messages are disconnected")
+	signalerCmd.PersistentFlags().Int(sendQueueLengthFlag, 1024, "Maximum amount of messages to queue for a client; clients which can't keep up are disconnected")
+	signalerCmd.PersistentFlags().StringSlice(allowedNetworksFlag, []string{}, "Comma-separated list of CIDRs or IPs from which clients may connect and use the management API (i.e. 10.0.0.0/8,2001:db8::/32) (empty allows all networks)")
+	signalerCmd.PersistentFlags().StringSlice(deniedNetworksFlag, []string{}, "Comma-separated list of CIDRs or IPs from which clients may not connect or use the management API (takes precedence over --"+allowedNetworksFlag+")")
+	signalerCmd.PersistentFlags().StringSlice(trustedProxiesFlag, []string{}, "Comma-separated list of CIDRs or IPs of reverse proxies whose Forwarded and X-Forwarded-For headers determine the IPs of clients for --"+allowedNetworksFlag+", --"+deniedNetworksFlag+" and bans (i.e. 127.0.0.1,::1) (empty ignores the headers, so all clients behind a proxy share its IP)")
+	signalerCmd.PersistentFlags().Int64(monthlyQuotaFlag, 0, "Maximum signaling traffic per community and calendar month (UTC) in bytes; communities which exceed it are suspended until the next month (0 disables the quota)")
+	signalerCmd.PersistentFlags().Duration(mailboxTTLFlag, 0, "Time to keep mail for offline clients for, which is delivered once they connect with selective signaling again (i.e. 168h) (0 disables the mailbox; mail in ephemeral communities is lost once they are deleted)")
+	signalerCmd.PersistentFlags().Int(mailboxLimitFlag, 64, "Maximum amount of mail to keep per offline client")
+	signalerCmd.PersistentFlags().Int(maxMailSizeFlag, 16*1024, "Maximum size of mail to keep in bytes")
+	signalerCmd.PersistentFlags().Duration(drainTimeoutFlag, time.Second*30, "Maximum time to wait for pending exchanges to complete when draining (on SIGTERM, SIGINT or a POST to "+wrtcsgl.DrainPath+" of the management API) before disconnecting clients so that they reconnect to another signaler")
+	signalerCmd.PersistentFlags().StringSlice(replicasFlag, []string{}, "Comma-separated list of URLs of all replicas of a sharded fleet, including this one (i.e. https://signaler-1.example.com/,https://signaler-2.example.com/); communities are sharded across them by consistent hashing and clients are redirected to the replica which owns their community, so replicas don't need to share a database or broker (empty disables sharding)")
+	signalerCmd.PersistentFlags().String(replicaURLFlag, "", "URL of this replica, which must be one of --"+replicasFlag+" (ignored if sharding is disabled)")
+	signalerCmd.PersistentFlags().String(webTransportAddrFlag, "", "UDP listening address for clients which connect over WebTransport (HTTP/3) by using the webtransport:// scheme, which has lower latency and no head-of-line blocking on lossy networks (i.e. :1337) (empty disables WebTransport)")
+	signalerCmd.PersistentFlags().String(tlsCertFlag, "", "Path to the TLS certificate for WebTransport, which QUIC requires (ignored if WebTransport is disabled)")
+	signalerCmd.PersistentFlags().String(tlsKeyFlag, "", "Path to the TLS key for WebTransport (ignored if WebTransport is disabled)")
+	signalerCmd.PersistentFlags().String(debugAddrFlag, "", "Listening address for the runtime debugging endpoints (pprof at /debug/pprof/, expvar at /debug/vars and a dump of all goroutines at /debug/goroutines) (i.e. 127.0.0.1:6060) (empty disables debugging; don't expose this publicly)")
 
 	viper.AutomaticEnv()
 
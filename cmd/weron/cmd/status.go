@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/pojntfx/weron/pkg/wrtchealth"
+	"github.com/pojntfx/weron/pkg/wrtcpcap"
+	"github.com/pojntfx/weron/pkg/wrtcstats"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	statsFlag          = "stats"
+	statsIntervalFlag  = "stats-interval"
+	statsRetentionFlag = "stats-retention"
+	controlLaddrFlag   = "control-laddr"
+	controlRaddrFlag   = "control-raddr"
+	historyFlag        = "history"
+	healthLaddrFlag    = "health-laddr"
+	pcapFlag           = "pcap"
+)
+
+var statusCmd = &cobra.Command{
+	Use:     "status",
+	Aliases: []string{"sta", "st"},
+	Short:   "Show the link quality to peers from the control API of a running VPN",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		samples, err := wrtcstats.GetSamples(ctx, viper.GetString(controlRaddrFlag), viper.GetDuration(historyFlag))
+		if err != nil {
+			return err
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		if err := w.Write([]string{"time", "community", "peer", "name", "state", "path", "relayed", "rtt", "loss", "sent", "received", "sendRate", "receiveRate"}); err != nil {
+			return err
+		}
+
+		for _, sample := range samples {
+			if err := w.Write([]string{
+				sample.Time.Format(time.RFC3339),
+				sample.Community,
+				sample.PeerID,
+				sample.Name,
+				sample.State,
+				sample.Path,
+				fmt.Sprintf("%v", sample.Relayed),
+				fmt.Sprintf("%v", sample.RTT),
+				fmt.Sprintf("%.2f", sample.Loss),
+				fmt.Sprintf("%v", sample.BytesSent),
+				fmt.Sprintf("%v", sample.BytesReceived),
+				fmt.Sprintf("%.0f", sample.SendRate),
+				fmt.Sprintf("%.0f", sample.ReceiveRate),
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// openStats starts recording the link quality to peers if the control API or the stats file are enabled; the capture is served by the control API if it is not nil
+func openStats(ctx context.Context, capture *wrtcpcap.Writer) (*wrtcstats.Recorder, error) {
+	if strings.TrimSpace(viper.GetString(statsFlag)) == "" && strings.TrimSpace(viper.GetString(controlLaddrFlag)) == "" {
+		return nil, nil
+	}
+
+	stats := wrtcstats.NewRecorder(
+		viper.GetString(statsFlag),
+		&wrtcstats.RecorderConfig{
+			Interval:  viper.GetDuration(statsIntervalFlag),
+			Retention: viper.GetDuration(statsRetentionFlag),
+		},
+		ctx,
+	)
+
+	if err := stats.Open(); err != nil {
+		return nil, err
+	}
+
+	if laddr := viper.GetString(controlLaddrFlag); strings.TrimSpace(laddr) != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/stats", stats)
+
+		if capture != nil {
+			mux.Handle("/pcap", capture)
+		}
+
+		log.Info().Str("addr", laddr).Msg("Listening for control API requests")
+
+		go func() {
+			if err := http.ListenAndServe(laddr, mux); err != nil {
+				log.Error().Err(err).Str("addr", laddr).Msg("Could not serve control API, stopping")
+			}
+		}()
+	}
+
+	return stats, nil
+}
+
+// openCapture creates a packet capture if the control API or the capture file are enabled and starts capturing if the capture file is set; the returned writer is nil otherwise
+func openCapture(ctx context.Context, linkType layers.LinkType) (*wrtcpcap.Writer, error) {
+	path := viper.GetString(pcapFlag)
+	if strings.TrimSpace(path) == "" && strings.TrimSpace(viper.GetString(controlLaddrFlag)) == "" {
+		return nil, nil
+	}
+
+	capture := wrtcpcap.NewWriter(
+		&wrtcpcap.WriterConfig{
+			LinkType: linkType,
+		},
+		ctx,
+	)
+
+	if strings.TrimSpace(path) != "" {
+		if err := capture.Start(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return capture, nil
+}
+
+// openHealth starts serving the health and readiness endpoints if they are enabled; the returned checker is nil otherwise
+func openHealth(conditions ...string) *wrtchealth.Checker {
+	laddr := viper.GetString(healthLaddrFlag)
+	if strings.TrimSpace(laddr) == "" {
+		return nil
+	}
+
+	health := wrtchealth.NewChecker(conditions...)
+
+	mux := http.NewServeMux()
+	health.Register(mux)
+
+	log.Info().Str("addr", laddr).Msg("Listening for health checks")
+
+	go func() {
+		if err := http.ListenAndServe(laddr, mux); err != nil {
+			log.Error().Err(err).Str("addr", laddr).Msg("Could not serve health checks, stopping")
+		}
+	}()
+
+	return health
+}
+
+func init() {
+	statusCmd.PersistentFlags().String(controlRaddrFlag, "http://localhost:1339/", "Remote address of the control API")
+	statusCmd.PersistentFlags().Duration(historyFlag, 0, "Show all samples in this duration instead of only the latest sample of each peer (i.e. --history=30m) (defaults to the last hour if no duration is given)")
+	statusCmd.PersistentFlags().Lookup(historyFlag).NoOptDefVal = "1h"
+
+	viper.AutomaticEnv()
+
+	rootCmd.AddCommand(statusCmd)
+}
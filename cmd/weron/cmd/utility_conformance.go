@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconform"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	vectorsFlag = "vectors"
+)
+
+var utilityConformanceCmd = &cobra.Command{
+	Use:     "conformance",
+	Aliases: []string{"conform", "cnf"},
+	Short:   "Check a third-party client against the signaling spec",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		if viper.GetBool(vectorsFlag) {
+			vectors, err := wrtcconform.Vectors()
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(vectors)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if strings.TrimSpace(viper.GetString(communityFlag)) == "" {
+			return errMissingCommunity
+		}
+
+		if strings.TrimSpace(viper.GetString(passwordFlag)) == "" {
+			return errMissingPassword
+		}
+
+		if strings.TrimSpace(viper.GetString(keyFlag)) == "" {
+			return errMissingKey
+		}
+
+		header, cookies, err := parseHeader()
+		if err != nil {
+			return err
+		}
+
+		u, err := url.Parse(viper.GetString(raddrFlag))
+		if err != nil {
+			return err
+		}
+
+		q := u.Query()
+		q.Set("community", viper.GetString(communityFlag))
+		q.Set("password", viper.GetString(passwordFlag))
+		u.RawQuery = q.Encode()
+
+		log.Info().
+			Str("addr", viper.GetString(raddrFlag)).
+			Str("version", wrtcconform.SpecVersion).
+			Msg("Connecting to signaler and waiting for client under test")
+
+		result, err := wrtcconform.Check(
+			ctx,
+			u.String(),
+			viper.GetString(keyFlag),
+			viper.GetStringSlice(iceFlag),
+			&wrtcconform.CheckConfig{
+				AdapterConfig: &wrtcconn.AdapterConfig{
+					Timeout:            viper.GetDuration(timeoutFlag),
+					Header:             header,
+					Cookies:            cookies,
+					BinarySignaling:    viper.GetBool(binarySignalingFlag),
+					SelectiveSignaling: viper.GetBool(selectiveSignalingFlag),
+					RelayFallback:      viper.GetBool(relayFallbackFlag),
+				},
+				PeerID:        viper.GetString(peerFlag),
+				Messages:      viper.GetInt(packetCountFlag),
+				MessageLength: viper.GetInt(packetLengthFlag),
+			},
+		)
+		if result != nil {
+			fmt.Printf("Client: %v Relayed: %v Messages echoed: %v/%v Average latency: %v\n", result.PeerID, result.Relayed, result.Messages, viper.GetInt(packetCountFlag), result.Latency)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Client is conformant")
+
+		return nil
+	},
+}
+
+func init() {
+	utilityConformanceCmd.PersistentFlags().String(raddrFlag, "wss://weron.up.railway.app/", "Remote address")
+	utilityConformanceCmd.PersistentFlags().Duration(timeoutFlag, time.Second*10, "Time to wait for connections and for each message to be echoed")
+	utilityConformanceCmd.PersistentFlags().String(communityFlag, "", "ID of community to join")
+	utilityConformanceCmd.PersistentFlags().String(passwordFlag, "", "Password for community")
+	utilityConformanceCmd.PersistentFlags().String(keyFlag, "", "Encryption key for community")
+	utilityConformanceCmd.PersistentFlags().StringSlice(iceFlag, []string{"stun:stun.l.google.com:19302"}, "Comma-separated list of STUN servers (in format stun:host:port) and TURN servers to use (in format username:credential@turn:host:port) (i.e. username:credential@turn:global.turn.twilio.com:3478?transport=tcp)")
+	utilityConformanceCmd.PersistentFlags().StringArray(headerFlag, []string{}, "HTTP header to send to the signaler (in format Name: value) (i.e. Authorization: Bearer token) (can be specified multiple times)")
+	utilityConformanceCmd.PersistentFlags().StringArray(cookieFlag, []string{}, "Cookie to send to the signaler (in format name=value) (can be specified multiple times)")
+	utilityConformanceCmd.PersistentFlags().Bool(binarySignalingFlag, false, "Request the binary signaling protocol from the signaler (checks weron.v2.cbor instead of weron.v1.json)")
+	utilityConformanceCmd.PersistentFlags().Bool(selectiveSignalingFlag, false, "Send the ID of this peer and the recipients of messages to the signaler (checks that the client under test handles envelopes)")
+	utilityConformanceCmd.PersistentFlags().Bool(relayFallbackFlag, false, "Relay payloads through the signaler if a direct connection to the client under test can't be established (checks relay and relay-close messages)")
+	utilityConformanceCmd.PersistentFlags().String(peerFlag, "", "ID of the client under test (empty checks the first client which connects)")
+	utilityConformanceCmd.PersistentFlags().Int(packetCountFlag, 3, "Amount of messages the client under test has to echo")
+	utilityConformanceCmd.PersistentFlags().Int(packetLengthFlag, 64, "Length of the messages the client under test has to echo")
+	utilityConformanceCmd.PersistentFlags().Bool(vectorsFlag, false, "Print every message type encoded with every version as JSON test vectors (see docs/signaling.md) and exit")
+
+	viper.AutomaticEnv()
+
+	utilityCmd.AddCommand(utilityConformanceCmd)
+}
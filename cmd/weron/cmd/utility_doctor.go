@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pojntfx/weron/pkg/wrtcdoc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var utilityDoctorCmd = &cobra.Command{
+	Use:     "doctor",
+	Aliases: []string{"doc", "d"},
+	Short:   "Diagnose connectivity issues with the signaler, STUN and TURN servers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		u, err := url.Parse(viper.GetString(raddrFlag))
+		if err != nil {
+			return err
+		}
+
+		header, cookies, err := parseHeader()
+		if err != nil {
+			return err
+		}
+
+		for _, cookie := range cookies {
+			header.Add("Cookie", cookie.String())
+		}
+
+		// Join a random ephemeral community if none has been specified
+		community := viper.GetString(communityFlag)
+		if strings.TrimSpace(community) == "" {
+			community = "weron-doctor-" + uuid.NewString()
+		}
+
+		password := viper.GetString(passwordFlag)
+		if strings.TrimSpace(password) == "" {
+			password = uuid.NewString()
+		}
+
+		q := u.Query()
+		q.Set("community", community)
+		q.Set("password", password)
+		u.RawQuery = q.Encode()
+
+		doctor := wrtcdoc.NewDoctor(
+			u.String(),
+			viper.GetStringSlice(iceFlag),
+			&wrtcdoc.DoctorConfig{
+				Timeout:  viper.GetDuration(timeoutFlag),
+				IPFamily: viper.GetString(ipFamilyFlag),
+				Header:   header,
+			},
+			ctx,
+		)
+
+		report, err := doctor.Diagnose()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case report.Signaler.Upgraded:
+			fmt.Printf("Signaler %v: reachable, WebSocket upgraded in %v\n", viper.GetString(raddrFlag), report.Signaler.Latency)
+		case report.Signaler.Reachable:
+			fmt.Printf("Signaler %v: reachable, WebSocket upgrade failed: %v\n", viper.GetString(raddrFlag), report.Signaler.Err)
+		default:
+			fmt.Printf("Signaler %v: unreachable: %v\n", viper.GetString(raddrFlag), report.Signaler.Err)
+		}
+
+		for _, res := range report.STUN {
+			if res.Err != nil {
+				fmt.Printf("STUN server %v: failed: %v\n", res.Server, res.Err)
+
+				continue
+			}
+
+			fmt.Printf("STUN server %v: mapped to %v in %v\n", res.Server, res.MappedAddr, res.Latency)
+		}
+
+		for _, res := range report.TURN {
+			if res.Err != nil {
+				fmt.Printf("TURN server %v: failed: %v\n", res.Server, res.Err)
+
+				continue
+			}
+
+			fmt.Printf("TURN server %v: relayed via %v in %v\n", res.Server, res.RelayedAddr, res.Latency)
+		}
+
+		fmt.Printf("NAT type: %v\n", report.NATType)
+
+		for _, advice := range report.Advice {
+			fmt.Printf("- %v\n", advice)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	utilityDoctorCmd.PersistentFlags().String(raddrFlag, "wss://weron.up.railway.app/", "Remote address")
+	utilityDoctorCmd.PersistentFlags().Duration(timeoutFlag, time.Second*10, "Time to wait for each probe")
+	utilityDoctorCmd.PersistentFlags().String(communityFlag, "", "ID of community to join (default is a random ephemeral community)")
+	utilityDoctorCmd.PersistentFlags().String(passwordFlag, "", "Password for community (default is a random password)")
+	utilityDoctorCmd.PersistentFlags().StringSlice(iceFlag, []string{"stun:stun.l.google.com:19302", "stun:stun1.l.google.com:19302"}, "Comma-separated list of STUN servers (in format stun:host:port) and TURN servers to use (in format username:credential@turn:host:port) (i.e. username:credential@turn:global.turn.twilio.com:3478?transport=tcp); at least two STUN servers are required to detect the NAT type")
+	utilityDoctorCmd.PersistentFlags().StringArray(headerFlag, []string{}, "HTTP header to send to the signaler (in format Name: value) (i.e. Authorization: Bearer token) (can be specified multiple times)")
+	utilityDoctorCmd.PersistentFlags().StringArray(cookieFlag, []string{}, "Cookie to send to the signaler (in format name=value) (can be specified multiple times)")
+	utilityDoctorCmd.PersistentFlags().String(ipFamilyFlag, "", "IP family to probe the STUN and TURN servers with (ipv4 or ipv6) (empty probes them with both)")
+
+	viper.AutomaticEnv()
+
+	utilityCmd.AddCommand(utilityDoctorCmd)
+}
@@ -0,0 +1,10 @@
+-- +migrate Up
+create table leases (
+    community text not null references communities(id) on delete cascade,
+    id text not null,
+    ips text not null,
+    name text not null,
+    primary key (community, id)
+);
+-- +migrate Down
+drop table leases;
\ No newline at end of file
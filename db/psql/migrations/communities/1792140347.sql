@@ -0,0 +1,4 @@
+-- +migrate Up
+alter table communities add column expires_at timestamptz;
+-- +migrate Down
+alter table communities drop column expires_at;
\ No newline at end of file
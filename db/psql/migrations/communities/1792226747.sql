@@ -0,0 +1,10 @@
+-- +migrate Up
+alter table communities add column peak_clients integer not null default 0;
+alter table communities add column messages bigint not null default 0;
+alter table communities add column bytes bigint not null default 0;
+alter table communities add column last_activity timestamptz;
+-- +migrate Down
+alter table communities drop column last_activity;
+alter table communities drop column bytes;
+alter table communities drop column messages;
+alter table communities drop column peak_clients;
\ No newline at end of file
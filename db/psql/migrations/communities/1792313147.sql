@@ -0,0 +1,10 @@
+-- +migrate Up
+create table members (
+    community text not null references communities(id) on delete cascade,
+    id text not null,
+    online boolean not null default false,
+    last_seen timestamptz not null,
+    primary key (community, id)
+);
+-- +migrate Down
+drop table members;
\ No newline at end of file
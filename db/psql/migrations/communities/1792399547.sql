@@ -0,0 +1,6 @@
+-- +migrate Up
+alter table communities add column usage_month text not null default '';
+alter table communities add column month_bytes bigint not null default 0;
+-- +migrate Down
+alter table communities drop column month_bytes;
+alter table communities drop column usage_month;
\ No newline at end of file
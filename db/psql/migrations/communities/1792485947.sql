@@ -0,0 +1,12 @@
+-- +migrate Up
+create table mail (
+    serial bigserial primary key,
+    community text not null references communities(id) on delete cascade,
+    recipient text not null,
+    payload bytea not null,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null
+);
+create index mail_recipient on mail (community, recipient);
+-- +migrate Down
+drop table mail;
\ No newline at end of file
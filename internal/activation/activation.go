@@ -0,0 +1,66 @@
+package activation
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	listenFDsStart = 3         // File descriptor of the first passed socket (SD_LISTEN_FDS_START)
+	defaultName    = "unknown" // Name of sockets for which no FileDescriptorName= has been set
+
+	pidEnv   = "LISTEN_PID"     // PID of the process which the sockets have been passed to
+	fdsEnv   = "LISTEN_FDS"     // Amount of passed sockets
+	namesEnv = "LISTEN_FDNAMES" // Colon-separated names of the passed sockets
+)
+
+// Listeners returns the stream sockets which have been passed by systemd socket activation (see sd_listen_fds(3)) by their names (FileDescriptorName= in the socket unit); the environment variables are unset so that child processes don't inherit them
+func Listeners() (map[string][]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv(pidEnv)
+		_ = os.Unsetenv(fdsEnv)
+		_ = os.Unsetenv(namesEnv)
+	}()
+
+	listeners := map[string][]net.Listener{}
+
+	// The sockets have been passed to another process if the PID doesn't match, i.e. if the variables have been inherited
+	pid, err := strconv.Atoi(os.Getenv(pidEnv))
+	if err != nil || pid != os.Getpid() {
+		return listeners, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv(fdsEnv))
+	if err != nil || fds <= 0 {
+		return listeners, nil
+	}
+
+	names := strings.Split(os.Getenv(namesEnv), ":")
+	for i := 0; i < fds; i++ {
+		name := defaultName
+		if i < len(names) && strings.TrimSpace(names[i]) != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+
+		// The listener uses a duplicate of the file descriptor
+		listener, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				for _, listener := range l {
+					_ = listener.Close()
+				}
+			}
+
+			return nil, err
+		}
+
+		listeners[name] = append(listeners[name], listener)
+	}
+
+	return listeners, nil
+}
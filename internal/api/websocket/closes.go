@@ -0,0 +1,41 @@
+package websocket
+
+import "github.com/gorilla/websocket"
+
+// Codes which the signaler rejects clients with; handshakes are rejected with a Rejection as the body, while clients which are already connected are disconnected with a close frame which contains the code and reason
+const (
+	CloseInvalidRequest               = 4000                          // The request is missing a community or password or contains a community multiple times
+	CloseWrongPassword                = 4001                          // The password for a community is wrong
+	CloseEphemeralCommunitiesDisabled = 4002                          // A community doesn't exist and the signaler doesn't allow creating ephemeral communities
+	CloseForbidden                    = 4003                          // The client is banned or connects from a network which is not allowed
+	CloseKicked                       = 4004                          // The community has been deleted or has expired, or the client has joined with a password which has been rotated
+	CloseMisdirected                  = 4021                          // The communities are owned by different replicas of a sharded fleet, so they must be joined over separate connections
+	CloseQuotaExceeded                = 4029                          // The community has exceeded its monthly quota and is suspended until the next month
+	CloseDraining                     = websocket.CloseServiceRestart // The signaler is draining (i.e. for a rolling update); clients should reconnect immediately, which load balancers route to another signaler
+)
+
+// Reasons which are sent together with the codes
+const (
+	ReasonInvalidRequest               = "invalid-request"
+	ReasonWrongPassword                = "wrong-password"
+	ReasonEphemeralCommunitiesDisabled = "ephemeral-communities-disabled"
+	ReasonForbidden                    = "forbidden"
+	ReasonKicked                       = "kicked"
+	ReasonMisdirected                  = "misdirected"
+	ReasonQuotaExceeded                = "quota-exceeded"
+	ReasonDraining                     = "draining"
+)
+
+// Rejection is a machine-readable reason for rejecting a client
+type Rejection struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// NewRejection creates a rejection
+func NewRejection(code int, reason string) *Rejection {
+	return &Rejection{
+		Code:   code,
+		Reason: reason,
+	}
+}
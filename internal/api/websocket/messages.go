@@ -1,40 +1,60 @@
 package websocket
 
 type Message struct {
-	Type string `json:"type"`
+	Type string `json:"type" cbor:"1,keyasint"`
+}
+
+type Sender struct {
+	From string `json:"from" cbor:"2,keyasint"`
 }
 
 type Introduction struct {
 	*Message
 
-	From string `json:"from"`
+	From     string   `json:"from" cbor:"2,keyasint"`
+	Metadata []byte   `json:"metadata,omitempty" cbor:"3,keyasint,omitempty"`
+	Session  string   `json:"session,omitempty" cbor:"4,keyasint,omitempty"`
+	Name     string   `json:"name,omitempty" cbor:"5,keyasint,omitempty"`
+	Mode     string   `json:"mode,omitempty" cbor:"6,keyasint,omitempty"`
+	Versions []string `json:"versions,omitempty" cbor:"7,keyasint,omitempty"`
 }
 
 type Exchange struct {
 	*Message
 
-	From    string `json:"from"`
-	To      string `json:"to"`
-	Payload []byte `json:"payload"`
+	From     string `json:"from" cbor:"2,keyasint"`
+	To       string `json:"to" cbor:"3,keyasint"`
+	Payload  []byte `json:"payload" cbor:"4,keyasint"`
+	Metadata []byte `json:"metadata,omitempty" cbor:"5,keyasint,omitempty"`
+	Session  string `json:"session,omitempty" cbor:"6,keyasint,omitempty"`
+	Name     string `json:"name,omitempty" cbor:"7,keyasint,omitempty"`
 }
 
-func NewIntroduction(from string) *Introduction {
+func NewIntroduction(from string, session string, name string, mode string, metadata []byte, versions []string) *Introduction {
 	return &Introduction{
 		Message: &Message{
 			Type: TypeIntroduction,
 		},
-		From: from,
+		From:     from,
+		Metadata: metadata,
+		Session:  session,
+		Name:     name,
+		Mode:     mode,
+		Versions: versions,
 	}
 }
 
-func NewOffer(from string, to string, payload []byte) *Exchange {
+func NewOffer(from string, to string, session string, name string, payload []byte, metadata []byte) *Exchange {
 	return &Exchange{
 		Message: &Message{
 			Type: TypeOffer,
 		},
-		From:    from,
-		To:      to,
-		Payload: payload,
+		From:     from,
+		To:       to,
+		Payload:  payload,
+		Metadata: metadata,
+		Session:  session,
+		Name:     name,
 	}
 }
 
@@ -59,3 +79,138 @@ func NewCandidate(from string, to string, payload []byte) *Exchange {
 		Payload: payload,
 	}
 }
+
+func NewEndOfCandidates(from string, to string) *Exchange {
+	return &Exchange{
+		Message: &Message{
+			Type: TypeEndOfCandidates,
+		},
+		From: from,
+		To:   to,
+	}
+}
+
+func NewRenegotiationOffer(from string, to string, payload []byte) *Exchange {
+	return &Exchange{
+		Message: &Message{
+			Type: TypeRenegotiationOffer,
+		},
+		From:    from,
+		To:      to,
+		Payload: payload,
+	}
+}
+
+func NewRenegotiationAnswer(from string, to string, payload []byte) *Exchange {
+	return &Exchange{
+		Message: &Message{
+			Type: TypeRenegotiationAnswer,
+		},
+		From:    from,
+		To:      to,
+		Payload: payload,
+	}
+}
+
+type Relay struct {
+	*Message
+
+	From    string `json:"from" cbor:"2,keyasint"`
+	To      string `json:"to" cbor:"3,keyasint"`
+	Channel string `json:"channel" cbor:"4,keyasint"`
+	Payload []byte `json:"payload,omitempty" cbor:"5,keyasint,omitempty"`
+}
+
+func NewRelay(from string, to string, channel string, payload []byte) *Relay {
+	return &Relay{
+		Message: &Message{
+			Type: TypeRelay,
+		},
+		From:    from,
+		To:      to,
+		Channel: channel,
+		Payload: payload,
+	}
+}
+
+func NewRelayClose(from string, to string, channel string) *Relay {
+	return &Relay{
+		Message: &Message{
+			Type: TypeRelayClose,
+		},
+		From:    from,
+		To:      to,
+		Channel: channel,
+	}
+}
+
+type Goodbye struct {
+	*Message
+
+	From   string `json:"from" cbor:"2,keyasint"`
+	To     string `json:"to" cbor:"3,keyasint"`
+	Reason string `json:"reason,omitempty" cbor:"4,keyasint,omitempty"`
+}
+
+func NewGoodbye(from string, to string, reason string) *Goodbye {
+	return &Goodbye{
+		Message: &Message{
+			Type: TypeGoodbye,
+		},
+		From:   from,
+		To:     to,
+		Reason: reason,
+	}
+}
+
+type Mail struct {
+	*Message
+
+	From    string `json:"from" cbor:"2,keyasint"`
+	To      string `json:"to" cbor:"3,keyasint"`
+	Payload []byte `json:"payload" cbor:"4,keyasint"`
+	Sent    int64  `json:"sent" cbor:"5,keyasint"`
+}
+
+func NewMail(from string, to string, payload []byte, sent int64) *Mail {
+	return &Mail{
+		Message: &Message{
+			Type: TypeMail,
+		},
+		From:    from,
+		To:      to,
+		Payload: payload,
+		Sent:    sent,
+	}
+}
+
+type Envelope struct {
+	Community string `json:"community" cbor:"1,keyasint"`
+	Payload   []byte `json:"payload" cbor:"2,keyasint"`
+	To        string `json:"to,omitempty" cbor:"3,keyasint,omitempty"`
+	Mail      bool   `json:"mail,omitempty" cbor:"4,keyasint,omitempty"`
+}
+
+func NewEnvelope(community string, payload []byte) *Envelope {
+	return &Envelope{
+		Community: community,
+		Payload:   payload,
+	}
+}
+
+func NewRoutedEnvelope(community string, to string, payload []byte) *Envelope {
+	return &Envelope{
+		Community: community,
+		Payload:   payload,
+		To:        to,
+	}
+}
+
+func NewMailEnvelope(community string, to string, payload []byte) *Envelope {
+	return &Envelope{
+		Community: community,
+		Payload:   payload,
+		To:        to,
+		Mail:      true,
+	}
+}
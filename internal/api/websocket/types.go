@@ -5,4 +5,16 @@ const (
 	TypeOffer        = "offer"
 	TypeAnswer       = "answer"
 	TypeCandidate    = "candidate"
+
+	TypeEndOfCandidates = "end-of-candidates"
+
+	TypeRenegotiationOffer  = "renegotiation-offer"
+	TypeRenegotiationAnswer = "renegotiation-answer"
+
+	TypeRelay      = "relay"
+	TypeRelayClose = "relay-close"
+
+	TypeGoodbye = "goodbye"
+
+	TypeMail = "mail"
 )
@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	VersionJSON   = "weron.v1.json" // Messages are encoded as JSON and sent as text frames
+	VersionBinary = "weron.v2.cbor" // Messages are encoded as CBOR and sent as binary frames
+)
+
+var (
+	Versions = []string{VersionBinary, VersionJSON} // Supported versions in order of preference
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Marshal encodes a message using the encoding of the version
+func Marshal(version string, v interface{}) ([]byte, error) {
+	if version == VersionBinary {
+		return cbor.Marshal(v)
+	}
+
+	return json.Marshal(v)
+}
+
+// IsBinary returns whether a message has been encoded as CBOR
+func IsBinary(data []byte) bool {
+	// JSON messages are always objects; CBOR messages are always maps, which never start with `{`
+	return len(data) == 0 || data[0] != '{'
+}
+
+// Unmarshal decodes a message, detecting whether it has been encoded as JSON or CBOR
+func Unmarshal(data []byte, v interface{}) error {
+	if !IsBinary(data) {
+		return json.Unmarshal(data, v)
+	}
+
+	return cbor.Unmarshal(data, v)
+}
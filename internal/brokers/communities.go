@@ -1,15 +1,22 @@
 package brokers
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Kick struct {
-	Community string `json:"community"`
+	Community    string     `json:"community"`
+	JoinedBefore *time.Time `json:"joinedBefore,omitempty"` // Only kick clients which have joined before this time (nil kicks all clients)
 }
 
 type Input struct {
-	Raddr       string `json:"raddr"`
-	MessageType int    `json:"messageType"`
-	P           []byte `json:"p"`
+	Raddr        string   `json:"raddr"`
+	MessageType  int      `json:"messageType"`
+	P            []byte   `json:"p"`
+	Introduction bool     `json:"introduction"`
+	Exclude      []string `json:"exclude"`
+	To           string   `json:"to"`
 }
 
 type CommunitiesBroker interface {
@@ -13,15 +13,20 @@ var (
 	ErrCouldNotUnmarshalInput = errors.New("could not unmarshal input")
 )
 
+type communityInput struct {
+	community string
+	input     brokers.Input
+}
+
 type CommunitiesBroker struct {
 	kicks  *broadcast.Relay[brokers.Kick]
-	inputs *broadcast.Relay[brokers.Input]
+	inputs *broadcast.Relay[communityInput]
 }
 
 func NewCommunitiesBroker() *CommunitiesBroker {
 	return &CommunitiesBroker{
 		kicks:  broadcast.NewRelay[brokers.Kick](),
-		inputs: broadcast.NewRelay[brokers.Input](),
+		inputs: broadcast.NewRelay[communityInput](),
 	}
 }
 
@@ -40,7 +45,12 @@ func (c *CommunitiesBroker) SubscribeToKicks(ctx context.Context, errs chan erro
 			select {
 			case <-ctx.Done():
 				return
-			case kick := <-rawKicks:
+			case kick, ok := <-rawKicks:
+				// The listener has been closed
+				if !ok {
+					return
+				}
+
 				kicks <- kick
 			}
 		}
@@ -64,8 +74,18 @@ func (c *CommunitiesBroker) SubscribeToInputs(ctx context.Context, errs chan err
 			select {
 			case <-ctx.Done():
 				return
-			case input := <-rawInputs:
-				inputs <- input
+			case input, ok := <-rawInputs:
+				// The listener has been closed
+				if !ok {
+					return
+				}
+
+				// Only forward inputs for the subscribed community
+				if input.community != community {
+					continue
+				}
+
+				inputs <- input.input
 			}
 		}
 	}()
@@ -78,7 +98,7 @@ func (c *CommunitiesBroker) SubscribeToInputs(ctx context.Context, errs chan err
 }
 
 func (c *CommunitiesBroker) PublishInput(ctx context.Context, input brokers.Input, community string) error {
-	c.inputs.NotifyCtx(ctx, input)
+	c.inputs.NotifyCtx(ctx, communityInput{community, input})
 
 	return nil
 }
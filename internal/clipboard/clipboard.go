@@ -0,0 +1,10 @@
+package clipboard
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnsupported    = errors.New("clipboard access is only supported on Linux, macOS and Windows") // The clipboard was accessed on an unsupported platform
+	ErrMissingBackend = errors.New("neither wl-clipboard, xclip nor xsel could be found")            // No clipboard tool is installed
+)
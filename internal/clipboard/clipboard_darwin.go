@@ -0,0 +1,19 @@
+package clipboard
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// Read returns the content of the system clipboard
+func Read() ([]byte, error) {
+	return exec.Command("pbpaste").Output()
+}
+
+// Write sets the content of the system clipboard
+func Write(content []byte) error {
+	cmd := exec.Command("pbcopy")
+	cmd.Stdin = bytes.NewReader(content)
+
+	return cmd.Run()
+}
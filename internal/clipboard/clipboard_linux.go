@@ -0,0 +1,50 @@
+package clipboard
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func getCommands() ([]string, []string, error) {
+	if strings.TrimSpace(os.Getenv("WAYLAND_DISPLAY")) != "" {
+		if _, err := exec.LookPath("wl-paste"); err == nil {
+			return []string{"wl-paste", "--no-newline"}, []string{"wl-copy"}, nil
+		}
+	}
+
+	if _, err := exec.LookPath("xclip"); err == nil {
+		return []string{"xclip", "-selection", "clipboard", "-o"}, []string{"xclip", "-selection", "clipboard", "-i"}, nil
+	}
+
+	if _, err := exec.LookPath("xsel"); err == nil {
+		return []string{"xsel", "--clipboard", "--output"}, []string{"xsel", "--clipboard", "--input"}, nil
+	}
+
+	return nil, nil, ErrMissingBackend
+}
+
+// Read returns the content of the system clipboard
+func Read() ([]byte, error) {
+	read, _, err := getCommands()
+	if err != nil {
+		return nil, err
+	}
+
+	return exec.Command(read[0], read[1:]...).Output()
+}
+
+// Write sets the content of the system clipboard
+func Write(content []byte) error {
+	_, write, err := getCommands()
+	if err != nil {
+		return err
+	}
+
+	// The tools keep running in the background to serve the clipboard, so their output must not be captured
+	cmd := exec.Command(write[0], write[1:]...)
+	cmd.Stdin = bytes.NewReader(content)
+
+	return cmd.Run()
+}
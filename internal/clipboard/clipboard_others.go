@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || windows)
+// +build !linux,!darwin,!windows
+
+package clipboard
+
+// Read returns the content of the system clipboard
+func Read() ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// Write sets the content of the system clipboard
+func Write(content []byte) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,19 @@
+package clipboard
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// Read returns the content of the system clipboard
+func Read() ([]byte, error) {
+	return exec.Command("powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw").Output()
+}
+
+// Write sets the content of the system clipboard
+func Write(content []byte) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-Command", "[Console]::In.ReadToEnd() | Set-Clipboard")
+	cmd.Stdin = bytes.NewReader(content)
+
+	return cmd.Run()
+}
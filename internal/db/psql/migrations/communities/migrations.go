@@ -34,6 +34,60 @@ func db_psql_migrations_communities_1646780237_sql() ([]byte, error) {
 	)
 }
 
+var _db_psql_migrations_communities_1792053947_sql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x6d\x8f\x5b\x0a\x02\x31\x0c\x45\xff\xbb\x8a\x7c\xb6\x38\xb3\x82\xf9\x75\x0b\x2e\x20\xb6\x57\x29\xf6\x45\xda\x41\xbb\x7b\xab\xa8\x38\x30\x81\x40\x38\x5c\x0e\xb9\xf3\x4c\x87\xe8\xaf\xc2\x0d\x74\x2a\xca\x0a\x5e\x57\xe3\x73\x00\x05\x70\x45\x25\xad\x68\x8c\xcd\x31\xae\xc9\xb7\x4e\x0d\x8f\x46\x29\x8f\x5d\x43\x20\xc1\x05\x82\x64\x47\xf0\x1b\xf1\xa8\xda\x3b\x43\x39\x91\x43\xc0\xf0\x59\xae\x96\x1d\xa6\xb7\xc9\xbb\xad\xe2\x43\x4b\xdd\xc3\x89\x23\xf6\x78\x11\x1f\x59\x3a\xdd\xd0\x49\xff\x7e\x9b\x86\xdc\x28\xb3\xa8\xf9\xaf\xd6\x31\xdf\x93\x72\x92\xcb\xa6\xd6\xf2\x04\x0f\xd4\xc9\xaf\xfa\x00\x00\x00")
+
+func db_psql_migrations_communities_1792053947_sql() ([]byte, error) {
+	return bindata_read(
+		_db_psql_migrations_communities_1792053947_sql,
+		"../../../db/psql/migrations/communities/1792053947.sql",
+	)
+}
+
+var _db_psql_migrations_communities_1792140347_sql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x75\xcc\x31\x0a\x80\x30\x0c\x00\xc0\xdd\x57\x64\x97\xbe\xa0\xab\x5f\x70\x96\x68\x83\x04\x9a\x36\xa4\x29\x8a\xaf\xd7\x51\x10\xc7\x5b\x2e\x04\x18\x85\x77\x43\x27\x98\x75\xc0\xec\x64\xe0\xb8\x66\x82\xad\x8a\xf4\xc2\xce\xd4\x00\x53\x7a\x9c\xbb\x14\xa0\x53\xd9\xa8\x2d\xe8\xe0\x2c\xd4\x1c\x45\xfd\x8a\x43\x78\x4d\x53\x3d\xca\xef\x95\xac\xea\x37\x8b\x37\xe6\x20\x9c\x95\x8a\x00\x00\x00")
+
+func db_psql_migrations_communities_1792140347_sql() ([]byte, error) {
+	return bindata_read(
+		_db_psql_migrations_communities_1792140347_sql,
+		"../../../db/psql/migrations/communities/1792140347.sql",
+	)
+}
+
+var _db_psql_migrations_communities_1792226747_sql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa5\x91\xc1\x0a\x02\x31\x0c\x44\xef\xfb\x15\xb9\xcb\x82\xf7\x5e\xfd\x05\xcf\x4b\x76\x1b\x4b\x30\x4d\xcb\x36\x55\xd6\xaf\xb7\x08\xc2\x1e\x14\x8a\x1e\x13\x66\x1e\xc9\xcc\x38\xc2\x21\x72\x58\xd1\x08\xce\x79\x40\x31\x5a\xc1\x70\x16\x82\x25\xc5\x58\x95\x8d\xa9\x00\x7a\xdf\x66\xa9\x51\x21\x13\x5e\xa7\x45\x98\xd4\x0a\xb0\x1a\x85\xe6\xd0\x64\xa0\x55\x04\x3c\x5d\xb0\x8a\xc1\xd1\xf5\xb0\x22\x95\x82\xa1\xed\x66\x0e\x0d\xf5\x2b\x66\xde\xec\x6f\x86\x60\xb1\x09\x17\xe3\x1b\xdb\x06\xc6\xed\x34\xc3\x98\xed\xe1\x86\x71\x97\xd1\x29\xdd\xf5\x2b\xce\xaf\x29\x7f\xe4\xb9\x2e\xcb\xeb\x8d\x3e\xe9\x3b\xb8\x3e\xf5\xbe\x32\xf7\x04\xe9\xbb\xf6\xff\xf2\x01\x00\x00")
+
+func db_psql_migrations_communities_1792226747_sql() ([]byte, error) {
+	return bindata_read(
+		_db_psql_migrations_communities_1792226747_sql,
+		"../../../db/psql/migrations/communities/1792226747.sql",
+	)
+}
+
+var _db_psql_migrations_communities_1792313147_sql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x5c\xcf\x4d\x4e\xc4\x30\x0c\xc5\xf1\x7d\x4e\xf1\x96\xad\x98\x39\xc1\x6c\xb9\x02\x6b\xe4\x26\xaf\xc8\xc2\x71\xaa\xc4\x15\x94\xd3\x23\x3e\x34\x30\xb3\xb3\x2c\xeb\x27\xff\xcf\x67\x3c\x54\x7d\xe9\x12\xc4\xd3\x96\x72\xe7\xd7\x14\xb2\x18\x51\x59\x17\xf6\x81\x29\x01\x40\x6e\xb5\xee\xae\x71\x20\xf8\x1e\xf0\x16\xf0\xdd\x0c\x9d\x2b\x3b\x3d\x73\x5c\x4f\x94\x63\xd2\x32\xa3\x39\x0a\x8d\x41\x64\x19\x59\x0a\x4f\xdf\x92\x96\x5b\xe2\x67\xdb\xdc\xd4\x89\xa5\x35\xa3\xf8\x9f\x5f\xb8\xca\x6e\x81\x55\x6c\xfc\x02\x26\x23\x9e\x07\xe9\x08\xad\x1c\x21\x75\x8b\x8f\x3b\x6e\xeb\x5a\xa5\x1f\x78\xe5\x81\xe9\xfa\xfb\x09\x5a\xe6\x34\x5f\xd2\xff\xee\xc7\xf6\xe6\xa9\xf4\xb6\xdd\x76\x5f\x3e\x07\x00\x18\xd6\x40\x9a\x1c\x01\x00\x00")
+
+func db_psql_migrations_communities_1792313147_sql() ([]byte, error) {
+	return bindata_read(
+		_db_psql_migrations_communities_1792313147_sql,
+		"../../../db/psql/migrations/communities/1792313147.sql",
+	)
+}
+
+var _db_psql_migrations_communities_1792399547_sql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\xcf\x31\x0a\xc3\x30\x0c\x85\xe1\x3d\xa7\x78\x5b\x86\x12\xe8\xee\xb5\x57\xe8\x1c\x94\x58\x75\x0d\xb2\x14\x6c\x99\xb6\xb7\x2f\x74\xca\x90\x42\x0e\xf0\x3e\xde\x3f\x4d\xb8\x94\x9c\x2a\x39\xe3\xbe\x0d\x24\xce\x15\x4e\x8b\x30\x56\x2b\xa5\x6b\xf6\xcc\x0d\x14\x23\x56\x93\x5e\x14\xbd\x51\xe2\xb9\x98\xfa\x13\xce\x6f\x87\x9a\x43\xbb\x08\x22\x3f\xa8\x8b\x63\x1c\xc3\x19\xe8\x47\xcc\xcb\xc7\xb9\x61\xc9\x29\xeb\x01\x75\x0d\xc3\xfe\xe1\xcd\x5e\xfa\x97\x8e\xd5\xb6\x03\x3b\x9c\x1a\xec\xaa\xc2\x77\x00\xf5\x5f\x0e\xb0\x14\x01\x00\x00")
+
+func db_psql_migrations_communities_1792399547_sql() ([]byte, error) {
+	return bindata_read(
+		_db_psql_migrations_communities_1792399547_sql,
+		"../../../db/psql/migrations/communities/1792399547.sql",
+	)
+}
+
+var _db_psql_migrations_communities_1792485947_sql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x74\x90\x4d\x6a\xc3\x30\x14\x84\xf7\x3e\xc5\x2c\x6d\x9a\x9c\xc0\xdb\x5e\xa1\xeb\xf0\x2c\x4d\xc2\xa3\xfa\x43\x7a\x26\x76\x4f\x5f\x12\xa7\x4e\x5a\xe8\xee\xc1\x8c\x3e\x46\xdf\xf1\x88\xb7\xa8\x97\x2a\x46\x7c\x94\xce\x55\xde\x2e\x93\x29\x10\x51\x34\xa0\xef\x00\xa0\xb1\xaa\x04\x4c\x7a\x79\x5c\xa5\x6a\x94\xba\xe2\x93\xeb\xe1\xde\x70\x39\xc6\x39\xa9\xad\x30\x2e\x86\x94\x0d\x69\x0e\x01\x95\x67\x56\x26\xc7\xb6\x57\x94\xad\x57\x3f\x20\x27\x78\x06\x1a\xe1\xa4\x39\xf1\xdc\x48\x95\x4e\x8b\x32\xd9\x6f\xd2\x16\x16\x59\x43\x16\x8f\x69\x35\xca\x9f\x6c\x1b\xef\x4f\x62\x30\x8d\x6c\x26\xb1\xd8\xd7\x5e\x82\xe7\x59\xe6\x70\x23\x5e\xfb\x61\xc3\x71\x29\x5a\xd9\xfe\x7b\xd2\x0d\xe3\x8f\x12\x4d\x9e\xcb\x5d\xc9\xe9\x39\x30\xa7\x87\xa4\xfd\xf7\x87\xe7\xfc\x61\xec\x5e\xed\xbe\xe7\x6b\xea\x7c\xcd\xe5\xc5\xee\xf8\x3d\x00\x4a\x2f\xe7\xbd\x7f\x01\x00\x00")
+
+func db_psql_migrations_communities_1792485947_sql() ([]byte, error) {
+	return bindata_read(
+		_db_psql_migrations_communities_1792485947_sql,
+		"../../../db/psql/migrations/communities/1792485947.sql",
+	)
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -57,6 +111,12 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() ([]byte, error){
 	"../../../db/psql/migrations/communities/1646780237.sql": db_psql_migrations_communities_1646780237_sql,
+	"../../../db/psql/migrations/communities/1792053947.sql": db_psql_migrations_communities_1792053947_sql,
+	"../../../db/psql/migrations/communities/1792140347.sql": db_psql_migrations_communities_1792140347_sql,
+	"../../../db/psql/migrations/communities/1792226747.sql": db_psql_migrations_communities_1792226747_sql,
+	"../../../db/psql/migrations/communities/1792313147.sql": db_psql_migrations_communities_1792313147_sql,
+	"../../../db/psql/migrations/communities/1792399547.sql": db_psql_migrations_communities_1792399547_sql,
+	"../../../db/psql/migrations/communities/1792485947.sql": db_psql_migrations_communities_1792485947_sql,
 }
 // AssetDir returns the file names below a certain
 // directory embedded in the file by go-bindata.
@@ -107,6 +167,18 @@ var _bintree = &_bintree_t{nil, map[string]*_bintree_t{
 							"communities": &_bintree_t{nil, map[string]*_bintree_t{
 								"1646780237.sql": &_bintree_t{db_psql_migrations_communities_1646780237_sql, map[string]*_bintree_t{
 								}},
+								"1792053947.sql": &_bintree_t{db_psql_migrations_communities_1792053947_sql, map[string]*_bintree_t{
+								}},
+								"1792140347.sql": &_bintree_t{db_psql_migrations_communities_1792140347_sql, map[string]*_bintree_t{
+								}},
+								"1792226747.sql": &_bintree_t{db_psql_migrations_communities_1792226747_sql, map[string]*_bintree_t{
+								}},
+								"1792313147.sql": &_bintree_t{db_psql_migrations_communities_1792313147_sql, map[string]*_bintree_t{
+								}},
+								"1792399547.sql": &_bintree_t{db_psql_migrations_communities_1792399547_sql, map[string]*_bintree_t{
+								}},
+								"1792485947.sql": &_bintree_t{db_psql_migrations_communities_1792485947_sql, map[string]*_bintree_t{
+								}},
 							}},
 						}},
 					}},
@@ -6,7 +6,13 @@ package models
 var TableNames = struct {
 	Communities    string
 	GorpMigrations string
+	Leases         string
+	Mail           string
+	Members        string
 }{
 	Communities:    "communities",
 	GorpMigrations: "gorp_migrations",
+	Leases:         "leases",
+	Mail:           "mail",
+	Members:        "members",
 }
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/friendsofgo/errors"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
@@ -23,37 +24,72 @@ import (
 
 // Community is an object representing the database table.
 type Community struct {
-	ID         string `boil:"id" json:"id" toml:"id" yaml:"id"`
-	Password   string `boil:"password" json:"password" toml:"password" yaml:"password"`
-	Clients    int    `boil:"clients" json:"clients" toml:"clients" yaml:"clients"`
-	Persistent bool   `boil:"persistent" json:"persistent" toml:"persistent" yaml:"persistent"`
+	ID           string    `boil:"id" json:"id" toml:"id" yaml:"id"`
+	Password     string    `boil:"password" json:"password" toml:"password" yaml:"password"`
+	Clients      int       `boil:"clients" json:"clients" toml:"clients" yaml:"clients"`
+	Persistent   bool      `boil:"persistent" json:"persistent" toml:"persistent" yaml:"persistent"`
+	ExpiresAt    null.Time `boil:"expires_at" json:"expires_at,omitempty" toml:"expires_at" yaml:"expires_at,omitempty"`
+	PeakClients  int       `boil:"peak_clients" json:"peak_clients" toml:"peak_clients" yaml:"peak_clients"`
+	Messages     int64     `boil:"messages" json:"messages" toml:"messages" yaml:"messages"`
+	Bytes        int64     `boil:"bytes" json:"bytes" toml:"bytes" yaml:"bytes"`
+	LastActivity null.Time `boil:"last_activity" json:"last_activity,omitempty" toml:"last_activity" yaml:"last_activity,omitempty"`
+	UsageMonth   string    `boil:"usage_month" json:"usage_month" toml:"usage_month" yaml:"usage_month"`
+	MonthBytes   int64     `boil:"month_bytes" json:"month_bytes" toml:"month_bytes" yaml:"month_bytes"`
 
 	R *communityR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L communityL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var CommunityColumns = struct {
-	ID         string
-	Password   string
-	Clients    string
-	Persistent string
+	ID           string
+	Password     string
+	Clients      string
+	Persistent   string
+	ExpiresAt    string
+	PeakClients  string
+	Messages     string
+	Bytes        string
+	LastActivity string
+	UsageMonth   string
+	MonthBytes   string
 }{
-	ID:         "id",
-	Password:   "password",
-	Clients:    "clients",
-	Persistent: "persistent",
+	ID:           "id",
+	Password:     "password",
+	Clients:      "clients",
+	Persistent:   "persistent",
+	ExpiresAt:    "expires_at",
+	PeakClients:  "peak_clients",
+	Messages:     "messages",
+	Bytes:        "bytes",
+	LastActivity: "last_activity",
+	UsageMonth:   "usage_month",
+	MonthBytes:   "month_bytes",
 }
 
 var CommunityTableColumns = struct {
-	ID         string
-	Password   string
-	Clients    string
-	Persistent string
+	ID           string
+	Password     string
+	Clients      string
+	Persistent   string
+	ExpiresAt    string
+	PeakClients  string
+	Messages     string
+	Bytes        string
+	LastActivity string
+	UsageMonth   string
+	MonthBytes   string
 }{
-	ID:         "communities.id",
-	Password:   "communities.password",
-	Clients:    "communities.clients",
-	Persistent: "communities.persistent",
+	ID:           "communities.id",
+	Password:     "communities.password",
+	Clients:      "communities.clients",
+	Persistent:   "communities.persistent",
+	ExpiresAt:    "communities.expires_at",
+	PeakClients:  "communities.peak_clients",
+	Messages:     "communities.messages",
+	Bytes:        "communities.bytes",
+	LastActivity: "communities.last_activity",
+	UsageMonth:   "communities.usage_month",
+	MonthBytes:   "communities.month_bytes",
 }
 
 // Generated where
@@ -113,24 +149,95 @@ func (w whereHelperbool) LTE(x bool) qm.QueryMod { return qmhelper.Where(w.field
 func (w whereHelperbool) GT(x bool) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.GT, x) }
 func (w whereHelperbool) GTE(x bool) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.GTE, x) }
 
+type whereHelpernull_Time struct{ field string }
+
+func (w whereHelpernull_Time) EQ(x null.Time) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, false, x)
+}
+func (w whereHelpernull_Time) NEQ(x null.Time) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, true, x)
+}
+func (w whereHelpernull_Time) LT(x null.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LT, x)
+}
+func (w whereHelpernull_Time) LTE(x null.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LTE, x)
+}
+func (w whereHelpernull_Time) GT(x null.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GT, x)
+}
+func (w whereHelpernull_Time) GTE(x null.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GTE, x)
+}
+
+func (w whereHelpernull_Time) IsNull() qm.QueryMod    { return qmhelper.WhereIsNull(w.field) }
+func (w whereHelpernull_Time) IsNotNull() qm.QueryMod { return qmhelper.WhereIsNotNull(w.field) }
+
+type whereHelperint64 struct{ field string }
+
+func (w whereHelperint64) EQ(x int64) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.EQ, x) }
+func (w whereHelperint64) NEQ(x int64) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.NEQ, x) }
+func (w whereHelperint64) LT(x int64) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.LT, x) }
+func (w whereHelperint64) LTE(x int64) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.LTE, x) }
+func (w whereHelperint64) GT(x int64) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.GT, x) }
+func (w whereHelperint64) GTE(x int64) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.GTE, x) }
+func (w whereHelperint64) IN(slice []int64) qm.QueryMod {
+	values := make([]interface{}, 0, len(slice))
+	for _, value := range slice {
+		values = append(values, value)
+	}
+	return qm.WhereIn(fmt.Sprintf("%s IN ?", w.field), values...)
+}
+func (w whereHelperint64) NIN(slice []int64) qm.QueryMod {
+	values := make([]interface{}, 0, len(slice))
+	for _, value := range slice {
+		values = append(values, value)
+	}
+	return qm.WhereNotIn(fmt.Sprintf("%s NOT IN ?", w.field), values...)
+}
+
 var CommunityWhere = struct {
-	ID         whereHelperstring
-	Password   whereHelperstring
-	Clients    whereHelperint
-	Persistent whereHelperbool
+	ID           whereHelperstring
+	Password     whereHelperstring
+	Clients      whereHelperint
+	Persistent   whereHelperbool
+	ExpiresAt    whereHelpernull_Time
+	PeakClients  whereHelperint
+	Messages     whereHelperint64
+	Bytes        whereHelperint64
+	LastActivity whereHelpernull_Time
+	UsageMonth   whereHelperstring
+	MonthBytes   whereHelperint64
 }{
-	ID:         whereHelperstring{field: "\"communities\".\"id\""},
-	Password:   whereHelperstring{field: "\"communities\".\"password\""},
-	Clients:    whereHelperint{field: "\"communities\".\"clients\""},
-	Persistent: whereHelperbool{field: "\"communities\".\"persistent\""},
+	ID:           whereHelperstring{field: "\"communities\".\"id\""},
+	Password:     whereHelperstring{field: "\"communities\".\"password\""},
+	Clients:      whereHelperint{field: "\"communities\".\"clients\""},
+	Persistent:   whereHelperbool{field: "\"communities\".\"persistent\""},
+	ExpiresAt:    whereHelpernull_Time{field: "\"communities\".\"expires_at\""},
+	PeakClients:  whereHelperint{field: "\"communities\".\"peak_clients\""},
+	Messages:     whereHelperint64{field: "\"communities\".\"messages\""},
+	Bytes:        whereHelperint64{field: "\"communities\".\"bytes\""},
+	LastActivity: whereHelpernull_Time{field: "\"communities\".\"last_activity\""},
+	UsageMonth:   whereHelperstring{field: "\"communities\".\"usage_month\""},
+	MonthBytes:   whereHelperint64{field: "\"communities\".\"month_bytes\""},
 }
 
 // CommunityRels is where relationship names are stored.
 var CommunityRels = struct {
-}{}
+	Leases  string
+	Mails   string
+	Members string
+}{
+	Leases:  "Leases",
+	Mails:   "Mails",
+	Members: "Members",
+}
 
 // communityR is where relationships are stored.
 type communityR struct {
+	Leases  LeaseSlice  `boil:"Leases" json:"Leases" toml:"Leases" yaml:"Leases"`
+	Mails   MailSlice   `boil:"Mails" json:"Mails" toml:"Mails" yaml:"Mails"`
+	Members MemberSlice `boil:"Members" json:"Members" toml:"Members" yaml:"Members"`
 }
 
 // NewStruct creates a new relationship struct
@@ -138,13 +245,34 @@ func (*communityR) NewStruct() *communityR {
 	return &communityR{}
 }
 
+func (r *communityR) GetLeases() LeaseSlice {
+	if r == nil {
+		return nil
+	}
+	return r.Leases
+}
+
+func (r *communityR) GetMails() MailSlice {
+	if r == nil {
+		return nil
+	}
+	return r.Mails
+}
+
+func (r *communityR) GetMembers() MemberSlice {
+	if r == nil {
+		return nil
+	}
+	return r.Members
+}
+
 // communityL is where Load methods for each relationship are stored.
 type communityL struct{}
 
 var (
-	communityAllColumns            = []string{"id", "password", "clients", "persistent"}
+	communityAllColumns            = []string{"id", "password", "clients", "persistent", "expires_at", "peak_clients", "messages", "bytes", "last_activity", "usage_month", "month_bytes"}
 	communityColumnsWithoutDefault = []string{"id", "password", "clients", "persistent"}
-	communityColumnsWithDefault    = []string{}
+	communityColumnsWithDefault    = []string{"expires_at", "peak_clients", "messages", "bytes", "last_activity", "usage_month", "month_bytes"}
 	communityPrimaryKeyColumns     = []string{"id"}
 	communityGeneratedColumns      = []string{}
 )
@@ -427,6 +555,501 @@ func (q communityQuery) Exists(ctx context.Context, exec boil.ContextExecutor) (
 	return count > 0, nil
 }
 
+// Leases retrieves all the lease's Leases with an executor.
+func (o *Community) Leases(mods ...qm.QueryMod) leaseQuery {
+	var queryMods []qm.QueryMod
+	if len(mods) != 0 {
+		queryMods = append(queryMods, mods...)
+	}
+
+	queryMods = append(queryMods,
+		qm.Where("\"leases\".\"community\"=?", o.ID),
+	)
+
+	return Leases(queryMods...)
+}
+
+// Mails retrieves all the mail's Mails with an executor.
+func (o *Community) Mails(mods ...qm.QueryMod) mailQuery {
+	var queryMods []qm.QueryMod
+	if len(mods) != 0 {
+		queryMods = append(queryMods, mods...)
+	}
+
+	queryMods = append(queryMods,
+		qm.Where("\"mail\".\"community\"=?", o.ID),
+	)
+
+	return Mails(queryMods...)
+}
+
+// Members retrieves all the member's Members with an executor.
+func (o *Community) Members(mods ...qm.QueryMod) memberQuery {
+	var queryMods []qm.QueryMod
+	if len(mods) != 0 {
+		queryMods = append(queryMods, mods...)
+	}
+
+	queryMods = append(queryMods,
+		qm.Where("\"members\".\"community\"=?", o.ID),
+	)
+
+	return Members(queryMods...)
+}
+
+// LoadLeases allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for a 1-M or N-M relationship.
+func (communityL) LoadLeases(ctx context.Context, e boil.ContextExecutor, singular bool, maybeCommunity interface{}, mods queries.Applicator) error {
+	var slice []*Community
+	var object *Community
+
+	if singular {
+		object = maybeCommunity.(*Community)
+	} else {
+		slice = *maybeCommunity.(*[]*Community)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &communityR{}
+		}
+		args = append(args, object.ID)
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &communityR{}
+			}
+
+			for _, a := range args {
+				if a == obj.ID {
+					continue Outer
+				}
+			}
+
+			args = append(args, obj.ID)
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`leases`),
+		qm.WhereIn(`leases.community in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load leases")
+	}
+
+	var resultSlice []*Lease
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice leases")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results in eager load on leases")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for leases")
+	}
+
+	if len(leaseAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+	if singular {
+		object.R.Leases = resultSlice
+		for _, foreign := range resultSlice {
+			if foreign.R == nil {
+				foreign.R = &leaseR{}
+			}
+			foreign.R.LeaseCommunity = object
+		}
+		return nil
+	}
+
+	for _, foreign := range resultSlice {
+		for _, local := range slice {
+			if local.ID == foreign.Community {
+				local.R.Leases = append(local.R.Leases, foreign)
+				if foreign.R == nil {
+					foreign.R = &leaseR{}
+				}
+				foreign.R.LeaseCommunity = local
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadMails allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for a 1-M or N-M relationship.
+func (communityL) LoadMails(ctx context.Context, e boil.ContextExecutor, singular bool, maybeCommunity interface{}, mods queries.Applicator) error {
+	var slice []*Community
+	var object *Community
+
+	if singular {
+		object = maybeCommunity.(*Community)
+	} else {
+		slice = *maybeCommunity.(*[]*Community)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &communityR{}
+		}
+		args = append(args, object.ID)
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &communityR{}
+			}
+
+			for _, a := range args {
+				if a == obj.ID {
+					continue Outer
+				}
+			}
+
+			args = append(args, obj.ID)
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`mail`),
+		qm.WhereIn(`mail.community in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load mail")
+	}
+
+	var resultSlice []*Mail
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice mail")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results in eager load on mail")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for mail")
+	}
+
+	if len(mailAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+	if singular {
+		object.R.Mails = resultSlice
+		for _, foreign := range resultSlice {
+			if foreign.R == nil {
+				foreign.R = &mailR{}
+			}
+			foreign.R.MailCommunity = object
+		}
+		return nil
+	}
+
+	for _, foreign := range resultSlice {
+		for _, local := range slice {
+			if local.ID == foreign.Community {
+				local.R.Mails = append(local.R.Mails, foreign)
+				if foreign.R == nil {
+					foreign.R = &mailR{}
+				}
+				foreign.R.MailCommunity = local
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadMembers allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for a 1-M or N-M relationship.
+func (communityL) LoadMembers(ctx context.Context, e boil.ContextExecutor, singular bool, maybeCommunity interface{}, mods queries.Applicator) error {
+	var slice []*Community
+	var object *Community
+
+	if singular {
+		object = maybeCommunity.(*Community)
+	} else {
+		slice = *maybeCommunity.(*[]*Community)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &communityR{}
+		}
+		args = append(args, object.ID)
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &communityR{}
+			}
+
+			for _, a := range args {
+				if a == obj.ID {
+					continue Outer
+				}
+			}
+
+			args = append(args, obj.ID)
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`members`),
+		qm.WhereIn(`members.community in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load members")
+	}
+
+	var resultSlice []*Member
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice members")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results in eager load on members")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for members")
+	}
+
+	if len(memberAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+	if singular {
+		object.R.Members = resultSlice
+		for _, foreign := range resultSlice {
+			if foreign.R == nil {
+				foreign.R = &memberR{}
+			}
+			foreign.R.MemberCommunity = object
+		}
+		return nil
+	}
+
+	for _, foreign := range resultSlice {
+		for _, local := range slice {
+			if local.ID == foreign.Community {
+				local.R.Members = append(local.R.Members, foreign)
+				if foreign.R == nil {
+					foreign.R = &memberR{}
+				}
+				foreign.R.MemberCommunity = local
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddLeases adds the given related objects to the existing relationships
+// of the community, optionally inserting them as new records.
+// Appends related to o.R.Leases.
+// Sets related.R.LeaseCommunity appropriately.
+func (o *Community) AddLeases(ctx context.Context, exec boil.ContextExecutor, insert bool, related ...*Lease) error {
+	var err error
+	for _, rel := range related {
+		if insert {
+			rel.Community = o.ID
+			if err = rel.Insert(ctx, exec, boil.Infer()); err != nil {
+				return errors.Wrap(err, "failed to insert into foreign table")
+			}
+		} else {
+			updateQuery := fmt.Sprintf(
+				"UPDATE \"leases\" SET %s WHERE %s",
+				strmangle.SetParamNames("\"", "\"", 1, []string{"community"}),
+				strmangle.WhereClause("\"", "\"", 2, leasePrimaryKeyColumns),
+			)
+			values := []interface{}{o.ID, rel.Community, rel.ID}
+
+			if boil.IsDebug(ctx) {
+				writer := boil.DebugWriterFrom(ctx)
+				fmt.Fprintln(writer, updateQuery)
+				fmt.Fprintln(writer, values)
+			}
+			if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+				return errors.Wrap(err, "failed to update foreign table")
+			}
+
+			rel.Community = o.ID
+		}
+	}
+
+	if o.R == nil {
+		o.R = &communityR{
+			Leases: related,
+		}
+	} else {
+		o.R.Leases = append(o.R.Leases, related...)
+	}
+
+	for _, rel := range related {
+		if rel.R == nil {
+			rel.R = &leaseR{
+				LeaseCommunity: o,
+			}
+		} else {
+			rel.R.LeaseCommunity = o
+		}
+	}
+	return nil
+}
+
+// AddMails adds the given related objects to the existing relationships
+// of the community, optionally inserting them as new records.
+// Appends related to o.R.Mails.
+// Sets related.R.MailCommunity appropriately.
+func (o *Community) AddMails(ctx context.Context, exec boil.ContextExecutor, insert bool, related ...*Mail) error {
+	var err error
+	for _, rel := range related {
+		if insert {
+			rel.Community = o.ID
+			if err = rel.Insert(ctx, exec, boil.Infer()); err != nil {
+				return errors.Wrap(err, "failed to insert into foreign table")
+			}
+		} else {
+			updateQuery := fmt.Sprintf(
+				"UPDATE \"mail\" SET %s WHERE %s",
+				strmangle.SetParamNames("\"", "\"", 1, []string{"community"}),
+				strmangle.WhereClause("\"", "\"", 2, mailPrimaryKeyColumns),
+			)
+			values := []interface{}{o.ID, rel.Serial}
+
+			if boil.IsDebug(ctx) {
+				writer := boil.DebugWriterFrom(ctx)
+				fmt.Fprintln(writer, updateQuery)
+				fmt.Fprintln(writer, values)
+			}
+			if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+				return errors.Wrap(err, "failed to update foreign table")
+			}
+
+			rel.Community = o.ID
+		}
+	}
+
+	if o.R == nil {
+		o.R = &communityR{
+			Mails: related,
+		}
+	} else {
+		o.R.Mails = append(o.R.Mails, related...)
+	}
+
+	for _, rel := range related {
+		if rel.R == nil {
+			rel.R = &mailR{
+				MailCommunity: o,
+			}
+		} else {
+			rel.R.MailCommunity = o
+		}
+	}
+	return nil
+}
+
+// AddMembers adds the given related objects to the existing relationships
+// of the community, optionally inserting them as new records.
+// Appends related to o.R.Members.
+// Sets related.R.MemberCommunity appropriately.
+func (o *Community) AddMembers(ctx context.Context, exec boil.ContextExecutor, insert bool, related ...*Member) error {
+	var err error
+	for _, rel := range related {
+		if insert {
+			rel.Community = o.ID
+			if err = rel.Insert(ctx, exec, boil.Infer()); err != nil {
+				return errors.Wrap(err, "failed to insert into foreign table")
+			}
+		} else {
+			updateQuery := fmt.Sprintf(
+				"UPDATE \"members\" SET %s WHERE %s",
+				strmangle.SetParamNames("\"", "\"", 1, []string{"community"}),
+				strmangle.WhereClause("\"", "\"", 2, memberPrimaryKeyColumns),
+			)
+			values := []interface{}{o.ID, rel.Community, rel.ID}
+
+			if boil.IsDebug(ctx) {
+				writer := boil.DebugWriterFrom(ctx)
+				fmt.Fprintln(writer, updateQuery)
+				fmt.Fprintln(writer, values)
+			}
+			if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+				return errors.Wrap(err, "failed to update foreign table")
+			}
+
+			rel.Community = o.ID
+		}
+	}
+
+	if o.R == nil {
+		o.R = &communityR{
+			Members: related,
+		}
+	} else {
+		o.R.Members = append(o.R.Members, related...)
+	}
+
+	for _, rel := range related {
+		if rel.R == nil {
+			rel.R = &memberR{
+				MemberCommunity: o,
+			}
+		} else {
+			rel.R.MemberCommunity = o
+		}
+	}
+	return nil
+}
+
 // Communities retrieves all the records using an executor.
 func Communities(mods ...qm.QueryMod) communityQuery {
 	mods = append(mods, qm.From("\"communities\""))
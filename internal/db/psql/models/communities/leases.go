@@ -0,0 +1,1077 @@
+// Code generated by SQLBoiler 4.11.0 (https://github.com/volatiletech/sqlboiler). DO NOT EDIT.
+// This file is meant to be re-generated in place and/or deleted at any time.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/friendsofgo/errors"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"github.com/volatiletech/sqlboiler/v4/queries/qmhelper"
+	"github.com/volatiletech/strmangle"
+)
+
+// Lease is an object representing the database table.
+type Lease struct {
+	Community string `boil:"community" json:"community" toml:"community" yaml:"community"`
+	ID        string `boil:"id" json:"id" toml:"id" yaml:"id"`
+	Ips       string `boil:"ips" json:"ips" toml:"ips" yaml:"ips"`
+	Name      string `boil:"name" json:"name" toml:"name" yaml:"name"`
+
+	R *leaseR `boil:"-" json:"-" toml:"-" yaml:"-"`
+	L leaseL  `boil:"-" json:"-" toml:"-" yaml:"-"`
+}
+
+var LeaseColumns = struct {
+	Community string
+	ID        string
+	Ips       string
+	Name      string
+}{
+	Community: "community",
+	ID:        "id",
+	Ips:       "ips",
+	Name:      "name",
+}
+
+var LeaseTableColumns = struct {
+	Community string
+	ID        string
+	Ips       string
+	Name      string
+}{
+	Community: "leases.community",
+	ID:        "leases.id",
+	Ips:       "leases.ips",
+	Name:      "leases.name",
+}
+
+// Generated where
+
+var LeaseWhere = struct {
+	Community whereHelperstring
+	ID        whereHelperstring
+	Ips       whereHelperstring
+	Name      whereHelperstring
+}{
+	Community: whereHelperstring{field: "\"leases\".\"community\""},
+	ID:        whereHelperstring{field: "\"leases\".\"id\""},
+	Ips:       whereHelperstring{field: "\"leases\".\"ips\""},
+	Name:      whereHelperstring{field: "\"leases\".\"name\""},
+}
+
+// LeaseRels is where relationship names are stored.
+var LeaseRels = struct {
+	LeaseCommunity string
+}{
+	LeaseCommunity: "LeaseCommunity",
+}
+
+// leaseR is where relationships are stored.
+type leaseR struct {
+	LeaseCommunity *Community `boil:"LeaseCommunity" json:"LeaseCommunity" toml:"LeaseCommunity" yaml:"LeaseCommunity"`
+}
+
+// NewStruct creates a new relationship struct
+func (*leaseR) NewStruct() *leaseR {
+	return &leaseR{}
+}
+
+func (r *leaseR) GetLeaseCommunity() *Community {
+	if r == nil {
+		return nil
+	}
+	return r.LeaseCommunity
+}
+
+// leaseL is where Load methods for each relationship are stored.
+type leaseL struct{}
+
+var (
+	leaseAllColumns            = []string{"community", "id", "ips", "name"}
+	leaseColumnsWithoutDefault = []string{"community", "id", "ips", "name"}
+	leaseColumnsWithDefault    = []string{}
+	leasePrimaryKeyColumns     = []string{"community", "id"}
+	leaseGeneratedColumns      = []string{}
+)
+
+type (
+	// LeaseSlice is an alias for a slice of pointers to Lease.
+	// This should almost always be used instead of []Lease.
+	LeaseSlice []*Lease
+	// LeaseHook is the signature for custom Lease hook methods
+	LeaseHook func(context.Context, boil.ContextExecutor, *Lease) error
+
+	leaseQuery struct {
+		*queries.Query
+	}
+)
+
+// Cache for insert, update and upsert
+var (
+	leaseType                 = reflect.TypeOf(&Lease{})
+	leaseMapping              = queries.MakeStructMapping(leaseType)
+	leasePrimaryKeyMapping, _ = queries.BindMapping(leaseType, leaseMapping, leasePrimaryKeyColumns)
+	leaseInsertCacheMut       sync.RWMutex
+	leaseInsertCache          = make(map[string]insertCache)
+	leaseUpdateCacheMut       sync.RWMutex
+	leaseUpdateCache          = make(map[string]updateCache)
+	leaseUpsertCacheMut       sync.RWMutex
+	leaseUpsertCache          = make(map[string]insertCache)
+)
+
+var (
+	// Force time package dependency for automated UpdatedAt/CreatedAt.
+	_ = time.Second
+	// Force qmhelper dependency for where clause generation (which doesn't
+	// always happen)
+	_ = qmhelper.Where
+)
+
+var leaseAfterSelectHooks []LeaseHook
+
+var leaseBeforeInsertHooks []LeaseHook
+var leaseAfterInsertHooks []LeaseHook
+
+var leaseBeforeUpdateHooks []LeaseHook
+var leaseAfterUpdateHooks []LeaseHook
+
+var leaseBeforeDeleteHooks []LeaseHook
+var leaseAfterDeleteHooks []LeaseHook
+
+var leaseBeforeUpsertHooks []LeaseHook
+var leaseAfterUpsertHooks []LeaseHook
+
+// doAfterSelectHooks executes all "after Select" hooks.
+func (o *Lease) doAfterSelectHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseAfterSelectHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeInsertHooks executes all "before insert" hooks.
+func (o *Lease) doBeforeInsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseBeforeInsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterInsertHooks executes all "after Insert" hooks.
+func (o *Lease) doAfterInsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseAfterInsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeUpdateHooks executes all "before Update" hooks.
+func (o *Lease) doBeforeUpdateHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseBeforeUpdateHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterUpdateHooks executes all "after Update" hooks.
+func (o *Lease) doAfterUpdateHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseAfterUpdateHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeDeleteHooks executes all "before Delete" hooks.
+func (o *Lease) doBeforeDeleteHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseBeforeDeleteHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterDeleteHooks executes all "after Delete" hooks.
+func (o *Lease) doAfterDeleteHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseAfterDeleteHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeUpsertHooks executes all "before Upsert" hooks.
+func (o *Lease) doBeforeUpsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseBeforeUpsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterUpsertHooks executes all "after Upsert" hooks.
+func (o *Lease) doAfterUpsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range leaseAfterUpsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddLeaseHook registers your hook function for all future operations.
+func AddLeaseHook(hookPoint boil.HookPoint, leaseHook LeaseHook) {
+	switch hookPoint {
+	case boil.AfterSelectHook:
+		leaseAfterSelectHooks = append(leaseAfterSelectHooks, leaseHook)
+	case boil.BeforeInsertHook:
+		leaseBeforeInsertHooks = append(leaseBeforeInsertHooks, leaseHook)
+	case boil.AfterInsertHook:
+		leaseAfterInsertHooks = append(leaseAfterInsertHooks, leaseHook)
+	case boil.BeforeUpdateHook:
+		leaseBeforeUpdateHooks = append(leaseBeforeUpdateHooks, leaseHook)
+	case boil.AfterUpdateHook:
+		leaseAfterUpdateHooks = append(leaseAfterUpdateHooks, leaseHook)
+	case boil.BeforeDeleteHook:
+		leaseBeforeDeleteHooks = append(leaseBeforeDeleteHooks, leaseHook)
+	case boil.AfterDeleteHook:
+		leaseAfterDeleteHooks = append(leaseAfterDeleteHooks, leaseHook)
+	case boil.BeforeUpsertHook:
+		leaseBeforeUpsertHooks = append(leaseBeforeUpsertHooks, leaseHook)
+	case boil.AfterUpsertHook:
+		leaseAfterUpsertHooks = append(leaseAfterUpsertHooks, leaseHook)
+	}
+}
+
+// One returns a single lease record from the query.
+func (q leaseQuery) One(ctx context.Context, exec boil.ContextExecutor) (*Lease, error) {
+	o := &Lease{}
+
+	queries.SetLimit(q.Query, 1)
+
+	err := q.Bind(ctx, exec, o)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, errors.Wrap(err, "models: failed to execute a one query for leases")
+	}
+
+	if err := o.doAfterSelectHooks(ctx, exec); err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+// All returns all Lease records from the query.
+func (q leaseQuery) All(ctx context.Context, exec boil.ContextExecutor) (LeaseSlice, error) {
+	var o []*Lease
+
+	err := q.Bind(ctx, exec, &o)
+	if err != nil {
+		return nil, errors.Wrap(err, "models: failed to assign all query results to Lease slice")
+	}
+
+	if len(leaseAfterSelectHooks) != 0 {
+		for _, obj := range o {
+			if err := obj.doAfterSelectHooks(ctx, exec); err != nil {
+				return o, err
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// Count returns the count of all Lease records in the query.
+func (q leaseQuery) Count(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	var count int64
+
+	queries.SetSelect(q.Query, nil)
+	queries.SetCount(q.Query)
+
+	err := q.Query.QueryRowContext(ctx, exec).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to count leases rows")
+	}
+
+	return count, nil
+}
+
+// Exists checks if the row exists in the table.
+func (q leaseQuery) Exists(ctx context.Context, exec boil.ContextExecutor) (bool, error) {
+	var count int64
+
+	queries.SetSelect(q.Query, nil)
+	queries.SetCount(q.Query)
+	queries.SetLimit(q.Query, 1)
+
+	err := q.Query.QueryRowContext(ctx, exec).Scan(&count)
+	if err != nil {
+		return false, errors.Wrap(err, "models: failed to check if leases exists")
+	}
+
+	return count > 0, nil
+}
+
+// LeaseCommunity pointed to by the foreign key.
+func (o *Lease) LeaseCommunity(mods ...qm.QueryMod) communityQuery {
+	queryMods := []qm.QueryMod{
+		qm.Where("\"id\" = ?", o.Community),
+	}
+
+	queryMods = append(queryMods, mods...)
+
+	return Communities(queryMods...)
+}
+
+// LoadLeaseCommunity allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for an N-1 relationship.
+func (leaseL) LoadLeaseCommunity(ctx context.Context, e boil.ContextExecutor, singular bool, maybeLease interface{}, mods queries.Applicator) error {
+	var slice []*Lease
+	var object *Lease
+
+	if singular {
+		object = maybeLease.(*Lease)
+	} else {
+		slice = *maybeLease.(*[]*Lease)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &leaseR{}
+		}
+		args = append(args, object.Community)
+
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &leaseR{}
+			}
+
+			for _, a := range args {
+				if a == obj.Community {
+					continue Outer
+				}
+			}
+
+			args = append(args, obj.Community)
+
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`communities`),
+		qm.WhereIn(`communities.id in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load Community")
+	}
+
+	var resultSlice []*Community
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice Community")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results of eager load for communities")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for communities")
+	}
+
+	if len(leaseAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(resultSlice) == 0 {
+		return nil
+	}
+
+	if singular {
+		foreign := resultSlice[0]
+		object.R.LeaseCommunity = foreign
+		if foreign.R == nil {
+			foreign.R = &communityR{}
+		}
+		foreign.R.Leases = append(foreign.R.Leases, object)
+		return nil
+	}
+
+	for _, local := range slice {
+		for _, foreign := range resultSlice {
+			if local.Community == foreign.ID {
+				local.R.LeaseCommunity = foreign
+				if foreign.R == nil {
+					foreign.R = &communityR{}
+				}
+				foreign.R.Leases = append(foreign.R.Leases, local)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetLeaseCommunity of the lease to the related item.
+// Sets o.R.LeaseCommunity to related.
+// Adds o to related.R.Leases.
+func (o *Lease) SetLeaseCommunity(ctx context.Context, exec boil.ContextExecutor, insert bool, related *Community) error {
+	var err error
+	if insert {
+		if err = related.Insert(ctx, exec, boil.Infer()); err != nil {
+			return errors.Wrap(err, "failed to insert into foreign table")
+		}
+	}
+
+	updateQuery := fmt.Sprintf(
+		"UPDATE \"leases\" SET %s WHERE %s",
+		strmangle.SetParamNames("\"", "\"", 1, []string{"community"}),
+		strmangle.WhereClause("\"", "\"", 2, leasePrimaryKeyColumns),
+	)
+	values := []interface{}{related.ID, o.Community, o.ID}
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, updateQuery)
+		fmt.Fprintln(writer, values)
+	}
+	if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+		return errors.Wrap(err, "failed to update local table")
+	}
+
+	o.Community = related.ID
+	if o.R == nil {
+		o.R = &leaseR{
+			LeaseCommunity: related,
+		}
+	} else {
+		o.R.LeaseCommunity = related
+	}
+
+	if related.R == nil {
+		related.R = &communityR{
+			Leases: LeaseSlice{o},
+		}
+	} else {
+		related.R.Leases = append(related.R.Leases, o)
+	}
+
+	return nil
+}
+
+// Leases retrieves all the records using an executor.
+func Leases(mods ...qm.QueryMod) leaseQuery {
+	mods = append(mods, qm.From("\"leases\""))
+	q := NewQuery(mods...)
+	if len(queries.GetSelect(q)) == 0 {
+		queries.SetSelect(q, []string{"\"leases\".*"})
+	}
+
+	return leaseQuery{q}
+}
+
+// FindLease retrieves a single record by ID with an executor.
+// If selectCols is empty Find will return all columns.
+func FindLease(ctx context.Context, exec boil.ContextExecutor, community string, iD string, selectCols ...string) (*Lease, error) {
+	leaseObj := &Lease{}
+
+	sel := "*"
+	if len(selectCols) > 0 {
+		sel = strings.Join(strmangle.IdentQuoteSlice(dialect.LQ, dialect.RQ, selectCols), ",")
+	}
+	query := fmt.Sprintf(
+		"select %s from \"leases\" where \"community\"=$1 AND \"id\"=$2", sel,
+	)
+
+	q := queries.Raw(query, community, iD)
+
+	err := q.Bind(ctx, exec, leaseObj)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, errors.Wrap(err, "models: unable to select from leases")
+	}
+
+	if err = leaseObj.doAfterSelectHooks(ctx, exec); err != nil {
+		return leaseObj, err
+	}
+
+	return leaseObj, nil
+}
+
+// Insert a single record using an executor.
+// See boil.Columns.InsertColumnSet documentation to understand column list inference for inserts.
+func (o *Lease) Insert(ctx context.Context, exec boil.ContextExecutor, columns boil.Columns) error {
+	if o == nil {
+		return errors.New("models: no leases provided for insertion")
+	}
+
+	var err error
+
+	if err := o.doBeforeInsertHooks(ctx, exec); err != nil {
+		return err
+	}
+
+	nzDefaults := queries.NonZeroDefaultSet(leaseColumnsWithDefault, o)
+
+	key := makeCacheKey(columns, nzDefaults)
+	leaseInsertCacheMut.RLock()
+	cache, cached := leaseInsertCache[key]
+	leaseInsertCacheMut.RUnlock()
+
+	if !cached {
+		wl, returnColumns := columns.InsertColumnSet(
+			leaseAllColumns,
+			leaseColumnsWithDefault,
+			leaseColumnsWithoutDefault,
+			nzDefaults,
+		)
+
+		cache.valueMapping, err = queries.BindMapping(leaseType, leaseMapping, wl)
+		if err != nil {
+			return err
+		}
+		cache.retMapping, err = queries.BindMapping(leaseType, leaseMapping, returnColumns)
+		if err != nil {
+			return err
+		}
+		if len(wl) != 0 {
+			cache.query = fmt.Sprintf("INSERT INTO \"leases\" (\"%s\") %%sVALUES (%s)%%s", strings.Join(wl, "\",\""), strmangle.Placeholders(dialect.UseIndexPlaceholders, len(wl), 1, 1))
+		} else {
+			cache.query = "INSERT INTO \"leases\" %sDEFAULT VALUES%s"
+		}
+
+		var queryOutput, queryReturning string
+
+		if len(cache.retMapping) != 0 {
+			queryReturning = fmt.Sprintf(" RETURNING \"%s\"", strings.Join(returnColumns, "\",\""))
+		}
+
+		cache.query = fmt.Sprintf(cache.query, queryOutput, queryReturning)
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(o))
+	vals := queries.ValuesFromMapping(value, cache.valueMapping)
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, cache.query)
+		fmt.Fprintln(writer, vals)
+	}
+
+	if len(cache.retMapping) != 0 {
+		err = exec.QueryRowContext(ctx, cache.query, vals...).Scan(queries.PtrsFromMapping(value, cache.retMapping)...)
+	} else {
+		_, err = exec.ExecContext(ctx, cache.query, vals...)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "models: unable to insert into leases")
+	}
+
+	if !cached {
+		leaseInsertCacheMut.Lock()
+		leaseInsertCache[key] = cache
+		leaseInsertCacheMut.Unlock()
+	}
+
+	return o.doAfterInsertHooks(ctx, exec)
+}
+
+// Update uses an executor to update the Lease.
+// See boil.Columns.UpdateColumnSet documentation to understand column list inference for updates.
+// Update does not automatically update the record in case of default values. Use .Reload() to refresh the records.
+func (o *Lease) Update(ctx context.Context, exec boil.ContextExecutor, columns boil.Columns) (int64, error) {
+	var err error
+	if err = o.doBeforeUpdateHooks(ctx, exec); err != nil {
+		return 0, err
+	}
+	key := makeCacheKey(columns, nil)
+	leaseUpdateCacheMut.RLock()
+	cache, cached := leaseUpdateCache[key]
+	leaseUpdateCacheMut.RUnlock()
+
+	if !cached {
+		wl := columns.UpdateColumnSet(
+			leaseAllColumns,
+			leasePrimaryKeyColumns,
+		)
+
+		if !columns.IsWhitelist() {
+			wl = strmangle.SetComplement(wl, []string{"created_at"})
+		}
+		if len(wl) == 0 {
+			return 0, errors.New("models: unable to update leases, could not build whitelist")
+		}
+
+		cache.query = fmt.Sprintf("UPDATE \"leases\" SET %s WHERE %s",
+			strmangle.SetParamNames("\"", "\"", 1, wl),
+			strmangle.WhereClause("\"", "\"", len(wl)+1, leasePrimaryKeyColumns),
+		)
+		cache.valueMapping, err = queries.BindMapping(leaseType, leaseMapping, append(wl, leasePrimaryKeyColumns...))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	values := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(o)), cache.valueMapping)
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, cache.query)
+		fmt.Fprintln(writer, values)
+	}
+	var result sql.Result
+	result, err = exec.ExecContext(ctx, cache.query, values...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to update leases row")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by update for leases")
+	}
+
+	if !cached {
+		leaseUpdateCacheMut.Lock()
+		leaseUpdateCache[key] = cache
+		leaseUpdateCacheMut.Unlock()
+	}
+
+	return rowsAff, o.doAfterUpdateHooks(ctx, exec)
+}
+
+// UpdateAll updates all rows with the specified column values.
+func (q leaseQuery) UpdateAll(ctx context.Context, exec boil.ContextExecutor, cols M) (int64, error) {
+	queries.SetUpdate(q.Query, cols)
+
+	result, err := q.Query.ExecContext(ctx, exec)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to update all for leases")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to retrieve rows affected for leases")
+	}
+
+	return rowsAff, nil
+}
+
+// UpdateAll updates all rows with the specified column values, using an executor.
+func (o LeaseSlice) UpdateAll(ctx context.Context, exec boil.ContextExecutor, cols M) (int64, error) {
+	ln := int64(len(o))
+	if ln == 0 {
+		return 0, nil
+	}
+
+	if len(cols) == 0 {
+		return 0, errors.New("models: update all requires at least one column argument")
+	}
+
+	colNames := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+
+	i := 0
+	for name, value := range cols {
+		colNames[i] = name
+		args[i] = value
+		i++
+	}
+
+	// Append all of the primary key values for each column
+	for _, obj := range o {
+		pkeyArgs := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(obj)), leasePrimaryKeyMapping)
+		args = append(args, pkeyArgs...)
+	}
+
+	sql := fmt.Sprintf("UPDATE \"leases\" SET %s WHERE %s",
+		strmangle.SetParamNames("\"", "\"", 1, colNames),
+		strmangle.WhereClauseRepeated(string(dialect.LQ), string(dialect.RQ), len(colNames)+1, leasePrimaryKeyColumns, len(o)))
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, args...)
+	}
+	result, err := exec.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to update all in lease slice")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to retrieve rows affected all in update all lease")
+	}
+	return rowsAff, nil
+}
+
+// Upsert attempts an insert using an executor, and does an update or ignore on conflict.
+// See boil.Columns documentation for how to properly use updateColumns and insertColumns.
+func (o *Lease) Upsert(ctx context.Context, exec boil.ContextExecutor, updateOnConflict bool, conflictColumns []string, updateColumns, insertColumns boil.Columns) error {
+	if o == nil {
+		return errors.New("models: no leases provided for upsert")
+	}
+
+	if err := o.doBeforeUpsertHooks(ctx, exec); err != nil {
+		return err
+	}
+
+	nzDefaults := queries.NonZeroDefaultSet(leaseColumnsWithDefault, o)
+
+	// Build cache key in-line uglily - mysql vs psql problems
+	buf := strmangle.GetBuffer()
+	if updateOnConflict {
+		buf.WriteByte('t')
+	} else {
+		buf.WriteByte('f')
+	}
+	buf.WriteByte('.')
+	for _, c := range conflictColumns {
+		buf.WriteString(c)
+	}
+	buf.WriteByte('.')
+	buf.WriteString(strconv.Itoa(updateColumns.Kind))
+	for _, c := range updateColumns.Cols {
+		buf.WriteString(c)
+	}
+	buf.WriteByte('.')
+	buf.WriteString(strconv.Itoa(insertColumns.Kind))
+	for _, c := range insertColumns.Cols {
+		buf.WriteString(c)
+	}
+	buf.WriteByte('.')
+	for _, c := range nzDefaults {
+		buf.WriteString(c)
+	}
+	key := buf.String()
+	strmangle.PutBuffer(buf)
+
+	leaseUpsertCacheMut.RLock()
+	cache, cached := leaseUpsertCache[key]
+	leaseUpsertCacheMut.RUnlock()
+
+	var err error
+
+	if !cached {
+		insert, ret := insertColumns.InsertColumnSet(
+			leaseAllColumns,
+			leaseColumnsWithDefault,
+			leaseColumnsWithoutDefault,
+			nzDefaults,
+		)
+
+		update := updateColumns.UpdateColumnSet(
+			leaseAllColumns,
+			leasePrimaryKeyColumns,
+		)
+
+		if updateOnConflict && len(update) == 0 {
+			return errors.New("models: unable to upsert leases, could not build update column list")
+		}
+
+		conflict := conflictColumns
+		if len(conflict) == 0 {
+			conflict = make([]string, len(leasePrimaryKeyColumns))
+			copy(conflict, leasePrimaryKeyColumns)
+		}
+		cache.query = buildUpsertQueryPostgres(dialect, "\"leases\"", updateOnConflict, ret, update, conflict, insert)
+
+		cache.valueMapping, err = queries.BindMapping(leaseType, leaseMapping, insert)
+		if err != nil {
+			return err
+		}
+		if len(ret) != 0 {
+			cache.retMapping, err = queries.BindMapping(leaseType, leaseMapping, ret)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(o))
+	vals := queries.ValuesFromMapping(value, cache.valueMapping)
+	var returns []interface{}
+	if len(cache.retMapping) != 0 {
+		returns = queries.PtrsFromMapping(value, cache.retMapping)
+	}
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, cache.query)
+		fmt.Fprintln(writer, vals)
+	}
+	if len(cache.retMapping) != 0 {
+		err = exec.QueryRowContext(ctx, cache.query, vals...).Scan(returns...)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil // Postgres doesn't return anything when there's no update
+		}
+	} else {
+		_, err = exec.ExecContext(ctx, cache.query, vals...)
+	}
+	if err != nil {
+		return errors.Wrap(err, "models: unable to upsert leases")
+	}
+
+	if !cached {
+		leaseUpsertCacheMut.Lock()
+		leaseUpsertCache[key] = cache
+		leaseUpsertCacheMut.Unlock()
+	}
+
+	return o.doAfterUpsertHooks(ctx, exec)
+}
+
+// Delete deletes a single Lease record with an executor.
+// Delete will match against the primary key column to find the record to delete.
+func (o *Lease) Delete(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	if o == nil {
+		return 0, errors.New("models: no Lease provided for delete")
+	}
+
+	if err := o.doBeforeDeleteHooks(ctx, exec); err != nil {
+		return 0, err
+	}
+
+	args := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(o)), leasePrimaryKeyMapping)
+	sql := "DELETE FROM \"leases\" WHERE \"community\"=$1 AND \"id\"=$2"
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, args...)
+	}
+	result, err := exec.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to delete from leases")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by delete for leases")
+	}
+
+	if err := o.doAfterDeleteHooks(ctx, exec); err != nil {
+		return 0, err
+	}
+
+	return rowsAff, nil
+}
+
+// DeleteAll deletes all matching rows.
+func (q leaseQuery) DeleteAll(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	if q.Query == nil {
+		return 0, errors.New("models: no leaseQuery provided for delete all")
+	}
+
+	queries.SetDelete(q.Query)
+
+	result, err := q.Query.ExecContext(ctx, exec)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to delete all from leases")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by deleteall for leases")
+	}
+
+	return rowsAff, nil
+}
+
+// DeleteAll deletes all rows in the slice, using an executor.
+func (o LeaseSlice) DeleteAll(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	if len(o) == 0 {
+		return 0, nil
+	}
+
+	if len(leaseBeforeDeleteHooks) != 0 {
+		for _, obj := range o {
+			if err := obj.doBeforeDeleteHooks(ctx, exec); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var args []interface{}
+	for _, obj := range o {
+		pkeyArgs := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(obj)), leasePrimaryKeyMapping)
+		args = append(args, pkeyArgs...)
+	}
+
+	sql := "DELETE FROM \"leases\" WHERE " +
+		strmangle.WhereClauseRepeated(string(dialect.LQ), string(dialect.RQ), 1, leasePrimaryKeyColumns, len(o))
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, args)
+	}
+	result, err := exec.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to delete all from lease slice")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by deleteall for leases")
+	}
+
+	if len(leaseAfterDeleteHooks) != 0 {
+		for _, obj := range o {
+			if err := obj.doAfterDeleteHooks(ctx, exec); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return rowsAff, nil
+}
+
+// Reload refetches the object from the database
+// using the primary keys with an executor.
+func (o *Lease) Reload(ctx context.Context, exec boil.ContextExecutor) error {
+	ret, err := FindLease(ctx, exec, o.Community, o.ID)
+	if err != nil {
+		return err
+	}
+
+	*o = *ret
+	return nil
+}
+
+// ReloadAll refetches every row with matching primary key column values
+// and overwrites the original object slice with the newly updated slice.
+func (o *LeaseSlice) ReloadAll(ctx context.Context, exec boil.ContextExecutor) error {
+	if o == nil || len(*o) == 0 {
+		return nil
+	}
+
+	slice := LeaseSlice{}
+	var args []interface{}
+	for _, obj := range *o {
+		pkeyArgs := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(obj)), leasePrimaryKeyMapping)
+		args = append(args, pkeyArgs...)
+	}
+
+	sql := "SELECT \"leases\".* FROM \"leases\" WHERE " +
+		strmangle.WhereClauseRepeated(string(dialect.LQ), string(dialect.RQ), 1, leasePrimaryKeyColumns, len(*o))
+
+	q := queries.Raw(sql, args...)
+
+	err := q.Bind(ctx, exec, &slice)
+	if err != nil {
+		return errors.Wrap(err, "models: unable to reload all in LeaseSlice")
+	}
+
+	*o = slice
+
+	return nil
+}
+
+// LeaseExists checks if the Lease row exists.
+func LeaseExists(ctx context.Context, exec boil.ContextExecutor, community string, iD string) (bool, error) {
+	var exists bool
+	sql := "select exists(select 1 from \"leases\" where \"community\"=$1 AND \"id\"=$2 limit 1)"
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, community, iD)
+	}
+	row := exec.QueryRowContext(ctx, sql, community, iD)
+
+	err := row.Scan(&exists)
+	if err != nil {
+		return false, errors.Wrap(err, "models: unable to check if leases exists")
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,1135 @@
+// Code generated by SQLBoiler 4.11.0 (https://github.com/volatiletech/sqlboiler). DO NOT EDIT.
+// This file is meant to be re-generated in place and/or deleted at any time.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/friendsofgo/errors"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"github.com/volatiletech/sqlboiler/v4/queries/qmhelper"
+	"github.com/volatiletech/strmangle"
+)
+
+// Mail is an object representing the database table.
+type Mail struct {
+	Serial    int64     `boil:"serial" json:"serial" toml:"serial" yaml:"serial"`
+	Community string    `boil:"community" json:"community" toml:"community" yaml:"community"`
+	Recipient string    `boil:"recipient" json:"recipient" toml:"recipient" yaml:"recipient"`
+	Payload   []byte    `boil:"payload" json:"payload" toml:"payload" yaml:"payload"`
+	CreatedAt time.Time `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
+	ExpiresAt time.Time `boil:"expires_at" json:"expires_at" toml:"expires_at" yaml:"expires_at"`
+
+	R *mailR `boil:"-" json:"-" toml:"-" yaml:"-"`
+	L mailL  `boil:"-" json:"-" toml:"-" yaml:"-"`
+}
+
+var MailColumns = struct {
+	Serial    string
+	Community string
+	Recipient string
+	Payload   string
+	CreatedAt string
+	ExpiresAt string
+}{
+	Serial:    "serial",
+	Community: "community",
+	Recipient: "recipient",
+	Payload:   "payload",
+	CreatedAt: "created_at",
+	ExpiresAt: "expires_at",
+}
+
+var MailTableColumns = struct {
+	Serial    string
+	Community string
+	Recipient string
+	Payload   string
+	CreatedAt string
+	ExpiresAt string
+}{
+	Serial:    "mail.serial",
+	Community: "mail.community",
+	Recipient: "mail.recipient",
+	Payload:   "mail.payload",
+	CreatedAt: "mail.created_at",
+	ExpiresAt: "mail.expires_at",
+}
+
+// Generated where
+
+type whereHelper__byte struct{ field string }
+
+func (w whereHelper__byte) EQ(x []byte) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.EQ, x) }
+func (w whereHelper__byte) NEQ(x []byte) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.NEQ, x) }
+func (w whereHelper__byte) LT(x []byte) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.LT, x) }
+func (w whereHelper__byte) LTE(x []byte) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.LTE, x) }
+func (w whereHelper__byte) GT(x []byte) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.GT, x) }
+func (w whereHelper__byte) GTE(x []byte) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.GTE, x) }
+
+type whereHelpertime_Time struct{ field string }
+
+func (w whereHelpertime_Time) EQ(x time.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.EQ, x)
+}
+func (w whereHelpertime_Time) NEQ(x time.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.NEQ, x)
+}
+func (w whereHelpertime_Time) LT(x time.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LT, x)
+}
+func (w whereHelpertime_Time) LTE(x time.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LTE, x)
+}
+func (w whereHelpertime_Time) GT(x time.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GT, x)
+}
+func (w whereHelpertime_Time) GTE(x time.Time) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GTE, x)
+}
+
+var MailWhere = struct {
+	Serial    whereHelperint64
+	Community whereHelperstring
+	Recipient whereHelperstring
+	Payload   whereHelper__byte
+	CreatedAt whereHelpertime_Time
+	ExpiresAt whereHelpertime_Time
+}{
+	Serial:    whereHelperint64{field: "\"mail\".\"serial\""},
+	Community: whereHelperstring{field: "\"mail\".\"community\""},
+	Recipient: whereHelperstring{field: "\"mail\".\"recipient\""},
+	Payload:   whereHelper__byte{field: "\"mail\".\"payload\""},
+	CreatedAt: whereHelpertime_Time{field: "\"mail\".\"created_at\""},
+	ExpiresAt: whereHelpertime_Time{field: "\"mail\".\"expires_at\""},
+}
+
+// MailRels is where relationship names are stored.
+var MailRels = struct {
+	MailCommunity string
+}{
+	MailCommunity: "MailCommunity",
+}
+
+// mailR is where relationships are stored.
+type mailR struct {
+	MailCommunity *Community `boil:"MailCommunity" json:"MailCommunity" toml:"MailCommunity" yaml:"MailCommunity"`
+}
+
+// NewStruct creates a new relationship struct
+func (*mailR) NewStruct() *mailR {
+	return &mailR{}
+}
+
+func (r *mailR) GetMailCommunity() *Community {
+	if r == nil {
+		return nil
+	}
+	return r.MailCommunity
+}
+
+// mailL is where Load methods for each relationship are stored.
+type mailL struct{}
+
+var (
+	mailAllColumns            = []string{"serial", "community", "recipient", "payload", "created_at", "expires_at"}
+	mailColumnsWithoutDefault = []string{"community", "recipient", "payload", "expires_at"}
+	mailColumnsWithDefault    = []string{"serial", "created_at"}
+	mailPrimaryKeyColumns     = []string{"serial"}
+	mailGeneratedColumns      = []string{}
+)
+
+type (
+	// MailSlice is an alias for a slice of pointers to Mail.
+	// This should almost always be used instead of []Mail.
+	MailSlice []*Mail
+	// MailHook is the signature for custom Mail hook methods
+	MailHook func(context.Context, boil.ContextExecutor, *Mail) error
+
+	mailQuery struct {
+		*queries.Query
+	}
+)
+
+// Cache for insert, update and upsert
+var (
+	mailType                 = reflect.TypeOf(&Mail{})
+	mailMapping              = queries.MakeStructMapping(mailType)
+	mailPrimaryKeyMapping, _ = queries.BindMapping(mailType, mailMapping, mailPrimaryKeyColumns)
+	mailInsertCacheMut       sync.RWMutex
+	mailInsertCache          = make(map[string]insertCache)
+	mailUpdateCacheMut       sync.RWMutex
+	mailUpdateCache          = make(map[string]updateCache)
+	mailUpsertCacheMut       sync.RWMutex
+	mailUpsertCache          = make(map[string]insertCache)
+)
+
+var (
+	// Force time package dependency for automated UpdatedAt/CreatedAt.
+	_ = time.Second
+	// Force qmhelper dependency for where clause generation (which doesn't
+	// always happen)
+	_ = qmhelper.Where
+)
+
+var mailAfterSelectHooks []MailHook
+
+var mailBeforeInsertHooks []MailHook
+var mailAfterInsertHooks []MailHook
+
+var mailBeforeUpdateHooks []MailHook
+var mailAfterUpdateHooks []MailHook
+
+var mailBeforeDeleteHooks []MailHook
+var mailAfterDeleteHooks []MailHook
+
+var mailBeforeUpsertHooks []MailHook
+var mailAfterUpsertHooks []MailHook
+
+// doAfterSelectHooks executes all "after Select" hooks.
+func (o *Mail) doAfterSelectHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailAfterSelectHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeInsertHooks executes all "before insert" hooks.
+func (o *Mail) doBeforeInsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailBeforeInsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterInsertHooks executes all "after Insert" hooks.
+func (o *Mail) doAfterInsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailAfterInsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeUpdateHooks executes all "before Update" hooks.
+func (o *Mail) doBeforeUpdateHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailBeforeUpdateHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterUpdateHooks executes all "after Update" hooks.
+func (o *Mail) doAfterUpdateHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailAfterUpdateHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeDeleteHooks executes all "before Delete" hooks.
+func (o *Mail) doBeforeDeleteHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailBeforeDeleteHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterDeleteHooks executes all "after Delete" hooks.
+func (o *Mail) doAfterDeleteHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailAfterDeleteHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doBeforeUpsertHooks executes all "before Upsert" hooks.
+func (o *Mail) doBeforeUpsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailBeforeUpsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doAfterUpsertHooks executes all "after Upsert" hooks.
+func (o *Mail) doAfterUpsertHooks(ctx context.Context, exec boil.ContextExecutor) (err error) {
+	if boil.HooksAreSkipped(ctx) {
+		return nil
+	}
+
+	for _, hook := range mailAfterUpsertHooks {
+		if err := hook(ctx, exec, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddMailHook registers your hook function for all future operations.
+func AddMailHook(hookPoint boil.HookPoint, mailHook MailHook) {
+	switch hookPoint {
+	case boil.AfterSelectHook:
+		mailAfterSelectHooks = append(mailAfterSelectHooks, mailHook)
+	case boil.BeforeInsertHook:
+		mailBeforeInsertHooks = append(mailBeforeInsertHooks, mailHook)
+	case boil.AfterInsertHook:
+		mailAfterInsertHooks = append(mailAfterInsertHooks, mailHook)
+	case boil.BeforeUpdateHook:
+		mailBeforeUpdateHooks = append(mailBeforeUpdateHooks, mailHook)
+	case boil.AfterUpdateHook:
+		mailAfterUpdateHooks = append(mailAfterUpdateHooks, mailHook)
+	case boil.BeforeDeleteHook:
+		mailBeforeDeleteHooks = append(mailBeforeDeleteHooks, mailHook)
+	case boil.AfterDeleteHook:
+		mailAfterDeleteHooks = append(mailAfterDeleteHooks, mailHook)
+	case boil.BeforeUpsertHook:
+		mailBeforeUpsertHooks = append(mailBeforeUpsertHooks, mailHook)
+	case boil.AfterUpsertHook:
+		mailAfterUpsertHooks = append(mailAfterUpsertHooks, mailHook)
+	}
+}
+
+// One returns a single mail record from the query.
+func (q mailQuery) One(ctx context.Context, exec boil.ContextExecutor) (*Mail, error) {
+	o := &Mail{}
+
+	queries.SetLimit(q.Query, 1)
+
+	err := q.Bind(ctx, exec, o)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, errors.Wrap(err, "models: failed to execute a one query for mail")
+	}
+
+	if err := o.doAfterSelectHooks(ctx, exec); err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+// All returns all Mail records from the query.
+func (q mailQuery) All(ctx context.Context, exec boil.ContextExecutor) (MailSlice, error) {
+	var o []*Mail
+
+	err := q.Bind(ctx, exec, &o)
+	if err != nil {
+		return nil, errors.Wrap(err, "models: failed to assign all query results to Mail slice")
+	}
+
+	if len(mailAfterSelectHooks) != 0 {
+		for _, obj := range o {
+			if err := obj.doAfterSelectHooks(ctx, exec); err != nil {
+				return o, err
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// Count returns the count of all Mail records in the query.
+func (q mailQuery) Count(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	var count int64
+
+	queries.SetSelect(q.Query, nil)
+	queries.SetCount(q.Query)
+
+	err := q.Query.QueryRowContext(ctx, exec).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to count mail rows")
+	}
+
+	return count, nil
+}
+
+// Exists checks if the row exists in the table.
+func (q mailQuery) Exists(ctx context.Context, exec boil.ContextExecutor) (bool, error) {
+	var count int64
+
+	queries.SetSelect(q.Query, nil)
+	queries.SetCount(q.Query)
+	queries.SetLimit(q.Query, 1)
+
+	err := q.Query.QueryRowContext(ctx, exec).Scan(&count)
+	if err != nil {
+		return false, errors.Wrap(err, "models: failed to check if mail exists")
+	}
+
+	return count > 0, nil
+}
+
+// MailCommunity pointed to by the foreign key.
+func (o *Mail) MailCommunity(mods ...qm.QueryMod) communityQuery {
+	queryMods := []qm.QueryMod{
+		qm.Where("\"id\" = ?", o.Community),
+	}
+
+	queryMods = append(queryMods, mods...)
+
+	return Communities(queryMods...)
+}
+
+// LoadMailCommunity allows an eager lookup of values, cached into the
+// loaded structs of the objects. This is for an N-1 relationship.
+func (mailL) LoadMailCommunity(ctx context.Context, e boil.ContextExecutor, singular bool, maybeMail interface{}, mods queries.Applicator) error {
+	var slice []*Mail
+	var object *Mail
+
+	if singular {
+		object = maybeMail.(*Mail)
+	} else {
+		slice = *maybeMail.(*[]*Mail)
+	}
+
+	args := make([]interface{}, 0, 1)
+	if singular {
+		if object.R == nil {
+			object.R = &mailR{}
+		}
+		args = append(args, object.Community)
+
+	} else {
+	Outer:
+		for _, obj := range slice {
+			if obj.R == nil {
+				obj.R = &mailR{}
+			}
+
+			for _, a := range args {
+				if a == obj.Community {
+					continue Outer
+				}
+			}
+
+			args = append(args, obj.Community)
+
+		}
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	query := NewQuery(
+		qm.From(`communities`),
+		qm.WhereIn(`communities.id in ?`, args...),
+	)
+	if mods != nil {
+		mods.Apply(query)
+	}
+
+	results, err := query.QueryContext(ctx, e)
+	if err != nil {
+		return errors.Wrap(err, "failed to eager load Community")
+	}
+
+	var resultSlice []*Community
+	if err = queries.Bind(results, &resultSlice); err != nil {
+		return errors.Wrap(err, "failed to bind eager loaded slice Community")
+	}
+
+	if err = results.Close(); err != nil {
+		return errors.Wrap(err, "failed to close results of eager load for communities")
+	}
+	if err = results.Err(); err != nil {
+		return errors.Wrap(err, "error occurred during iteration of eager loaded relations for communities")
+	}
+
+	if len(mailAfterSelectHooks) != 0 {
+		for _, obj := range resultSlice {
+			if err := obj.doAfterSelectHooks(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(resultSlice) == 0 {
+		return nil
+	}
+
+	if singular {
+		foreign := resultSlice[0]
+		object.R.MailCommunity = foreign
+		if foreign.R == nil {
+			foreign.R = &communityR{}
+		}
+		foreign.R.Mails = append(foreign.R.Mails, object)
+		return nil
+	}
+
+	for _, local := range slice {
+		for _, foreign := range resultSlice {
+			if local.Community == foreign.ID {
+				local.R.MailCommunity = foreign
+				if foreign.R == nil {
+					foreign.R = &communityR{}
+				}
+				foreign.R.Mails = append(foreign.R.Mails, local)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetMailCommunity of the mail to the related item.
+// Sets o.R.MailCommunity to related.
+// Adds o to related.R.Mails.
+func (o *Mail) SetMailCommunity(ctx context.Context, exec boil.ContextExecutor, insert bool, related *Community) error {
+	var err error
+	if insert {
+		if err = related.Insert(ctx, exec, boil.Infer()); err != nil {
+			return errors.Wrap(err, "failed to insert into foreign table")
+		}
+	}
+
+	updateQuery := fmt.Sprintf(
+		"UPDATE \"mail\" SET %s WHERE %s",
+		strmangle.SetParamNames("\"", "\"", 1, []string{"community"}),
+		strmangle.WhereClause("\"", "\"", 2, mailPrimaryKeyColumns),
+	)
+	values := []interface{}{related.ID, o.Serial}
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, updateQuery)
+		fmt.Fprintln(writer, values)
+	}
+	if _, err = exec.ExecContext(ctx, updateQuery, values...); err != nil {
+		return errors.Wrap(err, "failed to update local table")
+	}
+
+	o.Community = related.ID
+	if o.R == nil {
+		o.R = &mailR{
+			MailCommunity: related,
+		}
+	} else {
+		o.R.MailCommunity = related
+	}
+
+	if related.R == nil {
+		related.R = &communityR{
+			Mails: MailSlice{o},
+		}
+	} else {
+		related.R.Mails = append(related.R.Mails, o)
+	}
+
+	return nil
+}
+
+// Mails retrieves all the records using an executor.
+func Mails(mods ...qm.QueryMod) mailQuery {
+	mods = append(mods, qm.From("\"mail\""))
+	q := NewQuery(mods...)
+	if len(queries.GetSelect(q)) == 0 {
+		queries.SetSelect(q, []string{"\"mail\".*"})
+	}
+
+	return mailQuery{q}
+}
+
+// FindMail retrieves a single record by ID with an executor.
+// If selectCols is empty Find will return all columns.
+func FindMail(ctx context.Context, exec boil.ContextExecutor, serial int64, selectCols ...string) (*Mail, error) {
+	mailObj := &Mail{}
+
+	sel := "*"
+	if len(selectCols) > 0 {
+		sel = strings.Join(strmangle.IdentQuoteSlice(dialect.LQ, dialect.RQ, selectCols), ",")
+	}
+	query := fmt.Sprintf(
+		"select %s from \"mail\" where \"serial\"=$1", sel,
+	)
+
+	q := queries.Raw(query, serial)
+
+	err := q.Bind(ctx, exec, mailObj)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, errors.Wrap(err, "models: unable to select from mail")
+	}
+
+	if err = mailObj.doAfterSelectHooks(ctx, exec); err != nil {
+		return mailObj, err
+	}
+
+	return mailObj, nil
+}
+
+// Insert a single record using an executor.
+// See boil.Columns.InsertColumnSet documentation to understand column list inference for inserts.
+func (o *Mail) Insert(ctx context.Context, exec boil.ContextExecutor, columns boil.Columns) error {
+	if o == nil {
+		return errors.New("models: no mail provided for insertion")
+	}
+
+	var err error
+	if !boil.TimestampsAreSkipped(ctx) {
+		currTime := time.Now().In(boil.GetLocation())
+
+		if o.CreatedAt.IsZero() {
+			o.CreatedAt = currTime
+		}
+	}
+
+	if err := o.doBeforeInsertHooks(ctx, exec); err != nil {
+		return err
+	}
+
+	nzDefaults := queries.NonZeroDefaultSet(mailColumnsWithDefault, o)
+
+	key := makeCacheKey(columns, nzDefaults)
+	mailInsertCacheMut.RLock()
+	cache, cached := mailInsertCache[key]
+	mailInsertCacheMut.RUnlock()
+
+	if !cached {
+		wl, returnColumns := columns.InsertColumnSet(
+			mailAllColumns,
+			mailColumnsWithDefault,
+			mailColumnsWithoutDefault,
+			nzDefaults,
+		)
+
+		cache.valueMapping, err = queries.BindMapping(mailType, mailMapping, wl)
+		if err != nil {
+			return err
+		}
+		cache.retMapping, err = queries.BindMapping(mailType, mailMapping, returnColumns)
+		if err != nil {
+			return err
+		}
+		if len(wl) != 0 {
+			cache.query = fmt.Sprintf("INSERT INTO \"mail\" (\"%s\") %%sVALUES (%s)%%s", strings.Join(wl, "\",\""), strmangle.Placeholders(dialect.UseIndexPlaceholders, len(wl), 1, 1))
+		} else {
+			cache.query = "INSERT INTO \"mail\" %sDEFAULT VALUES%s"
+		}
+
+		var queryOutput, queryReturning string
+
+		if len(cache.retMapping) != 0 {
+			queryReturning = fmt.Sprintf(" RETURNING \"%s\"", strings.Join(returnColumns, "\",\""))
+		}
+
+		cache.query = fmt.Sprintf(cache.query, queryOutput, queryReturning)
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(o))
+	vals := queries.ValuesFromMapping(value, cache.valueMapping)
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, cache.query)
+		fmt.Fprintln(writer, vals)
+	}
+
+	if len(cache.retMapping) != 0 {
+		err = exec.QueryRowContext(ctx, cache.query, vals...).Scan(queries.PtrsFromMapping(value, cache.retMapping)...)
+	} else {
+		_, err = exec.ExecContext(ctx, cache.query, vals...)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "models: unable to insert into mail")
+	}
+
+	if !cached {
+		mailInsertCacheMut.Lock()
+		mailInsertCache[key] = cache
+		mailInsertCacheMut.Unlock()
+	}
+
+	return o.doAfterInsertHooks(ctx, exec)
+}
+
+// Update uses an executor to update the Mail.
+// See boil.Columns.UpdateColumnSet documentation to understand column list inference for updates.
+// Update does not automatically update the record in case of default values. Use .Reload() to refresh the records.
+func (o *Mail) Update(ctx context.Context, exec boil.ContextExecutor, columns boil.Columns) (int64, error) {
+	var err error
+	if err = o.doBeforeUpdateHooks(ctx, exec); err != nil {
+		return 0, err
+	}
+	key := makeCacheKey(columns, nil)
+	mailUpdateCacheMut.RLock()
+	cache, cached := mailUpdateCache[key]
+	mailUpdateCacheMut.RUnlock()
+
+	if !cached {
+		wl := columns.UpdateColumnSet(
+			mailAllColumns,
+			mailPrimaryKeyColumns,
+		)
+
+		if !columns.IsWhitelist() {
+			wl = strmangle.SetComplement(wl, []string{"created_at"})
+		}
+		if len(wl) == 0 {
+			return 0, errors.New("models: unable to update mail, could not build whitelist")
+		}
+
+		cache.query = fmt.Sprintf("UPDATE \"mail\" SET %s WHERE %s",
+			strmangle.SetParamNames("\"", "\"", 1, wl),
+			strmangle.WhereClause("\"", "\"", len(wl)+1, mailPrimaryKeyColumns),
+		)
+		cache.valueMapping, err = queries.BindMapping(mailType, mailMapping, append(wl, mailPrimaryKeyColumns...))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	values := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(o)), cache.valueMapping)
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, cache.query)
+		fmt.Fprintln(writer, values)
+	}
+	var result sql.Result
+	result, err = exec.ExecContext(ctx, cache.query, values...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to update mail row")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by update for mail")
+	}
+
+	if !cached {
+		mailUpdateCacheMut.Lock()
+		mailUpdateCache[key] = cache
+		mailUpdateCacheMut.Unlock()
+	}
+
+	return rowsAff, o.doAfterUpdateHooks(ctx, exec)
+}
+
+// UpdateAll updates all rows with the specified column values.
+func (q mailQuery) UpdateAll(ctx context.Context, exec boil.ContextExecutor, cols M) (int64, error) {
+	queries.SetUpdate(q.Query, cols)
+
+	result, err := q.Query.ExecContext(ctx, exec)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to update all for mail")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to retrieve rows affected for mail")
+	}
+
+	return rowsAff, nil
+}
+
+// UpdateAll updates all rows with the specified column values, using an executor.
+func (o MailSlice) UpdateAll(ctx context.Context, exec boil.ContextExecutor, cols M) (int64, error) {
+	ln := int64(len(o))
+	if ln == 0 {
+		return 0, nil
+	}
+
+	if len(cols) == 0 {
+		return 0, errors.New("models: update all requires at least one column argument")
+	}
+
+	colNames := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+
+	i := 0
+	for name, value := range cols {
+		colNames[i] = name
+		args[i] = value
+		i++
+	}
+
+	// Append all of the primary key values for each column
+	for _, obj := range o {
+		pkeyArgs := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(obj)), mailPrimaryKeyMapping)
+		args = append(args, pkeyArgs...)
+	}
+
+	sql := fmt.Sprintf("UPDATE \"mail\" SET %s WHERE %s",
+		strmangle.SetParamNames("\"", "\"", 1, colNames),
+		strmangle.WhereClauseRepeated(string(dialect.LQ), string(dialect.RQ), len(colNames)+1, mailPrimaryKeyColumns, len(o)))
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, args...)
+	}
+	result, err := exec.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to update all in mail slice")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to retrieve rows affected all in update all mail")
+	}
+	return rowsAff, nil
+}
+
+// Upsert attempts an insert using an executor, and does an update or ignore on conflict.
+// See boil.Columns documentation for how to properly use updateColumns and insertColumns.
+func (o *Mail) Upsert(ctx context.Context, exec boil.ContextExecutor, updateOnConflict bool, conflictColumns []string, updateColumns, insertColumns boil.Columns) error {
+	if o == nil {
+		return errors.New("models: no mail provided for upsert")
+	}
+	if !boil.TimestampsAreSkipped(ctx) {
+		currTime := time.Now().In(boil.GetLocation())
+
+		if o.CreatedAt.IsZero() {
+			o.CreatedAt = currTime
+		}
+	}
+
+	if err := o.doBeforeUpsertHooks(ctx, exec); err != nil {
+		return err
+	}
+
+	nzDefaults := queries.NonZeroDefaultSet(mailColumnsWithDefault, o)
+
+	// Build cache key in-line uglily - mysql vs psql problems
+	buf := strmangle.GetBuffer()
+	if updateOnConflict {
+		buf.WriteByte('t')
+	} else {
+		buf.WriteByte('f')
+	}
+	buf.WriteByte('.')
+	for _, c := range conflictColumns {
+		buf.WriteString(c)
+	}
+	buf.WriteByte('.')
+	buf.WriteString(strconv.Itoa(updateColumns.Kind))
+	for _, c := range updateColumns.Cols {
+		buf.WriteString(c)
+	}
+	buf.WriteByte('.')
+	buf.WriteString(strconv.Itoa(insertColumns.Kind))
+	for _, c := range insertColumns.Cols {
+		buf.WriteString(c)
+	}
+	buf.WriteByte('.')
+	for _, c := range nzDefaults {
+		buf.WriteString(c)
+	}
+	key := buf.String()
+	strmangle.PutBuffer(buf)
+
+	mailUpsertCacheMut.RLock()
+	cache, cached := mailUpsertCache[key]
+	mailUpsertCacheMut.RUnlock()
+
+	var err error
+
+	if !cached {
+		insert, ret := insertColumns.InsertColumnSet(
+			mailAllColumns,
+			mailColumnsWithDefault,
+			mailColumnsWithoutDefault,
+			nzDefaults,
+		)
+
+		update := updateColumns.UpdateColumnSet(
+			mailAllColumns,
+			mailPrimaryKeyColumns,
+		)
+
+		if updateOnConflict && len(update) == 0 {
+			return errors.New("models: unable to upsert mail, could not build update column list")
+		}
+
+		conflict := conflictColumns
+		if len(conflict) == 0 {
+			conflict = make([]string, len(mailPrimaryKeyColumns))
+			copy(conflict, mailPrimaryKeyColumns)
+		}
+		cache.query = buildUpsertQueryPostgres(dialect, "\"mail\"", updateOnConflict, ret, update, conflict, insert)
+
+		cache.valueMapping, err = queries.BindMapping(mailType, mailMapping, insert)
+		if err != nil {
+			return err
+		}
+		if len(ret) != 0 {
+			cache.retMapping, err = queries.BindMapping(mailType, mailMapping, ret)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(o))
+	vals := queries.ValuesFromMapping(value, cache.valueMapping)
+	var returns []interface{}
+	if len(cache.retMapping) != 0 {
+		returns = queries.PtrsFromMapping(value, cache.retMapping)
+	}
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, cache.query)
+		fmt.Fprintln(writer, vals)
+	}
+	if len(cache.retMapping) != 0 {
+		err = exec.QueryRowContext(ctx, cache.query, vals...).Scan(returns...)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil // Postgres doesn't return anything when there's no update
+		}
+	} else {
+		_, err = exec.ExecContext(ctx, cache.query, vals...)
+	}
+	if err != nil {
+		return errors.Wrap(err, "models: unable to upsert mail")
+	}
+
+	if !cached {
+		mailUpsertCacheMut.Lock()
+		mailUpsertCache[key] = cache
+		mailUpsertCacheMut.Unlock()
+	}
+
+	return o.doAfterUpsertHooks(ctx, exec)
+}
+
+// Delete deletes a single Mail record with an executor.
+// Delete will match against the primary key column to find the record to delete.
+func (o *Mail) Delete(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	if o == nil {
+		return 0, errors.New("models: no Mail provided for delete")
+	}
+
+	if err := o.doBeforeDeleteHooks(ctx, exec); err != nil {
+		return 0, err
+	}
+
+	args := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(o)), mailPrimaryKeyMapping)
+	sql := "DELETE FROM \"mail\" WHERE \"serial\"=$1"
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, args...)
+	}
+	result, err := exec.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to delete from mail")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by delete for mail")
+	}
+
+	if err := o.doAfterDeleteHooks(ctx, exec); err != nil {
+		return 0, err
+	}
+
+	return rowsAff, nil
+}
+
+// DeleteAll deletes all matching rows.
+func (q mailQuery) DeleteAll(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	if q.Query == nil {
+		return 0, errors.New("models: no mailQuery provided for delete all")
+	}
+
+	queries.SetDelete(q.Query)
+
+	result, err := q.Query.ExecContext(ctx, exec)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to delete all from mail")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by deleteall for mail")
+	}
+
+	return rowsAff, nil
+}
+
+// DeleteAll deletes all rows in the slice, using an executor.
+func (o MailSlice) DeleteAll(ctx context.Context, exec boil.ContextExecutor) (int64, error) {
+	if len(o) == 0 {
+		return 0, nil
+	}
+
+	if len(mailBeforeDeleteHooks) != 0 {
+		for _, obj := range o {
+			if err := obj.doBeforeDeleteHooks(ctx, exec); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var args []interface{}
+	for _, obj := range o {
+		pkeyArgs := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(obj)), mailPrimaryKeyMapping)
+		args = append(args, pkeyArgs...)
+	}
+
+	sql := "DELETE FROM \"mail\" WHERE " +
+		strmangle.WhereClauseRepeated(string(dialect.LQ), string(dialect.RQ), 1, mailPrimaryKeyColumns, len(o))
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, args)
+	}
+	result, err := exec.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "models: unable to delete all from mail slice")
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "models: failed to get rows affected by deleteall for mail")
+	}
+
+	if len(mailAfterDeleteHooks) != 0 {
+		for _, obj := range o {
+			if err := obj.doAfterDeleteHooks(ctx, exec); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return rowsAff, nil
+}
+
+// Reload refetches the object from the database
+// using the primary keys with an executor.
+func (o *Mail) Reload(ctx context.Context, exec boil.ContextExecutor) error {
+	ret, err := FindMail(ctx, exec, o.Serial)
+	if err != nil {
+		return err
+	}
+
+	*o = *ret
+	return nil
+}
+
+// ReloadAll refetches every row with matching primary key column values
+// and overwrites the original object slice with the newly updated slice.
+func (o *MailSlice) ReloadAll(ctx context.Context, exec boil.ContextExecutor) error {
+	if o == nil || len(*o) == 0 {
+		return nil
+	}
+
+	slice := MailSlice{}
+	var args []interface{}
+	for _, obj := range *o {
+		pkeyArgs := queries.ValuesFromMapping(reflect.Indirect(reflect.ValueOf(obj)), mailPrimaryKeyMapping)
+		args = append(args, pkeyArgs...)
+	}
+
+	sql := "SELECT \"mail\".* FROM \"mail\" WHERE " +
+		strmangle.WhereClauseRepeated(string(dialect.LQ), string(dialect.RQ), 1, mailPrimaryKeyColumns, len(*o))
+
+	q := queries.Raw(sql, args...)
+
+	err := q.Bind(ctx, exec, &slice)
+	if err != nil {
+		return errors.Wrap(err, "models: unable to reload all in MailSlice")
+	}
+
+	*o = slice
+
+	return nil
+}
+
+// MailExists checks if the Mail row exists.
+func MailExists(ctx context.Context, exec boil.ContextExecutor, serial int64) (bool, error) {
+	var exists bool
+	sql := "select exists(select 1 from \"mail\" where \"serial\"=$1 limit 1)"
+
+	if boil.IsDebug(ctx) {
+		writer := boil.DebugWriterFrom(ctx)
+		fmt.Fprintln(writer, sql)
+		fmt.Fprintln(writer, serial)
+	}
+	row := exec.QueryRowContext(ctx, sql, serial)
+
+	err := row.Scan(&exists)
+	if err != nil {
+		return false, errors.Wrap(err, "models: unable to check if mail exists")
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,148 @@
+package dualstack
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	lookupIP = net.DefaultResolver.LookupIP // Resolver for hostnames, which is replaced in tests so that they don't depend on the host's IPv4 and IPv6 setup
+)
+
+// getIPNetwork returns the network to resolve hostnames in for a network (i.e. ip6 for tcp6)
+func getIPNetwork(network string) string {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return "ip4"
+	case strings.HasSuffix(network, "6"):
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// Dial connects to an address with a dial function; hostnames are resolved in the IP family of the network, and if they have both IPv4 and IPv6 addresses, IPv6 is dialed first and IPv4 is raced against it after the fallback delay or as soon as IPv6 has failed (happy eyeballs, RFC 8305); connections which are established after another one has won are closed with closeConn
+func Dial[T any](
+	ctx context.Context,
+	network string,
+	addr string,
+	fallbackDelay time.Duration,
+	dial func(ctx context.Context, network, addr string) (T, error),
+	closeConn func(T),
+) (T, error) {
+	var zero T
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return zero, err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		// Dial functions which don't know about IP families (i.e. QUIC's) would otherwise connect to literals in the wrong family
+		if ipNetwork := getIPNetwork(network); (ipNetwork == "ip4" && ip.To4() == nil) || (ipNetwork == "ip6" && ip.To4() != nil) {
+			return zero, &net.AddrError{Err: "no suitable address found", Addr: host}
+		}
+
+		return dial(ctx, network, addr)
+	}
+
+	ips, err := lookupIP(ctx, getIPNetwork(network), host)
+	if err != nil {
+		return zero, err
+	}
+
+	primaries, fallbacks := []string{}, []string{}
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			primaries = append(primaries, net.JoinHostPort(ip.String(), port))
+		} else {
+			fallbacks = append(fallbacks, net.JoinHostPort(ip.String(), port))
+		}
+	}
+
+	dialAddrs := func(ctx context.Context, addrs []string) (T, error) {
+		var err error
+		for _, addr := range addrs {
+			var conn T
+			conn, err = dial(ctx, network, addr)
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return zero, err
+	}
+
+	if len(primaries) == 0 || len(fallbacks) == 0 {
+		return dialAddrs(ctx, append(primaries, fallbacks...))
+	}
+
+	type result struct {
+		conn T
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, 2)
+	race := func(addrs []string) {
+		go func() {
+			conn, err := dialAddrs(ctx, addrs)
+
+			results <- result{conn, err}
+		}()
+	}
+
+	race(primaries)
+	pending := 1
+
+	fallback := time.NewTimer(fallbackDelay)
+	defer fallback.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-fallback.C:
+			if fallbacks != nil {
+				race(fallbacks)
+				pending++
+
+				fallbacks = nil
+			}
+		case r := <-results:
+			pending--
+
+			if r.err == nil {
+				// The other family could still connect after it has been cancelled, so its connection is closed
+				if pending > 0 {
+					go func() {
+						if r := <-results; r.err == nil {
+							closeConn(r.conn)
+						}
+					}()
+				}
+
+				return r.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = r.err
+			}
+
+			// Don't wait for the fallback delay if the primary family has already failed
+			if fallbacks != nil {
+				race(fallbacks)
+				pending++
+
+				fallbacks = nil
+			}
+
+			if pending == 0 {
+				return zero, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package dualstack
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testFallbackDelay = time.Millisecond * 50
+	testHost          = "dualstack.test"
+)
+
+var (
+	errRefused = errors.New("connection refused")
+)
+
+// withLookup resolves testHost to ips for the duration of a test
+func withLookup(t *testing.T, ips ...string) {
+	parsed := []net.IP{}
+	for _, ip := range ips {
+		parsed = append(parsed, net.ParseIP(ip))
+	}
+
+	previous := lookupIP
+	lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		if host != testHost {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		res := []net.IP{}
+		for _, ip := range parsed {
+			if (network == "ip4" && ip.To4() == nil) || (network == "ip6" && ip.To4() != nil) {
+				continue
+			}
+
+			res = append(res, ip)
+		}
+
+		if len(res) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		return res, nil
+	}
+
+	t.Cleanup(func() {
+		lookupIP = previous
+	})
+}
+
+// fakeDialer dials addresses with a behaviour per IP; connections are the addresses which have been dialed
+type fakeDialer struct {
+	behaviours map[string]string // Behaviour by IP: ok connects immediately, refuse fails immediately, blackhole blocks until cancelled and late connects after the fallback delay even if cancelled
+
+	lock   sync.Mutex
+	dialed []string
+	closed chan string
+}
+
+func newFakeDialer(behaviours map[string]string) *fakeDialer {
+	return &fakeDialer{
+		behaviours: behaviours,
+
+		closed: make(chan string, len(behaviours)),
+	}
+}
+
+func (d *fakeDialer) dial(ctx context.Context, network, addr string) (string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	d.lock.Lock()
+	d.dialed = append(d.dialed, host)
+	d.lock.Unlock()
+
+	switch d.behaviours[host] {
+	case "ok":
+		return host, nil
+	case "blackhole":
+		<-ctx.Done()
+
+		return "", ctx.Err()
+	case "late":
+		time.Sleep(testFallbackDelay * 2)
+
+		return host, nil
+	default:
+		return "", errRefused
+	}
+}
+
+func (d *fakeDialer) close(conn string) {
+	d.closed <- conn
+}
+
+func TestDial(t *testing.T) {
+	tests := []struct {
+		name       string
+		network    string
+		addr       string
+		ips        []string
+		behaviours map[string]string
+		want       string
+		wantErr    bool
+		wantDialed []string // IPs which must have been dialed, in order
+		wantClosed string   // Connection which must be closed because it has lost the race
+	}{
+		{
+			name:       "ipv6 only",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"::1"},
+			behaviours: map[string]string{"::1": "ok"},
+			want:       "::1",
+			wantDialed: []string{"::1"},
+		},
+		{
+			name:       "ipv4 only",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1"},
+			behaviours: map[string]string{"127.0.0.1": "ok"},
+			want:       "127.0.0.1",
+			wantDialed: []string{"127.0.0.1"},
+		},
+		{
+			name:       "dual-stack prefers ipv6",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::1": "ok"},
+			want:       "::1",
+			wantDialed: []string{"::1"},
+		},
+		{
+			name:       "dual-stack with refused ipv6",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::1": "refuse"},
+			want:       "127.0.0.1",
+			wantDialed: []string{"::1", "127.0.0.1"},
+		},
+		{
+			name:       "dual-stack with refused ipv4",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "refuse", "::1": "ok"},
+			want:       "::1",
+			wantDialed: []string{"::1"},
+		},
+		{
+			name:       "dual-stack with blackholed ipv6",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::1": "blackhole"},
+			want:       "127.0.0.1",
+			wantDialed: []string{"::1", "127.0.0.1"},
+		},
+		{
+			name:       "dual-stack with slow ipv6",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::1": "late"},
+			want:       "127.0.0.1",
+			wantDialed: []string{"::1", "127.0.0.1"},
+			wantClosed: "::1",
+		},
+		{
+			name:       "dual-stack with multiple addresses per family",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::2", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::2": "refuse", "::1": "ok"},
+			want:       "::1",
+			wantDialed: []string{"::2", "::1"},
+		},
+		{
+			name:       "dual-stack with both families refused",
+			network:    "tcp",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{},
+			wantErr:    true,
+			wantDialed: []string{"::1", "127.0.0.1"},
+		},
+		{
+			name:       "dual-stack in ipv4",
+			network:    "tcp4",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::1": "ok"},
+			want:       "127.0.0.1",
+			wantDialed: []string{"127.0.0.1"},
+		},
+		{
+			name:       "dual-stack in ipv6",
+			network:    "udp6",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"127.0.0.1", "::1"},
+			behaviours: map[string]string{"127.0.0.1": "ok", "::1": "ok"},
+			want:       "::1",
+			wantDialed: []string{"::1"},
+		},
+		{
+			name:       "ipv6-only host in ipv4",
+			network:    "tcp4",
+			addr:       net.JoinHostPort(testHost, "1337"),
+			ips:        []string{"::1"},
+			behaviours: map[string]string{"::1": "ok"},
+			wantErr:    true,
+			wantDialed: []string{},
+		},
+		{
+			name:       "ipv6 literal",
+			network:    "tcp",
+			addr:       "[::1]:1337",
+			behaviours: map[string]string{"::1": "ok"},
+			want:       "::1",
+			wantDialed: []string{"::1"},
+		},
+		{
+			name:       "ipv4 literal",
+			network:    "tcp",
+			addr:       "127.0.0.1:1337",
+			behaviours: map[string]string{"127.0.0.1": "ok"},
+			want:       "127.0.0.1",
+			wantDialed: []string{"127.0.0.1"},
+		},
+		{
+			name:       "ipv6 literal in ipv4",
+			network:    "udp4",
+			addr:       "[::1]:1337",
+			behaviours: map[string]string{"::1": "ok"},
+			wantErr:    true,
+			wantDialed: []string{},
+		},
+		{
+			name:       "ipv4 literal in ipv6",
+			network:    "tcp6",
+			addr:       "127.0.0.1:1337",
+			behaviours: map[string]string{"127.0.0.1": "ok"},
+			wantErr:    true,
+			wantDialed: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withLookup(t, tt.ips...)
+
+			d := newFakeDialer(tt.behaviours)
+
+			got, err := Dial(context.Background(), tt.network, tt.addr, testFallbackDelay, d.dial, d.close)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", got)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != tt.want {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+
+			if tt.wantClosed != "" {
+				select {
+				case closed := <-d.closed:
+					if closed != tt.wantClosed {
+						t.Fatalf("closed %v, want %v", closed, tt.wantClosed)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("%v was not closed", tt.wantClosed)
+				}
+			}
+
+			d.lock.Lock()
+			defer d.lock.Unlock()
+
+			if len(d.dialed) != len(tt.wantDialed) {
+				t.Fatalf("dialed %v, want %v", d.dialed, tt.wantDialed)
+			}
+
+			for i := range d.dialed {
+				if d.dialed[i] != tt.wantDialed[i] {
+					t.Fatalf("dialed %v, want %v", d.dialed, tt.wantDialed)
+				}
+			}
+		})
+	}
+}
+
+func TestDialFallbackDelay(t *testing.T) {
+	withLookup(t, "127.0.0.1", "::1")
+
+	d := newFakeDialer(map[string]string{"127.0.0.1": "ok", "::1": "blackhole"})
+
+	start := time.Now()
+	if _, err := Dial(context.Background(), "tcp", net.JoinHostPort(testHost, "1337"), testFallbackDelay, d.dial, d.close); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < testFallbackDelay {
+		t.Fatalf("ipv4 was dialed after %v, want at least %v", elapsed, testFallbackDelay)
+	}
+}
+
+func TestDialCancel(t *testing.T) {
+	withLookup(t, "127.0.0.1", "::1")
+
+	d := newFakeDialer(map[string]string{"127.0.0.1": "blackhole", "::1": "blackhole"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testFallbackDelay*2)
+	defer cancel()
+
+	if _, err := Dial(ctx, "tcp", net.JoinHostPort(testHost, "1337"), testFallbackDelay, d.dial, d.close); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestListenTCP(t *testing.T) {
+	withLookup(t, "127.0.0.1", "::1")
+
+	tests := []struct {
+		name      string
+		laddr     string
+		wantAddrs int // Amount of addresses which must accept connections on the same port
+		dialAddrs []string
+	}{
+		{"hostname", net.JoinHostPort(testHost, "0"), 2, []string{"127.0.0.1", "::1"}},
+		{"ipv6 literal", "[::1]:0", 1, []string{"::1"}},
+		{"ipv4 literal", "127.0.0.1:0", 1, []string{"127.0.0.1"}},
+		{"wildcard", ":0", 1, []string{"127.0.0.1", "::1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := ListenTCP(context.Background(), tt.laddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			if _, ok := listener.(*multiListener); ok != (tt.wantAddrs > 1) {
+				t.Fatalf("got multi-address listener %v, want %v", ok, tt.wantAddrs > 1)
+			}
+
+			port := listener.Addr().(*net.TCPAddr).Port
+
+			accepted := make(chan error)
+			go func() {
+				for range tt.dialAddrs {
+					conn, err := listener.Accept()
+					if err != nil {
+						accepted <- err
+
+						return
+					}
+
+					accepted <- conn.Close()
+				}
+			}()
+
+			for _, ip := range tt.dialAddrs {
+				conn, err := net.Dial("tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = conn.Close()
+
+				if err := <-accepted; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := listener.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := listener.Accept(); err == nil {
+				t.Fatal("accepted connection after closing, want error")
+			}
+		})
+	}
+}
+
+func TestListenUDP(t *testing.T) {
+	withLookup(t, "127.0.0.1", "::1")
+
+	tests := []struct {
+		name      string
+		laddr     string
+		wantConns []string
+	}{
+		{"hostname", net.JoinHostPort(testHost, "0"), []string{"127.0.0.1", "::1"}},
+		{"ipv6 literal", "[::1]:0", []string{"::1"}},
+		{"wildcard", ":0", []string{"::"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conns, err := ListenUDP(context.Background(), tt.laddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				for _, conn := range conns {
+					_ = conn.Close()
+				}
+			}()
+
+			if len(conns) != len(tt.wantConns) {
+				t.Fatalf("got %v connections, want %v", len(conns), len(tt.wantConns))
+			}
+
+			port := conns[0].LocalAddr().(*net.UDPAddr).Port
+			for i, conn := range conns {
+				addr := conn.LocalAddr().(*net.UDPAddr)
+				if addr.Port != port {
+					t.Fatalf("got port %v, want %v", addr.Port, port)
+				}
+
+				if !addr.IP.Equal(net.ParseIP(tt.wantConns[i])) {
+					t.Fatalf("got address %v, want %v", addr.IP, tt.wantConns[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListenUnresolvable(t *testing.T) {
+	withLookup(t)
+
+	if _, err := ListenTCP(context.Background(), net.JoinHostPort(testHost, "0")); err == nil {
+		t.Fatal("listened on unresolvable host, want error")
+	}
+
+	if _, err := ListenUDP(context.Background(), net.JoinHostPort(testHost, "0")); err == nil {
+		t.Fatal("listened on unresolvable host, want error")
+	}
+}
@@ -0,0 +1,202 @@
+package dualstack
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// getListenAddrs returns the addresses to listen on for a listening address; hostnames which resolve to multiple addresses (i.e. localhost on dual-stack hosts) are listened on with all of them, while IP literals (i.e. [::1]:1337) and wildcard addresses (i.e. :1337, which accepts both IPv4 and IPv6) are listened on as-is
+func getListenAddrs(ctx context.Context, laddr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{laddr}, nil
+	}
+
+	ips, err := lookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []string{}
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+
+	return addrs, nil
+}
+
+// withPort replaces the port of an address; listeners after the first one use the port of the first one, so that all addresses share the same port if it is chosen by the system (port 0)
+func withPort(addr string, port int) (string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// ListenTCP listens on all addresses of a listening address; hostnames which resolve to multiple addresses (i.e. localhost on dual-stack hosts) are listened on with all of them, which share the port
+func ListenTCP(ctx context.Context, laddr string) (net.Listener, error) {
+	addrs, err := getListenAddrs(ctx, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := []net.Listener{}
+	for i, addr := range addrs {
+		if i > 0 {
+			if addr, err = withPort(addr, listeners[0].Addr().(*net.TCPAddr).Port); err != nil {
+				break
+			}
+		}
+
+		var listener net.Listener
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			break
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	if err != nil {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+
+		return nil, err
+	}
+
+	if len(listeners) == 1 {
+		return listeners[0], nil
+	}
+
+	return newMultiListener(listeners), nil
+}
+
+// ListenUDP listens on all addresses of a listening address (see ListenTCP)
+func ListenUDP(ctx context.Context, laddr string) ([]*net.UDPConn, error) {
+	addrs, err := getListenAddrs(ctx, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	conns := []*net.UDPConn{}
+	for i, addr := range addrs {
+		if i > 0 {
+			if addr, err = withPort(addr, conns[0].LocalAddr().(*net.UDPAddr).Port); err != nil {
+				break
+			}
+		}
+
+		var udpAddr *net.UDPAddr
+		udpAddr, err = net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			break
+		}
+
+		var conn *net.UDPConn
+		conn, err = net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			break
+		}
+
+		conns = append(conns, conn)
+	}
+
+	if err != nil {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+
+		return nil, err
+	}
+
+	return conns, nil
+}
+
+// multiListener accepts connections from multiple listeners; its address is the address of the first listener
+type multiListener struct {
+	listeners []net.Listener
+
+	conns chan net.Conn
+	errs  chan error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	l := &multiListener{
+		listeners: listeners,
+
+		conns: make(chan net.Conn),
+		errs:  make(chan error),
+
+		done: make(chan struct{}),
+	}
+
+	for _, listener := range listeners {
+		go l.accept(listener)
+	}
+
+	return l
+}
+
+func (l *multiListener) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+
+			return
+		}
+
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			_ = conn.Close()
+
+			return
+		}
+	}
+}
+
+func (l *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *multiListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+
+		for _, listener := range l.listeners {
+			if e := listener.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+
+	return err
+}
+
+func (l *multiListener) Addr() net.Addr {
+	return l.listeners[0].Addr()
+}
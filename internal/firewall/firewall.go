@@ -0,0 +1,77 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	BackendNFTables = "nftables" // Manage rules with nft
+	BackendIPTables = "iptables" // Manage rules with iptables and ip6tables
+
+	ProtocolTCP  = "tcp"  // Allow a TCP port or range of ports
+	ProtocolUDP  = "udp"  // Allow a UDP port or range of ports
+	ProtocolICMP = "icmp" // Allow ICMP and ICMPv6
+)
+
+var (
+	ErrUnsupported    = errors.New("firewall management is only supported on Linux")                        // Firewall rules were requested on an unsupported platform
+	ErrInvalidPort    = errors.New("invalid port, expected format tcp/port, udp/port, tcp/from-to or icmp") // The specified port can't be parsed
+	ErrInvalidBackend = errors.New("invalid firewall backend, must be nftables or iptables")                // The specified backend is unknown
+	ErrMissingBackend = errors.New("neither nft nor iptables could be found")                               // No backend is installed
+)
+
+// Port is a port or range of ports to allow
+type Port struct {
+	Protocol string // Protocol of the port
+	From     uint16 // First port of the range (0 for ICMP)
+	To       uint16 // Last port of the range (0 for ICMP)
+}
+
+// Rules configures the firewall for a device
+type Rules struct {
+	Device       string       // Name of the device to manage rules for
+	Backend      string       // Backend to use (default is nftables if nft is installed, otherwise iptables)
+	AllowedPorts []Port       // Incoming ports to allow; established traffic is always allowed (empty allows all)
+	Networks     []*net.IPNet // Networks of the device to masquerade
+	Masquerade   bool         // Whether to masquerade traffic from the networks which leaves through other devices
+}
+
+// ParsePort parses a port in the format tcp/22, udp/5000-5100 or icmp
+func ParsePort(raw string) (Port, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == ProtocolICMP {
+		return Port{Protocol: ProtocolICMP}, nil
+	}
+
+	parts := strings.Split(raw, "/")
+	if len(parts) != 2 || (parts[0] != ProtocolTCP && parts[0] != ProtocolUDP) {
+		return Port{}, ErrInvalidPort
+	}
+
+	bounds := strings.Split(parts[1], "-")
+	if len(bounds) > 2 {
+		return Port{}, ErrInvalidPort
+	}
+
+	from, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil || from == 0 {
+		return Port{}, ErrInvalidPort
+	}
+
+	to := from
+	if len(bounds) == 2 {
+		to, err = strconv.ParseUint(bounds[1], 10, 16)
+		if err != nil || to < from {
+			return Port{}, ErrInvalidPort
+		}
+	}
+
+	return Port{
+		Protocol: parts[0],
+		From:     uint16(from),
+		To:       uint16(to),
+	}, nil
+}
@@ -0,0 +1,284 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ruleComment = "weron" // Comment to identify rules which have been added to built-in chains
+)
+
+var (
+	invalidTableCharacters = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// Firewall manages the rules for a device
+type Firewall struct {
+	rules   *Rules
+	backend string
+}
+
+// New creates the firewall
+func New(rules *Rules) *Firewall {
+	if rules == nil {
+		rules = &Rules{}
+	}
+
+	return &Firewall{
+		rules: rules,
+	}
+}
+
+// Open applies the rules
+func (f *Firewall) Open() error {
+	f.backend = f.rules.Backend
+	switch f.backend {
+	case "":
+		if _, err := exec.LookPath("nft"); err == nil {
+			f.backend = BackendNFTables
+		} else if _, err := exec.LookPath("iptables"); err == nil {
+			f.backend = BackendIPTables
+		} else {
+			return ErrMissingBackend
+		}
+	case BackendNFTables, BackendIPTables:
+	default:
+		return ErrInvalidBackend
+	}
+
+	// Remove rules which have been left behind by an instance which didn't shut down cleanly
+	_ = f.remove()
+
+	if f.rules.Masquerade {
+		if err := enableForwarding(); err != nil {
+			return err
+		}
+	}
+
+	if f.backend == BackendNFTables {
+		return f.applyNFTables()
+	}
+
+	return f.applyIPTables()
+}
+
+// Close removes the rules
+func (f *Firewall) Close() error {
+	if f.backend == "" {
+		return nil
+	}
+
+	return f.remove()
+}
+
+func (f *Firewall) remove() error {
+	if f.backend == BackendNFTables {
+		return run("nft", "delete", "table", "inet", f.getTableName())
+	}
+
+	// Rules and chains which don't exist can't be removed, so errors are expected here
+	in, nat := f.getChainNames()
+	for _, command := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(command); err != nil {
+			continue
+		}
+
+		for _, args := range [][]string{
+			{"-D", "INPUT", "-i", f.rules.Device, "-j", in},
+			{"-F", in},
+			{"-X", in},
+			{"-D", "FORWARD", "-i", f.rules.Device, "-m", "comment", "--comment", ruleComment, "-j", "ACCEPT"},
+			{"-D", "FORWARD", "-o", f.rules.Device, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-m", "comment", "--comment", ruleComment, "-j", "ACCEPT"},
+			{"-t", "nat", "-D", "POSTROUTING", "-j", nat},
+			{"-t", "nat", "-F", nat},
+			{"-t", "nat", "-X", nat},
+		} {
+			_ = run(command, args...)
+		}
+	}
+
+	return nil
+}
+
+func (f *Firewall) applyNFTables() error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(f.getNFTablesRuleset())
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not apply nftables rules: %v: %v", string(output), err)
+	}
+
+	return nil
+}
+
+// getNFTablesRuleset generates the table with the rules for the device
+func (f *Firewall) getNFTablesRuleset() string {
+	device := strconv.Quote(f.rules.Device)
+
+	var ruleset strings.Builder
+	fmt.Fprintf(&ruleset, "table inet %v {\n", f.getTableName())
+
+	if len(f.rules.AllowedPorts) > 0 {
+		ruleset.WriteString("\tchain input {\n")
+		ruleset.WriteString("\t\ttype filter hook input priority filter; policy accept;\n")
+		fmt.Fprintf(&ruleset, "\t\tiifname %v ct state established,related accept\n", device)
+
+		for _, port := range f.rules.AllowedPorts {
+			if port.Protocol == ProtocolICMP {
+				fmt.Fprintf(&ruleset, "\t\tiifname %v meta l4proto { icmp, ipv6-icmp } accept\n", device)
+
+				continue
+			}
+
+			// nft rejects ranges which only contain a single port
+			ports := fmt.Sprintf("%v", port.From)
+			if port.To != port.From {
+				ports = fmt.Sprintf("%v-%v", port.From, port.To)
+			}
+
+			fmt.Fprintf(&ruleset, "\t\tiifname %v %v dport %v accept\n", device, port.Protocol, ports)
+		}
+
+		fmt.Fprintf(&ruleset, "\t\tiifname %v drop\n", device)
+		ruleset.WriteString("\t}\n")
+	}
+
+	if f.rules.Masquerade {
+		// Mirrors the rules which are added to the FORWARD chain for iptables
+		ruleset.WriteString("\tchain forward {\n")
+		ruleset.WriteString("\t\ttype filter hook forward priority filter; policy accept;\n")
+		fmt.Fprintf(&ruleset, "\t\tiifname %v accept\n", device)
+		fmt.Fprintf(&ruleset, "\t\toifname %v ct state established,related accept\n", device)
+		ruleset.WriteString("\t}\n")
+
+		ruleset.WriteString("\tchain postrouting {\n")
+		ruleset.WriteString("\t\ttype nat hook postrouting priority srcnat; policy accept;\n")
+
+		for _, network := range f.rules.Networks {
+			family := "ip6"
+			if network.IP.To4() != nil {
+				family = "ip"
+			}
+
+			fmt.Fprintf(&ruleset, "\t\t%v saddr %v oifname != %v masquerade\n", family, network.String(), device)
+		}
+
+		ruleset.WriteString("\t}\n")
+	}
+
+	ruleset.WriteString("}\n")
+
+	return ruleset.String()
+}
+
+func (f *Firewall) applyIPTables() error {
+	for _, command := range []string{"iptables", "ip6tables"} {
+		ipv4 := command == "iptables"
+
+		if _, err := exec.LookPath(command); err != nil {
+			// IPv6 rules are optional, as ip6tables is not installed on all systems
+			if ipv4 {
+				return err
+			}
+
+			continue
+		}
+
+		for _, args := range f.getIPTablesRules(ipv4) {
+			if err := run(command, args...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// getIPTablesRules generates the arguments for iptables (or ip6tables if ipv4 is false) which add the rules for the device
+func (f *Firewall) getIPTablesRules(ipv4 bool) [][]string {
+	in, nat := f.getChainNames()
+
+	rules := [][]string{}
+	if len(f.rules.AllowedPorts) > 0 {
+		rules = append(rules,
+			[]string{"-N", in},
+			[]string{"-A", in, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+		)
+
+		for _, port := range f.rules.AllowedPorts {
+			if port.Protocol == ProtocolICMP {
+				protocol := "ipv6-icmp"
+				if ipv4 {
+					protocol = "icmp"
+				}
+
+				rules = append(rules, []string{"-A", in, "-p", protocol, "-j", "ACCEPT"})
+
+				continue
+			}
+
+			rules = append(rules, []string{"-A", in, "-p", port.Protocol, "--dport", fmt.Sprintf("%v:%v", port.From, port.To), "-j", "ACCEPT"})
+		}
+
+		rules = append(rules,
+			[]string{"-A", in, "-j", "DROP"},
+			[]string{"-I", "INPUT", "-i", f.rules.Device, "-j", in},
+		)
+	}
+
+	if f.rules.Masquerade {
+		rules = append(rules,
+			[]string{"-I", "FORWARD", "-i", f.rules.Device, "-m", "comment", "--comment", ruleComment, "-j", "ACCEPT"},
+			[]string{"-I", "FORWARD", "-o", f.rules.Device, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-m", "comment", "--comment", ruleComment, "-j", "ACCEPT"},
+			[]string{"-t", "nat", "-N", nat},
+		)
+
+		for _, network := range f.rules.Networks {
+			if (network.IP.To4() != nil) != ipv4 {
+				continue
+			}
+
+			rules = append(rules, []string{"-t", "nat", "-A", nat, "-s", network.String(), "!", "-o", f.rules.Device, "-j", "MASQUERADE"})
+		}
+
+		rules = append(rules, []string{"-t", "nat", "-I", "POSTROUTING", "-j", nat})
+	}
+
+	return rules
+}
+
+func (f *Firewall) getTableName() string {
+	return "weron_" + invalidTableCharacters.ReplaceAllString(f.rules.Device, "_")
+}
+
+func (f *Firewall) getChainNames() (string, string) {
+	return "WERON-IN-" + f.rules.Device, "WERON-NAT-" + f.rules.Device
+}
+
+func enableForwarding() error {
+	if err := os.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644); err != nil {
+		return err
+	}
+
+	// IPv6 can be disabled in the kernel, in which case there is nothing to forward
+	if err := os.WriteFile("/proc/sys/net/ipv6/conf/all/forwarding", []byte("1"), 0644); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func run(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("could not run %v %v: %v: %v", name, strings.Join(args, " "), strings.TrimSpace(string(output)), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package firewall
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func mustParseCIDR(t *testing.T, raw string) *net.IPNet {
+	t.Helper()
+
+	_, network, err := net.ParseCIDR(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return network
+}
+
+func TestGetNFTablesRuleset(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules *Rules
+		want  string
+	}{
+		{
+			"no rules",
+			&Rules{Device: "weron0"},
+			"table inet weron_weron0 {\n}\n",
+		},
+		{
+			"device with invalid characters",
+			&Rules{Device: "weron-0.1"},
+			"table inet weron_weron_0_1 {\n}\n",
+		},
+		{
+			"allowed ports",
+			&Rules{
+				Device: "weron0",
+				AllowedPorts: []Port{
+					{Protocol: ProtocolTCP, From: 22, To: 22},
+					{Protocol: ProtocolUDP, From: 5000, To: 5100},
+					{Protocol: ProtocolICMP},
+				},
+			},
+			`table inet weron_weron0 {
+	chain input {
+		type filter hook input priority filter; policy accept;
+		iifname "weron0" ct state established,related accept
+		iifname "weron0" tcp dport 22 accept
+		iifname "weron0" udp dport 5000-5100 accept
+		iifname "weron0" meta l4proto { icmp, ipv6-icmp } accept
+		iifname "weron0" drop
+	}
+}
+`,
+		},
+		{
+			"masquerade",
+			&Rules{
+				Device:     "weron0",
+				Networks:   []*net.IPNet{mustParseCIDR(t, "10.0.0.0/24"), mustParseCIDR(t, "fd00::/64")},
+				Masquerade: true,
+			},
+			`table inet weron_weron0 {
+	chain forward {
+		type filter hook forward priority filter; policy accept;
+		iifname "weron0" accept
+		oifname "weron0" ct state established,related accept
+	}
+	chain postrouting {
+		type nat hook postrouting priority srcnat; policy accept;
+		ip saddr 10.0.0.0/24 oifname != "weron0" masquerade
+		ip6 saddr fd00::/64 oifname != "weron0" masquerade
+	}
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.rules).getNFTablesRuleset(); got != tt.want {
+				t.Fatalf("got ruleset\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIPTablesRules(t *testing.T) {
+	rules := &Rules{
+		Device: "weron0",
+		AllowedPorts: []Port{
+			{Protocol: ProtocolTCP, From: 22, To: 22},
+			{Protocol: ProtocolICMP},
+		},
+		Networks:   []*net.IPNet{mustParseCIDR(t, "10.0.0.0/24"), mustParseCIDR(t, "fd00::/64")},
+		Masquerade: true,
+	}
+
+	tests := []struct {
+		name  string
+		rules *Rules
+		ipv4  bool
+		want  [][]string
+	}{
+		{
+			"no rules",
+			&Rules{Device: "weron0"},
+			true,
+			[][]string{},
+		},
+		{
+			"ipv4",
+			rules,
+			true,
+			[][]string{
+				{"-N", "WERON-IN-weron0"},
+				{"-A", "WERON-IN-weron0", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+				{"-A", "WERON-IN-weron0", "-p", "tcp", "--dport", "22:22", "-j", "ACCEPT"},
+				{"-A", "WERON-IN-weron0", "-p", "icmp", "-j", "ACCEPT"},
+				{"-A", "WERON-IN-weron0", "-j", "DROP"},
+				{"-I", "INPUT", "-i", "weron0", "-j", "WERON-IN-weron0"},
+				{"-I", "FORWARD", "-i", "weron0", "-m", "comment", "--comment", "weron", "-j", "ACCEPT"},
+				{"-I", "FORWARD", "-o", "weron0", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-m", "comment", "--comment", "weron", "-j", "ACCEPT"},
+				{"-t", "nat", "-N", "WERON-NAT-weron0"},
+				{"-t", "nat", "-A", "WERON-NAT-weron0", "-s", "10.0.0.0/24", "!", "-o", "weron0", "-j", "MASQUERADE"},
+				{"-t", "nat", "-I", "POSTROUTING", "-j", "WERON-NAT-weron0"},
+			},
+		},
+		{
+			"ipv6",
+			rules,
+			false,
+			[][]string{
+				{"-N", "WERON-IN-weron0"},
+				{"-A", "WERON-IN-weron0", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"},
+				{"-A", "WERON-IN-weron0", "-p", "tcp", "--dport", "22:22", "-j", "ACCEPT"},
+				{"-A", "WERON-IN-weron0", "-p", "ipv6-icmp", "-j", "ACCEPT"},
+				{"-A", "WERON-IN-weron0", "-j", "DROP"},
+				{"-I", "INPUT", "-i", "weron0", "-j", "WERON-IN-weron0"},
+				{"-I", "FORWARD", "-i", "weron0", "-m", "comment", "--comment", "weron", "-j", "ACCEPT"},
+				{"-I", "FORWARD", "-o", "weron0", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-m", "comment", "--comment", "weron", "-j", "ACCEPT"},
+				{"-t", "nat", "-N", "WERON-NAT-weron0"},
+				{"-t", "nat", "-A", "WERON-NAT-weron0", "-s", "fd00::/64", "!", "-o", "weron0", "-j", "MASQUERADE"},
+				{"-t", "nat", "-I", "POSTROUTING", "-j", "WERON-NAT-weron0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.rules).getIPTablesRules(tt.ipv4); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got rules %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package firewall
+
+// Firewall manages the rules for a device
+type Firewall struct{}
+
+// New creates the firewall
+func New(rules *Rules) *Firewall {
+	return &Firewall{}
+}
+
+// Open applies the rules
+func (f *Firewall) Open() error {
+	return ErrUnsupported
+}
+
+// Close removes the rules
+func (f *Firewall) Close() error {
+	return nil
+}
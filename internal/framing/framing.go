@@ -0,0 +1,98 @@
+package framing
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	MaxPayload = 16 * 1024 // Maximum payload of a frame; larger writes are split across frames
+)
+
+var (
+	ErrInvalidFrame = errors.New("received invalid frame") // The received frame is shorter than the header
+)
+
+// Conn sends and receives frames, which consist of a header of fixed length and a payload, over a message-oriented connection (i.e. a data channel) with one frame per message
+type Conn struct {
+	conn         io.ReadWriteCloser
+	headerLength int
+
+	writeLock sync.Mutex
+
+	readBuf []byte
+}
+
+// NewConn creates a framed connection with headers of headerLength bytes
+func NewConn(conn io.ReadWriteCloser, headerLength int) *Conn {
+	return &Conn{
+		conn:         conn,
+		headerLength: headerLength,
+
+		readBuf: make([]byte, headerLength+MaxPayload),
+	}
+}
+
+// WriteFrame writes a single frame; the header must have the header length of the connection and the payload must not exceed MaxPayload
+func (c *Conn) WriteFrame(header []byte, p []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	frame := make([]byte, len(header)+len(p))
+	copy(frame, header)
+	copy(frame[len(header):], p)
+
+	_, err := c.conn.Write(frame)
+
+	return err
+}
+
+// WriteFrames writes data as frames with the same header, splitting it across frames if it exceeds MaxPayload
+func (c *Conn) WriteFrames(header []byte, p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxPayload {
+			chunk = chunk[:MaxPayload]
+		}
+
+		if err := c.WriteFrame(header, chunk); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+// ReadFrame reads the next frame; the header and payload are only valid until the next call
+func (c *Conn) ReadFrame() ([]byte, []byte, error) {
+	n, err := c.conn.Read(c.readBuf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if n < c.headerLength {
+		return nil, nil, ErrInvalidFrame
+	}
+
+	return c.readBuf[:c.headerLength], c.readBuf[c.headerLength:n], nil
+}
+
+// Close closes the underlying connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Writer writes data as frames with a header, splitting large writes across frames
+type Writer struct {
+	Conn   *Conn
+	Header []byte
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.Conn.WriteFrames(w.Header, p)
+}
@@ -0,0 +1,132 @@
+package framing
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// messageConn is a message-oriented loopback connection which returns each write as a single read
+type messageConn struct {
+	messages chan []byte
+}
+
+func newMessageConn() *messageConn {
+	return &messageConn{messages: make(chan []byte, 1024)}
+}
+
+func (c *messageConn) Read(p []byte) (int, error) {
+	msg, ok := <-c.messages
+	if !ok {
+		return 0, io.EOF
+	}
+
+	return copy(p, msg), nil
+}
+
+func (c *messageConn) Write(p []byte) (int, error) {
+	c.messages <- append([]byte{}, p...)
+
+	return len(p), nil
+}
+
+func (c *messageConn) Close() error {
+	close(c.messages)
+
+	return nil
+}
+
+func TestWriteFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		length     int
+		wantFrames int
+	}{
+		{"empty", 0, 0},
+		{"single frame", 1, 1},
+		{"full frame", MaxPayload, 1},
+		{"split", MaxPayload + 1, 2},
+		{"multiple full frames", MaxPayload * 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := newMessageConn()
+			c := NewConn(raw, 2)
+
+			p := make([]byte, tt.length)
+			for i := range p {
+				p[i] = byte(i)
+			}
+
+			n, err := c.WriteFrames([]byte{1, 2}, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n != len(p) {
+				t.Fatalf("wrote %v bytes, want %v", n, len(p))
+			}
+
+			if got := len(raw.messages); got != tt.wantFrames {
+				t.Fatalf("wrote %v frames, want %v", got, tt.wantFrames)
+			}
+
+			received := []byte{}
+			for i := 0; i < tt.wantFrames; i++ {
+				header, payload, err := c.ReadFrame()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(header, []byte{1, 2}) {
+					t.Fatalf("read header %v, want %v", header, []byte{1, 2})
+				}
+
+				if len(payload) > MaxPayload {
+					t.Fatalf("read payload of %v bytes, want at most %v", len(payload), MaxPayload)
+				}
+
+				received = append(received, payload...)
+			}
+
+			if !bytes.Equal(received, p) {
+				t.Fatal("read payloads don't match written data")
+			}
+		})
+	}
+}
+
+func TestReadFrameInvalid(t *testing.T) {
+	raw := newMessageConn()
+	c := NewConn(raw, 5)
+
+	if _, err := raw.Write([]byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.ReadFrame(); err != ErrInvalidFrame {
+		t.Fatalf("got %v, want %v", err, ErrInvalidFrame)
+	}
+
+	if err := c.WriteFrame([]byte{1, 2, 3, 4, 5}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	header, payload, err := c.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(header) != 5 || len(payload) != 0 {
+		t.Fatalf("read header of %v and payload of %v bytes, want 5 and 0", len(header), len(payload))
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.ReadFrame(); err != io.EOF {
+		t.Fatalf("got %v, want %v", err, io.EOF)
+	}
+}
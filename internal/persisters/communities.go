@@ -3,16 +3,54 @@ package persisters
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 var (
 	ErrEphemeralCommunitiesDisabled = errors.New("creation of ephemeral communites is disabled")
+	ErrMailboxFull                  = errors.New("mailbox is full")
 )
 
 type Community struct {
-	ID         string `json:"id"`
-	Clients    int    `json:"clients"`
-	Persistent bool   `json:"persistent"`
+	ID         string     `json:"id"`
+	Clients    int        `json:"clients"`
+	Persistent bool       `json:"persistent"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+
+	PeakClients  int        `json:"peakClients"`            // Highest amount of concurrently connected clients
+	Messages     int64      `json:"messages"`               // Amount of signaling messages relayed
+	Bytes        int64      `json:"bytes"`                  // Amount of signaling traffic relayed in bytes
+	LastActivity *time.Time `json:"lastActivity,omitempty"` // Time at which a client last joined or sent a message
+	MonthBytes   int64      `json:"monthBytes"`             // Amount of signaling traffic relayed in the current calendar month (UTC) in bytes
+
+	Suspended bool `json:"suspended,omitempty"` // Whether the community has exceeded the monthly quota of the signaler; not stored, but set by the signaler
+}
+
+// UsageMonth returns the calendar month (UTC) to which traffic at t is counted
+func UsageMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+type Lease struct {
+	Community string   `json:"community"`
+	ID        string   `json:"id"`
+	IPs       []string `json:"ips"`
+	Name      string   `json:"name"`
+}
+
+type Member struct {
+	Community string    `json:"community"`
+	ID        string    `json:"id"`
+	Online    bool      `json:"online"`   // Whether the peer is connected to a signaler
+	LastSeen  time.Time `json:"lastSeen"` // Time at which the peer has last connected to or disconnected from a signaler
+}
+
+type Mail struct {
+	Community string    `json:"community"`
+	To        string    `json:"to"`
+	Payload   []byte    `json:"payload"`   // Message encrypted with the community key, which the signaler can't read
+	CreatedAt time.Time `json:"createdAt"` // Time at which the mail has been queued
+	ExpiresAt time.Time `json:"expiresAt"` // Time after which the mail is discarded if it hasn't been delivered
 }
 
 type CommunitiesPersister interface {
@@ -37,9 +75,80 @@ type CommunitiesPersister interface {
 		ctx context.Context,
 		community string,
 		password string,
+		expiresAt *time.Time,
+	) (*Community, error)
+	UpdatePersistentCommunity(
+		ctx context.Context,
+		community string,
+		password string,
+		expiresAt *time.Time,
 	) (*Community, error)
+	ValidatePassword(
+		ctx context.Context,
+		community string,
+		password string,
+	) error
 	DeleteCommunity(
 		ctx context.Context,
 		community string,
 	) error
+	DeleteExpiredCommunities(
+		ctx context.Context,
+	) ([]string, error)
+	RecordUsage(
+		ctx context.Context,
+		community string,
+		messages int64,
+		bytes int64,
+	) error
+	CreateLease(
+		ctx context.Context,
+		community string,
+		id string,
+		ips []string,
+		name string,
+	) (*Lease, error)
+	GetLeases(
+		ctx context.Context,
+		community string,
+	) ([]Lease, error)
+	GetLease(
+		ctx context.Context,
+		community string,
+		password string,
+		id string,
+	) (*Lease, error)
+	DeleteLease(
+		ctx context.Context,
+		community string,
+		id string,
+	) error
+	RecordMember(
+		ctx context.Context,
+		community string,
+		id string,
+		online bool,
+	) error
+	GetMembers(
+		ctx context.Context,
+		community string,
+	) ([]Member, error)
+	GetMember(
+		ctx context.Context,
+		community string,
+		id string,
+	) (*Member, error)
+	AddMail(
+		ctx context.Context,
+		community string,
+		to string,
+		payload []byte,
+		expiresAt time.Time,
+		limit int,
+	) error
+	TakeMail(
+		ctx context.Context,
+		community string,
+		to string,
+	) ([]Mail, error)
 }
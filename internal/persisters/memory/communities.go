@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/pojntfx/go-auth-utils/pkg/authn"
 	"github.com/pojntfx/weron/internal/persisters"
@@ -18,6 +19,11 @@ var (
 type Community struct {
 	*persisters.Community
 	password string
+	leases   map[string]persisters.Lease
+	members  map[string]persisters.Member
+	mail     map[string][]persisters.Mail
+
+	usageMonth string
 }
 
 type CommunitiesPersister struct {
@@ -59,12 +65,19 @@ func (p *CommunitiesPersister) AddClientsToCommunity(
 	}
 
 	if c == nil {
+		now := time.Now()
+
 		p.communities = append(p.communities, &Community{
 			password: string(hashedPassword),
+			leases:   map[string]persisters.Lease{},
+			members:  map[string]persisters.Member{},
+			mail:     map[string][]persisters.Mail{},
 			Community: &persisters.Community{
-				ID:         community,
-				Clients:    1,
-				Persistent: false,
+				ID:           community,
+				Clients:      1,
+				Persistent:   false,
+				PeakClients:  1,
+				LastActivity: &now,
 			},
 		})
 
@@ -76,6 +89,12 @@ func (p *CommunitiesPersister) AddClientsToCommunity(
 	}
 
 	c.Clients += 1
+	if c.Clients > c.PeakClients {
+		c.PeakClients = c.Clients
+	}
+
+	now := time.Now()
+	c.LastActivity = &now
 
 	return nil
 }
@@ -137,6 +156,12 @@ func (p *CommunitiesPersister) Cleanup(
 		// Set client count to 0 for all persistent communities
 		candidate.Clients = 0
 
+		// Mark all members as offline, as they have been connected to the previous signaler
+		for id, member := range candidate.members {
+			member.Online = false
+			candidate.members[id] = member
+		}
+
 		newCommunities = append(newCommunities, candidate)
 	}
 
@@ -157,6 +182,13 @@ func (p *CommunitiesPersister) GetCommunities(
 			ID:         community.ID,
 			Clients:    community.Clients,
 			Persistent: community.Persistent,
+			ExpiresAt:  community.ExpiresAt,
+
+			PeakClients:  community.PeakClients,
+			Messages:     community.Messages,
+			Bytes:        community.Bytes,
+			LastActivity: community.LastActivity,
+			MonthBytes:   community.monthBytes(),
 		})
 	}
 
@@ -167,6 +199,7 @@ func (p *CommunitiesPersister) CreatePersistentCommunity(
 	ctx context.Context,
 	community string,
 	password string,
+	expiresAt *time.Time,
 ) (*persisters.Community, error) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -191,10 +224,14 @@ func (p *CommunitiesPersister) CreatePersistentCommunity(
 
 	c = &Community{
 		password: string(hashedPassword),
+		leases:   map[string]persisters.Lease{},
+		members:  map[string]persisters.Member{},
+		mail:     map[string][]persisters.Mail{},
 		Community: &persisters.Community{
 			ID:         community,
 			Clients:    0,
 			Persistent: true,
+			ExpiresAt:  expiresAt,
 		},
 	}
 
@@ -204,11 +241,65 @@ func (p *CommunitiesPersister) CreatePersistentCommunity(
 		ID:         c.ID,
 		Clients:    c.Clients,
 		Persistent: c.Persistent,
+		ExpiresAt:  c.ExpiresAt,
 	}
 
 	return cc, nil
 }
 
+func (p *CommunitiesPersister) UpdatePersistentCommunity(
+	ctx context.Context,
+	community string,
+	password string,
+	expiresAt *time.Time,
+) (*persisters.Community, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	c.password = string(hashedPassword)
+	c.Persistent = true
+	c.ExpiresAt = expiresAt
+
+	cc := &persisters.Community{
+		ID:         c.ID,
+		Clients:    c.Clients,
+		Persistent: c.Persistent,
+		ExpiresAt:  c.ExpiresAt,
+	}
+
+	return cc, nil
+}
+
+func (p *CommunitiesPersister) ValidatePassword(
+	ctx context.Context,
+	community string,
+	password string,
+) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return sql.ErrNoRows
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(c.password), []byte(password)) != nil {
+		return authn.ErrWrongPassword
+	}
+
+	return nil
+}
+
 func (p *CommunitiesPersister) DeleteCommunity(
 	ctx context.Context,
 	community string,
@@ -236,3 +327,300 @@ func (p *CommunitiesPersister) DeleteCommunity(
 
 	return nil
 }
+
+func (p *CommunitiesPersister) DeleteExpiredCommunities(
+	ctx context.Context,
+) ([]string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+
+	deleted := []string{}
+	newCommunities := []*Community{}
+	for _, candidate := range p.communities {
+		if candidate.ExpiresAt != nil && !candidate.ExpiresAt.After(now) {
+			deleted = append(deleted, candidate.ID)
+
+			continue
+		}
+
+		newCommunities = append(newCommunities, candidate)
+	}
+
+	p.communities = newCommunities
+
+	return deleted, nil
+}
+
+func (p *CommunitiesPersister) RecordUsage(
+	ctx context.Context,
+	community string,
+	messages int64,
+	bytes int64,
+) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return sql.ErrNoRows
+	}
+
+	c.Messages += messages
+	c.Bytes += bytes
+
+	if month := persisters.UsageMonth(time.Now()); c.usageMonth != month {
+		c.usageMonth = month
+		c.MonthBytes = 0
+	}
+	c.MonthBytes += bytes
+
+	now := time.Now()
+	c.LastActivity = &now
+
+	return nil
+}
+
+func (p *CommunitiesPersister) getCommunity(community string) *Community {
+	for _, candidate := range p.communities {
+		if candidate.ID == community {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+func (p *CommunitiesPersister) CreateLease(
+	ctx context.Context,
+	community string,
+	id string,
+	ips []string,
+	name string,
+) (*persisters.Lease, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	lease := persisters.Lease{
+		Community: community,
+		ID:        id,
+		IPs:       ips,
+		Name:      name,
+	}
+
+	c.leases[id] = lease
+
+	return &lease, nil
+}
+
+func (p *CommunitiesPersister) GetLeases(
+	ctx context.Context,
+	community string,
+) ([]persisters.Lease, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	leases := []persisters.Lease{}
+	for _, lease := range c.leases {
+		leases = append(leases, lease)
+	}
+
+	return leases, nil
+}
+
+func (p *CommunitiesPersister) GetLease(
+	ctx context.Context,
+	community string,
+	password string,
+	id string,
+) (*persisters.Lease, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(c.password), []byte(password)) != nil {
+		return nil, authn.ErrWrongPassword
+	}
+
+	lease, ok := c.leases[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &lease, nil
+}
+
+func (p *CommunitiesPersister) DeleteLease(
+	ctx context.Context,
+	community string,
+	id string,
+) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return sql.ErrNoRows
+	}
+
+	if _, ok := c.leases[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(c.leases, id)
+
+	return nil
+}
+
+func (p *CommunitiesPersister) RecordMember(
+	ctx context.Context,
+	community string,
+	id string,
+	online bool,
+) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return sql.ErrNoRows
+	}
+
+	c.members[id] = persisters.Member{
+		Community: community,
+		ID:        id,
+		Online:    online,
+		LastSeen:  time.Now(),
+	}
+
+	return nil
+}
+
+func (p *CommunitiesPersister) GetMembers(
+	ctx context.Context,
+	community string,
+) ([]persisters.Member, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	members := []persisters.Member{}
+	for _, member := range c.members {
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func (p *CommunitiesPersister) GetMember(
+	ctx context.Context,
+	community string,
+	id string,
+) (*persisters.Member, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	member, ok := c.members[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &member, nil
+}
+
+func (p *CommunitiesPersister) AddMail(
+	ctx context.Context,
+	community string,
+	to string,
+	payload []byte,
+	expiresAt time.Time,
+	limit int,
+) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return sql.ErrNoRows
+	}
+
+	mail := c.getMail(to)
+	if len(mail) >= limit {
+		return persisters.ErrMailboxFull
+	}
+
+	c.mail[to] = append(mail, persisters.Mail{
+		Community: community,
+		To:        to,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	})
+
+	return nil
+}
+
+func (p *CommunitiesPersister) TakeMail(
+	ctx context.Context,
+	community string,
+	to string,
+) ([]persisters.Mail, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c := p.getCommunity(community)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	mail := c.getMail(to)
+	delete(c.mail, to)
+
+	return mail, nil
+}
+
+// getMail returns the mail for a peer which hasn't expired yet
+func (c *Community) getMail(to string) []persisters.Mail {
+	now := time.Now()
+
+	mail := []persisters.Mail{}
+	for _, m := range c.mail[to] {
+		if m.ExpiresAt.After(now) {
+			mail = append(mail, m)
+		}
+	}
+
+	return mail
+}
+
+func (c *Community) monthBytes() int64 {
+	if c.usageMonth != persisters.UsageMonth(time.Now()) {
+		return 0
+	}
+
+	return c.MonthBytes
+}
@@ -3,6 +3,8 @@ package psql
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/pojntfx/go-auth-utils/pkg/authn"
@@ -10,6 +12,7 @@ import (
 	models "github.com/pojntfx/weron/internal/db/psql/models/communities"
 	"github.com/pojntfx/weron/internal/persisters"
 	migrate "github.com/rubenv/sql-migrate"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"golang.org/x/crypto/bcrypt"
@@ -84,10 +87,12 @@ func (p *CommunitiesPersister) AddClientsToCommunity(
 			}
 
 			c = &models.Community{
-				ID:         community,
-				Password:   string(hashedPassword),
-				Clients:    1,
-				Persistent: false,
+				ID:           community,
+				Password:     string(hashedPassword),
+				Clients:      1,
+				Persistent:   false,
+				PeakClients:  1,
+				LastActivity: null.TimeFrom(time.Now()),
 			}
 
 			if err := c.Insert(ctx, tx, boil.Infer()); err != nil {
@@ -117,8 +122,13 @@ func (p *CommunitiesPersister) AddClientsToCommunity(
 	}
 
 	c.Clients += 1
+	if c.Clients > c.PeakClients {
+		c.PeakClients = c.Clients
+	}
+	c.LastActivity = null.TimeFrom(time.Now())
 
-	if _, err := c.Update(ctx, tx, boil.Infer()); err != nil {
+	// Usage is recorded concurrently, so only the changed columns are updated
+	if _, err := c.Update(ctx, tx, boil.Whitelist(models.CommunityColumns.Clients, models.CommunityColumns.PeakClients, models.CommunityColumns.LastActivity)); err != nil {
 		if err := tx.Rollback(); err != nil {
 			return err
 		}
@@ -172,7 +182,7 @@ func (p *CommunitiesPersister) RemoveClientFromCommunity(
 		c.Clients = 0
 	}
 
-	if _, err := c.Update(ctx, tx, boil.Infer()); err != nil {
+	if _, err := c.Update(ctx, tx, boil.Whitelist(models.CommunityColumns.Clients)); err != nil {
 		if err := tx.Rollback(); err != nil {
 			return err
 		}
@@ -209,6 +219,15 @@ func (p *CommunitiesPersister) Cleanup(
 		return err
 	}
 
+	// Mark all members as offline, as they have been connected to the previous signaler
+	if _, err := models.Members().UpdateAll(ctx, tx, models.M{models.MemberColumns.Online: false}); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+
+		return err
+	}
+
 	return tx.Commit()
 }
 
@@ -220,12 +239,27 @@ func (p *CommunitiesPersister) GetCommunities(
 		return nil, err
 	}
 
+	month := persisters.UsageMonth(time.Now())
+
 	cc := []persisters.Community{}
 	for _, community := range c {
+		// The counter is only reset by the first usage in a new month, so it is stale until then
+		monthBytes := community.MonthBytes
+		if community.UsageMonth != month {
+			monthBytes = 0
+		}
+
 		cc = append(cc, persisters.Community{
 			ID:         community.ID,
 			Clients:    community.Clients,
 			Persistent: community.Persistent,
+			ExpiresAt:  community.ExpiresAt.Ptr(),
+
+			PeakClients:  community.PeakClients,
+			Messages:     community.Messages,
+			Bytes:        community.Bytes,
+			LastActivity: community.LastActivity.Ptr(),
+			MonthBytes:   monthBytes,
 		})
 	}
 
@@ -236,20 +270,35 @@ func (p *CommunitiesPersister) CreatePersistentCommunity(
 	ctx context.Context,
 	community string,
 	password string,
+	expiresAt *time.Time,
 ) (*persisters.Community, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &models.Community{
 		ID:         community,
 		Password:   string(hashedPassword),
 		Clients:    0,
 		Persistent: true,
+		ExpiresAt:  null.TimeFromPtr(expiresAt),
 	}
 
-	if err := c.Insert(ctx, p.db, boil.Infer()); err != nil {
+	if err := c.Insert(ctx, tx, boil.Infer()); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
@@ -257,11 +306,80 @@ func (p *CommunitiesPersister) CreatePersistentCommunity(
 		ID:         c.ID,
 		Clients:    c.Clients,
 		Persistent: c.Persistent,
+		ExpiresAt:  expiresAt,
 	}
 
 	return cc, nil
 }
 
+func (p *CommunitiesPersister) UpdatePersistentCommunity(
+	ctx context.Context,
+	community string,
+	password string,
+	expiresAt *time.Time,
+) (*persisters.Community, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := models.FindCommunity(ctx, tx, community)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	c.Password = string(hashedPassword)
+	c.Persistent = true
+	c.ExpiresAt = null.TimeFromPtr(expiresAt)
+
+	if _, err := c.Update(ctx, tx, boil.Whitelist(models.CommunityColumns.Password, models.CommunityColumns.Persistent, models.CommunityColumns.ExpiresAt)); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	cc := &persisters.Community{
+		ID:         c.ID,
+		Clients:    c.Clients,
+		Persistent: c.Persistent,
+		ExpiresAt:  expiresAt,
+	}
+
+	return cc, nil
+}
+
+func (p *CommunitiesPersister) ValidatePassword(
+	ctx context.Context,
+	community string,
+	password string,
+) error {
+	c, err := models.FindCommunity(ctx, p.db, community)
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(c.Password), []byte(password)) != nil {
+		return authn.ErrWrongPassword
+	}
+
+	return nil
+}
+
 func (p *CommunitiesPersister) DeleteCommunity(
 	ctx context.Context,
 	community string,
@@ -279,3 +397,403 @@ func (p *CommunitiesPersister) DeleteCommunity(
 
 	return nil
 }
+
+func (p *CommunitiesPersister) DeleteExpiredCommunities(
+	ctx context.Context,
+) ([]string, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := models.Communities(
+		models.CommunityWhere.ExpiresAt.IsNotNull(),
+		models.CommunityWhere.ExpiresAt.LTE(null.TimeFrom(time.Now())),
+		qm.For("update"),
+	).All(ctx, tx)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if _, err := c.DeleteAll(ctx, tx); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	deleted := []string{}
+	for _, community := range c {
+		deleted = append(deleted, community.ID)
+	}
+
+	return deleted, nil
+}
+
+func (p *CommunitiesPersister) RecordUsage(
+	ctx context.Context,
+	community string,
+	messages int64,
+	bytes int64,
+) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// The row is locked so that concurrent usage isn't lost
+	c, err := models.Communities(
+		models.CommunityWhere.ID.EQ(community),
+		qm.For("update"),
+	).One(ctx, tx)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+
+		return err
+	}
+
+	now := time.Now()
+	month := persisters.UsageMonth(now)
+
+	if c.UsageMonth != month {
+		c.UsageMonth = month
+		c.MonthBytes = 0
+	}
+
+	c.Messages += messages
+	c.Bytes += bytes
+	c.MonthBytes += bytes
+	c.LastActivity = null.TimeFrom(now)
+
+	if _, err := c.Update(ctx, tx, boil.Whitelist(
+		models.CommunityColumns.Messages,
+		models.CommunityColumns.Bytes,
+		models.CommunityColumns.MonthBytes,
+		models.CommunityColumns.UsageMonth,
+		models.CommunityColumns.LastActivity,
+	)); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *CommunitiesPersister) CreateLease(
+	ctx context.Context,
+	community string,
+	id string,
+	ips []string,
+	name string,
+) (*persisters.Lease, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := models.FindCommunity(ctx, tx, community); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	l := &models.Lease{
+		Community: community,
+		ID:        id,
+		Ips:       strings.Join(ips, ","),
+		Name:      name,
+	}
+
+	if err := l.Upsert(
+		ctx,
+		tx,
+		true,
+		[]string{models.LeaseColumns.Community, models.LeaseColumns.ID},
+		boil.Whitelist(models.LeaseColumns.Ips, models.LeaseColumns.Name),
+		boil.Infer(),
+	); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &persisters.Lease{
+		Community: community,
+		ID:        id,
+		IPs:       ips,
+		Name:      name,
+	}, nil
+}
+
+func (p *CommunitiesPersister) GetLeases(
+	ctx context.Context,
+	community string,
+) ([]persisters.Lease, error) {
+	if _, err := models.FindCommunity(ctx, p.db, community); err != nil {
+		return nil, err
+	}
+
+	l, err := models.Leases(models.LeaseWhere.Community.EQ(community)).All(ctx, p.db)
+	if err != nil {
+		return nil, err
+	}
+
+	leases := []persisters.Lease{}
+	for _, lease := range l {
+		leases = append(leases, persisters.Lease{
+			Community: lease.Community,
+			ID:        lease.ID,
+			IPs:       splitIPs(lease.Ips),
+			Name:      lease.Name,
+		})
+	}
+
+	return leases, nil
+}
+
+func (p *CommunitiesPersister) GetLease(
+	ctx context.Context,
+	community string,
+	password string,
+	id string,
+) (*persisters.Lease, error) {
+	c, err := models.FindCommunity(ctx, p.db, community)
+	if err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(c.Password), []byte(password)) != nil {
+		return nil, authn.ErrWrongPassword
+	}
+
+	l, err := models.FindLease(ctx, p.db, community, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &persisters.Lease{
+		Community: l.Community,
+		ID:        l.ID,
+		IPs:       splitIPs(l.Ips),
+		Name:      l.Name,
+	}, nil
+}
+
+func (p *CommunitiesPersister) DeleteLease(
+	ctx context.Context,
+	community string,
+	id string,
+) error {
+	n, err := models.Leases(
+		models.LeaseWhere.Community.EQ(community),
+		models.LeaseWhere.ID.EQ(id),
+	).DeleteAll(ctx, p.db)
+	if err != nil {
+		return err
+	}
+
+	if n <= 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *CommunitiesPersister) RecordMember(
+	ctx context.Context,
+	community string,
+	id string,
+	online bool,
+) error {
+	m := &models.Member{
+		Community: community,
+		ID:        id,
+		Online:    online,
+		LastSeen:  time.Now(),
+	}
+
+	return m.Upsert(
+		ctx,
+		p.db,
+		true,
+		[]string{models.MemberColumns.Community, models.MemberColumns.ID},
+		boil.Whitelist(models.MemberColumns.Online, models.MemberColumns.LastSeen),
+		boil.Infer(),
+	)
+}
+
+func (p *CommunitiesPersister) GetMembers(
+	ctx context.Context,
+	community string,
+) ([]persisters.Member, error) {
+	if _, err := models.FindCommunity(ctx, p.db, community); err != nil {
+		return nil, err
+	}
+
+	m, err := models.Members(models.MemberWhere.Community.EQ(community)).All(ctx, p.db)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []persisters.Member{}
+	for _, member := range m {
+		members = append(members, persisters.Member{
+			Community: member.Community,
+			ID:        member.ID,
+			Online:    member.Online,
+			LastSeen:  member.LastSeen,
+		})
+	}
+
+	return members, nil
+}
+
+func (p *CommunitiesPersister) GetMember(
+	ctx context.Context,
+	community string,
+	id string,
+) (*persisters.Member, error) {
+	m, err := models.FindMember(ctx, p.db, community, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &persisters.Member{
+		Community: m.Community,
+		ID:        m.ID,
+		Online:    m.Online,
+		LastSeen:  m.LastSeen,
+	}, nil
+}
+
+func (p *CommunitiesPersister) AddMail(
+	ctx context.Context,
+	community string,
+	to string,
+	payload []byte,
+	expiresAt time.Time,
+	limit int,
+) error {
+	if _, err := models.FindCommunity(ctx, p.db, community); err != nil {
+		return err
+	}
+
+	if _, err := models.Mails(
+		models.MailWhere.Community.EQ(community),
+		models.MailWhere.Recipient.EQ(to),
+		models.MailWhere.ExpiresAt.LTE(time.Now()),
+	).DeleteAll(ctx, p.db); err != nil {
+		return err
+	}
+
+	queued, err := models.Mails(
+		models.MailWhere.Community.EQ(community),
+		models.MailWhere.Recipient.EQ(to),
+	).Count(ctx, p.db)
+	if err != nil {
+		return err
+	}
+
+	if queued >= int64(limit) {
+		return persisters.ErrMailboxFull
+	}
+
+	m := &models.Mail{
+		Community: community,
+		Recipient: to,
+		Payload:   payload,
+		ExpiresAt: expiresAt,
+	}
+
+	return m.Insert(ctx, p.db, boil.Infer())
+}
+
+func (p *CommunitiesPersister) TakeMail(
+	ctx context.Context,
+	community string,
+	to string,
+) ([]persisters.Mail, error) {
+	if _, err := models.FindCommunity(ctx, p.db, community); err != nil {
+		return nil, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The rows are locked so that mail is only delivered once
+	m, err := models.Mails(
+		models.MailWhere.Community.EQ(community),
+		models.MailWhere.Recipient.EQ(to),
+		qm.OrderBy(models.MailColumns.Serial),
+		qm.For("update"),
+	).All(ctx, tx)
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if _, err := m.DeleteAll(ctx, tx); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mail := []persisters.Mail{}
+	for _, entry := range m {
+		if !entry.ExpiresAt.After(now) {
+			continue
+		}
+
+		mail = append(mail, persisters.Mail{
+			Community: entry.Community,
+			To:        entry.Recipient,
+			Payload:   entry.Payload,
+			CreatedAt: entry.CreatedAt,
+			ExpiresAt: entry.ExpiresAt,
+		})
+	}
+
+	return mail, nil
+}
+
+func splitIPs(ips string) []string {
+	if strings.TrimSpace(ips) == "" {
+		return []string{}
+	}
+
+	return strings.Split(ips, ",")
+}
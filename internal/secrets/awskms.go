@@ -0,0 +1,32 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"os/exec"
+	"strings"
+)
+
+// decryptAWSKMS decrypts a ciphertext blob with the AWS CLI, so that all of its credential sources (i.e. profiles, SSO and instance roles) can be used
+func decryptAWSKMS(ctx context.Context, path string, region string) (string, error) {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return "", ErrMissingAWSKMSBackend
+	}
+
+	args := []string{"kms", "decrypt", "--ciphertext-blob", "fileb://" + path, "--output", "text", "--query", "Plaintext"}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+
+	output, err := exec.CommandContext(ctx, "aws", args...).Output()
+	if err != nil {
+		return "", getCommandError(err)
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
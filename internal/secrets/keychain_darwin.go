@@ -0,0 +1,16 @@
+package secrets
+
+import (
+	"context"
+	"os/exec"
+)
+
+// readKeychain reads a generic password from the macOS Keychain
+func readKeychain(ctx context.Context, service string, account string) (string, error) {
+	output, err := exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", getCommandError(err)
+	}
+
+	return string(output), nil
+}
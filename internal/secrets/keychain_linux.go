@@ -0,0 +1,20 @@
+package secrets
+
+import (
+	"context"
+	"os/exec"
+)
+
+// readKeychain reads a password from the Secret Service (i.e. GNOME Keyring or KWallet), which has been stored with the service and account attributes (i.e. using secret-tool store --label=weron service weron account community)
+func readKeychain(ctx context.Context, service string, account string) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", ErrMissingKeychainBackend
+	}
+
+	output, err := exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		return "", getCommandError(err)
+	}
+
+	return string(output), nil
+}
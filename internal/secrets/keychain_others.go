@@ -0,0 +1,10 @@
+//go:build !(linux || darwin)
+// +build !linux,!darwin
+
+package secrets
+
+import "context"
+
+func readKeychain(ctx context.Context, service string, account string) (string, error) {
+	return "", ErrUnsupportedKeychain
+}
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SchemeEnv      = "env"      // env://NAME reads the environment variable NAME
+	SchemeFile     = "file"     // file:///path/to/secret reads a file and strips a trailing newline
+	SchemeVault    = "vault"    // vault://mount/path#field reads a field of a secret from HashiCorp Vault's KV engine (using VAULT_ADDR and VAULT_TOKEN; the field defaults to value)
+	SchemeAWSKMS   = "awskms"   // awskms:///path/to/ciphertext decrypts a file which has been encrypted with AWS KMS (using the AWS CLI and its configured credentials; ?region= selects the region)
+	SchemeKeychain = "keychain" // keychain://service/account reads a password from the system keychain (macOS Keychain or the Secret Service on Linux)
+)
+
+var (
+	ErrMissingEnv              = errors.New("environment variable is not set")                                    // The environment variable which the reference points to is not set
+	ErrInvalidReference        = errors.New("invalid secret reference")                                           // The reference is missing its path
+	ErrMissingVaultConfig      = errors.New("VAULT_ADDR and VAULT_TOKEN must be set to read secrets from Vault")  // Vault can't be reached without its address and a token
+	ErrMissingVaultField       = errors.New("field not found in secret from Vault")                               // The secret doesn't contain the field or it is not a string
+	ErrUnsupportedKeychain     = errors.New("keychain access is only supported on macOS and Linux")               // The keychain was accessed on an unsupported platform
+	ErrMissingKeychainBackend  = errors.New("secret-tool could not be found")                                     // The Secret Service is accessed through secret-tool on Linux, which is not installed
+	ErrMissingAWSKMSBackend    = errors.New("the AWS CLI (aws) could not be found")                               // AWS KMS is accessed through the AWS CLI, which is not installed
+	ErrUnexpectedVaultResponse = errors.New("unexpected status code from Vault, are the path and token correct?") // Vault has rejected the request or the secret doesn't exist
+)
+
+// IsReference returns whether the value refers to a secret in an external store instead of being the secret itself
+func IsReference(value string) bool {
+	for _, scheme := range []string{SchemeEnv, SchemeFile, SchemeVault, SchemeAWSKMS, SchemeKeychain} {
+		if strings.HasPrefix(value, scheme+"://") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve returns the secret which the value refers to (see SchemeEnv etc.); values which aren't references are returned as they are, so that secrets can still be passed directly
+func Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	// Relative paths (i.e. file://secrets/key) are parsed as host and path
+	path := strings.TrimPrefix(u.Host+u.Path, "/")
+
+	switch u.Scheme {
+	case SchemeEnv:
+		v, ok := os.LookupEnv(u.Host)
+		if !ok {
+			return "", ErrMissingEnv
+		}
+
+		return v, nil
+	case SchemeFile:
+		if u.Host == "" {
+			path = u.Path
+		}
+
+		if path == "" {
+			return "", ErrInvalidReference
+		}
+
+		b, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return "", err
+		}
+
+		return trimNewline(string(b)), nil
+	case SchemeVault:
+		if path == "" {
+			return "", ErrInvalidReference
+		}
+
+		field := u.Fragment
+		if field == "" {
+			field = "value"
+		}
+
+		return readVault(ctx, path, field)
+	case SchemeAWSKMS:
+		if u.Host == "" {
+			path = u.Path
+		}
+
+		if path == "" {
+			return "", ErrInvalidReference
+		}
+
+		return decryptAWSKMS(ctx, path, u.Query().Get("region"))
+	default:
+		parts := strings.SplitN(path, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return "", ErrInvalidReference
+		}
+
+		s, err := readKeychain(ctx, parts[0], parts[1])
+		if err != nil {
+			return "", err
+		}
+
+		return trimNewline(s), nil
+	}
+}
+
+func trimNewline(s string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+}
+
+// getCommandError returns the output of a failed command on stderr as the error, which describes the failure better than its exit code
+func getCommandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+		return errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+	}
+
+	return err
+}
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+type vaultResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// readVault reads a field of a secret from Vault; paths are tried with the KV version 2 API first and with the version 1 API if they don't exist there
+func readVault(ctx context.Context, path string, field string) (string, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", ErrMissingVaultConfig
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	urls := []string{addr + "/v1/" + path}
+	if len(parts) == 2 {
+		urls = append([]string{addr + "/v1/" + parts[0] + "/data/" + parts[1]}, urls...)
+	}
+
+	for i, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return "", err
+		}
+
+		req.Header.Set("X-Vault-Token", token)
+		if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+			req.Header.Set("X-Vault-Namespace", namespace)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+
+		if res.StatusCode == http.StatusNotFound && i < len(urls)-1 {
+			_ = res.Body.Close()
+
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			_ = res.Body.Close()
+
+			return "", ErrUnexpectedVaultResponse
+		}
+
+		var r vaultResponse
+		err = json.NewDecoder(res.Body).Decode(&r)
+		_ = res.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		// KV version 2 nests the secret's data and adds metadata
+		data := r.Data
+		if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+			data = nested
+		}
+
+		v, ok := data[field].(string)
+		if !ok {
+			return "", ErrMissingVaultField
+		}
+
+		return v, nil
+	}
+
+	return "", ErrUnexpectedVaultResponse
+}
@@ -0,0 +1,336 @@
+package webtransport
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pojntfx/weron/internal/dualstack"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	wt "github.com/quic-go/webtransport-go"
+)
+
+const (
+	Scheme         = "webtransport"   // URL scheme which selects WebTransport instead of WebSockets (i.e. webtransport://signaler.example.com/?community=mycommunity)
+	ProtocolHeader = "Weron-Protocol" // Header in which the client offers its versions as a comma-separated list and the server answers with the selected one, like the WebSocket subprotocol
+
+	frameHeaderLength = 5           // Length of the frame header, which contains the message type and length of the payload
+	closeTimeout      = time.Second // Time to wait for the peer to close the session after the stream has been closed
+)
+
+var (
+	errMissingStream = errors.New("client didn't open a stream")
+)
+
+// IsUpgrade returns whether the request is a WebTransport handshake
+func IsUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodConnect && r.Proto == Scheme
+}
+
+// NewServer creates a WebTransport server which serves the handler over HTTP/3
+func NewServer(addr string, handler http.Handler, certificates []tls.Certificate, checkOrigin func(r *http.Request) bool) *wt.Server {
+	return &wt.Server{
+		H3: http3.Server{
+			Addr:    addr,
+			Handler: handler,
+			TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+				Certificates: certificates,
+			}),
+		},
+		CheckOrigin: checkOrigin,
+	}
+}
+
+// Conn sends and receives messages over a bidirectional WebTransport stream with the semantics of a WebSocket connection, so that signaling messages, pings and close frames can be exchanged over both transports
+type Conn struct {
+	session     *wt.Session
+	stream      *wt.Stream
+	subprotocol string
+	onClose     func() error
+
+	writeLock sync.Mutex
+	readLimit int64
+
+	pongHandler func(appData string) error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newConn(session *wt.Session, stream *wt.Stream, subprotocol string, onClose func() error) *Conn {
+	return &Conn{
+		session:     session,
+		stream:      stream,
+		subprotocol: subprotocol,
+		onClose:     onClose,
+
+		pongHandler: func(string) error { return nil },
+	}
+}
+
+// Upgrade accepts a WebTransport session and the stream which the client opens in it; the version is selected from the versions which the client has offered in the same way as the WebSocket subprotocol
+func Upgrade(server *wt.Server, rw http.ResponseWriter, r *http.Request, versions []string, timeout time.Duration) (*Conn, error) {
+	subprotocol := ""
+l:
+	for _, offered := range strings.Split(r.Header.Get(ProtocolHeader), ",") {
+		for _, version := range versions {
+			if strings.TrimSpace(offered) == version {
+				subprotocol = version
+
+				break l
+			}
+		}
+	}
+
+	if subprotocol != "" {
+		rw.Header().Set(ProtocolHeader, subprotocol)
+	}
+
+	session, err := server.Upgrade(rw, r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(session.Context(), timeout)
+	defer cancel()
+
+	stream, err := session.AcceptStream(ctx)
+	if err != nil {
+		_ = session.CloseWithError(0, "")
+
+		return nil, errMissingStream
+	}
+
+	return newConn(session, stream, subprotocol, nil), nil
+}
+
+// Dial connects to a WebTransport server over a network (udp, udp4 or udp6) and opens the stream; handshakes which are answered with a status other than 2xx return websocket.ErrBadHandshake and the response, so that they can be handled like failed WebSocket handshakes.
+// If the network is udp and the server has both IPv4 and IPv6 addresses, IPv6 is tried first and IPv4 is raced against it after the fallback delay (happy eyeballs).
+func Dial(ctx context.Context, rawURL string, header http.Header, versions []string, network string, fallbackDelay time.Duration) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Scheme = "https"
+
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	if len(versions) > 0 {
+		header.Set(ProtocolHeader, strings.Join(versions, ", "))
+	}
+
+	dialer := &wt.Dialer{
+		DialAddr: newAddrDialer(network, fallbackDelay),
+	}
+
+	res, session, err := dialer.Dial(ctx, u.String(), header)
+	if err != nil {
+		_ = dialer.Close()
+
+		if res != nil && (res.StatusCode < 200 || res.StatusCode >= 300) {
+			return nil, res, websocket.ErrBadHandshake
+		}
+
+		return nil, res, err
+	}
+
+	stream, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		_ = session.CloseWithError(0, "")
+		_ = dialer.Close()
+
+		return nil, res, err
+	}
+
+	c := newConn(session, stream, res.Header.Get(ProtocolHeader), dialer.Close)
+
+	// Streams are only announced to the server once data has been sent on them
+	if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+		_ = c.Close()
+
+		return nil, res, err
+	}
+
+	return c, res, nil
+}
+
+// newAddrDialer creates a function which dials QUIC connections to a host in a network with happy eyeballs (see dualstack.Dial)
+func newAddrDialer(network string, fallbackDelay time.Duration) func(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (*quic.Conn, error) {
+	return func(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (*quic.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// The addresses are dialed directly, so the host has to be set for the certificate to be verified
+		if tlsConf.ServerName == "" {
+			tlsConf = tlsConf.Clone()
+			tlsConf.ServerName = host
+		}
+
+		return dualstack.Dial(
+			ctx,
+			network,
+			addr,
+			fallbackDelay,
+			func(ctx context.Context, network, addr string) (*quic.Conn, error) {
+				return quic.DialAddrEarly(ctx, addr, tlsConf, quicConf)
+			},
+			func(conn *quic.Conn) {
+				_ = conn.CloseWithError(0, "")
+			},
+		)
+	}
+}
+
+// ReadMessage reads the next data message; pings are answered and pongs are passed to the pong handler
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	for {
+		header := make([]byte, frameHeaderLength)
+		if _, err := io.ReadFull(c.stream, header); err != nil {
+			return 0, nil, c.getReadError(err)
+		}
+
+		messageType := int(header[0])
+		length := binary.BigEndian.Uint32(header[1:])
+
+		if c.readLimit > 0 && int64(length) > c.readLimit {
+			_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""), time.Now().Add(time.Second))
+
+			return 0, nil, websocket.ErrReadLimit
+		}
+
+		p := make([]byte, length)
+		if _, err := io.ReadFull(c.stream, p); err != nil {
+			return 0, nil, c.getReadError(err)
+		}
+
+		switch messageType {
+		case websocket.TextMessage, websocket.BinaryMessage:
+			return messageType, p, nil
+		case websocket.PingMessage:
+			if err := c.WriteMessage(websocket.PongMessage, p); err != nil {
+				return 0, nil, err
+			}
+		case websocket.PongMessage:
+			if err := c.pongHandler(string(p)); err != nil {
+				return 0, nil, err
+			}
+		case websocket.CloseMessage:
+			closeErr := &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+			if len(p) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(p))
+				closeErr.Text = string(p[2:])
+			}
+
+			return 0, nil, closeErr
+		}
+	}
+}
+
+func (c *Conn) getReadError(err error) error {
+	// Sessions which are closed without a close frame are reported like WebSocket connections which have been closed abnormally
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: err.Error()}
+	}
+
+	var sessionErr *wt.SessionError
+	if errors.As(err, &sessionErr) {
+		return &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: err.Error()}
+	}
+
+	return err
+}
+
+// WriteMessage writes a message of any type, including control messages
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	frame := make([]byte, frameHeaderLength+len(data))
+	frame[0] = byte(messageType)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	copy(frame[frameHeaderLength:], data)
+
+	_, err := c.stream.Write(frame)
+
+	return err
+}
+
+// WriteControl writes a control message with a deadline
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if err := c.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+
+	return c.WriteMessage(messageType, data)
+}
+
+// SetReadDeadline sets the deadline for reads
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.stream.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writes, including pending ones
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.stream.SetWriteDeadline(t)
+}
+
+// SetReadLimit sets the maximum size of a message in bytes
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetPongHandler sets the handler which is called for pongs
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	if h == nil {
+		h = func(string) error { return nil }
+	}
+
+	c.pongHandler = h
+}
+
+// Subprotocol returns the selected version
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.session.RemoteAddr()
+}
+
+// Close closes the stream and session; closing the session resets the stream, so the peer is given time to read pending messages (i.e. close frames) and close the session first
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stream.Close()
+
+		select {
+		case <-c.session.Context().Done():
+		case <-time.After(closeTimeout):
+		}
+
+		c.closeErr = c.session.CloseWithError(0, "")
+
+		if c.onClose != nil {
+			if err := c.onClose(); err != nil && c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+	})
+
+	return c.closeErr
+}
@@ -0,0 +1,22 @@
+package v1
+
+// Clipboard is a chunk of clipboard content
+type Clipboard struct {
+	Message
+	ID     string `json:"id"`     // ID of the clipboard content to which the chunk belongs
+	Size   int    `json:"size"`   // Size of the clipboard content in bytes
+	Offset int    `json:"offset"` // Offset of the chunk in the clipboard content
+	Data   []byte `json:"data"`   // Data of the chunk
+}
+
+func NewClipboard(id string, size int, offset int, data []byte) *Clipboard {
+	return &Clipboard{
+		Message: Message{
+			Type: TypeClipboard,
+		},
+		ID:     id,
+		Size:   size,
+		Offset: offset,
+		Data:   data,
+	}
+}
@@ -0,0 +1,24 @@
+package v1
+
+// Entry is a value which has been set or deleted in a key-value store
+type Entry struct {
+	Message
+	Key       string `json:"key"`               // Key of the entry
+	Value     []byte `json:"value,omitempty"`   // Value of the entry
+	Deleted   bool   `json:"deleted,omitempty"` // Whether the entry has been deleted
+	Timestamp int64  `json:"timestamp"`         // Timestamp to resolve conflicts
+	Origin    string `json:"origin"`            // ID of the peer which has written the entry; resolves conflicts if timestamps are equal
+}
+
+func NewEntry(key string, value []byte, deleted bool, timestamp int64, origin string) *Entry {
+	return &Entry{
+		Message: Message{
+			Type: TypeEntry,
+		},
+		Key:       key,
+		Value:     value,
+		Deleted:   deleted,
+		Timestamp: timestamp,
+		Origin:    origin,
+	}
+}
@@ -0,0 +1,48 @@
+package v1
+
+// Publication is a message which has been published to a topic
+type Publication struct {
+	Message
+	ID      string `json:"id"`      // ID to deduplicate the publication with
+	Origin  string `json:"origin"`  // ID of the peer which has published the publication
+	Topic   string `json:"topic"`   // Topic to which the publication has been published
+	Payload []byte `json:"payload"` // Content of the publication
+	Hops    int    `json:"hops"`    // Amount of times the publication may still be forwarded
+}
+
+func NewPublication(id string, origin string, topic string, payload []byte, hops int) *Publication {
+	return &Publication{
+		Message: Message{
+			Type: TypePublication,
+		},
+		ID:      id,
+		Origin:  origin,
+		Topic:   topic,
+		Payload: payload,
+		Hops:    hops,
+	}
+}
+
+// Subscription notifies a peer that publications to a topic should (not) be sent to it
+type Subscription struct {
+	Message
+	Topic string `json:"topic"` // Topic to (un)subscribe from
+}
+
+func NewSubscribe(topic string) *Subscription {
+	return &Subscription{
+		Message: Message{
+			Type: TypeSubscribe,
+		},
+		Topic: topic,
+	}
+}
+
+func NewUnsubscribe(topic string) *Subscription {
+	return &Subscription{
+		Message: Message{
+			Type: TypeUnsubscribe,
+		},
+		Topic: topic,
+	}
+}
@@ -0,0 +1,22 @@
+package v1
+
+// Advertisement is a network which can be reached through a peer
+type Advertisement struct {
+	Prefix string `json:"prefix"` // Network in CIDR notation
+	Metric int    `json:"metric"` // Priority of the route to the network (lower is preferred)
+}
+
+// Routes advertises the networks which can be reached through a peer
+type Routes struct {
+	Message
+	Routes []Advertisement `json:"routes"` // Networks which can be reached through the peer
+}
+
+func NewRoutes(routes []Advertisement) *Routes {
+	return &Routes{
+		Message: Message{
+			Type: TypeRoutes,
+		},
+		Routes: routes,
+	}
+}
@@ -0,0 +1,23 @@
+package v1
+
+// Service is a service which a peer offers
+type Service struct {
+	Name    string `json:"name"`    // Name of the service (i.e. ssh or www.example.com)
+	Channel string `json:"channel"` // Channel on which the service is offered (i.e. the primary channel of nc)
+	Port    int    `json:"port"`    // Port of the service (0 if the service isn't bound to a port)
+}
+
+// Services announces the services a peer offers
+type Services struct {
+	Message
+	Services []Service `json:"services"` // Services which the peer offers
+}
+
+func NewServices(services []Service) *Services {
+	return &Services{
+		Message: Message{
+			Type: TypeServices,
+		},
+		Services: services,
+	}
+}
@@ -5,4 +5,16 @@ const (
 	TypeKick     = "kick"     // Kick notifies peers that an ID has already been claimed
 	TypeBackoff  = "backoff"  // Backoff asks a peer to back off from claiming IDs
 	TypeClaimed  = "claimed"  // Claimed notifies a peer that an ID has already been claimed
+
+	TypePublication = "publication" // Publication is a message which has been published to a topic
+	TypeSubscribe   = "subscribe"   // Subscribe notifies a peer that publications to a topic should be sent to it
+	TypeUnsubscribe = "unsubscribe" // Unsubscribe notifies a peer that publications to a topic should no longer be sent to it
+
+	TypeEntry = "entry" // Entry is a value which has been set or deleted in a key-value store
+
+	TypeRoutes = "routes" // Routes advertises the networks which can be reached through a peer
+
+	TypeServices = "services" // Services announces the services a peer offers
+
+	TypeClipboard = "clipboard" // Clipboard is a chunk of clipboard content
 )
@@ -13,6 +13,44 @@ const (
 
 	ThroughputPrimary = weronPrefix + "throughput/primary" // Primary channel for throughput measurements
 	LatencyPrimary    = weronPrefix + "latency/primary"    // Primary channel for latency measurements
+	TimePrimary       = weronPrefix + "time/primary"       // Primary channel for clock offset measurements
+
+	MediaPrimary = weronPrefix + "media/primary" // Primary channel for media
+
+	ExposePrimary = weronPrefix + "expose/primary" // Primary channel for exposed services
+	ExposeID      = weronPrefix + "expose/id"      // ID negotiation channel for exposed services
+
+	WakePrimary = weronPrefix + "wake/primary" // Primary channel for Wake-on-LAN
+	WakeID      = weronPrefix + "wake/id"      // ID negotiation channel for Wake-on-LAN
+
+	PubSubPrimary = weronPrefix + "pubsub/primary" // Primary channel for publish/subscribe
+
+	KVPrimary = weronPrefix + "kv/primary" // Primary channel for the key-value store
+
+	MDNSPrimary = weronPrefix + "mdns/primary" // Primary channel for mDNS reflection
+
+	ClipboardPrimary = weronPrefix + "clipboard/primary" // Primary channel for clipboard sharing
+
+	NCPrimary = weronPrefix + "nc/primary" // Primary channel for bridged connections
+	NCID      = weronPrefix + "nc/id"      // ID negotiation channel for bridged connections
+
+	ExecPrimary = weronPrefix + "exec/primary" // Primary channel for remote command execution
+
+	DatagramPrimary = weronPrefix + "datagram/primary" // Primary channel for unreliable datagrams
+
+	ProbePrimary = weronPrefix + "probe/primary" // Primary channel for round-trip time measurements and service advertisements
+
+	MuxPrimary = weronPrefix + "mux/primary" // Primary channel for multiplexed streams
+
+	GossipPrimary = weronPrefix + "gossip/primary" // Primary channel for membership gossip and relayed signaling messages
+
+	MeshPrimary = weronPrefix + "mesh/primary" // Primary channel for round-trip time measurements, route advertisements and forwarded payloads of the partial mesh
+
+	QualityPrimary = weronPrefix + "quality/primary" // Primary channel for loss and round-trip time measurements of adaptive channels
+
+	ConformancePrimary = weronPrefix + "conformance/primary" // Primary channel for checking third-party clients against the signaling spec
+
+	BindingPrimary = weronPrefix + "binding/primary" // Primary channel for the nonces which channel bindings are derived from
 
 	IDGeneral = weronPrefix + "id/id" // General channel for ID negotiation
 )
@@ -0,0 +1,252 @@
+package wrtcaudit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EventPeerJoined    = "peer-joined"    // A peer has connected
+	EventPeerLeft      = "peer-left"      // A peer has disconnected
+	EventChannelOpened = "channel-opened" // A channel to a peer has been opened
+	EventFlow          = "flow"           // Packets have been exchanged with a peer during the flow interval
+	EventDenied        = "denied"         // Packets have been dropped by a policy during the flow interval
+
+	DirectionIn  = "in"  // Received from a peer
+	DirectionOut = "out" // Sent to a peer
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Event is an entry in the audit log
+type Event struct {
+	Time        time.Time `json:"time"`                  // Time at which the event has been logged
+	Type        string    `json:"type"`                  // Type of the event
+	Community   string    `json:"community,omitempty"`   // Community in which the peer is connected
+	PeerID      string    `json:"peerID,omitempty"`      // ID of the peer
+	Name        string    `json:"name,omitempty"`        // Human-readable name of the peer
+	ChannelID   string    `json:"channelID,omitempty"`   // Channel on which the peer is connected
+	Relayed     bool      `json:"relayed,omitempty"`     // Whether the channel is relayed through the signaler
+	Direction   string    `json:"direction,omitempty"`   // Direction of the packets
+	Protocol    string    `json:"protocol,omitempty"`    // Protocol of the packets (i.e. TCP or IPv6)
+	Source      string    `json:"source,omitempty"`      // Source address of the packets
+	Destination string    `json:"destination,omitempty"` // Destination address of the packets
+	Reason      string    `json:"reason,omitempty"`      // Reason for which the packets have been denied
+	Packets     int64     `json:"packets,omitempty"`     // Amount of packets during the flow interval
+	Bytes       int64     `json:"bytes,omitempty"`       // Amount of bytes during the flow interval
+}
+
+// LoggerConfig configures the logger
+type LoggerConfig struct {
+	MaxSize      int64         // Size in bytes after which the log is rotated (0 disables rotation)
+	MaxBackups   int           // Amount of rotated logs to keep (default is 3)
+	FlowInterval time.Duration // Time to aggregate flows and denials for before logging them (default is 1 minute)
+}
+
+// Logger writes audit events to a JSONL file
+type Logger struct {
+	path   string
+	config *LoggerConfig
+	ctx    context.Context
+
+	cancel context.CancelFunc
+
+	fileLock sync.Mutex
+	file     *os.File
+	size     int64
+
+	countsLock sync.Mutex
+	counts     map[Event]*Event
+}
+
+// NewLogger creates the logger
+func NewLogger(
+	path string,
+	config *LoggerConfig,
+	ctx context.Context,
+) *Logger {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &LoggerConfig{}
+	}
+
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 3
+	}
+
+	if config.FlowInterval <= 0 {
+		config.FlowInterval = time.Minute
+	}
+
+	return &Logger{
+		path:   path,
+		config: config,
+		ctx:    ictx,
+
+		cancel: cancel,
+
+		counts: map[Event]*Event{},
+	}
+}
+
+// Open opens the log file and starts logging aggregated flows
+func (l *Logger) Open() error {
+	log.Trace().Str("path", l.path).Msg("Opening audit log")
+
+	if err := l.openFile(); err != nil {
+		return err
+	}
+
+	go func() {
+		t := time.NewTicker(l.config.FlowInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-l.ctx.Done():
+				return
+			case <-t.C:
+				if err := l.flush(); err != nil {
+					log.Debug().Err(err).Str("path", l.path).Msg("Could not write flows to audit log, continuing")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (l *Logger) openFile() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+
+	return nil
+}
+
+// rotate moves the current log to the first backup; must be called with the file lock held
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	for i := l.config.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%v.%v", l.path, i), fmt.Sprintf("%v.%v", l.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+
+	return l.openFile()
+}
+
+// Log writes an event to the log
+func (l *Logger) Log(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	p, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p = append(p, '\n')
+
+	l.fileLock.Lock()
+	defer l.fileLock.Unlock()
+
+	if l.file == nil {
+		return os.ErrClosed
+	}
+
+	if l.config.MaxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.config.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+
+	return err
+}
+
+// Count adds a packet to the aggregated flow or denial described by the event; it is logged after the flow interval
+func (l *Logger) Count(event Event, bytes int) {
+	event.Time = time.Time{}
+	event.Packets = 0
+	event.Bytes = 0
+
+	l.countsLock.Lock()
+	defer l.countsLock.Unlock()
+
+	count, ok := l.counts[event]
+	if !ok {
+		count = &event
+		l.counts[event] = count
+	}
+
+	count.Packets++
+	count.Bytes += int64(bytes)
+}
+
+func (l *Logger) flush() error {
+	l.countsLock.Lock()
+	counts := l.counts
+	l.counts = map[Event]*Event{}
+	l.countsLock.Unlock()
+
+	for _, count := range counts {
+		if err := l.Log(*count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close logs the remaining flows and closes the log file
+func (l *Logger) Close() error {
+	log.Trace().Str("path", l.path).Msg("Closing audit log")
+
+	l.cancel()
+
+	if err := l.flush(); err != nil {
+		return err
+	}
+
+	l.fileLock.Lock()
+	defer l.fileLock.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
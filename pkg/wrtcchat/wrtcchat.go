@@ -113,6 +113,8 @@ func (a *Adapter) Wait() error {
 			}
 
 			return nil
+		case err := <-a.adapter.Err():
+			return err
 		case id := <-a.ids:
 			log.Debug().Str("id", id).Msg("Connected to signaler")
 
@@ -120,7 +122,7 @@ func (a *Adapter) Wait() error {
 				a.config.OnSignalerConnect(id)
 			}
 		case peer := <-a.adapter.Accept():
-			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Connected to peer")
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
 
 			l := a.input.Listener(0)
 
@@ -178,3 +180,10 @@ func (a *Adapter) SendMessage(body []byte) {
 
 	a.input.NotifyCtx(a.ctx, body)
 }
+
+// SendMail sends a message to a peer through the signaler, which queues it if the peer is offline; the peer is addressed by the ID of its underlying adapter instead of its name
+func (a *Adapter) SendMail(community string, to string, body []byte) error {
+	log.Trace().Str("to", to).Bytes("body", body).Msg("Sending mail")
+
+	return a.adapter.SendMail(community, to, body)
+}
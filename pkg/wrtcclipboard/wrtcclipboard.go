@@ -0,0 +1,397 @@
+package wrtcclipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pojntfx/weron/internal/clipboard"
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	chunkSize    = 16 * 1024 // Size of the chunks in which clipboard content is sent; must fit into a data channel message after encoding
+	maxChunkSize = 64 * 1024 // Maximum size of an encoded chunk
+)
+
+var (
+	ErrContentTooLarge = errors.New("clipboard content is larger than the maximum size") // The clipboard content can't be shared because it is too large
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string)              // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)              // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)              // Handler to be called when the adapter has disconnected from a peer
+	OnReceive          func(string, []byte)      // Handler to be called when the clipboard has been set to content from a peer
+	Confirm            func(string, []byte) bool // Handler to be called to confirm setting the clipboard to content from a peer (all content is accepted if nil)
+	Peers              []string                  // IDs of the peers to share the clipboard with (the clipboard is shared with all peers if empty)
+	MaxSize            int                       // Maximum size of clipboard content in bytes (default is 1 MiB)
+	Interval           time.Duration             // Time to wait between checks for changes of the local clipboard (default is 1 second)
+	Read               func() ([]byte, error)    // Handler to read the local clipboard with (default is the system clipboard)
+	Write              func([]byte) error        // Handler to write to the local clipboard with (default is the system clipboard)
+}
+
+type remotePeer struct {
+	conn      io.ReadWriteCloser
+	writeLock sync.Mutex
+}
+
+// write sends clipboard content in chunks, which must not be interleaved with chunks of other content
+func (p *remotePeer) write(content []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	id := uuid.NewString()
+	for offset := 0; offset == 0 || offset < len(content); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		b, err := json.Marshal(v1.NewClipboard(id, len(content), offset, content[offset:end]))
+		if err != nil {
+			return err
+		}
+
+		if _, err := p.conn.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Adapter shares the clipboard with peers
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids chan string
+
+	peersLock sync.Mutex
+	peers     map[string]*remotePeer
+	allowed   map[string]struct{}
+
+	// Serializes confirmations and changes to the clipboard
+	contentLock sync.Mutex
+	content     []byte
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.MaxSize <= 0 {
+		config.MaxSize = 1024 * 1024
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+
+	if config.Read == nil {
+		config.Read = clipboard.Read
+	}
+
+	if config.Write == nil {
+		config.Write = clipboard.Write
+	}
+
+	allowed := map[string]struct{}{}
+	for _, peer := range config.Peers {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			allowed[peer] = struct{}{}
+		}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		peers:   map[string]*remotePeer{},
+		allowed: allowed,
+	}
+}
+
+// Open connects the adapter to the signaler and starts watching the local clipboard
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	// The current content is not shared so that joining doesn't overwrite the clipboards of peers
+	content, err := a.config.Read()
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not read clipboard, continuing")
+	}
+	a.content = content
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.ClipboardPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		t := time.NewTicker(a.config.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-t.C:
+				content, err := a.config.Read()
+				if err != nil {
+					log.Debug().Err(err).Msg("Could not read clipboard, continuing")
+
+					continue
+				}
+
+				a.contentLock.Lock()
+				if bytes.Equal(content, a.content) {
+					a.contentLock.Unlock()
+
+					continue
+				}
+				a.content = content
+				a.contentLock.Unlock()
+
+				if err := a.share(content); err != nil {
+					log.Debug().Err(err).Int("len", len(content)).Msg("Could not share clipboard, continuing")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// share sends clipboard content to all peers
+func (a *Adapter) share(content []byte) error {
+	if len(content) > a.config.MaxSize {
+		return ErrContentTooLarge
+	}
+
+	log.Trace().Int("len", len(content)).Msg("Sharing clipboard")
+
+	a.peersLock.Lock()
+	peers := map[string]*remotePeer{}
+	for peerID, peer := range a.peers {
+		peers[peerID] = peer
+	}
+	a.peersLock.Unlock()
+
+	for peerID, peer := range peers {
+		if err := peer.write(content); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+
+	return nil
+}
+
+// apply sets the local clipboard to content from a peer
+func (a *Adapter) apply(peerID string, content []byte) {
+	a.contentLock.Lock()
+	defer a.contentLock.Unlock()
+
+	if bytes.Equal(content, a.content) {
+		return
+	}
+
+	if a.config.Confirm != nil && !a.config.Confirm(peerID, content) {
+		log.Debug().Str("peerID", peerID).Int("len", len(content)).Msg("Clipboard content has not been confirmed, ignoring")
+
+		return
+	}
+
+	if err := a.config.Write(content); err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write clipboard, continuing")
+
+		return
+	}
+
+	// Remembering the content prevents sending it back to peers
+	a.content = content
+
+	if a.config.OnReceive != nil {
+		a.config.OnReceive(peerID, content)
+	}
+}
+
+// Close stops watching the local clipboard and disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	return a.adapter.Close()
+}
+
+// Wait starts the transmission loop
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			if _, ok := a.allowed[peer.PeerID]; len(a.allowed) > 0 && !ok {
+				log.Debug().Str("peerID", peer.PeerID).Msg("Ignoring peer which is not allowed to share the clipboard")
+
+				_ = peer.Conn.Close()
+
+				continue
+			}
+
+			log.Debug().Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			rp := &remotePeer{
+				conn: peer.Conn,
+			}
+
+			a.peersLock.Lock()
+			a.peers[peer.PeerID] = rp
+			a.peersLock.Unlock()
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					a.peersLock.Lock()
+					if current, ok := a.peers[peer.PeerID]; ok && current == rp {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				var (
+					id      string
+					content []byte
+				)
+
+				buf := make([]byte, maxChunkSize)
+				for {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+						return
+					}
+
+					var chunk v1.Clipboard
+					if err := json.Unmarshal(buf[:n], &chunk); err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal chunk, continuing")
+
+						continue
+					}
+
+					if chunk.Type != v1.TypeClipboard {
+						log.Debug().Str("peerID", peer.PeerID).Str("type", chunk.Type).Msg("Got message with unknown type, continuing")
+
+						continue
+					}
+
+					if chunk.Size > a.config.MaxSize {
+						log.Debug().Str("peerID", peer.PeerID).Int("len", chunk.Size).Msg("Got clipboard content which is larger than the maximum size, ignoring")
+
+						continue
+					}
+
+					// Chunks arrive in order, so content is discarded if a chunk is missing
+					if chunk.Offset == 0 {
+						id = chunk.ID
+						content = make([]byte, 0, chunk.Size)
+					} else if chunk.ID != id || chunk.Offset != len(content) {
+						log.Debug().Str("peerID", peer.PeerID).Msg("Got unexpected chunk, ignoring")
+
+						id = ""
+						content = nil
+
+						continue
+					}
+
+					content = append(content, chunk.Data...)
+					if len(content) < chunk.Size {
+						continue
+					}
+
+					if len(content) > chunk.Size {
+						log.Debug().Str("peerID", peer.PeerID).Msg("Got clipboard content which is larger than announced, ignoring")
+					} else {
+						log.Trace().Str("peerID", peer.PeerID).Int("len", len(content)).Msg("Received clipboard")
+
+						a.apply(peer.PeerID, content)
+					}
+
+					id = ""
+					content = nil
+				}
+			}()
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package wrtcclk
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	adjOffsetSingleshot = 0x8001 // Slews the clock like adjtime(3) (ADJ_OFFSET_SINGLESHOT; the offset is in microseconds)
+	adjSetOffset        = 0x0100 // Steps the clock by the offset in the time field (ADJ_SETOFFSET)
+
+	maxSlew = time.Millisecond * 500 // Maximum offset which is slewed instead of stepped, which is the limit of the kernel
+)
+
+// adjustClock slews the clock by small offsets, so that time doesn't jump, and steps it by large ones
+func adjustClock(offset time.Duration) error {
+	if offset > -maxSlew && offset < maxSlew {
+		t := unix.Timex{
+			Modes: adjOffsetSingleshot,
+		}
+		setInt(&t.Offset, offset.Microseconds())
+
+		_, err := unix.Adjtimex(&t)
+
+		return err
+	}
+
+	_, err := unix.Adjtimex(&unix.Timex{
+		Modes: adjSetOffset,
+		Time:  unix.NsecToTimeval(offset.Nanoseconds()),
+	})
+
+	return err
+}
+
+// setInt sets a field whose width depends on the architecture
+func setInt[T ~int32 | ~int64](field *T, value int64) {
+	*field = T(value)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package wrtcclk
+
+import "time"
+
+func adjustClock(offset time.Duration) error {
+	return ErrDisciplineUnsupported
+}
@@ -0,0 +1,439 @@
+package wrtcclk
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+)
+
+const (
+	packetTypeRequest  = "request"  // Asks the peer for its receive and transmit timestamps
+	packetTypeResponse = "response" // Returns the receive and transmit timestamps of a request
+
+	maxPacketLength = 1024 // Maximum length of a packet to read
+)
+
+var (
+	ErrDisciplineUnsupported = errors.New("disciplining the clock is only supported on Linux") // The clock was disciplined on an unsupported platform
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string)  // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)  // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)  // Handler to be called when the adapter has disconnected from a peer
+	Interval           time.Duration // Time to wait between requests to each peer (default 1 second)
+	Samples            int           // Amount of samples per peer to estimate the offset and drift from; the offset is taken from the sample with the lowest delay, which is the least affected by queueing (default 8)
+	Discipline         bool          // Whether to slew or step the local clock towards the clocks of the peers once per window of samples (requires CAP_SYS_TIME; only supported on Linux)
+}
+
+// Measurement is the estimated offset of the clock of a peer
+type Measurement struct {
+	PeerID string        // ID of the peer
+	Offset time.Duration // Offset of the peer's clock relative to the local clock (positive if the peer's clock is ahead)
+	Delay  time.Duration // Round-trip delay of the sample which the offset has been estimated from
+	Drift  float64       // Rate at which the offset changes in parts per million (0 until at least three samples have been taken)
+}
+
+// Adjustment is a change of the local clock (see AdapterConfig.Discipline)
+type Adjustment struct {
+	Offset time.Duration // Amount by which the local clock has been moved
+	Peers  int           // Amount of peers whose offsets the adjustment is based on
+}
+
+type packet struct {
+	Type string `json:"type"`         // Type of the packet (see packetTypeRequest etc.)
+	T1   int64  `json:"t1"`           // Time at which the request has been sent in the requester's clock (in nanoseconds since the epoch)
+	T2   int64  `json:"t2,omitempty"` // Time at which the request has been received in the responder's clock
+	T3   int64  `json:"t3,omitempty"` // Time at which the response has been sent in the responder's clock
+}
+
+type sample struct {
+	at     time.Time
+	offset time.Duration
+	delay  time.Duration
+}
+
+type peerClock struct {
+	lock    sync.Mutex
+	samples []sample
+}
+
+// Adapter provides a time synchronization service
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids          chan string
+	measurements chan Measurement
+	adjustments  chan Adjustment
+
+	clocksLock sync.Mutex
+	clocks     map[string]*peerClock
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+
+	if config.Samples <= 0 {
+		config.Samples = 8
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids:          make(chan string),
+		measurements: make(chan Measurement),
+		adjustments:  make(chan Adjustment),
+
+		clocks: map[string]*peerClock{},
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.TimePrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	return a.adapter.Close()
+}
+
+// Wait answers requests from peers and measures the offsets of their clocks
+func (a *Adapter) Wait() error {
+	errs := make(chan error)
+
+	if a.config.Discipline {
+		go func() {
+			t := time.NewTicker(a.config.Interval * time.Duration(a.config.Samples))
+			defer t.Stop()
+
+			for {
+				select {
+				case <-a.ctx.Done():
+					return
+				case <-t.C:
+				}
+
+				adjustment, ok := a.discipline()
+				if !ok {
+					continue
+				}
+
+				if err := adjustClock(adjustment.Offset); err != nil {
+					select {
+					case <-a.ctx.Done():
+					case errs <- err:
+					}
+
+					return
+				}
+
+				select {
+				case <-a.ctx.Done():
+					return
+				case a.adjustments <- adjustment:
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-errs:
+			return err
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			go a.handlePeer(peer)
+		}
+	}
+}
+
+// handlePeer sends requests to a peer and answers its requests until it disconnects
+func (a *Adapter) handlePeer(peer *wrtcconn.Peer) {
+	clock := &peerClock{}
+
+	a.clocksLock.Lock()
+	a.clocks[peer.PeerID] = clock
+	a.clocksLock.Unlock()
+
+	ctx, cancel := context.WithCancel(a.ctx)
+
+	defer func() {
+		cancel()
+
+		a.clocksLock.Lock()
+		if a.clocks[peer.PeerID] == clock {
+			delete(a.clocks, peer.PeerID)
+		}
+		a.clocksLock.Unlock()
+
+		log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+		if a.config.OnPeerDisconnected != nil {
+			a.config.OnPeerDisconnected(peer.PeerID)
+		}
+	}()
+
+	if a.config.OnPeerConnect != nil {
+		a.config.OnPeerConnect(peer.PeerID)
+	}
+
+	var writeLock sync.Mutex
+	write := func(p packet) error {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+
+		writeLock.Lock()
+		defer writeLock.Unlock()
+
+		_, err = peer.Conn.Write(b)
+
+		return err
+	}
+
+	go func() {
+		t := time.NewTicker(a.config.Interval)
+		defer t.Stop()
+
+		for {
+			if err := write(packet{Type: packetTypeRequest, T1: time.Now().UnixNano()}); err != nil {
+				log.Debug().Err(err).Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Could not write to peer, stopping")
+
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	buf := make([]byte, maxPacketLength)
+	for {
+		n, err := peer.Conn.Read(buf)
+		if err != nil {
+			log.Debug().Err(err).Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+			return
+		}
+
+		received := time.Now()
+
+		var p packet
+		if err := json.Unmarshal(buf[:n], &p); err != nil {
+			log.Debug().Err(err).Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Could not unmarshal packet from peer, continuing")
+
+			continue
+		}
+
+		switch p.Type {
+		case packetTypeRequest:
+			p.Type = packetTypeResponse
+			p.T2 = received.UnixNano()
+			p.T3 = time.Now().UnixNano()
+
+			if err := write(p); err != nil {
+				log.Debug().Err(err).Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Could not write to peer, stopping")
+
+				return
+			}
+		case packetTypeResponse:
+			t4 := received.UnixNano()
+
+			// See RFC 5905 section 8
+			offset := time.Duration(((p.T2 - p.T1) + (p.T3 - t4)) / 2)
+			delay := time.Duration((t4 - p.T1) - (p.T3 - p.T2))
+
+			// Samples which span a step of the local clock have an invalid delay
+			if delay < 0 {
+				continue
+			}
+
+			m := clock.add(sample{received, offset, delay}, a.config.Samples)
+			m.PeerID = peer.PeerID
+
+			select {
+			case <-ctx.Done():
+				return
+			case a.measurements <- m:
+			}
+		}
+	}
+}
+
+// add records a sample and returns the current estimate, which only keeps the most recent samples
+func (c *peerClock) add(s sample, samples int) Measurement {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.samples = append(c.samples, s)
+	if len(c.samples) > samples {
+		c.samples = c.samples[len(c.samples)-samples:]
+	}
+
+	return c.estimate()
+}
+
+// estimate returns the offset of the sample with the lowest delay and the drift, which is the slope of a linear regression of the offsets over time
+func (c *peerClock) estimate() Measurement {
+	best := c.samples[0]
+	for _, s := range c.samples[1:] {
+		if s.delay < best.delay {
+			best = s
+		}
+	}
+
+	m := Measurement{
+		Offset: best.offset,
+		Delay:  best.delay,
+	}
+
+	if len(c.samples) < 3 {
+		return m
+	}
+
+	start := c.samples[0].at
+	n := float64(len(c.samples))
+	sumX, sumY, sumXY, sumXX := 0.0, 0.0, 0.0, 0.0
+	for _, s := range c.samples {
+		x := float64(s.at.Sub(start))
+		y := float64(s.offset)
+
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	if d := n*sumXX - sumX*sumX; d != 0 {
+		m.Drift = (n*sumXY - sumX*sumY) / d * 1e6
+	}
+
+	return m
+}
+
+// discipline returns half of the median offset to all peers, so that peers which all discipline their clocks converge instead of overshooting; the samples are discarded, since they are invalid once the clock has been adjusted
+func (a *Adapter) discipline() (Adjustment, bool) {
+	a.clocksLock.Lock()
+	defer a.clocksLock.Unlock()
+
+	offsets := []time.Duration{}
+	for _, clock := range a.clocks {
+		clock.lock.Lock()
+		if len(clock.samples) > 0 {
+			offsets = append(offsets, clock.estimate().Offset)
+		}
+
+		clock.samples = nil
+		clock.lock.Unlock()
+	}
+
+	if len(offsets) == 0 {
+		return Adjustment{}, false
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+
+	median := offsets[len(offsets)/2]
+	if len(offsets)%2 == 0 {
+		median = (offsets[len(offsets)/2-1] + offsets[len(offsets)/2]) / 2
+	}
+
+	return Adjustment{
+		Offset: median / 2,
+		Peers:  len(offsets),
+	}, true
+}
+
+// Measurements returns a channel on which the estimated offset of a peer is sent whenever it has answered a request
+func (a *Adapter) Measurements() chan Measurement {
+	return a.measurements
+}
+
+// Adjustments returns a channel on which all changes of the local clock are sent
+func (a *Adapter) Adjustments() chan Adjustment {
+	return a.adjustments
+}
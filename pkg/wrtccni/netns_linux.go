@@ -0,0 +1,178 @@
+package wrtccni
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+var (
+	errMissingHostInterface = errors.New("host interface of container does not exist")
+	errMissingIP            = errors.New("no IP has been allocated for container")
+)
+
+func setSysctl(name string, value string) error {
+	return os.WriteFile(filepath.Join("/proc/sys", name), []byte(value), 0644)
+}
+
+// add connects the container to the host with a veth pair; the host routes the IP of the container to it and answers ARP requests for the gateway, so that the traffic of the container is routed by the host (and thus through the TUN device of `weron vpn ip` to other nodes)
+func add(conf *NetConf, args *Args, subnet *net.IPNet) (*Result, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ip, err := allocateIP(conf, subnet, args.ContainerID, args.IfName)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway := getGateway(subnet)
+	hostIfName := getHostInterfaceName(args.ContainerID, args.IfName)
+
+	ns, err := netns.GetFromPath(args.Netns)
+	if err != nil {
+		_ = releaseIP(conf, args.ContainerID, args.IfName)
+
+		return nil, err
+	}
+	defer ns.Close()
+
+	res, err := func() (*Result, error) {
+		// The container side is created with a temporary name, as the interface name is likely to exist on the host already
+		tmpIfName := hostInterfacePrefix + "tmp" + strconv.Itoa(os.Getpid())
+		if len(tmpIfName) > 15 {
+			tmpIfName = tmpIfName[:15]
+		}
+
+		veth := &netlink.Veth{
+			LinkAttrs: netlink.LinkAttrs{
+				Name: hostIfName,
+				MTU:  conf.MTU,
+			},
+			PeerName: tmpIfName,
+		}
+		if err := netlink.LinkAdd(veth); err != nil {
+			return nil, err
+		}
+
+		hostLink, err := netlink.LinkByName(hostIfName)
+		if err != nil {
+			return nil, err
+		}
+
+		peerLink, err := netlink.LinkByName(tmpIfName)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := netlink.LinkSetNsFd(peerLink, int(ns)); err != nil {
+			return nil, err
+		}
+
+		if err := setSysctl(filepath.Join("net/ipv4/conf", hostIfName, "proxy_arp"), "1"); err != nil {
+			return nil, err
+		}
+
+		if err := setSysctl("net/ipv4/ip_forward", "1"); err != nil {
+			return nil, err
+		}
+
+		if err := netlink.LinkSetUp(hostLink); err != nil {
+			return nil, err
+		}
+
+		if err := netlink.RouteReplace(&netlink.Route{
+			LinkIndex: hostLink.Attrs().Index,
+			Dst:       &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)},
+			Scope:     netlink.SCOPE_LINK,
+		}); err != nil {
+			return nil, err
+		}
+
+		handle, err := netlink.NewHandleAt(ns)
+		if err != nil {
+			return nil, err
+		}
+		defer handle.Delete()
+
+		link, err := handle.LinkByName(tmpIfName)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := handle.LinkSetName(link, args.IfName); err != nil {
+			return nil, err
+		}
+
+		if err := handle.AddrAdd(link, &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}}); err != nil {
+			return nil, err
+		}
+
+		if err := handle.LinkSetUp(link); err != nil {
+			return nil, err
+		}
+
+		// The gateway is outside of the /32 network of the container, so it needs a link-scoped route before it can be used as the default gateway
+		if err := handle.RouteAdd(&netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Dst:       &net.IPNet{IP: gateway, Mask: net.CIDRMask(32, 32)},
+			Scope:     netlink.SCOPE_LINK,
+		}); err != nil {
+			return nil, err
+		}
+
+		if err := handle.RouteAdd(&netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Gw:        gateway,
+		}); err != nil {
+			return nil, err
+		}
+
+		return newResult(conf, hostIfName, hostLink.Attrs().HardwareAddr.String(), args.IfName, link.Attrs().HardwareAddr.String(), args.Netns, ip, gateway), nil
+	}()
+	if err != nil {
+		if link, e := netlink.LinkByName(hostIfName); e == nil {
+			_ = netlink.LinkDel(link)
+		}
+
+		_ = releaseIP(conf, args.ContainerID, args.IfName)
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// del removes the veth pair of the container and releases its IP; it succeeds if the container has already been removed
+func del(conf *NetConf, args *Args) error {
+	if link, err := netlink.LinkByName(getHostInterfaceName(args.ContainerID, args.IfName)); err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			return err
+		}
+	}
+
+	return releaseIP(conf, args.ContainerID, args.IfName)
+}
+
+// check verifies that the veth pair of the container exists and that its IP is still allocated
+func check(conf *NetConf, args *Args) error {
+	if _, err := netlink.LinkByName(getHostInterfaceName(args.ContainerID, args.IfName)); err != nil {
+		return errMissingHostInterface
+	}
+
+	ip, err := findIP(conf, args.ContainerID, args.IfName)
+	if err != nil {
+		return err
+	}
+
+	if ip == nil {
+		return errMissingIP
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package wrtccni
+
+import (
+	"net"
+)
+
+func add(conf *NetConf, args *Args, subnet *net.IPNet) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func del(conf *NetConf, args *Args) error {
+	return ErrUnsupported
+}
+
+func check(conf *NetConf, args *Args) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,421 @@
+package wrtccni
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+)
+
+const (
+	CommandAdd     = "ADD"     // Attach a container to the network
+	CommandDel     = "DEL"     // Detach a container from the network
+	CommandCheck   = "CHECK"   // Check whether a container is still attached to the network
+	CommandVersion = "VERSION" // Report the supported versions of the CNI specification
+
+	defaultDataDir = "/var/lib/cni/networks" // Default directory to store the allocated IPs in
+	defaultMTU     = 1420                    // Default MTU of the interfaces of containers, which matches the default MTU of `weron vpn ip`
+
+	hostInterfacePrefix = "wrn" // Prefix of the host side of the veth pairs
+
+	// Error codes of the CNI specification
+	ErrorCodeIncompatibleVersion = 1
+	ErrorCodeUnsupportedField    = 2
+	ErrorCodeInvalidEnvironment  = 4
+	ErrorCodeIOFailure           = 5
+	ErrorCodeDecodingFailure     = 6
+	ErrorCodeInvalidConfig       = 7
+	ErrorCodeTryAgainLater       = 11
+)
+
+var (
+	SupportedVersions = []string{"0.3.0", "0.3.1", "0.4.0", "1.0.0"} // Versions of the CNI specification which the plugin implements
+
+	ErrMissingCommand     = errors.New("missing CNI_COMMAND")                                                       // The runtime didn't set the command
+	ErrUnknownCommand     = errors.New("unknown CNI_COMMAND")                                                       // The runtime has set a command which the plugin doesn't implement
+	ErrMissingContainerID = errors.New("missing CNI_CONTAINERID")                                                   // The runtime didn't set the container ID
+	ErrMissingNetns       = errors.New("missing CNI_NETNS")                                                         // The runtime didn't set the network namespace
+	ErrMissingIfName      = errors.New("missing CNI_IFNAME")                                                        // The runtime didn't set the name of the interface
+	ErrMissingSubnet      = errors.New("neither a subnet nor a manager lease to fetch it from has been configured") // The plugin can't know which IPs to allocate
+	ErrNoIPv4Subnet       = errors.New("lease does not contain an IPv4 subnet")                                     // The lease of the node only contains IPv6 addresses
+	ErrSubnetExhausted    = errors.New("no free IPs left in subnet")                                                // All IPs of the subnet have been allocated
+	ErrUnsupportedVersion = errors.New("unsupported CNI version")                                                   // The runtime requested a version of the specification which the plugin doesn't implement
+	ErrUnsupported        = errors.New("CNI is only supported on Linux")                                            // The plugin can only attach containers on Linux
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// ManagerConfig configures how to fetch the subnet of the node from the lease of the node in a persistent community
+type ManagerConfig struct {
+	URL       string `json:"url"`       // URL of the signaler's management API (i.e. https://weron.up.railway.app/)
+	Community string `json:"community"` // Persistent community which the nodes join
+	Password  string `json:"password"`  // Password of the community, which is used to read the lease
+	Lease     string `json:"lease"`     // ID of the lease of the node (default is the hostname)
+}
+
+// NetConf is the network configuration which the runtime passes to the plugin
+type NetConf struct {
+	CNIVersion string         `json:"cniVersion"`
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Subnet     string         `json:"subnet,omitempty"`  // IPv4 subnet of the pods on this node (i.e. 10.244.1.0/24), which the node advertises to its peers (i.e. with `weron vpn ip --advertise`)
+	Manager    *ManagerConfig `json:"manager,omitempty"` // Manager to fetch the subnet from if it is not set; the first IPv4 network of the lease of the node is used
+	MTU        int            `json:"mtu,omitempty"`     // MTU of the interfaces of the pods (default is 1420)
+	DataDir    string         `json:"dataDir,omitempty"` // Directory to store the allocated IPs in (default is /var/lib/cni/networks)
+}
+
+// Args are the arguments which the runtime passes to the plugin through the environment
+type Args struct {
+	Command     string // Operation to execute (see CommandAdd etc.)
+	ContainerID string // ID of the container
+	Netns       string // Path to the network namespace of the container
+	IfName      string // Name of the interface to create in the container
+}
+
+// Interface is an interface which the plugin has created
+type Interface struct {
+	Name    string `json:"name"`
+	Mac     string `json:"mac,omitempty"`
+	Sandbox string `json:"sandbox,omitempty"`
+}
+
+// IPConfig is an IP which the plugin has assigned to an interface
+type IPConfig struct {
+	Version   string `json:"version,omitempty"` // Only used by versions before 1.0.0
+	Interface *int   `json:"interface,omitempty"`
+	Address   string `json:"address"`
+	Gateway   string `json:"gateway,omitempty"`
+}
+
+// Route is a route which the plugin has added to a container
+type Route struct {
+	Dst string `json:"dst"`
+	GW  string `json:"gw,omitempty"`
+}
+
+// Result is the result of an ADD command
+type Result struct {
+	CNIVersion string      `json:"cniVersion"`
+	Interfaces []Interface `json:"interfaces,omitempty"`
+	IPs        []IPConfig  `json:"ips,omitempty"`
+	Routes     []Route     `json:"routes,omitempty"`
+	DNS        struct{}    `json:"dns"`
+}
+
+// VersionResult is the result of a VERSION command
+type VersionResult struct {
+	CNIVersion        string   `json:"cniVersion"`
+	SupportedVersions []string `json:"supportedVersions"`
+}
+
+// Error is the result of a failed command
+type Error struct {
+	CNIVersion string `json:"cniVersion"`
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+	Details    string `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// ParseArgs reads the arguments from the environment
+func ParseArgs(getenv func(string) string) (*Args, error) {
+	args := &Args{
+		Command:     getenv("CNI_COMMAND"),
+		ContainerID: getenv("CNI_CONTAINERID"),
+		Netns:       getenv("CNI_NETNS"),
+		IfName:      getenv("CNI_IFNAME"),
+	}
+
+	switch args.Command {
+	case "":
+		return nil, ErrMissingCommand
+	case CommandVersion:
+		return args, nil
+	case CommandAdd, CommandDel, CommandCheck:
+	default:
+		return nil, ErrUnknownCommand
+	}
+
+	if strings.TrimSpace(args.ContainerID) == "" {
+		return nil, ErrMissingContainerID
+	}
+
+	// The network namespace may already be gone when a container is deleted
+	if strings.TrimSpace(args.Netns) == "" && args.Command != CommandDel {
+		return nil, ErrMissingNetns
+	}
+
+	if strings.TrimSpace(args.IfName) == "" {
+		return nil, ErrMissingIfName
+	}
+
+	return args, nil
+}
+
+// ParseNetConf reads the network configuration and applies the defaults; the configuration is also returned if its version is not supported
+func ParseNetConf(r io.Reader) (*NetConf, error) {
+	conf := &NetConf{}
+	if err := json.NewDecoder(r).Decode(conf); err != nil {
+		return nil, err
+	}
+
+	if !isSupportedVersion(conf.CNIVersion) {
+		return conf, ErrUnsupportedVersion
+	}
+
+	if conf.MTU <= 0 {
+		conf.MTU = defaultMTU
+	}
+
+	if strings.TrimSpace(conf.DataDir) == "" {
+		conf.DataDir = defaultDataDir
+	}
+
+	return conf, nil
+}
+
+func isSupportedVersion(version string) bool {
+	for _, supported := range SupportedVersions {
+		if version == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSubnet returns the subnet of the pods on this node, which is fetched from the lease of the node if it hasn't been configured
+func getSubnet(conf *NetConf, ctx context.Context) (*net.IPNet, error) {
+	if strings.TrimSpace(conf.Subnet) != "" {
+		_, subnet, err := net.ParseCIDR(conf.Subnet)
+
+		return subnet, err
+	}
+
+	if conf.Manager == nil {
+		return nil, ErrMissingSubnet
+	}
+
+	id := conf.Manager.Lease
+	if strings.TrimSpace(id) == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+
+		id = hostname
+	}
+
+	lease, err := wrtcmgr.NewManager(conf.Manager.URL, "", "", ctx).GetLease(conf.Manager.Community, conf.Manager.Password, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cidr := range lease.IPs {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		if subnet.IP.To4() != nil {
+			return subnet, nil
+		}
+	}
+
+	return nil, ErrNoIPv4Subnet
+}
+
+// getGateway returns the gateway of the pods, which is the first IP of the subnet; it is answered with proxy ARP by the host, so it is not assigned to any interface
+func getGateway(subnet *net.IPNet) net.IP {
+	return addToIP(subnet.IP.To4(), 1)
+}
+
+func addToIP(ip net.IP, n uint32) net.IP {
+	res := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(res, binary.BigEndian.Uint32(ip.To4())+n)
+
+	return res
+}
+
+// getHostInterfaceName returns the name of the host side of the veth pair of a container, which is derived from the container ID and must be shorter than 16 characters
+func getHostInterfaceName(containerID string, ifName string) string {
+	id := strings.ReplaceAll(containerID+ifName, "-", "")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	return hostInterfacePrefix + id
+}
+
+// getAllocationDir returns the directory in which the IPs of the network are allocated
+func getAllocationDir(conf *NetConf) string {
+	return filepath.Join(conf.DataDir, conf.Name)
+}
+
+// allocateIP reserves a free IP of the subnet for a container by creating a file named after it, which fails if the IP has already been reserved; the network address, the gateway and the broadcast address are never allocated
+func allocateIP(conf *NetConf, subnet *net.IPNet, containerID string, ifName string) (net.IP, error) {
+	dir := getAllocationDir(conf)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	// Containers which are added again keep their IP
+	if ip, err := findIP(conf, containerID, ifName); err != nil || ip != nil {
+		return ip, err
+	}
+
+	ones, bits := subnet.Mask.Size()
+	size := uint32(1) << uint32(bits-ones)
+
+	for i := uint32(2); i < size-1; i++ {
+		ip := addToIP(subnet.IP, i)
+
+		f, err := os.OpenFile(filepath.Join(dir, ip.String()), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if _, err := f.WriteString(containerID + "\n" + ifName); err != nil {
+			_ = f.Close()
+
+			return nil, err
+		}
+
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+
+		return ip, nil
+	}
+
+	return nil, ErrSubnetExhausted
+}
+
+// findIP returns the IP which has been allocated for a container (nil if no IP has been allocated)
+func findIP(conf *NetConf, containerID string, ifName string) (net.IP, error) {
+	entries, err := os.ReadDir(getAllocationDir(conf))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		ip := net.ParseIP(entry.Name())
+		if ip == nil {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(getAllocationDir(conf), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if string(b) == containerID+"\n"+ifName {
+			return ip, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// releaseIP frees the IP which has been allocated for a container
+func releaseIP(conf *NetConf, containerID string, ifName string) error {
+	ip, err := findIP(conf, containerID, ifName)
+	if err != nil || ip == nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(getAllocationDir(conf), ip.String()))
+}
+
+// newResult formats the result of an ADD command for the version of the specification which the runtime has requested
+func newResult(conf *NetConf, hostIfName string, hostMac string, ifName string, mac string, netns string, ip net.IP, gateway net.IP) *Result {
+	containerIndex := 1
+
+	version := ""
+	if conf.CNIVersion != "1.0.0" {
+		version = "4"
+	}
+
+	return &Result{
+		CNIVersion: conf.CNIVersion,
+		Interfaces: []Interface{
+			{Name: hostIfName, Mac: hostMac},
+			{Name: ifName, Mac: mac, Sandbox: netns},
+		},
+		IPs: []IPConfig{
+			{
+				Version:   version,
+				Interface: &containerIndex,
+				Address:   (&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}).String(),
+				Gateway:   gateway.String(),
+			},
+		},
+		Routes: []Route{
+			{Dst: "0.0.0.0/0", GW: gateway.String()},
+		},
+	}
+}
+
+// Execute runs a command of the runtime and returns its result, which is to be written to the standard output
+func Execute(args *Args, stdin io.Reader, ctx context.Context) (interface{}, error) {
+	if args.Command == CommandVersion {
+		return &VersionResult{
+			CNIVersion:        SupportedVersions[len(SupportedVersions)-1],
+			SupportedVersions: SupportedVersions,
+		}, nil
+	}
+
+	conf, err := ParseNetConf(stdin)
+	if err != nil {
+		if err == ErrUnsupportedVersion {
+			return nil, &Error{conf.CNIVersion, ErrorCodeIncompatibleVersion, err.Error(), conf.CNIVersion}
+		}
+
+		return nil, &Error{SupportedVersions[len(SupportedVersions)-1], ErrorCodeDecodingFailure, err.Error(), ""}
+	}
+
+	switch args.Command {
+	case CommandAdd:
+		subnet, err := getSubnet(conf, ctx)
+		if err != nil {
+			return nil, &Error{conf.CNIVersion, ErrorCodeTryAgainLater, "could not get subnet", err.Error()}
+		}
+
+		res, err := add(conf, args, subnet)
+		if err != nil {
+			return nil, &Error{conf.CNIVersion, ErrorCodeIOFailure, "could not add container to network", err.Error()}
+		}
+
+		return res, nil
+	case CommandDel:
+		if err := del(conf, args); err != nil {
+			return nil, &Error{conf.CNIVersion, ErrorCodeIOFailure, "could not delete container from network", err.Error()}
+		}
+
+		return nil, nil
+	default:
+		if err := check(conf, args); err != nil {
+			return nil, &Error{conf.CNIVersion, ErrorCodeIOFailure, "container is not attached to network", err.Error()}
+		}
+
+		return nil, nil
+	}
+}
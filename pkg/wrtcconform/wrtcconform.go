@@ -0,0 +1,239 @@
+package wrtcconform
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcenc"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SpecVersion = "1" // Version of the signaling spec (see docs/signaling.md) which the vectors and checks implement
+
+	VectorKey       = "conformance-key"       // Community key with which the vectors are encrypted
+	VectorCommunity = "conformance-community" // Community of the vectors which are wrapped in envelopes
+
+	vectorFrom = "4f5a3d8e-0c1b-4f7e-9a61-2a0d3c9b7e10"
+	vectorTo   = "b2c94e71-6d0a-4b8f-8e35-7f1d2a6c4e93"
+	vectorName = "conformance"
+)
+
+var (
+	ErrTimeout  = errors.New("timed out")                                      // The client under test did not echo a message in time
+	ErrMismatch = errors.New("echoed message does not match the sent message") // The client under test echoed a different message than the one which was sent
+)
+
+// Vector is a message encoded as it is sent over the wire
+type Vector struct {
+	Name       string `json:"name"`                // Name of the vector
+	Version    string `json:"version"`             // Subprotocol the message is encoded with (i.e. weron.v2.cbor)
+	Key        string `json:"key"`                 // Community key the message is encrypted with
+	Community  string `json:"community,omitempty"` // Community of the envelope the frame is wrapped in (empty if the frame is not wrapped)
+	Plaintext  []byte `json:"plaintext"`           // Encoded message
+	Ciphertext []byte `json:"ciphertext"`          // Encrypted message (nonce followed by the sealed message)
+	Frame      []byte `json:"frame"`               // Payload of the WebSocket frame, which is the ciphertext, optionally wrapped in an envelope
+}
+
+// Vectors returns every message type encoded with every version; ciphertexts use random nonces, so they differ between calls
+func Vectors() ([]Vector, error) {
+	metadata := []byte(`{"hostname":"conformance"}`)
+	offer := []byte(`{"type":"offer","sdp":"v=0\r\n"}`)
+	answer := []byte(`{"type":"answer","sdp":"v=0\r\n"}`)
+	candidate := []byte("candidate:1 1 udp 2130706431 192.0.2.1 50000 typ host")
+	session := "9d2e6f4a-3b1c-4e8d-a7f0-5c6b8e2d1a34"
+
+	messages := []struct {
+		name      string
+		message   interface{}
+		community string
+	}{
+		{"introduction", websocketapi.NewIntroduction(vectorFrom, session, vectorName, "", metadata, nil), ""},
+		{"offer", websocketapi.NewOffer(vectorFrom, vectorTo, session, vectorName, offer, metadata), ""},
+		{"answer", websocketapi.NewAnswer(vectorTo, vectorFrom, answer), ""},
+		{"candidate", websocketapi.NewCandidate(vectorFrom, vectorTo, candidate), ""},
+		{"end-of-candidates", websocketapi.NewEndOfCandidates(vectorFrom, vectorTo), ""},
+		{"renegotiation-offer", websocketapi.NewRenegotiationOffer(vectorFrom, vectorTo, offer), ""},
+		{"renegotiation-answer", websocketapi.NewRenegotiationAnswer(vectorTo, vectorFrom, answer), ""},
+		{"relay", websocketapi.NewRelay(vectorFrom, vectorTo, services.ConformancePrimary, []byte("hello")), ""},
+		{"relay-close", websocketapi.NewRelayClose(vectorFrom, vectorTo, services.ConformancePrimary), ""},
+		{"goodbye", websocketapi.NewGoodbye(vectorFrom, vectorTo, "maintenance"), ""},
+		{"mail", websocketapi.NewMail(vectorFrom, vectorTo, []byte("hello"), 1700000000), ""},
+		{"introduction-in-envelope", websocketapi.NewIntroduction(vectorFrom, session, vectorName, "", metadata, nil), VectorCommunity},
+	}
+
+	vectors := []Vector{}
+	for _, version := range websocketapi.Versions {
+		for _, m := range messages {
+			plaintext, err := websocketapi.Marshal(version, m.message)
+			if err != nil {
+				return nil, err
+			}
+
+			ciphertext, err := wrtcenc.DefaultCipher().Encrypt(plaintext, []byte(VectorKey))
+			if err != nil {
+				return nil, err
+			}
+
+			frame := ciphertext
+			if m.community != "" {
+				frame, err = websocketapi.Marshal(version, websocketapi.NewEnvelope(m.community, ciphertext))
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			vectors = append(vectors, Vector{
+				Name:       m.name,
+				Version:    version,
+				Key:        VectorKey,
+				Community:  m.community,
+				Plaintext:  plaintext,
+				Ciphertext: ciphertext,
+				Frame:      frame,
+			})
+		}
+	}
+
+	return vectors, nil
+}
+
+// CheckConfig configures the check
+type CheckConfig struct {
+	*wrtcconn.AdapterConfig
+	PeerID        string // ID of the client under test (empty checks the first client which connects)
+	Messages      int    // Amount of messages to send to the client under test (default is 3)
+	MessageLength int    // Length of the messages to send to the client under test (default is 64)
+}
+
+// Result is the result of checking a client
+type Result struct {
+	PeerID   string        // ID of the client under test
+	Relayed  bool          // Whether the client under test is connected through a relay
+	Messages int           // Amount of messages which have been echoed correctly
+	Latency  time.Duration // Average round-trip time of the messages
+}
+
+// Check joins a community and waits for the client under test to connect to it on the conformance channel, then sends random messages which it must echo back unchanged
+func Check(
+	ctx context.Context,
+	signaler string,
+	key string,
+	ice []string,
+	config *CheckConfig,
+) (*Result, error) {
+	if config == nil {
+		config = &CheckConfig{}
+	}
+
+	if config.AdapterConfig == nil {
+		config.AdapterConfig = &wrtcconn.AdapterConfig{
+			Timeout: time.Second * 10,
+		}
+	}
+
+	if config.Messages <= 0 {
+		config.Messages = 3
+	}
+
+	if config.MessageLength <= 0 {
+		config.MessageLength = 64
+	}
+
+	ictx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	adapter := wrtcconn.NewAdapter(signaler, key, ice, []string{services.ConformancePrimary}, config.AdapterConfig, ictx)
+
+	ids, err := adapter.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer adapter.Close()
+
+	select {
+	case <-ictx.Done():
+		return nil, ictx.Err()
+	case err := <-adapter.Err():
+		return nil, err
+	case id := <-ids:
+		log.Debug().Str("id", id).Msg("Connected to signaler, waiting for client under test")
+	}
+
+	var p *wrtcconn.Peer
+	for p == nil {
+		select {
+		case <-ictx.Done():
+			return nil, ictx.Err()
+		case candidate := <-adapter.Accept():
+			if strings.TrimSpace(config.PeerID) != "" && candidate.PeerID != config.PeerID {
+				log.Debug().Str("peerID", candidate.PeerID).Msg("Connected to peer which is not the client under test, ignoring")
+
+				continue
+			}
+
+			p = candidate
+		}
+	}
+
+	result := &Result{
+		PeerID:  p.PeerID,
+		Relayed: p.Relayed,
+	}
+
+	type echo struct {
+		n   int
+		err error
+	}
+
+	var total time.Duration
+	for i := 0; i < config.Messages; i++ {
+		sent := make([]byte, config.MessageLength)
+		if _, err := rand.Read(sent); err != nil {
+			return result, err
+		}
+
+		start := time.Now()
+		if _, err := p.Conn.Write(sent); err != nil {
+			return result, err
+		}
+
+		received := make([]byte, config.MessageLength)
+		echoes := make(chan echo, 1)
+		go func() {
+			n, err := io.ReadFull(p.Conn, received)
+
+			echoes <- echo{n, err}
+		}()
+
+		select {
+		case <-ictx.Done():
+			return result, ictx.Err()
+		case <-time.After(config.Timeout):
+			return result, ErrTimeout
+		case e := <-echoes:
+			if e.err != nil {
+				return result, e.err
+			}
+
+			if !bytes.Equal(sent, received[:e.n]) {
+				return result, ErrMismatch
+			}
+		}
+
+		total += time.Since(start)
+		result.Messages++
+	}
+
+	result.Latency = total / time.Duration(result.Messages)
+
+	return result, nil
+}
@@ -4,48 +4,240 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/pion/ice/v2"
+	"github.com/pion/interceptor"
 	"github.com/pion/webrtc/v3"
 	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
-	"github.com/pojntfx/weron/internal/encryption"
+	"github.com/pojntfx/weron/internal/webtransport"
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcaudit"
+	"github.com/pojntfx/weron/pkg/wrtcenc"
+	"github.com/pojntfx/weron/pkg/wrtcsess"
+	"github.com/pojntfx/weron/pkg/wrtcstats"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultICEDisconnectedTimeout = time.Second * 5  // Default time without network activity after which a connection is considered to be disconnected
+	defaultICEFailedTimeout       = time.Second * 25 // Default time after a disconnect after which a connection is considered to have failed
+	defaultICEKeepaliveInterval   = time.Second * 2  // Default time to wait between keepalives
 )
 
 var (
-	ErrInvalidTURNServerAddr   = errors.New("invalid TURN server address")                            // The specified TURN server address is invalid
-	ErrMissingTURNCredentials  = errors.New("missing TURN server credentials")                        // The specified TURN server is missing credentials
-	ErrMissingForcedTURNServer = errors.New("TURN is forced, but no TURN server has been configured") // All connections must use TURN, but no TURN server has been configured
+	ErrInvalidTURNServerAddr   = errors.New("invalid TURN server address")                                          // The specified TURN server address is invalid
+	ErrMissingTURNCredentials  = errors.New("missing TURN server credentials")                                      // The specified TURN server is missing credentials
+	ErrMissingForcedTURNServer = errors.New("TURN is forced, but no TURN server has been configured")               // All connections must use TURN, but no TURN server has been configured
+	ErrDuplicateCommunity      = errors.New("community has been specified multiple times")                          // The same community has been specified multiple times
+	ErrInvalidICETimeouts      = errors.New("ICE keepalive interval must be shorter than the disconnected timeout") // Connections would be considered to be disconnected between keepalives
 )
 
+type line struct {
+	community string
+	to        string
+	p         []byte
+	message   interface{} // Message to marshal with the version of the current connection to the signaler instead of p (nil if p is set)
+	mail      bool        // Whether the signaler should queue the message if the recipient is offline
+}
+
 type peer struct {
+	ctx    context.Context // Context of the peer, which is cancelled once it is closed to stop its goroutines
+	cancel context.CancelFunc
+
 	conn       *webrtc.PeerConnection
 	candidates chan webrtc.ICECandidateInit
 	channels   map[string]*webrtc.DataChannel
 	iid        string
+	metadata   []byte
+	name       string
+	relays     map[string]*relayConn
+	session    string
+	path       string    // Path of the connection to the peer (see PathHost etc.; empty if it hasn't been determined yet)
+	upgradedAt time.Time // Time of the last attempt to upgrade a relayed connection to a direct one
+
+	remoteCandidates []string  // Candidates which the peer has sent, which are cached once the connection has been established
+	createdAt        time.Time // Time at which the negotiation with the peer has started
+	connectedAt      time.Time // Time at which the connection to the peer has been established, either directly or through a relay (zero if it hasn't been yet)
+
+	adaptive adaptivePeer // Quality and adaptive channels of the direct connection to the peer
+	binding  *bindingPeer // Nonces of the direct connection to the peer which channel bindings are derived from
+}
+
+// newPeer creates a peer with a context derived from the adapter's
+func newPeer(ctx context.Context, conn *webrtc.PeerConnection, channels map[string]*webrtc.DataChannel, iid string, metadata []byte, session string, name string) *peer {
+	pctx, cancel := context.WithCancel(ctx)
+
+	return &peer{
+		ctx:    pctx,
+		cancel: cancel,
+
+		conn:       conn,
+		candidates: make(chan webrtc.ICECandidateInit),
+		channels:   channels,
+		iid:        iid,
+		metadata:   metadata,
+		name:       name,
+		relays:     map[string]*relayConn{},
+		session:    session,
+
+		remoteCandidates: []string{},
+		createdAt:        time.Now(),
+
+		binding: newBindingPeer(),
+	}
+}
+
+func (p *peer) closeRelays() {
+	for _, relay := range p.relays {
+		relay.closeLocal()
+	}
+}
+
+// close stops the peer's goroutines and closes its channels and connection; channels which the remote peer has already closed can't be closed again, which is ignored
+func (p *peer) close() {
+	p.cancel()
+
+	for _, channel := range p.channels {
+		if err := channel.Close(); err != nil {
+			log.Debug().Err(err).Str("channelID", channel.Label()).Msg("Could not close channel, continuing")
+		}
+	}
+
+	p.closeRelays()
+
+	if err := p.conn.Close(); err != nil {
+		log.Debug().Err(err).Msg("Could not close peer connection, continuing")
+	}
+}
+
+// connected returns whether the peer has an established direct connection which doesn't depend on the signaler
+func (p *peer) connected() bool {
+	return p.conn.ConnectionState() == webrtc.PeerConnectionStateConnected && len(p.relays) == 0
+}
+
+// negotiating returns whether the connection to the peer is still being established
+func (p *peer) negotiating(timeout time.Duration) bool {
+	state := p.conn.ConnectionState()
+
+	return (state == webrtc.PeerConnectionStateNew || state == webrtc.PeerConnectionStateConnecting) && time.Since(p.createdAt) < timeout
+}
+
+// offering returns whether an offer has been sent to the peer which it hasn't answered yet
+func (p *peer) offering() bool {
+	return p.conn.SignalingState() == webrtc.SignalingStateHaveLocalOffer
 }
 
 // Peer is a connected remote adapter
 type Peer struct {
 	PeerID    string             // ID of the peer
+	Name      string             // Human-readable name of the peer (empty if the peer has not set one)
 	ChannelID string             // Channel on which the peer is connected to
 	Conn      io.ReadWriteCloser // Underlying connection to send/receive on
+	Metadata  []byte             // Metadata the peer has supplied during introduction
+	Community string             // Community in which the peer is connected
+	Relayed   bool               // Whether payloads are relayed through the signaler, a data relay or other peers because a direct connection could not be established or has been pruned (see AdapterConfig.MeshDegree)
+
+	close func(reason string) error
+}
+
+// Close closes the connection to the peer, including all of its other channels, and sends the reason to the peer, which receives it as the reason of its closed event (empty uses ReasonClosed); the peer connects again once it re-introduces itself, unless it is denied with SetDenyList
+func (p *Peer) Close(reason string) error {
+	if p.close == nil {
+		return p.Conn.Close()
+	}
+
+	return p.close(reason)
+}
+
+// Community is an additional community to join
+type Community struct {
+	ID       string // ID of the community
+	Password string // Password for the community
+	Key      string // Encryption key for the community
 }
 
 // AdapterConfig configures the adapter
 type AdapterConfig struct {
-	Timeout             time.Duration // Time to wait before retrying to connect to the signaler
-	ID                  string        // ID to claim without conflict resolution (default is UUID)
-	ForceRelay          bool          // Whether to block P2P connections
-	OnSignalerReconnect func()        // Handler to be called when the adapter has reconnected to the signaler
+	Timeout                  time.Duration       // Time to wait before retrying to connect to the signaler
+	ID                       string              // ID to claim without conflict resolution (default is UUID)
+	IDFile                   string              // Path to a file to persist the ID in, so that it is kept across restarts (ignored if ID is set; empty disables persistence)
+	ForceRelay               bool                // Whether to block P2P connections
+	OnSignalerReconnect      func()              // Handler to be called when the adapter has reconnected to the signaler
+	OnSignalerDisconnect     func(err error)     // Handler to be called when the connection to the signaler has been closed or could not be established; rejections are converted into typed errors (i.e. ErrWrongPassword or ErrDraining)
+	SCTPMaxReceiveBufferSize uint32              // Maximum size of the SCTP receive buffer in bytes (0 uses the default of 1 MB)
+	SCTPMaxSendBufferSize    uint64              // Maximum amount of bytes to buffer before writes to a channel block (0 disables the limit)
+	Compression              bool                // Whether to negotiate permessage-deflate compression with the signaler
+	BinarySignaling          bool                // Whether to request the binary signaling protocol (messages are only encoded as CBOR for peers which use it too)
+	Metadata                 []byte              // Metadata to send to peers during introduction (i.e. version, hostname or advertised services)
+	Name                     string              // Human-readable name to send to peers during introduction, which they show in logs and stats instead of only the ID (i.e. laptop)
+	Services                 []v1.Service        // Services to announce to peers, which they can aggregate in a Registry (overrides Metadata)
+	Communities              []Community         // Additional communities to join over the same signaler connection
+	MediaEngine              *webrtc.MediaEngine // Codecs to negotiate for media tracks (nil disables media)
+	RelayFallback            bool                // Whether to relay payloads through the signaler if a direct connection to a peer can't be established
+	RelayRateLimit           int                 // Maximum amount of bytes per second to relay through the signaler per channel (0 uses the default of 64 KiB/s)
+	DataRelays               []string            // URLs of data relays (see wrtcrly) to relay payloads through instead of the signaler if a direct connection to a peer can't be established, which are tried in order (i.e. wss://relay.example.com/) (peers can only reach each other if they are connected to the same data relay)
+	DataRelayToken           string              // Bearer token to connect to the data relays with
+	DSCP                     int                 // DSCP class to mark traffic over host candidates and TURN servers which are used over TCP with (i.e. 46 for EF) (0 disables marking); traffic over server reflexive candidates and TURN servers which are used over UDP isn't marked, as the ICE agent opens their sockets itself, and all channels of a peer share one class, as they share one SCTP association
+	Audit                    *wrtcaudit.Logger   // Audit log to write channel events to (nil disables audit logging)
+	Stats                    *wrtcstats.Recorder // Recorder to sample the link quality to peers into (nil disables sampling)
+	Sessions                 *wrtcsess.Log       // Log to record the sessions with peers into once they have been closed (nil disables recording)
+	ExcludedInterfaces       []string            // Names of interfaces to not gather candidates on (supports wildcards, i.e. docker0 or veth*)
+	ExcludeLinkLocal         bool                // Whether to not gather candidates for link-local addresses
+	ExcludeULA               bool                // Whether to not gather candidates for IPv6 unique local addresses (fc00::/7)
+	IPFamily                 string              // IP family to gather candidates for (ipv4 or ipv6) (empty gathers candidates for both)
+	Nomination               string              // How to nominate candidate pairs (see NominationRegular etc.; default is regular)
+	IncludeLoopback          bool                // Whether to gather candidates for loopback addresses (i.e. to connect adapters on a host without network access)
+	ICEDisconnectedTimeout   time.Duration       // Time without network activity after which a connection to a peer is considered to be disconnected (0 uses the default of 5 seconds)
+	ICEFailedTimeout         time.Duration       // Time after a connection to a peer has been disconnected after which it is considered to have failed (0 uses the default of 25 seconds)
+	ICEKeepaliveInterval     time.Duration       // Time to wait between keepalives to peers when no other traffic is sent; must be shorter than the disconnected timeout (0 uses the default of 2 seconds)
+	SelectiveSignaling       bool                // Whether to send the ID and the recipients of messages to the signaler, so that it only forwards messages to their recipients (reveals the IDs of peers to the signaler)
+	Secure                   bool                // Whether to encrypt payloads on all channels end-to-end with per-peer keys derived from an X25519 handshake and the community key (all peers must enable it)
+	Cipher                   wrtcenc.Cipher      // Cipher to encrypt signaling messages and relayed payloads with (nil uses AES-GCM; all peers in the community must use the same cipher)
+	AllowList                []string            // IDs of the peers to connect to (all peers are allowed if empty; can be changed with SetAllowList)
+	DenyList                 []string            // IDs of the peers to never connect to, even if they are on the allow list (can be changed with SetDenyList)
+	UnreliableChannels       []string            // IDs of the channels to open as unordered channels without retransmissions, on which messages may be lost or arrive out of order (i.e. for game state)
+	ICEServersURL            string              // URL of an HTTP endpoint to fetch short-lived STUN and TURN servers from in addition to the static ones (i.e. from Twilio or Cloudflare); they are refreshed before they expire (empty disables fetching)
+	ICEServersMethod         string              // HTTP method to fetch the ICE servers with (default is POST)
+	ICEServersToken          string              // Bearer token to fetch the ICE servers with (credentials in the URL are sent using basic authentication)
+	ICEServersTTL            time.Duration       // Lifetime of the ICE servers to request, which is used if the endpoint doesn't return one (default is 24 hours)
+	Header                   http.Header         // Additional HTTP headers to send to the signaler when connecting (i.e. Authorization or a tenant ID for an authenticating reverse proxy)
+	Cookies                  []*http.Cookie      // Cookies to send to the signaler when connecting (i.e. a session cookie for an authenticating reverse proxy)
+	ICEProviders             []ICEProvider       // Providers of STUN and TURN servers to use in addition to the static ones (i.e. a FileICEProvider); servers which change are applied to new connections and relayed connections are re-established with them
+	Gossip                   bool                // Whether to gossip the community membership with connected peers and relay signaling messages through them while the signaler can't be reached, so that peers can still be introduced (all peers in the community must enable it)
+	GossipInterval           time.Duration       // Time to wait between membership announcements to connected peers (default is 5 seconds)
+	MeshDegree               int                 // Amount of nearest peers per community to keep direct connections to; connections to other peers are closed once they can be reached through nearer peers, which forward their payloads (0 connects to all peers; all peers in the community must enable it); writes to peers which are reached through other peers are limited to MaxMeshPayloadSize bytes, which is less than on direct channels
+	MeshInterval             time.Duration       // Time to wait between round-trip time measurements and route advertisements to connected peers (default is 5 seconds)
+	PeerCacheFile            string              // Path to a file to cache the peers which have been connected to and their candidates in, so that they are sent an offer immediately after a restart instead of waiting for them to answer the introduction (empty disables caching)
+	AcceptQueueLength        int                 // Maximum amount of peers to queue for Accept and each AcceptChannel before the accept policy applies (0 queues none)
+	AcceptPolicy             string              // What to do with peers which can't be queued because the application doesn't accept them fast enough (see AcceptPolicyBlock etc.; default is to block)
+	Negotiation              string              // Whether to send offers, answer offers or both (see NegotiationListen etc.; default is both), so that hub-and-spoke topologies can be built without both sides sending offers simultaneously
+	UnreliableDropThreshold  uint64              // Amount of buffered bytes above which writes to unreliable channels are dropped instead of queued, so that real-time data stays fresh under congestion (0 disables dropping; see Dropped)
+	AdaptiveChannels         []string            // IDs of the channels whose reliability is adapted to the measured loss and round-trip time of each direct connection; writes to them switch between the reliable channel and unordered, partially reliable channels with fewer retransmissions on lossy links (all peers in the community must enable it; see Quality)
+	AdaptiveLatency          time.Duration       // Maximum time which retransmissions of writes to adaptive channels may take, which limits their amount on links with a high round-trip time (default is 1 second)
+	QualityInterval          time.Duration       // Time to wait between probes which measure the loss and round-trip time of direct connections; probes are only sent if AdaptiveChannels or OnPeerQualityChange are set (default is 200 milliseconds)
+	ChannelBindings          bool                // Whether to exchange random nonces with peers over an internal channel of direct connections, from which ChannelBinding derives its tokens (all peers in the community must enable it)
+
+	OnPeerConnectionCreated func(peerID string, community string, conn *webrtc.PeerConnection)                             // Handler to be called before the adapter negotiates a new peer connection (i.e. to add tracks or read stats); must not replace the connection state and ICE candidate handlers
+	OnPeerPathChange        func(community string, peerID string, path string)                                             // Handler to be called when the path of the connection to a peer has changed (i.e. from host to relay, see PathHost etc.)
+	OnMail                  func(mail Mail)                                                                                // Handler to be called when mail has been received from a peer (see SendMail); must not block
+	OnPeerQualityChange     func(community string, peerID string, quality Quality)                                         // Handler to be called when the quality of the direct connection to a peer has been measured (see QualityInterval) and with a quality without measurements once the connection has been closed; must not block
+	OnLocalDescription      func(community string, peerID string, sdp webrtc.SessionDescription) webrtc.SessionDescription // Handler to be called with offers and answers before they are set as the local description and sent to a peer; the returned description is used instead (i.e. to cap the bandwidth with b=AS or strip candidates); must not block
+	OnRemoteDescription     func(community string, peerID string, sdp webrtc.SessionDescription) webrtc.SessionDescription // Handler to be called with offers and answers from a peer before they are set as the remote description; the returned description is used instead (i.e. to reorder codecs); must not block
+	UpgradeInterval         time.Duration                                                                                  // Time to wait between ICE restarts of connections which are relayed through TURN servers to try and upgrade them to direct connections (0 disables upgrades; ignored if ForceRelay is enabled)
 }
 
-// NamedAdapter provides a connection service without name conflict prevention
+// Adapter provides a connection service without name conflict prevention
 type Adapter struct {
 	signaler string
 	key      string
@@ -53,15 +245,56 @@ type Adapter struct {
 	channels []string
 	config   *AdapterConfig
 	ctx      context.Context
+	cipher   wrtcenc.Cipher
 
-	cancel   context.CancelFunc
-	done     bool
-	doneSync sync.Mutex
-	lines    chan []byte
+	cancel    context.CancelFunc
+	group     *errgroup.Group
+	closeOnce sync.Once
+	lines     chan line
+	errs      chan error
 
 	peers chan *Peer
 
 	api *webrtc.API
+	mux ice.UDPMux
+
+	listsLock       sync.RWMutex
+	allowed         map[string]struct{}
+	denied          map[string]struct{}
+	closeDisallowed func()
+
+	pathsLock sync.Mutex
+	paths     func() []PeerPath
+
+	mailLock sync.Mutex
+	sendMail func(community string, to string, payload []byte) error
+
+	transportsLock sync.Mutex
+	getTransport   func(community string, peerID string) (*webrtc.DTLSTransport, *bindingPeer)
+
+	// The ICE servers are replaced together with the changed channel, which is closed to reconnect peers which are relayed through the old TURN servers
+	iceServersLock     sync.Mutex
+	iceServers         []webrtc.ICEServer
+	providedICEServers [][]webrtc.ICEServer
+	iceServersChanged  chan struct{}
+
+	turnDialer *turnDialer
+
+	router *channelRouter
+
+	gossip *gossipMesh
+
+	mesh *meshRouter
+
+	dataRelay *dataRelay
+
+	cache *peerCache
+
+	events *peerEvents
+
+	adaptive *adaptiveManager
+
+	dropped uint64
 }
 
 // NewAdapter creates the adapter
@@ -83,6 +316,14 @@ func NewAdapter(
 		}
 	}
 
+	peers := make(chan *Peer, config.AcceptQueueLength)
+	events := newPeerEvents()
+
+	cipher := config.Cipher
+	if cipher == nil {
+		cipher = wrtcenc.DefaultCipher()
+	}
+
 	return &Adapter{
 		signaler: signaler,
 		key:      key,
@@ -90,73 +331,252 @@ func NewAdapter(
 		channels: channels,
 		config:   config,
 		ctx:      ictx,
+		cipher:   cipher,
 
 		cancel: cancel,
-		peers:  make(chan *Peer),
-		lines:  make(chan []byte),
+		group:  &errgroup.Group{},
+		peers:  peers,
+		lines:  make(chan line),
+		errs:   make(chan error),
+
+		allowed: getPeerSet(config.AllowList),
+		denied:  getPeerSet(config.DenyList),
+
+		iceServersChanged: make(chan struct{}),
+
+		turnDialer: newTURNDialer(config.IPFamily, config.Timeout, config.DSCP),
+
+		router: newChannelRouter(peers, config.AcceptQueueLength, config.AcceptPolicy),
+
+		gossip: newGossipMesh(config.GossipInterval),
+
+		mesh: newMeshRouter(config.MeshDegree, config.MeshInterval, events),
+
+		events: events,
+	}
+}
+
+func getPeerSet(ids []string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			set[id] = struct{}{}
+		}
 	}
+
+	return set
 }
 
-func (a *Adapter) sendLine(line []byte) {
-	a.doneSync.Lock()
-	defer a.doneSync.Unlock()
+// SetAllowList replaces the IDs of the peers to connect to (all peers are allowed if empty); connections to peers which are no longer allowed are closed
+func (a *Adapter) SetAllowList(ids []string) {
+	a.listsLock.Lock()
+	a.allowed = getPeerSet(ids)
+	closeDisallowed := a.closeDisallowed
+	a.listsLock.Unlock()
 
-	if a.done {
-		return
+	if closeDisallowed != nil {
+		closeDisallowed()
+	}
+}
+
+// SetDenyList replaces the IDs of the peers to never connect to; connections to peers which are now denied are closed
+func (a *Adapter) SetDenyList(ids []string) {
+	a.listsLock.Lock()
+	a.denied = getPeerSet(ids)
+	closeDisallowed := a.closeDisallowed
+	a.listsLock.Unlock()
+
+	if closeDisallowed != nil {
+		closeDisallowed()
+	}
+}
+
+// IsPeerAllowed returns whether the adapter connects to the peer with the ID
+func (a *Adapter) IsPeerAllowed(id string) bool {
+	a.listsLock.RLock()
+	defer a.listsLock.RUnlock()
+
+	if _, ok := a.denied[id]; ok {
+		return false
+	}
+
+	if _, ok := a.allowed[id]; len(a.allowed) > 0 && !ok {
+		return false
+	}
+
+	return true
+}
+
+// sendLine sends a message to the signaler; if selective signaling is enabled, the signaler only forwards messages with a recipient to that peer; the message is discarded if the adapter is closed before it could be sent
+func (a *Adapter) sendLine(community string, to string, p []byte) {
+	select {
+	case <-a.ctx.Done():
+	case a.lines <- line{community, to, p, nil, false}:
+	}
+}
+
+// sendMessage sends a message which is marshalled with the version of the current connection to the signaler
+func (a *Adapter) sendMessage(community string, to string, message interface{}) {
+	select {
+	case <-a.ctx.Done():
+	case a.lines <- line{community, to, nil, message, false}:
 	}
+}
 
-	a.lines <- line
+// spawn starts a goroutine in the adapter's group; it must only be called from goroutines which are in the group themselves or before Open returns, so that Close can't miss it
+func (a *Adapter) spawn(f func()) {
+	a.group.Go(func() error {
+		f()
+
+		return nil
+	})
 }
 
 // Open connects the adapter to the signaler
 func (a *Adapter) Open() (chan string, error) {
 	settingEngine := webrtc.SettingEngine{}
 	settingEngine.DetachDataChannels()
-	a.api = webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
+	settingEngine.SetSCTPMaxReceiveBufferSize(a.config.SCTPMaxReceiveBufferSize)
+
+	networkTypes, err := getNetworkTypes(a.config.IPFamily)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePolicy(a.config.AcceptPolicy); err != nil {
+		return nil, err
+	}
+
+	if err := validateNegotiation(a.config.Negotiation); err != nil {
+		return nil, err
+	}
+
+	if err := setNomination(&settingEngine, a.config.Nomination); err != nil {
+		return nil, err
+	}
+
+	if networkTypes != nil {
+		settingEngine.SetNetworkTypes(networkTypes)
+	}
+
+	if len(a.config.Services) > 0 {
+		a.config.Metadata, err = json.Marshal(v1.NewServices(a.config.Services))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	settingEngine.SetInterfaceFilter(a.includeInterface)
+	settingEngine.SetIncludeLoopbackCandidate(a.config.IncludeLoopback)
+	settingEngine.SetIPFilter(a.includeIP)
+	settingEngine.SetICEProxyDialer(a.turnDialer)
+
+	// Pion only allows setting all ICE timeouts at once, so unset ones use its defaults
+	if a.config.ICEDisconnectedTimeout > 0 || a.config.ICEFailedTimeout > 0 || a.config.ICEKeepaliveInterval > 0 {
+		disconnectedTimeout := a.config.ICEDisconnectedTimeout
+		if disconnectedTimeout <= 0 {
+			disconnectedTimeout = defaultICEDisconnectedTimeout
+		}
+
+		failedTimeout := a.config.ICEFailedTimeout
+		if failedTimeout <= 0 {
+			failedTimeout = defaultICEFailedTimeout
+		}
+
+		keepaliveInterval := a.config.ICEKeepaliveInterval
+		if keepaliveInterval <= 0 {
+			keepaliveInterval = defaultICEKeepaliveInterval
+		}
+
+		if keepaliveInterval >= disconnectedTimeout {
+			return nil, ErrInvalidICETimeouts
+		}
+
+		settingEngine.SetICETimeouts(disconnectedTimeout, failedTimeout, keepaliveInterval)
+	}
+
+	if a.config.DSCP > 0 {
+		if a.config.DSCP > maxDSCP {
+			return nil, ErrInvalidDSCP
+		}
+
+		a.mux, err = listenDSCP(a.config.DSCP, a.includeInterface, a.includeIP)
+		if err != nil {
+			return nil, err
+		}
+
+		settingEngine.SetICEUDPMux(a.mux)
+	}
+	options := []func(*webrtc.API){webrtc.WithSettingEngine(settingEngine)}
 
 	ids := make(chan string)
 
+	if a.config.MediaEngine != nil {
+		registry := &interceptor.Registry{}
+		if err := webrtc.RegisterDefaultInterceptors(a.config.MediaEngine, registry); err != nil {
+			return ids, err
+		}
+
+		options = append(options, webrtc.WithMediaEngine(a.config.MediaEngine), webrtc.WithInterceptorRegistry(registry))
+	}
+
+	a.api = webrtc.NewAPI(options...)
+
 	u, err := url.Parse(a.signaler)
 	if err != nil {
 		return ids, err
 	}
 
-	community := u.Query().Get("community")
+	// Map the joined communities to their keys
+	communities := map[string]string{
+		u.Query().Get("community"): a.key,
+	}
 
-	iceServers := []webrtc.ICEServer{}
+	// Messages of adapters which joined multiple communities are wrapped in envelopes
+	multiplexed := len(a.config.Communities) > 0
+	if multiplexed {
+		q := u.Query()
+		for _, community := range a.config.Communities {
+			if _, ok := communities[community.ID]; ok {
+				return ids, ErrDuplicateCommunity
+			}
 
-	containsTURN := false
-	for _, ice := range a.ice {
-		// Skip empty server configs
-		if strings.TrimSpace(ice) == "" {
-			log.Trace().Msg("Skipping empty server config")
+			communities[community.ID] = community.Key
 
-			continue
+			q.Add("community", community.ID)
+			q.Add("password", community.Password)
 		}
+		u.RawQuery = q.Encode()
+	}
 
-		if strings.Contains(ice, "stun:") {
-			iceServers = append(iceServers, webrtc.ICEServer{
-				URLs: []string{ice},
-			})
-		} else {
-			addrParts := strings.Split(ice, "@")
-			if len(addrParts) < 2 {
-				return ids, ErrInvalidTURNServerAddr
-			}
+	providers := []ICEProvider{StaticICEProvider(a.ice)}
+	if strings.TrimSpace(a.config.ICEServersURL) != "" {
+		providers = append(providers, &RESTICEProvider{
+			URL:    a.config.ICEServersURL,
+			Method: a.config.ICEServersMethod,
+			Token:  a.config.ICEServersToken,
+			TTL:    a.config.ICEServersTTL,
+		})
+	}
+	providers = append(providers, a.config.ICEProviders...)
 
-			authParts := strings.Split(addrParts[0], ":")
-			if len(addrParts) < 2 {
-				return ids, ErrMissingTURNCredentials
-			}
+	a.providedICEServers = make([][]webrtc.ICEServer, len(providers))
 
-			iceServers = append(iceServers, webrtc.ICEServer{
-				URLs:           []string{addrParts[1]},
-				Username:       authParts[0],
-				Credential:     authParts[1],
-				CredentialType: webrtc.ICECredentialTypePassword,
-			})
+	containsTURN := false
+	for i, provider := range providers {
+		iceServers, next, err := provider.ICEServers(a.ctx)
+		if err != nil {
+			return ids, err
+		}
+		a.setICEServers(i, iceServers)
+
+		containsTURN = containsTURN || containsTURNServer(iceServers)
 
-			containsTURN = true
+		if next > 0 {
+			i, provider, next := i, provider, next
+			a.spawn(func() {
+				a.refreshICEServers(i, provider, next)
+			})
 		}
 	}
 
@@ -164,163 +584,1554 @@ func (a *Adapter) Open() (chan string, error) {
 		return ids, ErrMissingForcedTURNServer
 	}
 
-	go func() {
-		for {
-			if a.done {
-				return
-			}
-
-			peers := map[string]*peer{}
-			var peerLock sync.Mutex
+	if a.config.MeshDegree > 0 {
+		a.mesh.channels = a.channels
+		a.channels = append(append([]string{}, a.channels...), services.MeshPrimary)
 
-			func() {
-				defer func() {
-					if err := recover(); err != nil {
-						log.Debug().Str("address", u.String()).Err(err.(error)).Msg("Closed connection to signaler (wrong username or password?)")
-					}
+		a.mesh.open = func(community string, peerID string, name string, channelID string, conn *relayConn, close func(reason string) error) {
+			p := &Peer{peerID, name, channelID, a.secure(conn, communities[community]), nil, community, true, close}
+			a.auditChannel(p)
 
-					log.Debug().Str("address", u.String()).Dur("timeout", a.config.Timeout).Msg("Reconnecting to signaler")
+			go a.router.deliver(a.ctx, p)
+		}
 
-					if a.config.OnSignalerReconnect != nil {
-						a.config.OnSignalerReconnect()
+		meshPeers := a.router.accept(services.MeshPrimary)
+		a.spawn(func() {
+			for {
+				select {
+				case <-a.ctx.Done():
+					return
+				case p := <-meshPeers:
+					// Relayed peers don't have a round-trip time which is comparable to direct connections
+					if p.Relayed {
+						_ = p.Conn.Close()
+
+						continue
 					}
 
-					time.Sleep(a.config.Timeout)
-				}()
-
-				ctx, cancel := context.WithTimeout(a.ctx, a.config.Timeout)
-				defer cancel()
-
-				conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
-				if err != nil {
-					panic(err)
+					a.mesh.add(p)
 				}
+			}
+		})
 
-				defer func() {
-					log.Debug().Str("address", u.String()).Msg("Disconnected from signaler")
+		a.spawn(func() {
+			a.mesh.run(a.ctx)
+		})
+	}
 
-					if err := conn.Close(); err != nil {
-						panic(err)
+	if a.config.Gossip {
+		a.channels = append(append([]string{}, a.channels...), services.GossipPrimary)
+
+		gossipPeers := a.router.accept(services.GossipPrimary)
+		a.spawn(func() {
+			for {
+				select {
+				case <-a.ctx.Done():
+					return
+				case p := <-gossipPeers:
+					// Relayed peers depend on the signaler, so they can't relay signaling messages
+					if p.Relayed {
+						_ = p.Conn.Close()
+
+						continue
 					}
 
-					peerLock.Lock()
-					defer peerLock.Unlock()
+					a.gossip.add(p)
+				}
+			}
+		})
 
-					for _, peer := range peers {
-						for _, channel := range peer.channels {
-							if err := channel.Close(); err != nil {
-								panic(err)
-							}
-						}
+		a.spawn(func() {
+			a.gossip.run(a.ctx)
+		})
+	}
 
-						if err := peer.conn.Close(); err != nil {
-							panic(err)
-						}
+	if len(a.config.AdaptiveChannels) > 0 || a.config.OnPeerQualityChange != nil {
+		a.adaptive = newAdaptiveManager(a.config.AdaptiveChannels, a.config.QualityInterval, a.config.AdaptiveLatency, a.config.OnPeerQualityChange)
+
+		for _, label := range a.adaptive.labels() {
+			a.channels = append(append([]string{}, a.channels...), label)
 
-						close(peer.candidates)
+			// Internal channels of direct connections are taken over before they are delivered, so only relayed ones arrive here
+			internalPeers := a.router.accept(label)
+			a.spawn(func() {
+				for {
+					select {
+					case <-a.ctx.Done():
+						return
+					case p := <-internalPeers:
+						_ = p.Conn.Close()
 					}
-				}()
+				}
+			})
+		}
+	}
 
-				if err := conn.SetReadDeadline(time.Now().Add(a.config.Timeout)); err != nil {
-					panic(err)
+	if a.config.ChannelBindings {
+		a.channels = append(append([]string{}, a.channels...), services.BindingPrimary)
+
+		// Binding channels of direct connections are taken over before they are delivered, so only relayed ones arrive here
+		bindingPeers := a.router.accept(services.BindingPrimary)
+		a.spawn(func() {
+			for {
+				select {
+				case <-a.ctx.Done():
+					return
+				case p := <-bindingPeers:
+					_ = p.Conn.Close()
 				}
-				conn.SetPongHandler(func(string) error {
-					return conn.SetReadDeadline(time.Now().Add(a.config.Timeout))
-				})
+			}
+		})
+	}
 
-				log.Debug().Str("address", u.String()).Msg("Connected to signaler")
+	// The ID and peers are kept across reconnects to the signaler so that established connections stay alive
+	id := a.config.ID
+	if strings.TrimSpace(id) == "" && strings.TrimSpace(a.config.IDFile) != "" {
+		identity, err := LoadOrCreateIdentity(a.config.IDFile)
+		if err != nil {
+			return ids, err
+		}
 
-				inputs := make(chan []byte)
-				errs := make(chan error)
-				go func() {
-					defer func() {
-						close(inputs)
-						close(errs)
-					}()
+		id = identity.ID
+	}
 
-					for {
-						_, p, err := conn.ReadMessage()
-						if err != nil {
-							errs <- err
+	if strings.TrimSpace(id) == "" {
+		id = uuid.New().String()
+	}
+	a.gossip.setID(id)
+	a.mesh.setID(id)
 
-							return
-						}
+	// Adapters which use selective signaling always wrap messages in envelopes, which contain the recipient in plaintext
+	if a.config.SelectiveSignaling {
+		multiplexed = true
 
-						inputs <- p
-					}
-				}()
+		q := u.Query()
+		q.Set("id", id)
+		u.RawQuery = q.Encode()
+	}
 
-				id := a.config.ID
-				if strings.TrimSpace(id) == "" {
-					id = uuid.New().String()
-				}
+	// Peers which are restarted with a fixed ID introduce themselves with a new session
+	session := uuid.NewString()
 
-				ids <- id
+	peers := map[string]map[string]*peer{}
+	for community := range communities {
+		peers[community] = map[string]*peer{}
+	}
+	var peerLock sync.Mutex
 
-				go func() {
-					p, err := json.Marshal(websocketapi.NewIntroduction(id))
-					if err != nil {
-						errs <- err
+	a.mesh.lock.Lock()
+	a.mesh.connecting = func(community string, peerID string) bool {
+		peerLock.Lock()
+		defer peerLock.Unlock()
 
-						return
-					}
+		_, ok := peers[community][peerID]
 
-					a.sendLine(p)
+		return ok
+	}
+	a.mesh.lock.Unlock()
 
-					log.Debug().Str("address", u.String()).Str("id", id).Msg("Introduced to signaler")
-				}()
+	// Peers which have been connected to are cached, so that they can be sent an offer immediately after a restart
+	if strings.TrimSpace(a.config.PeerCacheFile) != "" {
+		cache, err := loadPeerCache(a.config.PeerCacheFile)
+		if err != nil {
+			return ids, err
+		}
 
-				pings := time.NewTicker(a.config.Timeout / 2)
-				defer pings.Stop()
+		a.cache = cache
+	}
+	var reconnectCached sync.Once
 
-				for {
-					select {
-					case err := <-errs:
-						panic(err)
-					case input := <-inputs:
-						input, err = encryption.Decrypt(input, []byte(a.key))
-						if err != nil {
-							log.Debug().
-								Str("address", conn.RemoteAddr().String()).
-								Int("len", len(input)).
-								Str("community", community).
-								Str("id", id).Msg("Could not decrypt message from signaler, continuing")
+	cachePeer := func(community string, peerID string, iid string) {
+		if a.cache == nil {
+			return
+		}
 
-							continue
-						}
+		peerLock.Lock()
+		pr, ok := peers[community][peerID]
+		if !ok || pr.iid != iid {
+			peerLock.Unlock()
 
-						log.Trace().
-							Str("address", conn.RemoteAddr().String()).
-							Int("len", len(input)).
-							Str("community", community).
-							Str("id", id).Msg("Received message from signaler")
+			return
+		}
 
-						var message websocketapi.Message
-						if err := json.Unmarshal(input, &message); err != nil {
-							log.Debug().
-								Str("address", conn.RemoteAddr().String()).
-								Str("community", community).
-								Str("id", id).Msg("Could not unmarshal message from signaler, continuing")
+		cp := cachedPeer{community, peerID, pr.session, pr.name, pr.metadata, append([]string{}, pr.remoteCandidates...), time.Now()}
+		peerLock.Unlock()
 
-							continue
-						}
+		if err := a.cache.put(cp); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not cache peer, continuing")
+		}
+	}
 
-						switch message.Type {
-						case websocketapi.TypeIntroduction:
-							var introduction websocketapi.Introduction
-							if err := json.Unmarshal(input, &introduction); err != nil {
-								log.Debug().
-									Str("address", conn.RemoteAddr().String()).
-									Str("community", community).
-									Str("id", id).Msg("Could not unmarshal introduction from signaler, continuing")
+	markConnected := func(community string, peerID string, iid string) {
+		peerLock.Lock()
+		defer peerLock.Unlock()
 
-								continue
-							}
+		if pr, ok := peers[community][peerID]; ok && pr.iid == iid && pr.connectedAt.IsZero() {
+			pr.connectedAt = time.Now()
+		}
+	}
 
-							log.Debug().
-								Str("address", conn.RemoteAddr().String()).
+	// Sessions are recorded before the connection is closed, so that its stats can still be read; must be called with the peer lock held
+	recordSession := func(community string, peerID string, pr *peer, reason string) {
+		if a.config.Sessions == nil {
+			return
+		}
+
+		session := wrtcsess.Session{
+			Community: community,
+			PeerID:    peerID,
+			Name:      pr.name,
+			Start:     pr.createdAt,
+			End:       time.Now(),
+			Relayed:   len(pr.relays) > 0,
+			Reason:    reason,
+		}
+
+		if !pr.connectedAt.IsZero() {
+			connectedAt := pr.connectedAt
+			session.ConnectedAt = &connectedAt
+		}
+
+		report := pr.conn.GetStats()
+		session.BytesSent, session.BytesReceived = getTransferredBytes(report)
+		session.LocalCandidate, session.RemoteCandidate = getCandidateTypes(report)
+
+		// Sessions are written without holding the peer lock; the adapter waits for them to be written once it is closed
+		a.spawn(func() {
+			if err := a.config.Sessions.Add(session); err != nil {
+				log.Debug().Err(err).Str("peerID", peerID).Msg("Could not record session, continuing")
+			}
+		})
+	}
+
+	// Candidates of cached peers are added as soon as the remote description has been set, before the peer has sent its current ones
+	addCachedCandidates := func(community string, peerID string, c *webrtc.PeerConnection) {
+		for _, candidate := range a.cache.candidates(community, peerID) {
+			if err := c.AddICECandidate(webrtc.ICECandidateInit{Candidate: candidate}); err != nil {
+				log.Debug().Err(err).Str("peerID", peerID).Msg("Could not add cached ICE candidate, continuing")
+
+				continue
+			}
+
+			log.Trace().Str("peerID", peerID).Str("community", community).Msg("Added cached ICE candidate")
+		}
+	}
+
+	// Peers can be closed by the application, in which case the remote peer is told why
+	closer := func(community string, peerID string, pr *peer) func(reason string) error {
+		return func(reason string) error {
+			if strings.TrimSpace(reason) == "" {
+				reason = ReasonClosed
+			}
+
+			peerLock.Lock()
+			if current, ok := peers[community][peerID]; !ok || current != pr {
+				peerLock.Unlock()
+
+				return nil
+			}
+
+			recordSession(community, peerID, pr, reason)
+			pr.close()
+
+			delete(peers[community], peerID)
+			peerLock.Unlock()
+
+			log.Debug().Str("community", community).Str("peerID", peerID).Str("reason", reason).Msg("Closed connection to peer")
+
+			a.events.publish(community, peerID, PeerStateClosed, reason)
+
+			go a.sendMessage(community, peerID, websocketapi.NewGoodbye(id, peerID, reason))
+
+			return nil
+		}
+	}
+
+	// Relay a channel through a data relay; must be called with the peer lock held
+	var openDataRelay func(community string, peerID string, pr *peer, channelID string) *relayConn
+	if len(a.config.DataRelays) > 0 {
+		openDataRelay = func(community string, peerID string, pr *peer, channelID string) *relayConn {
+			if relay, ok := pr.relays[channelID]; ok {
+				return relay
+			}
+
+			var relay *relayConn
+			relay = newRelayConn(
+				-1,
+				PathDataRelay,
+				func(p []byte) error {
+					return a.dataRelay.send(community, peerID, channelID, p)
+				},
+				func() {
+					peerLock.Lock()
+					if current, ok := peers[community][peerID]; ok && current.relays[channelID] == relay {
+						delete(current.relays, channelID)
+					}
+					peerLock.Unlock()
+
+					if err := a.dataRelay.sendClose(community, peerID, channelID); err != nil {
+						log.Debug().Err(err).Str("peerID", peerID).Str("channelID", channelID).Msg("Could not send relay close, continuing")
+					}
+				},
+			)
+			pr.relays[channelID] = relay
+
+			log.Debug().
+				Str("community", community).
+				Str("peerID", peerID).
+				Str("channelID", channelID).
+				Msg("Relaying channel through data relay")
+
+			if pr.connectedAt.IsZero() {
+				pr.connectedAt = time.Now()
+			}
+
+			p := &Peer{peerID, pr.name, channelID, a.secure(relay, communities[community]), pr.metadata, community, true, closer(community, peerID, pr)}
+			a.auditChannel(p)
+
+			go a.router.deliver(pr.ctx, p)
+
+			return relay
+		}
+
+		a.dataRelay = newDataRelay(a.config.DataRelays, a.config.DataRelayToken, id, communities, a.config.Timeout, a.config.IPFamily, a.config.BinarySignaling, a.cipher, a.ctx, func(community string, relay *websocketapi.Relay) {
+			peerLock.Lock()
+			pr, ok := peers[community][relay.From]
+			if !ok {
+				peerLock.Unlock()
+
+				log.Debug().Str("peerID", relay.From).Msg("Could not find connection for peer, continuing")
+
+				return
+			}
+
+			rc, ok := pr.relays[relay.Channel]
+			if relay.Type == websocketapi.TypeRelayClose {
+				if ok {
+					delete(pr.relays, relay.Channel)
+				}
+				peerLock.Unlock()
+
+				if ok {
+					rc.closeLocal()
+
+					log.Debug().
+						Str("peerID", relay.From).
+						Str("channelID", relay.Channel).
+						Msg("Peer closed relayed channel")
+				}
+
+				return
+			}
+
+			// The remote peer can detect the failed connection before this adapter does
+			if !ok {
+				if !a.hasChannel(relay.Channel) {
+					peerLock.Unlock()
+
+					log.Debug().
+						Str("peerID", relay.From).
+						Str("channelID", relay.Channel).
+						Msg("Discarding relayed payload because the channel is unknown, continuing")
+
+					return
+				}
+
+				rc = openDataRelay(community, relay.From, pr, relay.Channel)
+			}
+			peerLock.Unlock()
+
+			if !rc.deliver(relay.Payload) {
+				log.Debug().
+					Str("peerID", relay.From).
+					Str("channelID", relay.Channel).
+					Msg("Could not deliver relayed payload because the channel's queue is full, dropping")
+			}
+		})
+		a.dataRelay.open(a.spawn)
+	}
+
+	a.listsLock.Lock()
+	a.closeDisallowed = func() {
+		peerLock.Lock()
+		defer peerLock.Unlock()
+
+		for community := range peers {
+			for peerID, pr := range peers[community] {
+				if a.IsPeerAllowed(peerID) {
+					continue
+				}
+
+				log.Debug().Str("peerID", peerID).Str("community", community).Msg("Disconnecting from peer which is no longer allowed")
+
+				recordSession(community, peerID, pr, ReasonNotAllowed)
+				pr.close()
+
+				delete(peers[community], peerID)
+
+				a.events.publish(community, peerID, PeerStateClosed, ReasonNotAllowed)
+			}
+		}
+	}
+	a.listsLock.Unlock()
+
+	a.mailLock.Lock()
+	a.sendMail = func(community string, to string, payload []byte) error {
+		if _, ok := communities[community]; !ok {
+			return ErrUnknownCommunity
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return a.ctx.Err()
+		case a.lines <- line{community, to, nil, websocketapi.NewMail(id, to, payload, time.Now().Unix()), true}:
+		}
+
+		return nil
+	}
+	a.mailLock.Unlock()
+
+	a.pathsLock.Lock()
+	a.paths = func() []PeerPath {
+		peerLock.Lock()
+		defer peerLock.Unlock()
+
+		paths := []PeerPath{}
+		for community := range peers {
+			for peerID, pr := range peers[community] {
+				if pr.path == "" {
+					continue
+				}
+
+				paths = append(paths, PeerPath{community, peerID, pr.path})
+			}
+		}
+
+		return paths
+	}
+	a.pathsLock.Unlock()
+
+	a.transportsLock.Lock()
+	a.getTransport = func(community string, peerID string) (*webrtc.DTLSTransport, *bindingPeer) {
+		peerLock.Lock()
+		defer peerLock.Unlock()
+
+		pr, ok := peers[community][peerID]
+		if !ok || len(pr.relays) > 0 {
+			return nil, nil
+		}
+
+		return pr.conn.SCTP().Transport(), pr.binding
+	}
+	a.transportsLock.Unlock()
+
+	if a.config.Stats != nil {
+		a.config.Stats.AddSource(func() []wrtcstats.Sample {
+			if a.ctx.Err() != nil {
+				return nil
+			}
+
+			return a.sampleStats(peers, &peerLock)
+		})
+	}
+
+	a.spawn(func() {
+		// Peers which have been kept across reconnects to the signaler are only closed once the adapter is closed
+		defer func() {
+			peerLock.Lock()
+			defer peerLock.Unlock()
+
+			for community, communityPeers := range peers {
+				for peerID, peer := range communityPeers {
+					recordSession(community, peerID, peer, ReasonAdapterClosed)
+					peer.close()
+
+					delete(communityPeers, peerID)
+
+					a.events.publish(community, peerID, PeerStateClosed, ReasonAdapterClosed)
+				}
+			}
+		}()
+
+		// Permanent rejections (i.e. a wrong password) can't be resolved by reconnecting
+		denied := false
+
+		for {
+			if a.ctx.Err() != nil || denied {
+				return
+			}
+
+			func() {
+				defer func() {
+					draining := false
+					if err := recover(); err != nil {
+						rejection := getRejection(err.(error), nil)
+
+						// Signalers which are draining disconnect their clients so that they reconnect to another signaler, so there is no need to wait; handshakes which are rejected while draining are retried after the timeout
+						if websocket.IsCloseError(err.(error), websocketapi.CloseDraining) {
+							draining = true
+
+							log.Debug().Str("address", u.String()).Msg("Signaler is draining, reconnecting")
+						} else {
+							log.Debug().Str("address", u.String()).Err(rejection).Msg("Closed connection to signaler")
+						}
+
+						if a.config.OnSignalerDisconnect != nil && a.ctx.Err() == nil {
+							a.config.OnSignalerDisconnect(rejection)
+						}
+
+						if isPermanentRejection(rejection) && a.ctx.Err() == nil {
+							denied = true
+
+							log.Error().Str("address", u.String()).Err(rejection).Msg("Signaler denied permission, stopping")
+
+							select {
+							case <-a.ctx.Done():
+							case a.errs <- ErrPermissionDenied:
+							}
+
+							return
+						}
+					}
+
+					if a.ctx.Err() != nil {
+						return
+					}
+
+					log.Debug().Str("address", u.String()).Dur("timeout", a.config.Timeout).Msg("Reconnecting to signaler")
+
+					if a.config.OnSignalerReconnect != nil {
+						a.config.OnSignalerReconnect()
+					}
+
+					if draining {
+						return
+					}
+
+					select {
+					case <-a.ctx.Done():
+					case <-time.After(a.config.Timeout):
+					}
+				}()
+
+				dial := func() (signalingConn, error) {
+					ctx, cancel := context.WithTimeout(a.ctx, a.config.Timeout)
+					defer cancel()
+
+					dialer := NewWebSocketDialer(a.config.IPFamily)
+					dialer.EnableCompression = a.config.Compression
+
+					versions := []string{}
+					if a.config.BinarySignaling {
+						versions = websocketapi.Versions
+					}
+					dialer.Subprotocols = versions
+
+					// Signalers which shard communities across replicas redirect to the replica which owns the community; it is looked up again on every reconnect, so that clients follow changes to the fleet
+					target := u.String()
+					for redirects := 0; ; redirects++ {
+						var (
+							conn signalingConn
+							res  *http.Response
+							err  error
+						)
+						if u.Scheme == webtransport.Scheme {
+							conn, res, err = dialWebTransport(ctx, target, a.getHeader(), versions, a.config.IPFamily)
+						} else {
+							conn, res, err = dialWebSocket(ctx, dialer, target, a.getHeader())
+						}
+
+						if location := getRedirect(res, u.Scheme); err == websocket.ErrBadHandshake && location != nil && redirects < maxSignalerRedirects {
+							log.Debug().Str("address", u.Host).Str("replica", location.Host).Msg("Redirected to signaler replica")
+
+							target = location.String()
+
+							continue
+						}
+
+						return conn, getRejection(err, res)
+					}
+				}
+
+				var conn signalingConn
+				gossiping := false
+				if c, err := dial(); err == nil {
+					conn = c
+				} else {
+					// Relaying signaling messages through peers doesn't help if the signaler has rejected the adapter
+					if isRejection(err) || !a.config.Gossip || a.gossip.neighbourCount() == 0 {
+						panic(err)
+					}
+
+					log.Debug().Err(err).Str("address", u.String()).Msg("Could not connect to signaler, relaying signaling messages through peers")
+
+					version := websocketapi.VersionJSON
+					if a.config.BinarySignaling {
+						version = websocketapi.VersionBinary
+					}
+
+					conn = newGossipConn(a.gossip, version, multiplexed, u.Query().Get("community"), a.config.Timeout, func() bool {
+						c, err := dial()
+						if err != nil {
+							return false
+						}
+
+						_ = c.Close()
+
+						return true
+					})
+					gossiping = true
+				}
+
+				// Signalers which don't support version negotiation always use JSON
+				version := conn.Subprotocol()
+				messageType := websocket.BinaryMessage
+				if version != websocketapi.VersionBinary {
+					version = websocketapi.VersionJSON
+					messageType = websocket.TextMessage
+				}
+
+				// Messages to peers are end-to-end encrypted, so the signaler can't re-encode them; they are only encoded as CBOR if both this adapter and the peer use the binary signaling protocol, which peers advertise in their introductions, so that peers which only support JSON can always decode them
+				var supportedVersions []string
+				if version == websocketapi.VersionBinary {
+					supportedVersions = websocketapi.Versions
+				}
+
+				var peerVersionsLock sync.Mutex
+				peerVersions := map[string]string{}
+
+				getVersion := func(peerID string) string {
+					// Messages without a recipient are received by every peer in the community
+					if version != websocketapi.VersionBinary || peerID == "" {
+						return websocketapi.VersionJSON
+					}
+
+					peerVersionsLock.Lock()
+					defer peerVersionsLock.Unlock()
+
+					if v, ok := peerVersions[peerID]; ok {
+						return v
+					}
+
+					return websocketapi.VersionJSON
+				}
+
+				setVersion := func(peerID string, versions []string) {
+					for _, v := range versions {
+						if v == websocketapi.VersionBinary {
+							peerVersionsLock.Lock()
+							peerVersions[peerID] = v
+							peerVersionsLock.Unlock()
+
+							return
+						}
+					}
+				}
+
+				// The goroutines of this connection are stopped before reconnecting, so that they can't send to the next one
+				cctx, ccancel := context.WithCancel(a.ctx)
+				var reader sync.WaitGroup
+
+				defer func() {
+					log.Debug().Str("address", u.String()).Msg("Disconnected from signaler")
+
+					ccancel()
+
+					// Closing the connection unblocks the reader
+					if err := conn.Close(); err != nil {
+						panic(err)
+					}
+
+					reader.Wait()
+
+					peerLock.Lock()
+					defer peerLock.Unlock()
+
+					reason := ReasonSignalerDisconnected
+					if a.ctx.Err() != nil {
+						reason = ReasonAdapterClosed
+					}
+
+					for community, communityPeers := range peers {
+						for peerID, peer := range communityPeers {
+							// The data path doesn't depend on the signaler, so only peers which aren't connected yet or are relayed are disconnected
+							if a.ctx.Err() == nil && peer.connected() {
+								log.Debug().Str("peerID", peerID).Msg("Keeping connection to peer across reconnect to signaler")
+
+								continue
+							}
+
+							recordSession(community, peerID, peer, reason)
+							peer.close()
+
+							delete(communityPeers, peerID)
+
+							a.events.publish(community, peerID, PeerStateClosed, reason)
+						}
+					}
+				}()
+
+				if err := conn.SetReadDeadline(time.Now().Add(a.config.Timeout)); err != nil {
+					panic(err)
+				}
+				conn.SetPongHandler(func(string) error {
+					return conn.SetReadDeadline(time.Now().Add(a.config.Timeout))
+				})
+
+				log.Debug().Str("address", u.String()).Str("version", version).Msg("Connected to signaler")
+
+				inputs := make(chan []byte)
+				errs := make(chan error)
+				reader.Add(1)
+				go func() {
+					defer reader.Done()
+
+					for {
+						_, p, err := conn.ReadMessage()
+						if err != nil {
+							select {
+							case <-cctx.Done():
+							case errs <- err:
+							}
+
+							return
+						}
+
+						select {
+						case <-cctx.Done():
+							return
+						case inputs <- p:
+						}
+					}
+				}()
+
+				// The adapter hasn't connected to the signaler if it is only gossiping
+				if !gossiping {
+					select {
+					case <-a.ctx.Done():
+						return
+					case ids <- id:
+					}
+				}
+
+				sendRenegotiationOffer := func(c *webrtc.PeerConnection, community string, peerID string, options *webrtc.OfferOptions) {
+					o, err := c.CreateOffer(options)
+					if err != nil {
+						log.Debug().Err(err).Str("peerID", peerID).Msg("Could not create renegotiation offer, continuing")
+
+						return
+					}
+					o = a.mungeLocalDescription(community, peerID, o)
+
+					if err := c.SetLocalDescription(o); err != nil {
+						log.Debug().Err(err).Str("peerID", peerID).Msg("Could not set renegotiation offer, continuing")
+
+						return
+					}
+
+					oj, err := json.Marshal(o)
+					if err != nil {
+						panic(err)
+					}
+
+					p, err := websocketapi.Marshal(getVersion(peerID), websocketapi.NewRenegotiationOffer(id, peerID, oj))
+					if err != nil {
+						panic(err)
+					}
+
+					go func() {
+						a.sendLine(community, peerID, p)
+
+						log.Debug().
+							Str("address", conn.RemoteAddr().String()).
+							Str("community", community).
+							Str("id", id).
+							Str("client", peerID).
+							Msg("Sent renegotiation offer to signaler")
+					}()
+				}
+
+				// Start a new offer/answer exchange when tracks or channels are added to an established connection
+				renegotiate := func(c *webrtc.PeerConnection, community string, peerID string) {
+					c.OnNegotiationNeeded(func() {
+						// The initial offer/answer exchange is started by the introduction
+						if c.CurrentRemoteDescription() == nil {
+							return
+						}
+
+						sendRenegotiationOffer(c, community, peerID, nil)
+					})
+				}
+
+				// Track the path of the connection to each peer and try to upgrade connections which are relayed through TURN servers to direct ones
+				checkPaths := func() {
+					type pathCheck struct {
+						community string
+						peerID    string
+						pr        *peer
+						conn      *webrtc.PeerConnection
+						relayPath string // Path of the relayed channels (empty if no channels are relayed)
+					}
+
+					// Collecting stats can take a while, so it is done without holding the lock
+					checks := []pathCheck{}
+					peerLock.Lock()
+					for community := range peers {
+						for peerID, pr := range peers[community] {
+							relayPath := ""
+							for _, relay := range pr.relays {
+								relayPath = relay.path
+							}
+
+							checks = append(checks, pathCheck{community, peerID, pr, pr.conn, relayPath})
+						}
+					}
+					peerLock.Unlock()
+
+					for _, check := range checks {
+						path := check.relayPath
+						if path == "" {
+							path = getPath(check.conn.GetStats())
+						}
+
+						if path == "" {
+							continue
+						}
+
+						peerLock.Lock()
+						changed := check.pr.path != path
+						if changed && path == PathRelay {
+							check.pr.upgradedAt = time.Now()
+						}
+						check.pr.path = path
+
+						// Only the peer with the lower ID restarts ICE, so that both peers don't send offers at the same time
+						upgrade := path == PathRelay &&
+							a.config.UpgradeInterval > 0 &&
+							!a.config.ForceRelay &&
+							id < check.peerID &&
+							time.Since(check.pr.upgradedAt) >= a.config.UpgradeInterval &&
+							check.conn.SignalingState() == webrtc.SignalingStateStable
+						if upgrade {
+							check.pr.upgradedAt = time.Now()
+						}
+						peerLock.Unlock()
+
+						if changed {
+							if path == PathRelay || path == PathSignaler || path == PathDataRelay {
+								log.Debug().Str("community", check.community).Str("peerID", check.peerID).Str("path", path).Msg("Connection to peer is relayed")
+							} else {
+								log.Debug().Str("community", check.community).Str("peerID", check.peerID).Str("path", path).Msg("Connection to peer is direct")
+							}
+
+							if a.config.OnPeerPathChange != nil {
+								a.config.OnPeerPathChange(check.community, check.peerID, path)
+							}
+						}
+
+						if upgrade {
+							log.Debug().Str("community", check.community).Str("peerID", check.peerID).Msg("Restarting ICE to try and upgrade relayed connection to a direct one")
+
+							a.events.publish(check.community, check.peerID, PeerStateReconnecting, ReasonICERestart)
+
+							sendRenegotiationOffer(check.conn, check.community, check.peerID, &webrtc.OfferOptions{ICERestart: true})
+						}
+					}
+				}
+
+				// Relay a channel through the signaler; must be called with the peer lock held
+				openRelay := func(community string, peerID string, pr *peer, channelID string) *relayConn {
+					if relay, ok := pr.relays[channelID]; ok {
+						return relay
+					}
+
+					var relay *relayConn
+					relay = newRelayConn(
+						a.config.RelayRateLimit,
+						PathSignaler,
+						func(p []byte) error {
+							m, err := websocketapi.Marshal(getVersion(peerID), websocketapi.NewRelay(id, peerID, channelID, p))
+							if err != nil {
+								return err
+							}
+
+							a.sendLine(community, peerID, m)
+
+							return nil
+						},
+						func() {
+							peerLock.Lock()
+							if current, ok := peers[community][peerID]; ok && current.relays[channelID] == relay {
+								delete(current.relays, channelID)
+							}
+							peerLock.Unlock()
+
+							m, err := websocketapi.Marshal(getVersion(peerID), websocketapi.NewRelayClose(id, peerID, channelID))
+							if err != nil {
+								log.Debug().Err(err).Str("peerID", peerID).Str("channelID", channelID).Msg("Could not marshal relay close, continuing")
+
+								return
+							}
+
+							go a.sendLine(community, peerID, m)
+						},
+					)
+					pr.relays[channelID] = relay
+
+					log.Debug().
+						Str("address", conn.RemoteAddr().String()).
+						Str("community", community).
+						Str("peerID", peerID).
+						Str("channelID", channelID).
+						Msg("Relaying channel through signaler")
+
+					if pr.connectedAt.IsZero() {
+						pr.connectedAt = time.Now()
+					}
+
+					p := &Peer{peerID, pr.name, channelID, a.secure(relay, communities[community]), pr.metadata, community, true, closer(community, peerID, pr)}
+					a.auditChannel(p)
+
+					go a.router.deliver(pr.ctx, p)
+
+					return relay
+				}
+
+				// Fall back to relaying all channels through a data relay or the signaler if ICE has failed
+				fallback := func(community string, peerID string, iid string) {
+					peerLock.Lock()
+					defer peerLock.Unlock()
+
+					pr, ok := peers[community][peerID]
+					if !ok {
+						log.Debug().Str("peerID", peerID).Msg("Could not find connection for peer, continuing")
+
+						return
+					}
+
+					if pr.iid != iid {
+						log.Debug().Str("peerID", peerID).Msg("Peer already rejoined, not relaying")
+
+						return
+					}
+
+					for _, channelID := range a.channels {
+						// Skip empty channel IDs
+						if strings.TrimSpace(channelID) == "" {
+							continue
+						}
+
+						if openDataRelay != nil {
+							openDataRelay(community, peerID, pr, channelID)
+						} else {
+							openRelay(community, peerID, pr, channelID)
+						}
+					}
+
+					a.events.publish(community, peerID, PeerStateConnected, ReasonRelayed)
+				}
+
+				// Send an offer to a peer which has introduced itself; the returned channel is closed once the offer has been sent
+				sendOffer := func(community string, introduction websocketapi.Introduction, reason string) <-chan struct{} {
+					sent := make(chan struct{})
+					iid := uuid.NewString()
+
+					transportPolicy := webrtc.ICETransportPolicyAll
+					if a.config.ForceRelay {
+						transportPolicy = webrtc.ICETransportPolicyRelay
+					}
+
+					c, err := a.api.NewPeerConnection(webrtc.Configuration{
+						ICEServers:         a.getICEServers(),
+						ICETransportPolicy: transportPolicy,
+					})
+					if err != nil {
+						panic(err)
+					}
+
+					renegotiate(c, community, introduction.From)
+
+					if a.config.OnPeerConnectionCreated != nil {
+						a.config.OnPeerConnectionCreated(introduction.From, community, c)
+					}
+
+					c.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
+						switch pcs {
+						case webrtc.PeerConnectionStateConnecting:
+							a.events.publish(community, introduction.From, PeerStateConnecting, "")
+						case webrtc.PeerConnectionStateConnected:
+							a.events.publish(community, introduction.From, PeerStateConnected, "")
+
+							markConnected(community, introduction.From, iid)
+
+							cachePeer(community, introduction.From, iid)
+						case webrtc.PeerConnectionStateFailed:
+							a.events.publish(community, introduction.From, PeerStateFailed, ReasonICEFailed)
+						}
+
+						if pcs == webrtc.PeerConnectionStateFailed && (a.config.RelayFallback || openDataRelay != nil) {
+							log.Debug().Str("peerID", introduction.From).Msg("Could not establish direct connection to peer, relaying")
+
+							fallback(community, introduction.From, iid)
+
+							return
+						}
+
+						if pcs == webrtc.PeerConnectionStateDisconnected {
+							log.Debug().Str("peerID", introduction.From).Msg("Disconnected from peer")
+
+							peerLock.Lock()
+							defer peerLock.Unlock()
+
+							c, ok := peers[community][introduction.From]
+
+							if !ok {
+								log.Debug().Str("peerID", introduction.From).Msg("Could not find connection for peer, continuing")
+
+								return
+							}
+
+							if c.iid != iid {
+								log.Debug().Str("peerID", introduction.From).Msg("Peer already rejoined, not disconnecting")
+
+								return
+							}
+
+							recordSession(community, introduction.From, c, ReasonDisconnected)
+							c.close()
+
+							delete(peers[community], introduction.From)
+
+							a.events.publish(community, introduction.From, PeerStateClosed, ReasonDisconnected)
+						}
+					})
+
+					var sending sync.WaitGroup
+
+					c.OnICECandidate(func(i *webrtc.ICECandidate) {
+						if i != nil {
+							log.Trace().
+								Str("address", conn.RemoteAddr().String()).
+								Str("len", i.String()).
+								Str("community", community).
+								Str("id", id).Msg("Created ICE candidate")
+
+							p, err := websocketapi.Marshal(getVersion(introduction.From), websocketapi.NewCandidate(id, introduction.From, []byte(i.ToJSON().Candidate)))
+							if err != nil {
+								panic(err)
+							}
+
+							sending.Add(1)
+							go func() {
+								defer sending.Done()
+
+								a.sendLine(community, introduction.From, p)
+
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).
+									Str("client", introduction.From).
+									Msg("Sent ICE candidate to signaler")
+							}()
+						} else {
+							// Candidates are sent concurrently, so the end of candidates is only sent once all of them have been queued
+							go func() {
+								sending.Wait()
+
+								p, err := websocketapi.Marshal(getVersion(introduction.From), websocketapi.NewEndOfCandidates(id, introduction.From))
+								if err != nil {
+									panic(err)
+								}
+
+								a.sendLine(community, introduction.From, p)
+
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).
+									Str("client", introduction.From).
+									Msg("Sent end of candidates to signaler")
+							}()
+						}
+					})
+
+					for i, channelID := range a.channels {
+						// Skip empty channel IDs
+						if strings.TrimSpace(channelID) == "" {
+							continue
+						}
+
+						dc, err := c.CreateDataChannel(channelID, a.getDataChannelInit(channelID))
+						if err != nil {
+							panic(err)
+						}
+
+						log.Trace().
+							Str("address", conn.RemoteAddr().String()).
+							Str("community", community).
+							Str("channelID", channelID).
+							Msg("Created data channel")
+
+						dc.OnOpen(func() {
+							log.Debug().
+								Str("label", dc.Label()).
+								Str("peer", introduction.From).
+								Msg("Connected to channel")
+
+							c, err := a.detach(dc)
+							if err != nil {
+								panic(err)
+							}
+
+							for _, channel := range a.channels {
+								if dc.Label() == channel {
+									peerLock.Lock()
+									pr, ok := peers[community][introduction.From]
+									if !ok {
+										peerLock.Unlock()
+
+										_ = c.Close()
+
+										log.Debug().Str("peerID", introduction.From).Msg("Could not find peer, continuing")
+
+										break
+									}
+
+									pr.channels[dc.Label()] = dc
+									p := &Peer{introduction.From, introduction.Name, dc.Label(), a.secure(c, communities[community]), introduction.Metadata, community, false, closer(community, introduction.From, pr)}
+									peerLock.Unlock()
+
+									a.auditChannel(p)
+
+									if p = pr.binding.add(a.adaptive.add(pr, p)); p != nil {
+										a.router.deliver(pr.ctx, p)
+									}
+
+									break
+								}
+							}
+						})
+
+						dc.OnClose(func() {
+							log.Debug().
+								Str("label", dc.Label()).
+								Str("peer", introduction.From).
+								Msg("Disconnected from channel")
+
+							peerLock.Lock()
+							defer peerLock.Unlock()
+							peer, ok := peers[community][introduction.From]
+							if !ok {
+								log.Debug().Str("peerID", introduction.From).Msg("Could not find peer, continuing")
+
+								return
+							}
+
+							channel, ok := peer.channels[dc.Label()]
+							if !ok {
+								log.Debug().
+									Str("peerID", introduction.From).
+									Str("channelID", dc.Label()).
+									Msg("Could not find channel, continuing")
+
+								return
+							}
+
+							if err := channel.Close(); err != nil {
+								log.Debug().Err(err).Str("channelID", dc.Label()).Msg("Could not close channel, continuing")
+							}
+
+							delete(peers[community][introduction.From].channels, dc.Label())
+						})
+
+						if i == 0 {
+							o, err := c.CreateOffer(nil)
+							if err != nil {
+								panic(err)
+							}
+							o = a.mungeLocalDescription(community, introduction.From, o)
+
+							if err := c.SetLocalDescription(o); err != nil {
+								panic(err)
+							}
+
+							oj, err := json.Marshal(o)
+							if err != nil {
+								panic(err)
+							}
+
+							p, err := websocketapi.Marshal(getVersion(introduction.From), websocketapi.NewOffer(id, introduction.From, session, a.config.Name, oj, a.config.Metadata))
+							if err != nil {
+								panic(err)
+							}
+
+							pr := newPeer(a.ctx, c, map[string]*webrtc.DataChannel{
+								dc.Label(): dc,
+							}, iid, introduction.Metadata, introduction.Session, introduction.Name)
+
+							peerLock.Lock()
+							old, ok := peers[community][introduction.From]
+							if ok {
+								// Disconnect the old peer
+								log.Debug().Str("peerID", introduction.From).Msg("Disconnected from peer")
+
+								recordSession(community, introduction.From, old, ReasonRestarted)
+								old.close()
+
+								a.events.publish(community, introduction.From, PeerStateReconnecting, ReasonRestarted)
+							}
+							peers[community][introduction.From] = pr
+							peerLock.Unlock()
+
+							a.events.publish(community, introduction.From, PeerStateGathering, reason)
+
+							go func() {
+								defer close(sent)
+
+								a.sendLine(community, introduction.From, p)
+
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).
+									Str("client", introduction.From).
+									Msg("Sent offer to signaler")
+							}()
+						}
+					}
+
+					return sent
+				}
+
+				a.spawn(func() {
+					p, err := websocketapi.Marshal(getVersion(""), websocketapi.NewIntroduction(id, session, a.config.Name, a.config.Negotiation, a.config.Metadata, supportedVersions))
+					if err != nil {
+						select {
+						case <-cctx.Done():
+						case errs <- err:
+						}
+
+						return
+					}
+
+					// Offers to cached peers are sent before the introduction, so that peers which are still running answer them instead of sending their own offers
+					reconnectCached.Do(func() {
+						if !canOffer(a.config.Negotiation) {
+							return
+						}
+
+						for community := range communities {
+							for _, cached := range a.cache.list(community) {
+								if !a.IsPeerAllowed(cached.PeerID) {
+									continue
+								}
+
+								peerLock.Lock()
+								_, ok := peers[community][cached.PeerID]
+								peerLock.Unlock()
+
+								if ok {
+									continue
+								}
+
+								log.Debug().Str("community", community).Str("peerID", cached.PeerID).Msg("Reconnecting to cached peer")
+
+								select {
+								case <-sendOffer(community, websocketapi.Introduction{From: cached.PeerID, Metadata: cached.Metadata, Session: cached.Session, Name: cached.Name}, ReasonCached):
+								case <-time.After(a.config.Timeout):
+								}
+
+								// Cached peers which don't answer (i.e. because they have been stopped) are removed again, so that they can be introduced to normally
+								community, cached := community, cached
+								a.spawn(func() {
+									select {
+									case <-a.ctx.Done():
+										return
+									case <-time.After(a.config.Timeout):
+									}
+
+									peerLock.Lock()
+									defer peerLock.Unlock()
+
+									pr, ok := peers[community][cached.PeerID]
+									if !ok || pr.session != cached.Session || pr.conn.RemoteDescription() != nil {
+										return
+									}
+
+									log.Debug().Str("community", community).Str("peerID", cached.PeerID).Msg("Cached peer did not answer, continuing")
+
+									recordSession(community, cached.PeerID, pr, ReasonNoAnswer)
+									pr.close()
+
+									delete(peers[community], cached.PeerID)
+
+									a.events.publish(community, cached.PeerID, PeerStateClosed, ReasonNoAnswer)
+								})
+							}
+						}
+					})
+
+					for community := range communities {
+						a.sendLine(community, "", p)
+
+						log.Debug().Str("address", u.String()).Str("community", community).Str("id", id).Msg("Introduced to signaler")
+					}
+				})
+
+				pings := time.NewTicker(a.config.Timeout / 2)
+				defer pings.Stop()
+
+				iceServersChanged := a.getICEServersChanged()
+
+				pathChecks := time.NewTicker(pathCheckInterval)
+				defer pathChecks.Stop()
+
+				// Peers which have been learned through gossip are introduced to while the signaler can't be reached, both when they have been learned and periodically in case the introduction has been discarded
+				var (
+					membersChanged chan struct{}
+					introductions  <-chan time.Time
+				)
+				if gossiping {
+					membersChanged = a.gossip.getMembersChanged()
+
+					t := time.NewTicker(a.gossip.interval)
+					defer t.Stop()
+
+					introductions = t.C
+				}
+
+				introduceMembers := func() {
+					p, err := websocketapi.Marshal(getVersion(""), websocketapi.NewIntroduction(id, session, a.config.Name, a.config.Negotiation, a.config.Metadata, supportedVersions))
+					if err != nil {
+						panic(err)
+					}
+
+					unknown := []Member{}
+					peerLock.Lock()
+					for _, member := range a.gossip.getMembers() {
+						if _, ok := peers[member.Community]; !ok {
+							continue
+						}
+
+						if _, ok := peers[member.Community][member.PeerID]; !ok {
+							unknown = append(unknown, member)
+						}
+					}
+					peerLock.Unlock()
+
+					for _, member := range unknown {
+						go func(member Member) {
+							a.sendLine(member.Community, member.PeerID, p)
+
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", member.Community).
+								Str("id", id).
+								Str("client", member.PeerID).
+								Msg("Introduced to peer which has been learned through gossip")
+						}(member)
+					}
+				}
+
+				for {
+					select {
+					case <-a.ctx.Done():
+						return
+					case err := <-errs:
+						panic(err)
+					case input := <-inputs:
+						community := u.Query().Get("community")
+						if multiplexed {
+							var envelope websocketapi.Envelope
+							if err := websocketapi.Unmarshal(input, &envelope); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("id", id).Msg("Could not unmarshal envelope from signaler, continuing")
+
+								continue
+							}
+
+							community = envelope.Community
+							input = envelope.Payload
+						}
+
+						key, ok := communities[community]
+						if !ok {
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).Msg("Discarding message from signaler because it is for a community which has not been joined, continuing")
+
+							continue
+						}
+
+						input, err = a.cipher.Decrypt(input, []byte(key))
+						if err != nil {
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Int("len", len(input)).
+								Str("community", community).
+								Str("id", id).Msg("Could not decrypt message from signaler, continuing")
+
+							continue
+						}
+
+						log.Trace().
+							Str("address", conn.RemoteAddr().String()).
+							Int("len", len(input)).
+							Str("community", community).
+							Str("id", id).Msg("Received message from signaler")
+
+						var message websocketapi.Message
+						if err := websocketapi.Unmarshal(input, &message); err != nil {
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).Msg("Could not unmarshal message from signaler, continuing")
+
+							continue
+						}
+
+						// Peers which send CBOR use the binary signaling protocol, even if their introduction has been missed
+						if websocketapi.IsBinary(input) {
+							var sender websocketapi.Sender
+							if err := websocketapi.Unmarshal(input, &sender); err == nil && sender.From != "" {
+								setVersion(sender.From, websocketapi.Versions)
+							}
+						}
+
+						switch message.Type {
+						case websocketapi.TypeIntroduction:
+							var introduction websocketapi.Introduction
+							if err := websocketapi.Unmarshal(input, &introduction); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal introduction from signaler, continuing")
+
+								continue
+							}
+
+							setVersion(introduction.From, introduction.Versions)
+
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).
+								Str("peerID", introduction.From).
+								Str("name", introduction.Name).Msg("Received introduction from signaler")
+
+							// Peers re-introduce themselves after reconnecting to the signaler, and peers which have been restarted send offers to cached peers before introducing themselves
+							peerLock.Lock()
+							existing, ok := peers[community][introduction.From]
+							reconnected := ok && existing.session == introduction.Session && (existing.connected() || existing.negotiating(a.config.Timeout))
+							peerLock.Unlock()
+
+							if reconnected {
+								log.Debug().Str("peerID", introduction.From).Msg("Discarding introduction because peer is already connected or connecting, continuing")
+
+								continue
+							}
+
+							// Introductions are flooded through the gossip mesh, so both peers receive each other's; only the peer with the higher ID sends an offer if both peers can send one
+							if gossiping && id < introduction.From && canOffer(introduction.Mode) && canAnswer(a.config.Negotiation) {
+								log.Debug().Str("peerID", introduction.From).Msg("Discarding gossiped introduction because the peer sends the offer, continuing")
+
+								continue
+							}
+
+							if !a.IsPeerAllowed(introduction.From) {
+								log.Debug().Str("peerID", introduction.From).Msg("Discarding introduction because peer is not allowed, continuing")
+
+								continue
+							}
+
+							// Peers which can't send an offer which the other peer answers introduce themselves in return, so that the other peer sends it instead
+							if !canOffer(a.config.Negotiation) || !canAnswer(introduction.Mode) {
+								if !canOffer(introduction.Mode) || !canAnswer(a.config.Negotiation) {
+									log.Debug().Str("peerID", introduction.From).Str("mode", introduction.Mode).Msg("Discarding introduction because neither peer answers the other's offers, continuing")
+
+									continue
+								}
+
+								p, err := websocketapi.Marshal(getVersion(introduction.From), websocketapi.NewIntroduction(id, session, a.config.Name, a.config.Negotiation, a.config.Metadata, supportedVersions))
+								if err != nil {
+									log.Debug().Err(err).Str("peerID", introduction.From).Msg("Could not marshal introduction, continuing")
+
+									continue
+								}
+
+								go a.sendLine(community, introduction.From, p)
+
+								log.Debug().Str("peerID", introduction.From).Msg("Introduced to peer so that it sends the offer")
+
+								continue
+							}
+
+							sendOffer(community, introduction, ReasonIntroduced)
+						case websocketapi.TypeOffer:
+							var offer websocketapi.Exchange
+							if err := websocketapi.Unmarshal(input, &offer); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal offer from signaler, continuing")
+
+								continue
+							}
+
+							if offer.To != id {
+								log.Trace().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Discarding offer from signaler because it is not intended for this client")
+
+								continue
+							}
+
+							if !a.IsPeerAllowed(offer.From) {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("peerID", offer.From).
+									Str("id", id).Msg("Discarding offer from signaler because peer is not allowed, continuing")
+
+								continue
+							}
+
+							if !canAnswer(a.config.Negotiation) {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("peerID", offer.From).
+									Str("id", id).Msg("Discarding offer from signaler because this client only sends offers, continuing")
+
+								continue
+							}
+
+							// Peers which receive each other's introductions at the same time or which have been restarted at the same time send offers to each other (glare); the offer of the peer with the higher ID wins, so that both peers keep the same connection
+							peerLock.Lock()
+							pending, ok := peers[community][offer.From]
+							glare := ok && pending.offering() && pending.negotiating(a.config.Timeout)
+							peerLock.Unlock()
+
+							if glare && id > offer.From {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("peerID", offer.From).
+									Str("id", id).Msg("Discarding offer from signaler because the offer sent to the peer wins, continuing")
+
+								continue
+							}
+
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
 								Str("community", community).
-								Str("id", id).Msg("Received introduction from signaler")
+								Str("id", id).
+								Str("peerID", offer.From).
+								Str("name", offer.Name).Msg("Received offer from signaler")
 
 							iid := uuid.NewString()
 
@@ -330,50 +2141,71 @@ func (a *Adapter) Open() (chan string, error) {
 							}
 
 							c, err := a.api.NewPeerConnection(webrtc.Configuration{
-								ICEServers:         iceServers,
+								ICEServers:         a.getICEServers(),
 								ICETransportPolicy: transportPolicy,
 							})
 							if err != nil {
 								panic(err)
 							}
 
+							renegotiate(c, community, offer.From)
+
+							if a.config.OnPeerConnectionCreated != nil {
+								a.config.OnPeerConnectionCreated(offer.From, community, c)
+							}
+
 							c.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
+								switch pcs {
+								case webrtc.PeerConnectionStateConnecting:
+									a.events.publish(community, offer.From, PeerStateConnecting, "")
+								case webrtc.PeerConnectionStateConnected:
+									a.events.publish(community, offer.From, PeerStateConnected, "")
+
+									markConnected(community, offer.From, iid)
+
+									cachePeer(community, offer.From, iid)
+								case webrtc.PeerConnectionStateFailed:
+									a.events.publish(community, offer.From, PeerStateFailed, ReasonICEFailed)
+								}
+
+								if pcs == webrtc.PeerConnectionStateFailed && (a.config.RelayFallback || openDataRelay != nil) {
+									log.Debug().Str("peerID", offer.From).Msg("Could not establish direct connection to peer, relaying")
+
+									fallback(community, offer.From, iid)
+
+									return
+								}
+
 								if pcs == webrtc.PeerConnectionStateDisconnected {
-									log.Debug().Str("peerID", introduction.From).Msg("Disconnected from peer")
+									log.Debug().Str("peerID", offer.From).Msg("Disconnected from peer")
 
 									peerLock.Lock()
 									defer peerLock.Unlock()
 
-									c, ok := peers[introduction.From]
-
+									c, ok := peers[community][offer.From]
 									if !ok {
-										log.Debug().Str("peerID", introduction.From).Msg("Could not find connection for peer, continuing")
+										log.Debug().Str("peerID", offer.From).Msg("Could not find connection for peer, continuing")
 
 										return
 									}
 
 									if c.iid != iid {
-										log.Debug().Str("peerID", introduction.From).Msg("Peer already rejoined, not disconnecting")
+										log.Debug().Str("peerID", offer.From).Msg("Peer already rejoined, not disconnecting")
 
 										return
 									}
 
-									for _, channel := range c.channels {
-										if err := channel.Close(); err != nil {
-											panic(err)
-										}
-									}
-
-									if err := c.conn.Close(); err != nil {
-										panic(err)
-									}
+									recordSession(community, offer.From, c, ReasonDisconnected)
+									c.close()
 
-									close(c.candidates)
+									delete(peers[community], offer.From)
 
-									delete(peers, introduction.From)
+									a.events.publish(community, offer.From, PeerStateClosed, ReasonDisconnected)
 								}
 							})
 
+							var sending sync.WaitGroup
+
 							c.OnICECandidate(func(i *webrtc.ICECandidate) {
 								if i != nil {
 									log.Trace().
@@ -382,48 +2214,54 @@ func (a *Adapter) Open() (chan string, error) {
 										Str("community", community).
 										Str("id", id).Msg("Created ICE candidate")
 
-									p, err := json.Marshal(websocketapi.NewCandidate(id, introduction.From, []byte(i.ToJSON().Candidate)))
+									p, err := websocketapi.Marshal(getVersion(offer.From), websocketapi.NewCandidate(id, offer.From, []byte(i.ToJSON().Candidate)))
 									if err != nil {
 										panic(err)
 									}
 
+									sending.Add(1)
 									go func() {
-										a.sendLine(p)
+										defer sending.Done()
+
+										a.sendLine(community, offer.From, p)
 
 										log.Debug().
 											Str("address", conn.RemoteAddr().String()).
 											Str("community", community).
 											Str("id", id).
-											Str("client", introduction.From).
+											Str("client", offer.From).
 											Msg("Sent ICE candidate to signaler")
 									}()
-								}
-							})
+								} else {
+									// Candidates are sent concurrently, so the end of candidates is only sent once all of them have been queued
+									go func() {
+										sending.Wait()
 
-							for i, channelID := range a.channels {
-								// Skip empty channel IDs
-								if strings.TrimSpace(channelID) == "" {
-									continue
-								}
+										p, err := websocketapi.Marshal(getVersion(offer.From), websocketapi.NewEndOfCandidates(id, offer.From))
+										if err != nil {
+											panic(err)
+										}
 
-								dc, err := c.CreateDataChannel(channelID, nil)
-								if err != nil {
-									panic(err)
-								}
+										a.sendLine(community, offer.From, p)
 
-								log.Trace().
-									Str("address", conn.RemoteAddr().String()).
-									Str("community", community).
-									Str("channelID", channelID).
-									Msg("Created data channel")
+										log.Debug().
+											Str("address", conn.RemoteAddr().String()).
+											Str("community", community).
+											Str("id", id).
+											Str("client", offer.From).
+											Msg("Sent end of candidates to signaler")
+									}()
+								}
+							})
 
+							c.OnDataChannel(func(dc *webrtc.DataChannel) {
 								dc.OnOpen(func() {
 									log.Debug().
 										Str("label", dc.Label()).
-										Str("peer", introduction.From).
+										Str("peer", offer.From).
 										Msg("Connected to channel")
 
-									c, err := dc.Detach()
+									c, err := a.detach(dc)
 									if err != nil {
 										panic(err)
 									}
@@ -431,10 +2269,27 @@ func (a *Adapter) Open() (chan string, error) {
 									for _, channel := range a.channels {
 										if dc.Label() == channel {
 											peerLock.Lock()
-											peers[introduction.From].channels[dc.Label()] = dc
-											a.peers <- &Peer{introduction.From, dc.Label(), c}
+											pr, ok := peers[community][offer.From]
+											if !ok {
+												peerLock.Unlock()
+
+												_ = c.Close()
+
+												log.Debug().Str("peerID", offer.From).Msg("Could not find peer, continuing")
+
+												break
+											}
+
+											pr.channels[dc.Label()] = dc
+											p := &Peer{offer.From, offer.Name, dc.Label(), a.secure(c, communities[community]), offer.Metadata, community, false, closer(community, offer.From, pr)}
 											peerLock.Unlock()
 
+											a.auditChannel(p)
+
+											if p = pr.binding.add(a.adaptive.add(pr, p)); p != nil {
+												a.router.deliver(pr.ctx, p)
+											}
+
 											break
 										}
 									}
@@ -443,14 +2298,14 @@ func (a *Adapter) Open() (chan string, error) {
 								dc.OnClose(func() {
 									log.Debug().
 										Str("label", dc.Label()).
-										Str("peer", introduction.From).
+										Str("peer", offer.From).
 										Msg("Disconnected from channel")
 
 									peerLock.Lock()
 									defer peerLock.Unlock()
-									peer, ok := peers[introduction.From]
+									peer, ok := peers[community][offer.From]
 									if !ok {
-										log.Debug().Str("peerID", introduction.From).Msg("Could not find peer, continuing")
+										log.Debug().Str("peerID", offer.From).Msg("Could not find peer, continuing")
 
 										return
 									}
@@ -458,7 +2313,7 @@ func (a *Adapter) Open() (chan string, error) {
 									channel, ok := peer.channels[dc.Label()]
 									if !ok {
 										log.Debug().
-											Str("peerID", introduction.From).
+											Str("peerID", offer.From).
 											Str("channelID", dc.Label()).
 											Msg("Could not find channel, continuing")
 
@@ -466,86 +2321,217 @@ func (a *Adapter) Open() (chan string, error) {
 									}
 
 									if err := channel.Close(); err != nil {
-										panic(err)
+										log.Debug().Err(err).Str("channelID", dc.Label()).Msg("Could not close channel, continuing")
+									}
+
+									delete(peers[community][offer.From].channels, dc.Label())
+								})
+							})
+
+							var sdp webrtc.SessionDescription
+							if err := json.Unmarshal(offer.Payload, &sdp); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal SDP from signaler, continuing")
+
+								continue
+							}
+
+							if err := c.SetRemoteDescription(a.mungeRemoteDescription(community, offer.From, sdp)); err != nil {
+								panic(err)
+							}
+
+							addCachedCandidates(community, offer.From, c)
+
+							ans, err := c.CreateAnswer(nil)
+							if err != nil {
+								panic(err)
+							}
+							ans = a.mungeLocalDescription(community, offer.From, ans)
+
+							if err := c.SetLocalDescription(ans); err != nil {
+								panic(err)
+							}
+
+							aj, err := json.Marshal(ans)
+							if err != nil {
+								panic(err)
+							}
+
+							p, err := websocketapi.Marshal(getVersion(offer.From), websocketapi.NewAnswer(id, offer.From, aj))
+							if err != nil {
+								panic(err)
+							}
+
+							peerLock.Lock()
+
+							if old, ok := peers[community][offer.From]; ok {
+								// Disconnect the old peer, i.e. if it has been restarted with a fixed ID or if the offer sent to it has lost
+								log.Debug().Str("peerID", offer.From).Msg("Disconnected from peer")
+
+								reason := ReasonRestarted
+								if glare && old == pending {
+									reason = ReasonGlare
+								}
+
+								recordSession(community, offer.From, old, reason)
+								old.close()
+
+								a.events.publish(community, offer.From, PeerStateReconnecting, reason)
+							}
+
+							pr := newPeer(a.ctx, c, map[string]*webrtc.DataChannel{}, iid, offer.Metadata, offer.Session, offer.Name)
+							peers[community][offer.From] = pr
+
+							peerLock.Unlock()
+
+							a.events.publish(community, offer.From, PeerStateGathering, ReasonOffered)
+
+							go func() {
+								for {
+									var candidate webrtc.ICECandidateInit
+									select {
+									case <-pr.ctx.Done():
+										return
+									case candidate = <-pr.candidates:
+									}
+
+									// Candidates can arrive after the connection to the signaler which created this goroutine has been closed
+									if err := c.AddICECandidate(candidate); err != nil {
+										log.Debug().Err(err).Str("peerID", offer.From).Msg("Could not add ICE candidate, continuing")
+
+										continue
 									}
 
-									delete(peers[introduction.From].channels, dc.Label())
-								})
+									log.Debug().
+										Str("address", conn.RemoteAddr().String()).
+										Str("community", community).
+										Str("id", id).
+										Str("peerID", offer.From).
+										Msg("Added ICE candidate from signaler")
+								}
+							}()
+
+							go func() {
+								a.sendLine(community, offer.From, p)
+
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).
+									Str("client", offer.From).
+									Msg("Sent answer to signaler")
+							}()
+						case websocketapi.TypeCandidate:
+							var candidate websocketapi.Exchange
+							if err := websocketapi.Unmarshal(input, &candidate); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal candidate from signaler, continuing")
+
+								continue
+							}
+
+							if candidate.To != id {
+								log.Trace().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Discarding candidate from signaler because it is not intended for this client")
+
+								continue
+							}
+
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).Msg("Received candidate from signaler")
+
+							peerLock.Lock()
+							c, ok := peers[community][candidate.From]
+
+							if !ok {
+								log.Debug().Str("peerID", candidate.From).Msg("Could not find connection for peer, continuing")
+
+								peerLock.Unlock()
+
+								continue
+							}
 
-								if i == 0 {
-									o, err := c.CreateOffer(nil)
-									if err != nil {
-										panic(err)
-									}
+							c.remoteCandidates = append(c.remoteCandidates, string(candidate.Payload))
 
-									if err := c.SetLocalDescription(o); err != nil {
-										panic(err)
-									}
+							// Candidates are queued until the remote description has been set
+							go func() {
+								select {
+								case <-c.ctx.Done():
+								case c.candidates <- webrtc.ICECandidateInit{Candidate: string(candidate.Payload)}:
+								}
+							}()
 
-									oj, err := json.Marshal(o)
-									if err != nil {
-										panic(err)
-									}
+							peerLock.Unlock()
+						case websocketapi.TypeEndOfCandidates:
+							var end websocketapi.Exchange
+							if err := websocketapi.Unmarshal(input, &end); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal end of candidates from signaler, continuing")
 
-									p, err := json.Marshal(websocketapi.NewOffer(id, introduction.From, oj))
-									if err != nil {
-										panic(err)
-									}
+								continue
+							}
 
-									pr := &peer{c, make(chan webrtc.ICECandidateInit), map[string]*webrtc.DataChannel{
-										dc.Label(): dc,
-									}, iid}
+							if end.To != id {
+								log.Trace().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Discarding end of candidates from signaler because it is not intended for this client")
 
-									peerLock.Lock()
-									old, ok := peers[introduction.From]
-									if ok {
-										// Disconnect the old peer
-										log.Debug().Str("peerID", introduction.From).Msg("Disconnected from peer")
-
-										for _, channel := range old.channels {
-											if err := channel.Close(); err != nil {
-												panic(err)
-											}
-										}
+								continue
+							}
 
-										if err := old.conn.Close(); err != nil {
-											panic(err)
-										}
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).
+								Str("peerID", end.From).Msg("Received end of candidates from signaler")
 
-										close(old.candidates)
-									}
-									peers[introduction.From] = pr
-									peerLock.Unlock()
+							peerLock.Lock()
+							c, ok := peers[community][end.From]
+							peerLock.Unlock()
 
-									go func() {
-										a.sendLine(p)
+							if !ok {
+								log.Debug().Str("peerID", end.From).Msg("Could not find connection for peer, continuing")
 
-										log.Debug().
-											Str("address", conn.RemoteAddr().String()).
-											Str("community", community).
-											Str("id", id).
-											Str("client", introduction.From).
-											Msg("Sent offer to signaler")
-									}()
-								}
+								continue
 							}
 
-						case websocketapi.TypeOffer:
-							var offer websocketapi.Exchange
-							if err := json.Unmarshal(input, &offer); err != nil {
+							// Like candidates, the end of candidates can only be added once the remote description has been set
+							go func() {
+								select {
+								case <-c.ctx.Done():
+									return
+								case c.candidates <- webrtc.ICECandidateInit{}:
+								}
+
+								a.events.publish(community, end.From, PeerStateConnecting, ReasonEndOfCandidates)
+							}()
+						case websocketapi.TypeAnswer:
+							var answer websocketapi.Exchange
+							if err := websocketapi.Unmarshal(input, &answer); err != nil {
 								log.Debug().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Could not unmarshal offer from signaler, continuing")
+									Str("id", id).Msg("Could not unmarshal answer from signaler, continuing")
 
 								continue
 							}
 
-							if offer.To != id {
+							if answer.To != id {
 								log.Trace().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Discarding offer from signaler because it is not intended for this client")
+									Str("id", id).Msg("Discarding answer from signaler because it is not intended for this client")
 
 								continue
 							}
@@ -553,132 +2539,105 @@ func (a *Adapter) Open() (chan string, error) {
 							log.Debug().
 								Str("address", conn.RemoteAddr().String()).
 								Str("community", community).
-								Str("id", id).Msg("Received offer from signaler")
+								Str("id", id).Msg("Received answer from signaler")
 
-							iid := uuid.NewString()
+							peerLock.Lock()
+							c, ok := peers[community][answer.From]
+							peerLock.Unlock()
 
-							transportPolicy := webrtc.ICETransportPolicyAll
-							if a.config.ForceRelay {
-								transportPolicy = webrtc.ICETransportPolicyRelay
-							}
+							if !ok {
+								log.Debug().Str("peerID", answer.From).Msg("Could not find connection for peer, continuing")
 
-							c, err := a.api.NewPeerConnection(webrtc.Configuration{
-								ICEServers:         iceServers,
-								ICETransportPolicy: transportPolicy,
-							})
-							if err != nil {
-								panic(err)
+								continue
 							}
 
-							c.OnConnectionStateChange(func(pcs webrtc.PeerConnectionState) {
-								if pcs == webrtc.PeerConnectionStateDisconnected {
-									log.Debug().Str("peerID", offer.From).Msg("Disconnected from peer")
-
-									peerLock.Lock()
-									defer peerLock.Unlock()
+							var sdp webrtc.SessionDescription
+							if err := json.Unmarshal(answer.Payload, &sdp); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal SDP from signaler, continuing")
 
-									c, ok := peers[offer.From]
-									if !ok {
-										log.Debug().Str("peerID", offer.From).Msg("Could not find connection for peer, continuing")
+								continue
+							}
 
-										return
-									}
+							if err := c.conn.SetRemoteDescription(a.mungeRemoteDescription(community, answer.From, sdp)); err != nil {
+								panic(err)
+							}
 
-									if c.iid != iid {
-										log.Debug().Str("peerID", offer.From).Msg("Peer already rejoined, not disconnecting")
+							addCachedCandidates(community, answer.From, c.conn)
 
+							go func() {
+								for {
+									var candidate webrtc.ICECandidateInit
+									select {
+									case <-c.ctx.Done():
 										return
+									case candidate = <-c.candidates:
 									}
 
-									if err := c.conn.Close(); err != nil {
-										panic(err)
-									}
+									// Candidates can arrive after the connection to the signaler which created this goroutine has been closed
+									if err := c.conn.AddICECandidate(candidate); err != nil {
+										log.Debug().Err(err).Str("peerID", answer.From).Msg("Could not add ICE candidate, continuing")
 
-									if err := c.conn.Close(); err != nil {
-										panic(err)
+										continue
 									}
 
-									close(c.candidates)
-
-									delete(peers, offer.From)
-								}
-							})
-
-							c.OnICECandidate(func(i *webrtc.ICECandidate) {
-								if i != nil {
-									log.Trace().
+									log.Debug().
 										Str("address", conn.RemoteAddr().String()).
-										Str("len", i.String()).
 										Str("community", community).
-										Str("id", id).Msg("Created ICE candidate")
-
-									p, err := json.Marshal(websocketapi.NewCandidate(id, offer.From, []byte(i.ToJSON().Candidate)))
-									if err != nil {
-										panic(err)
-									}
-
-									go func() {
-										a.sendLine(p)
-
-										log.Debug().
-											Str("address", conn.RemoteAddr().String()).
-											Str("community", community).
-											Str("id", id).
-											Str("client", offer.From).
-											Msg("Sent ICE candidate to signaler")
-									}()
+										Str("id", id).
+										Str("peerID", answer.From).
+										Msg("Added ICE candidate from signaler")
 								}
-							})
+							}()
 
-							c.OnDataChannel(func(dc *webrtc.DataChannel) {
-								dc.OnOpen(func() {
-									log.Debug().
-										Str("label", dc.Label()).
-										Str("peer", offer.From).
-										Msg("Connected to channel")
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).
+								Str("peerID", answer.From).
+								Msg("Added answer from signaler")
+						case websocketapi.TypeRenegotiationOffer:
+							var offer websocketapi.Exchange
+							if err := websocketapi.Unmarshal(input, &offer); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal renegotiation offer from signaler, continuing")
 
-									c, err := dc.Detach()
-									if err != nil {
-										panic(err)
-									}
+								continue
+							}
 
-									for _, channel := range a.channels {
-										if dc.Label() == channel {
-											peerLock.Lock()
-											peers[offer.From].channels[dc.Label()] = dc
-											a.peers <- &Peer{offer.From, dc.Label(), c}
-											peerLock.Unlock()
+							if offer.To != id {
+								log.Trace().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Discarding renegotiation offer from signaler because it is not intended for this client")
 
-											break
-										}
-									}
-								})
+								continue
+							}
 
-								dc.OnClose(func() {
-									log.Debug().
-										Str("label", dc.Label()).
-										Str("peer", offer.From).
-										Msg("Disconnected from channel")
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).Msg("Received renegotiation offer from signaler")
 
-									peerLock.Lock()
-									defer peerLock.Unlock()
-									channel, ok := peers[offer.From].channels[dc.Label()]
-									if !ok {
-										log.Debug().
-											Str("peerID", offer.From).
-											Str("channelID", dc.Label()).
-											Msg("Could not find channel, continuing")
+							peerLock.Lock()
+							c, ok := peers[community][offer.From]
+							peerLock.Unlock()
 
-										return
-									}
+							if !ok {
+								log.Debug().Str("peerID", offer.From).Msg("Could not find connection for peer, continuing")
 
-									if err := channel.Close(); err != nil {
-										panic(err)
-									}
+								continue
+							}
 
-									delete(peers[offer.From].channels, dc.Label())
-								})
-							})
+							if c.conn.SignalingState() != webrtc.SignalingStateStable {
+								log.Debug().Str("peerID", offer.From).Msg("Discarding renegotiation offer because a negotiation is already in progress, continuing")
+
+								continue
+							}
 
 							var sdp webrtc.SessionDescription
 							if err := json.Unmarshal(offer.Payload, &sdp); err != nil {
@@ -690,17 +2649,24 @@ func (a *Adapter) Open() (chan string, error) {
 								continue
 							}
 
-							if err := c.SetRemoteDescription(sdp); err != nil {
-								panic(err)
+							if err := c.conn.SetRemoteDescription(a.mungeRemoteDescription(community, offer.From, sdp)); err != nil {
+								log.Debug().Err(err).Str("peerID", offer.From).Msg("Could not set renegotiation offer, continuing")
+
+								continue
 							}
 
-							ans, err := c.CreateAnswer(nil)
+							ans, err := c.conn.CreateAnswer(nil)
 							if err != nil {
-								panic(err)
+								log.Debug().Err(err).Str("peerID", offer.From).Msg("Could not create renegotiation answer, continuing")
+
+								continue
 							}
+							ans = a.mungeLocalDescription(community, offer.From, ans)
 
-							if err := c.SetLocalDescription(ans); err != nil {
-								panic(err)
+							if err := c.conn.SetLocalDescription(ans); err != nil {
+								log.Debug().Err(err).Str("peerID", offer.From).Msg("Could not set renegotiation answer, continuing")
+
+								continue
 							}
 
 							aj, err := json.Marshal(ans)
@@ -708,112 +2674,143 @@ func (a *Adapter) Open() (chan string, error) {
 								panic(err)
 							}
 
-							p, err := json.Marshal(websocketapi.NewAnswer(id, offer.From, aj))
+							p, err := websocketapi.Marshal(getVersion(offer.From), websocketapi.NewRenegotiationAnswer(id, offer.From, aj))
 							if err != nil {
 								panic(err)
 							}
 
-							peerLock.Lock()
+							go func() {
+								a.sendLine(community, offer.From, p)
+
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).
+									Str("client", offer.From).
+									Msg("Sent renegotiation answer to signaler")
+							}()
+						case websocketapi.TypeRenegotiationAnswer:
+							var answer websocketapi.Exchange
+							if err := websocketapi.Unmarshal(input, &answer); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal renegotiation answer from signaler, continuing")
 
-							candidates := make(chan webrtc.ICECandidateInit)
-							peers[offer.From] = &peer{c, candidates, map[string]*webrtc.DataChannel{}, iid}
+								continue
+							}
 
-							peerLock.Unlock()
+							if answer.To != id {
+								log.Trace().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Discarding renegotiation answer from signaler because it is not intended for this client")
 
-							go func() {
-								for candidate := range candidates {
-									if err := c.AddICECandidate(candidate); err != nil {
-										errs <- err
+								continue
+							}
 
-										return
-									}
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).Msg("Received renegotiation answer from signaler")
 
-									log.Debug().
-										Str("address", conn.RemoteAddr().String()).
-										Str("community", community).
-										Str("id", id).
-										Str("peerID", offer.From).
-										Msg("Added ICE candidate from signaler")
-								}
-							}()
+							peerLock.Lock()
+							c, ok := peers[community][answer.From]
+							peerLock.Unlock()
 
-							go func() {
-								a.sendLine(p)
+							if !ok {
+								log.Debug().Str("peerID", answer.From).Msg("Could not find connection for peer, continuing")
+
+								continue
+							}
 
+							var sdp webrtc.SessionDescription
+							if err := json.Unmarshal(answer.Payload, &sdp); err != nil {
 								log.Debug().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).
-									Str("client", offer.From).
-									Msg("Sent answer to signaler")
-							}()
-						case websocketapi.TypeCandidate:
-							var candidate websocketapi.Exchange
-							if err := json.Unmarshal(input, &candidate); err != nil {
+									Str("id", id).Msg("Could not unmarshal SDP from signaler, continuing")
+
+								continue
+							}
+
+							if err := c.conn.SetRemoteDescription(a.mungeRemoteDescription(community, answer.From, sdp)); err != nil {
+								log.Debug().Err(err).Str("peerID", answer.From).Msg("Could not set renegotiation answer, continuing")
+
+								continue
+							}
+						case websocketapi.TypeGoodbye:
+							var goodbye websocketapi.Goodbye
+							if err := websocketapi.Unmarshal(input, &goodbye); err != nil {
 								log.Debug().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Could not unmarshal candidate from signaler, continuing")
+									Str("id", id).Msg("Could not unmarshal goodbye from signaler, continuing")
 
 								continue
 							}
 
-							if candidate.To != id {
+							if goodbye.To != id {
 								log.Trace().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Discarding candidate from signaler because it is not intended for this client")
+									Str("id", id).Msg("Discarding goodbye from signaler because it is not intended for this client")
 
 								continue
 							}
 
-							log.Debug().
-								Str("address", conn.RemoteAddr().String()).
-								Str("community", community).
-								Str("id", id).Msg("Received candidate from signaler")
+							reason := goodbye.Reason
+							if strings.TrimSpace(reason) == "" {
+								reason = ReasonClosed
+							}
 
 							peerLock.Lock()
-							c, ok := peers[candidate.From]
-
+							pr, ok := peers[community][goodbye.From]
 							if !ok {
-								log.Debug().Str("peerID", candidate.From).Msg("Could not find connection for peer, continuing")
-
 								peerLock.Unlock()
 
+								log.Debug().Str("peerID", goodbye.From).Msg("Could not find connection for peer, continuing")
+
 								continue
 							}
 
-							go func() {
-								defer func() {
-									if err := recover(); err != nil {
-										log.Debug().
-											Str("address", conn.RemoteAddr().String()).
-											Str("community", community).
-											Str("id", id).
-											Msg("Gathering candiates has stopped, continuing candidate")
-									}
-								}()
-
-								c.candidates <- webrtc.ICECandidateInit{Candidate: string(candidate.Payload)}
-							}()
+							recordSession(community, goodbye.From, pr, reason)
+							pr.close()
 
+							delete(peers[community], goodbye.From)
 							peerLock.Unlock()
-						case websocketapi.TypeAnswer:
-							var answer websocketapi.Exchange
-							if err := json.Unmarshal(input, &answer); err != nil {
+
+							log.Debug().
+								Str("address", conn.RemoteAddr().String()).
+								Str("community", community).
+								Str("id", id).
+								Str("peerID", goodbye.From).
+								Str("reason", reason).
+								Msg("Peer closed connection")
+
+							a.events.publish(community, goodbye.From, PeerStateClosed, reason)
+						case websocketapi.TypeMail:
+							var mail websocketapi.Mail
+							if err := websocketapi.Unmarshal(input, &mail); err != nil {
 								log.Debug().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Could not unmarshal answer from signaler, continuing")
+									Str("id", id).Msg("Could not unmarshal mail from signaler, continuing")
 
 								continue
 							}
 
-							if answer.To != id {
+							if mail.To != id {
 								log.Trace().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Discarding answer from signaler because it is not intended for this client")
+									Str("id", id).Msg("Discarding mail from signaler because it is not intended for this client")
+
+								continue
+							}
+
+							if !a.IsPeerAllowed(mail.From) {
+								log.Debug().Str("peerID", mail.From).Msg("Discarding mail from peer which is not allowed, continuing")
 
 								continue
 							}
@@ -821,55 +2818,94 @@ func (a *Adapter) Open() (chan string, error) {
 							log.Debug().
 								Str("address", conn.RemoteAddr().String()).
 								Str("community", community).
-								Str("id", id).Msg("Received answer from signaler")
-
-							peerLock.Lock()
-							c, ok := peers[answer.From]
-							peerLock.Unlock()
+								Str("id", id).
+								Str("peerID", mail.From).
+								Msg("Received mail")
 
-							if !ok {
-								log.Debug().Str("peerID", answer.From).Msg("Could not find connection for peer, continuing")
+							if a.config.OnMail != nil {
+								a.config.OnMail(Mail{community, mail.From, mail.Payload, time.Unix(mail.Sent, 0)})
+							}
+						case websocketapi.TypeRelay, websocketapi.TypeRelayClose:
+							var relay websocketapi.Relay
+							if err := websocketapi.Unmarshal(input, &relay); err != nil {
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", community).
+									Str("id", id).Msg("Could not unmarshal relayed payload from signaler, continuing")
 
 								continue
 							}
 
-							var sdp webrtc.SessionDescription
-							if err := json.Unmarshal(answer.Payload, &sdp); err != nil {
-								log.Debug().
+							if relay.To != id {
+								log.Trace().
 									Str("address", conn.RemoteAddr().String()).
 									Str("community", community).
-									Str("id", id).Msg("Could not unmarshal SDP from signaler, continuing")
+									Str("id", id).Msg("Discarding relayed payload from signaler because it is not intended for this client")
 
 								continue
 							}
 
-							if err := c.conn.SetRemoteDescription(sdp); err != nil {
-								panic(err)
+							peerLock.Lock()
+							pr, ok := peers[community][relay.From]
+							if !ok {
+								peerLock.Unlock()
+
+								log.Debug().Str("peerID", relay.From).Msg("Could not find connection for peer, continuing")
+
+								continue
 							}
 
-							go func() {
-								for candidate := range c.candidates {
-									if err := c.conn.AddICECandidate(candidate); err != nil {
-										errs <- err
+							rc, ok := pr.relays[relay.Channel]
+							if message.Type == websocketapi.TypeRelayClose {
+								if ok {
+									delete(pr.relays, relay.Channel)
+								}
+								peerLock.Unlock()
 
-										return
+								if ok {
+									rc.closeLocal()
+
+									log.Debug().
+										Str("peerID", relay.From).
+										Str("channelID", relay.Channel).
+										Msg("Peer closed relayed channel")
+								}
+
+								continue
+							}
+
+							if !ok {
+								known := false
+								for _, channelID := range a.channels {
+									if channelID == relay.Channel {
+										known = true
+
+										break
 									}
+								}
+
+								// The remote peer can detect the failed connection before this adapter does
+								if !a.config.RelayFallback || !known {
+									peerLock.Unlock()
 
 									log.Debug().
-										Str("address", conn.RemoteAddr().String()).
-										Str("community", community).
-										Str("id", id).
-										Str("peerID", answer.From).
-										Msg("Added ICE candidate from signaler")
+										Str("peerID", relay.From).
+										Str("channelID", relay.Channel).
+										Msg("Discarding relayed payload because relaying is disabled or the channel is unknown, continuing")
+
+									continue
 								}
-							}()
 
-							log.Debug().
-								Str("address", conn.RemoteAddr().String()).
-								Str("community", community).
-								Str("id", id).
-								Str("peerID", answer.From).
-								Msg("Added answer from signaler")
+								rc = openRelay(community, relay.From, pr, relay.Channel)
+							}
+							peerLock.Unlock()
+
+							if !rc.deliver(relay.Payload) {
+								log.Debug().
+									Str("peerID", relay.From).
+									Str("channelID", relay.Channel).
+									Msg("Could not deliver relayed payload because the channel's queue is full, dropping")
+							}
 						default:
 							log.Debug().
 								Str("address", conn.RemoteAddr().String()).
@@ -881,29 +2917,102 @@ func (a *Adapter) Open() (chan string, error) {
 							continue
 						}
 					case line := <-a.lines:
-						line, err = encryption.Encrypt(line, []byte(a.key))
+						p := line.p
+						if line.message != nil {
+							var err error
+							p, err = websocketapi.Marshal(getVersion(line.to), line.message)
+							if err != nil {
+								panic(err)
+							}
+						}
+
+						p, err := a.cipher.Encrypt(p, []byte(communities[line.community]))
 						if err != nil {
 							panic(err)
 						}
 
+						if multiplexed {
+							to := ""
+							if a.config.SelectiveSignaling {
+								to = line.to
+							}
+
+							envelope := websocketapi.NewRoutedEnvelope(line.community, to, p)
+							if line.mail {
+								envelope = websocketapi.NewMailEnvelope(line.community, line.to, p)
+							}
+
+							p, err = websocketapi.Marshal(version, envelope)
+							if err != nil {
+								panic(err)
+							}
+						}
+
 						log.Trace().
 							Str("address", conn.RemoteAddr().String()).
-							Str("community", community).
+							Str("community", line.community).
 							Str("id", id).
-							Int("len", len(line)).
+							Int("len", len(p)).
 							Msg("Sending message to signaler")
 
-						if err := conn.WriteMessage(websocket.TextMessage, line); err != nil {
+						if err := conn.WriteMessage(messageType, p); err != nil {
 							panic(err)
 						}
 
 						if err := conn.SetWriteDeadline(time.Now().Add(a.config.Timeout)); err != nil {
 							panic(err)
 						}
+					case <-pathChecks.C:
+						a.spawn(checkPaths)
+					case <-membersChanged:
+						membersChanged = a.gossip.getMembersChanged()
+
+						introduceMembers()
+					case <-introductions:
+						introduceMembers()
+					case <-iceServersChanged:
+						iceServersChanged = a.getICEServersChanged()
+
+						type relayedPeer struct {
+							community string
+							peerID    string
+							conn      *webrtc.PeerConnection
+						}
+
+						relayedPeers := []relayedPeer{}
+						peerLock.Lock()
+						for community := range peers {
+							for peerID, pr := range peers[community] {
+								relayedPeers = append(relayedPeers, relayedPeer{community, peerID, pr.conn})
+							}
+						}
+						peerLock.Unlock()
+
+						// Allocations on TURN servers can't be refreshed with new credentials, so peers which are relayed through them re-introduce themselves with a new session, which makes both peers create new connections
+						for _, pr := range relayedPeers {
+							if !isRelayedThroughTURN(pr.conn.GetStats()) {
+								continue
+							}
+
+							p, err := websocketapi.Marshal(getVersion(pr.peerID), websocketapi.NewIntroduction(id, uuid.NewString(), a.config.Name, a.config.Negotiation, a.config.Metadata, supportedVersions))
+							if err != nil {
+								panic(err)
+							}
+
+							go func(pr relayedPeer) {
+								a.sendLine(pr.community, pr.peerID, p)
+
+								log.Debug().
+									Str("address", conn.RemoteAddr().String()).
+									Str("community", pr.community).
+									Str("id", id).
+									Str("client", pr.peerID).
+									Msg("Re-introduced to peer to reconnect with new TURN credentials")
+							}(pr)
+						}
 					case <-pings.C:
 						log.Trace().
 							Str("address", conn.RemoteAddr().String()).
-							Str("community", community).
 							Str("id", id).
 							Msg("Sending ping to signaler")
 
@@ -918,25 +3027,303 @@ func (a *Adapter) Open() (chan string, error) {
 				}
 			}()
 		}
-	}()
+	})
 
 	return ids, nil
 }
 
-// Close disconnects the adapter from the signaler
+func (a *Adapter) getICEServers() []webrtc.ICEServer {
+	a.iceServersLock.Lock()
+	defer a.iceServersLock.Unlock()
+
+	return a.iceServers
+}
+
+func (a *Adapter) getICEServersChanged() chan struct{} {
+	a.iceServersLock.Lock()
+	defer a.iceServersLock.Unlock()
+
+	return a.iceServersChanged
+}
+
+// getHeader returns the HTTP headers to send to the signaler
+func (a *Adapter) getHeader() http.Header {
+	header := a.config.Header.Clone()
+	if len(a.config.Cookies) == 0 {
+		return header
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+
+	cookies := []string{}
+	for _, cookie := range a.config.Cookies {
+		cookies = append(cookies, cookie.String())
+	}
+
+	// Cookies must be sent in a single header
+	header.Set("Cookie", strings.Join(append(header.Values("Cookie"), cookies...), "; "))
+
+	return header
+}
+
+// setICEServers replaces the servers of a provider; if they have changed, they are applied to new connections
+func (a *Adapter) setICEServers(provider int, iceServers []webrtc.ICEServer) {
+	a.iceServersLock.Lock()
+	defer a.iceServersLock.Unlock()
+
+	if a.providedICEServers[provider] != nil && reflect.DeepEqual(a.providedICEServers[provider], iceServers) {
+		return
+	}
+	a.providedICEServers[provider] = iceServers
+
+	all := []webrtc.ICEServer{}
+	for _, provided := range a.providedICEServers {
+		all = append(all, provided...)
+	}
+	a.iceServers = a.turnDialer.rewrite(all)
+
+	close(a.iceServersChanged)
+	a.iceServersChanged = make(chan struct{})
+}
+
+// refreshICEServers fetches the servers of a provider again after the time it has returned; the previous servers are kept if this fails
+func (a *Adapter) refreshICEServers(i int, provider ICEProvider, next time.Duration) {
+	for {
+		t := time.NewTimer(next)
+
+		select {
+		case <-a.ctx.Done():
+			t.Stop()
+
+			return
+		case <-t.C:
+		}
+
+		iceServers, newNext, err := provider.ICEServers(a.ctx)
+		if err != nil {
+			log.Debug().Err(err).Int("provider", i).Msg("Could not refresh ICE servers, retrying")
+
+			next = a.config.Timeout
+
+			continue
+		}
+
+		log.Trace().Int("provider", i).Dur("next", newNext).Msg("Refreshed ICE servers")
+
+		a.setICEServers(i, iceServers)
+
+		if newNext <= 0 {
+			return
+		}
+
+		next = newNext
+	}
+}
+
+// getDataChannelInit returns the options for a channel; the peer which answers uses the options of the channel it receives
+func (a *Adapter) getDataChannelInit(channelID string) *webrtc.DataChannelInit {
+	if a.adaptive.isInternal(channelID) {
+		return a.adaptive.getDataChannelInit(channelID)
+	}
+
+	if !a.isUnreliable(channelID) {
+		return nil
+	}
+
+	ordered := false
+	maxRetransmits := uint16(0)
+
+	return &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	}
+}
+
+func (a *Adapter) isUnreliable(channelID string) bool {
+	for _, unreliable := range a.config.UnreliableChannels {
+		if unreliable == channelID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Adapter) detach(dc *webrtc.DataChannel) (io.ReadWriteCloser, error) {
+	c, err := dc.Detach()
+	if err != nil {
+		return nil, err
+	}
+
+	if a.config.UnreliableDropThreshold > 0 && a.isUnreliable(dc.Label()) {
+		return newDroppingConn(c, dc, a.config.UnreliableDropThreshold, &a.dropped), nil
+	}
+
+	if a.config.SCTPMaxSendBufferSize <= 0 {
+		return c, nil
+	}
+
+	return newBufferedConn(c, dc, a.config.SCTPMaxSendBufferSize), nil
+}
+
+// secure wraps a connection with end-to-end encryption if enabled; the handshake is started right away so that it doesn't depend on the peer reading or writing first
+func (a *Adapter) secure(conn io.ReadWriteCloser, key string) io.ReadWriteCloser {
+	if !a.config.Secure {
+		return conn
+	}
+
+	c := NewSecureConn(conn, []byte(key))
+
+	go func() {
+		if err := c.Handshake(); err != nil {
+			log.Debug().Err(err).Msg("Could not complete handshake for end-to-end encryption, closing channel")
+
+			_ = c.Close()
+		}
+	}()
+
+	return c
+}
+
+// sampleStats takes a sample of the link quality to each connected peer
+func (a *Adapter) sampleStats(peers map[string]map[string]*peer, peerLock *sync.Mutex) []wrtcstats.Sample {
+	type entry struct {
+		sample wrtcstats.Sample
+		conn   *webrtc.PeerConnection
+		pr     *peer
+	}
+
+	// Collecting stats can take a while, so it is done without holding the lock
+	entries := []entry{}
+	peerLock.Lock()
+	for community := range peers {
+		for peerID, p := range peers[community] {
+			entries = append(entries, entry{
+				sample: wrtcstats.Sample{
+					Community: community,
+					PeerID:    peerID,
+					Name:      p.name,
+					Relayed:   len(p.relays) > 0,
+					Path:      p.path,
+				},
+				conn: p.conn,
+				pr:   p,
+			})
+		}
+	}
+	peerLock.Unlock()
+
+	samples := []wrtcstats.Sample{}
+	for _, e := range entries {
+		sample := e.sample
+		sample.Time = time.Now()
+		sample.State = e.conn.ConnectionState().String()
+
+		report := e.conn.GetStats()
+
+		for _, s := range report {
+			switch s := s.(type) {
+			case webrtc.TransportStats:
+				if s.ID == "iceTransport" {
+					sample.BytesSent = s.BytesSent
+					sample.BytesReceived = s.BytesReceived
+				}
+			case webrtc.ICECandidatePairStats:
+				if s.Nominated {
+					sample.RTT = time.Duration(s.CurrentRoundTripTime * float64(time.Second))
+				}
+			}
+		}
+
+		if isRelayedThroughTURN(report) {
+			sample.Relayed = true
+		}
+
+		// The ICE agent doesn't always measure the round-trip time, but the probes of adaptive channels do
+		if quality, ok := e.pr.adaptive.current(); ok {
+			if sample.RTT == 0 {
+				sample.RTT = quality.RTT
+			}
+
+			sample.Loss = quality.Loss
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples
+}
+
+func (a *Adapter) auditChannel(p *Peer) {
+	if a.config.Audit == nil {
+		return
+	}
+
+	if err := a.config.Audit.Log(wrtcaudit.Event{
+		Type:      wrtcaudit.EventChannelOpened,
+		Community: p.Community,
+		PeerID:    p.PeerID,
+		ChannelID: p.ChannelID,
+		Relayed:   p.Relayed,
+	}); err != nil {
+		log.Debug().Err(err).Str("peerID", p.PeerID).Msg("Could not write to audit log, continuing")
+	}
+}
+
+// Close disconnects the adapter from the signaler and closes all peers; it returns once all goroutines of the adapter have exited (see Adapter for the order) and can be called multiple times, but must not be called from the adapter's handlers
 func (a *Adapter) Close() error {
-	log.Trace().Msg("Closing adapter")
+	var err error
+	a.closeOnce.Do(func() {
+		log.Trace().Msg("Closing adapter")
+
+		a.cancel()
+
+		err = a.group.Wait()
+
+		if a.mux != nil {
+			if e := a.mux.Close(); err == nil {
+				err = e
+			}
+		}
+	})
+
+	return err
+}
 
-	a.done = true
+// hasChannel returns whether the adapter opens a channel
+func (a *Adapter) hasChannel(channelID string) bool {
+	for _, c := range a.channels {
+		if c == channelID {
+			return true
+		}
+	}
+
+	return false
+}
 
-	a.cancel()
+// Members returns the peers which are directly connected to the adapter and the peers they have listed, if gossip is enabled
+func (a *Adapter) Members() []Member {
+	return a.gossip.getMembers()
+}
 
-	close(a.lines)
+// Dropped returns the amount of writes to unreliable channels which have been dropped because more than UnreliableDropThreshold bytes were buffered
+func (a *Adapter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
 
-	return nil
+// Err returns a channel on which all fatal errors will be sent (i.e. ErrPermissionDenied, after which the adapter stops reconnecting to the signaler)
+func (a *Adapter) Err() chan error {
+	return a.errs
 }
 
 // Accept returns a channel on which peers will be sent when they connect
 func (a *Adapter) Accept() chan *Peer {
 	return a.peers
 }
+
+// AcceptChannel returns a channel on which peers will be sent when they connect on a data channel with the label; once it has been called, peers on this label are no longer sent to Accept
+func (a *Adapter) AcceptChannel(channelID string) chan *Peer {
+	return a.router.accept(channelID)
+}
@@ -45,6 +45,7 @@ type NamedAdapter struct {
 	names         chan string
 	errs          chan error
 	acceptedPeers chan *Peer
+	router        *channelRouter
 }
 
 // NewNamedAdapter creates the adapter
@@ -74,6 +75,13 @@ func NewNamedAdapter(
 		}
 	}
 
+	queueLength, policy := 0, ""
+	if config.AdapterConfig != nil {
+		queueLength, policy = config.AcceptQueueLength, config.AcceptPolicy
+	}
+
+	acceptedPeers := make(chan *Peer, queueLength)
+
 	return &NamedAdapter{
 		signaler: signaler,
 		key:      key,
@@ -86,7 +94,8 @@ func NewNamedAdapter(
 		ids:           make(chan string),
 		names:         make(chan string),
 		errs:          make(chan error),
-		acceptedPeers: make(chan *Peer),
+		acceptedPeers: acceptedPeers,
+		router:        newChannelRouter(acceptedPeers, queueLength, policy),
 	}
 }
 
@@ -94,7 +103,19 @@ func NewNamedAdapter(
 func (a *NamedAdapter) Open() (chan string, error) {
 	ready := time.NewTimer(a.config.Timeout + a.config.Kicks)
 
+	var candidatesLock sync.Mutex
+	candidates := map[string]struct{}{}
+	id := ""
+
 	a.config.AdapterConfig.OnSignalerReconnect = func() {
+		candidatesLock.Lock()
+		defer candidatesLock.Unlock()
+
+		// Established peers are kept across reconnects, so the claimed name is kept too
+		if id != "" {
+			return
+		}
+
 		ready.Stop()
 		ready.Reset(a.config.Timeout + a.config.Kicks)
 	}
@@ -114,9 +135,6 @@ func (a *NamedAdapter) Open() (chan string, error) {
 		return nil, err
 	}
 
-	var candidatesLock sync.Mutex
-	candidates := map[string]struct{}{}
-	id := ""
 	timestamp := time.Now().UnixNano()
 
 	peers := map[string]map[string]*Peer{}
@@ -130,14 +148,28 @@ func (a *NamedAdapter) Open() (chan string, error) {
 		for {
 			select {
 			case <-a.ctx.Done():
+				return
+			case err := <-a.adapter.Err():
+				select {
+				case <-a.ctx.Done():
+				case a.errs <- err:
+				}
+
 				return
 			case sid := <-a.ids:
 				candidatesLock.Lock()
+				if id != "" {
+					candidatesLock.Unlock()
+
+					log.Debug().Str("id", sid).Str("name", id).Msg("Reconnected to signaler, keeping claimed name")
+
+					continue
+				}
+
 				candidates = map[string]struct{}{}
 				for _, username := range a.config.Names {
 					candidates[username] = struct{}{}
 				}
-				id = ""
 				candidatesLock.Unlock()
 
 				log.Debug().Str("id", sid).Msg("Claimed ID")
@@ -195,7 +227,7 @@ func (a *NamedAdapter) Open() (chan string, error) {
 						namedPeersCond.L.Unlock()
 					}
 
-					a.acceptedPeers <- peer
+					a.router.deliver(a.ctx, peer)
 				}()
 			case peer := <-a.adapter.Accept():
 				rid := peer.PeerID
@@ -217,8 +249,13 @@ func (a *NamedAdapter) Open() (chan string, error) {
 				if rid != peer.PeerID && peer.ChannelID != a.config.IDChannel {
 					namedPeers <- &Peer{
 						PeerID:    rid,
+						Name:      peer.Name,
 						ChannelID: peer.ChannelID,
 						Conn:      peer.Conn,
+						Metadata:  peer.Metadata,
+						Community: peer.Community,
+						Relayed:   peer.Relayed,
+						close:     peer.close,
 					}
 				}
 				peersLock.Unlock()
@@ -463,8 +500,13 @@ func (a *NamedAdapter) Open() (chan string, error) {
 									if value.ChannelID != a.config.IDChannel {
 										namedPeers <- &Peer{
 											PeerID:    rid,
+											Name:      value.Name,
 											ChannelID: value.ChannelID,
 											Conn:      value.Conn,
+											Metadata:  value.Metadata,
+											Community: value.Community,
+											Relayed:   value.Relayed,
+											close:     value.close,
 										}
 									}
 								}
@@ -505,3 +547,18 @@ func (a *NamedAdapter) Err() chan error {
 func (a *NamedAdapter) Accept() chan *Peer {
 	return a.acceptedPeers
 }
+
+// AcceptChannel returns a channel on which peers will be sent when they connect on a data channel with the label; once it has been called, peers on this label are no longer sent to Accept
+func (a *NamedAdapter) AcceptChannel(channelID string) chan *Peer {
+	return a.router.accept(channelID)
+}
+
+// SendMail sends a small message to a peer through the signaler, which queues it if the peer is offline (see Adapter.SendMail)
+func (a *NamedAdapter) SendMail(community string, to string, payload []byte) error {
+	return a.adapter.SendMail(community, to, payload)
+}
+
+// ChannelBinding returns a token which is unique to the secure transport to a peer (see Adapter.ChannelBinding)
+func (a *NamedAdapter) ChannelBinding(community string, peerID string, label string) ([]byte, error) {
+	return a.adapter.ChannelBinding(community, peerID, label)
+}
@@ -0,0 +1,627 @@
+package wrtcconn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AdaptiveMTU = 1280 // MTU which is recommended for lossy links, so that packets are split into as few SCTP chunks as possible (the minimum IPv6 MTU)
+
+	qualityTypePing = 0 // Measures the round-trip time and loss to a peer
+	qualityTypePong = 1 // Answers a ping
+
+	qualityProbeLength     = 13                     // Type (1 byte), sequence number (4 bytes) and send time (8 bytes)
+	defaultQualityInterval = time.Millisecond * 200 // Default time to wait between probes
+	qualityWindow          = 50                     // Amount of probes over which the loss is measured
+	qualityUpdateProbes    = 10                     // Amount of probes after which the quality is updated
+	qualityRTTWeight       = 0.25                   // Weight of new round-trip time measurements in the smoothed round-trip time
+	qualityMinTimeout      = time.Second            // Minimum time after which unanswered probes are considered to be lost
+
+	adaptiveLossThreshold  = 0.03        // Loss above which adaptive channels switch from reliable to partially reliable delivery
+	adaptiveResidualLoss   = 0.001       // Loss which the retransmissions of partially reliable delivery should reduce the loss to
+	defaultAdaptiveLatency = time.Second // Default maximum time which retransmissions on adaptive channels may take
+	adaptiveMessageLength  = 65536       // Maximum length of messages on adaptive channels
+	adaptiveQueueLength    = 128         // Amount of received messages to queue per adaptive channel
+)
+
+// adaptiveRetransmits are the maximum amounts of retransmissions of the partially reliable channels which are opened for each adaptive channel
+var adaptiveRetransmits = []int{0, 1, 3}
+
+// Quality is the measured quality of the direct connection to a peer
+type Quality struct {
+	RTT            time.Duration // Smoothed round-trip time of the probes
+	Loss           float64       // Fraction of the recent probes which have been lost (0 to 1)
+	MaxRetransmits int           // Maximum amount of retransmissions of writes to adaptive channels (-1 if they are delivered reliably)
+	MTU            int           // Recommended maximum size of the packets which are written to adaptive channels, i.e. for the MTU of a VPN (0 if packets of any size can be written)
+}
+
+// tune selects the reliability of adaptive channels for the quality of a link; retransmissions take at least one round trip each, so links with a high round-trip time get less of them
+func tune(rtt time.Duration, loss float64, latency time.Duration) (retransmits int, mtu int) {
+	if loss < adaptiveLossThreshold {
+		return -1, 0
+	}
+
+	limit := adaptiveRetransmits[len(adaptiveRetransmits)-1]
+	if rtt > 0 {
+		limit = int(latency/rtt) - 1
+	}
+
+	for _, candidate := range adaptiveRetransmits {
+		if candidate > limit {
+			break
+		}
+
+		retransmits = candidate
+
+		if math.Pow(loss, float64(candidate+1)) <= adaptiveResidualLoss {
+			break
+		}
+	}
+
+	return retransmits, AdaptiveMTU
+}
+
+type adaptiveTierKey struct {
+	channelID   string
+	retransmits int
+}
+
+// adaptiveManager measures the quality of the connections to peers and switches the writes to adaptive channels between the reliable channel and partially reliable ones
+type adaptiveManager struct {
+	channels map[string]struct{}
+	tiers    map[string]adaptiveTierKey
+	interval time.Duration
+	latency  time.Duration
+
+	onQuality func(community string, peerID string, quality Quality)
+}
+
+func newAdaptiveManager(channels []string, interval time.Duration, latency time.Duration, onQuality func(community string, peerID string, quality Quality)) *adaptiveManager {
+	if interval <= 0 {
+		interval = defaultQualityInterval
+	}
+
+	if latency <= 0 {
+		latency = defaultAdaptiveLatency
+	}
+
+	m := &adaptiveManager{
+		channels: map[string]struct{}{},
+		tiers:    map[string]adaptiveTierKey{},
+		interval: interval,
+		latency:  latency,
+
+		onQuality: onQuality,
+	}
+
+	for _, channelID := range channels {
+		m.channels[channelID] = struct{}{}
+
+		for _, retransmits := range adaptiveRetransmits {
+			m.tiers[getTierLabel(channelID, retransmits)] = adaptiveTierKey{channelID, retransmits}
+		}
+	}
+
+	return m
+}
+
+func getTierLabel(channelID string, retransmits int) string {
+	return fmt.Sprintf("%v/rexmit/%v", channelID, retransmits)
+}
+
+// labels returns the internal channels to open in addition to the application's channels
+func (m *adaptiveManager) labels() []string {
+	labels := []string{services.QualityPrimary}
+	for label := range m.tiers {
+		labels = append(labels, label)
+	}
+
+	return labels
+}
+
+// isInternal returns whether a channel is used internally to measure the quality or as a partially reliable channel
+func (m *adaptiveManager) isInternal(channelID string) bool {
+	if m == nil {
+		return false
+	}
+
+	if channelID == services.QualityPrimary {
+		return true
+	}
+
+	_, ok := m.tiers[channelID]
+
+	return ok
+}
+
+// getDataChannelInit returns the options for the internal channels (nil for all other channels)
+func (m *adaptiveManager) getDataChannelInit(channelID string) *webrtc.DataChannelInit {
+	if m == nil {
+		return nil
+	}
+
+	ordered := false
+	if channelID == services.QualityPrimary {
+		maxRetransmits := uint16(0)
+
+		return &webrtc.DataChannelInit{
+			Ordered:        &ordered,
+			MaxRetransmits: &maxRetransmits,
+		}
+	}
+
+	tier, ok := m.tiers[channelID]
+	if !ok {
+		return nil
+	}
+
+	maxRetransmits := uint16(tier.retransmits)
+
+	return &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	}
+}
+
+// add takes ownership of the internal channels of a direct connection and wraps its adaptive channels; it returns the peer to deliver to the application or nil if the channel is internal
+func (m *adaptiveManager) add(pr *peer, p *Peer) *Peer {
+	if m == nil {
+		return p
+	}
+
+	if p.ChannelID == services.QualityPrimary {
+		go m.probe(pr, p)
+
+		return nil
+	}
+
+	if tier, ok := m.tiers[p.ChannelID]; ok {
+		pr.adaptive.attach(tier, p.Conn)
+
+		return nil
+	}
+
+	if _, ok := m.channels[p.ChannelID]; ok {
+		p.Conn = pr.adaptive.wrap(p.ChannelID, p.Conn)
+	}
+
+	return p
+}
+
+// probe measures the round-trip time and loss of the connection to a peer by sending it numbered pings on an unreliable channel
+func (m *adaptiveManager) probe(pr *peer, p *Peer) {
+	defer func() {
+		_ = p.Conn.Close()
+
+		// Consumers of the quality reset what they have adapted to the peer
+		if m.onQuality != nil {
+			m.onQuality(p.Community, p.PeerID, Quality{MaxRetransmits: -1})
+		}
+	}()
+
+	var (
+		lock     sync.Mutex
+		sent     = map[uint32]time.Time{}
+		answered = []bool{} // Whether the recent probes have been answered
+		rtt      time.Duration
+
+		writeLock sync.Mutex
+	)
+
+	write := func(typ byte, sequence uint32, sentAt int64) error {
+		b := make([]byte, qualityProbeLength)
+		b[0] = typ
+		binary.BigEndian.PutUint32(b[1:5], sequence)
+		binary.BigEndian.PutUint64(b[5:13], uint64(sentAt))
+
+		writeLock.Lock()
+		defer writeLock.Unlock()
+
+		_, err := p.Conn.Write(b)
+
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, qualityProbeLength)
+		for {
+			n, err := p.Conn.Read(buf)
+			if err != nil {
+				log.Debug().Err(err).Str("peerID", p.PeerID).Msg("Could not read from peer, stopping")
+
+				return
+			}
+
+			if n != qualityProbeLength {
+				continue
+			}
+
+			sequence := binary.BigEndian.Uint32(buf[1:5])
+			switch buf[0] {
+			case qualityTypePing:
+				if err := write(qualityTypePong, sequence, int64(binary.BigEndian.Uint64(buf[5:13]))); err != nil {
+					log.Debug().Err(err).Str("peerID", p.PeerID).Msg("Could not write to peer, continuing")
+				}
+			case qualityTypePong:
+				lock.Lock()
+				if sentAt, ok := sent[sequence]; ok {
+					delete(sent, sequence)
+
+					measured := time.Since(sentAt)
+					if rtt == 0 {
+						rtt = measured
+					} else {
+						rtt = time.Duration(float64(rtt)*(1-qualityRTTWeight) + float64(measured)*qualityRTTWeight)
+					}
+
+					answered = append(answered, true)
+				}
+				lock.Unlock()
+			}
+		}
+	}()
+
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	sequence := uint32(0)
+	for {
+		select {
+		case <-pr.ctx.Done():
+			return
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		sequence++
+		now := time.Now()
+
+		lock.Lock()
+		sent[sequence] = now
+
+		timeout := 4 * rtt
+		if timeout < qualityMinTimeout {
+			timeout = qualityMinTimeout
+		}
+
+		for s, sentAt := range sent {
+			if now.Sub(sentAt) > timeout {
+				delete(sent, s)
+
+				answered = append(answered, false)
+			}
+		}
+
+		if len(answered) > qualityWindow {
+			answered = answered[len(answered)-qualityWindow:]
+		}
+
+		var quality Quality
+		update := sequence%qualityUpdateProbes == 0 && rtt > 0
+		if update {
+			lost := 0
+			for _, ok := range answered {
+				if !ok {
+					lost++
+				}
+			}
+
+			quality.RTT = rtt
+			quality.Loss = float64(lost) / float64(len(answered))
+			quality.MaxRetransmits, quality.MTU = tune(quality.RTT, quality.Loss, m.latency)
+		}
+		lock.Unlock()
+
+		if err := write(qualityTypePing, sequence, now.UnixNano()); err != nil {
+			log.Debug().Err(err).Str("peerID", p.PeerID).Msg("Could not write to peer, continuing")
+		}
+
+		// Peers which don't answer probes (i.e. because they don't measure the quality) are never updated
+		if update {
+			pr.adaptive.update(quality)
+
+			log.Trace().
+				Str("community", p.Community).
+				Str("peerID", p.PeerID).
+				Dur("rtt", quality.RTT).
+				Float64("loss", quality.Loss).
+				Int("maxRetransmits", quality.MaxRetransmits).
+				Msg("Measured quality of connection to peer")
+
+			if m.onQuality != nil {
+				m.onQuality(p.Community, p.PeerID, quality)
+			}
+		}
+	}
+}
+
+// adaptivePeer is the quality and the adaptive channels of the direct connection to a peer
+type adaptivePeer struct {
+	lock     sync.Mutex
+	conns    map[string]*adaptiveConn
+	pending  map[adaptiveTierKey]io.ReadWriteCloser // Partially reliable channels which have been opened before their adaptive channel
+	quality  Quality
+	measured bool
+}
+
+func (s *adaptivePeer) wrap(channelID string, conn io.ReadWriteCloser) io.ReadWriteCloser {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conns == nil {
+		s.conns = map[string]*adaptiveConn{}
+	}
+
+	c := newAdaptiveConn(conn)
+	if s.measured {
+		c.setRetransmits(s.quality.MaxRetransmits)
+	}
+	s.conns[channelID] = c
+
+	for key, tier := range s.pending {
+		if key.channelID == channelID {
+			c.attach(key.retransmits, tier)
+
+			delete(s.pending, key)
+		}
+	}
+
+	return c
+}
+
+func (s *adaptivePeer) attach(key adaptiveTierKey, conn io.ReadWriteCloser) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if c, ok := s.conns[key.channelID]; ok {
+		c.attach(key.retransmits, conn)
+
+		return
+	}
+
+	if s.pending == nil {
+		s.pending = map[adaptiveTierKey]io.ReadWriteCloser{}
+	}
+
+	if old, ok := s.pending[key]; ok {
+		_ = old.Close()
+	}
+	s.pending[key] = conn
+}
+
+func (s *adaptivePeer) update(quality Quality) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.quality = quality
+	s.measured = true
+
+	for _, c := range s.conns {
+		c.setRetransmits(quality.MaxRetransmits)
+		c.hello()
+	}
+}
+
+// current returns the latest quality; it returns false if it hasn't been measured yet
+func (s *adaptivePeer) current() (Quality, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.quality, s.measured
+}
+
+type adaptiveTier struct {
+	conn  io.ReadWriteCloser
+	ready atomic.Bool // Whether the remote peer has sent a hello on the channel, which means that it reads from it
+}
+
+// adaptiveConn reads from a reliable channel and its partially reliable channels and writes to the channel with the current reliability
+type adaptiveConn struct {
+	base     io.ReadWriteCloser
+	messages chan []byte
+	done     chan struct{}
+
+	closeOnce sync.Once
+	err       error // Error which closed the connection; set before done is closed
+
+	lock        sync.Mutex
+	tiers       map[int]*adaptiveTier
+	retransmits int
+}
+
+func newAdaptiveConn(base io.ReadWriteCloser) *adaptiveConn {
+	c := &adaptiveConn{
+		base:     base,
+		messages: make(chan []byte, adaptiveQueueLength),
+		done:     make(chan struct{}),
+
+		tiers:       map[int]*adaptiveTier{},
+		retransmits: -1,
+	}
+
+	go c.read(base, nil)
+
+	return c
+}
+
+func (c *adaptiveConn) read(conn io.ReadWriteCloser, tier *adaptiveTier) {
+	buf := make([]byte, adaptiveMessageLength)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if tier == nil {
+				c.close(err)
+			} else {
+				c.detach(tier)
+			}
+
+			return
+		}
+
+		// Empty messages on partially reliable channels are hellos
+		if n == 0 && tier != nil {
+			tier.ready.Store(true)
+
+			continue
+		}
+
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+
+		select {
+		case c.messages <- msg:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// attach starts reading from a partially reliable channel and tells the remote peer that it can write to it
+func (c *adaptiveConn) attach(retransmits int, conn io.ReadWriteCloser) {
+	tier := &adaptiveTier{conn: conn}
+
+	c.lock.Lock()
+	select {
+	case <-c.done:
+		c.lock.Unlock()
+
+		_ = conn.Close()
+
+		return
+	default:
+	}
+
+	if old, ok := c.tiers[retransmits]; ok {
+		_ = old.conn.Close()
+	}
+	c.tiers[retransmits] = tier
+	c.lock.Unlock()
+
+	go c.read(conn, tier)
+
+	if _, err := conn.Write([]byte{}); err != nil {
+		log.Debug().Err(err).Int("retransmits", retransmits).Msg("Could not write hello to partially reliable channel, continuing")
+	}
+}
+
+func (c *adaptiveConn) detach(tier *adaptiveTier) {
+	c.lock.Lock()
+	for retransmits, t := range c.tiers {
+		if t == tier {
+			delete(c.tiers, retransmits)
+		}
+	}
+	c.lock.Unlock()
+
+	_ = tier.conn.Close()
+}
+
+// hello tells the remote peer again that it can write to the partially reliable channels, as hellos can be lost
+func (c *adaptiveConn) hello() {
+	c.lock.Lock()
+	tiers := []*adaptiveTier{}
+	for _, tier := range c.tiers {
+		tiers = append(tiers, tier)
+	}
+	c.lock.Unlock()
+
+	for _, tier := range tiers {
+		if _, err := tier.conn.Write([]byte{}); err != nil {
+			log.Debug().Err(err).Msg("Could not write hello to partially reliable channel, continuing")
+		}
+	}
+}
+
+func (c *adaptiveConn) setRetransmits(retransmits int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.retransmits = retransmits
+}
+
+// getTier returns the partially reliable channel to write to; it returns nil if writes should be reliable or the remote peer doesn't read from the channel
+func (c *adaptiveConn) getTier() *adaptiveTier {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.retransmits < 0 {
+		return nil
+	}
+
+	tier, ok := c.tiers[c.retransmits]
+	if !ok || !tier.ready.Load() {
+		return nil
+	}
+
+	return tier
+}
+
+// Read reads one message from any of the channels; if p is too small to hold the message, io.ErrShortBuffer is returned and the message is dropped
+func (c *adaptiveConn) Read(p []byte) (int, error) {
+	select {
+	case msg := <-c.messages:
+		if len(msg) > len(p) {
+			return 0, io.ErrShortBuffer
+		}
+
+		return copy(p, msg), nil
+	case <-c.done:
+		return 0, c.err
+	}
+}
+
+// Write writes one message to the channel with the current reliability, falling back to the reliable channel if the partially reliable one can't be written to
+func (c *adaptiveConn) Write(p []byte) (int, error) {
+	if tier := c.getTier(); tier != nil && len(p) > 0 {
+		n, err := tier.conn.Write(p)
+		if err == nil {
+			return n, nil
+		}
+
+		log.Debug().Err(err).Msg("Could not write to partially reliable channel, falling back to reliable channel")
+
+		c.detach(tier)
+	}
+
+	return c.base.Write(p)
+}
+
+// Close closes the reliable channel and all partially reliable ones
+func (c *adaptiveConn) Close() error {
+	return c.close(io.EOF)
+}
+
+func (c *adaptiveConn) close(reason error) error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.lock.Lock()
+		c.err = reason
+		close(c.done)
+
+		tiers := c.tiers
+		c.tiers = map[int]*adaptiveTier{}
+		c.lock.Unlock()
+
+		for _, tier := range tiers {
+			_ = tier.conn.Close()
+		}
+
+		err = c.base.Close()
+	})
+
+	return err
+}
@@ -0,0 +1,187 @@
+package wrtcconn
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	batchHeaderLength = 2     // Length of the length prefix in front of each frame
+	defaultBatchSize  = 16384 // Default maximum size of a batch
+
+	MaxBatchedFrameSize = math.MaxUint16 // Maximum size of a frame which can be batched, which is limited by its length prefix
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame is too large to be batched") // The frame can't fit into a batch
+	ErrInvalidBatch  = errors.New("received invalid batch")           // The received batch could not be split into frames
+)
+
+// BatchConfig configures the batched connection
+type BatchConfig struct {
+	Interval time.Duration // Time to wait before flushing coalesced frames
+	Size     int           // Maximum size of a batch (must not exceed the maximum message size of the channel and must fit the largest frame; see GetBatchSize)
+}
+
+// BatchedConn coalesces multiple small frames into one data channel message
+type BatchedConn struct {
+	conn   io.ReadWriteCloser
+	config *BatchConfig
+
+	writeLock sync.Mutex
+	writeBuf  []byte
+	timer     *time.Timer
+	writeErr  error
+
+	readLock sync.Mutex
+	readBuf  []byte
+	frames   []byte
+}
+
+// NewBatchedConn creates the batched connection
+func NewBatchedConn(
+	conn io.ReadWriteCloser,
+	config *BatchConfig,
+) *BatchedConn {
+	if config == nil {
+		config = &BatchConfig{}
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Microsecond * 500
+	}
+
+	if config.Size <= 0 {
+		config.Size = defaultBatchSize
+	}
+
+	return &BatchedConn{
+		conn:   conn,
+		config: config,
+
+		writeBuf: make([]byte, 0, config.Size),
+		readBuf:  make([]byte, config.Size),
+	}
+}
+
+// GetBatchSize returns the size of batches which fit frames of up to frameSize bytes, which is the default size unless the frames are larger; both peers must use the same size
+func GetBatchSize(frameSize int) (int, error) {
+	if frameSize > MaxBatchedFrameSize {
+		return 0, ErrFrameTooLarge
+	}
+
+	return max(defaultBatchSize, frameSize+batchHeaderLength), nil
+}
+
+// Write queues a frame, which will be sent once the batch is full or the interval has passed
+func (c *BatchedConn) Write(p []byte) (int, error) {
+	if len(p) > MaxBatchedFrameSize || len(p)+batchHeaderLength > c.config.Size {
+		return 0, ErrFrameTooLarge
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+
+	if len(c.writeBuf)+batchHeaderLength+len(p) > c.config.Size {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	header := make([]byte, batchHeaderLength)
+	binary.BigEndian.PutUint16(header, uint16(len(p)))
+
+	c.writeBuf = append(c.writeBuf, header...)
+	c.writeBuf = append(c.writeBuf, p...)
+
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.config.Interval, func() {
+			c.writeLock.Lock()
+			defer c.writeLock.Unlock()
+
+			c.writeErr = c.flush()
+		})
+	}
+
+	return len(p), nil
+}
+
+// Flush sends all queued frames immediately
+func (c *BatchedConn) Flush() error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	return c.flush()
+}
+
+func (c *BatchedConn) flush() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	if len(c.writeBuf) <= 0 {
+		return nil
+	}
+
+	_, err := c.conn.Write(c.writeBuf)
+	c.writeBuf = c.writeBuf[:0]
+
+	return err
+}
+
+// Read reads exactly one frame
+func (c *BatchedConn) Read(p []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.frames) <= 0 {
+		n, err := c.conn.Read(c.readBuf)
+		if err != nil {
+			return 0, err
+		}
+
+		c.frames = c.readBuf[:n]
+	}
+
+	if len(c.frames) < batchHeaderLength {
+		c.frames = nil
+
+		return 0, ErrInvalidBatch
+	}
+
+	length := int(binary.BigEndian.Uint16(c.frames))
+	if len(c.frames) < batchHeaderLength+length {
+		c.frames = nil
+
+		return 0, ErrInvalidBatch
+	}
+
+	n := copy(p, c.frames[batchHeaderLength:batchHeaderLength+length])
+	c.frames = c.frames[batchHeaderLength+length:]
+
+	if n < length {
+		return n, io.ErrShortBuffer
+	}
+
+	return n, nil
+}
+
+// Close flushes all queued frames and closes the underlying connection
+func (c *BatchedConn) Close() error {
+	if err := c.Flush(); err != nil {
+		_ = c.conn.Close()
+
+		return err
+	}
+
+	return c.conn.Close()
+}
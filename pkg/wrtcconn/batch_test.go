@@ -0,0 +1,83 @@
+package wrtcconn_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+)
+
+func TestGetBatchSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		frameSize int
+		want      int
+		wantErr   error
+	}{
+		{"default mtu", 1500 + 14, 16384, nil},
+		{"largest frame which fits the default size", 16382, 16384, nil},
+		{"jumbo frame", 16383, 16385, nil},
+		{"largest frame", wrtcconn.MaxBatchedFrameSize, wrtcconn.MaxBatchedFrameSize + 2, nil},
+		{"frame too large", wrtcconn.MaxBatchedFrameSize + 1, 0, wrtcconn.ErrFrameTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wrtcconn.GetBatchSize(tt.frameSize)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("got size %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestBatchedConnLargeFrames sends frames which don't fit the default batch size through batched connections which derive their size from the frames
+func TestBatchedConnLargeFrames(t *testing.T) {
+	frameSize := 32000
+
+	size, err := wrtcconn.GetBatchSize(frameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, remote := net.Pipe()
+
+	sender := wrtcconn.NewBatchedConn(local, &wrtcconn.BatchConfig{Size: size})
+	defer sender.Close()
+
+	receiver := wrtcconn.NewBatchedConn(remote, &wrtcconn.BatchConfig{Size: size})
+	defer receiver.Close()
+
+	frames := [][]byte{bytes.Repeat([]byte{1}, frameSize), []byte("small"), bytes.Repeat([]byte{2}, frameSize)}
+
+	go func() {
+		for _, frame := range frames {
+			if _, err := sender.Write(frame); err != nil {
+				t.Error(err)
+
+				return
+			}
+		}
+
+		if err := sender.Flush(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	buf := make([]byte, frameSize)
+	for _, want := range frames {
+		n, err := receiver.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf[:n], want) {
+			t.Fatalf("got frame of length %v, want length %v", n, len(want))
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package wrtcconn
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2/pkg/crypto/fingerprint"
+	"github.com/pion/webrtc/v3"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	bindingNonceLength = 32 // Length of the random nonce which each peer contributes to the channel binding
+	bindingLength      = 32 // Length of the derived channel binding
+)
+
+var (
+	ErrPeerNotConnected        = errors.New("peer is not connected directly")                   // Channel bindings can only be derived for peers with an established DTLS transport, not for relayed or routed ones
+	ErrChannelBindingsDisabled = errors.New("channel bindings are disabled")                    // The adapter hasn't been configured to exchange nonces with its peers (see AdapterConfig.ChannelBindings)
+	ErrChannelBindingTimeout   = errors.New("timed out waiting for channel binding nonce")      // The peer hasn't sent its nonce in time (i.e. because it hasn't enabled channel bindings)
+	ErrInvalidBindingNonce     = errors.New("peer has sent a nonce with an unsupported length") // The nonce of the peer can't be used to derive channel bindings
+
+	bindingInfo = []byte("weron/binding/v1")
+)
+
+// bindingPeer holds the random nonces which have been exchanged with a peer over the internal binding channel of its direct connection
+type bindingPeer struct {
+	local  []byte
+	remote []byte
+
+	ready     chan struct{} // Closed once the nonce of the peer has been received
+	readyOnce sync.Once
+}
+
+func newBindingPeer() *bindingPeer {
+	local := make([]byte, bindingNonceLength)
+	if _, err := rand.Read(local); err != nil {
+		panic(err)
+	}
+
+	return &bindingPeer{
+		local: local,
+		ready: make(chan struct{}),
+	}
+}
+
+// add takes ownership of the binding channel of a direct connection; it returns the peer to deliver to the application or nil if the channel is internal (or if p is nil)
+func (b *bindingPeer) add(p *Peer) *Peer {
+	if p == nil || p.ChannelID != services.BindingPrimary {
+		return p
+	}
+
+	go func() {
+		if err := b.exchange(p.Conn); err != nil {
+			log.Debug().Err(err).Str("peerID", p.PeerID).Msg("Could not exchange channel binding nonces with peer, continuing")
+		}
+	}()
+
+	return nil
+}
+
+// exchange sends the local nonce to the peer and waits for its nonce; the channel is protected by DTLS, so only the two endpoints of the transport learn the nonces
+func (b *bindingPeer) exchange(conn io.ReadWriter) error {
+	if _, err := conn.Write(b.local); err != nil {
+		return err
+	}
+
+	buf := make([]byte, bindingNonceLength*2)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+
+	if n != bindingNonceLength {
+		return ErrInvalidBindingNonce
+	}
+
+	b.readyOnce.Do(func() {
+		b.remote = buf[:n]
+
+		close(b.ready)
+	})
+
+	return nil
+}
+
+// ChannelBinding returns a token which is unique to the secure transport to a peer and which the peer derives identically for the same label, so that applications can prove to a backend that both endpoints share the same transport (i.e. by having both of them submit the token); both peers must enable AdapterConfig.ChannelBindings
+//
+// pion doesn't expose the DTLS keying material exporter (RFC 5705), so both peers send each other a random nonce over an
+// internal data channel, which is protected by DTLS, once the connection has been established. The token is derived
+// from both nonces with HKDF, which is salted with the SHA-256 fingerprints of the certificates that the DTLS handshake
+// has authenticated; third parties which only know the fingerprints (i.e. from the signaling messages) can't derive it,
+// and a peer in the middle would have to present different certificates to both sides, so their tokens wouldn't match.
+// It changes whenever the connection to the peer is replaced.
+func (a *Adapter) ChannelBinding(community string, peerID string, label string) ([]byte, error) {
+	if !a.config.ChannelBindings {
+		return nil, ErrChannelBindingsDisabled
+	}
+
+	a.transportsLock.Lock()
+	getTransport := a.getTransport
+	a.transportsLock.Unlock()
+
+	if getTransport == nil {
+		return nil, ErrPeerNotConnected
+	}
+
+	transport, binding := getTransport(community, peerID)
+	if transport == nil || transport.State() != webrtc.DTLSTransportStateConnected {
+		return nil, ErrPeerNotConnected
+	}
+
+	select {
+	case <-binding.ready:
+	case <-time.After(a.config.Timeout):
+		return nil, ErrChannelBindingTimeout
+	}
+
+	return getChannelBinding(transport, binding, label)
+}
+
+// getChannelBinding derives the channel binding from the nonces of both peers and the fingerprints of their certificates
+func getChannelBinding(transport *webrtc.DTLSTransport, binding *bindingPeer, label string) ([]byte, error) {
+	parameters, err := transport.GetLocalParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	local := ""
+	for _, f := range parameters.Fingerprints {
+		if f.Algorithm == "sha-256" {
+			local = f.Value
+
+			break
+		}
+	}
+
+	if local == "" {
+		return nil, ErrPeerNotConnected
+	}
+
+	certificate, err := x509.ParseCertificate(transport.GetRemoteCertificate())
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := fingerprint.Fingerprint(certificate, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	return deriveChannelBinding(local, binding.local, remote, binding.remote, label)
+}
+
+// deriveChannelBinding orders the fingerprints and nonces of both peers lexicographically by fingerprint, so that both sides derive the same token
+func deriveChannelBinding(localFingerprint string, localNonce []byte, remoteFingerprint string, remoteNonce []byte, label string) ([]byte, error) {
+	if remoteFingerprint < localFingerprint {
+		localFingerprint, remoteFingerprint = remoteFingerprint, localFingerprint
+		localNonce, remoteNonce = remoteNonce, localNonce
+	}
+
+	secret := append(append([]byte{}, localNonce...), remoteNonce...)
+	salt := append(append([]byte(localFingerprint), 0), []byte(remoteFingerprint)...)
+	info := append(append(append([]byte{}, bindingInfo...), 0), []byte(label)...)
+
+	token := make([]byte, bindingLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
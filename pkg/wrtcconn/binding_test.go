@@ -0,0 +1,116 @@
+package wrtcconn_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtctest"
+)
+
+const (
+	bindingChannel   = "primary"
+	bindingCommunity = "binding"
+	bindingLabel     = "weron/test"
+	bindingTimeout   = time.Second * 30
+)
+
+// TestChannelBinding connects three adapters with each other; both ends of a connection must derive the same channel binding, and the third adapter, which knows the fingerprints of both from their signaling messages, must not be able to derive it
+func TestChannelBinding(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), bindingTimeout)
+	defer cancel()
+
+	signaler := wrtctest.NewSignaler(nil, ctx)
+	if err := signaler.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer signaler.Close()
+
+	adapters := []*wrtcconn.Adapter{}
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		adapter := signaler.NewAdapter(bindingCommunity, []string{bindingChannel}, &wrtcconn.AdapterConfig{
+			ChannelBindings: true,
+		}, ctx)
+		defer adapter.Close()
+
+		c, err := adapter.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case id := <-c:
+			ids = append(ids, id)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for adapter to join")
+		}
+
+		adapters = append(adapters, adapter)
+	}
+
+	// Each adapter connects to both others
+	for _, adapter := range adapters {
+		for i := 0; i < len(adapters)-1; i++ {
+			select {
+			case <-adapter.Accept():
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for adapters to connect")
+			}
+		}
+	}
+
+	getBinding := func(from int, to int, label string) []byte {
+		t.Helper()
+
+		binding, err := adapters[from].ChannelBinding(bindingCommunity, ids[to], label)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return binding
+	}
+
+	ab, ba := getBinding(0, 1, bindingLabel), getBinding(1, 0, bindingLabel)
+	if !bytes.Equal(ab, ba) {
+		t.Fatalf("got different bindings %x and %x for both ends of the same connection", ab, ba)
+	}
+
+	if other := getBinding(0, 1, bindingLabel+"/other"); bytes.Equal(ab, other) {
+		t.Fatal("got the same binding for different labels")
+	}
+
+	for _, binding := range [][]byte{getBinding(2, 0, bindingLabel), getBinding(2, 1, bindingLabel), getBinding(0, 2, bindingLabel), getBinding(1, 2, bindingLabel)} {
+		if bytes.Equal(ab, binding) {
+			t.Fatal("third adapter derived the binding of a connection which it is not an endpoint of")
+		}
+	}
+
+	if _, err := adapters[0].ChannelBinding(bindingCommunity, "unknown", bindingLabel); err != wrtcconn.ErrPeerNotConnected {
+		t.Fatalf("got %v, want %v", err, wrtcconn.ErrPeerNotConnected)
+	}
+}
+
+func TestChannelBindingDisabled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), bindingTimeout)
+	defer cancel()
+
+	signaler := wrtctest.NewSignaler(nil, ctx)
+	if err := signaler.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer signaler.Close()
+
+	adapter := signaler.NewAdapter(bindingCommunity, []string{bindingChannel}, nil, ctx)
+	defer adapter.Close()
+
+	if _, err := adapter.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := adapter.ChannelBinding(bindingCommunity, "unknown", bindingLabel); err != wrtcconn.ErrChannelBindingsDisabled {
+		t.Fatalf("got %v, want %v", err, wrtcconn.ErrChannelBindingsDisabled)
+	}
+}
@@ -0,0 +1,156 @@
+package wrtcconn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	peerCacheMaxAge        = time.Hour * 24 // Time after which cached peers are no longer reconnected to
+	peerCacheMaxCandidates = 16             // Maximum amount of candidates to cache per peer
+)
+
+// cachedPeer is a peer which has been connected to before; its descriptions can't be reused, as the ICE credentials and DTLS fingerprints change with every connection, but its session, metadata and candidates can
+type cachedPeer struct {
+	Community   string    `json:"community"`
+	PeerID      string    `json:"peerID"`
+	Session     string    `json:"session"`
+	Name        string    `json:"name,omitempty"`
+	Metadata    []byte    `json:"metadata,omitempty"`
+	Candidates  []string  `json:"candidates,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// peerCache persists the peers which have been connected to, so that they can be reconnected to immediately after a restart
+type peerCache struct {
+	path string
+
+	lock  sync.Mutex
+	peers map[string]map[string]cachedPeer
+}
+
+// loadPeerCache reads the cached peers from a file; a missing file is treated as an empty cache
+func loadPeerCache(path string) (*peerCache, error) {
+	c := &peerCache{
+		path:  path,
+		peers: map[string]map[string]cachedPeer{},
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+
+		return nil, err
+	}
+
+	cached := []cachedPeer{}
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return nil, err
+	}
+
+	for _, p := range cached {
+		if time.Since(p.ConnectedAt) > peerCacheMaxAge {
+			continue
+		}
+
+		if _, ok := c.peers[p.Community]; !ok {
+			c.peers[p.Community] = map[string]cachedPeer{}
+		}
+
+		c.peers[p.Community][p.PeerID] = p
+	}
+
+	return c, nil
+}
+
+// list returns the cached peers of a community which haven't expired yet
+func (c *peerCache) list(community string) []cachedPeer {
+	if c == nil {
+		return []cachedPeer{}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	peers := []cachedPeer{}
+	for _, p := range c.peers[community] {
+		if time.Since(p.ConnectedAt) > peerCacheMaxAge {
+			continue
+		}
+
+		peers = append(peers, p)
+	}
+
+	return peers
+}
+
+// candidates returns the cached candidates of a peer
+func (c *peerCache) candidates(community string, peerID string) []string {
+	if c == nil {
+		return []string{}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]string{}, c.peers[community][peerID].Candidates...)
+}
+
+// put caches a peer which has been connected to and writes the cache to its file
+func (c *peerCache) put(p cachedPeer) error {
+	if c == nil {
+		return nil
+	}
+
+	if len(p.Candidates) > peerCacheMaxCandidates {
+		p.Candidates = p.Candidates[len(p.Candidates)-peerCacheMaxCandidates:]
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.peers[p.Community]; !ok {
+		c.peers[p.Community] = map[string]cachedPeer{}
+	}
+	c.peers[p.Community][p.PeerID] = p
+
+	cached := []cachedPeer{}
+	for _, peers := range c.peers {
+		for _, p := range peers {
+			cached = append(cached, p)
+		}
+	}
+
+	b, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that an interrupted write can't leave a partial cache behind
+	f, err := os.CreateTemp(filepath.Dir(c.path), "."+filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path)
+}
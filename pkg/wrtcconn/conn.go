@@ -0,0 +1,156 @@
+package wrtcconn
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	bufferedConnPollInterval = time.Millisecond * 100 // Time to wait before re-checking the state of a blocked channel
+)
+
+// bufferedConn blocks writes while the amount of buffered data of a channel exceeds a limit
+type bufferedConn struct {
+	io.ReadWriteCloser
+
+	dc  *webrtc.DataChannel
+	max uint64
+	low chan struct{}
+}
+
+func newBufferedConn(conn io.ReadWriteCloser, dc *webrtc.DataChannel, max uint64) *bufferedConn {
+	c := &bufferedConn{
+		ReadWriteCloser: conn,
+
+		dc:  dc,
+		max: max,
+		low: make(chan struct{}, 1),
+	}
+
+	dc.SetBufferedAmountLowThreshold(max / 2)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case c.low <- struct{}{}:
+		default:
+		}
+	})
+
+	return c
+}
+
+// wait blocks until the amount of buffered data is below the limit
+func (c *bufferedConn) wait() error {
+	for c.dc.BufferedAmount() > c.max {
+		if c.dc.ReadyState() != webrtc.DataChannelStateOpen {
+			return io.ErrClosedPipe
+		}
+
+		select {
+		case <-c.low:
+		case <-time.After(bufferedConnPollInterval):
+		}
+	}
+
+	return nil
+}
+
+func (c *bufferedConn) Write(p []byte) (int, error) {
+	if err := c.wait(); err != nil {
+		return 0, err
+	}
+
+	return c.ReadWriteCloser.Write(p)
+}
+
+func (c *bufferedConn) ReadDataChannel(p []byte) (int, bool, error) {
+	if mc, ok := c.ReadWriteCloser.(messageConn); ok {
+		return mc.ReadDataChannel(p)
+	}
+
+	n, err := c.ReadWriteCloser.Read(p)
+
+	return n, false, err
+}
+
+func (c *bufferedConn) WriteDataChannel(p []byte, isString bool) (int, error) {
+	if err := c.wait(); err != nil {
+		return 0, err
+	}
+
+	if mc, ok := c.ReadWriteCloser.(messageConn); ok {
+		return mc.WriteDataChannel(p, isString)
+	}
+
+	if isString {
+		return 0, ErrStringMessagesUnsupported
+	}
+
+	return c.ReadWriteCloser.Write(p)
+}
+
+// droppingConn drops writes while the amount of buffered data of a channel exceeds a limit instead of blocking them, so that only fresh data is sent
+type droppingConn struct {
+	io.ReadWriteCloser
+
+	dc        *webrtc.DataChannel
+	threshold uint64
+	dropped   *uint64
+}
+
+func newDroppingConn(conn io.ReadWriteCloser, dc *webrtc.DataChannel, threshold uint64, dropped *uint64) *droppingConn {
+	return &droppingConn{
+		ReadWriteCloser: conn,
+
+		dc:        dc,
+		threshold: threshold,
+		dropped:   dropped,
+	}
+}
+
+// congested returns whether the next write should be dropped; dropped writes are reported as successful, just like lost messages
+func (c *droppingConn) congested() bool {
+	if c.dc.BufferedAmount() <= c.threshold {
+		return false
+	}
+
+	atomic.AddUint64(c.dropped, 1)
+
+	return true
+}
+
+func (c *droppingConn) Write(p []byte) (int, error) {
+	if c.congested() {
+		return len(p), nil
+	}
+
+	return c.ReadWriteCloser.Write(p)
+}
+
+func (c *droppingConn) ReadDataChannel(p []byte) (int, bool, error) {
+	if mc, ok := c.ReadWriteCloser.(messageConn); ok {
+		return mc.ReadDataChannel(p)
+	}
+
+	n, err := c.ReadWriteCloser.Read(p)
+
+	return n, false, err
+}
+
+func (c *droppingConn) WriteDataChannel(p []byte, isString bool) (int, error) {
+	if c.congested() {
+		return len(p), nil
+	}
+
+	if mc, ok := c.ReadWriteCloser.(messageConn); ok {
+		return mc.WriteDataChannel(p, isString)
+	}
+
+	if isString {
+		return 0, ErrStringMessagesUnsupported
+	}
+
+	return c.ReadWriteCloser.Write(p)
+}
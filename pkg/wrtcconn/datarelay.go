@@ -0,0 +1,227 @@
+package wrtcconn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/pojntfx/weron/pkg/wrtcenc"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrDataRelayUnavailable = errors.New("not connected to a data relay") // None of the data relays could be reached
+)
+
+type dataRelayConn struct {
+	conn        *websocket.Conn
+	version     string
+	messageType int
+
+	writeLock sync.Mutex
+}
+
+// dataRelay relays channels through data relays (see wrtcrly) instead of the signaler; each community uses its own connection, which fails over to the next data relay if it is lost
+type dataRelay struct {
+	urls        []string
+	token       string
+	id          string
+	communities map[string]string
+	timeout     time.Duration
+	family      string
+	binary      bool
+	cipher      wrtcenc.Cipher
+	ctx         context.Context
+	onRelay     func(community string, relay *websocketapi.Relay)
+
+	connsLock sync.Mutex
+	conns     map[string]*dataRelayConn
+}
+
+func newDataRelay(
+	urls []string,
+	token string,
+	id string,
+	communities map[string]string,
+	timeout time.Duration,
+	family string,
+	binary bool,
+	cipher wrtcenc.Cipher,
+	ctx context.Context,
+	onRelay func(community string, relay *websocketapi.Relay),
+) *dataRelay {
+	return &dataRelay{
+		urls:        urls,
+		token:       token,
+		id:          id,
+		communities: communities,
+		timeout:     timeout,
+		family:      family,
+		binary:      binary,
+		cipher:      cipher,
+		ctx:         ctx,
+		onRelay:     onRelay,
+
+		conns: map[string]*dataRelayConn{},
+	}
+}
+
+// open connects to the data relays in the background, starting the goroutines with spawn
+func (d *dataRelay) open(spawn func(func())) {
+	for community := range d.communities {
+		community := community
+		spawn(func() {
+			for i := 0; ; i++ {
+				if d.ctx.Err() != nil {
+					return
+				}
+
+				raddr := d.urls[i%len(d.urls)]
+				if err := d.serve(community, raddr); err != nil {
+					log.Debug().Err(err).Str("address", raddr).Str("community", community).Msg("Disconnected from data relay, trying next one")
+				}
+
+				select {
+				case <-d.ctx.Done():
+					return
+				case <-time.After(d.timeout):
+				}
+			}
+		})
+	}
+}
+
+func (d *dataRelay) serve(community string, raddr string) error {
+	u, err := url.Parse(raddr)
+	if err != nil {
+		return err
+	}
+
+	q := u.Query()
+	q.Set("community", community)
+	q.Set("id", d.id)
+	u.RawQuery = q.Encode()
+
+	header := http.Header{}
+	if d.token != "" {
+		header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	dialer := NewWebSocketDialer(d.family)
+	if d.binary {
+		dialer.Subprotocols = websocketapi.Versions
+	}
+
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	conn, _, err := dialer.DialContext(ctx, u.String(), header)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Data relays which don't support version negotiation always use JSON
+	c := &dataRelayConn{
+		conn:        conn,
+		version:     conn.Subprotocol(),
+		messageType: websocket.BinaryMessage,
+	}
+	if c.version != websocketapi.VersionBinary {
+		c.version = websocketapi.VersionJSON
+		c.messageType = websocket.TextMessage
+	}
+
+	d.connsLock.Lock()
+	d.conns[community] = c
+	d.connsLock.Unlock()
+
+	defer func() {
+		d.connsLock.Lock()
+		if current, ok := d.conns[community]; ok && current == c {
+			delete(d.conns, community)
+		}
+		d.connsLock.Unlock()
+	}()
+
+	log.Debug().Str("address", raddr).Str("community", community).Str("version", c.version).Msg("Connected to data relay")
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-d.ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, p, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var relay websocketapi.Relay
+		if err := websocketapi.Unmarshal(p, &relay); err != nil || relay.Message == nil {
+			log.Debug().Str("address", raddr).Str("community", community).Msg("Could not unmarshal relayed payload from data relay, continuing")
+
+			continue
+		}
+
+		if relay.Type == websocketapi.TypeRelay {
+			relay.Payload, err = d.cipher.Decrypt(relay.Payload, []byte(d.communities[community]))
+			if err != nil {
+				log.Debug().Str("address", raddr).Str("community", community).Str("peerID", relay.From).Msg("Could not decrypt relayed payload from data relay, continuing")
+
+				continue
+			}
+		}
+
+		d.onRelay(community, &relay)
+	}
+}
+
+func (d *dataRelay) write(community string, relay *websocketapi.Relay) error {
+	d.connsLock.Lock()
+	c, ok := d.conns[community]
+	d.connsLock.Unlock()
+
+	if !ok {
+		return ErrDataRelayUnavailable
+	}
+
+	p, err := websocketapi.Marshal(c.version, relay)
+	if err != nil {
+		return err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(d.timeout)); err != nil {
+		return err
+	}
+
+	return c.conn.WriteMessage(c.messageType, p)
+}
+
+// send relays a payload to a channel of a peer; payloads are encrypted with the key of the community, so data relays can't read them
+func (d *dataRelay) send(community string, to string, channelID string, payload []byte) error {
+	p, err := d.cipher.Encrypt(payload, []byte(d.communities[community]))
+	if err != nil {
+		return err
+	}
+
+	return d.write(community, websocketapi.NewRelay(d.id, to, channelID, p))
+}
+
+// sendClose notifies a peer that a relayed channel has been closed
+func (d *dataRelay) sendClose(community string, to string, channelID string) error {
+	return d.write(community, websocketapi.NewRelayClose(d.id, to, channelID))
+}
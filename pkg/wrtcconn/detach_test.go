@@ -0,0 +1,205 @@
+package wrtcconn
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	benchmarkMessageSize    = 1400             // Size of a message, which is about the size of a frame at the default MTU
+	benchmarkSendBuffer     = 1024 * 1024      // Amount of bytes to buffer before writes block, so that the writer can't outrun the reader
+	benchmarkConnectTimeout = time.Second * 10 // Time to wait for the channel to open
+)
+
+// newBenchmarkPeers connects two in-process peer connections over loopback and returns the opened channels of both sides
+func newBenchmarkPeers(b *testing.B, detach bool) (*webrtc.DataChannel, *webrtc.DataChannel) {
+	b.Helper()
+
+	settingEngine := webrtc.SettingEngine{}
+	if detach {
+		settingEngine.DetachDataChannels()
+	}
+	settingEngine.SetIncludeLoopbackCandidate(true)
+	settingEngine.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(settingEngine))
+
+	offerer, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = offerer.Close() })
+
+	answerer, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = answerer.Close() })
+
+	local, err := offerer.CreateDataChannel("primary", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	opened := make(chan struct{}, 2)
+	local.OnOpen(func() {
+		opened <- struct{}{}
+	})
+
+	remotes := make(chan *webrtc.DataChannel, 1)
+	answerer.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnOpen(func() {
+			remotes <- dc
+			opened <- struct{}{}
+		})
+	})
+
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	gathered := webrtc.GatheringCompletePromise(offerer)
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		b.Fatal(err)
+	}
+	<-gathered
+
+	if err := answerer.SetRemoteDescription(*offerer.LocalDescription()); err != nil {
+		b.Fatal(err)
+	}
+
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	gathered = webrtc.GatheringCompletePromise(answerer)
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		b.Fatal(err)
+	}
+	<-gathered
+
+	if err := offerer.SetRemoteDescription(*answerer.LocalDescription()); err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-opened:
+		case <-time.After(benchmarkConnectTimeout):
+			b.Fatal("timed out waiting for channel to open")
+		}
+	}
+
+	return local, <-remotes
+}
+
+// benchmarkTransfer writes b.N messages with write and waits until read has received all of them
+func benchmarkTransfer(b *testing.B, write func(p []byte) error, read func() error) {
+	b.Helper()
+
+	msg := make([]byte, benchmarkMessageSize)
+
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if err := read(); err != nil {
+				errs <- err
+
+				return
+			}
+		}
+
+		errs <- nil
+	}()
+
+	b.SetBytes(benchmarkMessageSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := write(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if err := <-errs; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkDataChannel compares the detached read/write path which adapters use with OnMessage callbacks, which need a copy into and a goroutine hop through a Go channel per message
+func BenchmarkDataChannel(b *testing.B) {
+	b.Run("detached", func(b *testing.B) {
+		local, remote := newBenchmarkPeers(b, true)
+
+		a := &Adapter{config: &AdapterConfig{SCTPMaxSendBufferSize: benchmarkSendBuffer}}
+
+		writer, err := a.detach(local)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		reader, err := a.detach(remote)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		buf := make([]byte, benchmarkMessageSize)
+		benchmarkTransfer(b, func(p []byte) error {
+			_, err := writer.Write(p)
+
+			return err
+		}, func() error {
+			_, err := reader.Read(buf)
+
+			return err
+		})
+	})
+
+	b.Run("callback", func(b *testing.B) {
+		local, remote := newBenchmarkPeers(b, false)
+
+		messages := make(chan []byte, 1024)
+		remote.OnMessage(func(msg webrtc.DataChannelMessage) {
+			messages <- msg.Data
+		})
+
+		// Callbacks don't block writes, so the writer waits for the buffer to drain like the detached path
+		writer := newBufferedConn(nopReadWriteCloser{send: local.Send}, local, benchmarkSendBuffer)
+
+		benchmarkTransfer(b, func(p []byte) error {
+			_, err := writer.Write(p)
+
+			return err
+		}, func() error {
+			<-messages
+
+			return nil
+		})
+	})
+}
+
+// nopReadWriteCloser writes with a send function and can't be read from
+type nopReadWriteCloser struct {
+	send func(p []byte) error
+}
+
+func (c nopReadWriteCloser) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (c nopReadWriteCloser) Write(p []byte) (int, error) {
+	if err := c.send(p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (c nopReadWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,43 @@
+package wrtcconn
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pojntfx/weron/internal/dualstack"
+)
+
+const (
+	happyEyeballsDelay = time.Millisecond * 250 // Time to wait for a connection over the preferred IP family of a dual-stack host before racing the other one (RFC 8305)
+)
+
+// getNetwork returns the network to dial in an IP family (i.e. tcp6 for tcp in IPv6); the base network is returned if no family is set, which dials both
+func getNetwork(base string, family string) string {
+	switch family {
+	case IPFamilyIPv4:
+		return base + "4"
+	case IPFamilyIPv6:
+		return base + "6"
+	default:
+		return base
+	}
+}
+
+// NewWebSocketDialer creates a WebSocket dialer which connects to signalers and data relays in an IP family; if no family is set, hosts with both IPv4 and IPv6 addresses are dialed with happy eyeballs, so that a broken family doesn't delay connecting
+func NewWebSocketDialer(family string) *websocket.Dialer {
+	netDialer := &net.Dialer{}
+
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dualstack.Dial(ctx, getNetwork(network, family), addr, happyEyeballsDelay, netDialer.DialContext, closeConn)
+	}
+
+	return &dialer
+}
+
+// closeConn closes a connection which is no longer needed
+func closeConn(conn net.Conn) {
+	_ = conn.Close()
+}
@@ -0,0 +1,18 @@
+// Package wrtcconn provides connection services which connect peers over WebRTC using a signaler.
+//
+// # Supervision
+//
+// All long-running goroutines of an Adapter are started in its group, so that Close can wait for them; the signaler
+// connection loop starts the goroutines of each connection in the group too and stops them before reconnecting.
+// Short-lived goroutines which are started by WebRTC handlers aren't part of the group, but they only block on sends which
+// are aborted once the context is cancelled.
+//
+// # Shutdown
+//
+// Close shuts the Adapter down in this order:
+//
+//  1. The context is cancelled, which stops accepting new peers, aborts pending sends and stops the ICE server refreshes, the gossip mesh and the data relays
+//  2. The signaler connection loop closes the connection to the signaler, waits for its reader and closes all remaining peers
+//  3. Close waits for all goroutines in the group to exit
+//  4. The UDP mux, which the peer connections use, is closed
+package wrtcconn
@@ -0,0 +1,140 @@
+package wrtcconn
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pion/ice/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	maxDSCP = 63 // DSCP is a 6-bit field
+)
+
+var (
+	ErrInvalidDSCP = errors.New("invalid DSCP class, must be a class name (i.e. EF, AF41 or CS6) or a number between 0 and 63") // The specified DSCP class is invalid
+
+	dscpClasses = map[string]int{
+		"CS0":  0,
+		"CS1":  8,
+		"AF11": 10,
+		"AF12": 12,
+		"AF13": 14,
+		"CS2":  16,
+		"AF21": 18,
+		"AF22": 20,
+		"AF23": 22,
+		"CS3":  24,
+		"AF31": 26,
+		"AF32": 28,
+		"AF33": 30,
+		"CS4":  32,
+		"AF41": 34,
+		"AF42": 36,
+		"AF43": 38,
+		"CS5":  40,
+		"EF":   46,
+		"CS6":  48,
+		"CS7":  56,
+	}
+)
+
+// ParseDSCP parses a DSCP class name (i.e. EF or AF41) or a numeric DSCP value
+func ParseDSCP(class string) (int, error) {
+	class = strings.ToUpper(strings.TrimSpace(class))
+	if class == "" {
+		return 0, nil
+	}
+
+	if dscp, ok := dscpClasses[class]; ok {
+		return dscp, nil
+	}
+
+	dscp, err := strconv.Atoi(class)
+	if err != nil || dscp < 0 || dscp > maxDSCP {
+		return 0, ErrInvalidDSCP
+	}
+
+	return dscp, nil
+}
+
+// setDSCP marks the traffic of a stream connection (i.e. to a TURN server) with a DSCP class
+func setDSCP(conn net.Conn, dscp int) error {
+	// The DSCP is stored in the upper 6 bits of the traffic class
+	tos := dscp << 2
+
+	addr, ok := conn.LocalAddr().(*net.TCPAddr)
+	if ok && addr.IP.To4() == nil {
+		return ipv6.NewConn(conn).SetTrafficClass(tos)
+	}
+
+	return ipv4.NewConn(conn).SetTOS(tos)
+}
+
+// listenDSCP listens on all local interfaces with sockets which mark their traffic with a DSCP class; the candidate filters have to be applied here, as they are ignored for muxed sockets
+func listenDSCP(dscp int, includeInterface func(string) bool, includeIP func(net.IP) bool) (ice.UDPMux, error) {
+	// The DSCP is stored in the upper 6 bits of the traffic class
+	tos := dscp << 2
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	conns := []*net.UDPConn{}
+	closeConns := func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || !includeInterface(iface.Name) {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Debug().Err(err).Str("interface", iface.Name).Msg("Could not get addresses of interface, continuing")
+
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() || !includeIP(ipNet.IP) {
+				continue
+			}
+
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ipNet.IP, Port: 0})
+			if err != nil {
+				closeConns()
+
+				return nil, err
+			}
+			conns = append(conns, conn)
+
+			if ipNet.IP.To4() != nil {
+				err = ipv4.NewPacketConn(conn).SetTOS(tos)
+			} else {
+				err = ipv6.NewPacketConn(conn).SetTrafficClass(tos)
+			}
+
+			if err != nil {
+				log.Debug().Err(err).Str("address", conn.LocalAddr().String()).Int("dscp", dscp).Msg("Could not set DSCP class, continuing")
+			}
+		}
+	}
+
+	muxes := []ice.UDPMux{}
+	for _, conn := range conns {
+		muxes = append(muxes, ice.NewUDPMuxDefault(ice.UDPMuxParams{UDPConn: conn}))
+	}
+
+	return ice.NewMultiUDPMuxDefault(muxes...), nil
+}
@@ -0,0 +1,98 @@
+package wrtcconn_test
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcsgl"
+	"github.com/pojntfx/weron/pkg/wrtctest"
+)
+
+const (
+	dualStackTimeout = time.Second * 10
+)
+
+// TestDualStackSignaler joins signalers which listen on IPv4, IPv6 or both with every IP family; adapters must only connect if the signaler is reachable in their family
+func TestDualStackSignaler(t *testing.T) {
+	tests := []struct {
+		name        string
+		laddr       string // Address the signaler listens on
+		host        string // IP literal the adapter connects to
+		family      string
+		wantConnect bool
+	}{
+		{"ipv4 signaler", "127.0.0.1:0", "127.0.0.1", "", true},
+		{"ipv4 signaler in ipv4", "127.0.0.1:0", "127.0.0.1", wrtcconn.IPFamilyIPv4, true},
+		{"ipv4 signaler in ipv6", "127.0.0.1:0", "127.0.0.1", wrtcconn.IPFamilyIPv6, false},
+		{"ipv6 signaler", "[::1]:0", "::1", "", true},
+		{"ipv6 signaler in ipv4", "[::1]:0", "::1", wrtcconn.IPFamilyIPv4, false},
+		{"ipv6 signaler in ipv6", "[::1]:0", "::1", wrtcconn.IPFamilyIPv6, true},
+		{"wildcard signaler over ipv4", ":0", "127.0.0.1", "", true},
+		{"wildcard signaler over ipv6", ":0", "::1", "", true},
+		{"wildcard signaler over ipv6 in ipv6", ":0", "::1", wrtcconn.IPFamilyIPv6, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), dualStackTimeout)
+			defer cancel()
+
+			signaler := wrtcsgl.NewSignaler(tt.laddr, "", "", &wrtcsgl.SignalerConfig{
+				Heartbeat:            time.Second * 10,
+				EphemeralCommunities: true,
+			}, ctx)
+			if err := signaler.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer signaler.Close()
+
+			q := url.Values{}
+			q.Set("community", "dualstack")
+			q.Set("password", wrtctest.Password)
+
+			u := url.URL{
+				Scheme:   "ws",
+				Host:     net.JoinHostPort(tt.host, strconv.Itoa(signaler.Addr().(*net.TCPAddr).Port)),
+				Path:     "/",
+				RawQuery: q.Encode(),
+			}
+
+			reconnecting := make(chan struct{}, 1)
+			adapter := wrtcconn.NewAdapter(u.String(), wrtctest.Key, []string{}, []string{"primary"}, &wrtcconn.AdapterConfig{
+				Timeout:         time.Second,
+				IncludeLoopback: true,
+				IPFamily:        tt.family,
+				OnSignalerReconnect: func() {
+					select {
+					case reconnecting <- struct{}{}:
+					default:
+					}
+				},
+			}, ctx)
+
+			ids, err := adapter.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer adapter.Close()
+
+			select {
+			case <-ids:
+				if !tt.wantConnect {
+					t.Fatal("connected to signaler, want no connection")
+				}
+			case <-reconnecting:
+				if tt.wantConnect {
+					t.Fatal("could not connect to signaler, want connection")
+				}
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		})
+	}
+}
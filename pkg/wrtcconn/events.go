@@ -0,0 +1,102 @@
+package wrtcconn
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	PeerStateGathering    = "gathering"    // A new connection to the peer is being negotiated and candidates are being gathered
+	PeerStateConnecting   = "connecting"   // Candidates are being checked to establish the connection
+	PeerStateConnected    = "connected"    // The connection has been established, either directly or through a relay
+	PeerStateReconnecting = "reconnecting" // The connection is being replaced or restarted (i.e. because the peer has been restarted or to upgrade a relayed connection)
+	PeerStateFailed       = "failed"       // The connection could not be established
+	PeerStateClosed       = "closed"       // The connection has been closed
+
+	ReasonIntroduced           = "introduced"            // The peer has introduced itself, so an offer has been sent to it
+	ReasonOffered              = "offered"               // The peer has sent an offer
+	ReasonCached               = "cached"                // An offer has been sent to a cached peer after a restart (see AdapterConfig.PeerCacheFile)
+	ReasonRestarted            = "restarted"             // The peer has re-introduced itself or sent a new offer, i.e. because it has been restarted
+	ReasonGlare                = "glare"                 // The peer has sent an offer while the offer sent to it was still pending, and its offer has won because it has the higher ID
+	ReasonICERestart           = "ice-restart"           // ICE has been restarted to try and upgrade a relayed connection to a direct one
+	ReasonICEFailed            = "ice-failed"            // No candidate pair could be found or the connection has timed out
+	ReasonEndOfCandidates      = "end-of-candidates"     // The peer has finished gathering and sent all of its candidates, so only the remaining candidate pairs are being checked
+	ReasonRelayed              = "relayed"               // Payloads are relayed through the signaler or a data relay because ICE has failed
+	ReasonDisconnected         = "disconnected"          // The peer has closed the connection or can no longer be reached
+	ReasonNotAllowed           = "not-allowed"           // The peer has been removed from the allow list or added to the deny list
+	ReasonNoAnswer             = "no-answer"             // A cached peer has not answered the offer
+	ReasonSignalerDisconnected = "signaler-disconnected" // The connection depended on the signaler, which has disconnected
+	ReasonAdapterClosed        = "adapter-closed"        // The adapter has been closed
+	ReasonClosed               = "closed"                // The peer has been closed with Peer.Close without a reason
+	ReasonMeshPruned           = "mesh-pruned"           // The direct connection has been closed because the peer can be reached through a nearer peer (see AdapterConfig.MeshDegree)
+	ReasonRouted               = "routed"                // Payloads are forwarded through other peers because the peer isn't directly connected (see AdapterConfig.MeshDegree)
+
+	eventQueueLength = 128 // Maximum amount of events to queue for a subscriber
+)
+
+// PeerEvent is a change of the state of the connection to a peer
+type PeerEvent struct {
+	Community string    // Community in which the peer is connected
+	PeerID    string    // ID of the peer
+	State     string    // State of the connection (see PeerStateGathering etc.)
+	Reason    string    // Reason for the change (see ReasonIntroduced etc. or the reason which has been passed to Peer.Close on either side; empty if the state has changed as part of the negotiation)
+	Time      time.Time // Time at which the state has changed
+}
+
+type peerEvents struct {
+	lock        sync.Mutex
+	subscribers map[chan PeerEvent]struct{}
+}
+
+func newPeerEvents() *peerEvents {
+	return &peerEvents{
+		subscribers: map[chan PeerEvent]struct{}{},
+	}
+}
+
+// subscribe returns a channel which receives all events until the context is cancelled, after which it is closed
+func (e *peerEvents) subscribe(ctx context.Context, done <-chan struct{}) chan PeerEvent {
+	events := make(chan PeerEvent, eventQueueLength)
+
+	e.lock.Lock()
+	e.subscribers[events] = struct{}{}
+	e.lock.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		e.lock.Lock()
+		delete(e.subscribers, events)
+		close(events)
+		e.lock.Unlock()
+	}()
+
+	return events
+}
+
+// publish sends an event to all subscribers without blocking; subscribers which can't keep up miss events
+func (e *peerEvents) publish(community string, peerID string, state string, reason string) {
+	event := PeerEvent{community, peerID, state, reason, time.Now()}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for events := range e.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Debug().Str("community", community).Str("peerID", peerID).Str("state", state).Msg("Could not send peer event because the subscriber's queue is full, dropping")
+		}
+	}
+}
+
+// Events returns a channel which receives the changes of the states of the connections to all peers until the context is cancelled or the adapter is closed, after which it is closed; events are dropped if they aren't received fast enough
+func (a *Adapter) Events(ctx context.Context) chan PeerEvent {
+	return a.events.subscribe(ctx, a.ctx.Done())
+}
@@ -0,0 +1,59 @@
+package wrtcconn
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	IPFamilyIPv4 = "ipv4" // Only gather IPv4 candidates
+	IPFamilyIPv6 = "ipv6" // Only gather IPv6 candidates
+)
+
+var (
+	ErrInvalidIPFamily = errors.New("invalid IP family, must be ipv4 or ipv6") // The specified IP family is invalid
+)
+
+// getNetworkTypes returns the network types to gather candidates for (nil gathers all network types)
+func getNetworkTypes(family string) ([]webrtc.NetworkType, error) {
+	switch family {
+	case "":
+		return nil, nil
+	case IPFamilyIPv4:
+		return []webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeTCP4}, nil
+	case IPFamilyIPv6:
+		return []webrtc.NetworkType{webrtc.NetworkTypeUDP6, webrtc.NetworkTypeTCP6}, nil
+	default:
+		return nil, ErrInvalidIPFamily
+	}
+}
+
+// includeInterface returns whether candidates should be gathered on an interface
+func (a *Adapter) includeInterface(name string) bool {
+	for _, pattern := range a.config.ExcludedInterfaces {
+		if matched, err := filepath.Match(pattern, name); err == nil && matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// includeIP returns whether candidates should be gathered for an address
+func (a *Adapter) includeIP(ip net.IP) bool {
+	ipv4 := ip.To4() != nil
+
+	switch {
+	case a.config.IPFamily == IPFamilyIPv4 && !ipv4,
+		a.config.IPFamily == IPFamilyIPv6 && ipv4,
+		a.config.ExcludeLinkLocal && ip.IsLinkLocalUnicast(),
+		// Unique local addresses are in fc00::/7
+		a.config.ExcludeULA && !ipv4 && len(ip) == net.IPv6len && ip[0]&0xfe == 0xfc:
+		return false
+	}
+
+	return true
+}
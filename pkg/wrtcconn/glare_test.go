@@ -0,0 +1,218 @@
+package wrtcconn_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcsgl"
+	"github.com/pojntfx/weron/pkg/wrtctest"
+)
+
+const (
+	glareChannel   = "primary"
+	glareSettle    = time.Second      // Time to wait for duplicate peers after both adapters have accepted one
+	glareTimeout   = time.Second * 30 // Maximum duration of a round
+	glareHeartbeat = time.Second * 2  // Duration between heartbeats of the signaler; clients of previous rounds are cleaned up faster with shorter heartbeats
+	glareMinRounds = 3                // Minimum amount of rounds to join in
+	glareMaxRounds = 25               // Maximum amount of rounds to join in until both adapters have sent offers at the same time; depending on scheduling, one of the adapters can receive the offer before the introduction of the other one
+	glareConnects  = 1024             // Amount of connections to the signaler to buffer
+)
+
+// TestSimultaneousJoin makes both adapters receive the introduction of the other one, so that both send an offer at the same time; in every round, exactly one connection must survive, and each adapter must accept the other one exactly once
+func TestSimultaneousJoin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	connects := make(chan string, glareConnects)
+
+	// Buffering introductions delivers the introduction of each adapter to the other one even if it has joined later
+	signaler := wrtctest.NewSignaler(&wrtcsgl.SignalerConfig{
+		Heartbeat:          glareHeartbeat,
+		IntroductionWindow: time.Second * 10,
+		OnConnect: func(raddr, community string) {
+			select {
+			case connects <- community:
+			default:
+			}
+		},
+	}, ctx)
+	if err := signaler.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer signaler.Close()
+
+	glared := false
+	for round := 0; round < glareMaxRounds && (round < glareMinRounds || !glared); round++ {
+		t.Run(fmt.Sprintf("round %v", round), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, glareTimeout)
+			defer cancel()
+
+			community := fmt.Sprintf("glare-%v", round)
+
+			adapters := []*wrtcconn.Adapter{}
+			events := []chan wrtcconn.PeerEvent{}
+			for i := 0; i < 2; i++ {
+				adapter := signaler.NewAdapter(community, []string{glareChannel}, nil, ctx)
+				defer adapter.Close()
+
+				adapters = append(adapters, adapter)
+				events = append(events, adapter.Events(ctx))
+			}
+
+			// Adapters only introduce themselves once their ID has been received, so IDs are received from both adapters at the same time once both have connected to the signaler, and for as long as the round runs (i.e. after they have reconnected)
+			var wg sync.WaitGroup
+			ids := make([]string, len(adapters))
+			errs := make(chan error, len(adapters))
+			start := make(chan struct{})
+			for i, adapter := range adapters {
+				wg.Add(1)
+
+				go func(i int, adapter *wrtcconn.Adapter) {
+					c, err := adapter.Open()
+					if err != nil {
+						errs <- err
+						wg.Done()
+
+						return
+					}
+
+					select {
+					case <-ctx.Done():
+						wg.Done()
+
+						return
+					case <-start:
+					}
+
+					joined := false
+					for {
+						select {
+						case <-ctx.Done():
+							if !joined {
+								wg.Done()
+							}
+
+							return
+						case id := <-c:
+							if !joined {
+								ids[i] = id
+								joined = true
+
+								wg.Done()
+							}
+						}
+					}
+				}(i, adapter)
+			}
+
+			for connected := 0; connected < len(adapters); {
+				select {
+				case c := <-connects:
+					if c == community {
+						connected++
+					}
+				case <-ctx.Done():
+					t.Fatal("timed out waiting for adapters to connect to signaler")
+				}
+			}
+			close(start)
+
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Fatal(err)
+			}
+
+			if ctx.Err() != nil {
+				t.Fatal("timed out waiting for adapters to join")
+			}
+
+			accepted := make([][]*wrtcconn.Peer, len(adapters))
+			for i, adapter := range adapters {
+				select {
+				case p := <-adapter.Accept():
+					accepted[i] = append(accepted[i], p)
+				case <-ctx.Done():
+					t.Fatalf("timed out waiting for adapter %v to accept a peer", i)
+				}
+			}
+
+			// Duplicate peers would be accepted shortly after the first ones
+			deadline := time.After(glareSettle)
+		l:
+			for {
+				select {
+				case p := <-adapters[0].Accept():
+					accepted[0] = append(accepted[0], p)
+				case p := <-adapters[1].Accept():
+					accepted[1] = append(accepted[1], p)
+				case <-deadline:
+					break l
+				}
+			}
+
+			for i := range adapters {
+				if len(accepted[i]) != 1 {
+					t.Fatalf("adapter %v accepted %v peers, want 1", i, len(accepted[i]))
+				}
+
+				if got, want := accepted[i][0].PeerID, ids[1-i]; got != want {
+					t.Fatalf("adapter %v accepted peer %v, want %v", i, got, want)
+				}
+			}
+
+			// The surviving connection must work in both directions
+			for i := range adapters {
+				msg := []byte(fmt.Sprintf("from %v", i))
+				if _, err := accepted[i][0].Conn.Write(msg); err != nil {
+					t.Fatal(err)
+				}
+
+				buf := make([]byte, 1024)
+				read := make(chan string, 1)
+				go func(conn interface{ Read([]byte) (int, error) }) {
+					n, err := conn.Read(buf)
+					if err != nil {
+						read <- err.Error()
+
+						return
+					}
+
+					read <- string(buf[:n])
+				}(accepted[1-i][0].Conn)
+
+				select {
+				case got := <-read:
+					if got != string(msg) {
+						t.Fatalf("read %q, want %q", got, msg)
+					}
+				case <-ctx.Done():
+					t.Fatal("timed out reading from surviving connection")
+				}
+			}
+
+			for _, c := range events {
+			e:
+				for {
+					select {
+					case event := <-c:
+						if event.Reason == wrtcconn.ReasonGlare {
+							glared = true
+						}
+					default:
+						break e
+					}
+				}
+			}
+		})
+	}
+
+	if !glared {
+		t.Fatalf("adapters didn't send offers at the same time in %v rounds", glareMaxRounds)
+	}
+}
@@ -0,0 +1,532 @@
+package wrtcconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	gossipTypeMembers = "members" // Lists the peers a peer is directly connected to
+	gossipTypeSignal  = "signal"  // Carries a signaling message which would otherwise be sent through the signaler
+
+	gossipTTL             = 8               // Maximum amount of peers a signaling message is forwarded through
+	gossipFrameLength     = 64 * 1024       // Maximum length of gossip frames
+	gossipQueueLength     = 128             // Amount of signaling messages to queue before dropping new ones
+	gossipSeenTTL         = time.Minute     // Time to remember forwarded signaling messages for so that they aren't forwarded again
+	defaultGossipInterval = time.Second * 5 // Default time to wait between membership announcements
+)
+
+var (
+	ErrSignalerReachable = errors.New("signaler is reachable again") // The signaling messages are no longer relayed through peers because the signaler can be reached again
+	ErrNoNeighbours      = errors.New("no peers to gossip with")     // The signaling messages can't be relayed because there are no directly connected peers which gossip
+)
+
+// signalingConn is a connection to the signaler or, while it can't be reached, to the gossip mesh
+type signalingConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	RemoteAddr() net.Addr
+	Subprotocol() string
+	Close() error
+}
+
+type gossipFrame struct {
+	Type      string   `json:"type"`
+	ID        string   `json:"id,omitempty"`
+	Community string   `json:"community"`
+	To        string   `json:"to,omitempty"`
+	TTL       int      `json:"ttl,omitempty"`
+	Payload   []byte   `json:"payload,omitempty"`
+	Members   []string `json:"members,omitempty"`
+}
+
+type gossipInput struct {
+	community string
+	payload   []byte
+}
+
+type memberKey struct {
+	community string
+	peerID    string
+}
+
+// Member is a peer in a community which is known to the adapter either through a direct connection or through gossip
+type Member struct {
+	Community string    // Community of the peer
+	PeerID    string    // ID of the peer
+	Direct    bool      // Whether the peer is directly connected to the adapter
+	LastSeen  time.Time // Time at which a connected peer has last listed the peer
+}
+
+type gossipNeighbour struct {
+	peer *Peer
+
+	writeLock sync.Mutex
+}
+
+func (n *gossipNeighbour) write(frame gossipFrame) error {
+	b, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	n.writeLock.Lock()
+	defer n.writeLock.Unlock()
+
+	_, err = n.peer.Conn.Write(b)
+
+	return err
+}
+
+// gossipMesh exchanges community membership with directly connected peers and relays signaling messages through them
+type gossipMesh struct {
+	interval time.Duration
+
+	lock           sync.Mutex
+	id             string
+	neighbours     map[memberKey]*gossipNeighbour
+	members        map[memberKey]time.Time
+	membersChanged chan struct{}
+	seen           map[string]time.Time
+	active         bool
+
+	inputs chan gossipInput
+}
+
+func newGossipMesh(interval time.Duration) *gossipMesh {
+	if interval <= 0 {
+		interval = defaultGossipInterval
+	}
+
+	return &gossipMesh{
+		interval: interval,
+
+		neighbours:     map[memberKey]*gossipNeighbour{},
+		members:        map[memberKey]time.Time{},
+		membersChanged: make(chan struct{}),
+		seen:           map[string]time.Time{},
+
+		inputs: make(chan gossipInput, gossipQueueLength),
+	}
+}
+
+func (m *gossipMesh) setID(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.id = id
+}
+
+// run announces the membership periodically and forgets stale members
+func (m *gossipMesh) run(ctx context.Context) {
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.lock.Lock()
+			now := time.Now()
+			for key, lastSeen := range m.members {
+				if now.Sub(lastSeen) > m.interval*3 {
+					delete(m.members, key)
+				}
+			}
+
+			for id, seen := range m.seen {
+				if now.Sub(seen) > gossipSeenTTL {
+					delete(m.seen, id)
+				}
+			}
+			m.lock.Unlock()
+
+			m.announce()
+		}
+	}
+}
+
+// add starts gossiping with a peer which is connected on the gossip channel; the mesh takes ownership of the connection
+func (m *gossipMesh) add(peer *Peer) {
+	key := memberKey{peer.Community, peer.PeerID}
+	n := &gossipNeighbour{peer: peer}
+
+	m.lock.Lock()
+	if old, ok := m.neighbours[key]; ok {
+		_ = old.peer.Conn.Close()
+	}
+	m.neighbours[key] = n
+	m.lock.Unlock()
+
+	log.Debug().Str("community", peer.Community).Str("peerID", peer.PeerID).Msg("Started gossiping with peer")
+
+	m.announce()
+
+	go func() {
+		defer func() {
+			log.Debug().Str("community", peer.Community).Str("peerID", peer.PeerID).Msg("Stopped gossiping with peer")
+
+			m.lock.Lock()
+			if current, ok := m.neighbours[key]; ok && current == n {
+				delete(m.neighbours, key)
+			}
+			m.lock.Unlock()
+
+			_ = peer.Conn.Close()
+		}()
+
+		buf := make([]byte, gossipFrameLength)
+		for {
+			n, err := peer.Conn.Read(buf)
+			if err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+				return
+			}
+
+			var frame gossipFrame
+			if err := json.Unmarshal(buf[:n], &frame); err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal gossip frame, continuing")
+
+				continue
+			}
+
+			// Peers may only gossip about the community in which they are connected
+			frame.Community = peer.Community
+
+			m.handle(key, frame)
+		}
+	}()
+}
+
+func (m *gossipMesh) handle(from memberKey, frame gossipFrame) {
+	switch frame.Type {
+	case gossipTypeMembers:
+		m.lock.Lock()
+		now := time.Now()
+		changed := false
+		for _, peerID := range append(frame.Members, from.peerID) {
+			if peerID == m.id {
+				continue
+			}
+
+			key := memberKey{frame.Community, peerID}
+			if _, ok := m.members[key]; !ok {
+				changed = true
+			}
+
+			m.members[key] = now
+		}
+
+		if changed {
+			close(m.membersChanged)
+			m.membersChanged = make(chan struct{})
+		}
+		m.lock.Unlock()
+	case gossipTypeSignal:
+		m.lock.Lock()
+		if _, ok := m.seen[frame.ID]; ok || frame.ID == "" {
+			m.lock.Unlock()
+
+			return
+		}
+		m.seen[frame.ID] = time.Now()
+
+		deliver := m.active && (frame.To == "" || frame.To == m.id)
+		m.lock.Unlock()
+
+		if frame.To != m.id && frame.TTL > 1 {
+			frame.TTL--
+
+			m.forward(frame, from)
+		}
+
+		if !deliver {
+			return
+		}
+
+		select {
+		case m.inputs <- gossipInput{frame.Community, frame.Payload}:
+		default:
+			log.Debug().Str("community", frame.Community).Str("peerID", from.peerID).Msg("Could not deliver signaling message from peer because the queue is full, dropping")
+		}
+	default:
+		log.Debug().Str("peerID", from.peerID).Str("type", frame.Type).Msg("Got gossip frame with unknown type, continuing")
+	}
+}
+
+// forward sends a frame to all neighbours in its community except the one it has been received from
+func (m *gossipMesh) forward(frame gossipFrame, from memberKey) {
+	m.lock.Lock()
+	neighbours := []*gossipNeighbour{}
+	for key, n := range m.neighbours {
+		if key.community == frame.Community && key != from {
+			neighbours = append(neighbours, n)
+		}
+	}
+	m.lock.Unlock()
+
+	for _, n := range neighbours {
+		if err := n.write(frame); err != nil {
+			log.Debug().Err(err).Str("peerID", n.peer.PeerID).Msg("Could not write to peer, continuing")
+		}
+	}
+}
+
+// send relays a signaling message through the neighbours in a community
+func (m *gossipMesh) send(community string, to string, payload []byte) {
+	frame := gossipFrame{
+		Type:      gossipTypeSignal,
+		ID:        uuid.NewString(),
+		Community: community,
+		To:        to,
+		TTL:       gossipTTL,
+		Payload:   payload,
+	}
+
+	m.lock.Lock()
+	m.seen[frame.ID] = time.Now()
+	m.lock.Unlock()
+
+	m.forward(frame, memberKey{})
+}
+
+// announce sends the IDs of the directly connected peers in each community to them
+func (m *gossipMesh) announce() {
+	m.lock.Lock()
+	members := map[string][]string{}
+	for key := range m.neighbours {
+		members[key.community] = append(members[key.community], key.peerID)
+	}
+
+	neighbours := map[memberKey]*gossipNeighbour{}
+	for key, n := range m.neighbours {
+		neighbours[key] = n
+	}
+	m.lock.Unlock()
+
+	for key, n := range neighbours {
+		if err := n.write(gossipFrame{
+			Type:      gossipTypeMembers,
+			Community: key.community,
+			Members:   members[key.community],
+		}); err != nil {
+			log.Debug().Err(err).Str("peerID", key.peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+}
+
+func (m *gossipMesh) neighbourCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return len(m.neighbours)
+}
+
+func (m *gossipMesh) getMembersChanged() chan struct{} {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.membersChanged
+}
+
+// setActive sets whether signaling messages are delivered; they are only delivered while the signaler can't be reached
+func (m *gossipMesh) setActive(active bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.active = active
+
+	if !active {
+		for {
+			select {
+			case <-m.inputs:
+			default:
+				return
+			}
+		}
+	}
+}
+
+// getMembers returns the directly connected peers and the peers they have listed, sorted by community and ID
+func (m *gossipMesh) getMembers() []Member {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	members := []Member{}
+	for key, lastSeen := range m.members {
+		_, direct := m.neighbours[key]
+
+		members = append(members, Member{key.community, key.peerID, direct, lastSeen})
+	}
+
+	for key := range m.neighbours {
+		if _, ok := m.members[key]; !ok {
+			members = append(members, Member{key.community, key.peerID, true, time.Now()})
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Community != members[j].Community {
+			return members[i].Community < members[j].Community
+		}
+
+		return members[i].PeerID < members[j].PeerID
+	})
+
+	return members
+}
+
+type gossipAddr struct{}
+
+func (gossipAddr) Network() string { return "gossip" }
+func (gossipAddr) String() string  { return "gossip" }
+
+// gossipConn sends and receives signaling messages through the gossip mesh as if they were sent through the signaler
+type gossipConn struct {
+	mesh        *gossipMesh
+	version     string
+	multiplexed bool
+	community   string // Community of messages which aren't wrapped in envelopes
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// newGossipConn creates the connection; it is closed once probe returns true, which is called periodically to check whether the signaler can be reached again
+func newGossipConn(
+	mesh *gossipMesh,
+	version string,
+	multiplexed bool,
+	community string,
+	interval time.Duration,
+	probe func() bool,
+) *gossipConn {
+	c := &gossipConn{
+		mesh:        mesh,
+		version:     version,
+		multiplexed: multiplexed,
+		community:   community,
+
+		done: make(chan struct{}),
+	}
+
+	mesh.setActive(true)
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-t.C:
+				if mesh.neighbourCount() == 0 {
+					c.end(ErrNoNeighbours)
+
+					return
+				}
+
+				if probe() {
+					c.end(ErrSignalerReachable)
+
+					return
+				}
+			}
+		}
+	}()
+
+	return c
+}
+
+func (c *gossipConn) end(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+
+		c.mesh.setActive(false)
+
+		close(c.done)
+	})
+}
+
+func (c *gossipConn) ReadMessage() (int, []byte, error) {
+	messageType := websocket.TextMessage
+	if c.version == websocketapi.VersionBinary {
+		messageType = websocket.BinaryMessage
+	}
+
+	select {
+	case <-c.done:
+		return 0, nil, c.err
+	case input := <-c.mesh.inputs:
+		if !c.multiplexed {
+			return messageType, input.payload, nil
+		}
+
+		p, err := websocketapi.Marshal(c.version, websocketapi.NewEnvelope(input.community, input.payload))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return messageType, p, nil
+	}
+}
+
+func (c *gossipConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+
+	// There is no connection to keep alive
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return nil
+	}
+
+	if !c.multiplexed {
+		c.mesh.send(c.community, "", data)
+
+		return nil
+	}
+
+	var envelope websocketapi.Envelope
+	if err := websocketapi.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+
+	c.mesh.send(envelope.Community, envelope.To, envelope.Payload)
+
+	return nil
+}
+
+func (c *gossipConn) SetReadDeadline(t time.Time) error { return nil }
+
+func (c *gossipConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (c *gossipConn) SetPongHandler(h func(appData string) error) {}
+
+func (c *gossipConn) RemoteAddr() net.Addr { return gossipAddr{} }
+
+func (c *gossipConn) Subprotocol() string { return c.version }
+
+func (c *gossipConn) Close() error {
+	c.end(net.ErrClosed)
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package wrtcconn
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// ICEProvider provides STUN and TURN servers
+type ICEProvider interface {
+	// ICEServers returns the servers and the time after which they should be fetched again (0 if they never change)
+	ICEServers(ctx context.Context) ([]webrtc.ICEServer, time.Duration, error)
+}
+
+// StaticICEProvider provides STUN servers (in format stun:host:port) and TURN servers (in format username:credential@turn:host:port) which never change
+type StaticICEProvider []string
+
+// ICEServers parses the servers
+func (p StaticICEProvider) ICEServers(ctx context.Context) ([]webrtc.ICEServer, time.Duration, error) {
+	iceServers, _, err := ParseICEServers(p)
+
+	return iceServers, 0, err
+}
+
+// RESTICEProvider fetches short-lived STUN and TURN servers from an HTTP endpoint (see FetchICEServers)
+type RESTICEProvider struct {
+	URL    string        // URL of the endpoint (i.e. from Twilio or Cloudflare)
+	Method string        // HTTP method to fetch the servers with (default is POST)
+	Token  string        // Bearer token to fetch the servers with (credentials in the URL are sent using basic authentication)
+	TTL    time.Duration // Lifetime of the servers to request, which is used if the endpoint doesn't return one (default is 24 hours)
+}
+
+// ICEServers fetches the servers; they are fetched again before they expire
+func (p *RESTICEProvider) ICEServers(ctx context.Context) ([]webrtc.ICEServer, time.Duration, error) {
+	iceServers, ttl, err := FetchICEServers(ctx, p.URL, p.Method, p.Token, p.TTL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return iceServers, ttl * 4 / 5, nil
+}
+
+// FileICEProvider reads STUN and TURN servers from a file and picks up changes to it; the file can either contain servers in the format of StaticICEProvider (separated by newlines or commas) or any of the JSON formats supported by FetchICEServers
+type FileICEProvider struct {
+	Path     string        // Path to the file
+	Interval time.Duration // Time to wait between reads of the file (default is 5 seconds)
+}
+
+// ICEServers reads the servers from the file
+func (p *FileICEProvider) ICEServers(ctx context.Context) ([]webrtc.ICEServer, time.Duration, error) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+
+	content, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if content = bytes.TrimSpace(content); len(content) > 0 && (content[0] == '[' || content[0] == '{') {
+		iceServers, _, err := parseICEServersResponse(content, interval)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return iceServers, interval, nil
+	}
+
+	servers := []string{}
+	for _, server := range strings.FieldsFunc(string(content), func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	}) {
+		servers = append(servers, strings.TrimSpace(server))
+	}
+
+	iceServers, _, err := ParseICEServers(servers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return iceServers, interval, nil
+}
+
+// ParseICEServers parses STUN servers (in format stun:host:port) and TURN servers (in format username:credential@turn:host:port)
+func ParseICEServers(ice []string) (iceServers []webrtc.ICEServer, containsTURN bool, err error) {
+	iceServers = []webrtc.ICEServer{}
+
+	for _, ice := range ice {
+		// Skip empty server configs
+		if strings.TrimSpace(ice) == "" {
+			log.Trace().Msg("Skipping empty server config")
+
+			continue
+		}
+
+		if strings.Contains(ice, "stun:") {
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs: []string{ice},
+			})
+		} else {
+			addrParts := strings.Split(ice, "@")
+			if len(addrParts) < 2 {
+				return nil, false, ErrInvalidTURNServerAddr
+			}
+
+			authParts := strings.Split(addrParts[0], ":")
+			if len(authParts) < 2 {
+				return nil, false, ErrMissingTURNCredentials
+			}
+
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs:           []string{addrParts[1]},
+				Username:       authParts[0],
+				Credential:     authParts[1],
+				CredentialType: webrtc.ICECredentialTypePassword,
+			})
+
+			containsTURN = true
+		}
+	}
+
+	return iceServers, containsTURN, nil
+}
@@ -0,0 +1,76 @@
+package wrtcconn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidIdentity = errors.New("identity file does not contain an ID") // The identity file exists, but doesn't contain an ID
+)
+
+// Identity is the persistent identity of a node
+type Identity struct {
+	ID string `json:"id"` // ID to claim without conflict resolution
+}
+
+// LoadOrCreateIdentity reads the identity from a file, or generates a new identity and writes it to the file if it doesn't exist yet
+func LoadOrCreateIdentity(path string) (*Identity, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		var identity Identity
+		if err := json.Unmarshal(b, &identity); err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(identity.ID) == "" {
+			return nil, ErrInvalidIdentity
+		}
+
+		return &identity, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	identity := &Identity{
+		ID: uuid.NewString(),
+	}
+
+	b, err = json.Marshal(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	// Write to a temporary file first so that an interrupted write can't leave a partial identity behind
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,40 @@
+package wrtcconn
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrMailRequiresSelectiveSignaling = errors.New("mail requires selective signaling") // The signaler can only queue mail for a peer if it knows the recipient
+	ErrUnknownCommunity               = errors.New("community has not been joined")     // Mail can only be sent in communities which the adapter has joined
+)
+
+// Mail is a message which a peer has sent to the adapter through the signaler, possibly while the adapter was offline (see SendMail)
+type Mail struct {
+	Community string    // Community in which the mail has been sent
+	From      string    // ID of the peer that sent the mail
+	Payload   []byte    // Content of the mail
+	Sent      time.Time // Time at which the peer has sent the mail
+}
+
+// SendMail sends a small message to a peer through the signaler, encrypted with the community key; if the peer is offline and the signaler has enabled its mailbox, the signaler queues the message until the peer connects again
+//
+// Both peers must enable selective signaling, so that the signaler knows the recipient and the recipient's ID once it
+// connects again, and the recipient should use a fixed ID (see AdapterConfig.ID and AdapterConfig.IDFile). SendMail
+// returns once the message has been handed to the connection to the signaler; it is not acknowledged by the peer.
+func (a *Adapter) SendMail(community string, to string, payload []byte) error {
+	if !a.config.SelectiveSignaling {
+		return ErrMailRequiresSelectiveSignaling
+	}
+
+	a.mailLock.Lock()
+	sendMail := a.sendMail
+	a.mailLock.Unlock()
+
+	if sendMail == nil {
+		return ErrUnknownCommunity
+	}
+
+	return sendMail(community, to, payload)
+}
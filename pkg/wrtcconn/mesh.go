@@ -0,0 +1,845 @@
+package wrtcconn
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	meshTypePing   = "ping"   // Measures the round-trip time to a directly connected peer
+	meshTypePong   = "pong"   // Answers a ping
+	meshTypeRoutes = "routes" // Lists the peers which can be reached through a peer and their cost
+	meshTypeData   = "data"   // Carries a payload of a channel to a peer which isn't directly connected
+	meshTypeClose  = "close"  // Closes a channel or, if no channel is set, all channels to a peer which isn't directly connected
+
+	meshTTL             = 16              // Maximum amount of peers a payload is forwarded through, which is also the maximum length of routes
+	meshFrameLength     = 256 * 1024      // Maximum length of mesh frames
+	meshRTTWeight       = 0.25            // Weight of new round-trip time measurements in the smoothed round-trip time
+	defaultMeshInterval = time.Second * 5 // Default time to wait between round-trip time measurements and route advertisements
+	meshPruneDelay      = 3               // Amount of intervals a peer must have been connected for before its connection can be pruned
+	meshRouteTTL        = 3               // Amount of intervals after which routes which haven't been advertised again are forgotten
+
+	meshDataMarker       = 0   // First byte of binary data frames; all other frames are JSON objects, which start with "{"
+	meshMaxIDLength      = 255 // Maximum length of peer and channel IDs in data frames
+	meshMaxHeaderLength  = 2 + 3*(1+meshMaxIDLength)
+	meshMaxMessageLength = 65536                                                       // Maximum length of a message on a channel (the maximum size of an SCTP message)
+	meshMaxFramePayload  = meshMaxMessageLength - SecureOverhead - meshMaxHeaderLength // Maximum length of the payload of a data frame; frames are encrypted on the mesh channel to each neighbour
+
+	// Maximum size of a write to a peer which is reached through other peers, which is smaller than on direct channels as the forwarding header is added to it.
+	// Forwarded channels are encrypted end-to-end before their payloads are put into data frames, which are encrypted again
+	// on the mesh channel to each neighbour, so the overhead of encryption is subtracted twice.
+	MaxMeshPayloadSize = meshMaxFramePayload - SecureOverhead
+)
+
+var (
+	ErrNoRoute              = errors.New("no route to peer")                               // The peer is neither directly connected nor can it be reached through other peers
+	ErrMeshPayloadTooLarge  = errors.New("payload is too large to be forwarded to peer")   // The write is larger than MaxMeshPayloadSize
+	ErrMeshIDTooLong        = errors.New("peer or channel ID is too long to be forwarded") // The ID is longer than 255 bytes
+	errInvalidMeshDataFrame = errors.New("invalid mesh data frame")
+)
+
+type meshRoute struct {
+	Cost   int64  `json:"cost"`             // Sum of the round-trip times along the route in microseconds
+	Hops   int    `json:"hops"`             // Amount of peers along the route; 1 if the advertising peer is directly connected to the destination
+	Name   string `json:"name,omitempty"`   // Human-readable name of the destination
+	Mutual bool   `json:"mutual,omitempty"` // Whether both the advertising peer and the destination keep their direct connection, so that neither of them prunes it
+}
+
+type meshFrame struct {
+	Type      string               `json:"type"`
+	Community string               `json:"community"`
+	From      string               `json:"from,omitempty"`
+	To        string               `json:"to,omitempty"`
+	Channel   string               `json:"channel,omitempty"`
+	TTL       int                  `json:"ttl,omitempty"`
+	Time      int64                `json:"time,omitempty"`
+	Reason    string               `json:"reason,omitempty"`
+	Payload   []byte               `json:"payload,omitempty"`
+	Routes    map[string]meshRoute `json:"routes,omitempty"`
+	Kept      bool                 `json:"kept,omitempty"`
+}
+
+type meshNeighbour struct {
+	peer  *Peer
+	added time.Time
+
+	rtt      time.Duration
+	routes   map[string]meshRoute
+	routesAt time.Time
+	keepsUs  bool // Whether the neighbour keeps its direct connection to the router
+
+	writeLock sync.Mutex
+}
+
+func (n *meshNeighbour) write(frame meshFrame) error {
+	var (
+		b   []byte
+		err error
+	)
+	if frame.Type == meshTypeData {
+		b, err = marshalMeshData(frame)
+	} else {
+		b, err = json.Marshal(frame)
+	}
+	if err != nil {
+		return err
+	}
+
+	n.writeLock.Lock()
+	defer n.writeLock.Unlock()
+
+	_, err = n.peer.Conn.Write(b)
+
+	return err
+}
+
+type meshEntry struct {
+	next memberKey
+	cost int64
+	hops int
+	name string
+}
+
+// meshDestination is a peer which isn't directly connected, whose channels are forwarded through other peers
+type meshDestination struct {
+	name     string
+	channels map[string]*relayConn
+	closed   bool // Whether the peer has been closed, in which case it isn't connected to again until its route has been lost
+}
+
+// meshRouter keeps direct connections to the nearest peers only and forwards the payloads to all other peers through them using a distance-vector protocol
+type meshRouter struct {
+	degree   int
+	interval time.Duration
+	events   *peerEvents
+
+	lock         sync.Mutex
+	id           string
+	neighbours   map[memberKey]*meshNeighbour
+	table        map[memberKey]meshEntry
+	destinations map[memberKey]*meshDestination
+	done         bool
+
+	// open delivers a channel to a peer which isn't directly connected to the application
+	open func(community string, peerID string, name string, channelID string, conn *relayConn, close func(reason string) error)
+	// channels are the channels to open to peers which aren't directly connected
+	channels []string
+	// connecting returns whether the adapter has a direct connection to a peer or is negotiating one
+	connecting func(community string, peerID string) bool
+}
+
+func newMeshRouter(degree int, interval time.Duration, events *peerEvents) *meshRouter {
+	if interval <= 0 {
+		interval = defaultMeshInterval
+	}
+
+	return &meshRouter{
+		degree:   degree,
+		interval: interval,
+		events:   events,
+
+		neighbours:   map[memberKey]*meshNeighbour{},
+		table:        map[memberKey]meshEntry{},
+		destinations: map[memberKey]*meshDestination{},
+	}
+}
+
+func (m *meshRouter) setID(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.id = id
+}
+
+// run measures the round-trip times to the neighbours, advertises the routes and prunes the connections to distant peers periodically
+func (m *meshRouter) run(ctx context.Context) {
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.lock.Lock()
+			m.done = true
+			for key, dest := range m.destinations {
+				for _, conn := range dest.channels {
+					conn.closeLocal()
+				}
+
+				delete(m.destinations, key)
+			}
+			m.lock.Unlock()
+
+			return
+		case <-t.C:
+			now := time.Now()
+
+			m.expire(now)
+			m.ping(now)
+			m.update()
+			m.advertise()
+			m.prune()
+		}
+	}
+}
+
+// expire forgets the routes of neighbours which haven't advertised them again for meshRouteTTL intervals; they are removed from the routing table on the next update
+func (m *meshRouter) expire(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, n := range m.neighbours {
+		if n.routes != nil && now.Sub(n.routesAt) > m.interval*meshRouteTTL {
+			n.routes = nil
+			n.keepsUs = false
+		}
+	}
+}
+
+// add starts routing through a peer which is connected on the mesh channel; the router takes ownership of the connection
+func (m *meshRouter) add(peer *Peer) {
+	key := memberKey{peer.Community, peer.PeerID}
+	n := &meshNeighbour{peer: peer, added: time.Now()}
+
+	m.lock.Lock()
+	if old, ok := m.neighbours[key]; ok {
+		_ = old.peer.Conn.Close()
+	}
+	m.neighbours[key] = n
+
+	// The direct connection replaces the forwarded one
+	if dest, ok := m.destinations[key]; ok {
+		for _, conn := range dest.channels {
+			conn.closeLocal()
+		}
+
+		delete(m.destinations, key)
+
+		log.Debug().Str("community", peer.Community).Str("peerID", peer.PeerID).Msg("Replaced forwarded connection to peer with direct connection")
+	}
+	m.lock.Unlock()
+
+	log.Debug().Str("community", peer.Community).Str("peerID", peer.PeerID).Msg("Started routing through peer")
+
+	m.ping(time.Now())
+
+	go func() {
+		defer func() {
+			log.Debug().Str("community", peer.Community).Str("peerID", peer.PeerID).Msg("Stopped routing through peer")
+
+			m.lock.Lock()
+			if current, ok := m.neighbours[key]; ok && current == n {
+				delete(m.neighbours, key)
+			}
+			m.lock.Unlock()
+
+			_ = peer.Conn.Close()
+
+			m.update()
+		}()
+
+		buf := make([]byte, meshFrameLength)
+		for {
+			i, err := peer.Conn.Read(buf)
+			if err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+				return
+			}
+
+			var frame meshFrame
+			if i > 0 && buf[0] == meshDataMarker {
+				frame, err = unmarshalMeshData(buf[:i])
+			} else {
+				err = json.Unmarshal(buf[:i], &frame)
+			}
+			if err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal mesh frame, continuing")
+
+				continue
+			}
+
+			// Peers may only route within the community in which they are connected
+			frame.Community = peer.Community
+
+			m.handle(key, n, frame)
+		}
+	}()
+}
+
+func (m *meshRouter) handle(from memberKey, n *meshNeighbour, frame meshFrame) {
+	switch frame.Type {
+	case meshTypePing:
+		if err := n.write(meshFrame{
+			Type:      meshTypePong,
+			Community: frame.Community,
+			Time:      frame.Time,
+		}); err != nil {
+			log.Debug().Err(err).Str("peerID", from.peerID).Msg("Could not write to peer, continuing")
+		}
+	case meshTypePong:
+		rtt := time.Since(time.Unix(0, frame.Time))
+		if rtt <= 0 {
+			return
+		}
+
+		m.lock.Lock()
+		if n.rtt == 0 {
+			n.rtt = rtt
+		} else {
+			n.rtt = time.Duration(float64(n.rtt)*(1-meshRTTWeight) + float64(rtt)*meshRTTWeight)
+		}
+		m.lock.Unlock()
+	case meshTypeRoutes:
+		m.lock.Lock()
+		n.routes = frame.Routes
+		n.routesAt = time.Now()
+		n.keepsUs = frame.Kept
+		m.lock.Unlock()
+
+		m.update()
+	case meshTypeData, meshTypeClose:
+		m.lock.Lock()
+		id := m.id
+		m.lock.Unlock()
+
+		if frame.To != id {
+			if frame.TTL <= 1 {
+				log.Debug().Str("peerID", frame.From).Str("to", frame.To).Msg("Could not forward mesh frame because its TTL has expired, dropping")
+
+				return
+			}
+
+			frame.TTL--
+
+			if err := m.forward(frame); err != nil {
+				log.Debug().Err(err).Str("peerID", frame.From).Str("to", frame.To).Msg("Could not forward mesh frame, dropping")
+			}
+
+			return
+		}
+
+		if frame.Type == meshTypeClose {
+			m.closeDestination(memberKey{frame.Community, frame.From}, frame.Channel, frame.Reason, false)
+
+			return
+		}
+
+		conn := m.getChannel(memberKey{frame.Community, frame.From}, frame.Channel)
+		if conn == nil {
+			log.Debug().Str("peerID", frame.From).Str("channelID", frame.Channel).Msg("Could not find forwarded channel for peer, dropping")
+
+			return
+		}
+
+		if !conn.deliver(frame.Payload) {
+			log.Debug().Str("peerID", frame.From).Str("channelID", frame.Channel).Msg("Could not deliver forwarded payload because the queue is full, dropping")
+		}
+	default:
+		log.Debug().Str("peerID", from.peerID).Str("type", frame.Type).Msg("Got mesh frame with unknown type, continuing")
+	}
+}
+
+// forward sends a frame to the next peer on the route to its recipient
+func (m *meshRouter) forward(frame meshFrame) error {
+	m.lock.Lock()
+	entry, ok := m.table[memberKey{frame.Community, frame.To}]
+	if !ok {
+		m.lock.Unlock()
+
+		return ErrNoRoute
+	}
+
+	n, ok := m.neighbours[entry.next]
+	m.lock.Unlock()
+	if !ok {
+		return ErrNoRoute
+	}
+
+	return n.write(frame)
+}
+
+// send forwards a frame from the router to a peer which isn't directly connected
+func (m *meshRouter) send(community string, to string, frameType string, channelID string, reason string, payload []byte) error {
+	if len(payload) > meshMaxFramePayload {
+		return ErrMeshPayloadTooLarge
+	}
+
+	m.lock.Lock()
+	id := m.id
+	m.lock.Unlock()
+
+	return m.forward(meshFrame{
+		Type:      frameType,
+		Community: community,
+		From:      id,
+		To:        to,
+		Channel:   channelID,
+		TTL:       meshTTL,
+		Reason:    reason,
+		Payload:   payload,
+	})
+}
+
+// ping measures the round-trip times to all neighbours
+func (m *meshRouter) ping(now time.Time) {
+	m.lock.Lock()
+	neighbours := map[memberKey]*meshNeighbour{}
+	for key, n := range m.neighbours {
+		neighbours[key] = n
+	}
+	m.lock.Unlock()
+
+	for key, n := range neighbours {
+		if err := n.write(meshFrame{
+			Type:      meshTypePing,
+			Community: key.community,
+			Time:      now.UnixNano(),
+		}); err != nil {
+			log.Debug().Err(err).Str("peerID", key.peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+}
+
+// update recalculates the routing table and connects to or disconnects from the peers which aren't directly connected accordingly
+func (m *meshRouter) update() {
+	type opened struct {
+		key       memberKey
+		name      string
+		channelID string
+		conn      *relayConn
+	}
+
+	m.lock.Lock()
+	// Directly connected peers are always reached directly, so that the advertised direct connections can be relied on when pruning
+	table := map[memberKey]meshEntry{}
+	for key, n := range m.neighbours {
+		if n.rtt > 0 {
+			table[key] = meshEntry{key, n.rtt.Microseconds() + 1, 1, n.peer.Name}
+		}
+	}
+
+	for key, n := range m.neighbours {
+		if n.rtt == 0 {
+			continue
+		}
+
+		for peerID, route := range n.routes {
+			dest := memberKey{key.community, peerID}
+			if peerID == m.id || route.Hops+1 > meshTTL {
+				continue
+			}
+
+			if current, ok := table[dest]; ok && current.hops == 1 && current.next == dest {
+				continue
+			}
+
+			entry := meshEntry{key, n.rtt.Microseconds() + 1 + route.Cost, route.Hops + 1, route.Name}
+			if current, ok := table[dest]; !ok || entry.cost < current.cost || (entry.cost == current.cost && entry.next.peerID < current.next.peerID) {
+				table[dest] = entry
+			}
+		}
+	}
+	m.table = table
+
+	lost := map[memberKey]*meshDestination{}
+	for key, dest := range m.destinations {
+		if _, ok := table[key]; ok {
+			if _, direct := m.neighbours[key]; !direct {
+				continue
+			}
+		}
+
+		lost[key] = dest
+		delete(m.destinations, key)
+	}
+
+	candidates := []memberKey{}
+	for key := range table {
+		_, direct := m.neighbours[key]
+		if _, ok := m.destinations[key]; !ok && !direct {
+			candidates = append(candidates, key)
+		}
+	}
+	connecting := m.connecting
+	m.lock.Unlock()
+
+	// Peers to which a direct connection is being negotiated would otherwise be connected to twice
+	if connecting != nil {
+		routed := []memberKey{}
+		for _, key := range candidates {
+			if !connecting(key.community, key.peerID) {
+				routed = append(routed, key)
+			}
+		}
+		candidates = routed
+	}
+
+	added := []opened{}
+	m.lock.Lock()
+	if m.open != nil && !m.done {
+		for _, key := range candidates {
+			entry, ok := m.table[key]
+			if !ok {
+				continue
+			}
+
+			if _, direct := m.neighbours[key]; direct {
+				continue
+			}
+
+			if _, ok := m.destinations[key]; ok {
+				continue
+			}
+
+			dest := &meshDestination{entry.name, map[string]*relayConn{}, false}
+			for _, channelID := range m.channels {
+				conn := m.newChannel(key, dest, channelID)
+				dest.channels[channelID] = conn
+
+				added = append(added, opened{key, entry.name, channelID, conn})
+			}
+			m.destinations[key] = dest
+		}
+	}
+	m.lock.Unlock()
+
+	for key, dest := range lost {
+		for _, conn := range dest.channels {
+			conn.closeLocal()
+		}
+
+		if dest.closed {
+			continue
+		}
+
+		log.Debug().Str("community", key.community).Str("peerID", key.peerID).Msg("Lost route to peer")
+
+		m.events.publish(key.community, key.peerID, PeerStateClosed, ReasonDisconnected)
+	}
+
+	published := map[memberKey]struct{}{}
+	for _, o := range added {
+		if _, ok := published[o.key]; !ok {
+			published[o.key] = struct{}{}
+
+			log.Debug().Str("community", o.key.community).Str("peerID", o.key.peerID).Str("name", o.name).Msg("Connected to peer through mesh")
+
+			m.events.publish(o.key.community, o.key.peerID, PeerStateConnected, ReasonRouted)
+		}
+
+		key := o.key
+		m.open(key.community, key.peerID, o.name, o.channelID, o.conn, func(reason string) error {
+			return m.closeDestination(key, "", reason, true)
+		})
+	}
+}
+
+// newChannel creates a forwarded channel; must be called with the lock held
+func (m *meshRouter) newChannel(key memberKey, dest *meshDestination, channelID string) *relayConn {
+	var conn *relayConn
+	conn = newRelayConn(
+		-1,
+		PathMesh,
+		func(p []byte) error {
+			return m.send(key.community, key.peerID, meshTypeData, channelID, "", p)
+		},
+		func() {
+			m.lock.Lock()
+			if current, ok := m.destinations[key]; ok && current == dest && dest.channels[channelID] == conn {
+				delete(dest.channels, channelID)
+			}
+			m.lock.Unlock()
+
+			if err := m.send(key.community, key.peerID, meshTypeClose, channelID, "", nil); err != nil {
+				log.Debug().Err(err).Str("peerID", key.peerID).Str("channelID", channelID).Msg("Could not send mesh close, continuing")
+			}
+		},
+	)
+
+	return conn
+}
+
+// getChannel returns a forwarded channel; it is nil if the channel has been closed or the peer can't be reached
+func (m *meshRouter) getChannel(key memberKey, channelID string) *relayConn {
+	m.lock.Lock()
+	_, ok := m.destinations[key]
+	m.lock.Unlock()
+
+	// The peer may have learned the route before the router has
+	if !ok {
+		m.update()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	dest, ok := m.destinations[key]
+	if !ok {
+		return nil
+	}
+
+	return dest.channels[channelID]
+}
+
+// closeDestination closes a channel or, if channelID is empty, all channels to a peer which isn't directly connected; local closes notify the peer
+func (m *meshRouter) closeDestination(key memberKey, channelID string, reason string, local bool) error {
+	if strings.TrimSpace(reason) == "" {
+		reason = ReasonClosed
+	}
+
+	m.lock.Lock()
+	dest, ok := m.destinations[key]
+	if !ok || dest.closed {
+		m.lock.Unlock()
+
+		return nil
+	}
+
+	conns := []*relayConn{}
+	for id, conn := range dest.channels {
+		if channelID == "" || id == channelID {
+			conns = append(conns, conn)
+
+			delete(dest.channels, id)
+		}
+	}
+
+	if channelID == "" {
+		dest.closed = true
+	}
+	m.lock.Unlock()
+
+	for _, conn := range conns {
+		conn.closeLocal()
+	}
+
+	if channelID != "" {
+		return nil
+	}
+
+	log.Debug().Str("community", key.community).Str("peerID", key.peerID).Str("reason", reason).Msg("Closed forwarded connection to peer")
+
+	m.events.publish(key.community, key.peerID, PeerStateClosed, reason)
+
+	if !local {
+		return nil
+	}
+
+	return m.send(key.community, key.peerID, meshTypeClose, "", reason, nil)
+}
+
+// advertise sends the routing table to the neighbours; routes through a neighbour aren't sent to it, so that it doesn't route back through the router
+func (m *meshRouter) advertise() {
+	m.lock.Lock()
+	neighbours := map[memberKey]*meshNeighbour{}
+	for key, n := range m.neighbours {
+		neighbours[key] = n
+	}
+
+	kept := m.getKept()
+
+	routes := map[memberKey]map[string]meshRoute{}
+	for key := range neighbours {
+		r := map[string]meshRoute{}
+		for dest, entry := range m.table {
+			if dest.community != key.community || entry.next == key || dest == key {
+				continue
+			}
+
+			mutual := false
+			if n, ok := neighbours[dest]; ok && entry.next == dest {
+				mutual = kept[dest] && n.keepsUs
+			}
+
+			r[dest.peerID] = meshRoute{entry.cost, entry.hops, entry.name, mutual}
+		}
+
+		routes[key] = r
+	}
+	m.lock.Unlock()
+
+	for key, n := range neighbours {
+		if err := n.write(meshFrame{
+			Type:      meshTypeRoutes,
+			Community: key.community,
+			Routes:    routes[key],
+			Kept:      kept[key],
+		}); err != nil {
+			log.Debug().Err(err).Str("peerID", key.peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+}
+
+// getKept returns whether the direct connections to the neighbours are kept, which is the case for the nearest neighbours of each community; must be called with the lock held
+func (m *meshRouter) getKept() map[memberKey]bool {
+	measured := map[string][]memberKey{}
+	kept := map[memberKey]bool{}
+	for key, n := range m.neighbours {
+		if n.rtt > 0 {
+			measured[key.community] = append(measured[key.community], key)
+		}
+	}
+
+	for _, keys := range measured {
+		sort.Slice(keys, func(i, j int) bool {
+			return m.neighbours[keys[i]].rtt < m.neighbours[keys[j]].rtt
+		})
+
+		for i, key := range keys {
+			kept[key] = i < m.degree
+		}
+	}
+
+	return kept
+}
+
+// prune closes the direct connection to a neighbour which isn't among the nearest peers of its community if it can be reached through a nearer neighbour
+//
+// A connection is only pruned if both connections of the route which replaces it are kept by both of their peers, which
+// never prune them, so that peers which prune at the same time can't disconnect each other from the mesh. The mesh may
+// thus keep more connections than the degree. At most one connection is pruned per interval so that the routes can settle.
+func (m *meshRouter) prune() {
+	m.lock.Lock()
+	kept := m.getKept()
+
+	var pruned *meshNeighbour
+	for key, far := range m.neighbours {
+		if kept[key] || far.rtt == 0 || time.Since(far.added) < m.interval*meshPruneDelay {
+			continue
+		}
+
+		for nearKey, near := range m.neighbours {
+			if nearKey.community != key.community || !kept[nearKey] || !near.keepsUs {
+				continue
+			}
+
+			if route, ok := near.routes[key.peerID]; ok && route.Hops == 1 && route.Mutual {
+				pruned = far
+
+				break
+			}
+		}
+
+		if pruned != nil {
+			break
+		}
+	}
+	m.lock.Unlock()
+
+	if pruned == nil {
+		return
+	}
+
+	log.Debug().Str("community", pruned.peer.Community).Str("peerID", pruned.peer.PeerID).Msg("Pruning direct connection to peer which can be reached through a nearer peer")
+
+	if err := pruned.peer.Close(ReasonMeshPruned); err != nil {
+		log.Debug().Err(err).Str("peerID", pruned.peer.PeerID).Msg("Could not close connection to peer, continuing")
+	}
+}
+
+// getRoutes returns the routes to all peers which can be reached, sorted by community and ID
+func (m *meshRouter) getRoutes() []Route {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	routes := []Route{}
+	for key, entry := range m.table {
+		routes = append(routes, Route{
+			Community: key.community,
+			PeerID:    key.peerID,
+			Name:      entry.name,
+			NextHop:   entry.next.peerID,
+			Hops:      entry.hops,
+			Cost:      time.Duration(entry.cost) * time.Microsecond,
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Community != routes[j].Community {
+			return routes[i].Community < routes[j].Community
+		}
+
+		return routes[i].PeerID < routes[j].PeerID
+	})
+
+	return routes
+}
+
+// getPaths returns the paths to the peers which aren't directly connected
+func (m *meshRouter) getPaths() []PeerPath {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	paths := []PeerPath{}
+	for key, dest := range m.destinations {
+		if !dest.closed {
+			paths = append(paths, PeerPath{key.community, key.peerID, PathMesh})
+		}
+	}
+
+	return paths
+}
+
+// Route is the route to a peer through the mesh (see AdapterConfig.MeshDegree)
+type Route struct {
+	Community string        // Community of the peer
+	PeerID    string        // ID of the peer
+	Name      string        // Human-readable name of the peer (empty if the peer has not set one)
+	NextHop   string        // ID of the directly connected peer through which payloads are forwarded to the peer (the peer itself if it is directly connected)
+	Hops      int           // Amount of peers along the route, including the peer itself
+	Cost      time.Duration // Sum of the smoothed round-trip times along the route
+}
+
+// Routes returns the routes to all peers which can be reached through the mesh, if the partial mesh is enabled
+func (a *Adapter) Routes() []Route {
+	return a.mesh.getRoutes()
+}
+
+// marshalMeshData encodes a data frame in binary, as JSON would encode the payload in base64, which makes it a third larger; the community isn't sent, as it is given by the channel
+func marshalMeshData(frame meshFrame) ([]byte, error) {
+	if len(frame.From) > meshMaxIDLength || len(frame.To) > meshMaxIDLength || len(frame.Channel) > meshMaxIDLength {
+		return nil, ErrMeshIDTooLong
+	}
+
+	b := make([]byte, 0, meshMaxHeaderLength+len(frame.Payload))
+	b = append(b, meshDataMarker, byte(frame.TTL))
+	for _, field := range []string{frame.From, frame.To, frame.Channel} {
+		b = append(b, byte(len(field)))
+		b = append(b, field...)
+	}
+
+	return append(b, frame.Payload...), nil
+}
+
+func unmarshalMeshData(b []byte) (meshFrame, error) {
+	if len(b) < 2 || b[0] != meshDataMarker {
+		return meshFrame{}, errInvalidMeshDataFrame
+	}
+
+	frame := meshFrame{
+		Type: meshTypeData,
+		TTL:  int(b[1]),
+	}
+
+	b = b[2:]
+	fields := make([]string, 3)
+	for i := range fields {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return meshFrame{}, errInvalidMeshDataFrame
+		}
+
+		fields[i] = string(b[1 : 1+int(b[0])])
+		b = b[1+int(b[0]):]
+	}
+	frame.From, frame.To, frame.Channel = fields[0], fields[1], fields[2]
+	frame.Payload = append([]byte{}, b...)
+
+	return frame, nil
+}
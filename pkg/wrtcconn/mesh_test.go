@@ -0,0 +1,463 @@
+package wrtcconn
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/services"
+)
+
+const (
+	meshTestCommunity = "community"
+	meshTestInterval  = time.Second
+)
+
+// meshTestConn is an in-memory mesh channel to a neighbour which records the frames that the router writes to it
+type meshTestConn struct {
+	lock    sync.Mutex
+	written []meshFrame
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMeshTestConn() *meshTestConn {
+	return &meshTestConn{
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *meshTestConn) Read(p []byte) (int, error) {
+	<-c.closed
+
+	return 0, io.EOF
+}
+
+func (c *meshTestConn) Write(p []byte) (int, error) {
+	var (
+		frame meshFrame
+		err   error
+	)
+	if len(p) > 0 && p[0] == meshDataMarker {
+		frame, err = unmarshalMeshData(p)
+	} else {
+		err = json.Unmarshal(p, &frame)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.written = append(c.written, frame)
+
+	return len(p), nil
+}
+
+func (c *meshTestConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return nil
+}
+
+// getRoutes returns the routes of the last advertisement which the router has written to the neighbour
+func (c *meshTestConn) getRoutes() (map[string]meshRoute, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i := len(c.written) - 1; i >= 0; i-- {
+		if c.written[i].Type == meshTypeRoutes {
+			return c.written[i].Routes, true
+		}
+	}
+
+	return nil, false
+}
+
+// meshTestNeighbour is a neighbour of a router whose round-trip time has been measured
+type meshTestNeighbour struct {
+	key    memberKey
+	n      *meshNeighbour
+	conn   *meshTestConn
+	pruned chan string // Receives the reason once the router has closed the connection to the neighbour
+}
+
+// newMeshTestRouter creates a router which records the forwarded channels that it opens to peers which aren't directly connected
+func newMeshTestRouter(id string, degree int) (*meshRouter, chan memberKey) {
+	m := newMeshRouter(degree, meshTestInterval, newPeerEvents())
+	m.setID(id)
+
+	opened := make(chan memberKey, 16)
+	m.channels = []string{"primary"}
+	m.open = func(community, peerID, name, channelID string, conn *relayConn, close func(reason string) error) {
+		opened <- memberKey{community, peerID}
+	}
+
+	return m, opened
+}
+
+func addMeshTestNeighbour(t *testing.T, m *meshRouter, peerID string, rtt time.Duration) *meshTestNeighbour {
+	t.Helper()
+
+	conn := newMeshTestConn()
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	pruned := make(chan string, 1)
+	m.add(&Peer{
+		PeerID:    peerID,
+		ChannelID: services.MeshPrimary,
+		Conn:      conn,
+		Community: meshTestCommunity,
+		close: func(reason string) error {
+			pruned <- reason
+
+			return conn.Close()
+		},
+	})
+
+	key := memberKey{meshTestCommunity, peerID}
+
+	m.lock.Lock()
+	n := m.neighbours[key]
+	n.rtt = rtt
+	m.lock.Unlock()
+
+	return &meshTestNeighbour{key, n, conn, pruned}
+}
+
+// advertise makes a neighbour advertise routes to the router
+func (n *meshTestNeighbour) advertise(m *meshRouter, kept bool, routes map[string]meshRoute) {
+	m.handle(n.key, n.n, meshFrame{
+		Type:      meshTypeRoutes,
+		Community: meshTestCommunity,
+		Routes:    routes,
+		Kept:      kept,
+	})
+}
+
+func getMeshTestRoute(m *meshRouter, peerID string) (Route, bool) {
+	for _, route := range m.getRoutes() {
+		if route.PeerID == peerID {
+			return route, true
+		}
+	}
+
+	return Route{}, false
+}
+
+func TestMeshDataFrame(t *testing.T) {
+	longID := strings.Repeat("a", meshMaxIDLength)
+
+	tests := []struct {
+		name    string
+		frame   meshFrame
+		wantErr error
+	}{
+		{
+			"empty payload",
+			meshFrame{Type: meshTypeData, From: "from", To: "to", Channel: "channel", TTL: meshTTL},
+			nil,
+		},
+		{
+			"maximum payload and IDs",
+			meshFrame{Type: meshTypeData, From: longID, To: longID, Channel: longID, TTL: meshTTL, Payload: bytes.Repeat([]byte{1}, MaxMeshPayloadSize+SecureOverhead)},
+			nil,
+		},
+		{
+			"ID too long",
+			meshFrame{Type: meshTypeData, From: longID + "a", To: "to", Channel: "channel", TTL: meshTTL},
+			ErrMeshIDTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshalMeshData(tt.frame)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			// The frame must fit into one SCTP message, even if the mesh channel is encrypted
+			if len(b)+SecureOverhead > meshMaxMessageLength {
+				t.Fatalf("frame is %v bytes, which doesn't fit into a message", len(b))
+			}
+
+			got, err := unmarshalMeshData(b)
+			if err != nil {
+				t.Fatalf("could not unmarshal: %v", err)
+			}
+
+			if got.Type != meshTypeData || got.From != tt.frame.From || got.To != tt.frame.To || got.Channel != tt.frame.Channel || got.TTL != tt.frame.TTL || !bytes.Equal(got.Payload, tt.frame.Payload) {
+				t.Fatalf("got %+v, want %+v", got, tt.frame)
+			}
+		})
+	}
+}
+
+func TestMeshDataFrameInvalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{meshDataMarker},
+		{meshDataMarker, meshTTL, 4, 'f'},
+		{meshDataMarker, meshTTL, 0, 0},
+		[]byte(`{"type":"data"}`),
+	} {
+		if _, err := unmarshalMeshData(b); err != errInvalidMeshDataFrame {
+			t.Fatalf("got %v for %q, want %v", err, b, errInvalidMeshDataFrame)
+		}
+	}
+}
+
+func TestMeshRouterUpdate(t *testing.T) {
+	m, opened := newMeshTestRouter("a", 2)
+
+	b := addMeshTestNeighbour(t, m, "b", time.Millisecond*10)
+	c := addMeshTestNeighbour(t, m, "c", time.Millisecond)
+
+	b.advertise(m, true, map[string]meshRoute{
+		"d": {Cost: 1000, Hops: 1},
+		"a": {Cost: 1, Hops: 1},            // Routes to the router itself are ignored
+		"e": {Cost: 1, Hops: meshTTL},      // Routes which would exceed the TTL are ignored
+		"c": {Cost: 1, Hops: 1, Name: "c"}, // Directly connected peers are always reached directly
+	})
+	c.advertise(m, true, map[string]meshRoute{
+		"d": {Cost: 50000, Hops: 2, Name: "d"},
+	})
+
+	tests := []struct {
+		peerID   string
+		wantNext string
+		wantHops int
+		wantCost time.Duration
+		wantName string
+	}{
+		{"b", "b", 1, time.Millisecond*10 + time.Microsecond, ""},
+		{"c", "c", 1, time.Millisecond + time.Microsecond, ""},
+		{"d", "b", 2, time.Millisecond*10 + time.Microsecond + time.Millisecond, ""}, // The route through b is cheaper than the one through the nearer c
+	}
+
+	for _, tt := range tests {
+		route, ok := getMeshTestRoute(m, tt.peerID)
+		if !ok {
+			t.Fatalf("got no route to %v", tt.peerID)
+		}
+
+		if route.NextHop != tt.wantNext || route.Hops != tt.wantHops || route.Cost != tt.wantCost || route.Name != tt.wantName {
+			t.Fatalf("got route %+v to %v, want next hop %v, %v hops, cost %v and name %q", route, tt.peerID, tt.wantNext, tt.wantHops, tt.wantCost, tt.wantName)
+		}
+	}
+
+	for _, peerID := range []string{"a", "e"} {
+		if _, ok := getMeshTestRoute(m, peerID); ok {
+			t.Fatalf("got route to %v, want none", peerID)
+		}
+	}
+
+	// Only d isn't directly connected, so channels are only forwarded to it
+	select {
+	case key := <-opened:
+		if key.peerID != "d" {
+			t.Fatalf("opened forwarded channel to %v, want d", key.peerID)
+		}
+	default:
+		t.Fatal("didn't open forwarded channel to d")
+	}
+
+	select {
+	case key := <-opened:
+		t.Fatalf("opened second forwarded channel to %v", key.peerID)
+	default:
+	}
+
+	// Once b advertises a more expensive route, the route through c is used
+	b.advertise(m, true, map[string]meshRoute{
+		"d": {Cost: 100000, Hops: 1},
+	})
+
+	if route, ok := getMeshTestRoute(m, "d"); !ok || route.NextHop != "c" || route.Hops != 3 {
+		t.Fatalf("got route %+v to d, want route through c with 3 hops", route)
+	}
+}
+
+func TestMeshRouterSplitHorizon(t *testing.T) {
+	m, _ := newMeshTestRouter("a", 2)
+
+	b := addMeshTestNeighbour(t, m, "b", time.Millisecond)
+	c := addMeshTestNeighbour(t, m, "c", time.Millisecond*2)
+
+	b.advertise(m, true, map[string]meshRoute{
+		"d": {Cost: 1000, Hops: 1},
+	})
+	c.advertise(m, true, map[string]meshRoute{})
+
+	m.advertise()
+
+	tests := []struct {
+		name       string
+		neighbour  *meshTestNeighbour
+		want       []string
+		wantAbsent []string
+	}{
+		// Routes through b aren't advertised back to it, so that it doesn't route back through the router
+		{"to next hop", b, []string{"c"}, []string{"b", "d"}},
+		{"to other neighbour", c, []string{"b", "d"}, []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, ok := tt.neighbour.conn.getRoutes()
+			if !ok {
+				t.Fatal("router didn't advertise routes")
+			}
+
+			for _, peerID := range tt.want {
+				if _, ok := routes[peerID]; !ok {
+					t.Fatalf("route to %v hasn't been advertised, got %v", peerID, routes)
+				}
+			}
+
+			for _, peerID := range tt.wantAbsent {
+				if _, ok := routes[peerID]; ok {
+					t.Fatalf("route to %v has been advertised, got %v", peerID, routes)
+				}
+			}
+		})
+	}
+
+	// Both neighbours keep their connections to the router, so its direct routes to them are mutual
+	routes, _ := c.conn.getRoutes()
+	if route := routes["b"]; route.Hops != 1 || !route.Mutual {
+		t.Fatalf("got route %+v to b, want mutual direct route", route)
+	}
+
+	if route := routes["d"]; route.Hops != 2 || route.Mutual {
+		t.Fatalf("got route %+v to d, want route with 2 hops which isn't mutual", route)
+	}
+}
+
+func TestMeshRouterRouteExpiry(t *testing.T) {
+	m, opened := newMeshTestRouter("a", 2)
+
+	b := addMeshTestNeighbour(t, m, "b", time.Millisecond)
+	b.advertise(m, true, map[string]meshRoute{
+		"d": {Cost: 1000, Hops: 1},
+	})
+
+	select {
+	case <-opened:
+	default:
+		t.Fatal("didn't open forwarded channel to d")
+	}
+
+	m.lock.Lock()
+	conn := m.destinations[memberKey{meshTestCommunity, "d"}].channels["primary"]
+	m.lock.Unlock()
+
+	// Routes which have been advertised recently are kept
+	m.expire(time.Now().Add(meshTestInterval * (meshRouteTTL - 1)))
+	m.update()
+
+	if _, ok := getMeshTestRoute(m, "d"); !ok {
+		t.Fatal("route to d has expired before its TTL")
+	}
+
+	m.expire(time.Now().Add(meshTestInterval * (meshRouteTTL + 1)))
+	m.update()
+
+	if _, ok := getMeshTestRoute(m, "d"); ok {
+		t.Fatal("route to d hasn't expired")
+	}
+
+	// The direct route to b doesn't depend on its advertisements
+	if _, ok := getMeshTestRoute(m, "b"); !ok {
+		t.Fatal("direct route to b has expired")
+	}
+
+	m.lock.Lock()
+	_, ok := m.destinations[memberKey{meshTestCommunity, "d"}]
+	keepsUs := b.n.keepsUs
+	m.lock.Unlock()
+
+	if ok {
+		t.Fatal("forwarded connection to d hasn't been closed")
+	}
+
+	if keepsUs {
+		t.Fatal("b is still assumed to keep its connection to the router")
+	}
+
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("forwarded channel to d hasn't been closed")
+	}
+}
+
+func TestMeshRouterPrune(t *testing.T) {
+	tests := []struct {
+		name       string
+		degree     int
+		keepsUs    bool          // Whether the near neighbour keeps its connection to the router
+		route      meshRoute     // Route from the near neighbour to the far one
+		age        time.Duration // Time since the far neighbour has connected
+		wantPruned bool
+	}{
+		{"mutual route through near neighbour", 1, true, meshRoute{Cost: 1000, Hops: 1, Mutual: true}, meshTestInterval * meshPruneDelay * 2, true},
+		{"route which isn't mutual", 1, true, meshRoute{Cost: 1000, Hops: 1}, meshTestInterval * meshPruneDelay * 2, false},
+		{"indirect route", 1, true, meshRoute{Cost: 1000, Hops: 2, Mutual: true}, meshTestInterval * meshPruneDelay * 2, false},
+		{"near neighbour doesn't keep router", 1, false, meshRoute{Cost: 1000, Hops: 1, Mutual: true}, meshTestInterval * meshPruneDelay * 2, false},
+		{"far neighbour connected recently", 1, true, meshRoute{Cost: 1000, Hops: 1, Mutual: true}, 0, false},
+		{"far neighbour within degree", 2, true, meshRoute{Cost: 1000, Hops: 1, Mutual: true}, meshTestInterval * meshPruneDelay * 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newMeshTestRouter("a", tt.degree)
+
+			near := addMeshTestNeighbour(t, m, "near", time.Millisecond)
+			far := addMeshTestNeighbour(t, m, "far", time.Millisecond*10)
+
+			m.lock.Lock()
+			far.n.added = time.Now().Add(-tt.age)
+			m.lock.Unlock()
+
+			near.advertise(m, tt.keepsUs, map[string]meshRoute{
+				"far": tt.route,
+			})
+
+			m.prune()
+
+			select {
+			case reason := <-far.pruned:
+				if !tt.wantPruned {
+					t.Fatal("pruned connection to far neighbour")
+				}
+
+				if reason != ReasonMeshPruned {
+					t.Fatalf("got reason %v, want %v", reason, ReasonMeshPruned)
+				}
+			default:
+				if tt.wantPruned {
+					t.Fatal("didn't prune connection to far neighbour")
+				}
+			}
+
+			select {
+			case <-near.pruned:
+				t.Fatal("pruned connection to near neighbour")
+			default:
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package wrtcconn
+
+import (
+	"errors"
+)
+
+var (
+	ErrStringMessagesUnsupported = errors.New("string messages are not supported by this connection") // The connection is relayed or encrypted, so it can't preserve whether a message is a string
+)
+
+// messageConn is implemented by connections which can preserve whether a message is a string, i.e. detached data channels
+type messageConn interface {
+	ReadDataChannel(p []byte) (int, bool, error)
+	WriteDataChannel(p []byte, isString bool) (int, error)
+}
+
+// ReadMessage reads exactly one message into p and returns whether it has been sent as a string; if p is too small to hold the message, io.ErrShortBuffer is returned
+func (p *Peer) ReadMessage(b []byte) (n int, isString bool, err error) {
+	if c, ok := p.Conn.(messageConn); ok {
+		return c.ReadDataChannel(b)
+	}
+
+	// All connections are message-oriented, but only data channels can carry the string flag
+	n, err = p.Conn.Read(b)
+
+	return n, false, err
+}
+
+// WriteMessage writes b as exactly one message, either as a string or as binary; strings can only be sent over direct, unencrypted connections (see ErrStringMessagesUnsupported)
+func (p *Peer) WriteMessage(b []byte, isString bool) (int, error) {
+	if c, ok := p.Conn.(messageConn); ok {
+		return c.WriteDataChannel(b, isString)
+	}
+
+	if isString {
+		return 0, ErrStringMessagesUnsupported
+	}
+
+	return p.Conn.Write(b)
+}
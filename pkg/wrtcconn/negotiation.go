@@ -0,0 +1,33 @@
+package wrtcconn
+
+import "errors"
+
+const (
+	NegotiationBoth     = "both"     // Send offers to introduced peers and answer offers from them
+	NegotiationListen   = "listen"   // Only answer offers; peers which introduce themselves are asked to send an offer instead, i.e. for the hub of a hub-and-spoke topology
+	NegotiationInitiate = "initiate" // Only send offers; offers from other peers are discarded, i.e. for the spokes of a hub-and-spoke topology
+)
+
+var (
+	ErrInvalidNegotiation = errors.New("invalid negotiation mode") // The specified negotiation mode is neither both, listen nor initiate
+)
+
+// validateNegotiation checks that the negotiation mode is known
+func validateNegotiation(mode string) error {
+	switch mode {
+	case "", NegotiationBoth, NegotiationListen, NegotiationInitiate:
+		return nil
+	default:
+		return ErrInvalidNegotiation
+	}
+}
+
+// canOffer returns whether a peer with the negotiation mode sends offers; unknown modes are treated like NegotiationBoth
+func canOffer(mode string) bool {
+	return mode != NegotiationListen
+}
+
+// canAnswer returns whether a peer with the negotiation mode answers offers; unknown modes are treated like NegotiationBoth
+func canAnswer(mode string) bool {
+	return mode != NegotiationInitiate
+}
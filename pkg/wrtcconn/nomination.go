@@ -0,0 +1,33 @@
+package wrtcconn
+
+import (
+	"errors"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	NominationRegular    = "regular"    // Wait for better candidate pairs before nominating server reflexive, peer reflexive and relayed ones, which prefers direct connections at the cost of setup time
+	NominationAggressive = "aggressive" // Nominate the first candidate pair which succeeds, which reduces setup time but may select a relayed pair even if a direct one would have succeeded shortly after
+)
+
+var (
+	ErrInvalidNomination = errors.New("invalid nomination, must be regular or aggressive") // The specified nomination is invalid
+)
+
+// setNomination configures how the ICE agent nominates candidate pairs
+func setNomination(settingEngine *webrtc.SettingEngine, nomination string) error {
+	switch nomination {
+	case "", NominationRegular:
+		return nil
+	case NominationAggressive:
+		settingEngine.SetHostAcceptanceMinWait(0)
+		settingEngine.SetSrflxAcceptanceMinWait(0)
+		settingEngine.SetPrflxAcceptanceMinWait(0)
+		settingEngine.SetRelayAcceptanceMinWait(0)
+
+		return nil
+	default:
+		return ErrInvalidNomination
+	}
+}
@@ -0,0 +1,108 @@
+package wrtcconn
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	PathHost            = "host"       // The peers are connected directly, i.e. in the same network
+	PathServerReflexive = "srflx"      // The peers are connected directly through NAT, using an address discovered with a STUN server
+	PathPeerReflexive   = "prflx"      // The peers are connected directly through NAT, using an address discovered during connectivity checks
+	PathRelay           = "relay"      // The connection is relayed through a TURN server
+	PathSignaler        = "signaler"   // Payloads are relayed through the signaler because a connection could not be established
+	PathDataRelay       = "data-relay" // Payloads are relayed through a data relay (see wrtcrly) because a connection could not be established
+	PathMesh            = "mesh"       // Payloads are forwarded through other peers because the peer isn't directly connected (see AdapterConfig.MeshDegree)
+
+	pathCheckInterval = time.Second * 5 // Time to wait between checks of the paths to peers
+)
+
+// PeerPath is the path of the connection to a peer
+type PeerPath struct {
+	Community string // Community in which the peer is connected
+	PeerID    string // ID of the peer
+	Path      string // Path of the connection (see PathHost etc.)
+}
+
+// getPath returns the path of the selected candidate pair of a connection, which is the least direct type of its local and remote candidates (empty if no pair has been selected)
+func getPath(report webrtc.StatsReport) string {
+	ranks := map[webrtc.ICECandidateType]int{
+		webrtc.ICECandidateTypeHost:  0,
+		webrtc.ICECandidateTypeSrflx: 1,
+		webrtc.ICECandidateTypePrflx: 1,
+		webrtc.ICECandidateTypeRelay: 2,
+	}
+
+	for _, s := range report {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+		if !ok || !pair.Nominated || pair.State != webrtc.StatsICECandidatePairStateSucceeded {
+			continue
+		}
+
+		path := ""
+		rank := -1
+		for _, id := range []string{pair.LocalCandidateID, pair.RemoteCandidateID} {
+			c, ok := report[id].(webrtc.ICECandidateStats)
+			if !ok {
+				continue
+			}
+
+			if r, ok := ranks[c.CandidateType]; ok && r > rank {
+				path = c.CandidateType.String()
+				rank = r
+			}
+		}
+
+		return path
+	}
+
+	return ""
+}
+
+// getCandidateTypes returns the types of the local and remote candidates of the selected candidate pair of a connection (empty if no pair has been selected)
+func getCandidateTypes(report webrtc.StatsReport) (string, string) {
+	for _, s := range report {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+		if !ok || !pair.Nominated {
+			continue
+		}
+
+		local, remote := "", ""
+		if c, ok := report[pair.LocalCandidateID].(webrtc.ICECandidateStats); ok {
+			local = c.CandidateType.String()
+		}
+
+		if c, ok := report[pair.RemoteCandidateID].(webrtc.ICECandidateStats); ok {
+			remote = c.CandidateType.String()
+		}
+
+		return local, remote
+	}
+
+	return "", ""
+}
+
+// getTransferredBytes returns the total amount of bytes which have been sent and received over a connection
+func getTransferredBytes(report webrtc.StatsReport) (uint64, uint64) {
+	for _, s := range report {
+		if t, ok := s.(webrtc.TransportStats); ok && t.ID == "iceTransport" {
+			return t.BytesSent, t.BytesReceived
+		}
+	}
+
+	return 0, 0
+}
+
+// Paths returns the paths of the connections to all peers
+func (a *Adapter) Paths() []PeerPath {
+	a.pathsLock.Lock()
+	paths := a.paths
+	a.pathsLock.Unlock()
+
+	if paths == nil {
+		return a.mesh.getPaths()
+	}
+
+	return append(paths(), a.mesh.getPaths()...)
+}
@@ -0,0 +1,173 @@
+package wrtcconn
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DropPolicyTail = "tail" // Drop new frames if the queue is full
+	DropPolicyHead = "head" // Drop the oldest queued frame if the queue is full
+)
+
+var (
+	ErrInvalidDropPolicy = errors.New("invalid drop policy, must be tail or head") // The specified drop policy is unknown
+)
+
+// QueueConfig configures the queued connection
+type QueueConfig struct {
+	Length     int          // Amount of frames to queue before dropping them (default is 1024)
+	DropPolicy string       // Frames to drop if the queue is full (tail or head) (default is tail)
+	OnDrop     func([]byte) // Handler to be called when a frame has been dropped
+}
+
+// QueuedConn sends frames from a bounded queue in its own goroutine so that writes never block on a slow peer
+type QueuedConn struct {
+	conn   io.ReadWriteCloser
+	config *QueueConfig
+
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	errLock sync.Mutex
+	err     error
+
+	dropped uint64
+}
+
+// ValidateDropPolicy checks whether a drop policy is known
+func ValidateDropPolicy(policy string) error {
+	switch policy {
+	case "", DropPolicyTail, DropPolicyHead:
+		return nil
+	default:
+		return ErrInvalidDropPolicy
+	}
+}
+
+// NewQueuedConn creates the queued connection and starts sending queued frames
+func NewQueuedConn(
+	conn io.ReadWriteCloser,
+	config *QueueConfig,
+) *QueuedConn {
+	if config == nil {
+		config = &QueueConfig{}
+	}
+
+	if config.Length <= 0 {
+		config.Length = 1024
+	}
+
+	if config.DropPolicy == "" {
+		config.DropPolicy = DropPolicyTail
+	}
+
+	c := &QueuedConn{
+		conn:   conn,
+		config: config,
+
+		queue: make(chan []byte, config.Length),
+		done:  make(chan struct{}),
+	}
+
+	go c.send()
+
+	return c
+}
+
+func (c *QueuedConn) send() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case p := <-c.queue:
+			if _, err := c.conn.Write(p); err != nil {
+				c.errLock.Lock()
+				c.err = err
+				c.errLock.Unlock()
+
+				return
+			}
+		}
+	}
+}
+
+func (c *QueuedConn) drop(p []byte) {
+	atomic.AddUint64(&c.dropped, 1)
+
+	if c.config.OnDrop != nil {
+		c.config.OnDrop(p)
+	}
+}
+
+// Write queues a frame; if the queue is full, a frame is dropped according to the drop policy
+func (c *QueuedConn) Write(p []byte) (int, error) {
+	c.errLock.Lock()
+	err := c.err
+	c.errLock.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	// The frame is copied as the caller may reuse its buffer
+	frame := make([]byte, len(p))
+	copy(frame, p)
+
+	select {
+	case c.queue <- frame:
+		return len(p), nil
+	default:
+	}
+
+	if c.config.DropPolicy == DropPolicyHead {
+		select {
+		case oldest := <-c.queue:
+			c.drop(oldest)
+		default:
+		}
+
+		select {
+		case c.queue <- frame:
+			return len(p), nil
+		default:
+		}
+	}
+
+	c.drop(frame)
+
+	return len(p), nil
+}
+
+// Read reads from the underlying connection
+func (c *QueuedConn) Read(p []byte) (int, error) {
+	return c.conn.Read(p)
+}
+
+// Dropped returns the amount of frames which have been dropped because the queue was full
+func (c *QueuedConn) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Queued returns the amount of frames which are waiting to be sent
+func (c *QueuedConn) Queued() int {
+	return len(c.queue)
+}
+
+// Close stops sending queued frames and closes the underlying connection
+func (c *QueuedConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
+	return c.conn.Close()
+}
@@ -0,0 +1,45 @@
+package wrtcconn
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pojntfx/weron/internal/webtransport"
+)
+
+const (
+	maxSignalerRedirects = 3 // Maximum amount of redirects to follow when connecting to the signaler (i.e. to the replica of a sharded fleet which owns the community)
+)
+
+// getRedirect returns the WebSocket or WebTransport URL, depending on the scheme of the handshake, which the signaler has redirected a handshake to, or nil if the handshake hasn't been redirected
+func getRedirect(res *http.Response, scheme string) *url.URL {
+	if res == nil {
+		return nil
+	}
+
+	switch res.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+
+	u, err := res.Location()
+	if err != nil {
+		return nil
+	}
+
+	if scheme == webtransport.Scheme {
+		u.Scheme = webtransport.Scheme
+
+		return u
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+
+	return u
+}
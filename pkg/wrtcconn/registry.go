@@ -0,0 +1,167 @@
+package wrtcconn
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
+)
+
+// RegisteredService is a service which a peer has announced in its metadata
+type RegisteredService struct {
+	v1.Service
+	PeerID string // ID of the peer which offers the service
+}
+
+// ParseServices parses the services a peer has announced in its metadata (see AdapterConfig.Services); metadata which doesn't announce services contains no services
+func ParseServices(metadata []byte) ([]v1.Service, error) {
+	if len(metadata) == 0 {
+		return []v1.Service{}, nil
+	}
+
+	var message v1.Message
+	if err := json.Unmarshal(metadata, &message); err != nil || message.Type != v1.TypeServices {
+		return []v1.Service{}, nil
+	}
+
+	var announcement v1.Services
+	if err := json.Unmarshal(metadata, &announcement); err != nil {
+		return nil, err
+	}
+
+	return announcement.Services, nil
+}
+
+// Registry aggregates the services which peers have announced in their metadata
+type Registry struct {
+	lock     sync.Mutex
+	services map[string][]v1.Service
+	changed  chan struct{}
+}
+
+// NewRegistry creates the registry
+func NewRegistry() *Registry {
+	return &Registry{
+		services: map[string][]v1.Service{},
+		changed:  make(chan struct{}),
+	}
+}
+
+// Add adds or replaces the services a peer has announced in its metadata
+func (r *Registry) Add(peerID string, metadata []byte) error {
+	services, err := ParseServices(metadata)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if current, ok := r.services[peerID]; ok && reflect.DeepEqual(current, services) {
+		return nil
+	}
+
+	if len(services) == 0 {
+		if _, ok := r.services[peerID]; !ok {
+			return nil
+		}
+
+		delete(r.services, peerID)
+	} else {
+		r.services[peerID] = services
+	}
+
+	r.notify()
+
+	return nil
+}
+
+// Remove removes the services of a peer
+func (r *Registry) Remove(peerID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.services[peerID]; !ok {
+		return
+	}
+
+	delete(r.services, peerID)
+
+	r.notify()
+}
+
+// notify wakes up all watchers; the lock must be held
+func (r *Registry) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// list returns the services with a name (all services if the name is empty) sorted by name and peer ID; the lock must be held
+func (r *Registry) list(name string) []RegisteredService {
+	registered := []RegisteredService{}
+	for peerID, services := range r.services {
+		for _, service := range services {
+			if name == "" || service.Name == name {
+				registered = append(registered, RegisteredService{service, peerID})
+			}
+		}
+	}
+
+	sort.Slice(registered, func(i, j int) bool {
+		if registered[i].Name != registered[j].Name {
+			return registered[i].Name < registered[j].Name
+		}
+
+		return registered[i].PeerID < registered[j].PeerID
+	})
+
+	return registered
+}
+
+// List returns all services
+func (r *Registry) List() []RegisteredService {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.list("")
+}
+
+// Lookup returns the peers which offer a service
+func (r *Registry) Lookup(name string) []RegisteredService {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.list(name)
+}
+
+// Watch sends all services on the returned channel, first immediately and then whenever they have changed; the channel is closed once the context is cancelled
+func (r *Registry) Watch(ctx context.Context) chan []RegisteredService {
+	services := make(chan []RegisteredService)
+
+	go func() {
+		defer close(services)
+
+		for {
+			r.lock.Lock()
+			registered := r.list("")
+			changed := r.changed
+			r.lock.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case services <- registered:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+
+	return services
+}
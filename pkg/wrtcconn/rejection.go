@@ -0,0 +1,91 @@
+package wrtcconn
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+)
+
+var (
+	ErrInvalidRequest               = errors.New("signaler rejected the request as invalid")                                     // A community or password is missing
+	ErrWrongPassword                = errors.New("wrong password for community")                                                 // The password for a community is wrong
+	ErrEphemeralCommunitiesDisabled = errors.New("community doesn't exist and the signaler doesn't allow ephemeral communities") // The community must be created with the management API first
+	ErrForbidden                    = errors.New("banned from signaler or connecting from a network which is not allowed")       // The signaler doesn't allow the IP or ID of the adapter
+	ErrKicked                       = errors.New("kicked from community")                                                        // The community has been deleted or has expired, or its password has been rotated
+	ErrMisdirected                  = errors.New("communities are owned by different replicas of the signaler")                  // The communities must be joined with separate adapters
+	ErrQuotaExceeded                = errors.New("community has exceeded its monthly quota")                                     // The community is suspended until the next month
+	ErrDraining                     = errors.New("signaler is draining")                                                         // The signaler is shutting down; reconnecting is routed to another signaler
+
+	ErrPermissionDenied = errors.New("permission denied by signaler") // The signaler has permanently rejected the adapter (i.e. because of a wrong password or a ban), so it has stopped reconnecting; the reason is passed to OnSignalerDisconnect
+)
+
+var (
+	rejections = map[int]error{
+		websocketapi.CloseInvalidRequest:               ErrInvalidRequest,
+		websocketapi.CloseWrongPassword:                ErrWrongPassword,
+		websocketapi.CloseEphemeralCommunitiesDisabled: ErrEphemeralCommunitiesDisabled,
+		websocketapi.CloseForbidden:                    ErrForbidden,
+		websocketapi.CloseKicked:                       ErrKicked,
+		websocketapi.CloseMisdirected:                  ErrMisdirected,
+		websocketapi.CloseQuotaExceeded:                ErrQuotaExceeded,
+		websocketapi.CloseDraining:                     ErrDraining,
+	}
+)
+
+// isRejection returns whether an error is one of the typed rejections
+func isRejection(err error) bool {
+	for _, rejection := range rejections {
+		if err == rejection {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPermanentRejection returns whether reconnecting can't resolve a rejection; communities which have been kicked or have exceeded their quota and signalers which are draining can be joined again later
+func isPermanentRejection(err error) bool {
+	return err == ErrInvalidRequest ||
+		err == ErrWrongPassword ||
+		err == ErrEphemeralCommunitiesDisabled ||
+		err == ErrForbidden ||
+		err == ErrMisdirected
+}
+
+// getRejection converts a rejection from the signaler, which is either the body of a rejected handshake or a close frame, into one of the typed errors; other errors (i.e. from signalers which don't send rejections) are returned unchanged
+func getRejection(err error, res *http.Response) error {
+	if err == nil {
+		return nil
+	}
+
+	if e, ok := err.(*websocket.CloseError); ok {
+		if rejection, ok := rejections[e.Code]; ok {
+			return rejection
+		}
+
+		return err
+	}
+
+	if err != websocket.ErrBadHandshake || res == nil || res.Body == nil {
+		return err
+	}
+
+	body, e := ioutil.ReadAll(res.Body)
+	if e != nil {
+		return err
+	}
+
+	var r websocketapi.Rejection
+	if e := json.Unmarshal(body, &r); e != nil {
+		return err
+	}
+
+	if rejection, ok := rejections[r.Code]; ok {
+		return rejection
+	}
+
+	return err
+}
@@ -0,0 +1,130 @@
+package wrtcconn
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRelayRateLimit = 64 * 1024 // Default amount of bytes per second to relay through the signaler per channel
+	relayQueueLength      = 128       // Amount of relayed messages to queue before dropping new ones
+)
+
+// relayConn sends the payloads of a channel through the signaler or a data relay instead of a data channel
+type relayConn struct {
+	rate    int
+	path    string // Path of the relayed connection (see PathSignaler and PathDataRelay)
+	send    func(p []byte) error
+	onClose func()
+
+	reads     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	writeLock sync.Mutex
+	next      time.Time
+}
+
+// newRelayConn creates the connection; a rate of 0 uses the default rate limit, and a negative rate disables it
+func newRelayConn(rate int, path string, send func(p []byte) error, onClose func()) *relayConn {
+	if rate == 0 {
+		rate = defaultRelayRateLimit
+	}
+
+	return &relayConn{
+		rate:    rate,
+		path:    path,
+		send:    send,
+		onClose: onClose,
+
+		reads: make(chan []byte, relayQueueLength),
+		done:  make(chan struct{}),
+	}
+}
+
+// deliver queues a relayed message for reading; it returns false if the message has been dropped
+func (c *relayConn) deliver(p []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.reads <- p:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *relayConn) Read(p []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, io.EOF
+	case msg := <-c.reads:
+		// Match the message-oriented semantics of detached data channels
+		if len(p) < len(msg) {
+			return 0, io.ErrShortBuffer
+		}
+
+		return copy(p, msg), nil
+	}
+}
+
+func (c *relayConn) Write(p []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	// Spread writes over time so that relayed peers can't exhaust the signaler
+	if c.rate > 0 {
+		now := time.Now()
+		if c.next.Before(now) {
+			c.next = now
+		}
+
+		wait := c.next.Sub(now)
+		c.next = c.next.Add(time.Duration(len(p)) * time.Second / time.Duration(c.rate))
+
+		if wait > 0 {
+			select {
+			case <-c.done:
+				return 0, io.ErrClosedPipe
+			case <-time.After(wait):
+			}
+		}
+	}
+
+	select {
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	if err := c.send(p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// closeLocal closes the connection without notifying the remote peer
+func (c *relayConn) closeLocal() bool {
+	closed := false
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		closed = true
+	})
+
+	return closed
+}
+
+func (c *relayConn) Close() error {
+	if c.closeLocal() && c.onClose != nil {
+		c.onClose()
+	}
+
+	return nil
+}
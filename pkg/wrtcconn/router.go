@@ -0,0 +1,101 @@
+package wrtcconn
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AcceptPolicyBlock = "block" // Wait until the application accepts the peer or the peer is closed; the adapter never holds a lock while waiting
+	AcceptPolicyDrop  = "drop"  // Close the channel if the queue is full; the other channels of the peer stay open
+)
+
+var (
+	ErrInvalidAcceptPolicy = errors.New("invalid accept policy") // The specified accept policy is neither block nor drop
+)
+
+// channelRouter sends peers to the channel of their label if it is accepted separately and to the shared channel otherwise
+type channelRouter struct {
+	lock        sync.Mutex
+	channels    map[string]chan *Peer
+	fallback    chan *Peer
+	queueLength int
+	policy      string
+}
+
+func newChannelRouter(fallback chan *Peer, queueLength int, policy string) *channelRouter {
+	return &channelRouter{
+		channels:    map[string]chan *Peer{},
+		fallback:    fallback,
+		queueLength: queueLength,
+		policy:      policy,
+	}
+}
+
+// validatePolicy checks that the accept policy is known
+func validatePolicy(policy string) error {
+	switch policy {
+	case "", AcceptPolicyBlock, AcceptPolicyDrop:
+		return nil
+	default:
+		return ErrInvalidAcceptPolicy
+	}
+}
+
+// route returns the channel to send a peer to
+func (r *channelRouter) route(peer *Peer) chan *Peer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if c, ok := r.channels[peer.ChannelID]; ok {
+		return c
+	}
+
+	return r.fallback
+}
+
+// deliver sends a peer to the application according to the accept policy; it must not be called with a lock held, as it can block until the context is cancelled
+func (r *channelRouter) deliver(ctx context.Context, peer *Peer) {
+	c := r.route(peer)
+
+	if r.policy == AcceptPolicyDrop {
+		select {
+		case c <- peer:
+		default:
+			log.Debug().
+				Str("community", peer.Community).
+				Str("peerID", peer.PeerID).
+				Str("channelID", peer.ChannelID).
+				Msg("Could not accept channel because the accept queue is full, dropping")
+
+			// Only the queue of this channel is full, so the connection to the peer is kept
+			_ = peer.Conn.Close()
+		}
+
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		_ = peer.Conn.Close()
+	case c <- peer:
+	}
+}
+
+// accept returns the channel for a label, which is created on first use
+func (r *channelRouter) accept(channelID string) chan *Peer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c, ok := r.channels[channelID]
+	if !ok {
+		c = make(chan *Peer, r.queueLength)
+
+		r.channels[channelID] = c
+	}
+
+	return c
+}
@@ -0,0 +1,138 @@
+package wrtcconn
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closeRecorder records whether a channel has been closed
+type closeRecorder struct {
+	closed atomic.Bool
+}
+
+func (c *closeRecorder) Read(p []byte) (int, error)  { return 0, io.EOF }
+func (c *closeRecorder) Write(p []byte) (int, error) { return len(p), nil }
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+
+	return nil
+}
+
+// newRouterPeer creates a peer whose channel and peer connection record whether they have been closed
+func newRouterPeer(channelID string) (*Peer, *closeRecorder, *atomic.Bool) {
+	conn := &closeRecorder{}
+	peerClosed := &atomic.Bool{}
+
+	return &Peer{
+		PeerID:    "peer",
+		ChannelID: channelID,
+		Conn:      conn,
+		Community: "community",
+		close: func(reason string) error {
+			peerClosed.Store(true)
+
+			return nil
+		},
+	}, conn, peerClosed
+}
+
+func TestChannelRouterDeliverContention(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"default", ""},
+		{"block", AcceptPolicyBlock},
+		{"drop", AcceptPolicyDrop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The consumer never calls Accept, so the queue fills up after the first peer
+			r := newChannelRouter(make(chan *Peer), 1, tt.policy)
+			queue := r.accept("primary")
+
+			first, firstConn, firstPeerClosed := newRouterPeer("primary")
+			r.deliver(ctx, first)
+
+			second, secondConn, secondPeerClosed := newRouterPeer("primary")
+			delivered := make(chan struct{})
+			go func() {
+				defer close(delivered)
+
+				r.deliver(ctx, second)
+			}()
+
+			if tt.policy == AcceptPolicyDrop {
+				select {
+				case <-delivered:
+				case <-time.After(time.Second):
+					t.Fatal("deliver blocked with drop policy")
+				}
+
+				if !secondConn.closed.Load() {
+					t.Fatal("dropped channel hasn't been closed")
+				}
+			} else {
+				select {
+				case <-delivered:
+					t.Fatal("deliver didn't block with block policy")
+				case <-time.After(time.Millisecond * 100):
+				}
+
+				if secondConn.closed.Load() {
+					t.Fatal("blocked channel has been closed")
+				}
+
+				cancel()
+
+				select {
+				case <-delivered:
+				case <-time.After(time.Second):
+					t.Fatal("deliver didn't return after the context was cancelled")
+				}
+
+				if !secondConn.closed.Load() {
+					t.Fatal("channel hasn't been closed after the context was cancelled")
+				}
+			}
+
+			// Only the channel which couldn't be queued is affected, not the peer connection or other channels
+			if firstPeerClosed.Load() || secondPeerClosed.Load() {
+				t.Fatal("peer connection has been closed")
+			}
+
+			if firstConn.closed.Load() {
+				t.Fatal("queued channel has been closed")
+			}
+
+			if got := <-queue; got != first {
+				t.Fatal("queued peer isn't the first peer")
+			}
+		})
+	}
+}
+
+func TestChannelRouterDeliverFallback(t *testing.T) {
+	fallback := make(chan *Peer, 1)
+	r := newChannelRouter(fallback, 1, AcceptPolicyDrop)
+	r.accept("primary")
+
+	p, _, _ := newRouterPeer("secondary")
+	r.deliver(context.Background(), p)
+
+	select {
+	case got := <-fallback:
+		if got != p {
+			t.Fatal("got wrong peer from fallback")
+		}
+	default:
+		t.Fatal("peer on channel which isn't accepted separately wasn't sent to the fallback")
+	}
+}
@@ -0,0 +1,21 @@
+package wrtcconn
+
+import "github.com/pion/webrtc/v3"
+
+// mungeLocalDescription lets the application modify an offer or answer before it is set as the local description and sent to the peer
+func (a *Adapter) mungeLocalDescription(community string, peerID string, sdp webrtc.SessionDescription) webrtc.SessionDescription {
+	if a.config.OnLocalDescription == nil {
+		return sdp
+	}
+
+	return a.config.OnLocalDescription(community, peerID, sdp)
+}
+
+// mungeRemoteDescription lets the application modify an offer or answer from the peer before it is set as the remote description
+func (a *Adapter) mungeRemoteDescription(community string, peerID string, sdp webrtc.SessionDescription) webrtc.SessionDescription {
+	if a.config.OnRemoteDescription == nil {
+		return sdp
+	}
+
+	return a.config.OnRemoteDescription(community, peerID, sdp)
+}
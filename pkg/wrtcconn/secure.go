@@ -0,0 +1,353 @@
+package wrtcconn
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	SecureOverhead = secureCounterLength + chacha20poly1305.Overhead // Amount of bytes which encryption adds to each message
+
+	secureVersion          = 1    // Version of the handshake
+	secureAck              = 0x80 // Flag which marks handshakes that answer a handshake of the peer, so that they aren't answered again
+	secureCounterLength    = 8    // Length of the message counter which is used as the nonce
+	secureHandshakeLength  = 1 + curve25519.PointSize
+	secureReplayWindow     = 64                     // Amount of messages which may arrive out of order before they are rejected as replays
+	secureMaxMessageSize   = 65536                  // Maximum size of a message which can be received during the handshake (the maximum size of an SCTP message)
+	secureRetransmit       = time.Millisecond * 250 // Time to wait before retransmitting the handshake, which can be lost on unreliable channels
+	secureHandshakeTimeout = time.Second * 10       // Time to wait for the handshake of the peer
+)
+
+var (
+	ErrHandshakeTimeout = errors.New("timed out waiting for handshake from peer") // The peer hasn't sent its handshake in time (i.e. because it doesn't use end-to-end encryption or uses a different version)
+
+	secureInfo = []byte("weron/secure/v1")
+)
+
+// SecureConn encrypts and authenticates all messages on a connection with per-peer keys, which are derived from an X25519 handshake and a pre-shared key; both peers must wrap the connection. The handshake is retransmitted until the handshake of the peer has been received, so it also works on unreliable channels
+type SecureConn struct {
+	conn io.ReadWriteCloser
+	psk  []byte
+
+	handshakeOnce sync.Once
+	handshakeErr  error
+
+	public  []byte
+	remote  []byte
+	pending [][]byte
+
+	send cipher.AEAD
+	recv cipher.AEAD
+
+	writeLock sync.Mutex
+	counter   uint64
+
+	readLock sync.Mutex
+	readBuf  []byte
+	highest  uint64
+	window   uint64
+}
+
+// NewSecureConn wraps a message-oriented connection; the handshake is done on the first read or write or by calling Handshake
+func NewSecureConn(conn io.ReadWriteCloser, psk []byte) *SecureConn {
+	return &SecureConn{
+		conn: conn,
+		psk:  psk,
+	}
+}
+
+// Handshake exchanges ephemeral public keys with the peer and derives the keys; it is only done once
+func (c *SecureConn) Handshake() error {
+	c.handshakeOnce.Do(func() {
+		c.handshakeErr = c.handshake()
+	})
+
+	return c.handshakeErr
+}
+
+func (c *SecureConn) handshake() error {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		return err
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+
+	c.public = public
+
+	remote, err := c.receiveHandshake()
+	if err != nil {
+		return err
+	}
+	c.remote = remote
+
+	shared, err := curve25519.X25519(private, remote)
+	if err != nil {
+		return err
+	}
+
+	// Both public keys are bound to the keys in a stable order, and the pre-shared key prevents peers outside of the community from deriving them
+	first, second := public, remote
+	if bytes.Compare(first, second) > 0 {
+		first, second = second, first
+	}
+
+	info := append(append(append([]byte{}, secureInfo...), first...), second...)
+	keys := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, c.psk, info), keys); err != nil {
+		return err
+	}
+
+	sendKey, recvKey := keys[:chacha20poly1305.KeySize], keys[chacha20poly1305.KeySize:]
+	if bytes.Equal(first, remote) {
+		sendKey, recvKey = recvKey, sendKey
+	}
+
+	if c.send, err = chacha20poly1305.New(sendKey); err != nil {
+		return err
+	}
+
+	if c.recv, err = chacha20poly1305.New(recvKey); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// receiveHandshake sends the handshake until the handshake of the peer has been received; messages which are received before it (i.e. on unordered channels) are kept until the keys have been derived
+func (c *SecureConn) receiveHandshake() ([]byte, error) {
+	type result struct {
+		remote []byte
+		ack    bool
+		err    error
+	}
+
+	// Reads from the channel can't be cancelled, so the reader exits once the channel has been closed (i.e. after the handshake has timed out)
+	results := make(chan result, 1)
+	go func() {
+		for {
+			buf := make([]byte, secureMaxMessageSize)
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				results <- result{err: err}
+
+				return
+			}
+
+			if n == secureHandshakeLength && buf[0]&^secureAck == secureVersion {
+				results <- result{remote: buf[1:n], ack: buf[0]&secureAck != 0}
+
+				return
+			}
+
+			if len(c.pending) < secureReplayWindow {
+				c.pending = append(c.pending, buf[:n])
+			}
+		}
+	}()
+
+	if err := c.writeHandshake(false); err != nil {
+		return nil, err
+	}
+
+	t := time.NewTicker(secureRetransmit)
+	defer t.Stop()
+
+	timeout := time.NewTimer(secureHandshakeTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				return nil, r.err
+			}
+
+			if !r.ack {
+				if err := c.writeHandshake(true); err != nil {
+					return nil, err
+				}
+			}
+
+			return r.remote, nil
+		case <-t.C:
+			if err := c.writeHandshake(false); err != nil {
+				return nil, err
+			}
+		case <-timeout.C:
+			return nil, ErrHandshakeTimeout
+		}
+	}
+}
+
+func (c *SecureConn) writeHandshake(ack bool) error {
+	version := byte(secureVersion)
+	if ack {
+		version |= secureAck
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err := c.conn.Write(append([]byte{version}, c.public...))
+
+	return err
+}
+
+// Read reads and decrypts a message; messages which can't be authenticated or which have already been received are dropped
+func (c *SecureConn) Read(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+
+		if n, ok := c.open(p, msg); ok {
+			return n, nil
+		}
+	}
+
+	if len(c.readBuf) < len(p)+SecureOverhead {
+		c.readBuf = make([]byte, len(p)+SecureOverhead)
+	}
+
+	for {
+		n, err := c.conn.Read(c.readBuf)
+		if err != nil {
+			return 0, err
+		}
+
+		// The peer retransmits its handshake until it has received an answer, which can be lost on unreliable channels
+		if n == secureHandshakeLength && c.readBuf[0]&^secureAck == secureVersion && bytes.Equal(c.readBuf[1:n], c.remote) {
+			if c.readBuf[0]&secureAck == 0 {
+				if err := c.writeHandshake(true); err != nil {
+					return 0, err
+				}
+			}
+
+			continue
+		}
+
+		if n, ok := c.open(p, c.readBuf[:n]); ok {
+			return n, nil
+		}
+	}
+}
+
+// open decrypts a message into p and returns whether it could be decrypted
+func (c *SecureConn) open(p []byte, msg []byte) (int, bool) {
+	if len(msg) < SecureOverhead {
+		log.Debug().Int("len", len(msg)).Msg("Could not decrypt message because it is too short, dropping")
+
+		return 0, false
+	}
+
+	counter := binary.BigEndian.Uint64(msg[:secureCounterLength])
+	if !c.isFresh(counter) {
+		log.Debug().Uint64("counter", counter).Msg("Could not decrypt message because it has already been received, dropping")
+
+		return 0, false
+	}
+
+	if len(msg)-SecureOverhead > len(p) {
+		log.Debug().Int("len", len(msg)).Msg("Could not decrypt message because it is larger than the buffer, dropping")
+
+		return 0, false
+	}
+
+	plaintext, err := c.recv.Open(p[:0], getSecureNonce(counter), msg[secureCounterLength:], nil)
+	if err != nil {
+		log.Debug().Err(err).Uint64("counter", counter).Msg("Could not decrypt message, dropping")
+
+		return 0, false
+	}
+
+	c.markReceived(counter)
+
+	return len(plaintext), true
+}
+
+// Write encrypts and writes a message
+func (c *SecureConn) Write(p []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.counter++
+
+	msg := make([]byte, secureCounterLength, len(p)+SecureOverhead)
+	binary.BigEndian.PutUint64(msg, c.counter)
+	msg = c.send.Seal(msg, getSecureNonce(c.counter), p, nil)
+
+	if _, err := c.conn.Write(msg); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the underlying connection
+func (c *SecureConn) Close() error {
+	return c.conn.Close()
+}
+
+// isFresh checks the counter against a sliding window, so that unordered channels still work but replayed messages are rejected
+func (c *SecureConn) isFresh(counter uint64) bool {
+	if counter == 0 {
+		return false
+	}
+
+	if counter > c.highest {
+		return true
+	}
+
+	if c.highest-counter >= secureReplayWindow {
+		return false
+	}
+
+	return c.window&(1<<(c.highest-counter)) == 0
+}
+
+func (c *SecureConn) markReceived(counter uint64) {
+	if counter > c.highest {
+		if shift := counter - c.highest; shift < secureReplayWindow {
+			c.window <<= shift
+		} else {
+			c.window = 0
+		}
+
+		c.highest = counter
+	}
+
+	c.window |= 1 << (c.highest - counter)
+}
+
+func getSecureNonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[chacha20poly1305.NonceSize-secureCounterLength:], counter)
+
+	return nonce
+}
@@ -0,0 +1,164 @@
+package wrtcconn
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyConn is one end of a message-oriented pipe which drops the messages that drop returns true for
+type lossyConn struct {
+	in   chan []byte
+	out  chan []byte
+	drop func(i int) bool
+
+	writesLock sync.Mutex
+	writes     int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLossyPipe(dropA func(i int) bool, dropB func(i int) bool) (*lossyConn, *lossyConn) {
+	ab, ba := make(chan []byte, 1024), make(chan []byte, 1024)
+
+	return &lossyConn{in: ba, out: ab, drop: dropA, done: make(chan struct{})},
+		&lossyConn{in: ab, out: ba, drop: dropB, done: make(chan struct{})}
+}
+
+func (c *lossyConn) Read(p []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, io.EOF
+	case msg := <-c.in:
+		if len(msg) > len(p) {
+			return 0, io.ErrShortBuffer
+		}
+
+		return copy(p, msg), nil
+	}
+}
+
+func (c *lossyConn) Write(p []byte) (int, error) {
+	c.writesLock.Lock()
+	i := c.writes
+	c.writes++
+	c.writesLock.Unlock()
+
+	if c.drop != nil && c.drop(i) {
+		return len(p), nil
+	}
+
+	c.out <- append([]byte{}, p...)
+
+	return len(p), nil
+}
+
+func (c *lossyConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
+	return nil
+}
+
+func TestSecureConnHandshake(t *testing.T) {
+	tests := []struct {
+		name  string
+		dropA func(i int) bool
+		dropB func(i int) bool
+	}{
+		{
+			"reliable",
+			nil,
+			nil,
+		},
+		{
+			"first handshake of one peer lost",
+			func(i int) bool { return i == 0 },
+			nil,
+		},
+		{
+			"first handshakes of both peers lost",
+			func(i int) bool { return i < 2 },
+			func(i int) bool { return i < 3 },
+		},
+		{
+			"answer lost",
+			nil,
+			func(i int) bool { return i == 1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawA, rawB := newLossyPipe(tt.dropA, tt.dropB)
+			defer rawA.Close()
+			defer rawB.Close()
+
+			a, b := NewSecureConn(rawA, []byte("psk")), NewSecureConn(rawB, []byte("psk"))
+
+			errs := make(chan error, 2)
+			go func() { errs <- a.Handshake() }()
+			go func() { errs <- b.Handshake() }()
+
+			for i := 0; i < 2; i++ {
+				if err := <-errs; err != nil {
+					t.Fatalf("could not handshake: %v", err)
+				}
+			}
+
+			for _, dir := range []struct {
+				from, to *SecureConn
+			}{{a, b}, {b, a}} {
+				if _, err := dir.from.Write([]byte("hello")); err != nil {
+					t.Fatalf("could not write: %v", err)
+				}
+
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+
+					buf := make([]byte, 1024)
+					n, err := dir.to.Read(buf)
+					if err != nil {
+						t.Errorf("could not read: %v", err)
+
+						return
+					}
+
+					if got := string(buf[:n]); got != "hello" {
+						t.Errorf("read %q, want %q", got, "hello")
+					}
+				}()
+
+				select {
+				case <-done:
+				case <-time.After(secureHandshakeTimeout):
+					t.Fatal("timed out reading")
+				}
+			}
+		})
+	}
+}
+
+func TestSecureConnHandshakeTimeout(t *testing.T) {
+	rawA, rawB := newLossyPipe(nil, func(int) bool { return true })
+	defer rawA.Close()
+	defer rawB.Close()
+
+	go func() {
+		// The peer never answers, so its messages are dropped
+		buf := make([]byte, secureMaxMessageSize)
+		for {
+			if _, err := rawB.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := NewSecureConn(rawA, []byte("psk")).Handshake(); err != ErrHandshakeTimeout {
+		t.Fatalf("got %v, want %v", err, ErrHandshakeTimeout)
+	}
+}
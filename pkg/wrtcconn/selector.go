@@ -0,0 +1,385 @@
+package wrtcconn
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	probeTypeHello = "hello" // Advertises the services a peer offers
+	probeTypePing  = "ping"  // Requests a pong with the same nonce
+	probeTypePong  = "pong"  // Answers a ping
+
+	probeLength = 64 * 1024 // Maximum length of probe messages
+
+	selectionHysteresis = 1.1 // Factor by which the currently selected peer may be slower than the closest peer before switching
+)
+
+var (
+	ErrNoPeerForService = errors.New("no reachable peer offers the service") // None of the probed peers offering the service has answered a ping
+)
+
+type probe struct {
+	Type     string   `json:"type"`
+	Nonce    uint64   `json:"nonce"`
+	Services []string `json:"services"`
+}
+
+type probedPeer struct {
+	peer *Peer
+
+	writeLock sync.Mutex
+
+	services map[string]struct{}
+	pending  map[uint64]time.Time
+	rtt      time.Duration // Smoothed round-trip time; 0 if the peer hasn't answered or has missed its last ping
+}
+
+func (p *probedPeer) write(msg probe) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	_, err = p.peer.Conn.Write(b)
+
+	return err
+}
+
+// SelectorConfig configures the selector
+type SelectorConfig struct {
+	Services []string                                               // Tags of the services this peer offers to others (i.e. api or db-replica)
+	Interval time.Duration                                          // Duration between round-trip time measurements and re-evaluations (default is 10 seconds)
+	Timeout  time.Duration                                          // Time to wait for a pong before treating a peer as unreachable (default is 5 seconds)
+	OnSelect func(service string, peerID string, rtt time.Duration) // Handler to be called when a different peer has been selected for a service (empty peer ID if no peer is reachable)
+}
+
+// Selector measures the round-trip time to peers connected on the probe channel (see services.ProbePrimary) and selects the closest peer offering a service; it also answers the pings of the other peers and advertises the services of this peer to them
+type Selector struct {
+	config *SelectorConfig
+	ctx    context.Context
+
+	cancel context.CancelFunc
+
+	peersLock sync.Mutex
+	peers     map[string]*probedPeer
+	nonce     uint64
+	selected  map[string]string
+}
+
+// NewSelector creates the selector
+func NewSelector(
+	config *SelectorConfig,
+	ctx context.Context,
+) *Selector {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &SelectorConfig{}
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Second * 10
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second * 5
+	}
+
+	return &Selector{
+		config: config,
+		ctx:    ictx,
+
+		cancel: cancel,
+
+		peers:    map[string]*probedPeer{},
+		selected: map[string]string{},
+	}
+}
+
+// Open starts measuring the round-trip time to peers periodically
+func (s *Selector) Open() error {
+	log.Trace().Msg("Opening selector")
+
+	go func() {
+		t := time.NewTicker(s.config.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+				s.measure()
+				s.evaluate()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops measuring and disconnects from all probed peers
+func (s *Selector) Close() error {
+	log.Trace().Msg("Closing selector")
+
+	s.cancel()
+
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+
+	for _, p := range s.peers {
+		_ = p.peer.Conn.Close()
+	}
+
+	return nil
+}
+
+// Add starts probing a peer which is connected on the probe channel; the selector takes ownership of the connection
+func (s *Selector) Add(peer *Peer) {
+	p := &probedPeer{
+		peer: peer,
+
+		services: map[string]struct{}{},
+		pending:  map[uint64]time.Time{},
+	}
+
+	s.peersLock.Lock()
+	if old, ok := s.peers[peer.PeerID]; ok {
+		_ = old.peer.Conn.Close()
+	}
+	s.peers[peer.PeerID] = p
+	s.peersLock.Unlock()
+
+	go func() {
+		defer func() {
+			log.Debug().Str("peerID", peer.PeerID).Msg("Stopped probing peer")
+
+			s.peersLock.Lock()
+			if current, ok := s.peers[peer.PeerID]; ok && current == p {
+				delete(s.peers, peer.PeerID)
+			}
+			s.peersLock.Unlock()
+
+			s.evaluate()
+		}()
+
+		if err := p.write(probe{Type: probeTypeHello, Services: s.config.Services}); err != nil {
+			log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not write to peer, stopping")
+
+			return
+		}
+
+		s.ping(p)
+
+		buf := make([]byte, probeLength)
+		for {
+			n, err := peer.Conn.Read(buf)
+			if err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+				return
+			}
+
+			var msg probe
+			if err := json.Unmarshal(buf[:n], &msg); err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal probe, continuing")
+
+				continue
+			}
+
+			switch msg.Type {
+			case probeTypeHello:
+				s.peersLock.Lock()
+				p.services = map[string]struct{}{}
+				for _, service := range msg.Services {
+					p.services[service] = struct{}{}
+				}
+				s.peersLock.Unlock()
+
+				log.Debug().Str("peerID", peer.PeerID).Strs("services", msg.Services).Msg("Received services of peer")
+
+				s.evaluate()
+			case probeTypePing:
+				if err := p.write(probe{Type: probeTypePong, Nonce: msg.Nonce}); err != nil {
+					log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not write to peer, stopping")
+
+					return
+				}
+			case probeTypePong:
+				s.peersLock.Lock()
+				reachable := p.rtt > 0
+				sent, ok := p.pending[msg.Nonce]
+				if ok {
+					delete(p.pending, msg.Nonce)
+
+					rtt := time.Since(sent)
+					if p.rtt == 0 {
+						p.rtt = rtt
+					} else {
+						// Smooth the round-trip time so that jitter doesn't cause the selection to flap
+						p.rtt = (7*p.rtt + rtt) / 8
+					}
+				}
+				rtt := p.rtt
+				s.peersLock.Unlock()
+
+				if ok {
+					log.Trace().Str("peerID", peer.PeerID).Dur("rtt", rtt).Msg("Received pong from peer")
+
+					// Select peers as soon as they are reachable instead of waiting for the next re-evaluation
+					if !reachable {
+						s.evaluate()
+					}
+				}
+			}
+		}
+	}()
+}
+
+// ping sends a ping to a peer; pings which haven't been answered within the timeout mark the peer as unreachable
+func (s *Selector) ping(p *probedPeer) {
+	s.peersLock.Lock()
+	now := time.Now()
+	for nonce, sent := range p.pending {
+		if now.Sub(sent) > s.config.Timeout {
+			delete(p.pending, nonce)
+
+			p.rtt = 0
+		}
+	}
+
+	s.nonce++
+	nonce := s.nonce
+	p.pending[nonce] = now
+	s.peersLock.Unlock()
+
+	if err := p.write(probe{Type: probeTypePing, Nonce: nonce}); err != nil {
+		log.Debug().Err(err).Str("peerID", p.peer.PeerID).Msg("Could not write to peer, continuing")
+	}
+}
+
+func (s *Selector) measure() {
+	s.peersLock.Lock()
+	peers := []*probedPeer{}
+	for _, p := range s.peers {
+		peers = append(peers, p)
+	}
+	s.peersLock.Unlock()
+
+	for _, p := range peers {
+		s.ping(p)
+	}
+}
+
+// evaluate re-selects the closest peer of all known services and calls the handler for the ones which have changed
+func (s *Selector) evaluate() {
+	type selection struct {
+		service string
+		peerID  string
+		rtt     time.Duration
+	}
+
+	changed := []selection{}
+
+	s.peersLock.Lock()
+	services := map[string]struct{}{}
+	for service := range s.selected {
+		services[service] = struct{}{}
+	}
+	for _, p := range s.peers {
+		for service := range p.services {
+			services[service] = struct{}{}
+		}
+	}
+
+	for service := range services {
+		peerID, rtt, _ := s.closest(service)
+		if s.selected[service] != peerID {
+			if peerID == "" {
+				delete(s.selected, service)
+			} else {
+				s.selected[service] = peerID
+			}
+
+			changed = append(changed, selection{service, peerID, rtt})
+		}
+	}
+	s.peersLock.Unlock()
+
+	for _, c := range changed {
+		log.Debug().Str("service", c.service).Str("peerID", c.peerID).Dur("rtt", c.rtt).Msg("Selected peer for service")
+
+		if s.config.OnSelect != nil {
+			s.config.OnSelect(c.service, c.peerID, c.rtt)
+		}
+	}
+}
+
+// closest returns the reachable peer with the lowest round-trip time which offers a service; the lock must be held
+func (s *Selector) closest(service string) (string, time.Duration, bool) {
+	peerIDs := []string{}
+	for peerID, p := range s.peers {
+		if _, ok := p.services[service]; ok && p.rtt > 0 {
+			peerIDs = append(peerIDs, peerID)
+		}
+	}
+
+	if len(peerIDs) == 0 {
+		return "", 0, false
+	}
+
+	sort.Slice(peerIDs, func(i, j int) bool {
+		if s.peers[peerIDs[i]].rtt != s.peers[peerIDs[j]].rtt {
+			return s.peers[peerIDs[i]].rtt < s.peers[peerIDs[j]].rtt
+		}
+
+		return peerIDs[i] < peerIDs[j]
+	})
+
+	// Keep the current selection if it is almost as close as the closest peer, so that peers aren't switched needlessly
+	closest := s.peers[peerIDs[0]]
+	if current, ok := s.peers[s.selected[service]]; ok && current.rtt > 0 {
+		if _, ok := current.services[service]; ok && float64(current.rtt) <= float64(closest.rtt)*selectionHysteresis {
+			return s.selected[service], current.rtt, true
+		}
+	}
+
+	return peerIDs[0], closest.rtt, true
+}
+
+// Select returns the ID and round-trip time of the closest reachable peer offering a service
+func (s *Selector) Select(service string) (string, time.Duration, error) {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+
+	peerID, rtt, ok := s.closest(service)
+	if !ok {
+		return "", 0, ErrNoPeerForService
+	}
+
+	return peerID, rtt, nil
+}
+
+// RTTs returns the smoothed round-trip times of all reachable peers offering a service
+func (s *Selector) RTTs(service string) map[string]time.Duration {
+	s.peersLock.Lock()
+	defer s.peersLock.Unlock()
+
+	rtts := map[string]time.Duration{}
+	for peerID, p := range s.peers {
+		if _, ok := p.services[service]; ok && p.rtt > 0 {
+			rtts[peerID] = p.rtt
+		}
+	}
+
+	return rtts
+}
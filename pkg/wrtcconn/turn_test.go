@@ -0,0 +1,210 @@
+package wrtcconn
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// getRewrittenHostPort returns the address the ICE agent dials for a rewritten TURN server, which it formats without brackets
+func getRewrittenHostPort(t *testing.T, raw string) string {
+	t.Helper()
+
+	u, err := url.Parse(strings.Replace(raw, ":", "://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("%v:%v", u.Hostname(), u.Port())
+}
+
+func TestTURNDialerRewrite(t *testing.T) {
+	tests := []struct {
+		name            string
+		family          string
+		url             string
+		wantRewritten   string // Rewritten URL; empty if the URL is kept as-is
+		wantPlaceholder bool
+		wantAddr        string // Address of the registered TURN server
+	}{
+		{"udp turn over ipv4", "", "turn:127.0.0.1:3478", "", false, ""},
+		{"tcp turn over ipv4", "", "turn:127.0.0.1:3478?transport=tcp", "turn:127.0.0.1:3478?transport=tcp", false, "127.0.0.1:3478"},
+		{"turns with hostname", "", "turns:turn.example.com:5349", "turns:turn.example.com:5349?transport=tcp", false, "turn.example.com:5349"},
+		{"udp turn with ipv6 literal", "", "turn:[::1]:3478", "", true, "[::1]:3478"},
+		{"tcp turn with ipv6 literal", "", "turn:[::1]:3478?transport=tcp", "", true, "[::1]:3478"},
+		{"udp turn with hostname in ipv6", IPFamilyIPv6, "turn:turn.example.com:3478", "", true, "turn.example.com:3478"},
+		{"udp turn with hostname in ipv4", IPFamilyIPv4, "turn:turn.example.com:3478", "", false, ""},
+		{"stun", "", "stun:stun.example.com:3478", "", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTURNDialer(tt.family, time.Second, 0)
+
+			servers := d.rewrite([]webrtc.ICEServer{{URLs: []string{tt.url}}})
+			if len(servers) != 1 || len(servers[0].URLs) != 1 {
+				t.Fatalf("got %v, want one server with one URL", servers)
+			}
+
+			got := servers[0].URLs[0]
+			if tt.wantAddr == "" {
+				if got != tt.url {
+					t.Fatalf("got %v, want %v", got, tt.url)
+				}
+
+				if len(d.servers) != 0 {
+					t.Fatalf("registered %v, want no TURN servers", d.servers)
+				}
+
+				return
+			}
+
+			if tt.wantPlaceholder {
+				if !strings.HasSuffix(got, "?transport=tcp") {
+					t.Fatalf("got %v, want TCP transport", got)
+				}
+
+				host, _, err := net.SplitHostPort(getRewrittenHostPort(t, got))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if ip, err := netip.ParseAddr(host); err != nil || !placeholderNetwork.Contains(ip) {
+					t.Fatalf("got host %v, want placeholder in %v", host, placeholderNetwork)
+				}
+			} else if got != tt.wantRewritten {
+				t.Fatalf("got %v, want %v", got, tt.wantRewritten)
+			}
+
+			server, ok := d.servers[getRewrittenHostPort(t, got)]
+			if !ok {
+				t.Fatalf("TURN server for %v is not registered", got)
+			}
+
+			if server.addr != tt.wantAddr {
+				t.Fatalf("registered %v, want %v", server.addr, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestTURNDialerPlaceholders(t *testing.T) {
+	const servers = 300 // More servers than there are addresses in a /24
+
+	d := newTURNDialer("", time.Second, 0)
+
+	iceServers := []webrtc.ICEServer{}
+	for i := 0; i < servers; i++ {
+		iceServers = append(iceServers, webrtc.ICEServer{URLs: []string{fmt.Sprintf("turn:[2001:db8::%x]:3478", i+1)}})
+	}
+
+	placeholders := map[string]string{}
+	for i, server := range d.rewrite(iceServers) {
+		placeholder := getRewrittenHostPort(t, server.URLs[0])
+		if other, ok := placeholders[placeholder]; ok {
+			t.Fatalf("TURN servers %v and %v share placeholder %v", other, iceServers[i].URLs[0], placeholder)
+		}
+
+		placeholders[placeholder] = iceServers[i].URLs[0]
+	}
+
+	if len(d.servers) != servers {
+		t.Fatalf("registered %v TURN servers, want %v", len(d.servers), servers)
+	}
+
+	// Fetching ICE servers again must keep the placeholders, as the ICE agent may still be connected to them
+	for i, server := range d.rewrite(iceServers) {
+		if placeholder := getRewrittenHostPort(t, server.URLs[0]); placeholders[placeholder] != iceServers[i].URLs[0] {
+			t.Fatalf("got placeholder %v for %v, want the one of %v", placeholder, iceServers[i].URLs[0], placeholders[placeholder])
+		}
+	}
+
+	if len(d.servers) != servers {
+		t.Fatalf("registered %v TURN servers after rewriting again, want %v", len(d.servers), servers)
+	}
+}
+
+func TestTURNDialerPlaceholdersExhausted(t *testing.T) {
+	d := newTURNDialer("", time.Second, 0)
+	d.nextPlaceholder = netip.MustParseAddr("198.19.255.255") // Last address of the placeholder network
+
+	servers := d.rewrite([]webrtc.ICEServer{{URLs: []string{"turn:[2001:db8::1]:3478", "turn:[2001:db8::2]:3478"}}})
+	if got := len(servers[0].URLs); got != 1 {
+		t.Fatalf("got %v URLs, want 1", got)
+	}
+
+	if _, ok := d.placeholders["[2001:db8::2]:3478"]; ok {
+		t.Fatal("got placeholder outside of the placeholder network")
+	}
+}
+
+func TestTURNDialerDial(t *testing.T) {
+	tests := []struct {
+		name    string
+		family  string
+		laddr   string
+		url     string
+		wantErr bool
+	}{
+		{"ipv6 literal", "", "[::1]:0", "turn:[::1]:%v?transport=tcp", false},
+		{"ipv6 literal in ipv6", IPFamilyIPv6, "[::1]:0", "turn:[::1]:%v?transport=tcp", false},
+		{"ipv6 literal in ipv4", IPFamilyIPv4, "[::1]:0", "turn:[::1]:%v?transport=tcp", true},
+		{"ipv4 literal", "", "127.0.0.1:0", "turn:127.0.0.1:%v?transport=tcp", false},
+		{"ipv4 literal in ipv6", IPFamilyIPv6, "127.0.0.1:0", "turn:127.0.0.1:%v?transport=tcp", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", tt.laddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+
+					_ = conn.Close()
+				}
+			}()
+
+			d := newTURNDialer(tt.family, time.Second, 0)
+
+			servers := d.rewrite([]webrtc.ICEServer{{URLs: []string{fmt.Sprintf(tt.url, listener.Addr().(*net.TCPAddr).Port)}}})
+
+			conn, err := d.Dial("tcp4", getRewrittenHostPort(t, servers[0].URLs[0]))
+			if tt.wantErr {
+				if err == nil {
+					_ = conn.Close()
+
+					t.Fatal("connected, want error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if got, want := conn.RemoteAddr().String(), listener.Addr().String(); got != want {
+				t.Fatalf("connected to %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := newTURNDialer("", time.Second, 0).Dial("tcp4", "198.18.0.1:3478"); err != ErrInvalidTURNServerAddr {
+		t.Fatalf("got %v, want %v", err, ErrInvalidTURNServerAddr)
+	}
+}
@@ -0,0 +1,204 @@
+package wrtcconn_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcenc"
+	"github.com/pojntfx/weron/pkg/wrtctest"
+)
+
+const (
+	versionsChannel = "primary"
+	versionsTimeout = time.Second * 10
+)
+
+// TestMixedSignalingVersions connects adapters which use the JSON and the binary signaling protocol in the same community
+func TestMixedSignalingVersions(t *testing.T) {
+	tests := []struct {
+		name   string
+		binary []bool
+	}{
+		{"json and json", []bool{false, false}},
+		{"json and binary", []bool{false, true}},
+		{"binary and json", []bool{true, false}},
+		{"binary and binary", []bool{true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), versionsTimeout)
+			defer cancel()
+
+			signaler := wrtctest.NewSignaler(nil, ctx)
+			if err := signaler.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer signaler.Close()
+
+			peers := []chan *wrtcconn.Peer{}
+			for _, binary := range tt.binary {
+				adapter := signaler.NewAdapter("versions", []string{versionsChannel}, &wrtcconn.AdapterConfig{
+					BinarySignaling: binary,
+				}, ctx)
+				defer adapter.Close()
+
+				ids, err := adapter.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				select {
+				case <-ids:
+				case <-ctx.Done():
+					t.Fatal("timed out waiting for adapter to join")
+				}
+
+				peers = append(peers, adapter.Accept())
+			}
+
+			conns := []*wrtcconn.Peer{}
+			for _, c := range peers {
+				select {
+				case peer := <-c:
+					conns = append(conns, peer)
+				case <-ctx.Done():
+					t.Fatal("timed out waiting for adapters to connect")
+				}
+			}
+
+			if _, err := conns[0].Conn.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, 5)
+			if _, err := conns[1].Conn.Read(buf); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(buf); got != "hello" {
+				t.Fatalf("got %v, want hello", got)
+			}
+		})
+	}
+}
+
+// TestSignalingVersionOfRecipient joins a raw client next to an adapter which uses the binary signaling protocol; the client must receive the adapter's messages in the version it has requested
+func TestSignalingVersionOfRecipient(t *testing.T) {
+	tests := []struct {
+		name            string
+		subprotocols    []string // Versions the client requests from the signaler
+		versions        []string // Versions the client advertises in its introduction
+		wantMessageType int
+		wantBinaryOffer bool
+	}{
+		{"json client", nil, nil, websocket.TextMessage, false},
+		{"binary client", websocketapi.Versions, websocketapi.Versions, websocket.BinaryMessage, true},
+		{"binary client without advertisement", websocketapi.Versions, nil, websocket.BinaryMessage, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), versionsTimeout)
+			defer cancel()
+
+			signaler := wrtctest.NewSignaler(nil, ctx)
+			if err := signaler.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer signaler.Close()
+
+			dialer := *websocket.DefaultDialer
+			dialer.Subprotocols = tt.subprotocols
+
+			conn, _, err := dialer.DialContext(ctx, signaler.URL("versions"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			cipher := wrtcenc.DefaultCipher()
+			read := func(wantType string) []byte {
+				t.Helper()
+
+				for {
+					if err := conn.SetReadDeadline(time.Now().Add(versionsTimeout)); err != nil {
+						t.Fatal(err)
+					}
+
+					messageType, p, err := conn.ReadMessage()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if messageType != tt.wantMessageType {
+						t.Fatalf("got message type %v, want %v", messageType, tt.wantMessageType)
+					}
+
+					plaintext, err := cipher.Decrypt(p, []byte(wrtctest.Key))
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					var message websocketapi.Message
+					if err := websocketapi.Unmarshal(plaintext, &message); err != nil {
+						t.Fatal(err)
+					}
+
+					if message.Type == wantType {
+						return plaintext
+					}
+				}
+			}
+
+			adapter := signaler.NewAdapter("versions", []string{versionsChannel}, &wrtcconn.AdapterConfig{
+				BinarySignaling: true,
+			}, ctx)
+			defer adapter.Close()
+
+			ids, err := adapter.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-ids:
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for adapter to join")
+			}
+
+			// Introductions are received by every peer in the community, so they must always be encoded as JSON
+			if introduction := read(websocketapi.TypeIntroduction); websocketapi.IsBinary(introduction) {
+				t.Fatal("got binary introduction, want JSON")
+			}
+
+			version := websocketapi.VersionJSON
+			if len(tt.versions) > 0 {
+				version = websocketapi.VersionBinary
+			}
+
+			introduction, err := websocketapi.Marshal(version, websocketapi.NewIntroduction(uuid.NewString(), uuid.NewString(), "", "", nil, tt.versions))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			introduction, err = cipher.Encrypt(introduction, []byte(wrtctest.Key))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := conn.WriteMessage(tt.wantMessageType, introduction); err != nil {
+				t.Fatal(err)
+			}
+
+			if offer := read(websocketapi.TypeOffer); websocketapi.IsBinary(offer) != tt.wantBinaryOffer {
+				t.Fatalf("got binary offer %v, want %v", websocketapi.IsBinary(offer), tt.wantBinaryOffer)
+			}
+		})
+	}
+}
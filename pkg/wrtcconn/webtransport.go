@@ -0,0 +1,29 @@
+package wrtcconn
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/pojntfx/weron/internal/webtransport"
+)
+
+// dialWebSocket connects to the signaler over WebSockets
+func dialWebSocket(ctx context.Context, dialer *websocket.Dialer, target string, header http.Header) (signalingConn, *http.Response, error) {
+	conn, res, err := dialer.DialContext(ctx, target, header)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return conn, res, nil
+}
+
+// dialWebTransport connects to the signaler over WebTransport in an IP family, which uses QUIC and thus doesn't suffer from head-of-line blocking on lossy networks and needs fewer round trips to connect
+func dialWebTransport(ctx context.Context, target string, header http.Header, versions []string, family string) (signalingConn, *http.Response, error) {
+	conn, res, err := webtransport.Dial(ctx, target, header, versions, getNetwork("udp", family), happyEyeballsDelay)
+	if err != nil {
+		return nil, res, err
+	}
+
+	return conn, res, nil
+}
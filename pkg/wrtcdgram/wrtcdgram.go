@@ -0,0 +1,372 @@
+package wrtcdgram
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MaxDatagramSize          = 64 * 1024 // Maximum size of a datagram which can be written to a peer without end-to-end encryption; larger writes fail
+	UnfragmentedDatagramSize = 1200      // Maximum size of a datagram which fits into a single packet without end-to-end encryption; larger datagrams are lost if any of their fragments are lost
+
+	network = "weron"
+)
+
+var (
+	ErrPeerNotConnected = errors.New("peer is not connected")         // The datagram can't be written because no channel to the peer is open
+	ErrDatagramTooLarge = errors.New("datagram is too large")         // The datagram is larger than the maximum datagram size
+	ErrInvalidAddrType  = errors.New("address is not a peer address") // The address has not been returned by this package
+)
+
+// Addr is the address of a peer
+type Addr struct {
+	PeerID string // ID of the peer
+}
+
+// Network returns the name of the network
+func (a *Addr) Network() string {
+	return network
+}
+
+// String returns the ID of the peer
+func (a *Addr) String() string {
+	return a.PeerID
+}
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	ReadQueueLength    int          // Amount of received datagrams to queue before dropping new ones (default is 128)
+}
+
+type datagram struct {
+	peerID  string
+	payload []byte
+}
+
+// Adapter sends unordered datagrams without retransmissions to peers, similar to UDP; it implements net.PacketConn with peer IDs as addresses
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids chan string
+
+	idLock sync.Mutex
+	id     string
+
+	peersLock sync.Mutex
+	peers     map[string]*wrtcconn.Peer
+
+	datagrams chan datagram
+
+	// The read deadline is replaced together with the changed channel, which is closed to wake up pending reads
+	deadlineLock    sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{}
+}
+
+var _ net.PacketConn = (*Adapter)(nil)
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.AdapterConfig == nil {
+		config.AdapterConfig = &wrtcconn.AdapterConfig{
+			Timeout: time.Second * 10,
+		}
+	}
+
+	if config.ReadQueueLength <= 0 {
+		config.ReadQueueLength = 128
+	}
+
+	config.UnreliableChannels = append(config.UnreliableChannels, services.DatagramPrimary)
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		peers: map[string]*wrtcconn.Peer{},
+
+		datagrams: make(chan datagram, config.ReadQueueLength),
+
+		deadlineChanged: make(chan struct{}),
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.DatagramPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	if a.adapter == nil {
+		return nil
+	}
+
+	return a.adapter.Close()
+}
+
+// Wait starts receiving datagrams
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			a.idLock.Lock()
+			a.id = id
+			a.idLock.Unlock()
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			a.peersLock.Lock()
+			a.peers[peer.PeerID] = peer
+			a.peersLock.Unlock()
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					a.peersLock.Lock()
+					if current, ok := a.peers[peer.PeerID]; ok && current == peer {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				buf := make([]byte, MaxDatagramSize)
+				for {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
+						log.Debug().Err(err).Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+						return
+					}
+
+					select {
+					case a.datagrams <- datagram{peer.PeerID, append([]byte{}, buf[:n]...)}:
+					default:
+						log.Trace().Str("peerID", peer.PeerID).Int("len", n).Msg("Could not queue datagram because the queue is full, dropping")
+					}
+				}
+			}()
+		}
+	}
+}
+
+// ReadFrom reads a datagram and returns the address of the peer which has sent it; datagrams which are larger than the buffer are truncated
+func (a *Adapter) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		a.deadlineLock.Lock()
+		deadline := a.readDeadline
+		changed := a.deadlineChanged
+		a.deadlineLock.Unlock()
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		n, addr, ok, err := a.read(p, timeout, changed)
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ok {
+			return n, addr, err
+		}
+	}
+}
+
+// read waits for a datagram; it returns false if the deadline has been changed while waiting
+func (a *Adapter) read(p []byte, timeout <-chan time.Time, changed chan struct{}) (int, net.Addr, bool, error) {
+	select {
+	case <-a.ctx.Done():
+		return 0, nil, true, net.ErrClosed
+	case <-timeout:
+		return 0, nil, true, os.ErrDeadlineExceeded
+	case <-changed:
+		return 0, nil, false, nil
+	case d := <-a.datagrams:
+		return copy(p, d.payload), &Addr{d.peerID}, true, nil
+	}
+}
+
+// WriteTo writes a datagram to the peer with the address; it may be lost or arrive out of order
+func (a *Adapter) WriteTo(p []byte, addr net.Addr) (int, error) {
+	peerAddr, ok := addr.(*Addr)
+	if !ok {
+		return 0, ErrInvalidAddrType
+	}
+
+	return a.WriteToPeer(p, peerAddr.PeerID)
+}
+
+// WriteToPeer writes a datagram to the peer with the ID; it may be lost or arrive out of order
+func (a *Adapter) WriteToPeer(p []byte, peerID string) (int, error) {
+	a.peersLock.Lock()
+	peer, ok := a.peers[peerID]
+	a.peersLock.Unlock()
+
+	if !ok {
+		return 0, ErrPeerNotConnected
+	}
+
+	if len(p) > a.MaxDatagramSize() {
+		return 0, ErrDatagramTooLarge
+	}
+
+	return peer.Conn.Write(p)
+}
+
+// Peers returns the IDs of the peers to which datagrams can be written
+func (a *Adapter) Peers() []string {
+	a.peersLock.Lock()
+	defer a.peersLock.Unlock()
+
+	peerIDs := []string{}
+	for peerID := range a.peers {
+		peerIDs = append(peerIDs, peerID)
+	}
+
+	return peerIDs
+}
+
+// MaxDatagramSize returns the maximum size of a datagram which can be written to peers
+func (a *Adapter) MaxDatagramSize() int {
+	if a.config.Secure {
+		return MaxDatagramSize - wrtcconn.SecureOverhead
+	}
+
+	return MaxDatagramSize
+}
+
+// UnfragmentedDatagramSize returns the maximum size of a datagram which fits into a single packet; datagrams which are smaller than this are lost independently of each other
+func (a *Adapter) UnfragmentedDatagramSize() int {
+	if a.config.Secure {
+		return UnfragmentedDatagramSize - wrtcconn.SecureOverhead
+	}
+
+	return UnfragmentedDatagramSize
+}
+
+// LocalAddr returns the address of this peer
+func (a *Adapter) LocalAddr() net.Addr {
+	a.idLock.Lock()
+	defer a.idLock.Unlock()
+
+	return &Addr{a.id}
+}
+
+// SetDeadline sets the read deadline; writes don't block, so there is no write deadline
+func (a *Adapter) SetDeadline(t time.Time) error {
+	return a.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the time after which pending and future reads fail (a zero value disables the deadline)
+func (a *Adapter) SetReadDeadline(t time.Time) error {
+	a.deadlineLock.Lock()
+	defer a.deadlineLock.Unlock()
+
+	a.readDeadline = t
+
+	close(a.deadlineChanged)
+	a.deadlineChanged = make(chan struct{})
+
+	return nil
+}
+
+// SetWriteDeadline is a no-op, as writes don't block
+func (a *Adapter) SetWriteDeadline(t time.Time) error {
+	return nil
+}
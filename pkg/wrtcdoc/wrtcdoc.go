@@ -0,0 +1,470 @@
+package wrtcdoc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrTimeout            = errors.New("timed out")                      // The server did not respond in time
+	ErrUnsupportedAddress = errors.New("unsupported ICE server address") // The ICE server address has an unsupported scheme
+)
+
+// NATType is the behaviour of the NAT in front of this host
+type NATType string
+
+const (
+	NATTypeUnknown             NATType = "unknown"              // Could not determine the NAT type (i.e. less than two STUN servers are reachable)
+	NATTypeNone                NATType = "none"                 // The host has a public IP address
+	NATTypeEndpointIndependent NATType = "endpoint-independent" // The NAT re-uses mappings for all destinations; direct connections are likely to work
+	NATTypeSymmetric           NATType = "symmetric"            // The NAT creates a new mapping for each destination; a TURN server is likely required
+)
+
+// DoctorConfig configures the doctor
+type DoctorConfig struct {
+	Timeout  time.Duration // Time to wait for each probe
+	IPFamily string        // IP family to probe the ICE servers with (ipv4 or ipv6) (empty probes them with both)
+	Header   http.Header   // Additional HTTP headers to send to the signaler (i.e. Authorization for an authenticating reverse proxy)
+}
+
+// SignalerResult is the result of probing the signaler
+type SignalerResult struct {
+	Address   string        // Address of the signaler
+	Reachable bool          // Whether the signaler answered HTTP requests
+	Upgraded  bool          // Whether the signaler accepted the WebSocket upgrade
+	Latency   time.Duration // Time it took to upgrade the connection
+	Err       error         // Error which occurred while probing
+}
+
+// STUNResult is the result of probing a STUN server
+type STUNResult struct {
+	Server     string        // URL of the STUN server
+	MappedAddr net.Addr      // Public address as seen by the STUN server
+	Latency    time.Duration // Round-trip time of the binding request
+	Err        error         // Error which occurred while probing
+}
+
+// TURNResult is the result of probing a TURN server
+type TURNResult struct {
+	Server      string        // URL of the TURN server
+	RelayedAddr net.Addr      // Address allocated on the TURN server
+	Latency     time.Duration // Time it took to allocate the relayed address
+	Err         error         // Error which occurred while probing
+}
+
+// Report are the results of all probes
+type Report struct {
+	Signaler SignalerResult // Result of probing the signaler
+	STUN     []STUNResult   // Results of probing the STUN servers
+	TURN     []TURNResult   // Results of probing the TURN servers
+	NATType  NATType        // Detected NAT type
+	Advice   []string       // Actionable advice based on the results
+}
+
+// Doctor diagnoses connectivity issues
+type Doctor struct {
+	signaler string
+	ice      []string
+	config   *DoctorConfig
+	ctx      context.Context
+}
+
+// NewDoctor creates the doctor
+func NewDoctor(
+	signaler string,
+	ice []string,
+	config *DoctorConfig,
+	ctx context.Context,
+) *Doctor {
+	if config == nil {
+		config = &DoctorConfig{}
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second * 10
+	}
+
+	return &Doctor{
+		signaler: signaler,
+		ice:      ice,
+		config:   config,
+		ctx:      ctx,
+	}
+}
+
+// Diagnose probes the signaler and all ICE servers
+func (d *Doctor) Diagnose() (*Report, error) {
+	iceServers, _, err := wrtcconn.ParseICEServers(d.ice)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Signaler: d.probeSignaler(),
+		STUN:     []STUNResult{},
+		TURN:     []TURNResult{},
+		NATType:  NATTypeUnknown,
+		Advice:   []string{},
+	}
+
+	// Use the same socket for all STUN servers so that the mappings can be compared
+	conn, err := net.ListenPacket(d.network("udp"), ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		Conn: conn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if err := client.Listen(); err != nil {
+		return nil, err
+	}
+
+	for _, server := range iceServers {
+		for _, u := range server.URLs {
+			if server.CredentialType == webrtc.ICECredentialTypePassword && strings.TrimSpace(server.Username) != "" {
+				credential, _ := server.Credential.(string)
+
+				report.TURN = append(report.TURN, d.probeTURN(u, server.Username, credential))
+
+				continue
+			}
+
+			report.STUN = append(report.STUN, d.probeSTUN(client, u))
+		}
+	}
+
+	report.NATType = classifyNAT(report.STUN)
+	report.Advice = advise(report)
+
+	return report, nil
+}
+
+func (d *Doctor) probeSignaler() SignalerResult {
+	res := SignalerResult{
+		Address: d.signaler,
+	}
+
+	u, err := url.Parse(d.signaler)
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+
+	// Check HTTP reachability first, which makes it possible to distinguish DNS/firewall issues from upgrade issues
+	hu := *u
+	switch hu.Scheme {
+	case "wss":
+		hu.Scheme = "https"
+	case "ws":
+		hu.Scheme = "http"
+	}
+	hu.RawQuery = ""
+
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hu.String(), http.NoBody)
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+
+	for key, values := range d.config.Header {
+		req.Header[key] = values
+	}
+
+	hres, err := http.DefaultClient.Do(req)
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+	_ = hres.Body.Close()
+
+	res.Reachable = true
+
+	log.Debug().Str("address", hu.String()).Int("status", hres.StatusCode).Msg("Signaler is reachable")
+
+	start := time.Now()
+
+	conn, wres, err := wrtcconn.NewWebSocketDialer(d.config.IPFamily).DialContext(ctx, u.String(), d.config.Header)
+	if err != nil {
+		if wres != nil {
+			res.Err = errors.New(wres.Status)
+		} else {
+			res.Err = err
+		}
+
+		return res
+	}
+	_ = conn.Close()
+
+	res.Upgraded = true
+	res.Latency = time.Since(start)
+
+	return res
+}
+
+func (d *Doctor) probeSTUN(client *turn.Client, u string) STUNResult {
+	res := STUNResult{
+		Server: u,
+	}
+
+	addr, err := getHostPort(u, "stun:")
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+
+	raddr, err := net.ResolveUDPAddr(d.network("udp"), addr)
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+
+	start := time.Now()
+
+	res.MappedAddr, res.Err = d.withTimeout(func() (net.Addr, error) {
+		return client.SendBindingRequestTo(raddr)
+	})
+	res.Latency = time.Since(start)
+
+	log.Debug().Str("server", u).Err(res.Err).Msg("Probed STUN server")
+
+	return res
+}
+
+func (d *Doctor) probeTURN(u string, username string, credential string) TURNResult {
+	res := TURNResult{
+		Server: u,
+	}
+
+	addr, err := getHostPort(u, "turn:")
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+
+	serverAddr := addr
+
+	var conn net.PacketConn
+	if strings.Contains(u, "transport=tcp") {
+		c, err := net.DialTimeout(d.network("tcp"), addr, d.config.Timeout)
+		if err != nil {
+			res.Err = err
+
+			return res
+		}
+
+		// The TURN client only resolves IPv4 addresses, but doesn't use the address for TCP connections, so use a placeholder from TEST-NET-1 (RFC 5737) for IPv6
+		if raddr, ok := c.RemoteAddr().(*net.TCPAddr); ok && raddr.IP.To4() == nil {
+			serverAddr = net.JoinHostPort("192.0.2.1", strconv.Itoa(raddr.Port))
+		}
+
+		conn = turn.NewSTUNConn(c)
+	} else {
+		conn, err = net.ListenPacket(d.network("udp"), ":0")
+		if err != nil {
+			res.Err = err
+
+			return res
+		}
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: serverAddr,
+		TURNServerAddr: serverAddr,
+		Username:       username,
+		Password:       credential,
+		Conn:           conn,
+	})
+	if err != nil {
+		res.Err = err
+
+		return res
+	}
+	defer client.Close()
+
+	if err := client.Listen(); err != nil {
+		res.Err = err
+
+		return res
+	}
+
+	start := time.Now()
+
+	res.RelayedAddr, res.Err = d.withTimeout(func() (net.Addr, error) {
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return nil, err
+		}
+		defer relayConn.Close()
+
+		return relayConn.LocalAddr(), nil
+	})
+	res.Latency = time.Since(start)
+
+	log.Debug().Str("server", u).Err(res.Err).Msg("Probed TURN server")
+
+	return res
+}
+
+// network returns the network (i.e. udp4 or udp6) to use for the configured IP family
+func (d *Doctor) network(base string) string {
+	switch d.config.IPFamily {
+	case wrtcconn.IPFamilyIPv4:
+		return base + "4"
+	case wrtcconn.IPFamilyIPv6:
+		return base + "6"
+	default:
+		return base
+	}
+}
+
+func (d *Doctor) withTimeout(probe func() (net.Addr, error)) (net.Addr, error) {
+	type result struct {
+		addr net.Addr
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		addr, err := probe()
+
+		results <- result{addr, err}
+	}()
+
+	select {
+	case <-d.ctx.Done():
+		return nil, d.ctx.Err()
+	case <-time.After(d.config.Timeout):
+		return nil, ErrTimeout
+	case res := <-results:
+		return res.addr, res.err
+	}
+}
+
+func getHostPort(u string, prefix string) (string, error) {
+	if !strings.HasPrefix(u, prefix) {
+		return "", ErrUnsupportedAddress
+	}
+
+	addr := strings.SplitN(strings.TrimPrefix(u, prefix), "?", 2)[0]
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// Use the default port for STUN and TURN; IPv6 literals may be in brackets even without a port
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "3478")
+	}
+
+	return addr, nil
+}
+
+func classifyNAT(results []STUNResult) NATType {
+	mapped := []*net.UDPAddr{}
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+
+		addr, ok := res.MappedAddr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		mapped = append(mapped, addr)
+	}
+
+	if len(mapped) <= 0 {
+		return NATTypeUnknown
+	}
+
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ip, ok := addr.(*net.IPNet); ok && ip.IP.Equal(mapped[0].IP) {
+				return NATTypeNone
+			}
+		}
+	}
+
+	if len(mapped) < 2 {
+		return NATTypeUnknown
+	}
+
+	for _, addr := range mapped[1:] {
+		if !addr.IP.Equal(mapped[0].IP) || addr.Port != mapped[0].Port {
+			return NATTypeSymmetric
+		}
+	}
+
+	return NATTypeEndpointIndependent
+}
+
+func advise(report *Report) []string {
+	advice := []string{}
+
+	if !report.Signaler.Reachable {
+		advice = append(advice, "The signaler is not reachable; check the remote address, your DNS resolution and whether a firewall or proxy blocks the connection")
+	} else if !report.Signaler.Upgraded {
+		advice = append(advice, "The signaler is reachable, but rejected the WebSocket upgrade; check the community and password, and make sure that reverse proxies forward the Upgrade and Connection headers")
+	}
+
+	reachableSTUN := 0
+	for _, res := range report.STUN {
+		if res.Err == nil {
+			reachableSTUN++
+		}
+	}
+
+	reachableTURN := 0
+	for _, res := range report.TURN {
+		if res.Err == nil {
+			reachableTURN++
+		}
+	}
+
+	if len(report.STUN) > 0 && reachableSTUN == 0 {
+		advice = append(advice, "None of the STUN servers answered; outgoing UDP traffic is probably blocked, so you will need a TURN server using TCP or TLS")
+	}
+
+	if len(report.TURN) > 0 && reachableTURN < len(report.TURN) {
+		advice = append(advice, "Some TURN servers could not allocate a relay; check their credentials and whether their ports are reachable")
+	}
+
+	switch report.NATType {
+	case NATTypeSymmetric:
+		if reachableTURN == 0 {
+			advice = append(advice, "You are behind a symmetric NAT, so direct connections to peers behind another NAT will likely fail; configure a TURN server with --ice")
+		} else {
+			advice = append(advice, "You are behind a symmetric NAT; connections to peers behind another NAT will likely be relayed through your TURN server")
+		}
+	case NATTypeUnknown:
+		if reachableSTUN < 2 {
+			advice = append(advice, "Could not determine the NAT type; configure at least two STUN servers with --ice to detect it")
+		}
+	}
+
+	return advice
+}
@@ -0,0 +1,194 @@
+package wrtcdocker
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func htons(i uint16) uint16 {
+	return (i<<8)&0xff00 | i>>8
+}
+
+// createBridge creates a bridge and sets it up; it succeeds if the bridge already exists
+func createBridge(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if err := netlink.LinkAdd(&netlink.Bridge{
+			LinkAttrs: netlink.LinkAttrs{
+				Name: name,
+			},
+		}); err != nil {
+			return err
+		}
+
+		link, err = netlink.LinkByName(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return netlink.LinkSetUp(link)
+}
+
+// deleteLink removes an interface; it succeeds if the interface has already been removed
+func deleteLink(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	return netlink.LinkDel(link)
+}
+
+// attachToBridge adds an interface to a bridge and sets it up
+func attachToBridge(name string, bridge string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+
+	master, err := netlink.LinkByName(bridge)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetMaster(link, master); err != nil {
+		return err
+	}
+
+	return netlink.LinkSetUp(link)
+}
+
+// createVeth creates a veth pair with the MTU of a bridge and attaches its host side to the bridge
+func createVeth(hostName string, containerName string, bridge string) error {
+	master, err := netlink.LinkByName(bridge)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkAdd(&netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: hostName,
+			MTU:  master.Attrs().MTU,
+		},
+		PeerName: containerName,
+	}); err != nil {
+		return err
+	}
+
+	if err := attachToBridge(hostName, bridge); err != nil {
+		_ = deleteLink(hostName)
+
+		return err
+	}
+
+	return nil
+}
+
+// probeAddress sends an ARP probe (RFC 5227) for an address on a bridge and reports whether another node has claimed it before the timeout
+func probeAddress(bridge string, ip net.IP, timeout time.Duration) (bool, error) {
+	link, err := netlink.LinkByName(bridge)
+	if err != nil {
+		return false, err
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return false, err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ARP),
+		Ifindex:  link.Attrs().Index,
+	}); err != nil {
+		return false, err
+	}
+
+	hwaddr := link.Attrs().HardwareAddr
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(
+		buf,
+		gopacket.SerializeOptions{FixLengths: true},
+		&layers.Ethernet{
+			SrcMAC:       hwaddr,
+			DstMAC:       broadcast,
+			EthernetType: layers.EthernetTypeARP,
+		},
+		&layers.ARP{
+			AddrType:          layers.LinkTypeEthernet,
+			Protocol:          layers.EthernetTypeIPv4,
+			HwAddressSize:     6,
+			ProtAddressSize:   4,
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   hwaddr,
+			SourceProtAddress: net.IPv4zero.To4(),
+			DstHwAddress:      make(net.HardwareAddr, 6),
+			DstProtAddress:    ip.To4(),
+		},
+	); err != nil {
+		return false, err
+	}
+
+	addr := &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ARP),
+		Ifindex:  link.Attrs().Index,
+		Halen:    6,
+	}
+	copy(addr.Addr[:], broadcast)
+
+	if err := unix.Sendto(fd, buf.Bytes(), 0, addr); err != nil {
+		return false, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	frame := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return false, err
+		}
+
+		n, _, err := unix.Recvfrom(fd, frame, 0)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+
+			return false, err
+		}
+
+		packet := gopacket.NewPacket(frame[:n], layers.LayerTypeEthernet, gopacket.Default)
+		arpLayer := packet.Layer(layers.LayerTypeARP)
+		if arpLayer == nil {
+			continue
+		}
+
+		arp, ok := arpLayer.(*layers.ARP)
+		if !ok || net.HardwareAddr(arp.SourceHwAddress).String() == hwaddr.String() {
+			continue
+		}
+
+		// A node which uses the address answers the probe or announces it; a node which probes for the same address at the same time would assign it too
+		if net.IP(arp.SourceProtAddress).Equal(ip) ||
+			(arp.Operation == layers.ARPRequest && net.IP(arp.SourceProtAddress).Equal(net.IPv4zero) && net.IP(arp.DstProtAddress).Equal(ip)) {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package wrtcdocker
+
+import (
+	"net"
+	"time"
+)
+
+func createBridge(name string) error {
+	return ErrUnsupported
+}
+
+func deleteLink(name string) error {
+	return ErrUnsupported
+}
+
+func attachToBridge(name string, bridge string) error {
+	return ErrUnsupported
+}
+
+func createVeth(hostName string, containerName string, bridge string) error {
+	return ErrUnsupported
+}
+
+func probeAddress(bridge string, ip net.IP, timeout time.Duration) (bool, error) {
+	return false, ErrUnsupported
+}
@@ -0,0 +1,801 @@
+package wrtcdocker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtceth"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+const (
+	contentType = "application/vnd.docker.plugins.v1.2+json"
+
+	genericOptions = "com.docker.network.generic" // Key of the options passed with `docker network create -o`
+
+	optionRaddr     = "raddr"     // Option for the remote address of the signaler
+	optionCommunity = "community" // Option for the ID of the community to join
+	optionPassword  = "password"  // Option for the password of the community
+	optionKey       = "key"       // Option for the encryption key of the community
+
+	requestAddressType = "RequestAddressType"         // Option which is set if IPAM is asked for the address of the gateway
+	gatewayAddressType = "com.docker.network.gateway" // Value of the option if IPAM is asked for the address of the gateway
+
+	localAddressSpace  = "weron-local"  // Address space for local networks
+	globalAddressSpace = "weron-global" // Address space for global networks
+
+	bridgePrefix        = "wrb" // Prefix of the names of the bridges of networks
+	tapPrefix           = "wrt" // Prefix of the names of the TAP devices of networks
+	hostInterfacePrefix = "wrv" // Prefix of the names of the host sides of the veth pairs of endpoints
+	containerPrefix     = "wrc" // Prefix of the names of the container sides of the veth pairs of endpoints before they are moved into the container
+
+	stateFile = "networks.json" // Name of the file in the data directory in which the networks are persisted
+)
+
+var (
+	ErrMissingCommunity = errors.New("missing community option")                             // The network has been created without the community option
+	ErrMissingPassword  = errors.New("missing password option")                              // The network has been created without the password option
+	ErrMissingKey       = errors.New("missing key option")                                   // The network has been created without the key option
+	ErrMissingSubnet    = errors.New("missing subnet, specify one with --subnet")            // No subnet has been requested for the pool
+	ErrIPv6Unsupported  = errors.New("IPv6 pools are not supported")                         // An IPv6 pool has been requested
+	ErrPoolExhausted    = errors.New("no free addresses left in pool")                       // All addresses in the pool are in use
+	ErrAddressInUse     = errors.New("address is already in use")                            // The requested address is in use locally or by another node in the community
+	ErrAddressNotInPool = errors.New("address is not in pool")                               // The requested address is outside of the pool
+	ErrNetworkNotFound  = errors.New("network not found")                                    // The network of a request doesn't exist
+	ErrEndpointNotFound = errors.New("endpoint not found")                                   // The endpoint of a request doesn't exist
+	ErrUnsupported      = errors.New("the Docker network driver is only supported on Linux") // The driver can only attach containers on Linux
+)
+
+// DriverConfig configures the driver
+type DriverConfig struct {
+	*wrtcconn.AdapterConfig
+	Socket             string        // Path of the UNIX socket to listen on (default is /run/docker/plugins/weron.sock)
+	DataDir            string        // Directory to persist the networks in, so that they are restored after a restart (default is /var/lib/weron/docker)
+	Signaler           string        // Remote address of the signaler to use for networks which don't set the raddr option
+	ICE                []string      // STUN and TURN servers to use
+	ProbeTimeout       time.Duration // Time to wait for other nodes to claim an address before it is assigned to a container (default is 1s)
+	OnSignalerConnect  func(string)  // Handler to be called when a network has connected to the signaler
+	OnPeerConnect      func(string)  // Handler to be called when a network has connected to a peer
+	OnPeerDisconnected func(string)  // Handler to be called when a network has disconnected from a peer
+}
+
+// networkConfig is the persisted configuration of a network
+type networkConfig struct {
+	Signaler  string `json:"signaler"`
+	Community string `json:"community"`
+	Password  string `json:"password"`
+	Key       string `json:"key"`
+	Subnet    string `json:"subnet"`
+}
+
+type network struct {
+	config  *networkConfig
+	subnet  *net.IPNet
+	bridge  string
+	adapter *wrtceth.Adapter
+}
+
+type pool struct {
+	subnet    *net.IPNet
+	gateway   net.IP
+	addresses map[string]struct{}
+}
+
+// Driver is a Docker network and IPAM driver which attaches containers to communities; every Docker network is a layer 2 overlay network (see wrtceth) which is bridged to the containers in it, and addresses are only assigned to containers after no other node in the community has claimed them
+type Driver struct {
+	config *DriverConfig
+	ctx    context.Context
+
+	cancel   context.CancelFunc
+	listener net.Listener
+	server   *http.Server
+
+	networksLock sync.Mutex
+	networks     map[string]*network
+
+	poolsLock sync.Mutex
+	pools     map[string]*pool
+}
+
+// NewDriver creates the driver
+func NewDriver(
+	config *DriverConfig,
+	ctx context.Context,
+) *Driver {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &DriverConfig{}
+	}
+
+	if config.AdapterConfig == nil {
+		config.AdapterConfig = &wrtcconn.AdapterConfig{
+			Timeout: time.Second * 10,
+		}
+	}
+
+	if strings.TrimSpace(config.Socket) == "" {
+		config.Socket = "/run/docker/plugins/weron.sock"
+	}
+
+	if strings.TrimSpace(config.DataDir) == "" {
+		config.DataDir = "/var/lib/weron/docker"
+	}
+
+	if config.ProbeTimeout <= 0 {
+		config.ProbeTimeout = time.Second
+	}
+
+	return &Driver{
+		config: config,
+		ctx:    ictx,
+
+		cancel: cancel,
+
+		networks: map[string]*network{},
+		pools:    map[string]*pool{},
+	}
+}
+
+// Open restores the persisted networks and starts listening on the socket
+func (d *Driver) Open() error {
+	log.Trace().Msg("Opening driver")
+
+	if err := os.MkdirAll(d.config.DataDir, 0700); err != nil {
+		return err
+	}
+
+	configs, err := d.loadState()
+	if err != nil {
+		return err
+	}
+
+	for id, config := range configs {
+		if err := d.openNetwork(id, config); err != nil {
+			log.Debug().Err(err).Str("network", id).Msg("Could not restore network, continuing")
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.config.Socket), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(d.config.Socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	d.listener, err = net.Listen("unix", d.config.Socket)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/Plugin.Activate", handle(func(req *struct{}) (interface{}, error) {
+		return map[string][]string{"Implements": {"NetworkDriver", "IpamDriver"}}, nil
+	}))
+
+	mux.HandleFunc("/NetworkDriver.GetCapabilities", handle(func(req *struct{}) (interface{}, error) {
+		return map[string]string{"Scope": "local", "ConnectivityScope": "global"}, nil
+	}))
+	mux.HandleFunc("/NetworkDriver.CreateNetwork", handle(d.createNetwork))
+	mux.HandleFunc("/NetworkDriver.DeleteNetwork", handle(d.deleteNetwork))
+	mux.HandleFunc("/NetworkDriver.CreateEndpoint", handle(d.createEndpoint))
+	mux.HandleFunc("/NetworkDriver.EndpointOperInfo", handle(func(req *struct{}) (interface{}, error) {
+		return map[string]interface{}{"Value": map[string]interface{}{}}, nil
+	}))
+	mux.HandleFunc("/NetworkDriver.DeleteEndpoint", handle(d.deleteEndpoint))
+	mux.HandleFunc("/NetworkDriver.Join", handle(d.join))
+	mux.HandleFunc("/NetworkDriver.Leave", handle(d.leave))
+	for _, endpoint := range []string{
+		"/NetworkDriver.DiscoverNew",
+		"/NetworkDriver.DiscoverDelete",
+		"/NetworkDriver.ProgramExternalConnectivity",
+		"/NetworkDriver.RevokeExternalConnectivity",
+	} {
+		mux.HandleFunc(endpoint, handle(func(req *struct{}) (interface{}, error) {
+			return struct{}{}, nil
+		}))
+	}
+
+	mux.HandleFunc("/IpamDriver.GetCapabilities", handle(func(req *struct{}) (interface{}, error) {
+		return map[string]bool{"RequiresMACAddress": false}, nil
+	}))
+	mux.HandleFunc("/IpamDriver.GetDefaultAddressSpaces", handle(func(req *struct{}) (interface{}, error) {
+		return map[string]string{"LocalDefaultAddressSpace": localAddressSpace, "GlobalDefaultAddressSpace": globalAddressSpace}, nil
+	}))
+	mux.HandleFunc("/IpamDriver.RequestPool", handle(d.requestPool))
+	mux.HandleFunc("/IpamDriver.ReleasePool", handle(d.releasePool))
+	mux.HandleFunc("/IpamDriver.RequestAddress", handle(d.requestAddress))
+	mux.HandleFunc("/IpamDriver.ReleaseAddress", handle(d.releaseAddress))
+
+	d.server = &http.Server{Handler: mux}
+
+	return nil
+}
+
+// Close stops listening on the socket and disconnects the networks from their communities; bridges and endpoints are kept so that containers stay attached to them until the driver is started again
+func (d *Driver) Close() error {
+	log.Trace().Msg("Closing driver")
+
+	d.cancel()
+
+	d.networksLock.Lock()
+	for id, n := range d.networks {
+		if err := n.adapter.Close(); err != nil {
+			log.Debug().Err(err).Str("network", id).Msg("Could not close network, continuing")
+		}
+	}
+	d.networksLock.Unlock()
+
+	if d.server == nil {
+		return nil
+	}
+
+	return d.server.Close()
+}
+
+// Wait starts serving requests from Docker
+func (d *Driver) Wait() error {
+	if err := d.server.Serve(d.listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// handle decodes the request body, calls the handler and encodes its response or error in the format of the plugin API
+func handle[T any](handler func(req *T) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+
+		req := new(T)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+			w.WriteHeader(http.StatusBadRequest)
+
+			_ = json.NewEncoder(w).Encode(map[string]string{"Err": err.Error()})
+
+			return
+		}
+
+		res, err := handler(req)
+		if err != nil {
+			log.Debug().Err(err).Str("path", r.URL.Path).Msg("Could not handle request, continuing")
+
+			w.WriteHeader(http.StatusInternalServerError)
+
+			_ = json.NewEncoder(w).Encode(map[string]string{"Err": err.Error()})
+
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Debug().Err(err).Str("path", r.URL.Path).Msg("Could not write response, continuing")
+		}
+	}
+}
+
+type ipamData struct {
+	AddressSpace string
+	Pool         string
+	Gateway      string
+}
+
+type createNetworkRequest struct {
+	NetworkID string
+	Options   map[string]interface{}
+	IPv4Data  []ipamData
+}
+
+// createNetwork joins the community of a network and creates its bridge
+func (d *Driver) createNetwork(req *createNetworkRequest) (interface{}, error) {
+	options := map[string]string{}
+	if generic, ok := req.Options[genericOptions].(map[string]interface{}); ok {
+		for key, value := range generic {
+			if v, ok := value.(string); ok {
+				options[key] = v
+			}
+		}
+	}
+
+	config := &networkConfig{
+		Signaler:  options[optionRaddr],
+		Community: options[optionCommunity],
+		Password:  options[optionPassword],
+		Key:       options[optionKey],
+	}
+
+	if strings.TrimSpace(config.Signaler) == "" {
+		config.Signaler = d.config.Signaler
+	}
+
+	if strings.TrimSpace(config.Community) == "" {
+		return nil, ErrMissingCommunity
+	}
+
+	if strings.TrimSpace(config.Password) == "" {
+		return nil, ErrMissingPassword
+	}
+
+	if strings.TrimSpace(config.Key) == "" {
+		return nil, ErrMissingKey
+	}
+
+	if len(req.IPv4Data) > 0 {
+		config.Subnet = req.IPv4Data[0].Pool
+	}
+
+	if err := d.openNetwork(req.NetworkID, config); err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, d.saveState()
+}
+
+type networkRequest struct {
+	NetworkID string
+}
+
+// deleteNetwork leaves the community of a network and removes its bridge
+func (d *Driver) deleteNetwork(req *networkRequest) (interface{}, error) {
+	d.networksLock.Lock()
+	n, ok := d.networks[req.NetworkID]
+	delete(d.networks, req.NetworkID)
+	d.networksLock.Unlock()
+
+	if !ok {
+		return struct{}{}, nil
+	}
+
+	if err := n.adapter.Close(); err != nil {
+		log.Debug().Err(err).Str("network", req.NetworkID).Msg("Could not close network, continuing")
+	}
+
+	if err := deleteLink(n.bridge); err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, d.saveState()
+}
+
+// openNetwork creates the bridge of a network and attaches the TAP device of an ethernet adapter for the community to it
+func (d *Driver) openNetwork(id string, config *networkConfig) error {
+	n := &network{
+		config: config,
+		bridge: getInterfaceName(bridgePrefix, id),
+	}
+
+	if strings.TrimSpace(config.Subnet) != "" {
+		var err error
+		_, n.subnet, err = net.ParseCIDR(config.Subnet)
+		if err != nil {
+			return err
+		}
+	}
+
+	u, err := url.Parse(config.Signaler)
+	if err != nil {
+		return err
+	}
+
+	q := u.Query()
+	q.Set("community", config.Community)
+	q.Set("password", config.Password)
+	u.RawQuery = q.Encode()
+
+	if err := createBridge(n.bridge); err != nil {
+		return err
+	}
+
+	// The ID is set by the ethernet adapter, so every network needs its own copy of the configuration
+	adapterConfig := *d.config.AdapterConfig
+	adapterConfig.ID = ""
+
+	tap := getInterfaceName(tapPrefix, id)
+	n.adapter = wrtceth.NewAdapter(
+		u.String(),
+		config.Key,
+		d.config.ICE,
+		&wrtceth.AdapterConfig{
+			AdapterConfig:      &adapterConfig,
+			Device:             tap,
+			OnSignalerConnect:  d.config.OnSignalerConnect,
+			OnPeerConnect:      d.config.OnPeerConnect,
+			OnPeerDisconnected: d.config.OnPeerDisconnected,
+		},
+		d.ctx,
+	)
+
+	if err := n.adapter.Open(); err != nil {
+		_ = deleteLink(n.bridge)
+
+		return err
+	}
+
+	if err := attachToBridge(tap, n.bridge); err != nil {
+		_ = n.adapter.Close()
+		_ = deleteLink(n.bridge)
+
+		return err
+	}
+
+	go func() {
+		if err := n.adapter.Wait(); err != nil {
+			log.Debug().Err(err).Str("network", id).Msg("Could not forward frames of network, stopping")
+		}
+	}()
+
+	d.networksLock.Lock()
+	d.networks[id] = n
+	d.networksLock.Unlock()
+
+	log.Debug().Str("network", id).Str("community", config.Community).Str("bridge", n.bridge).Msg("Opened network")
+
+	return nil
+}
+
+type endpointRequest struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// createEndpoint checks that the network of an endpoint exists; the interface of the endpoint is only created once a container joins it
+func (d *Driver) createEndpoint(req *endpointRequest) (interface{}, error) {
+	if _, err := d.getNetwork(req.NetworkID); err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, nil
+}
+
+// deleteEndpoint removes the veth pair of an endpoint if it still exists
+func (d *Driver) deleteEndpoint(req *endpointRequest) (interface{}, error) {
+	return struct{}{}, deleteLink(getInterfaceName(hostInterfacePrefix, req.EndpointID))
+}
+
+type interfaceName struct {
+	SrcName   string
+	DstPrefix string
+}
+
+type joinResponse struct {
+	InterfaceName interfaceName
+}
+
+// join creates a veth pair for an endpoint and attaches its host side to the bridge of the network; Docker moves the container side into the container and assigns the address from IPAM to it
+func (d *Driver) join(req *endpointRequest) (interface{}, error) {
+	n, err := d.getNetwork(req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	containerName := getInterfaceName(containerPrefix, req.EndpointID)
+	if err := createVeth(getInterfaceName(hostInterfacePrefix, req.EndpointID), containerName, n.bridge); err != nil {
+		return nil, err
+	}
+
+	return &joinResponse{
+		InterfaceName: interfaceName{
+			SrcName:   containerName,
+			DstPrefix: "eth",
+		},
+	}, nil
+}
+
+// leave removes the veth pair of an endpoint
+func (d *Driver) leave(req *endpointRequest) (interface{}, error) {
+	return struct{}{}, deleteLink(getInterfaceName(hostInterfacePrefix, req.EndpointID))
+}
+
+func (d *Driver) getNetwork(id string) (*network, error) {
+	d.networksLock.Lock()
+	defer d.networksLock.Unlock()
+
+	n, ok := d.networks[id]
+	if !ok {
+		return nil, ErrNetworkNotFound
+	}
+
+	return n, nil
+}
+
+type requestPoolRequest struct {
+	AddressSpace string
+	Pool         string
+	V6           bool
+}
+
+type requestPoolResponse struct {
+	PoolID string
+	Pool   string
+	Data   map[string]string
+}
+
+// requestPool registers the subnet of a network; the pool ID is the subnet, so that pools survive restarts of the driver
+func (d *Driver) requestPool(req *requestPoolRequest) (interface{}, error) {
+	if req.V6 {
+		return nil, ErrIPv6Unsupported
+	}
+
+	if strings.TrimSpace(req.Pool) == "" {
+		return nil, ErrMissingSubnet
+	}
+
+	p, err := d.getPool(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+
+	return &requestPoolResponse{
+		PoolID: p.subnet.String(),
+		Pool:   p.subnet.String(),
+		Data:   map[string]string{},
+	}, nil
+}
+
+type releasePoolRequest struct {
+	PoolID string
+}
+
+func (d *Driver) releasePool(req *releasePoolRequest) (interface{}, error) {
+	d.poolsLock.Lock()
+	delete(d.pools, req.PoolID)
+	d.poolsLock.Unlock()
+
+	return struct{}{}, nil
+}
+
+type requestAddressRequest struct {
+	PoolID  string
+	Address string
+	Options map[string]string
+}
+
+type requestAddressResponse struct {
+	Address string
+	Data    map[string]string
+}
+
+// requestAddress assigns an address from a pool; addresses for containers are probed with ARP on the bridge of the network first, so that an address which is already in use by a container on another node in the community is never assigned
+func (d *Driver) requestAddress(req *requestAddressRequest) (interface{}, error) {
+	p, err := d.getPool(req.PoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, _ := p.subnet.Mask.Size()
+	first, last := getHostRange(p.subnet)
+
+	if req.Options[requestAddressType] == gatewayAddressType {
+		gateway := uint32ToIP(first)
+		if strings.TrimSpace(req.Address) != "" {
+			gateway = net.ParseIP(req.Address).To4()
+			if gateway == nil || !p.subnet.Contains(gateway) {
+				return nil, ErrAddressNotInPool
+			}
+		}
+
+		d.poolsLock.Lock()
+		p.gateway = gateway
+		p.addresses[gateway.String()] = struct{}{}
+		d.poolsLock.Unlock()
+
+		return &requestAddressResponse{
+			Address: (&net.IPNet{IP: gateway, Mask: net.CIDRMask(ones, 32)}).String(),
+			Data:    map[string]string{},
+		}, nil
+	}
+
+	bridge := ""
+	d.networksLock.Lock()
+	for _, n := range d.networks {
+		if n.subnet != nil && n.subnet.String() == p.subnet.String() {
+			bridge = n.bridge
+
+			break
+		}
+	}
+	d.networksLock.Unlock()
+
+	candidates := []uint32{}
+	if strings.TrimSpace(req.Address) != "" {
+		ip := net.ParseIP(req.Address).To4()
+		if ip == nil || !p.subnet.Contains(ip) {
+			return nil, ErrAddressNotInPool
+		}
+
+		candidates = append(candidates, ipToUint32(ip))
+	} else {
+		// Starting at a random address makes it unlikely that nodes which allocate at the same time probe the same addresses
+		size := last - first + 1
+		offset := uint32(time.Now().UnixNano()) % size
+		for i := uint32(0); i < size; i++ {
+			candidates = append(candidates, first+(offset+i)%size)
+		}
+	}
+
+	for _, candidate := range candidates {
+		ip := uint32ToIP(candidate)
+
+		d.poolsLock.Lock()
+		if _, ok := p.addresses[ip.String()]; ok {
+			d.poolsLock.Unlock()
+
+			continue
+		}
+		p.addresses[ip.String()] = struct{}{}
+		d.poolsLock.Unlock()
+
+		inUse := false
+		if bridge == "" {
+			log.Debug().Str("pool", req.PoolID).Msg("Could not find network for pool, skipping probe")
+		} else {
+			inUse, err = probeAddress(bridge, ip, d.config.ProbeTimeout)
+			if err != nil {
+				d.poolsLock.Lock()
+				delete(p.addresses, ip.String())
+				d.poolsLock.Unlock()
+
+				return nil, err
+			}
+		}
+
+		if inUse {
+			log.Debug().Str("pool", req.PoolID).Str("address", ip.String()).Msg("Address is already in use by another node, continuing")
+
+			d.poolsLock.Lock()
+			delete(p.addresses, ip.String())
+			d.poolsLock.Unlock()
+
+			continue
+		}
+
+		return &requestAddressResponse{
+			Address: (&net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 32)}).String(),
+			Data:    map[string]string{},
+		}, nil
+	}
+
+	if strings.TrimSpace(req.Address) != "" {
+		return nil, ErrAddressInUse
+	}
+
+	return nil, ErrPoolExhausted
+}
+
+type releaseAddressRequest struct {
+	PoolID  string
+	Address string
+}
+
+func (d *Driver) releaseAddress(req *releaseAddressRequest) (interface{}, error) {
+	d.poolsLock.Lock()
+	defer d.poolsLock.Unlock()
+
+	if p, ok := d.pools[req.PoolID]; ok {
+		delete(p.addresses, req.Address)
+	}
+
+	return struct{}{}, nil
+}
+
+// getPool returns the pool for a subnet, creating it if it doesn't exist yet
+func (d *Driver) getPool(subnet string) (*pool, error) {
+	_, s, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.IP.To4() == nil {
+		return nil, ErrIPv6Unsupported
+	}
+
+	d.poolsLock.Lock()
+	defer d.poolsLock.Unlock()
+
+	p, ok := d.pools[s.String()]
+	if !ok {
+		p = &pool{
+			subnet:    s,
+			addresses: map[string]struct{}{},
+		}
+
+		d.pools[s.String()] = p
+	}
+
+	return p, nil
+}
+
+func (d *Driver) loadState() (map[string]*networkConfig, error) {
+	configs := map[string]*networkConfig{}
+
+	content, err := os.ReadFile(filepath.Join(d.config.DataDir, stateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return configs, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &configs); err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+// saveState persists the configurations of the networks; the file is replaced atomically so that a crash can't corrupt it
+func (d *Driver) saveState() error {
+	configs := map[string]*networkConfig{}
+
+	d.networksLock.Lock()
+	for id, n := range d.networks {
+		configs[id] = n.config
+	}
+	d.networksLock.Unlock()
+
+	content, err := json.Marshal(configs)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(d.config.DataDir, stateFile)
+	if err := os.WriteFile(path+".tmp", content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// getInterfaceName returns the name of an interface for a network or endpoint ID, truncated to the maximum length of interface names
+func getInterfaceName(prefix string, id string) string {
+	name := prefix + id
+	if len(name) > 15 {
+		return name[:15]
+	}
+
+	return name
+}
+
+// getHostRange returns the first and last address in a subnet which can be assigned to hosts
+func getHostRange(subnet *net.IPNet) (uint32, uint32) {
+	ones, bits := subnet.Mask.Size()
+
+	first := ipToUint32(subnet.IP.To4())
+	last := first | ^uint32(0)>>ones
+
+	// Networks with less than two host bits have no network or broadcast address
+	if bits-ones < 2 {
+		return first, last
+	}
+
+	return first + 1, last - 1
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(i uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, i)
+
+	return ip
+}
@@ -0,0 +1,52 @@
+package wrtcenc
+
+import (
+	"sync"
+)
+
+// KeyDeriver derives keys from passwords with a secret which never leaves an external key management service, i.e. a MAC key in a cloud KMS or an HSM
+type KeyDeriver interface {
+	DeriveKey(password []byte) ([]byte, error) // DeriveKey must return the same 32-byte key for the same password on all peers
+}
+
+// NewKMSCipher returns a cipher (see CipherAESGCM etc.) whose keys are derived by an external key management service, so that only peers with access to it can decrypt payloads, even if the password leaks
+//
+// Derived keys are cached for each password, so that the key management service is only asked once per community
+// instead of for every payload.
+func NewKMSCipher(name string, deriver KeyDeriver) (Cipher, error) {
+	c, err := NewCipher(name)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &kmsKeys{
+		deriver: deriver,
+		keys:    map[string][]byte{},
+	}
+
+	return &aeadCipher{c.(*aeadCipher).newAEAD, k.deriveKey}, nil
+}
+
+type kmsKeys struct {
+	lock    sync.Mutex
+	deriver KeyDeriver
+	keys    map[string][]byte
+}
+
+func (k *kmsKeys) deriveKey(password []byte) ([]byte, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if key, ok := k.keys[string(password)]; ok {
+		return key, nil
+	}
+
+	key, err := k.deriver.DeriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	k.keys[string(password)] = key
+
+	return key, nil
+}
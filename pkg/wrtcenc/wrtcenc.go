@@ -0,0 +1,135 @@
+package wrtcenc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/sys/cpu"
+)
+
+const (
+	CipherAESGCM           = "aes-gcm"           // AES-256-GCM, which is hardware-accelerated on most x86-64 and ARM64 CPUs (default)
+	CipherChaCha20Poly1305 = "chacha20-poly1305" // ChaCha20-Poly1305, which is faster than AES-GCM on CPUs without AES instructions
+)
+
+var (
+	ErrInvalidCipher         = errors.New("invalid cipher, must be aes-gcm or chacha20-poly1305") // The specified cipher is unknown
+	ErrCiphertextTooShort    = errors.New("ciphertext too short")                                 // The ciphertext is shorter than the nonce
+	ErrInvalidDerivedKeySize = errors.New("invalid derived key size, must be 32 bytes")           // The key derivation has returned a key which can't be used with the cipher
+)
+
+// Cipher encrypts and decrypts payloads with a password, i.e. signaling messages with the community key; all peers which exchange payloads must use the same cipher
+type Cipher interface {
+	Encrypt(data, password []byte) ([]byte, error) // Encrypt seals the data and prepends the nonce
+	Decrypt(data, password []byte) ([]byte, error) // Decrypt opens data which has been sealed by Encrypt
+}
+
+// aeadCipher seals data with an AEAD and a random nonce, which is prepended to the ciphertext
+type aeadCipher struct {
+	newAEAD   func(key []byte) (cipher.AEAD, error)
+	deriveKey func(password []byte) ([]byte, error)
+}
+
+// NewCipher returns the cipher with the name (see CipherAESGCM etc.; empty uses AES-GCM)
+func NewCipher(name string) (Cipher, error) {
+	switch name {
+	case "", CipherAESGCM:
+		return DefaultCipher(), nil
+	case CipherChaCha20Poly1305:
+		return &aeadCipher{chacha20poly1305.New, deriveKey}, nil
+	default:
+		return nil, ErrInvalidCipher
+	}
+}
+
+// PreferredCipher returns the cipher which is fastest on this CPU; since all peers must use the same cipher, it should only be used to pick the cipher for a deployment of similar hosts
+func PreferredCipher() string {
+	if cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ || cpu.ARM64.HasAES && cpu.ARM64.HasPMULL || cpu.S390X.HasAES && cpu.S390X.HasGHASH {
+		return CipherAESGCM
+	}
+
+	return CipherChaCha20Poly1305
+}
+
+// DefaultCipher returns AES-GCM, which is used if no cipher has been configured
+func DefaultCipher() Cipher {
+	return &aeadCipher{newAESGCM, deriveAESKey}
+}
+
+// See https://bruinsslot.jp/post/golang-crypto/
+
+func (c *aeadCipher) Encrypt(data, password []byte) ([]byte, error) {
+	aead, err := c.getAEAD(password)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (c *aeadCipher) Decrypt(data, password []byte) ([]byte, error) {
+	aead, err := c.getAEAD(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, ErrCiphertextTooShort
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+func (c *aeadCipher) getAEAD(password []byte) (cipher.AEAD, error) {
+	key, err := c.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != 32 {
+		return nil, ErrInvalidDerivedKeySize
+	}
+
+	return c.newAEAD(key)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(blockCipher)
+}
+
+// deriveAESKey derives the key for AES-GCM; it is kept for compatibility with existing peers (see docs/signaling.md)
+func deriveAESKey(password []byte) ([]byte, error) {
+	buf := make([]byte, 32) // Will use AES-256
+
+	copy(buf, sha256.New224().Sum(password)) // Fill the rest of the hash with zeros (SHA-224 leads to a 28 byte long hash)
+
+	return buf, nil
+}
+
+// deriveKey derives the key for ciphers which don't need to be compatible with existing peers by hashing the password
+func deriveKey(password []byte) ([]byte, error) {
+	key := sha256.Sum256(password)
+
+	return key[:], nil
+}
@@ -0,0 +1,527 @@
+package wrtceth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"github.com/pojntfx/weron/pkg/wrtcaudit"
+)
+
+var (
+	ErrInvalidFilter           = errors.New("invalid filter rule, expected format allow expression or deny expression") // The specified filter rule can't be parsed
+	ErrInvalidFilterExpression = errors.New("invalid filter expression")                                                // The expression of a filter rule can't be parsed
+)
+
+const (
+	FilterActionAllow = "allow" // Forward frames which match the expression
+	FilterActionDeny  = "deny"  // Drop frames which match the expression
+
+	ipv4HeaderMinLength = 20
+	ipv6HeaderLength    = 40
+	arpIPv4Length       = 28
+)
+
+// Filter decides whether to forward a frame; direction is wrtcaudit.DirectionIn for frames received from peers and wrtcaudit.DirectionOut for frames sent to peers
+type Filter func(frame []byte, direction string) bool
+
+// frameInfo contains the fields of a frame which filter expressions can match on
+type frameInfo struct {
+	direction string
+
+	src       net.HardwareAddr
+	dst       net.HardwareAddr
+	etherType layers.EthernetType
+	vlan      int // -1 if the frame is untagged
+
+	srcIP    net.IP
+	dstIP    net.IP
+	protocol layers.IPProtocol
+	isIP     bool
+
+	srcPort  uint16
+	dstPort  uint16
+	hasPorts bool
+}
+
+type matcher func(f *frameInfo) bool
+
+type filterRule struct {
+	allow bool
+	match matcher
+}
+
+// ParseFilter parses filter rules into a filter; rules are evaluated in order and the first rule whose expression matches decides whether a frame is forwarded, frames which match no rule are forwarded.
+// A rule has the format allow expression or deny expression (i.e. deny udp and src port 67); an empty expression matches all frames.
+// Expressions combine primitives with and, or, not and parentheses; supported primitives are ip, ip6, arp, tcp, udp, icmp, icmp6, broadcast, multicast, inbound, outbound,
+// vlan [id], ether proto type, ether [src|dst|host] mac, [src|dst] host ip, [src|dst] net prefix and [src|dst] port port[-port].
+func ParseFilter(rules []string) (Filter, error) {
+	parsed := []filterRule{}
+	for _, rule := range rules {
+		tokens := tokenizeFilter(rule)
+		if len(tokens) <= 0 {
+			return nil, ErrInvalidFilter
+		}
+
+		r := filterRule{}
+		switch tokens[0] {
+		case FilterActionAllow:
+			r.allow = true
+		case FilterActionDeny:
+			r.allow = false
+		default:
+			return nil, ErrInvalidFilter
+		}
+
+		if len(tokens) == 1 {
+			r.match = func(f *frameInfo) bool { return true }
+		} else {
+			p := &filterParser{tokens: tokens[1:]}
+
+			match, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.pos < len(p.tokens) {
+				return nil, ErrInvalidFilterExpression
+			}
+
+			r.match = match
+		}
+
+		parsed = append(parsed, r)
+	}
+
+	return func(frame []byte, direction string) bool {
+		f, ok := decodeFrameInfo(frame, direction)
+		if !ok {
+			// Let frames which can't be decoded through; they will be dropped by the receiving TAP device
+			return true
+		}
+
+		for _, r := range parsed {
+			if r.match(f) {
+				return r.allow
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// Check whether all configured filters allow a frame
+func (a *Adapter) filterFrame(buf []byte, direction string) bool {
+	for _, filter := range a.config.Filters {
+		if !filter(buf, direction) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func tokenizeFilter(s string) []string {
+	s = strings.ReplaceAll(s, "(", " ( ")
+	s = strings.ReplaceAll(s, ")", " ) ")
+
+	return strings.Fields(strings.ToLower(s))
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", ErrInvalidFilterExpression
+	}
+
+	token := p.tokens[p.pos]
+	p.pos++
+
+	return token, nil
+}
+
+func (p *filterParser) parseOr() (matcher, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" {
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(f *frameInfo) bool { return l(f) || right(f) }
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (matcher, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" {
+		p.pos++
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(f *frameInfo) bool { return l(f) && right(f) }
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (matcher, error) {
+	if p.peek() == "not" {
+		p.pos++
+
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(f *frameInfo) bool { return !inner(f) }, nil
+	}
+
+	if p.peek() == "(" {
+		p.pos++
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if token, err := p.next(); err != nil || token != ")" {
+			return nil, ErrInvalidFilterExpression
+		}
+
+		return inner, nil
+	}
+
+	return p.parsePrimitive()
+}
+
+func (p *filterParser) parsePrimitive() (matcher, error) {
+	token, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case "ip":
+		return matchEtherType(layers.EthernetTypeIPv4), nil
+	case "ip6":
+		return matchEtherType(layers.EthernetTypeIPv6), nil
+	case "arp":
+		return matchEtherType(layers.EthernetTypeARP), nil
+	case "tcp":
+		return matchProtocol(layers.IPProtocolTCP), nil
+	case "udp":
+		return matchProtocol(layers.IPProtocolUDP), nil
+	case "icmp":
+		return matchProtocol(layers.IPProtocolICMPv4), nil
+	case "icmp6":
+		return matchProtocol(layers.IPProtocolICMPv6), nil
+	case "broadcast":
+		return func(f *frameInfo) bool { return f.dst.String() == broadcastMAC }, nil
+	case "multicast":
+		return func(f *frameInfo) bool { return f.dst[0]&0b01 == 1 }, nil
+	case "inbound":
+		return func(f *frameInfo) bool { return f.direction == wrtcaudit.DirectionIn }, nil
+	case "outbound":
+		return func(f *frameInfo) bool { return f.direction == wrtcaudit.DirectionOut }, nil
+	case "vlan":
+		raw := p.peek()
+		if raw == "" {
+			return func(f *frameInfo) bool { return f.vlan >= 0 }, nil
+		}
+
+		vlan, err := strconv.ParseUint(raw, 10, 12)
+		if err != nil {
+			// The VLAN ID is optional, so the next token belongs to the enclosing expression
+			return func(f *frameInfo) bool { return f.vlan >= 0 }, nil
+		}
+		p.pos++
+
+		return func(f *frameInfo) bool { return f.vlan == int(vlan) }, nil
+	case "ether":
+		return p.parseEther()
+	case "src", "dst":
+		kind, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		return p.parseAddress(token, kind)
+	case "host", "net", "port":
+		return p.parseAddress("", token)
+	}
+
+	return nil, ErrInvalidFilterExpression
+}
+
+func (p *filterParser) parseEther() (matcher, error) {
+	qualifier, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if qualifier == "proto" {
+		raw, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		etherType, err := strconv.ParseUint(raw, 0, 16)
+		if err != nil {
+			return nil, ErrInvalidFilterExpression
+		}
+
+		return matchEtherType(layers.EthernetType(etherType)), nil
+	}
+
+	raw := qualifier
+	if qualifier == "src" || qualifier == "dst" || qualifier == "host" {
+		if raw, err = p.next(); err != nil {
+			return nil, err
+		}
+	} else {
+		qualifier = "host"
+	}
+
+	mac, err := net.ParseMAC(raw)
+	if err != nil {
+		return nil, ErrInvalidFilterExpression
+	}
+
+	return func(f *frameInfo) bool {
+		switch qualifier {
+		case "src":
+			return bytes.Equal(f.src, mac)
+		case "dst":
+			return bytes.Equal(f.dst, mac)
+		default:
+			return bytes.Equal(f.src, mac) || bytes.Equal(f.dst, mac)
+		}
+	}, nil
+}
+
+func (p *filterParser) parseAddress(qualifier, kind string) (matcher, error) {
+	raw, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	var match func(srcOrDst bool, f *frameInfo) bool // srcOrDst is true for the source
+	switch kind {
+	case "host":
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			return nil, ErrInvalidFilterExpression
+		}
+
+		match = func(src bool, f *frameInfo) bool {
+			if src {
+				return f.srcIP != nil && f.srcIP.Equal(ip)
+			}
+
+			return f.dstIP != nil && f.dstIP.Equal(ip)
+		}
+	case "net":
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, ErrInvalidFilterExpression
+		}
+
+		match = func(src bool, f *frameInfo) bool {
+			if src {
+				return f.srcIP != nil && network.Contains(f.srcIP)
+			}
+
+			return f.dstIP != nil && network.Contains(f.dstIP)
+		}
+	case "port":
+		rawLow, rawHigh, ok := strings.Cut(raw, "-")
+		if !ok {
+			rawHigh = rawLow
+		}
+
+		low, err := strconv.ParseUint(rawLow, 10, 16)
+		if err != nil {
+			return nil, ErrInvalidFilterExpression
+		}
+
+		high, err := strconv.ParseUint(rawHigh, 10, 16)
+		if err != nil || high < low {
+			return nil, ErrInvalidFilterExpression
+		}
+
+		match = func(src bool, f *frameInfo) bool {
+			if !f.hasPorts {
+				return false
+			}
+
+			port := f.dstPort
+			if src {
+				port = f.srcPort
+			}
+
+			return uint64(port) >= low && uint64(port) <= high
+		}
+	default:
+		return nil, ErrInvalidFilterExpression
+	}
+
+	switch qualifier {
+	case "src":
+		return func(f *frameInfo) bool { return match(true, f) }, nil
+	case "dst":
+		return func(f *frameInfo) bool { return match(false, f) }, nil
+	default:
+		return func(f *frameInfo) bool { return match(true, f) || match(false, f) }, nil
+	}
+}
+
+func matchEtherType(etherType layers.EthernetType) matcher {
+	return func(f *frameInfo) bool { return f.etherType == etherType }
+}
+
+func matchProtocol(protocol layers.IPProtocol) matcher {
+	return func(f *frameInfo) bool { return f.isIP && f.protocol == protocol }
+}
+
+// Decode the headers of a frame which filter expressions can match on
+func decodeFrameInfo(buf []byte, direction string) (*frameInfo, bool) {
+	if len(buf) < ethernetHeaderLength {
+		return nil, false
+	}
+
+	f := &frameInfo{
+		direction: direction,
+
+		dst:       net.HardwareAddr(buf[0:6]),
+		src:       net.HardwareAddr(buf[6:12]),
+		etherType: layers.EthernetType(binary.BigEndian.Uint16(buf[12:14])),
+		vlan:      -1,
+	}
+
+	payload := buf[ethernetHeaderLength:]
+	if f.etherType == layers.EthernetTypeDot1Q {
+		if len(payload) < dot1QHeaderLength {
+			return nil, false
+		}
+
+		f.vlan = int(binary.BigEndian.Uint16(payload[0:2]) & vlanIDMask)
+		f.etherType = layers.EthernetType(binary.BigEndian.Uint16(payload[2:4]))
+		payload = payload[dot1QHeaderLength:]
+	}
+
+	var transport []byte
+	switch f.etherType {
+	case layers.EthernetTypeIPv4:
+		if len(payload) < ipv4HeaderMinLength {
+			return f, true
+		}
+
+		headerLength := int(payload[0]&0x0f) * 4
+		if headerLength < ipv4HeaderMinLength || len(payload) < headerLength {
+			return f, true
+		}
+
+		f.isIP = true
+		f.protocol = layers.IPProtocol(payload[9])
+		f.srcIP = net.IP(payload[12:16])
+		f.dstIP = net.IP(payload[16:20])
+
+		// Only the first fragment contains the transport header
+		if binary.BigEndian.Uint16(payload[6:8])&0x1fff == 0 {
+			transport = payload[headerLength:]
+		}
+	case layers.EthernetTypeIPv6:
+		if len(payload) < ipv6HeaderLength {
+			return f, true
+		}
+
+		f.isIP = true
+		f.srcIP = net.IP(payload[8:24])
+		f.dstIP = net.IP(payload[24:40])
+
+		next := layers.IPProtocol(payload[6])
+		rest := payload[ipv6HeaderLength:]
+		fragmented := false
+
+		// Skip extension headers to find the transport protocol
+	extensions:
+		for {
+			switch next {
+			case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+				if len(rest) < 2 || len(rest) < (int(rest[1])+1)*8 {
+					break extensions
+				}
+
+				next = layers.IPProtocol(rest[0])
+				rest = rest[(int(rest[1])+1)*8:]
+			case layers.IPProtocolIPv6Fragment:
+				if len(rest) < 8 {
+					break extensions
+				}
+
+				fragmented = binary.BigEndian.Uint16(rest[2:4])&0xfff8 != 0
+				next = layers.IPProtocol(rest[0])
+				rest = rest[8:]
+			default:
+				break extensions
+			}
+		}
+
+		f.protocol = next
+		if !fragmented {
+			transport = rest
+		}
+	case layers.EthernetTypeARP:
+		// Allow matching the addresses of IPv4 over Ethernet ARP packets with host and net
+		if len(payload) >= arpIPv4Length && payload[4] == 6 && payload[5] == 4 {
+			f.srcIP = net.IP(payload[14:18])
+			f.dstIP = net.IP(payload[24:28])
+		}
+
+		return f, true
+	default:
+		return f, true
+	}
+
+	if (f.protocol == layers.IPProtocolTCP || f.protocol == layers.IPProtocolUDP || f.protocol == layers.IPProtocolSCTP) && len(transport) >= 4 {
+		f.hasPorts = true
+		f.srcPort = binary.BigEndian.Uint16(transport[0:2])
+		f.dstPort = binary.BigEndian.Uint16(transport[2:4])
+	}
+
+	return f, true
+}
@@ -0,0 +1,298 @@
+package wrtceth
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/pojntfx/weron/pkg/wrtcaudit"
+)
+
+var (
+	testSrcMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	testDstMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+// serializeFrame builds an Ethernet frame with an optional 802.1Q tag (vlan < 0 for untagged frames) around the layers
+func serializeFrame(t *testing.T, dst net.HardwareAddr, etherType layers.EthernetType, vlan int, payload ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+
+	ethernet := &layers.Ethernet{
+		SrcMAC:       testSrcMAC,
+		DstMAC:       dst,
+		EthernetType: etherType,
+	}
+
+	all := []gopacket.SerializableLayer{ethernet}
+	if vlan >= 0 {
+		ethernet.EthernetType = layers.EthernetTypeDot1Q
+
+		all = append(all, &layers.Dot1Q{
+			VLANIdentifier: uint16(vlan),
+			Type:           etherType,
+		})
+	}
+	all = append(all, payload...)
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, all...); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func udp4Frame(t *testing.T, vlan int, src, dst string, srcPort, dstPort uint16) []byte {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+	if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+
+	return serializeFrame(t, testDstMAC, layers.EthernetTypeIPv4, vlan, ip, udp, gopacket.Payload("hello"))
+}
+
+func tcp6Frame(t *testing.T, src, dst string, srcPort, dstPort uint16) []byte {
+	ip := &layers.IPv6{
+		Version:    6,
+		HopLimit:   64,
+		NextHeader: layers.IPProtocolTCP,
+		SrcIP:      net.ParseIP(src),
+		DstIP:      net.ParseIP(dst),
+	}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), SYN: true, Window: 1024}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+
+	return serializeFrame(t, testDstMAC, layers.EthernetTypeIPv6, -1, ip, tcp)
+}
+
+func icmp4Frame(t *testing.T, src, dst string) []byte {
+	return serializeFrame(t, testDstMAC, layers.EthernetTypeIPv4, -1, &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolICMPv4,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0)})
+}
+
+func arpFrame(t *testing.T, src, dst string) []byte {
+	broadcast, err := net.ParseMAC(broadcastMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return serializeFrame(t, broadcast, layers.EthernetTypeARP, -1, &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   testSrcMAC,
+		SourceProtAddress: net.ParseIP(src).To4(),
+		DstHwAddress:      make([]byte, 6),
+		DstProtAddress:    net.ParseIP(dst).To4(),
+	})
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		wantErr error
+	}{
+		{"no rules", []string{}, nil},
+		{"action without expression", []string{"deny"}, nil},
+		{"all primitives", []string{
+			"allow ip", "allow ip6", "allow arp", "allow tcp", "allow udp", "allow icmp", "allow icmp6",
+			"allow broadcast", "allow multicast", "allow inbound", "allow outbound",
+			"allow vlan", "allow vlan 42",
+			"allow ether proto 0x0800", "allow ether proto 2054",
+			"allow ether 02:00:00:00:00:01", "allow ether src 02:00:00:00:00:01", "allow ether dst 02:00:00:00:00:01", "allow ether host 02:00:00:00:00:01",
+			"allow host 10.0.0.1", "allow src host fd00::1", "allow dst host 10.0.0.1",
+			"allow net 10.0.0.0/8", "allow src net fd00::/8", "allow dst net 10.0.0.0/8",
+			"allow port 53", "allow src port 1024-65535", "allow dst port 67-68",
+		}, nil},
+		{"operators and parentheses", []string{"deny not (udp or tcp) and not arp"}, nil},
+		{"uppercase", []string{"DENY UDP AND SRC PORT 67"}, nil},
+		{"parentheses without spaces", []string{"deny (udp)and(port 53)"}, nil},
+		{"empty rule", []string{""}, ErrInvalidFilter},
+		{"unknown action", []string{"drop udp"}, ErrInvalidFilter},
+		{"expression without action", []string{"udp"}, ErrInvalidFilter},
+		{"unknown primitive", []string{"deny sctp"}, ErrInvalidFilterExpression},
+		{"trailing token", []string{"deny udp tcp"}, ErrInvalidFilterExpression},
+		{"dangling and", []string{"deny udp and"}, ErrInvalidFilterExpression},
+		{"dangling not", []string{"deny not"}, ErrInvalidFilterExpression},
+		{"unclosed parenthesis", []string{"deny (udp or tcp"}, ErrInvalidFilterExpression},
+		{"unopened parenthesis", []string{"deny udp)"}, ErrInvalidFilterExpression},
+		{"empty parentheses", []string{"deny ()"}, ErrInvalidFilterExpression},
+		{"vlan id out of range", []string{"deny vlan 4096"}, ErrInvalidFilterExpression},
+		{"invalid ether proto", []string{"deny ether proto ipv4"}, ErrInvalidFilterExpression},
+		{"missing ether proto", []string{"deny ether proto"}, ErrInvalidFilterExpression},
+		{"invalid mac", []string{"deny ether src 02:00"}, ErrInvalidFilterExpression},
+		{"missing ether qualifier", []string{"deny ether"}, ErrInvalidFilterExpression},
+		{"invalid host", []string{"deny host example.com"}, ErrInvalidFilterExpression},
+		{"missing host", []string{"deny src host"}, ErrInvalidFilterExpression},
+		{"net without prefix length", []string{"deny net 10.0.0.0"}, ErrInvalidFilterExpression},
+		{"invalid port", []string{"deny port dns"}, ErrInvalidFilterExpression},
+		{"port out of range", []string{"deny port 65536"}, ErrInvalidFilterExpression},
+		{"reversed port range", []string{"deny port 68-67"}, ErrInvalidFilterExpression},
+		{"qualifier without kind", []string{"deny src"}, ErrInvalidFilterExpression},
+		{"qualifier with invalid kind", []string{"deny src mac 02:00:00:00:00:01"}, ErrInvalidFilterExpression},
+		{"invalid rule after valid one", []string{"allow udp", "deny tcp or"}, ErrInvalidFilterExpression},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.rules)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && filter == nil {
+				t.Fatal("got nil filter without error")
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	dhcp := udp4Frame(t, -1, "10.0.0.1", "10.0.0.2", 67, 68)
+	dns := udp4Frame(t, -1, "10.0.0.1", "192.168.0.1", 1234, 53)
+	tagged := udp4Frame(t, 42, "10.0.0.1", "10.0.0.2", 1234, 53)
+	ssh := tcp6Frame(t, "fd00::1", "fd00::2", 40000, 22)
+	ping := icmp4Frame(t, "10.0.0.1", "10.0.0.2")
+	arp := arpFrame(t, "10.0.0.1", "10.0.0.2")
+
+	fragment := udp4Frame(t, -1, "10.0.0.1", "10.0.0.2", 67, 68)
+	fragment[ethernetHeaderLength+7] = 1 // Fragment offset of 8 bytes, so the frame doesn't contain the UDP header
+
+	tests := []struct {
+		name      string
+		rules     []string
+		frame     []byte
+		direction string
+		want      bool
+	}{
+		// Rule evaluation
+		{"no rules pass", []string{}, dhcp, wrtcaudit.DirectionIn, true},
+		{"unmatched frames pass", []string{"deny tcp"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"empty expression matches", []string{"deny"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"first matching rule decides", []string{"allow udp", "deny ip"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"later rule decides if earlier don't match", []string{"allow tcp", "deny ip"}, dhcp, wrtcaudit.DirectionIn, false},
+
+		// Primitives
+		{"ip", []string{"deny ip"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"ip on ipv6", []string{"deny ip"}, ssh, wrtcaudit.DirectionIn, true},
+		{"ip6", []string{"deny ip6"}, ssh, wrtcaudit.DirectionIn, false},
+		{"arp", []string{"deny arp"}, arp, wrtcaudit.DirectionIn, false},
+		{"tcp", []string{"deny tcp"}, ssh, wrtcaudit.DirectionIn, false},
+		{"udp", []string{"deny udp"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"udp on tcp", []string{"deny udp"}, ssh, wrtcaudit.DirectionIn, true},
+		{"icmp", []string{"deny icmp"}, ping, wrtcaudit.DirectionIn, false},
+		{"icmp6 on icmp", []string{"deny icmp6"}, ping, wrtcaudit.DirectionIn, true},
+		{"broadcast", []string{"deny broadcast"}, arp, wrtcaudit.DirectionIn, false},
+		{"broadcast on unicast", []string{"deny broadcast"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"multicast on broadcast", []string{"deny multicast"}, arp, wrtcaudit.DirectionIn, false},
+		{"multicast on unicast", []string{"deny multicast"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"inbound", []string{"deny inbound"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"inbound on outbound", []string{"deny inbound"}, dhcp, wrtcaudit.DirectionOut, true},
+		{"outbound", []string{"deny outbound"}, dhcp, wrtcaudit.DirectionOut, false},
+		{"ether proto", []string{"deny ether proto 0x0806"}, arp, wrtcaudit.DirectionIn, false},
+		{"ether proto on other type", []string{"deny ether proto 0x0806"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"ether src", []string{"deny ether src 02:00:00:00:00:01"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"ether dst on source", []string{"deny ether dst 02:00:00:00:00:01"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"ether host", []string{"deny ether host 02:00:00:00:00:02"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"ether without qualifier", []string{"deny ether 02:00:00:00:00:02"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"host", []string{"deny host 10.0.0.2"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"src host on destination", []string{"deny src host 10.0.0.2"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"dst host", []string{"deny dst host 10.0.0.2"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"host on ipv6", []string{"deny host fd00::1"}, ssh, wrtcaudit.DirectionIn, false},
+		{"host on arp", []string{"deny dst host 10.0.0.2"}, arp, wrtcaudit.DirectionIn, false},
+		{"net", []string{"deny dst net 192.168.0.0/16"}, dns, wrtcaudit.DirectionIn, false},
+		{"net on other network", []string{"deny dst net 192.168.0.0/16"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"net on ipv6", []string{"deny net fd00::/8"}, ssh, wrtcaudit.DirectionIn, false},
+		{"port", []string{"deny port 22"}, ssh, wrtcaudit.DirectionIn, false},
+		{"src port on destination", []string{"deny src port 53"}, dns, wrtcaudit.DirectionIn, true},
+		{"dst port range", []string{"deny dst port 67-68"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"port range excludes", []string{"deny port 100-200"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"port on icmp", []string{"deny port 0-65535"}, ping, wrtcaudit.DirectionIn, true},
+		{"port on non-first fragment", []string{"deny port 67"}, fragment, wrtcaudit.DirectionIn, true},
+		{"udp on non-first fragment", []string{"deny udp"}, fragment, wrtcaudit.DirectionIn, false},
+
+		// Precedence
+		{"and binds tighter than or", []string{"deny tcp or udp and port 22"}, ssh, wrtcaudit.DirectionIn, false},
+		{"and binds tighter than or on udp", []string{"deny tcp or udp and port 22"}, dns, wrtcaudit.DirectionIn, true},
+		{"parentheses override precedence", []string{"deny (tcp or udp) and port 22"}, dns, wrtcaudit.DirectionIn, true},
+		{"parentheses override precedence on tcp", []string{"deny (tcp or udp) and port 22"}, ssh, wrtcaudit.DirectionIn, false},
+		{"not binds tighter than and", []string{"deny not udp and ip"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"not binds tighter than and on icmp", []string{"deny not udp and ip"}, ping, wrtcaudit.DirectionIn, false},
+		{"not binds tighter than or", []string{"deny not tcp or udp"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"not of parentheses", []string{"deny not (tcp or udp)"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"double not", []string{"deny not not udp"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"nested parentheses", []string{"deny ((udp) and (src port 67 or src port 68))"}, dhcp, wrtcaudit.DirectionIn, false},
+
+		// The VLAN ID is optional, so tokens after vlan which aren't IDs belong to the enclosing expression
+		{"vlan", []string{"deny vlan"}, tagged, wrtcaudit.DirectionIn, false},
+		{"vlan on untagged", []string{"deny vlan"}, dhcp, wrtcaudit.DirectionIn, true},
+		{"vlan id", []string{"deny vlan 42"}, tagged, wrtcaudit.DirectionIn, false},
+		{"vlan other id", []string{"deny vlan 43"}, tagged, wrtcaudit.DirectionIn, true},
+		{"vlan followed by and", []string{"deny vlan and udp"}, tagged, wrtcaudit.DirectionIn, false},
+		{"vlan followed by or", []string{"deny vlan or arp"}, arp, wrtcaudit.DirectionIn, false},
+		{"vlan followed by closing parenthesis", []string{"deny (vlan) and port 53"}, tagged, wrtcaudit.DirectionIn, false},
+		{"vlan id followed by and", []string{"deny vlan 42 and dst port 53"}, tagged, wrtcaudit.DirectionIn, false},
+		{"vlan id followed by and on other port", []string{"deny vlan 42 and dst port 54"}, tagged, wrtcaudit.DirectionIn, true},
+		{"not vlan", []string{"deny not vlan"}, dhcp, wrtcaudit.DirectionIn, false},
+		{"primitives match inside vlan", []string{"deny udp and dst host 10.0.0.2 and port 53"}, tagged, wrtcaudit.DirectionIn, false},
+
+		// Frames which can't be decoded pass
+		{"empty frame passes", []string{"deny"}, []byte{}, wrtcaudit.DirectionIn, true},
+		{"truncated ethernet header passes", []string{"deny"}, dhcp[:ethernetHeaderLength-1], wrtcaudit.DirectionIn, true},
+		{"truncated vlan tag passes", []string{"deny"}, tagged[:ethernetHeaderLength+dot1QHeaderLength-1], wrtcaudit.DirectionIn, true},
+
+		// Malformed frames with a valid Ethernet header are matched on the fields which could be decoded
+		{"truncated ipv4 header matches ether type", []string{"deny ip"}, dhcp[:ethernetHeaderLength+ipv4HeaderMinLength-1], wrtcaudit.DirectionIn, false},
+		{"truncated ipv4 header doesn't match protocol", []string{"deny udp"}, dhcp[:ethernetHeaderLength+ipv4HeaderMinLength-1], wrtcaudit.DirectionIn, true},
+		{"truncated ipv6 header doesn't match host", []string{"deny host fd00::1"}, ssh[:ethernetHeaderLength+ipv6HeaderLength-1], wrtcaudit.DirectionIn, true},
+		{"truncated udp header doesn't match port", []string{"deny port 68"}, dhcp[:ethernetHeaderLength+ipv4HeaderMinLength+3], wrtcaudit.DirectionIn, true},
+		{"truncated udp header matches protocol", []string{"deny udp"}, dhcp[:ethernetHeaderLength+ipv4HeaderMinLength+3], wrtcaudit.DirectionIn, false},
+		{"truncated arp doesn't match host", []string{"deny host 10.0.0.1"}, arp[:ethernetHeaderLength+arpIPv4Length-1], wrtcaudit.DirectionIn, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := filter(tt.frame, tt.direction); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterInvalidIPv4HeaderLength(t *testing.T) {
+	frame := udp4Frame(t, -1, "10.0.0.1", "10.0.0.2", 67, 68)
+	frame[ethernetHeaderLength] = 0x44 // Header length of 16 bytes, which is shorter than the minimum
+
+	filter, err := ParseFilter([]string{"deny ip and not udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The frame is decoded as an IPv4 frame without the IP fields, so the protocol doesn't match
+	if filter(frame, wrtcaudit.DirectionIn) {
+		t.Fatal("got true, want false")
+	}
+}
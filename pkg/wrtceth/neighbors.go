@@ -0,0 +1,265 @@
+package wrtceth
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ndpFlagSolicited = 0x40 // The advertisement has been sent in response to a solicitation
+	ndpFlagOverride  = 0x20 // The advertisement should override cached link-layer addresses
+	ndpHopLimit      = 255  // Hop limit of NDP packets, which receivers check to make sure that they haven't been forwarded
+)
+
+type neighbor struct {
+	mac     net.HardwareAddr
+	peerID  string
+	learned time.Time
+}
+
+// neighborCache maps the IP addresses of hosts behind peers to their MAC addresses, which are learned from their ARP and NDP packets, so that requests for them can be answered locally instead of being flooded to all peers
+type neighborCache struct {
+	timeout time.Duration
+
+	lock      sync.Mutex
+	neighbors map[string]neighbor
+}
+
+func newNeighborCache(timeout time.Duration) *neighborCache {
+	return &neighborCache{
+		timeout: timeout,
+
+		neighbors: map[string]neighbor{},
+	}
+}
+
+// learn records the address of the sender of an ARP or NDP packet in a frame received from a peer
+func (c *neighborCache) learn(peerID string, buf []byte) {
+	var frame layers.Ethernet
+	if err := frame.DecodeFromBytes(buf, gopacket.NilDecodeFeedback); err != nil {
+		return
+	}
+
+	switch frame.EthernetType {
+	case layers.EthernetTypeARP:
+		var arp layers.ARP
+		if err := arp.DecodeFromBytes(frame.Payload, gopacket.NilDecodeFeedback); err != nil || arp.AddrType != layers.LinkTypeEthernet || arp.Protocol != layers.EthernetTypeIPv4 {
+			return
+		}
+
+		// ARP probes don't have a sender address yet
+		if ip := net.IP(arp.SourceProtAddress); !ip.IsUnspecified() {
+			c.add(peerID, ip, net.HardwareAddr(arp.SourceHwAddress))
+		}
+	case layers.EthernetTypeIPv6:
+		packet, icmp, ok := decodeICMPv6(frame.Payload)
+		if !ok {
+			return
+		}
+
+		switch icmp.TypeCode.Type() {
+		case layers.ICMPv6TypeNeighborAdvertisement:
+			var advertisement layers.ICMPv6NeighborAdvertisement
+			if err := advertisement.DecodeFromBytes(icmp.Payload, gopacket.NilDecodeFeedback); err != nil {
+				return
+			}
+
+			c.add(peerID, advertisement.TargetAddress, getLinkLayerAddress(advertisement.Options, layers.ICMPv6OptTargetAddress, frame.SrcMAC))
+		case layers.ICMPv6TypeNeighborSolicitation:
+			// Solicitations for duplicate address detection don't have a sender address yet
+			if packet.SrcIP.IsUnspecified() {
+				return
+			}
+
+			var solicitation layers.ICMPv6NeighborSolicitation
+			if err := solicitation.DecodeFromBytes(icmp.Payload, gopacket.NilDecodeFeedback); err != nil {
+				return
+			}
+
+			c.add(peerID, packet.SrcIP, getLinkLayerAddress(solicitation.Options, layers.ICMPv6OptSourceAddress, frame.SrcMAC))
+		}
+	}
+}
+
+func (c *neighborCache) add(peerID string, ip net.IP, mac net.HardwareAddr) {
+	if len(mac) != 6 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.neighbors[ip.String()] = neighbor{append(net.HardwareAddr{}, mac...), peerID, time.Now()}
+}
+
+// lookup returns the MAC address of an IP address if it has been learned and hasn't expired yet
+func (c *neighborCache) lookup(ip net.IP) (net.HardwareAddr, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	n, ok := c.neighbors[ip.String()]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Since(n.learned) > c.timeout {
+		delete(c.neighbors, ip.String())
+
+		return nil, false
+	}
+
+	return n.mac, true
+}
+
+// forget removes the addresses learned from a disconnected peer
+func (c *neighborCache) forget(peerID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for ip, n := range c.neighbors {
+		if n.peerID == peerID {
+			delete(c.neighbors, ip)
+		}
+	}
+}
+
+// answer returns a reply to an ARP request or NDP solicitation read from the TAP device if the requested address has been learned; returns nil if the frame should be sent to peers
+func (c *neighborCache) answer(frame *layers.Ethernet) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+
+	switch frame.EthernetType {
+	case layers.EthernetTypeARP:
+		var arp layers.ARP
+		if err := arp.DecodeFromBytes(frame.Payload, gopacket.NilDecodeFeedback); err != nil || arp.Operation != layers.ARPRequest || arp.AddrType != layers.LinkTypeEthernet || arp.Protocol != layers.EthernetTypeIPv4 {
+			return nil
+		}
+
+		// Probes and gratuitous requests must reach the hosts which own the address
+		sender, target := net.IP(arp.SourceProtAddress), net.IP(arp.DstProtAddress)
+		if sender.IsUnspecified() || sender.Equal(target) {
+			return nil
+		}
+
+		mac, ok := c.lookup(target)
+		if !ok {
+			return nil
+		}
+
+		if err := gopacket.SerializeLayers(
+			buf,
+			opts,
+			&layers.Ethernet{
+				SrcMAC:       mac,
+				DstMAC:       frame.SrcMAC,
+				EthernetType: layers.EthernetTypeARP,
+			},
+			&layers.ARP{
+				AddrType:          layers.LinkTypeEthernet,
+				Protocol:          layers.EthernetTypeIPv4,
+				HwAddressSize:     6,
+				ProtAddressSize:   4,
+				Operation:         layers.ARPReply,
+				SourceHwAddress:   mac,
+				SourceProtAddress: target.To4(),
+				DstHwAddress:      arp.SourceHwAddress,
+				DstProtAddress:    arp.SourceProtAddress,
+			},
+		); err != nil {
+			return nil
+		}
+
+		return buf.Bytes()
+	case layers.EthernetTypeIPv6:
+		packet, icmp, ok := decodeICMPv6(frame.Payload)
+		if !ok || icmp.TypeCode.Type() != layers.ICMPv6TypeNeighborSolicitation || packet.SrcIP.IsUnspecified() {
+			return nil
+		}
+
+		var solicitation layers.ICMPv6NeighborSolicitation
+		if err := solicitation.DecodeFromBytes(icmp.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return nil
+		}
+
+		mac, ok := c.lookup(solicitation.TargetAddress)
+		if !ok {
+			return nil
+		}
+
+		ip := &layers.IPv6{
+			Version:    6,
+			NextHeader: layers.IPProtocolICMPv6,
+			HopLimit:   ndpHopLimit,
+			SrcIP:      solicitation.TargetAddress,
+			DstIP:      packet.SrcIP,
+		}
+
+		reply := &layers.ICMPv6{
+			TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0),
+		}
+		if err := reply.SetNetworkLayerForChecksum(ip); err != nil {
+			return nil
+		}
+
+		if err := gopacket.SerializeLayers(
+			buf,
+			opts,
+			&layers.Ethernet{
+				SrcMAC:       mac,
+				DstMAC:       frame.SrcMAC,
+				EthernetType: layers.EthernetTypeIPv6,
+			},
+			ip,
+			reply,
+			&layers.ICMPv6NeighborAdvertisement{
+				Flags:         ndpFlagSolicited | ndpFlagOverride,
+				TargetAddress: solicitation.TargetAddress,
+				Options: layers.ICMPv6Options{
+					{
+						Type: layers.ICMPv6OptTargetAddress,
+						Data: mac,
+					},
+				},
+			},
+		); err != nil {
+			return nil
+		}
+
+		return buf.Bytes()
+	}
+
+	return nil
+}
+
+// decodeICMPv6 decodes an IPv6 packet which directly contains an ICMPv6 message
+func decodeICMPv6(payload []byte) (*layers.IPv6, *layers.ICMPv6, bool) {
+	var packet layers.IPv6
+	if err := packet.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil || packet.NextHeader != layers.IPProtocolICMPv6 {
+		return nil, nil, false
+	}
+
+	var icmp layers.ICMPv6
+	if err := icmp.DecodeFromBytes(packet.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil, nil, false
+	}
+
+	return &packet, &icmp, true
+}
+
+// getLinkLayerAddress returns the link-layer address from an NDP option, or the fallback if the option isn't set
+func getLinkLayerAddress(options layers.ICMPv6Options, optionType layers.ICMPv6Opt, fallback net.HardwareAddr) net.HardwareAddr {
+	for _, option := range options {
+		if option.Type == optionType && len(option.Data) == 6 {
+			return net.HardwareAddr(option.Data)
+		}
+	}
+
+	return fallback
+}
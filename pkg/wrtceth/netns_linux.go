@@ -2,6 +2,8 @@ package wrtceth
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/songgao/water"
@@ -50,3 +52,58 @@ func setLinkUp(linkName string) error {
 
 	return netlink.LinkSetUp(link)
 }
+
+func enableProxyNeighbors(linkName string) error {
+	if _, err := netlink.LinkByName(linkName); err != nil {
+		return err
+	}
+
+	// The kernel only answers for proxy neighbors if it forwards packets; NDP also has to be enabled explicitly
+	for _, sysctl := range []string{
+		"/proc/sys/net/ipv4/ip_forward",
+		"/proc/sys/net/ipv6/conf/all/forwarding",
+		filepath.Join("/proc/sys/net/ipv6/conf", linkName, "proxy_ndp"),
+	} {
+		if err := os.WriteFile(sysctl, []byte("1"), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addProxyNeighbor(linkName string, ip net.IP) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return err
+	}
+
+	return netlink.NeighAdd(&netlink.Neigh{
+		LinkIndex: link.Attrs().Index,
+		Family:    getFamily(ip),
+		Flags:     netlink.NTF_PROXY,
+		IP:        ip,
+	})
+}
+
+func removeProxyNeighbor(linkName string, ip net.IP) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return err
+	}
+
+	return netlink.NeighDel(&netlink.Neigh{
+		LinkIndex: link.Attrs().Index,
+		Family:    getFamily(ip),
+		Flags:     netlink.NTF_PROXY,
+		IP:        ip,
+	})
+}
+
+func getFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return netlink.FAMILY_V4
+	}
+
+	return netlink.FAMILY_V6
+}
@@ -26,3 +26,15 @@ func getMTU(linkName string) (int, error) {
 func setLinkUp(linkName string) error {
 	return nil
 }
+
+func enableProxyNeighbors(linkName string) error {
+	return ErrProxyNeighborsUnsupported
+}
+
+func addProxyNeighbor(linkName string, ip net.IP) error {
+	return ErrProxyNeighborsUnsupported
+}
+
+func removeProxyNeighbor(linkName string, ip net.IP) error {
+	return ErrProxyNeighborsUnsupported
+}
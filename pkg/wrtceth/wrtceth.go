@@ -2,33 +2,60 @@ package wrtceth
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"net"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcaudit"
 	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcpcap"
 	"github.com/songgao/water"
 	"golang.org/x/sync/semaphore"
 )
 
+var (
+	ErrProxyNeighborsUnsupported = errors.New("proxy ARP/NDP is only supported on Linux") // Proxy neighbors were requested on an unsupported platform
+)
+
 const (
 	broadcastMAC         = "ff:ff:ff:ff:ff:ff"
 	ethernetHeaderLength = 14
+	dot1QHeaderLength    = 4
+	vlanIDMask           = 0x0fff
+
+	denyReasonVLAN   = "vlan"   // The frame's VLAN is not allowed
+	denyReasonQueue  = "queue"  // The peer's send queue is full
+	denyReasonFilter = "filter" // The frame was dropped by a filter
 )
 
 // AdapterConfig configures the adapter
 type AdapterConfig struct {
 	*wrtcconn.AdapterConfig
-	Device             string       // Name to give to the TAP device
-	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
-	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
-	OnPeerDisconnected func(string) // Handler to be called when the adapter has received a message
-	Parallel           int          // Maximum amount of goroutines to use to unmarshal ethernet frames
+	Device             string            // Name to give to the TAP device
+	OnSignalerConnect  func(string)      // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)      // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)      // Handler to be called when the adapter has received a message
+	Parallel           int               // Maximum amount of goroutines to use to unmarshal ethernet frames
+	BatchInterval      time.Duration     // Time to wait before flushing coalesced frames (0 disables batching; must be enabled on all peers)
+	VLANs              []uint16          // 802.1Q VLAN IDs to forward (untagged frames are always forwarded; all VLANs are forwarded if empty)
+	VLANRewrites       map[uint16]uint16 // Local VLAN IDs to rewrite before sending frames to peers (rewritten back for frames received from peers)
+	ProxyNeighbors     string            // Name of a physical interface on which to answer ARP and NDP requests for the addresses of remote peers (i.e. eth0) (disabled if empty; only supported on Linux)
+	QueueLength        int               // Amount of frames to queue per peer before dropping them (default is 1024)
+	DropPolicy         string            // Frames to drop if the queue of a peer is full (tail or head) (default is tail)
+	SuppressNeighbors  bool              // Whether to answer ARP and NDP requests from the TAP device locally if the requested address has been learned from the ARP and NDP packets of peers instead of flooding them to all peers
+	NeighborTimeout    time.Duration     // Time after which learned addresses expire, so that requests for them are flooded to all peers again (default is 5 minutes)
+	Filters            []Filter          // Filters to apply to frames sent to and received from peers; frames are dropped if any of them returns false (see ParseFilter)
+	Adaptive           bool              // Whether to adapt the reliability of the channel to peers to the measured loss and round-trip time of the connections to them, so that the VPN keeps working on lossy links (all peers must enable it)
+	Capture            *wrtcpcap.Writer  // Writer to capture frames sent to and received from peers with (disabled if nil; must use the Ethernet link type)
 }
 
 // Adapter provides an ethernet service
@@ -39,11 +66,20 @@ type Adapter struct {
 	config   *AdapterConfig
 	ctx      context.Context
 
-	cancel  context.CancelFunc
-	adapter *wrtcconn.Adapter
-	tap     *water.Interface
-	mtu     int
-	ids     chan string
+	cancel    context.CancelFunc
+	adapter   *wrtcconn.Adapter
+	tap       *water.Interface
+	mtu       int
+	batchSize int
+	ids       chan string
+
+	neighborsLock sync.Mutex
+	neighbors     map[string]string
+
+	cache *neighborCache
+
+	vlans        map[uint16]struct{}
+	vlanRewrites map[uint16]uint16
 }
 
 // NewAdapter creates the adapter
@@ -64,6 +100,20 @@ func NewAdapter(
 		config.Parallel = runtime.NumCPU()
 	}
 
+	if config.NeighborTimeout <= 0 {
+		config.NeighborTimeout = time.Minute * 5
+	}
+
+	vlans := map[uint16]struct{}{}
+	for _, vlan := range config.VLANs {
+		vlans[vlan] = struct{}{}
+	}
+
+	vlanRewrites := map[uint16]uint16{}
+	for local, remote := range config.VLANRewrites {
+		vlanRewrites[remote] = local
+	}
+
 	return &Adapter{
 		signaler: signaler,
 		key:      key,
@@ -73,6 +123,13 @@ func NewAdapter(
 
 		cancel: cancel,
 		ids:    make(chan string),
+
+		neighbors: map[string]string{},
+
+		cache: newNeighborCache(config.NeighborTimeout),
+
+		vlans:        vlans,
+		vlanRewrites: vlanRewrites,
 	}
 }
 
@@ -80,6 +137,16 @@ func NewAdapter(
 func (a *Adapter) Open() error {
 	log.Trace().Msg("Opening adapter")
 
+	if err := wrtcconn.ValidateDropPolicy(a.config.DropPolicy); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(a.config.ProxyNeighbors) != "" {
+		if err := enableProxyNeighbors(a.config.ProxyNeighbors); err != nil {
+			return err
+		}
+	}
+
 	var err error
 	a.tap, err = water.New(water.Config{
 		DeviceType:             water.TAP,
@@ -94,6 +161,10 @@ func (a *Adapter) Open() error {
 		return err
 	}
 
+	if a.config.Adaptive {
+		a.config.AdapterConfig.AdaptiveChannels = append(a.config.AdapterConfig.AdaptiveChannels, services.EthernetPrimary)
+	}
+
 	a.adapter = wrtcconn.NewAdapter(
 		a.signaler,
 		a.key,
@@ -109,6 +180,14 @@ func (a *Adapter) Open() error {
 	}
 
 	a.mtu, err = getMTU(a.tap.Name())
+	if err != nil {
+		return err
+	}
+
+	// Batches must fit the largest frames of the TAP device
+	if a.config.BatchInterval > 0 {
+		a.batchSize, err = wrtcconn.GetBatchSize(a.mtu + ethernetHeaderLength)
+	}
 
 	return err
 }
@@ -117,6 +196,16 @@ func (a *Adapter) Open() error {
 func (a *Adapter) Close() error {
 	log.Trace().Msg("Closing adapter")
 
+	a.neighborsLock.Lock()
+	for ip := range a.neighbors {
+		if err := removeProxyNeighbor(a.config.ProxyNeighbors, net.ParseIP(ip)); err != nil {
+			log.Debug().Err(err).Str("ip", ip).Msg("Could not remove proxy neighbor, continuing")
+		}
+
+		delete(a.neighbors, ip)
+	}
+	a.neighborsLock.Unlock()
+
 	if err := a.tap.Close(); err != nil {
 		return err
 	}
@@ -135,11 +224,34 @@ func (a *Adapter) Wait() error {
 		for {
 			buf := make([]byte, a.mtu+ethernetHeaderLength)
 
-			if _, err := a.tap.Read(buf); err != nil {
+			n, err := a.tap.Read(buf)
+			if err != nil {
 				log.Debug().Err(err).Msg("Could not read from TAP device, continuing")
 
 				continue
 			}
+			buf = buf[:n]
+
+			// Filter before rewriting the VLAN tag so that expressions match local VLAN IDs
+			if !a.filterFrame(buf, wrtcaudit.DirectionOut) {
+				log.Trace().Msg("Dropping frame denied by filter")
+
+				a.auditFrame(wrtcaudit.EventDenied, nil, wrtcaudit.DirectionOut, denyReasonFilter, buf)
+
+				continue
+			}
+
+			if !a.filterVLAN(buf, true) {
+				log.Trace().Msg("Dropping frame from disallowed VLAN")
+
+				a.auditFrame(wrtcaudit.EventDenied, nil, wrtcaudit.DirectionOut, denyReasonVLAN, buf)
+
+				continue
+			}
+
+			if a.config.Capture != nil {
+				a.config.Capture.Write(buf)
+			}
 
 			go func() {
 				if err := sem.Acquire(a.ctx, 1); err != nil {
@@ -156,6 +268,18 @@ func (a *Adapter) Wait() error {
 					return
 				}
 
+				if a.config.SuppressNeighbors {
+					if reply := a.cache.answer(&frame); reply != nil {
+						log.Trace().Str("src", frame.SrcMAC.String()).Msg("Answering ARP/NDP request locally")
+
+						if _, err := a.tap.Write(reply); err != nil {
+							log.Debug().Err(err).Msg("Could not write to TAP device, continuing")
+						}
+
+						return
+					}
+				}
+
 				peersLock.Lock()
 				for _, peer := range peers {
 					// Send if matching destination, multicast or broadcast MAC
@@ -169,6 +293,8 @@ func (a *Adapter) Wait() error {
 
 							continue
 						}
+
+						a.auditFrame(wrtcaudit.EventFlow, peer, wrtcaudit.DirectionOut, "", buf)
 					}
 				}
 				peersLock.Unlock()
@@ -186,6 +312,8 @@ func (a *Adapter) Wait() error {
 			}
 
 			return nil
+		case err := <-a.adapter.Err():
+			return err
 		case id := <-a.ids:
 			log.Debug().Str("id", id).Msg("Connected to signaler")
 
@@ -197,23 +325,59 @@ func (a *Adapter) Wait() error {
 				return err
 			}
 		case peer := <-a.adapter.Accept():
-			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Connected to peer")
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
 
 			if a.config.OnPeerConnect != nil {
 				a.config.OnPeerConnect(peer.PeerID)
 			}
 
+			a.audit(wrtcaudit.EventPeerJoined, peer)
+
+			if a.config.BatchInterval > 0 {
+				peer = &wrtcconn.Peer{
+					PeerID:    peer.PeerID,
+					Name:      peer.Name,
+					ChannelID: peer.ChannelID,
+					Metadata:  peer.Metadata,
+					Community: peer.Community,
+					Relayed:   peer.Relayed,
+					Conn: wrtcconn.NewBatchedConn(peer.Conn, &wrtcconn.BatchConfig{
+						Interval: a.config.BatchInterval,
+						Size:     a.batchSize,
+					}),
+				}
+			}
+
+			// Frames are sent from a queue per peer so that a slow peer can't stall forwarding to other peers
+			queue := a.newQueuedConn(peer)
+			peer = &wrtcconn.Peer{
+				PeerID:    peer.PeerID,
+				Name:      peer.Name,
+				ChannelID: peer.ChannelID,
+				Metadata:  peer.Metadata,
+				Community: peer.Community,
+				Relayed:   peer.Relayed,
+				Conn:      queue,
+			}
+
 			go func() {
 				defer func() {
-					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Uint64("dropped", queue.Dropped()).Msg("Disconnected from peer")
+
+					_ = queue.Close()
 
 					if a.config.OnPeerDisconnected != nil {
 						a.config.OnPeerDisconnected(peer.PeerID)
 					}
 
+					a.audit(wrtcaudit.EventPeerLeft, peer)
+
 					peersLock.Lock()
 					delete(peers, peer.PeerID)
 					peersLock.Unlock()
+
+					a.forgetNeighbors(peer.PeerID)
+					a.cache.forget(peer.PeerID)
 				}()
 
 				peersLock.Lock()
@@ -223,7 +387,8 @@ func (a *Adapter) Wait() error {
 				for {
 					buf := make([]byte, a.mtu+ethernetHeaderLength)
 
-					if _, err := peer.Conn.Read(buf); err != nil {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
 						log.Debug().
 							Err(err).
 							Str("channelID", peer.ChannelID).
@@ -233,7 +398,41 @@ func (a *Adapter) Wait() error {
 						return
 					}
 
-					if _, err := a.tap.Write(buf); err != nil {
+					if !a.filterVLAN(buf[:n], false) {
+						log.Trace().
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Msg("Dropping frame from disallowed VLAN")
+
+						a.auditFrame(wrtcaudit.EventDenied, peer, wrtcaudit.DirectionIn, denyReasonVLAN, buf[:n])
+
+						continue
+					}
+
+					if !a.filterFrame(buf[:n], wrtcaudit.DirectionIn) {
+						log.Trace().
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Msg("Dropping frame denied by filter")
+
+						a.auditFrame(wrtcaudit.EventDenied, peer, wrtcaudit.DirectionIn, denyReasonFilter, buf[:n])
+
+						continue
+					}
+
+					if strings.TrimSpace(a.config.ProxyNeighbors) != "" {
+						a.learnNeighbor(peer.PeerID, buf[:n])
+					}
+
+					if a.config.SuppressNeighbors {
+						a.cache.learn(peer.PeerID, buf[:n])
+					}
+
+					if a.config.Capture != nil {
+						a.config.Capture.Write(buf[:n])
+					}
+
+					if _, err := a.tap.Write(buf[:n]); err != nil {
 						log.Debug().
 							Err(err).
 							Str("channelID", peer.ChannelID).
@@ -242,8 +441,171 @@ func (a *Adapter) Wait() error {
 
 						continue
 					}
+
+					a.auditFrame(wrtcaudit.EventFlow, peer, wrtcaudit.DirectionIn, "", buf[:n])
 				}
 			}()
 		}
 	}
 }
+
+func (a *Adapter) newQueuedConn(peer *wrtcconn.Peer) *wrtcconn.QueuedConn {
+	return wrtcconn.NewQueuedConn(peer.Conn, &wrtcconn.QueueConfig{
+		Length:     a.config.QueueLength,
+		DropPolicy: a.config.DropPolicy,
+		OnDrop: func(buf []byte) {
+			log.Trace().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Dropping frame because the queue of the peer is full")
+
+			a.auditFrame(wrtcaudit.EventDenied, peer, wrtcaudit.DirectionOut, denyReasonQueue, buf)
+		},
+	})
+}
+
+func (a *Adapter) audit(eventType string, peer *wrtcconn.Peer) {
+	if a.config.AdapterConfig == nil || a.config.Audit == nil {
+		return
+	}
+
+	if err := a.config.Audit.Log(wrtcaudit.Event{
+		Type:      eventType,
+		Community: peer.Community,
+		PeerID:    peer.PeerID,
+		Name:      peer.Name,
+		ChannelID: peer.ChannelID,
+		Relayed:   peer.Relayed,
+	}); err != nil {
+		log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not write to audit log, continuing")
+	}
+}
+
+// Count a frame towards its flow or denial in the audit log; the peer is nil if the frame hasn't been routed yet
+func (a *Adapter) auditFrame(eventType string, peer *wrtcconn.Peer, direction string, reason string, buf []byte) {
+	if a.config.AdapterConfig == nil || a.config.Audit == nil || len(buf) < ethernetHeaderLength {
+		return
+	}
+
+	event := wrtcaudit.Event{
+		Type:        eventType,
+		Direction:   direction,
+		Protocol:    layers.EthernetType(binary.BigEndian.Uint16(buf[12:14])).String(),
+		Source:      net.HardwareAddr(buf[6:12]).String(),
+		Destination: net.HardwareAddr(buf[0:6]).String(),
+		Reason:      reason,
+	}
+
+	if peer != nil {
+		event.Community = peer.Community
+		event.PeerID = peer.PeerID
+	}
+
+	a.config.Audit.Count(event, len(buf))
+}
+
+// Check whether a frame's VLAN is allowed and rewrite its tag in place; returns false if the frame should be dropped
+func (a *Adapter) filterVLAN(buf []byte, outgoing bool) bool {
+	if len(buf) < ethernetHeaderLength+dot1QHeaderLength || layers.EthernetType(binary.BigEndian.Uint16(buf[12:14])) != layers.EthernetTypeDot1Q {
+		return true
+	}
+
+	tci := binary.BigEndian.Uint16(buf[14:16])
+	vlan := tci & vlanIDMask
+
+	// Outgoing frames are rewritten from local to remote VLAN IDs, incoming ones from remote to local ones
+	rewrites := a.vlanRewrites
+	if outgoing {
+		rewrites = a.config.VLANRewrites
+	}
+
+	local := vlan
+	if rewritten, ok := rewrites[vlan]; ok {
+		// Keep the priority and DEI bits
+		binary.BigEndian.PutUint16(buf[14:16], (tci&^vlanIDMask)|(rewritten&vlanIDMask))
+
+		if !outgoing {
+			local = rewritten
+		}
+	}
+
+	if len(a.vlans) <= 0 {
+		return true
+	}
+
+	_, ok := a.vlans[local]
+
+	return ok
+}
+
+// Answer ARP and NDP requests on the physical interface for the source address of a frame received from a peer
+func (a *Adapter) learnNeighbor(peerID string, buf []byte) {
+	var frame layers.Ethernet
+	if err := frame.DecodeFromBytes(buf, gopacket.NilDecodeFeedback); err != nil {
+		return
+	}
+
+	var ip net.IP
+	switch frame.EthernetType {
+	case layers.EthernetTypeARP:
+		var arp layers.ARP
+		if err := arp.DecodeFromBytes(frame.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return
+		}
+
+		ip = net.IP(arp.SourceProtAddress)
+	case layers.EthernetTypeIPv4:
+		var packet layers.IPv4
+		if err := packet.DecodeFromBytes(frame.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return
+		}
+
+		ip = packet.SrcIP
+	case layers.EthernetTypeIPv6:
+		var packet layers.IPv6
+		if err := packet.DecodeFromBytes(frame.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return
+		}
+
+		ip = packet.SrcIP
+	default:
+		return
+	}
+
+	// Link-local addresses can't be reached through the gateway
+	if !ip.IsGlobalUnicast() {
+		return
+	}
+
+	a.neighborsLock.Lock()
+	defer a.neighborsLock.Unlock()
+
+	if _, ok := a.neighbors[ip.String()]; ok {
+		return
+	}
+
+	if err := addProxyNeighbor(a.config.ProxyNeighbors, ip); err != nil {
+		log.Debug().Err(err).Str("ip", ip.String()).Str("peerID", peerID).Msg("Could not add proxy neighbor, continuing")
+
+		return
+	}
+
+	log.Debug().Str("ip", ip.String()).Str("peerID", peerID).Msg("Added proxy neighbor")
+
+	a.neighbors[ip.String()] = peerID
+}
+
+// Stop answering ARP and NDP requests for the addresses of a disconnected peer
+func (a *Adapter) forgetNeighbors(peerID string) {
+	a.neighborsLock.Lock()
+	defer a.neighborsLock.Unlock()
+
+	for ip, candidate := range a.neighbors {
+		if candidate != peerID {
+			continue
+		}
+
+		if err := removeProxyNeighbor(a.config.ProxyNeighbors, net.ParseIP(ip)); err != nil {
+			log.Debug().Err(err).Str("ip", ip).Str("peerID", peerID).Msg("Could not remove proxy neighbor, continuing")
+		}
+
+		delete(a.neighbors, ip)
+	}
+}
@@ -0,0 +1,86 @@
+package wrtcexec
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pojntfx/weron/internal/framing"
+)
+
+const (
+	frameHeaderLength = 5 // Length of the command ID and frame type
+
+	frameTypeRun        byte = 0 // Request to run a command; the payload contains the request
+	frameTypeStdin      byte = 1 // Data for the standard input of the command
+	frameTypeStdinClose byte = 2 // The client has finished writing to the standard input
+	frameTypeStdout     byte = 3 // Data from the standard output of the command
+	frameTypeStderr     byte = 4 // Data from the standard error of the command
+	frameTypeExit       byte = 5 // The command has exited; the payload contains the exit code
+	frameTypeError      byte = 6 // The command could not be run; the payload contains the reason
+	frameTypeCancel     byte = 7 // The client has stopped waiting for the command, which is killed
+)
+
+var (
+	ErrInvalidFrame = framing.ErrInvalidFrame // The received frame could not be parsed
+)
+
+type request struct {
+	Command string   `json:"command"` // Name of the command to run
+	Args    []string `json:"args"`    // Arguments to append to the command
+}
+
+// conn multiplexes the commands which a client runs on a server over a single data channel; each frame carries the ID of its command, which the client allocates
+type conn struct {
+	*framing.Conn
+}
+
+func newConn(c io.ReadWriteCloser) *conn {
+	return &conn{framing.NewConn(c, frameHeaderLength)}
+}
+
+func (c *conn) writeFrame(id uint32, frameType byte, p []byte) error {
+	return c.WriteFrame(getHeader(id, frameType), p)
+}
+
+// readFrame reads the next frame; the payload is only valid until the next call
+func (c *conn) readFrame() (uint32, byte, []byte, error) {
+	header, payload, err := c.ReadFrame()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return binary.BigEndian.Uint32(header), header[4], payload, nil
+}
+
+func (c *conn) run(id uint32, r request) error {
+	p, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return c.writeFrame(id, frameTypeRun, p)
+}
+
+func (c *conn) exit(id uint32, code int) error {
+	p := make([]byte, 4)
+	binary.BigEndian.PutUint32(p, uint32(int32(code)))
+
+	return c.writeFrame(id, frameTypeExit, p)
+}
+
+func (c *conn) fail(id uint32, reason error) error {
+	return c.writeFrame(id, frameTypeError, []byte(reason.Error()))
+}
+
+func getHeader(id uint32, frameType byte) []byte {
+	header := make([]byte, frameHeaderLength)
+	binary.BigEndian.PutUint32(header, id)
+	header[4] = frameType
+
+	return header
+}
+
+// newFrameWriter creates a writer which writes data as frames of a type for a command, splitting large writes across frames
+func newFrameWriter(c *conn, id uint32, frameType byte) io.Writer {
+	return &framing.Writer{Conn: c.Conn, Header: getHeader(id, frameType)}
+}
@@ -0,0 +1,568 @@
+package wrtcexec
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+)
+
+var (
+	ErrCommandNotAllowed   = errors.New("command is not allowed")                    // The server doesn't allow running the requested command
+	ErrArgumentsNotAllowed = errors.New("arguments are not allowed")                 // The server doesn't allow appending arguments to commands
+	ErrPeerNotAllowed      = errors.New("peer is not allowed to run commands")       // The server doesn't allow the peer to run commands
+	ErrNotAClient          = errors.New("adapter is a server")                       // Only clients run commands on peers
+	ErrMissingCommands     = errors.New("servers must allow at least one command")   // The adapter acts as a server, but no commands have been allowed
+	ErrInvalidExit         = errors.New("received exit code with an invalid length") // The received exit code could not be parsed
+	ErrPeerDisconnected    = errors.New("peer disconnected before command exited")   // The connection to the server was lost while running a command
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string)        // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)        // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)        // Handler to be called when the adapter has disconnected from a peer
+	Server             bool                // Whether to run commands for peers
+	Commands           map[string][]string // Commands which peers may run by name, with the executable and its arguments (only used when acting as a server)
+	Peers              []string            // IDs of the peers which may run commands (all peers in the community may run commands if empty) (only used when acting as a server)
+	Arguments          bool                // Whether peers may append arguments to the commands (only used when acting as a server)
+}
+
+// Adapter runs allow-listed commands for peers; servers allow commands, and clients run them on servers by their ID or name
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids chan string
+
+	allowed map[string]struct{}
+
+	// Peers which commands can be run on; changed is closed and replaced whenever a peer connects
+	peersLock sync.Mutex
+	peers     map[string]*session
+	changed   chan struct{}
+}
+
+// session holds the commands which are running on a server over the data channel to it
+type session struct {
+	peer *wrtcconn.Peer
+	conn *conn
+
+	commandsLock sync.Mutex
+	commands     map[uint32]*command
+	nextID       uint32
+
+	closed chan struct{} // Closed once the data channel to the server has been closed
+}
+
+// command receives the frames for a command which is running on a server
+type command struct {
+	id     uint32
+	frames chan frame
+	done   chan struct{} // Closed once the client has stopped waiting for the command
+}
+
+type frame struct {
+	frameType byte
+	payload   []byte
+}
+
+// process is a command which a server runs for a client
+type process struct {
+	stdin  io.WriteCloser
+	cancel context.CancelFunc
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	allowed := map[string]struct{}{}
+	for _, peer := range config.Peers {
+		allowed[peer] = struct{}{}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		allowed: allowed,
+
+		peers:   map[string]*session{},
+		changed: make(chan struct{}),
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	if a.config.Server && len(a.config.Commands) <= 0 {
+		return ErrMissingCommands
+	}
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.ExecPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	return a.adapter.Close()
+}
+
+// Wait starts handling peers
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				if a.config.Server {
+					a.handleConn(peer.PeerID, newConn(peer.Conn))
+
+					return
+				}
+
+				s := &session{
+					peer: peer,
+					conn: newConn(peer.Conn),
+
+					commands: map[uint32]*command{},
+
+					closed: make(chan struct{}),
+				}
+
+				a.peersLock.Lock()
+				a.peers[peer.PeerID] = s
+				close(a.changed)
+				a.changed = make(chan struct{})
+				a.peersLock.Unlock()
+
+				defer func() {
+					a.peersLock.Lock()
+					if a.peers[peer.PeerID] == s {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+				}()
+
+				if err := s.serve(); err != nil {
+					log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+				}
+			}()
+		}
+	}
+}
+
+// Run runs a command on the server with the given ID or name, waiting for the peer to connect if it hasn't already; stdin (which may be nil) is streamed to the command, its output is streamed to stdout and stderr, and its exit code is returned once it has exited
+//
+// Commands which run on the same server concurrently share the data channel to it; the command is killed if ctx is cancelled.
+func (a *Adapter) Run(
+	ctx context.Context,
+	peer string,
+	command string,
+	args []string,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+) (int, error) {
+	if a.config.Server {
+		return -1, ErrNotAClient
+	}
+
+	s, err := a.dial(ctx, peer)
+	if err != nil {
+		return -1, err
+	}
+
+	cmd := s.open()
+	defer s.release(cmd)
+
+	if err := s.conn.run(cmd.id, request{command, args}); err != nil {
+		return -1, err
+	}
+
+	if stdin != nil {
+		go func() {
+			if _, err := io.Copy(newFrameWriter(s.conn, cmd.id, frameTypeStdin), stdin); err != nil {
+				log.Debug().Err(err).Str("peer", peer).Msg("Could not copy from stdin to peer, stopping")
+
+				return
+			}
+
+			if err := s.conn.writeFrame(cmd.id, frameTypeStdinClose, nil); err != nil {
+				log.Debug().Err(err).Str("peer", peer).Msg("Could not close stdin of peer, continuing")
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.conn.writeFrame(cmd.id, frameTypeCancel, nil); err != nil {
+				log.Debug().Err(err).Str("peer", peer).Msg("Could not cancel command on peer, continuing")
+			}
+
+			return -1, ctx.Err()
+		case <-s.closed:
+			return -1, ErrPeerDisconnected
+		case f := <-cmd.frames:
+			switch f.frameType {
+			case frameTypeStdout:
+				if _, err := stdout.Write(f.payload); err != nil {
+					return -1, err
+				}
+			case frameTypeStderr:
+				if _, err := stderr.Write(f.payload); err != nil {
+					return -1, err
+				}
+			case frameTypeExit:
+				if len(f.payload) != 4 {
+					return -1, ErrInvalidExit
+				}
+
+				return int(int32(binary.BigEndian.Uint32(f.payload))), nil
+			case frameTypeError:
+				return -1, errors.New(string(f.payload))
+			default:
+				return -1, ErrInvalidFrame
+			}
+		}
+	}
+}
+
+// dial returns the session with the peer with the given ID or name, waiting for it to connect if it hasn't already
+func (a *Adapter) dial(ctx context.Context, peer string) (*session, error) {
+	for {
+		a.peersLock.Lock()
+		var match *session
+		for id, candidate := range a.peers {
+			if id == peer || candidate.peer.Name == peer {
+				match = candidate
+
+				break
+			}
+		}
+		changed := a.changed
+		a.peersLock.Unlock()
+
+		if match != nil {
+			return match, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-a.ctx.Done():
+			return nil, a.ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// open allocates the ID for a new command
+func (s *session) open() *command {
+	s.commandsLock.Lock()
+	defer s.commandsLock.Unlock()
+
+	cmd := &command{
+		id:     s.nextID,
+		frames: make(chan frame),
+		done:   make(chan struct{}),
+	}
+	s.commands[cmd.id] = cmd
+	s.nextID++
+
+	return cmd
+}
+
+// release stops delivering frames to a command; frames which the server still sends for it are dropped
+func (s *session) release(cmd *command) {
+	s.commandsLock.Lock()
+	delete(s.commands, cmd.id)
+	s.commandsLock.Unlock()
+
+	close(cmd.done)
+}
+
+// serve dispatches the frames from the server to their commands until the data channel is closed
+func (s *session) serve() error {
+	defer close(s.closed)
+	defer s.conn.Close()
+
+	for {
+		id, frameType, payload, err := s.conn.readFrame()
+		if err != nil {
+			return err
+		}
+
+		s.commandsLock.Lock()
+		cmd, ok := s.commands[id]
+		s.commandsLock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		select {
+		case cmd.frames <- frame{frameType, append([]byte{}, payload...)}:
+		case <-cmd.done:
+		}
+	}
+}
+
+// handleConn runs the commands which a peer requests until it disconnects
+func (a *Adapter) handleConn(peerID string, c *conn) {
+	defer c.Close()
+
+	// All commands are killed if the peer disconnects
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+
+	var processesLock sync.Mutex
+	processes := map[uint32]*process{}
+
+	for {
+		id, frameType, payload, err := c.readFrame()
+		if err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not read from peer, stopping")
+
+			return
+		}
+
+		processesLock.Lock()
+		p, ok := processes[id]
+		processesLock.Unlock()
+
+		switch frameType {
+		case frameTypeRun:
+			if ok {
+				log.Debug().Str("peerID", peerID).Uint32("id", id).Msg("Got run request for command which is already running, continuing")
+
+				continue
+			}
+
+			var req request
+			if err := json.Unmarshal(payload, &req); err != nil {
+				log.Debug().Err(err).Str("peerID", peerID).Msg("Could not unmarshal run request, continuing")
+
+				if err := c.fail(id, err); err != nil {
+					log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+				}
+
+				continue
+			}
+
+			// Commands are started before the next frame is read, so that their stdin can't be received before them
+			cmd, p := a.start(ctx, peerID, c, id, req)
+			if cmd == nil {
+				continue
+			}
+
+			processesLock.Lock()
+			processes[id] = p
+			processesLock.Unlock()
+
+			go func() {
+				defer func() {
+					processesLock.Lock()
+					delete(processes, id)
+					processesLock.Unlock()
+				}()
+
+				a.wait(peerID, c, id, req, cmd, p)
+			}()
+		case frameTypeStdin:
+			if !ok {
+				continue
+			}
+
+			// Writes fail once the command has exited, but the peer may still be sending
+			if _, err := p.stdin.Write(payload); err != nil {
+				log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to stdin of command, continuing")
+			}
+		case frameTypeStdinClose:
+			if !ok {
+				continue
+			}
+
+			if err := p.stdin.Close(); err != nil {
+				log.Debug().Err(err).Str("peerID", peerID).Msg("Could not close stdin of command, continuing")
+			}
+		case frameTypeCancel:
+			if !ok {
+				continue
+			}
+
+			p.cancel()
+		default:
+			log.Debug().Str("peerID", peerID).Msg("Got unexpected frame from peer, stopping")
+
+			return
+		}
+	}
+}
+
+// start checks whether a peer may run the requested command and starts it; it returns nil if the command has been rejected
+func (a *Adapter) start(ctx context.Context, peerID string, c *conn, id uint32, req request) (*exec.Cmd, *process) {
+	reject := func(reason error) {
+		log.Debug().Err(reason).Str("peerID", peerID).Str("command", req.Command).Msg("Rejecting run request")
+
+		if err := c.fail(id, reason); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+
+	if _, ok := a.allowed[peerID]; len(a.allowed) > 0 && !ok {
+		reject(ErrPeerNotAllowed)
+
+		return nil, nil
+	}
+
+	argv, ok := a.config.Commands[req.Command]
+	if !ok || len(argv) <= 0 {
+		reject(ErrCommandNotAllowed)
+
+		return nil, nil
+	}
+
+	if len(req.Args) > 0 && !a.config.Arguments {
+		reject(ErrArgumentsNotAllowed)
+
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	cmd := exec.CommandContext(ctx, argv[0], append(append([]string{}, argv[1:]...), req.Args...)...)
+	cmd.Stdout = newFrameWriter(c, id, frameTypeStdout)
+	cmd.Stderr = newFrameWriter(c, id, frameTypeStderr)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		reject(err)
+
+		return nil, nil
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		reject(err)
+
+		return nil, nil
+	}
+
+	log.Info().Str("peerID", peerID).Str("command", req.Command).Strs("args", req.Args).Msg("Running command")
+
+	return cmd, &process{stdin, cancel}
+}
+
+// wait waits for a command to exit and sends its exit code to the peer
+func (a *Adapter) wait(peerID string, c *conn, id uint32, req request, cmd *exec.Cmd, p *process) {
+	defer p.cancel()
+
+	code := 0
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			log.Debug().Err(err).Str("peerID", peerID).Str("command", req.Command).Msg("Could not wait for command, stopping")
+
+			if err := c.fail(id, err); err != nil {
+				log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, stopping")
+			}
+
+			return
+		}
+
+		code = exitErr.ExitCode()
+	}
+
+	log.Info().Str("peerID", peerID).Str("command", req.Command).Int("code", code).Msg("Command exited")
+
+	if err := c.exit(id, code); err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write exit code to peer, stopping")
+	}
+}
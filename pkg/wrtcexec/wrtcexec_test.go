@@ -0,0 +1,125 @@
+package wrtcexec_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcexec"
+	"github.com/pojntfx/weron/pkg/wrtctest"
+)
+
+const (
+	execCommunity = "exec"
+	execTimeout   = time.Second * 30
+)
+
+func newAdapter(t *testing.T, signaler *wrtctest.Signaler, config *wrtcexec.AdapterConfig, ctx context.Context) (*wrtcexec.Adapter, chan string) {
+	t.Helper()
+
+	ids := make(chan string, 1)
+
+	config.AdapterConfig = &wrtcconn.AdapterConfig{
+		Timeout:         time.Second * 10,
+		IncludeLoopback: true,
+	}
+	config.OnSignalerConnect = func(id string) {
+		ids <- id
+	}
+
+	adapter := wrtcexec.NewAdapter(signaler.URL(execCommunity), wrtctest.Key, []string{}, config, ctx)
+	if err := adapter.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := adapter.Wait(); err != nil {
+			t.Log(err)
+		}
+	}()
+
+	return adapter, ids
+}
+
+// TestRunMultipleCommands runs several commands on the same server, both in a row and concurrently, over the same data channel
+func TestRunMultipleCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	signaler := wrtctest.NewSignaler(nil, ctx)
+	if err := signaler.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer signaler.Close()
+
+	server, serverIDs := newAdapter(t, signaler, &wrtcexec.AdapterConfig{
+		Server: true,
+		Commands: map[string][]string{
+			"hello": {"echo", "hello"},
+			"cat":   {"cat"},
+			"fail":  {"sh", "-c", "exit 3"},
+		},
+	}, ctx)
+	defer server.Close()
+
+	var serverID string
+	select {
+	case serverID = <-serverIDs:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for server to join")
+	}
+
+	client, _ := newAdapter(t, signaler, &wrtcexec.AdapterConfig{}, ctx)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		stdout := &bytes.Buffer{}
+		code, err := client.Run(ctx, serverID, "hello", nil, nil, stdout, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != 0 {
+			t.Fatalf("got exit code %v, want 0", code)
+		}
+
+		if got := stdout.String(); got != "hello\n" {
+			t.Fatalf("got output %q for command %v, want %q", got, i, "hello\n")
+		}
+	}
+
+	if code, err := client.Run(ctx, serverID, "fail", nil, nil, &bytes.Buffer{}, &bytes.Buffer{}); err != nil || code != 3 {
+		t.Fatalf("got exit code %v and error %v, want 3", code, err)
+	}
+
+	if _, err := client.Run(ctx, serverID, "unknown", nil, nil, &bytes.Buffer{}, &bytes.Buffer{}); err == nil || err.Error() != wrtcexec.ErrCommandNotAllowed.Error() {
+		t.Fatalf("got error %v, want %v", err, wrtcexec.ErrCommandNotAllowed)
+	}
+
+	var wg sync.WaitGroup
+	inputs := []string{"first", "second", "third"}
+	for _, input := range inputs {
+		wg.Add(1)
+
+		go func(input string) {
+			defer wg.Done()
+
+			stdout := &bytes.Buffer{}
+			if _, err := client.Run(ctx, serverID, "cat", nil, strings.NewReader(input), stdout, &bytes.Buffer{}); err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if got := stdout.String(); got != input {
+				t.Errorf("got output %q, want %q", got, input)
+			}
+		}(input)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,197 @@
+package wrtcexp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/pojntfx/weron/internal/framing"
+)
+
+const (
+	frameHeaderLength = 5 // Length of the stream ID and frame type
+
+	frameTypeRequestData   byte = 0 // Data sent by the peer which opened the stream
+	frameTypeRequestClose  byte = 1 // The peer which opened the stream has finished writing
+	frameTypeResponseData  byte = 2 // Data sent by the peer which accepted the stream
+	frameTypeResponseClose byte = 3 // The peer which accepted the stream has finished writing
+)
+
+var (
+	errSessionClosed = errors.New("session closed")
+)
+
+// session multiplexes streams over a single data channel
+type session struct {
+	conn *framing.Conn
+
+	streamsLock  sync.Mutex
+	nextID       uint32
+	lastAccepted uint32
+	opened       map[uint32]*stream
+	accepted     map[uint32]*stream
+}
+
+// stream is a bidirectional byte stream inside a session
+type stream struct {
+	*io.PipeReader
+
+	session  *session
+	id       uint32
+	opener   bool
+	pw       *io.PipeWriter
+	doneOnce sync.Once
+}
+
+func newSession(conn io.ReadWriteCloser) *session {
+	return &session{
+		conn: framing.NewConn(conn, frameHeaderLength),
+
+		opened:   map[uint32]*stream{},
+		accepted: map[uint32]*stream{},
+	}
+}
+
+func (s *session) newStream(id uint32, opener bool) *stream {
+	pr, pw := io.Pipe()
+
+	return &stream{
+		PipeReader: pr,
+
+		session: s,
+		id:      id,
+		opener:  opener,
+		pw:      pw,
+	}
+}
+
+// open creates a new outgoing stream
+func (s *session) open() *stream {
+	s.streamsLock.Lock()
+	defer s.streamsLock.Unlock()
+
+	s.nextID++
+	st := s.newStream(s.nextID, true)
+	s.opened[st.id] = st
+
+	return st
+}
+
+// serve dispatches incoming frames to their streams and calls onAccept for new incoming streams
+func (s *session) serve(onAccept func(*stream)) error {
+	defer s.closeStreams()
+
+	for {
+		header, payload, err := s.conn.ReadFrame()
+		if err != nil {
+			if err == framing.ErrInvalidFrame {
+				continue
+			}
+
+			return err
+		}
+
+		id := binary.BigEndian.Uint32(header[:4])
+		frameType := header[4]
+
+		s.streamsLock.Lock()
+		var st *stream
+		switch frameType {
+		case frameTypeRequestData, frameTypeRequestClose:
+			var ok bool
+			st, ok = s.accepted[id]
+			// Stream IDs are increasing, so lower IDs belong to streams which have already been closed
+			if !ok && frameType == frameTypeRequestData && id > s.lastAccepted {
+				s.lastAccepted = id
+
+				st = s.newStream(id, false)
+				s.accepted[id] = st
+
+				go onAccept(st)
+			}
+		case frameTypeResponseData, frameTypeResponseClose:
+			st = s.opened[id]
+		}
+		s.streamsLock.Unlock()
+
+		// Frames for unknown or already closed streams are dropped
+		if st == nil {
+			continue
+		}
+
+		switch frameType {
+		case frameTypeRequestData, frameTypeResponseData:
+			// Writing to the pipe blocks until the stream has been read, so the payload can be re-used afterwards
+			if _, err := st.pw.Write(payload); err != nil {
+				continue
+			}
+		default:
+			_ = st.pw.Close()
+		}
+	}
+}
+
+func getHeader(id uint32, frameType byte) []byte {
+	header := make([]byte, frameHeaderLength)
+	binary.BigEndian.PutUint32(header[:4], id)
+	header[4] = frameType
+
+	return header
+}
+
+func (s *session) writeFrame(id uint32, frameType byte, p []byte) error {
+	return s.conn.WriteFrame(getHeader(id, frameType), p)
+}
+
+func (s *session) closeStreams() {
+	s.streamsLock.Lock()
+	defer s.streamsLock.Unlock()
+
+	for id, st := range s.opened {
+		_ = st.pw.CloseWithError(errSessionClosed)
+
+		delete(s.opened, id)
+	}
+
+	for id, st := range s.accepted {
+		_ = st.pw.CloseWithError(errSessionClosed)
+
+		delete(s.accepted, id)
+	}
+}
+
+// Write sends data to the remote end of the stream
+func (st *stream) Write(p []byte) (int, error) {
+	frameType := frameTypeResponseData
+	if st.opener {
+		frameType = frameTypeRequestData
+	}
+
+	return st.session.conn.WriteFrames(getHeader(st.id, frameType), p)
+}
+
+// CloseWrite signals the remote end that no more data will be written
+func (st *stream) CloseWrite() error {
+	frameType := frameTypeResponseClose
+	if st.opener {
+		frameType = frameTypeRequestClose
+	}
+
+	return st.session.writeFrame(st.id, frameType, nil)
+}
+
+// Close stops reading from the stream and forgets about it
+func (st *stream) Close() error {
+	st.doneOnce.Do(func() {
+		st.session.streamsLock.Lock()
+		if st.opener {
+			delete(st.session.opened, st.id)
+		} else {
+			delete(st.session.accepted, st.id)
+		}
+		st.session.streamsLock.Unlock()
+	})
+
+	return st.PipeReader.Close()
+}
@@ -0,0 +1,391 @@
+package wrtcexp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnknownHost = errors.New("no peer is exposing this host") // No peer has claimed or announced the host of the request
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.NamedAdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	Upstream           string       // URL of the local HTTP service to expose under the claimed name (i.e. http://localhost:8080) (only required for peers which expose a service)
+	Ingress            string       // Listening address for public HTTP requests (i.e. :8080) (only required for ingress peers)
+	TLSCertFile        string       // Path to the TLS certificate to serve HTTPS with on the ingress address (HTTP is served if empty)
+	TLSKeyFile         string       // Path to the TLS key to serve HTTPS with on the ingress address (HTTP is served if empty)
+}
+
+// Adapter provides an HTTP reverse proxy service; peers claim a hostname as their name and may announce additional hostnames as services (see wrtcconn.AdapterConfig.Services), and ingress peers route requests by host to them
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel   context.CancelFunc
+	adapter  *wrtcconn.NamedAdapter
+	upstream *url.URL
+	proxy    *httputil.ReverseProxy
+	srv      *http.Server
+
+	ids  chan string
+	errs chan error
+
+	sessionsLock sync.Mutex
+	sessions     map[string]*session
+	next         int // Index of the next peer to route requests for a host which multiple peers have announced to
+
+	registry *wrtcconn.Registry
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	a := &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids:  make(chan string),
+		errs: make(chan error),
+
+		sessions: map[string]*session{},
+
+		registry: wrtcconn.NewRegistry(),
+	}
+
+	a.proxy = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = r.Host
+		},
+		Transport: a,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Debug().Err(err).Str("host", r.Host).Msg("Could not proxy request, continuing")
+
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+
+	return a
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	if strings.TrimSpace(a.config.Upstream) != "" {
+		var err error
+		a.upstream, err = url.Parse(a.config.Upstream)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.adapter = wrtcconn.NewNamedAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.ExposePrimary},
+		a.config.NamedAdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(a.config.Ingress) != "" {
+		a.srv = &http.Server{
+			Addr:    a.config.Ingress,
+			Handler: a,
+		}
+
+		go func() {
+			var err error
+			if strings.TrimSpace(a.config.TLSCertFile) != "" && strings.TrimSpace(a.config.TLSKeyFile) != "" {
+				err = a.srv.ListenAndServeTLS(a.config.TLSCertFile, a.config.TLSKeyFile)
+			} else {
+				err = a.srv.ListenAndServe()
+			}
+
+			if err != nil && err != http.ErrServerClosed {
+				a.errs <- err
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Close stops listening and disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	if a.srv != nil {
+		if err := a.srv.Shutdown(a.ctx); err != nil {
+			return err
+		}
+	}
+
+	return a.adapter.Close()
+}
+
+// Wait starts handling peers
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case err := <-a.errs:
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			s := newSession(peer.Conn)
+
+			if err := a.registry.Add(peer.PeerID, peer.Metadata); err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not parse services of peer, continuing")
+			}
+
+			a.sessionsLock.Lock()
+			a.sessions[peer.PeerID] = s
+			a.sessionsLock.Unlock()
+
+			go func() {
+				defer func() {
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+
+					a.sessionsLock.Lock()
+					if a.sessions[peer.PeerID] == s {
+						delete(a.sessions, peer.PeerID)
+
+						a.registry.Remove(peer.PeerID)
+					}
+					a.sessionsLock.Unlock()
+				}()
+
+				if err := s.serve(func(st *stream) {
+					a.handleStream(peer.PeerID, st)
+				}); err != nil {
+					log.Debug().
+						Err(err).
+						Str("channelID", peer.ChannelID).
+						Str("peerID", peer.PeerID).
+						Msg("Could not read from peer, stopping")
+				}
+			}()
+		}
+	}
+}
+
+// ServeHTTP routes a request to the peer which has claimed or announced its host
+func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.proxy.ServeHTTP(w, r)
+}
+
+// RoundTrip sends a request to the peer which has claimed its host and returns the peer's response; if no peer has claimed the host, requests are distributed across the peers which have announced it
+func (a *Adapter) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := r.URL.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	s, ok := a.getSession(host)
+	if !ok {
+		return nil, ErrUnknownHost
+	}
+
+	st := s.open()
+
+	go func() {
+		if err := r.Write(st); err != nil {
+			log.Debug().Err(err).Str("host", host).Msg("Could not write request to peer, stopping")
+
+			_ = st.Close()
+
+			return
+		}
+
+		if err := st.CloseWrite(); err != nil {
+			log.Debug().Err(err).Str("host", host).Msg("Could not close request stream, continuing")
+		}
+	}()
+
+	res, err := http.ReadResponse(bufio.NewReader(st), r)
+	if err != nil {
+		_ = st.Close()
+
+		return nil, err
+	}
+
+	res.Body = &streamBody{res.Body, st}
+
+	return res, nil
+}
+
+// getSession returns the session of the peer which has claimed a host or, if there is none, of one of the peers which have announced it
+func (a *Adapter) getSession(host string) (*session, bool) {
+	a.sessionsLock.Lock()
+	defer a.sessionsLock.Unlock()
+
+	if s, ok := a.sessions[host]; ok {
+		return s, true
+	}
+
+	candidates := []*session{}
+	for _, service := range a.registry.Lookup(host) {
+		if s, ok := a.sessions[service.PeerID]; ok && service.Channel == services.ExposePrimary {
+			candidates = append(candidates, s)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, false
+	}
+
+	a.next++
+
+	return candidates[a.next%len(candidates)], true
+}
+
+// Services returns the registry of the hostnames which the connected peers have announced
+func (a *Adapter) Services() *wrtcconn.Registry {
+	return a.registry
+}
+
+// handleStream forwards a request received from a peer to the upstream service
+func (a *Adapter) handleStream(peerID string, st *stream) {
+	defer st.Close()
+
+	r, err := http.ReadRequest(bufio.NewReader(st))
+	if err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Msg("Could not read request from peer, stopping")
+
+		return
+	}
+
+	var res *http.Response
+	if a.upstream == nil {
+		res = newErrorResponse(r, http.StatusNotFound, ErrUnknownHost)
+	} else {
+		// Keep the original host header, so that name-based virtual hosts continue to work
+		r.URL.Scheme = a.upstream.Scheme
+		r.URL.Host = a.upstream.Host
+		r.RequestURI = ""
+
+		res, err = http.DefaultTransport.RoundTrip(r.WithContext(a.ctx))
+		if err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Str("upstream", a.upstream.String()).Msg("Could not forward request to upstream, continuing")
+
+			res = newErrorResponse(r, http.StatusBadGateway, err)
+		}
+	}
+	defer res.Body.Close()
+
+	log.Debug().
+		Str("peerID", peerID).
+		Str("method", r.Method).
+		Str("host", r.Host).
+		Str("path", r.URL.Path).
+		Int("status", res.StatusCode).
+		Msg("Handled request")
+
+	if err := res.Write(st); err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write response to peer, stopping")
+
+		return
+	}
+
+	if err := st.CloseWrite(); err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Msg("Could not close response stream, continuing")
+	}
+}
+
+func newErrorResponse(r *http.Request, status int, err error) *http.Response {
+	body := fmt.Sprintf("%v\n", err)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// streamBody closes the underlying stream once a response body has been read
+type streamBody struct {
+	io.ReadCloser
+
+	st *stream
+}
+
+func (b *streamBody) Close() error {
+	_ = b.st.Close()
+
+	return b.ReadCloser.Close()
+}
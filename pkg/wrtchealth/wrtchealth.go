@@ -0,0 +1,106 @@
+package wrtchealth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	HealthPath = "/healthz" // Path of the liveness endpoint, which succeeds as long as the daemon is serving requests
+	ReadyPath  = "/readyz"  // Path of the readiness endpoint, which only succeeds once all conditions are met
+
+	ConditionSignaler  = "signaler"  // The adapter is connected to the signaler
+	ConditionDevice    = "device"    // The TUN or TAP device has been created
+	ConditionListening = "listening" // The daemon is listening for connections
+)
+
+// Checker tracks the conditions which have to be met before a daemon is ready; all methods are safe to call on a nil checker, so that health checks can be disabled without extra checks
+type Checker struct {
+	lock       sync.Mutex
+	conditions map[string]bool
+}
+
+// NewChecker creates the checker; all conditions are initially unmet
+func NewChecker(conditions ...string) *Checker {
+	c := &Checker{
+		conditions: map[string]bool{},
+	}
+
+	for _, condition := range conditions {
+		c.conditions[condition] = false
+	}
+
+	return c
+}
+
+// Set marks a condition as met or unmet
+func (c *Checker) Set(condition string, met bool) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.conditions[condition] = met
+}
+
+// Pending returns the conditions which are unmet
+func (c *Checker) Pending() []string {
+	pending := []string{}
+	if c == nil {
+		return pending
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for condition, met := range c.conditions {
+		if !met {
+			pending = append(pending, condition)
+		}
+	}
+
+	sort.Strings(pending)
+
+	return pending
+}
+
+// Ready returns whether all conditions are met
+func (c *Checker) Ready() bool {
+	return len(c.Pending()) == 0
+}
+
+// ServeHTTP answers liveness requests with 200 and readiness requests with 200 if all conditions are met or 503 and the unmet conditions otherwise
+func (c *Checker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+
+	if strings.TrimSuffix(r.URL.Path, "/") == ReadyPath {
+		if pending := c.Pending(); len(pending) > 0 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+
+			_, _ = fmt.Fprintf(rw, "not ready: %v\n", strings.Join(pending, ", "))
+
+			return
+		}
+	}
+
+	_, _ = fmt.Fprintln(rw, "ok")
+}
+
+// IsCheck returns whether a request is for the liveness or readiness endpoint
+func IsCheck(r *http.Request) bool {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	return path == HealthPath || path == ReadyPath
+}
+
+// Register adds the liveness and readiness endpoints to a mux
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.Handle(HealthPath, c)
+	mux.Handle(ReadyPath, c)
+}
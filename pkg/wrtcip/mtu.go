@@ -0,0 +1,75 @@
+package wrtcip
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// adaptiveMTU sets the MTU of the TUN device to the lowest MTU which is recommended for the connections to peers, so that packets are split into as few SCTP chunks as possible on lossy links
+type adaptiveMTU struct {
+	lock    sync.Mutex
+	device  string
+	max     int
+	current int
+	peers   map[string]int
+}
+
+func newAdaptiveMTU() *adaptiveMTU {
+	return &adaptiveMTU{
+		peers: map[string]int{},
+	}
+}
+
+// open starts adapting the MTU of a device; max is its configured MTU, which the MTU is never raised above
+func (m *adaptiveMTU) open(device string, max int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.device = device
+	m.max = max
+	m.current = max
+
+	m.apply()
+}
+
+// update sets the recommended MTU for a peer (0 if packets of any size can be sent to it)
+func (m *adaptiveMTU) update(peerID string, mtu int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if mtu <= 0 {
+		delete(m.peers, peerID)
+	} else {
+		m.peers[peerID] = mtu
+	}
+
+	m.apply()
+}
+
+func (m *adaptiveMTU) apply() {
+	if m.device == "" {
+		return
+	}
+
+	mtu := m.max
+	for _, recommended := range m.peers {
+		if recommended < mtu {
+			mtu = recommended
+		}
+	}
+
+	if mtu == m.current {
+		return
+	}
+
+	if err := setMTU(m.device, mtu); err != nil {
+		log.Debug().Err(err).Str("device", m.device).Int("mtu", mtu).Msg("Could not set MTU of TUN device, continuing")
+
+		return
+	}
+
+	log.Debug().Str("device", m.device).Int("mtu", mtu).Int("previous", m.current).Msg("Adapted MTU of TUN device to connection quality")
+
+	m.current = mtu
+}
@@ -36,6 +36,15 @@ func getMTU(linkName string) (int, error) {
 	return iface.MTU, nil
 }
 
+func setMTU(linkName string, mtu int) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return err
+	}
+
+	return netlink.LinkSetMTU(link, mtu)
+}
+
 func setLinkUp(linkName string) error {
 	link, err := netlink.LinkByName(linkName)
 	if err != nil {
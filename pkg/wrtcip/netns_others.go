@@ -40,6 +40,15 @@ func getMTU(linkName string) (int, error) {
 	return iface.MTU, nil
 }
 
+func setMTU(linkName string, mtu int) error {
+	output, err := exec.Command("ifconfig", linkName, "mtu", fmt.Sprintf("%v", mtu)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not set MTU of interface: %v: %v", string(output), err)
+	}
+
+	return nil
+}
+
 func setLinkUp(linkName string) error {
 	return nil
 }
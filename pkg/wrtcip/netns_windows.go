@@ -37,6 +37,17 @@ func getMTU(linkName string) (int, error) {
 	return iface.MTU, nil
 }
 
+func setMTU(linkName string, mtu int) error {
+	for _, family := range []string{"ipv4", "ipv6"} {
+		output, err := exec.Command("netsh", "interface", family, "set", "subinterface", linkName, fmt.Sprintf("mtu=%v", mtu), "store=active").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("could not set MTU of interface: %v: %v", string(output), err)
+		}
+	}
+
+	return nil
+}
+
 func setLinkUp(linkName string) error {
 	return nil
 }
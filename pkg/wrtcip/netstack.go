@@ -0,0 +1,289 @@
+//go:build netstack
+// +build netstack
+
+package wrtcip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const (
+	netstackName        = "netstack" // Name of the userspace network stack
+	netstackNIC         = 1          // ID of the only NIC of the userspace network stack
+	netstackQueueLength = 1024       // Amount of outgoing packets to queue in the userspace network stack
+)
+
+// netstackDevice is a userspace network stack which terminates TCP and UDP in-process instead of handing packets to the kernel
+type netstackDevice struct {
+	stack *stack.Stack
+	ep    *channel.Endpoint
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newNetstackDevice() (*netstackDevice, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol4, icmp.NewProtocol6},
+		HandleLocal:        true,
+	})
+
+	ep := channel.New(netstackQueueLength, netstackMTU, "")
+	if err := s.CreateNIC(netstackNIC, ep); err != nil {
+		s.Close()
+
+		return nil, errors.New(err.String())
+	}
+
+	// Packets to all networks are written to peers, which are selected by the routing table of the adapter
+	s.SetRouteTable([]tcpip.Route{
+		{
+			Destination: header.IPv4EmptySubnet,
+			NIC:         netstackNIC,
+		},
+		{
+			Destination: header.IPv6EmptySubnet,
+			NIC:         netstackNIC,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &netstackDevice{
+		stack: s,
+		ep:    ep,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (d *netstackDevice) Name() string {
+	return netstackName
+}
+
+func (d *netstackDevice) ReadPackets(size int) ([][]byte, error) {
+	pkt := d.ep.ReadContext(d.ctx)
+	if pkt == nil {
+		return nil, os.ErrClosed
+	}
+	defer pkt.DecRef()
+
+	view := pkt.ToView()
+	defer view.Release()
+
+	buf := view.AsSlice()
+	if len(buf) > size {
+		buf = buf[:size]
+	}
+
+	return [][]byte{append([]byte{}, buf...)}, nil
+}
+
+func (d *netstackDevice) Write(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, ErrInvalidPacket
+	}
+
+	var protocol tcpip.NetworkProtocolNumber
+	switch header.IPVersion(packet) {
+	case header.IPv4Version:
+		protocol = header.IPv4ProtocolNumber
+	case header.IPv6Version:
+		protocol = header.IPv6ProtocolNumber
+	default:
+		return 0, ErrInvalidPacket
+	}
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(packet),
+	})
+	defer pkt.DecRef()
+
+	d.ep.InjectInbound(protocol, pkt)
+
+	return len(packet), nil
+}
+
+func (d *netstackDevice) Close() error {
+	d.cancel()
+
+	d.ep.Close()
+	d.stack.Close()
+
+	return nil
+}
+
+// addAddress adds an IP address in CIDR notation to the NIC
+func (d *netstackDevice) addAddress(rawIP string) error {
+	prefix, err := netip.ParsePrefix(rawIP)
+	if err != nil {
+		return err
+	}
+
+	protocol := header.IPv6ProtocolNumber
+	if prefix.Addr().Is4() {
+		protocol = header.IPv4ProtocolNumber
+	}
+
+	if err := d.stack.AddProtocolAddress(netstackNIC, tcpip.ProtocolAddress{
+		Protocol: protocol,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFromSlice(prefix.Addr().AsSlice()),
+			PrefixLen: prefix.Bits(),
+		},
+	}, stack.AddressProperties{}); err != nil {
+		// Addresses are added again when the adapter reconnects to the signaler
+		if _, ok := err.(*tcpip.ErrDuplicateAddress); ok {
+			return nil
+		}
+
+		return errors.New(err.String())
+	}
+
+	return nil
+}
+
+// getFullAddress parses an address in the format host:port, where the host must be an IP address (the unspecified address if empty)
+func getFullAddress(network string, address string) (tcpip.FullAddress, tcpip.NetworkProtocolNumber, error) {
+	host, rawPort, err := net.SplitHostPort(address)
+	if err != nil {
+		return tcpip.FullAddress{}, 0, err
+	}
+
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil {
+		return tcpip.FullAddress{}, 0, err
+	}
+
+	addr := tcpip.FullAddress{
+		Port: uint16(port),
+	}
+
+	if host == "" {
+		// IPv6 endpoints also accept IPv4 connections
+		if network == "tcp4" || network == "udp4" {
+			return addr, header.IPv4ProtocolNumber, nil
+		}
+
+		return addr, header.IPv6ProtocolNumber, nil
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return tcpip.FullAddress{}, 0, err
+	}
+	ip = ip.Unmap()
+
+	addr.Addr = tcpip.AddrFromSlice(ip.AsSlice())
+
+	if ip.Is4() {
+		return addr, header.IPv4ProtocolNumber, nil
+	}
+
+	return addr, header.IPv6ProtocolNumber, nil
+}
+
+// DialContext connects to an address on the overlay network (the network must be tcp, tcp4, tcp6, udp, udp4 or udp6; the host must be an IP address) (only supported in userspace mode)
+func (a *Adapter) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if a.netstack == nil {
+		return nil, ErrNotUserspace
+	}
+
+	addr, protocol, err := getFullAddress(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		conn, err := gonet.DialContextTCP(ctx, a.netstack.stack, addr, protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn, nil
+	case "udp", "udp4", "udp6":
+		conn, err := gonet.DialUDP(a.netstack.stack, nil, &addr, protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn, nil
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+}
+
+// Dial connects to an address on the overlay network (see DialContext)
+func (a *Adapter) Dial(network string, address string) (net.Conn, error) {
+	return a.DialContext(context.Background(), network, address)
+}
+
+// Listen listens for TCP connections from the overlay network (the network must be tcp, tcp4 or tcp6; the host must be empty or an IP address) (only supported in userspace mode)
+func (a *Adapter) Listen(network string, address string) (net.Listener, error) {
+	if a.netstack == nil {
+		return nil, ErrNotUserspace
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	addr, protocol, err := getFullAddress(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := gonet.ListenTCP(a.netstack.stack, addr, protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// ListenPacket listens for UDP packets from the overlay network (the network must be udp, udp4 or udp6; the host must be empty or an IP address) (only supported in userspace mode)
+func (a *Adapter) ListenPacket(network string, address string) (net.PacketConn, error) {
+	if a.netstack == nil {
+		return nil, ErrNotUserspace
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	addr, protocol, err := getFullAddress(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := gonet.DialUDP(a.netstack.stack, &addr, nil, protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,42 @@
+//go:build !netstack
+// +build !netstack
+
+package wrtcip
+
+import (
+	"context"
+	"net"
+)
+
+// netstackDevice is a placeholder for the userspace network stack, which is only compiled in with the netstack tag so that gVisor isn't linked into every build
+type netstackDevice struct {
+	device
+}
+
+func newNetstackDevice() (*netstackDevice, error) {
+	return nil, ErrUserspaceUnsupported
+}
+
+func (d *netstackDevice) addAddress(rawIP string) error {
+	return ErrUserspaceUnsupported
+}
+
+// DialContext connects to an address on the overlay network (only supported in userspace mode)
+func (a *Adapter) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	return nil, ErrNotUserspace
+}
+
+// Dial connects to an address on the overlay network (see DialContext)
+func (a *Adapter) Dial(network string, address string) (net.Conn, error) {
+	return a.DialContext(context.Background(), network, address)
+}
+
+// Listen listens for TCP connections from the overlay network (only supported in userspace mode)
+func (a *Adapter) Listen(network string, address string) (net.Listener, error) {
+	return nil, ErrNotUserspace
+}
+
+// ListenPacket listens for UDP packets from the overlay network (only supported in userspace mode)
+func (a *Adapter) ListenPacket(network string, address string) (net.PacketConn, error) {
+	return nil, ErrNotUserspace
+}
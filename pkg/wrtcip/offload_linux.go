@@ -0,0 +1,261 @@
+package wrtcip
+
+import (
+	"encoding/binary"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// See https://github.com/torvalds/linux/blob/master/include/uapi/linux/virtio_net.h and https://github.com/torvalds/linux/blob/master/include/uapi/linux/if_tun.h
+const (
+	virtioNetHdrLen = 10
+
+	virtioNetHdrFNeedsCsum = 0x01
+
+	virtioNetHdrGSONone  = 0x00
+	virtioNetHdrGSOTCPv4 = 0x01
+	virtioNetHdrGSOTCPv6 = 0x04
+	virtioNetHdrGSOECN   = 0x80
+
+	tunFCsum   = 0x01
+	tunFTSO4   = 0x02
+	tunFTSO6   = 0x04
+	tunFTSOECN = 0x08
+
+	tcpFlagFIN = 0x01
+	tcpFlagPSH = 0x08
+	tcpFlagCWR = 0x80
+
+	maxOffloadPacketSize = 65535
+)
+
+// virtioNetHdr is the header which the kernel prepends to packets on TUN devices with IFF_VNET_HDR
+type virtioNetHdr struct {
+	flags      uint8
+	gsoType    uint8
+	hdrLen     uint16
+	gsoSize    uint16
+	csumStart  uint16
+	csumOffset uint16
+}
+
+// offloadDevice is a TUN device which reads TCP segments of up to 64 KiB per syscall and splits them into packets
+type offloadDevice struct {
+	file *os.File
+	name string
+	buf  []byte
+	hdr  [virtioNetHdrLen]byte
+}
+
+func newOffloadDevice(name string) (device, error) {
+	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	ifr.SetUint16(unix.IFF_TUN | unix.IFF_NO_PI | unix.IFF_VNET_HDR)
+	if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	if err := unix.IoctlSetInt(fd, unix.TUNSETOFFLOAD, tunFCsum|tunFTSO4|tunFTSO6|tunFTSOECN); err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	// Non-blocking file descriptors use the runtime's poller, which allows closing the device while it is being read from
+	if err := unix.SetNonblock(fd, true); err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	return &offloadDevice{
+		file: os.NewFile(uintptr(fd), "/dev/net/tun"),
+		name: ifr.Name(),
+		buf:  make([]byte, virtioNetHdrLen+maxOffloadPacketSize),
+	}, nil
+}
+
+func (d *offloadDevice) Name() string {
+	return d.name
+}
+
+func (d *offloadDevice) Close() error {
+	return d.file.Close()
+}
+
+func (d *offloadDevice) ReadPackets(size int) ([][]byte, error) {
+	n, err := d.file.Read(d.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < virtioNetHdrLen {
+		return nil, ErrInvalidOffloadPacket
+	}
+
+	hdr := virtioNetHdr{
+		flags:      d.buf[0],
+		gsoType:    d.buf[1],
+		hdrLen:     binary.LittleEndian.Uint16(d.buf[2:]),
+		gsoSize:    binary.LittleEndian.Uint16(d.buf[4:]),
+		csumStart:  binary.LittleEndian.Uint16(d.buf[6:]),
+		csumOffset: binary.LittleEndian.Uint16(d.buf[8:]),
+	}
+
+	return splitPacket(hdr, d.buf[virtioNetHdrLen:n])
+}
+
+func (d *offloadDevice) Write(packet []byte) (int, error) {
+	conn, err := d.file.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	// Packets are written without offloads, which only requires an empty header in front of them
+	n := 0
+	var werr error
+	if err := conn.Write(func(fd uintptr) bool {
+		n, werr = unix.Writev(int(fd), [][]byte{d.hdr[:], packet})
+
+		return werr != unix.EAGAIN
+	}); err != nil {
+		return 0, err
+	}
+
+	if werr != nil {
+		return 0, werr
+	}
+
+	return n - virtioNetHdrLen, nil
+}
+
+// splitPacket completes the checksum of a packet or splits a TCP segment into packets of the segment size
+func splitPacket(hdr virtioNetHdr, in []byte) ([][]byte, error) {
+	switch hdr.gsoType &^ virtioNetHdrGSOECN {
+	case virtioNetHdrGSONone:
+		packet := make([]byte, len(in))
+		copy(packet, in)
+
+		if hdr.flags&virtioNetHdrFNeedsCsum != 0 {
+			csumAt := int(hdr.csumStart) + int(hdr.csumOffset)
+			if csumAt+2 > len(packet) {
+				return nil, ErrInvalidOffloadPacket
+			}
+
+			// The checksum field contains the sum of the pseudo header, which has to be included
+			initial := binary.BigEndian.Uint16(packet[csumAt:])
+			packet[csumAt], packet[csumAt+1] = 0, 0
+
+			binary.BigEndian.PutUint16(packet[csumAt:], ^checksum(packet[hdr.csumStart:], uint64(initial)))
+		}
+
+		return [][]byte{packet}, nil
+	case virtioNetHdrGSOTCPv4, virtioNetHdrGSOTCPv6:
+	default:
+		return nil, ErrInvalidOffloadPacket
+	}
+
+	ipv4 := hdr.gsoType&^virtioNetHdrGSOECN == virtioNetHdrGSOTCPv4
+
+	// The header length reported by the kernel can't be relied upon, so it is calculated from the packet
+	l4 := int(hdr.csumStart)
+	if l4+20 > len(in) || hdr.gsoSize == 0 {
+		return nil, ErrInvalidOffloadPacket
+	}
+
+	hdrLen := l4 + int(in[l4+12]>>4)*4
+	if hdrLen > len(in) {
+		return nil, ErrInvalidOffloadPacket
+	}
+
+	var addrs []byte
+	if ipv4 {
+		if l4 < 20 {
+			return nil, ErrInvalidOffloadPacket
+		}
+
+		addrs = in[12:20]
+	} else {
+		if l4 < 40 {
+			return nil, ErrInvalidOffloadPacket
+		}
+
+		addrs = in[8:40]
+	}
+
+	id := binary.BigEndian.Uint16(in[4:])
+	seq := binary.BigEndian.Uint32(in[l4+4:])
+	payload := in[hdrLen:]
+	gsoSize := int(hdr.gsoSize)
+
+	packets := [][]byte{}
+	for i, offset := 0, 0; offset < len(payload); i, offset = i+1, offset+gsoSize {
+		end := offset + gsoSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		packet := make([]byte, hdrLen+end-offset)
+		copy(packet, in[:hdrLen])
+		copy(packet[hdrLen:], payload[offset:end])
+
+		if ipv4 {
+			binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+			binary.BigEndian.PutUint16(packet[4:], id+uint16(i))
+
+			packet[10], packet[11] = 0, 0
+			binary.BigEndian.PutUint16(packet[10:], ^checksum(packet[:l4], 0))
+		} else {
+			binary.BigEndian.PutUint16(packet[4:], uint16(len(packet)-40))
+		}
+
+		binary.BigEndian.PutUint32(packet[l4+4:], seq+uint32(offset))
+
+		// CWR is only set on the first segment, FIN and PSH only on the last one
+		if i > 0 {
+			packet[l4+13] &^= tcpFlagCWR
+		}
+
+		if end < len(payload) {
+			packet[l4+13] &^= tcpFlagFIN | tcpFlagPSH
+		}
+
+		packet[l4+16], packet[l4+17] = 0, 0
+		binary.BigEndian.PutUint16(packet[l4+16:], ^checksum(packet[l4:], uint64(checksum(addrs, uint64(unix.IPPROTO_TCP)+uint64(len(packet)-l4)))))
+
+		packets = append(packets, packet)
+	}
+
+	return packets, nil
+}
+
+// checksum calculates the folded one's complement sum of b, starting with initial
+func checksum(b []byte, initial uint64) uint16 {
+	sum := initial
+	for ; len(b) >= 2; b = b[2:] {
+		sum += uint64(binary.BigEndian.Uint16(b))
+	}
+
+	if len(b) == 1 {
+		sum += uint64(b[0]) << 8
+	}
+
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return uint16(sum)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package wrtcip
+
+func newOffloadDevice(name string) (device, error) {
+	return nil, ErrOffloadUnsupported
+}
@@ -0,0 +1,299 @@
+package wrtcip
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidRoute         = errors.New("invalid route, expected format prefix=via or prefix=via@metric") // The specified route can't be parsed
+	ErrInvalidAdvertisement = errors.New("invalid advertisement, expected format prefix or prefix@metric") // The specified advertisement can't be parsed
+)
+
+// Route is a route to a network through a peer
+type Route struct {
+	Prefix netip.Prefix // Network to route
+	Via    netip.Addr   // IP address of the peer in the overlay network to route the network through
+	Metric int          // Priority of the route if multiple routes with the same prefix length exist (lower is preferred)
+}
+
+// ParseRoute parses a route in the format prefix=via or prefix=via@metric (i.e. 192.168.1.0/24=10.0.0.2@100)
+func ParseRoute(s string) (Route, error) {
+	rawPrefix, rawVia, ok := strings.Cut(s, "=")
+	if !ok {
+		return Route{}, ErrInvalidRoute
+	}
+
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(rawPrefix))
+	if err != nil {
+		return Route{}, err
+	}
+
+	rawVia, metric, err := parseMetric(rawVia)
+	if err != nil {
+		return Route{}, err
+	}
+
+	via, err := netip.ParseAddr(strings.TrimSpace(rawVia))
+	if err != nil {
+		return Route{}, err
+	}
+
+	return Route{prefix.Masked(), via, metric}, nil
+}
+
+// ParseAdvertisement parses a network to advertise to peers in the format prefix or prefix@metric (i.e. 192.168.1.0/24@100); the returned route has no gateway
+func ParseAdvertisement(s string) (Route, error) {
+	if strings.Contains(s, "=") {
+		return Route{}, ErrInvalidAdvertisement
+	}
+
+	rawPrefix, metric, err := parseMetric(s)
+	if err != nil {
+		return Route{}, err
+	}
+
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(rawPrefix))
+	if err != nil {
+		return Route{}, err
+	}
+
+	return Route{Prefix: prefix.Masked(), Metric: metric}, nil
+}
+
+func parseMetric(s string) (string, int, error) {
+	rest, rawMetric, ok := strings.Cut(s, "@")
+	if !ok {
+		return rest, 0, nil
+	}
+
+	metric, err := strconv.Atoi(strings.TrimSpace(rawMetric))
+	if err != nil {
+		return "", 0, err
+	}
+
+	return rest, metric, nil
+}
+
+// routingTable selects the peer to send a packet to by longest-prefix match
+type routingTable struct {
+	ecmp bool
+
+	lock   sync.RWMutex
+	routes map[netip.Prefix][]Route
+	peers  map[netip.Addr]*peerWithIP
+}
+
+func newRoutingTable(ecmp bool) *routingTable {
+	return &routingTable{
+		ecmp: ecmp,
+
+		routes: map[netip.Prefix][]Route{},
+		peers:  map[netip.Addr]*peerWithIP{},
+	}
+}
+
+// add adds a route or updates the metric of an existing route
+func (t *routingTable) add(route Route) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	route.Prefix = route.Prefix.Masked()
+
+	routes := t.routes[route.Prefix]
+	for i, candidate := range routes {
+		if candidate.Via == route.Via {
+			routes[i] = route
+
+			return
+		}
+	}
+
+	t.routes[route.Prefix] = append(routes, route)
+}
+
+// remove removes a route; it returns false if the route doesn't exist
+func (t *routingTable) remove(route Route) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	route.Prefix = route.Prefix.Masked()
+
+	routes := t.routes[route.Prefix]
+	for i, candidate := range routes {
+		if candidate.Via == route.Via {
+			routes = append(routes[:i], routes[i+1:]...)
+			if len(routes) == 0 {
+				delete(t.routes, route.Prefix)
+			} else {
+				t.routes[route.Prefix] = routes
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// list returns all routes, sorted by prefix and metric
+func (t *routingTable) list() []Route {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	routes := []Route{}
+	for _, candidates := range t.routes {
+		routes = append(routes, candidates...)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Prefix != routes[j].Prefix {
+			return routes[i].Prefix.String() < routes[j].Prefix.String()
+		}
+
+		return routes[i].Metric < routes[j].Metric
+	})
+
+	return routes
+}
+
+// addPeer makes a peer available as a gateway and adds a host route to it
+func (t *routingTable) addPeer(peer *peerWithIP) {
+	addr, ok := toAddr(peer.ip)
+	if !ok {
+		return
+	}
+
+	t.lock.Lock()
+	t.peers[addr] = peer
+	t.lock.Unlock()
+
+	t.add(Route{netip.PrefixFrom(addr, addr.BitLen()), addr, 0})
+}
+
+// removePeer removes a peer and its host route; routes through the peer are kept but ignored until it reconnects. It returns false if the peer has already been replaced by a new connection.
+func (t *routingTable) removePeer(peer *peerWithIP) bool {
+	addr, ok := toAddr(peer.ip)
+	if !ok {
+		return false
+	}
+
+	t.lock.Lock()
+	current, ok := t.peers[addr]
+	if !ok || current.Peer != peer.Peer {
+		t.lock.Unlock()
+
+		return false
+	}
+
+	delete(t.peers, addr)
+	t.lock.Unlock()
+
+	t.remove(Route{netip.PrefixFrom(addr, addr.BitLen()), addr, 0})
+
+	return true
+}
+
+// connected returns all connected peers, once for each of their IP addresses
+func (t *routingTable) connected() []*peerWithIP {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	peers := []*peerWithIP{}
+	for _, peer := range t.peers {
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
+
+// lookup returns the peer to send a packet of a flow to the destination to or nil if there is no route
+func (t *routingTable) lookup(dst net.IP, flow uint64) *peerWithIP {
+	addr, ok := toAddr(dst)
+	if !ok {
+		return nil
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for bits := addr.BitLen(); bits >= 0; bits-- {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return nil
+		}
+
+		var (
+			best       *peerWithIP
+			bestVia    netip.Addr
+			bestMetric int
+			bestWeight uint64
+		)
+		for _, route := range t.routes[prefix] {
+			// Routes through disconnected peers are skipped so that the standby routes can take over
+			peer, ok := t.peers[route.Via]
+			if !ok {
+				continue
+			}
+
+			if best != nil && route.Metric > bestMetric {
+				continue
+			}
+
+			if best == nil || route.Metric < bestMetric {
+				best, bestVia, bestMetric, bestWeight = peer, route.Via, route.Metric, getRouteWeight(flow, route.Via)
+
+				continue
+			}
+
+			// Flows are distributed between routes with equal metrics by rendezvous hashing, so that only the flows of a failed route move
+			if t.ecmp {
+				if weight := getRouteWeight(flow, route.Via); weight > bestWeight {
+					best, bestVia, bestWeight = peer, route.Via, weight
+				}
+
+				continue
+			}
+
+			// Without ECMP, the same route is always selected for the same set of routes
+			if route.Via.Less(bestVia) {
+				best, bestVia, bestWeight = peer, route.Via, getRouteWeight(flow, route.Via)
+			}
+		}
+
+		if best != nil {
+			return best
+		}
+	}
+
+	return nil
+}
+
+func getRouteWeight(flow uint64, via netip.Addr) uint64 {
+	h := fnv.New64a()
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, flow)
+	_, _ = h.Write(b)
+
+	raw, _ := via.MarshalBinary()
+	_, _ = h.Write(raw)
+
+	return h.Sum64()
+}
+
+func toAddr(ip net.IP) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
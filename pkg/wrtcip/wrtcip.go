@@ -3,43 +3,99 @@ package wrtcip
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"net"
 	"net/netip"
+	"os"
 	"runtime"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/pojntfx/weron/internal/firewall"
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
 	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcaudit"
 	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcpcap"
 	"github.com/songgao/water"
 	"golang.org/x/sync/semaphore"
 )
 
 const (
 	headerLength = 22
+
+	denyReasonQueue = "queue" // The peer's send queue is full
+
+	netstackMTU = 1500 // MTU of the userspace network stack, which is the same as the default MTU of TUN devices
 )
 
 var (
+	ErrOffloadUnsupported   = errors.New("segmentation offload is only supported on Linux")                       // Segmentation offload was requested on an unsupported platform
+	ErrInvalidOffloadPacket = errors.New("invalid packet read from segmentation offload TUN")                     // The virtio-net header of a packet read from the TUN device can't be handled
+	ErrNotUserspace         = errors.New("dialing and listening is only supported in userspace mode")             // Dial or Listen was called on an adapter which uses a TUN device
+	ErrUserspaceConflict    = errors.New("firewall and segmentation offload are not supported in userspace mode") // Firewall or Offload was enabled together with Userspace
+	ErrUserspaceUnsupported = errors.New("userspace mode is only supported in builds with the netstack tag")      // Userspace was enabled, but the userspace network stack hasn't been compiled in
+	ErrInvalidPacket        = errors.New("packet is neither an IPv4 nor an IPv6 packet")                          // The packet to write has an unknown IP version
+
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
 // AdapterConfig configures the adapter
 type AdapterConfig struct {
 	*wrtcconn.NamedAdapterConfig
-	Device             string       // Name to give to the TUN device
-	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
-	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
-	OnPeerDisconnected func(string) // Handler to be called when the adapter has received a message
-	CIDRs              []string     // IPv4 & IPv6 networks to join
-	MaxRetries         int          // Maximum amount of IP address to try and claim before giving up
-	Parallel           int          // Maximum amount of goroutines to use to unmarshal IP packets
-	Static             bool         // Claim the exact IP specified in the CIDR notation instead of selecting a random one from the networks
+	Device             string           // Name to give to the TUN device
+	OnSignalerConnect  func(string)     // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)     // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)     // Handler to be called when the adapter has received a message
+	CIDRs              []string         // IPv4 & IPv6 networks to join
+	MaxRetries         int              // Maximum amount of IP address to try and claim before giving up
+	Parallel           int              // Maximum amount of goroutines to use to unmarshal IP packets
+	Static             bool             // Claim the exact IP specified in the CIDR notation instead of selecting a random one from the networks
+	BatchInterval      time.Duration    // Time to wait before flushing coalesced packets (0 disables batching; must be enabled on all peers)
+	Firewall           bool             // Whether to manage firewall rules for the TUN device (only supported on Linux)
+	FirewallBackend    string           // Backend to manage firewall rules with (nftables or iptables) (default is nftables if it is installed)
+	AllowedPorts       []string         // Incoming ports to allow on the TUN device (i.e. tcp/22, udp/5000-5100 or icmp) (empty allows all; requires Firewall)
+	Masquerade         bool             // Whether to masquerade traffic from the overlay network which leaves through other interfaces, i.e. for exit nodes (requires Firewall)
+	Offload            bool             // Whether to enable TCP segmentation offload on the TUN device so that multiple packets can be read per syscall (only supported on Linux)
+	QueueLength        int              // Amount of packets to queue per peer before dropping them (default is 1024)
+	DropPolicy         string           // Packets to drop if the queue of a peer is full (tail or head) (default is tail)
+	Routes             []Route          // Static routes to networks through peers (the networks must also be routed to the TUN device by the system)
+	Advertise          []Route          // Networks to advertise to peers so that they can route them through this adapter (the gateways of the routes are ignored; overrides Metadata)
+	ECMP               bool             // Whether to balance flows between routes with the same prefix length and metric instead of only using one of them
+	Capture            *wrtcpcap.Writer // Writer to capture packets sent to and received from peers with (disabled if nil; must use the raw IP link type)
+	Adaptive           bool             // Whether to adapt the reliability of the channel to peers and the MTU of the TUN device to the measured loss and round-trip time of the connections to them, so that the VPN keeps working on lossy links (all peers must enable it; the MTU isn't adapted in userspace mode)
+	Userspace          bool             // Whether to terminate TCP and UDP in a userspace network stack instead of creating a TUN device, so that no root privileges are required (connections can only be made with Dial and Listen; Firewall and Offload are not supported; only supported in builds with the netstack tag)
+}
+
+// device is a TUN device
+type device interface {
+	Name() string
+	ReadPackets(size int) ([][]byte, error) // Read one or more packets of at most size bytes each
+	Write(packet []byte) (int, error)
+	Close() error
+}
+
+// waterDevice is a TUN device which reads one packet per syscall
+type waterDevice struct {
+	*water.Interface
+}
+
+func (d *waterDevice) ReadPackets(size int) ([][]byte, error) {
+	buf := make([]byte, size)
+
+	n, err := d.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{buf[:n]}, nil
 }
 
 // Adapter provides an IP service
@@ -50,11 +106,16 @@ type Adapter struct {
 	config   *AdapterConfig
 	ctx      context.Context
 
-	cancel  context.CancelFunc
-	adapter *wrtcconn.NamedAdapter
-	tun     *water.Interface
-	mtu     int
-	ids     chan string
+	cancel    context.CancelFunc
+	adapter   *wrtcconn.NamedAdapter
+	tun       device
+	netstack  *netstackDevice
+	mtu       int
+	batchSize int
+	ids       chan string
+	firewall  *firewall.Firewall
+	routes    *routingTable
+	mtus      *adaptiveMTU
 }
 
 type peerWithIP struct {
@@ -81,6 +142,11 @@ func NewAdapter(
 		config.Parallel = runtime.NumCPU()
 	}
 
+	routes := newRoutingTable(config.ECMP)
+	for _, route := range config.Routes {
+		routes.add(route)
+	}
+
 	return &Adapter{
 		signaler: signaler,
 		key:      key,
@@ -90,22 +156,48 @@ func NewAdapter(
 
 		cancel: cancel,
 		ids:    make(chan string),
+		routes: routes,
+		mtus:   newAdaptiveMTU(),
 	}
 }
 
-// Open connects the adapter to the signaler and creates the TUN device
+// Open connects the adapter to the signaler and creates the TUN device or userspace network stack
 func (a *Adapter) Open() error {
 	log.Trace().Msg("Opening adapter")
 
-	var err error
-	a.tun, err = water.New(water.Config{
-		DeviceType:             water.TUN,
-		PlatformSpecificParams: getPlatformSpecificParams(a.config.Device),
-	})
-	if err != nil {
+	if err := wrtcconn.ValidateDropPolicy(a.config.DropPolicy); err != nil {
 		return err
 	}
 
+	var err error
+	if a.config.Userspace {
+		if a.config.Firewall || a.config.Offload {
+			return ErrUserspaceConflict
+		}
+
+		a.netstack, err = newNetstackDevice()
+		if err != nil {
+			return err
+		}
+
+		a.tun = a.netstack
+	} else if a.config.Offload {
+		a.tun, err = newOffloadDevice(a.config.Device)
+		if err != nil {
+			return err
+		}
+	} else {
+		tun, err := water.New(water.Config{
+			DeviceType:             water.TUN,
+			PlatformSpecificParams: getPlatformSpecificParams(a.config.Device),
+		})
+		if err != nil {
+			return err
+		}
+
+		a.tun = &waterDevice{tun}
+	}
+
 	for _, rawIP := range a.config.CIDRs {
 		ip, _, err := net.ParseCIDR(rawIP)
 		if err != nil {
@@ -113,7 +205,7 @@ func (a *Adapter) Open() error {
 		}
 
 		// macOS does not support IPv4 TUN
-		if runtime.GOOS == "darwin" && ip.To4() != nil {
+		if runtime.GOOS == "darwin" && ip.To4() != nil && a.netstack == nil {
 			continue
 		}
 
@@ -176,6 +268,45 @@ func (a *Adapter) Open() error {
 		}
 	}
 
+	if len(a.config.Advertise) > 0 {
+		advertisements := []v1.Advertisement{}
+		for _, route := range a.config.Advertise {
+			advertisements = append(advertisements, v1.Advertisement{
+				Prefix: route.Prefix.Masked().String(),
+				Metric: route.Metric,
+			})
+		}
+
+		metadata, err := json.Marshal(v1.NewRoutes(advertisements))
+		if err != nil {
+			return err
+		}
+
+		if a.config.NamedAdapterConfig.AdapterConfig == nil {
+			a.config.NamedAdapterConfig.AdapterConfig = &wrtcconn.AdapterConfig{}
+		}
+
+		a.config.NamedAdapterConfig.AdapterConfig.Metadata = metadata
+	}
+
+	if a.config.Adaptive {
+		if a.config.NamedAdapterConfig.AdapterConfig == nil {
+			a.config.NamedAdapterConfig.AdapterConfig = &wrtcconn.AdapterConfig{}
+		}
+
+		config := a.config.NamedAdapterConfig.AdapterConfig
+		config.AdaptiveChannels = append(config.AdaptiveChannels, services.IPPrimary)
+
+		onPeerQualityChange := config.OnPeerQualityChange
+		config.OnPeerQualityChange = func(community, peerID string, quality wrtcconn.Quality) {
+			a.mtus.update(community+"/"+peerID, quality.MTU)
+
+			if onPeerQualityChange != nil {
+				onPeerQualityChange(community, peerID, quality)
+			}
+		}
+	}
+
 	a.config.NamedAdapterConfig.Names = names
 	a.config.NamedAdapterConfig.IsIDClaimed = func(theirRawIPs map[string]struct{}, s string) bool {
 		ourIPs := []string{}
@@ -218,15 +349,71 @@ func (a *Adapter) Open() error {
 		return err
 	}
 
-	a.mtu, err = getMTU(a.tun.Name())
+	if a.netstack != nil {
+		a.mtu = netstackMTU
+	} else {
+		a.mtu, err = getMTU(a.tun.Name())
+		if err != nil {
+			return err
+		}
+
+		if a.config.Adaptive {
+			a.mtus.open(a.tun.Name(), a.mtu)
+		}
+	}
+
+	// Batches must fit the largest packets of the TUN device
+	if a.config.BatchInterval > 0 {
+		a.batchSize, err = wrtcconn.GetBatchSize(a.mtu + headerLength)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.config.Firewall {
+		rules := &firewall.Rules{
+			Device:     a.tun.Name(),
+			Backend:    a.config.FirewallBackend,
+			Masquerade: a.config.Masquerade,
+		}
+
+		for _, rawPort := range a.config.AllowedPorts {
+			port, err := firewall.ParsePort(rawPort)
+			if err != nil {
+				return err
+			}
+
+			rules.AllowedPorts = append(rules.AllowedPorts, port)
+		}
+
+		for _, cidr := range a.config.CIDRs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return err
+			}
+
+			rules.Networks = append(rules.Networks, network)
+		}
 
-	return err
+		a.firewall = firewall.New(rules)
+		if err := a.firewall.Open(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Close disconnects the adapter from the signaler and closes the TUN device
+// Close disconnects the adapter from the signaler and closes the TUN device or userspace network stack
 func (a *Adapter) Close() error {
 	log.Trace().Msg("Closing adapter")
 
+	if a.firewall != nil {
+		if err := a.firewall.Close(); err != nil {
+			return err
+		}
+	}
+
 	if err := a.tun.Close(); err != nil {
 		return err
 	}
@@ -236,21 +423,24 @@ func (a *Adapter) Close() error {
 
 // Wait starts the transmission loop
 func (a *Adapter) Wait() error {
-	peers := map[string]*peerWithIP{}
-	var peersLock sync.Mutex
-
 	go func() {
 		sem := semaphore.NewWeighted(int64(a.config.Parallel))
 
 		for {
-			buf := make([]byte, a.mtu+headerLength)
+			packets, err := a.tun.ReadPackets(a.mtu + headerLength)
+			if err != nil {
+				if errors.Is(err, os.ErrClosed) {
+					log.Debug().Err(err).Msg("Could not read from TUN device, stopping")
+
+					return
+				}
 
-			if _, err := a.tun.Read(buf); err != nil {
 				log.Debug().Err(err).Msg("Could not read from TUN device, continuing")
 
 				continue
 			}
 
+			// Packets which have been read at once are segments of the same flow, so they are sent in order
 			go func() {
 				if err := sem.Acquire(a.ctx, 1); err != nil {
 					log.Debug().Err(err).Msg("Could not acquire semaphore, stopping")
@@ -259,25 +449,19 @@ func (a *Adapter) Wait() error {
 				}
 				defer sem.Release(1)
 
-				var dst net.IP
-				var packet layers.IPv4
-				if err := packet.DecodeFromBytes(buf, gopacket.NilDecodeFeedback); err != nil {
-					var packet layers.IPv6
-					if err := packet.DecodeFromBytes(buf, gopacket.NilDecodeFeedback); err != nil {
-						log.Debug().Err(err).Msg("Could not unmarshal packet, stopping")
+				for _, buf := range packets {
+					src, dst, protocol, err := getFlow(buf)
+					if err != nil {
+						log.Debug().Err(err).Msg("Could not unmarshal packet, continuing")
 
-						return
-					} else {
-						dst = packet.DstIP
+						continue
+					}
+
+					if a.config.Capture != nil {
+						a.config.Capture.Write(buf)
 					}
-				} else {
-					dst = packet.DstIP
-				}
 
-				peersLock.Lock()
-				for _, peer := range peers {
-					// Send if matching destination, multicast or broadcast IP
-					if dst.Equal(peer.ip) || ((dst.IsMulticast() || dst.IsInterfaceLocalMulticast() || dst.IsInterfaceLocalMulticast()) && len(dst) == len(peer.ip)) || (peer.ip.To4() != nil && dst.Equal(getBroadcastAddr(peer.net))) {
+					for _, peer := range a.getDestinations(dst, getFlowHash(buf)) {
 						if _, err := peer.Conn.Write(buf); err != nil {
 							log.Debug().
 								Err(err).
@@ -287,9 +471,20 @@ func (a *Adapter) Wait() error {
 
 							continue
 						}
+
+						if a.config.Audit != nil {
+							a.config.Audit.Count(wrtcaudit.Event{
+								Type:        wrtcaudit.EventFlow,
+								Community:   peer.Community,
+								PeerID:      peer.PeerID,
+								Direction:   wrtcaudit.DirectionOut,
+								Protocol:    protocol,
+								Source:      src.String(),
+								Destination: dst.String(),
+							}, len(buf))
+						}
 					}
 				}
-				peersLock.Unlock()
 			}()
 		}
 	}()
@@ -326,6 +521,14 @@ func (a *Adapter) Wait() error {
 					continue
 				}
 
+				if a.netstack != nil {
+					if err := a.netstack.addAddress(rawIP); err != nil {
+						return err
+					}
+
+					continue
+				}
+
 				// macOS does not support IPv4 TUN
 				if runtime.GOOS == "darwin" && ip.To4() != nil {
 					continue
@@ -336,17 +539,48 @@ func (a *Adapter) Wait() error {
 				}
 			}
 
-			if err := setLinkUp(a.tun.Name()); err != nil {
-				return err
+			if a.netstack == nil {
+				if err := setLinkUp(a.tun.Name()); err != nil {
+					return err
+				}
 			}
 		case peer := <-a.adapter.Accept():
-			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Connected to peer")
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if a.config.BatchInterval > 0 {
+				peer = &wrtcconn.Peer{
+					PeerID:    peer.PeerID,
+					Name:      peer.Name,
+					ChannelID: peer.ChannelID,
+					Metadata:  peer.Metadata,
+					Community: peer.Community,
+					Relayed:   peer.Relayed,
+					Conn: wrtcconn.NewBatchedConn(peer.Conn, &wrtcconn.BatchConfig{
+						Interval: a.config.BatchInterval,
+						Size:     a.batchSize,
+					}),
+				}
+			}
+
+			// Packets are sent from a queue per peer so that a slow peer can't stall forwarding to other peers
+			queue := a.newQueuedConn(peer)
+			peer = &wrtcconn.Peer{
+				PeerID:    peer.PeerID,
+				Name:      peer.Name,
+				ChannelID: peer.ChannelID,
+				Metadata:  peer.Metadata,
+				Community: peer.Community,
+				Relayed:   peer.Relayed,
+				Conn:      queue,
+			}
 
 			go func() {
 				if a.config.OnPeerConnect != nil {
 					a.config.OnPeerConnect(peer.PeerID)
 				}
 
+				a.audit(wrtcaudit.EventPeerJoined, peer)
+
 				ips := []string{}
 				if err := json.Unmarshal([]byte(peer.PeerID), &ips); err != nil {
 					log.Debug().
@@ -358,7 +592,7 @@ func (a *Adapter) Wait() error {
 				}
 
 				valid := false
-				peersLock.Lock()
+				routed := []*peerWithIP{}
 				for _, rawIP := range ips {
 					ip, net, err := net.ParseCIDR(rawIP)
 					if err != nil {
@@ -371,24 +605,39 @@ func (a *Adapter) Wait() error {
 						continue
 					}
 
-					peers[ip.String()] = &peerWithIP{peer, ip, net}
+					p := &peerWithIP{peer, ip, net}
+					a.routes.addPeer(p)
+					routed = append(routed, p)
 
 					valid = true
 				}
-				peersLock.Unlock()
+
+				advertised := a.addAdvertisedRoutes(peer, routed)
 
 				defer func() {
-					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Uint64("dropped", queue.Dropped()).Msg("Disconnected from peer")
+
+					_ = queue.Close()
 
 					if a.config.OnPeerDisconnected != nil {
 						a.config.OnPeerDisconnected(peer.PeerID)
 					}
 
-					peersLock.Lock()
-					for _, ip := range ips {
-						delete(peers, ip)
+					a.audit(wrtcaudit.EventPeerLeft, peer)
+
+					removed := false
+					for _, p := range routed {
+						if a.routes.removePeer(p) {
+							removed = true
+						}
+					}
+
+					// Advertised routes are kept if the peer has already reconnected
+					if removed {
+						for _, route := range advertised {
+							a.routes.remove(route)
+						}
 					}
-					peersLock.Unlock()
 				}()
 
 				if !valid {
@@ -403,7 +652,8 @@ func (a *Adapter) Wait() error {
 				for {
 					buf := make([]byte, a.mtu+headerLength)
 
-					if _, err := peer.Conn.Read(buf); err != nil {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
 						log.Debug().
 							Err(err).
 							Str("channelID", peer.ChannelID).
@@ -413,7 +663,11 @@ func (a *Adapter) Wait() error {
 						return
 					}
 
-					if _, err := a.tun.Write(buf); err != nil {
+					if a.config.Capture != nil {
+						a.config.Capture.Write(buf[:n])
+					}
+
+					if _, err := a.tun.Write(buf[:n]); err != nil {
 						log.Debug().
 							Err(err).
 							Str("channelID", peer.ChannelID).
@@ -422,12 +676,219 @@ func (a *Adapter) Wait() error {
 
 						continue
 					}
+
+					if a.config.Audit != nil {
+						if src, dst, protocol, err := getFlow(buf[:n]); err == nil {
+							a.config.Audit.Count(wrtcaudit.Event{
+								Type:        wrtcaudit.EventFlow,
+								Community:   peer.Community,
+								PeerID:      peer.PeerID,
+								Direction:   wrtcaudit.DirectionIn,
+								Protocol:    protocol,
+								Source:      src.String(),
+								Destination: dst.String(),
+							}, n)
+						}
+					}
 				}
 			}()
 		}
 	}
 }
 
+// AddRoute adds a route to a network through a peer or updates the metric of an existing route
+func (a *Adapter) AddRoute(route Route) {
+	log.Trace().Str("prefix", route.Prefix.String()).Str("via", route.Via.String()).Int("metric", route.Metric).Msg("Adding route")
+
+	a.routes.add(route)
+}
+
+// RemoveRoute removes a route to a network through a peer; it returns false if the route doesn't exist
+func (a *Adapter) RemoveRoute(route Route) bool {
+	log.Trace().Str("prefix", route.Prefix.String()).Str("via", route.Via.String()).Msg("Removing route")
+
+	return a.routes.remove(route)
+}
+
+// Routes returns all routes, including the host routes to connected peers
+func (a *Adapter) Routes() []Route {
+	return a.routes.list()
+}
+
+// Add the routes which a peer has advertised in its metadata
+func (a *Adapter) addAdvertisedRoutes(peer *wrtcconn.Peer, routed []*peerWithIP) []Route {
+	routes := []Route{}
+	if len(routed) == 0 || len(peer.Metadata) == 0 {
+		return routes
+	}
+
+	var message v1.Message
+	if err := json.Unmarshal(peer.Metadata, &message); err != nil || message.Type != v1.TypeRoutes {
+		return routes
+	}
+
+	var advertisement v1.Routes
+	if err := json.Unmarshal(peer.Metadata, &advertisement); err != nil {
+		log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal advertised routes, continuing")
+
+		return routes
+	}
+
+	via, ok := toAddr(routed[0].ip)
+	if !ok {
+		return routes
+	}
+
+	for _, rawRoute := range advertisement.Routes {
+		prefix, err := netip.ParsePrefix(rawRoute.Prefix)
+		if err != nil {
+			log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not parse advertised route, continuing")
+
+			continue
+		}
+
+		route := Route{prefix.Masked(), via, rawRoute.Metric}
+
+		log.Debug().Str("peerID", peer.PeerID).Str("prefix", route.Prefix.String()).Int("metric", route.Metric).Msg("Adding advertised route")
+
+		a.routes.add(route)
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// Get the peers to send a packet to the destination to
+func (a *Adapter) getDestinations(dst net.IP, flow uint64) []*peerWithIP {
+	// Multicast and broadcast packets are sent to all peers of the same IP family, but only once to each peer
+	multicast := dst.IsMulticast() || dst.IsInterfaceLocalMulticast() || dst.IsLinkLocalMulticast()
+
+	peers := []*peerWithIP{}
+	sent := map[string]struct{}{}
+	for _, peer := range a.routes.connected() {
+		if (multicast && (dst.To4() != nil) == (peer.ip.To4() != nil)) || (peer.ip.To4() != nil && dst.Equal(getBroadcastAddr(peer.net))) {
+			if _, ok := sent[peer.PeerID]; ok {
+				continue
+			}
+
+			sent[peer.PeerID] = struct{}{}
+			peers = append(peers, peer)
+		}
+	}
+
+	if len(peers) > 0 || multicast {
+		return peers
+	}
+
+	if peer := a.routes.lookup(dst, flow); peer != nil {
+		return []*peerWithIP{peer}
+	}
+
+	return peers
+}
+
+func (a *Adapter) newQueuedConn(peer *wrtcconn.Peer) *wrtcconn.QueuedConn {
+	return wrtcconn.NewQueuedConn(peer.Conn, &wrtcconn.QueueConfig{
+		Length:     a.config.QueueLength,
+		DropPolicy: a.config.DropPolicy,
+		OnDrop: func(buf []byte) {
+			log.Trace().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Dropping packet because the queue of the peer is full")
+
+			if a.config.Audit == nil {
+				return
+			}
+
+			if src, dst, protocol, err := getFlow(buf); err == nil {
+				a.config.Audit.Count(wrtcaudit.Event{
+					Type:        wrtcaudit.EventDenied,
+					Community:   peer.Community,
+					PeerID:      peer.PeerID,
+					Direction:   wrtcaudit.DirectionOut,
+					Protocol:    protocol,
+					Source:      src.String(),
+					Destination: dst.String(),
+					Reason:      denyReasonQueue,
+				}, len(buf))
+			}
+		},
+	})
+}
+
+func (a *Adapter) audit(eventType string, peer *wrtcconn.Peer) {
+	if a.config.Audit == nil {
+		return
+	}
+
+	if err := a.config.Audit.Log(wrtcaudit.Event{
+		Type:      eventType,
+		Community: peer.Community,
+		PeerID:    peer.PeerID,
+		Name:      peer.Name,
+		ChannelID: peer.ChannelID,
+		Relayed:   peer.Relayed,
+	}); err != nil {
+		log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not write to audit log, continuing")
+	}
+}
+
+// Get the source, destination and protocol of an IPv4 or IPv6 packet
+func getFlow(buf []byte) (net.IP, net.IP, string, error) {
+	var packet layers.IPv4
+	if err := packet.DecodeFromBytes(buf, gopacket.NilDecodeFeedback); err != nil {
+		var packet layers.IPv6
+		if err := packet.DecodeFromBytes(buf, gopacket.NilDecodeFeedback); err != nil {
+			return nil, nil, "", err
+		}
+
+		return packet.SrcIP, packet.DstIP, packet.NextHeader.String(), nil
+	}
+
+	return packet.SrcIP, packet.DstIP, packet.Protocol.String(), nil
+}
+
+// Get a hash of the addresses, protocol and ports of an IPv4 or IPv6 packet, which is the same for all packets of a flow
+func getFlowHash(buf []byte) uint64 {
+	h := fnv.New64a()
+
+	if len(buf) < 1 {
+		return 0
+	}
+
+	var (
+		protocol byte
+		l4       int
+	)
+	switch buf[0] >> 4 {
+	case 4:
+		if len(buf) < 20 {
+			return 0
+		}
+
+		protocol = buf[9]
+		l4 = int(buf[0]&0x0f) * 4
+		_, _ = h.Write(buf[12:20])
+	case 6:
+		if len(buf) < 40 {
+			return 0
+		}
+
+		protocol = buf[6]
+		l4 = 40
+		_, _ = h.Write(buf[8:40])
+	default:
+		return 0
+	}
+
+	_, _ = h.Write([]byte{protocol})
+
+	// Ports are only included for TCP and UDP
+	if (protocol == 6 || protocol == 17) && len(buf) >= l4+4 {
+		_, _ = h.Write(buf[l4 : l4+4])
+	}
+
+	return h.Sum64()
+}
+
 // See https://go.dev/play/p/Igo6Ct3gx_
 func getBroadcastAddr(n *net.IPNet) net.IP {
 	ip := make(net.IP, len(n.IP.To4()))
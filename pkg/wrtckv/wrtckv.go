@@ -0,0 +1,399 @@
+package wrtckv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrMissingKey    = errors.New("missing key")                                   // The key is empty
+	ErrEntryTooLarge = errors.New("entry is larger than the maximum message size") // The entry can't be sent because it is too large
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Change is a value which has been set or deleted
+type Change struct {
+	Key     string // Key which has been changed
+	Value   []byte // New value of the key
+	Deleted bool   // Whether the key has been deleted
+	PeerID  string // ID of the peer that has changed the key
+}
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	OnChange           func(Change) // Handler to be called when a key has been set or deleted by this adapter or a peer
+	MaxMessageSize     int          // Maximum size of an entry in bytes (default is 64 KiB; must be the same on all peers)
+}
+
+type entry struct {
+	value     []byte
+	deleted   bool
+	timestamp int64
+	origin    string
+}
+
+// newer returns whether the entry wins over another entry
+func (e *entry) newer(other *entry) bool {
+	if e.timestamp != other.timestamp {
+		return e.timestamp > other.timestamp
+	}
+
+	return e.origin > other.origin
+}
+
+type remotePeer struct {
+	conn      io.ReadWriteCloser
+	writeLock sync.Mutex
+}
+
+func (p *remotePeer) write(b []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	_, err := p.conn.Write(b)
+
+	return err
+}
+
+// Adapter provides a replicated key-value store with last-writer-wins semantics
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids chan string
+
+	peersLock sync.Mutex
+	peers     map[string]*remotePeer
+
+	// Deleted entries are kept as tombstones so that peers which missed the deletion don't resurrect them
+	entriesLock sync.Mutex
+	entries     map[string]*entry
+	clock       int64
+	id          string
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = 64 * 1024
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		peers:   map[string]*remotePeer{},
+		entries: map[string]*entry{},
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.KVPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+
+	return err
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	return a.adapter.Close()
+}
+
+// Wait starts the transmission loop
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			a.entriesLock.Lock()
+			a.id = id
+			a.entriesLock.Unlock()
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			rp := &remotePeer{
+				conn: peer.Conn,
+			}
+
+			a.peersLock.Lock()
+			a.peers[peer.PeerID] = rp
+			a.peersLock.Unlock()
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					a.peersLock.Lock()
+					if current, ok := a.peers[peer.PeerID]; ok && current == rp {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				// Synchronize the peer by sending it all entries
+				a.entriesLock.Lock()
+				entries := []*v1.Entry{}
+				for key, e := range a.entries {
+					entries = append(entries, v1.NewEntry(key, e.value, e.deleted, e.timestamp, e.origin))
+				}
+				a.entriesLock.Unlock()
+
+				for _, e := range entries {
+					p, err := json.Marshal(e)
+					if err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not marshal entry, continuing")
+
+						continue
+					}
+
+					if err := rp.write(p); err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not write to peer, stopping")
+
+						return
+					}
+				}
+
+				buf := make([]byte, a.config.MaxMessageSize)
+				for {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+						return
+					}
+
+					var message v1.Message
+					if err := json.Unmarshal(buf[:n], &message); err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal message, continuing")
+
+						continue
+					}
+
+					if message.Type != v1.TypeEntry {
+						log.Debug().Str("peerID", peer.PeerID).Str("type", message.Type).Msg("Got message with unknown type, continuing")
+
+						continue
+					}
+
+					var e v1.Entry
+					if err := json.Unmarshal(buf[:n], &e); err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal entry, continuing")
+
+						continue
+					}
+
+					log.Trace().Str("peerID", peer.PeerID).Str("key", e.Key).Msg("Received entry")
+
+					a.merge(&e)
+				}
+			}()
+		}
+	}
+}
+
+// merge applies an entry from a peer if it is newer than the local one
+func (a *Adapter) merge(e *v1.Entry) {
+	a.entriesLock.Lock()
+
+	if e.Timestamp > a.clock {
+		a.clock = e.Timestamp
+	}
+
+	incoming := &entry{e.Value, e.Deleted, e.Timestamp, e.Origin}
+	if current, ok := a.entries[e.Key]; ok && !incoming.newer(current) {
+		a.entriesLock.Unlock()
+
+		return
+	}
+
+	a.entries[e.Key] = incoming
+	a.entriesLock.Unlock()
+
+	if a.config.OnChange != nil {
+		a.config.OnChange(Change{
+			Key:     e.Key,
+			Value:   e.Value,
+			Deleted: e.Deleted,
+			PeerID:  e.Origin,
+		})
+	}
+}
+
+func (a *Adapter) write(key string, value []byte, deleted bool) error {
+	if key == "" {
+		return ErrMissingKey
+	}
+
+	a.entriesLock.Lock()
+
+	// Timestamps are always larger than all known ones, even if the local clock is behind
+	timestamp := time.Now().UnixNano()
+	if timestamp <= a.clock {
+		timestamp = a.clock + 1
+	}
+
+	e := v1.NewEntry(key, value, deleted, timestamp, a.id)
+
+	p, err := json.Marshal(e)
+	if err != nil {
+		a.entriesLock.Unlock()
+
+		return err
+	}
+
+	if len(p) > a.config.MaxMessageSize {
+		a.entriesLock.Unlock()
+
+		return ErrEntryTooLarge
+	}
+
+	a.clock = timestamp
+	a.entries[key] = &entry{value, deleted, timestamp, a.id}
+	a.entriesLock.Unlock()
+
+	a.peersLock.Lock()
+	peers := map[string]*remotePeer{}
+	for peerID, peer := range a.peers {
+		peers[peerID] = peer
+	}
+	a.peersLock.Unlock()
+
+	for peerID, peer := range peers {
+		if err := peer.write(p); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+
+	if a.config.OnChange != nil {
+		a.config.OnChange(Change{
+			Key:     key,
+			Value:   value,
+			Deleted: deleted,
+			PeerID:  e.Origin,
+		})
+	}
+
+	return nil
+}
+
+// Set sets a key to a value and sends it to all peers
+func (a *Adapter) Set(key string, value []byte) error {
+	log.Trace().Str("key", key).Int("len", len(value)).Msg("Setting key")
+
+	return a.write(key, value, false)
+}
+
+// Delete deletes a key and notifies all peers
+func (a *Adapter) Delete(key string) error {
+	log.Trace().Str("key", key).Msg("Deleting key")
+
+	return a.write(key, nil, true)
+}
+
+// Get returns the value of a key and whether it exists
+func (a *Adapter) Get(key string) ([]byte, bool) {
+	a.entriesLock.Lock()
+	defer a.entriesLock.Unlock()
+
+	e, ok := a.entries[key]
+	if !ok || e.deleted {
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+// Keys returns all keys which haven't been deleted in sorted order
+func (a *Adapter) Keys() []string {
+	a.entriesLock.Lock()
+	defer a.entriesLock.Unlock()
+
+	keys := []string{}
+	for key, e := range a.entries {
+		if !e.deleted {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -135,6 +135,8 @@ func (a *Adapter) Wait() error {
 			return nil
 		case err := <-errs:
 			return err
+		case err := <-a.adapter.Err():
+			return err
 		case id := <-a.ids:
 			log.Debug().Str("id", id).Msg("Connected to signaler")
 
@@ -142,7 +144,7 @@ func (a *Adapter) Wait() error {
 				a.config.OnSignalerConnect(id)
 			}
 		case peer := <-a.adapter.Accept():
-			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Connected to peer")
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
 
 			if a.config.Server {
 				go func() {
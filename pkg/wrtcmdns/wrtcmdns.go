@@ -0,0 +1,364 @@
+package wrtcmdns
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	mdnsPort      = 5353
+	maxPacketSize = 9000        // mDNS packets can be as large as a jumbo frame
+	echoTimeout   = time.Second // Time during which a packet which has already been reflected is ignored
+)
+
+var (
+	ErrCouldNotListen = errors.New("could not listen for mDNS packets on IPv4 or IPv6") // Neither an IPv4 nor an IPv6 multicast socket could be opened
+
+	mdnsIPv4 = net.IPv4(224, 0, 0, 251)
+	mdnsIPv6 = net.ParseIP("ff02::fb")
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	Interface          string       // Name of the local interface to capture and reflect mDNS packets on (i.e. eth0) (default is chosen by the system)
+}
+
+type localConn struct {
+	conn  *net.UDPConn
+	group *net.UDPAddr
+}
+
+type remotePeer struct {
+	conn      io.ReadWriteCloser
+	writeLock sync.Mutex
+}
+
+func (p *remotePeer) write(b []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	_, err := p.conn.Write(b)
+
+	return err
+}
+
+// Adapter reflects mDNS packets between the local networks of peers
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids   chan string
+	conns []*localConn
+
+	peersLock sync.Mutex
+	peers     map[string]*remotePeer
+
+	seenLock sync.Mutex
+	seen     map[[sha256.Size]byte]time.Time
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		peers: map[string]*remotePeer{},
+		seen:  map[[sha256.Size]byte]time.Time{},
+	}
+}
+
+// Open starts capturing mDNS packets and connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	var iface *net.Interface
+	if strings.TrimSpace(a.config.Interface) != "" {
+		var err error
+		iface, err = net.InterfaceByName(a.config.Interface)
+		if err != nil {
+			return err
+		}
+	}
+
+	// IPv4 is preferred when reflecting packets, so it is opened first
+	for _, group := range []*net.UDPAddr{{IP: mdnsIPv4, Port: mdnsPort}, {IP: mdnsIPv6, Port: mdnsPort}} {
+		network := "udp6"
+		if group.IP.To4() != nil {
+			network = "udp4"
+		}
+
+		conn, err := net.ListenMulticastUDP(network, iface, group)
+		if err != nil {
+			log.Debug().Err(err).Str("group", group.String()).Msg("Could not listen for mDNS packets, continuing")
+
+			continue
+		}
+
+		if iface != nil {
+			if network == "udp4" {
+				err = ipv4.NewPacketConn(conn).SetMulticastInterface(iface)
+			} else {
+				err = ipv6.NewPacketConn(conn).SetMulticastInterface(iface)
+			}
+
+			if err != nil {
+				_ = conn.Close()
+
+				log.Debug().Err(err).Str("group", group.String()).Msg("Could not set multicast interface, continuing")
+
+				continue
+			}
+		}
+
+		a.conns = append(a.conns, &localConn{conn, group})
+	}
+
+	if len(a.conns) == 0 {
+		return ErrCouldNotListen
+	}
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.MDNSPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range a.conns {
+		go func(c *localConn) {
+			buf := make([]byte, maxPacketSize)
+			for {
+				n, raddr, err := c.conn.ReadFromUDP(buf)
+				if err != nil {
+					log.Debug().Err(err).Str("group", c.group.String()).Msg("Could not read from local network, stopping")
+
+					return
+				}
+
+				// Drop packets which have been reflected to the local network by this adapter and duplicates received over both IP families
+				if !a.markSeen(buf[:n]) {
+					continue
+				}
+
+				log.Trace().Str("source", raddr.String()).Int("len", n).Msg("Reflecting mDNS packet to peers")
+
+				a.peersLock.Lock()
+				peers := map[string]*remotePeer{}
+				for peerID, peer := range a.peers {
+					peers[peerID] = peer
+				}
+				a.peersLock.Unlock()
+
+				for peerID, peer := range peers {
+					if err := peer.write(buf[:n]); err != nil {
+						log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+					}
+				}
+			}
+		}(c)
+	}
+
+	go func() {
+		t := time.NewTicker(echoTimeout)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-t.C:
+				a.seenLock.Lock()
+				for hash, seen := range a.seen {
+					if time.Since(seen) > echoTimeout {
+						delete(a.seen, hash)
+					}
+				}
+				a.seenLock.Unlock()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops capturing mDNS packets and disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	for _, c := range a.conns {
+		_ = c.conn.Close()
+	}
+
+	return a.adapter.Close()
+}
+
+// Wait starts the transmission loop
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			rp := &remotePeer{
+				conn: peer.Conn,
+			}
+
+			a.peersLock.Lock()
+			a.peers[peer.PeerID] = rp
+			a.peersLock.Unlock()
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					a.peersLock.Lock()
+					if current, ok := a.peers[peer.PeerID]; ok && current == rp {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				buf := make([]byte, maxPacketSize)
+				for {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+						return
+					}
+
+					packet := multicastResponses(buf[:n])
+
+					a.markSeen(packet)
+
+					log.Trace().Str("peerID", peer.PeerID).Int("len", len(packet)).Msg("Reflecting mDNS packet to local network")
+
+					// Packets are only sent over one IP family, as their records don't depend on it
+					c := a.conns[0]
+					if _, err := c.conn.WriteToUDP(packet, c.group); err != nil {
+						log.Debug().Err(err).Str("group", c.group.String()).Msg("Could not write to local network, continuing")
+					}
+				}
+			}()
+		}
+	}
+}
+
+// markSeen remembers a packet and returns whether it hasn't been seen recently
+func (a *Adapter) markSeen(packet []byte) bool {
+	hash := sha256.Sum256(packet)
+
+	a.seenLock.Lock()
+	defer a.seenLock.Unlock()
+
+	if seen, ok := a.seen[hash]; ok && time.Since(seen) <= echoTimeout {
+		return false
+	}
+
+	a.seen[hash] = time.Now()
+
+	return true
+}
+
+// multicastResponses clears the unicast response bit of questions, as unicast responses can't reach queriers in other networks
+func multicastResponses(packet []byte) []byte {
+	var m dnsmessage.Message
+	if err := m.Unpack(packet); err != nil || m.Header.Response {
+		return packet
+	}
+
+	changed := false
+	for i, question := range m.Questions {
+		if question.Class&(1<<15) != 0 {
+			m.Questions[i].Class &^= 1 << 15
+
+			changed = true
+		}
+	}
+
+	if !changed {
+		return packet
+	}
+
+	p, err := m.Pack()
+	if err != nil {
+		return packet
+	}
+
+	return p
+}
@@ -0,0 +1,282 @@
+package wrtcmedia
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string)        // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)        // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)        // Handler to be called when the adapter has disconnected from a peer
+	Tracks             []webrtc.TrackLocal // Local tracks to send to all peers
+}
+
+// Track is a track received from a peer
+type Track struct {
+	PeerID    string              // ID of the peer which sent the track
+	Community string              // Community in which the peer is connected
+	Track     *webrtc.TrackRemote // Track to read RTP packets from
+	Receiver  *webrtc.RTPReceiver // Receiver to read RTCP packets from
+}
+
+// Adapter provides a media service
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids    chan string
+	tracks chan *Track
+
+	connsLock sync.Mutex
+	conns     map[*webrtc.PeerConnection]struct{}
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids:    make(chan string),
+		tracks: make(chan *Track),
+
+		conns: map[*webrtc.PeerConnection]struct{}{},
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	config := &wrtcconn.AdapterConfig{}
+	if a.config.AdapterConfig != nil {
+		c := *a.config.AdapterConfig
+		config = &c
+	}
+
+	if config.MediaEngine == nil {
+		config.MediaEngine = &webrtc.MediaEngine{}
+		if err := config.MediaEngine.RegisterDefaultCodecs(); err != nil {
+			return err
+		}
+	}
+
+	onPeerConnectionCreated := config.OnPeerConnectionCreated
+	config.OnPeerConnectionCreated = func(peerID string, community string, conn *webrtc.PeerConnection) {
+		a.addTracks(peerID, community, conn)
+
+		if onPeerConnectionCreated != nil {
+			onPeerConnectionCreated(peerID, community, conn)
+		}
+	}
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.MediaPrimary},
+		config,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+
+	return err
+}
+
+func (a *Adapter) addTracks(peerID string, community string, conn *webrtc.PeerConnection) {
+	a.connsLock.Lock()
+	defer a.connsLock.Unlock()
+
+	a.conns[conn] = struct{}{}
+
+	for _, track := range a.config.Tracks {
+		sender, err := conn.AddTrack(track)
+		if err != nil {
+			log.Debug().
+				Err(err).
+				Str("peerID", peerID).
+				Str("trackID", track.ID()).
+				Msg("Could not add track, continuing")
+
+			continue
+		}
+
+		go readRTCP(sender)
+	}
+
+	conn.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		log.Debug().
+			Str("peerID", peerID).
+			Str("trackID", track.ID()).
+			Str("kind", track.Kind().String()).
+			Msg("Received track")
+
+		select {
+		case <-a.ctx.Done():
+		case a.tracks <- &Track{peerID, community, track, receiver}:
+		}
+	})
+}
+
+// AddTrack sends a track to all current and future peers; established connections are renegotiated
+func (a *Adapter) AddTrack(track webrtc.TrackLocal) error {
+	a.connsLock.Lock()
+	defer a.connsLock.Unlock()
+
+	a.config.Tracks = append(a.config.Tracks, track)
+
+	for conn := range a.conns {
+		if conn.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			delete(a.conns, conn)
+
+			continue
+		}
+
+		sender, err := conn.AddTrack(track)
+		if err != nil {
+			return err
+		}
+
+		go readRTCP(sender)
+	}
+
+	return nil
+}
+
+// RemoveTrack stops sending a track to all peers; established connections are renegotiated
+func (a *Adapter) RemoveTrack(track webrtc.TrackLocal) error {
+	a.connsLock.Lock()
+	defer a.connsLock.Unlock()
+
+	tracks := []webrtc.TrackLocal{}
+	for _, candidate := range a.config.Tracks {
+		if candidate != track {
+			tracks = append(tracks, candidate)
+		}
+	}
+	a.config.Tracks = tracks
+
+	for conn := range a.conns {
+		if conn.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			delete(a.conns, conn)
+
+			continue
+		}
+
+		for _, sender := range conn.GetSenders() {
+			if sender.Track() != track {
+				continue
+			}
+
+			if err := conn.RemoveTrack(sender); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Read incoming RTCP packets so that interceptors can process them
+func readRTCP(sender *webrtc.RTPSender) {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := sender.Read(buf); err != nil {
+			return
+		}
+	}
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	return a.adapter.Close()
+}
+
+// Wait starts handling peers
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				// The channel is only used to detect disconnects
+				buf := make([]byte, 1)
+				for {
+					if _, err := peer.Conn.Read(buf); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}
+}
+
+// Accept returns a channel on which tracks will be sent when peers start sending them
+func (a *Adapter) Accept() chan *Track {
+	return a.tracks
+}
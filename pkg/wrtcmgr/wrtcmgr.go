@@ -1,17 +1,28 @@
 package wrtcmgr
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pojntfx/weron/internal/persisters"
+	"github.com/pojntfx/weron/pkg/wrtcsgl"
+)
+
+const (
+	maxRedirects = 10 // Maximum amount of redirects to follow
 )
 
 var (
+	errTooManyRedirects = errors.New("stopped after too many redirects")
+
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
@@ -38,9 +49,27 @@ func NewManager(
 	}
 }
 
-// CreatePersistentCommunity creates a persistent community, which will not be automatically deleted after the last peer leaves
-func (m *Manager) CreatePersistentCommunity(community string, password string) (*persisters.Community, error) {
-	hc := &http.Client{}
+// getClient returns a HTTP client which keeps the credentials if the signaler redirects a request to the replica of a sharded fleet which owns the community
+func (m *Manager) getClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errTooManyRedirects
+			}
+
+			// The HTTP client removes the credentials if the redirect is to another host; they are only sent to it again if the original request has been authenticated with them (i.e. not for leases) and if they can't be read in transit
+			if _, _, ok := via[0].BasicAuth(); ok && req.URL.Scheme == "https" {
+				req.SetBasicAuth(m.username, m.password)
+			}
+
+			return nil
+		},
+	}
+}
+
+// CreatePersistentCommunity creates a persistent community, which will not be automatically deleted after the last peer leaves; if ttl is set, the community is deleted and its peers are kicked once it has expired
+func (m *Manager) CreatePersistentCommunity(community string, password string, ttl time.Duration) (*persisters.Community, error) {
+	hc := m.getClient()
 
 	u, err := url.Parse(m.url)
 	if err != nil {
@@ -50,6 +79,9 @@ func (m *Manager) CreatePersistentCommunity(community string, password string) (
 	q := u.Query()
 	q.Set("community", community)
 	q.Set("password", password)
+	if ttl > 0 {
+		q.Set("ttl", ttl.String())
+	}
 	u.RawQuery = q.Encode()
 
 	req, err := http.NewRequest(http.MethodPost, u.String(), http.NoBody)
@@ -89,7 +121,7 @@ func (m *Manager) ListCommunities() ([]persisters.Community, error) {
 		return nil, err
 	}
 
-	hc := &http.Client{}
+	hc := m.getClient()
 
 	req, err := http.NewRequest(http.MethodGet, u.String(), http.NoBody)
 	if err != nil {
@@ -123,7 +155,7 @@ func (m *Manager) ListCommunities() ([]persisters.Community, error) {
 
 // DeleteCommunity deletes a community and kicks all peers that joined it
 func (m *Manager) DeleteCommunity(community string) error {
-	hc := &http.Client{}
+	hc := m.getClient()
 
 	u, err := url.Parse(m.url)
 	if err != nil {
@@ -153,3 +185,534 @@ func (m *Manager) DeleteCommunity(community string) error {
 
 	return nil
 }
+
+func (m *Manager) getLeasesURL(community string, id string) (*url.URL, error) {
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow using the same address as for the signaler
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join(u.Path, wrtcsgl.LeasesPath)
+
+	q := url.Values{}
+	q.Set("community", community)
+	if id != "" {
+		q.Set("id", id)
+	}
+	u.RawQuery = q.Encode()
+
+	return u, nil
+}
+
+// CreateLease reserves IPs and a name for a peer in a persistent community, replacing an existing lease with the same ID
+func (m *Manager) CreateLease(community string, id string, ips []string, name string) (*persisters.Lease, error) {
+	hc := m.getClient()
+
+	u, err := m.getLeasesURL(community, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	for _, ip := range ips {
+		q.Add("ip", ip)
+	}
+	q.Set("name", name)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	l := persisters.Lease{}
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// ListLeases queries all leases of a community
+func (m *Manager) ListLeases(community string) ([]persisters.Lease, error) {
+	hc := m.getClient()
+
+	u, err := m.getLeasesURL(community, "")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	l := []persisters.Lease{}
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// GetLease queries the lease of a peer using the community password instead of the API credentials
+func (m *Manager) GetLease(community string, password string, id string) (*persisters.Lease, error) {
+	hc := m.getClient()
+
+	u, err := m.getLeasesURL(community, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("password", password)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	l := persisters.Lease{}
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// DeleteLease deletes the lease of a peer
+func (m *Manager) DeleteLease(community string, id string) error {
+	hc := m.getClient()
+
+	u, err := m.getLeasesURL(community, id)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, u.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+// RotatePassword replaces the password of a persistent community with a random one, which is only returned once; clients which have joined with the previous password are kicked once grace has passed
+func (m *Manager) RotatePassword(community string, grace time.Duration) (*wrtcsgl.Rotation, error) {
+	hc := m.getClient()
+
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow using the same address as for the signaler
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join(u.Path, wrtcsgl.RotatePath)
+
+	q := url.Values{}
+	q.Set("community", community)
+	if grace > 0 {
+		q.Set("grace", grace.String())
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := wrtcsgl.Rotation{}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Drain makes the signaler stop accepting new clients, wait for pending exchanges to complete, disconnect its clients so that they reconnect to another signaler and exit; it returns once draining has been started
+func (m *Manager) Drain() error {
+	hc := m.getClient()
+
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return err
+	}
+
+	// Allow using the same address as for the signaler
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join(u.Path, wrtcsgl.DrainPath)
+	u.RawQuery = ""
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusAccepted {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+// ListMembers queries the peers of a community which have connected to the signaler with their ID and when they were last seen
+func (m *Manager) ListMembers(community string) ([]persisters.Member, error) {
+	hc := m.getClient()
+
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow using the same address as for the signaler
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join(u.Path, wrtcsgl.MembersPath)
+
+	q := url.Values{}
+	q.Set("community", community)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	l := []persisters.Member{}
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (m *Manager) getBansURL(ip string, peerID string) (*url.URL, error) {
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow using the same address as for the signaler
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join(u.Path, wrtcsgl.BansPath)
+
+	q := url.Values{}
+	if ip != "" {
+		q.Set("ip", ip)
+	}
+	if peerID != "" {
+		q.Set("peer", peerID)
+	}
+	u.RawQuery = q.Encode()
+
+	return u, nil
+}
+
+// CreateBan disconnects the clients with an IP or, if no IP is given, a peer ID and prevents them from connecting again; if ttl is set, the ban is lifted once it has expired
+func (m *Manager) CreateBan(ip string, peerID string, ttl time.Duration) (*wrtcsgl.Ban, error) {
+	hc := m.getClient()
+
+	u, err := m.getBansURL(ip, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		q := u.Query()
+		q.Set("ttl", ttl.String())
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	b := wrtcsgl.Ban{}
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// ListBans queries all active bans
+func (m *Manager) ListBans() ([]wrtcsgl.Ban, error) {
+	hc := m.getClient()
+
+	u, err := m.getBansURL("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	b := []wrtcsgl.Ban{}
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// DeleteBan lifts the ban of an IP or peer ID
+func (m *Manager) DeleteBan(ip string, peerID string) error {
+	hc := m.getClient()
+
+	u, err := m.getBansURL(ip, peerID)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, u.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.username, m.password)
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+// Apply reconciles the persistent communities and their leases on the signaler with a spec and returns the changes which were made; if dryRun is set, the changes are only computed
+func (m *Manager) Apply(spec wrtcsgl.Spec, dryRun bool) ([]wrtcsgl.Change, error) {
+	hc := m.getClient()
+
+	u, err := url.Parse(m.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow using the same address as for the signaler
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join(u.Path, wrtcsgl.ApplyPath)
+
+	q := url.Values{}
+	q.Set("dryRun", strconv.FormatBool(dryRun))
+	u.RawQuery = q.Encode()
+
+	p, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.username, m.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c := []wrtcsgl.Change{}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
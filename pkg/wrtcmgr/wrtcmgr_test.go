@@ -0,0 +1,50 @@
+package wrtcmgr
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestRedirectCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticated bool
+		from          string
+		to            string
+		want          bool
+	}{
+		{"https replica", true, "https://signaler.example.com/", "https://replica.example.com/", true},
+		{"http replica", true, "http://signaler.example.com/", "http://replica.example.com/", false},
+		{"downgrade to http", true, "https://signaler.example.com/", "http://replica.example.com/", false},
+		{"unauthenticated lease request", false, "https://signaler.example.com/", "https://replica.example.com/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(tt.from, "admin", "secret", context.Background())
+
+			from, err := http.NewRequest(http.MethodGet, tt.from, http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.authenticated {
+				from.SetBasicAuth("admin", "secret")
+			}
+
+			to, err := http.NewRequest(http.MethodGet, tt.to, http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := m.getClient().CheckRedirect(to, []*http.Request{from}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, got := to.BasicAuth(); got != tt.want {
+				t.Fatalf("got credentials %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
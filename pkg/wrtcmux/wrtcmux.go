@@ -0,0 +1,417 @@
+package wrtcmux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxMessageSize = 16 * 1024 // Maximum size of the messages which carry the multiplexed streams, which is supported by all WebRTC implementations
+	readBufferSize = 64 * 1024 // Size of the buffer to read messages into; must be larger than the largest message peers send
+)
+
+var (
+	ErrPeerNotConnected = errors.New("peer is not connected") // No session to the peer has been established
+	ErrClosed           = errors.New("adapter is closed")     // The adapter has been closed
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect   func(string)  // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect       func(string)  // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected  func(string)  // Handler to be called when the adapter has disconnected from a peer
+	AcceptBacklog       int           // Maximum amount of streams a peer can open before they are accepted (default is 256)
+	KeepAliveInterval   time.Duration // Time between keep-alives on idle sessions (0 disables keep-alives; the data channel is kept alive by SCTP anyway)
+	MaxStreamWindowSize uint32        // Maximum amount of unacknowledged bytes per stream (default and minimum is 256 KiB)
+}
+
+// Stream is a logical stream to a peer, which shares one data channel with all other streams to the peer
+type Stream struct {
+	net.Conn
+	PeerID    string // ID of the peer
+	Community string // Community in which the peer is connected
+}
+
+type session struct {
+	*yamux.Session
+	metadata []byte
+}
+
+// sessionKey identifies a session, as peers which have joined multiple communities have one session per community
+type sessionKey struct {
+	community string
+	peerID    string
+}
+
+// messageConn turns the message-oriented data channel into a stream-oriented connection for yamux, which writes frames of arbitrary size
+type messageConn struct {
+	conn io.ReadWriteCloser
+
+	buf    []byte
+	unread []byte
+}
+
+func (c *messageConn) Read(p []byte) (int, error) {
+	if len(c.unread) == 0 {
+		n, err := c.conn.Read(c.buf)
+		if err != nil {
+			return 0, err
+		}
+
+		c.unread = c.buf[:n]
+	}
+
+	n := copy(p, c.unread)
+	c.unread = c.unread[n:]
+
+	return n, nil
+}
+
+func (c *messageConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxMessageSize {
+			chunk = chunk[:maxMessageSize]
+		}
+
+		n, err := c.conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+func (c *messageConn) Close() error {
+	return c.conn.Close()
+}
+
+// Adapter multiplexes many reliable streams over a single data channel per peer, which avoids the limit of SCTP streams and the cost of negotiating a data channel for every stream
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids     chan string
+	streams chan *Stream
+
+	idLock sync.Mutex
+	id     string
+
+	sessionsLock sync.Mutex
+	sessions     map[sessionKey]*session
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.AdapterConfig == nil {
+		config.AdapterConfig = &wrtcconn.AdapterConfig{
+			Timeout: time.Second * 10,
+		}
+	}
+
+	if config.AcceptBacklog <= 0 {
+		config.AcceptBacklog = 256
+	}
+
+	if config.MaxStreamWindowSize <= 0 {
+		config.MaxStreamWindowSize = 256 * 1024
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids:     make(chan string),
+		streams: make(chan *Stream),
+
+		sessions: map[sessionKey]*session{},
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.MuxPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close disconnects the adapter from the signaler and closes all streams
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	a.sessionsLock.Lock()
+	for _, session := range a.sessions {
+		_ = session.Close()
+	}
+	a.sessionsLock.Unlock()
+
+	if a.adapter == nil {
+		return nil
+	}
+
+	return a.adapter.Close()
+}
+
+// Wait starts establishing sessions to peers
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			a.idLock.Lock()
+			a.id = id
+			a.idLock.Unlock()
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if err := a.handlePeer(peer); err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not create session for peer, stopping")
+
+				_ = peer.Conn.Close()
+			}
+		}
+	}
+}
+
+func (a *Adapter) handlePeer(peer *wrtcconn.Peer) error {
+	config := yamux.DefaultConfig()
+	config.AcceptBacklog = a.config.AcceptBacklog
+	config.EnableKeepAlive = a.config.KeepAliveInterval > 0
+	if config.EnableKeepAlive {
+		config.KeepAliveInterval = a.config.KeepAliveInterval
+	}
+	config.MaxStreamWindowSize = a.config.MaxStreamWindowSize
+	config.LogOutput = io.Discard
+
+	conn := &messageConn{
+		conn: peer.Conn,
+		buf:  make([]byte, readBufferSize),
+	}
+
+	a.idLock.Lock()
+	id := a.id
+	a.idLock.Unlock()
+
+	// Both peers need to agree on which one is the client, as the client and server use different stream IDs
+	var (
+		ys  *yamux.Session
+		err error
+	)
+	if id < peer.PeerID {
+		ys, err = yamux.Client(conn, config)
+	} else {
+		ys, err = yamux.Server(conn, config)
+	}
+	if err != nil {
+		return err
+	}
+
+	session := &session{ys, peer.Metadata}
+	key := sessionKey{peer.Community, peer.PeerID}
+
+	a.sessionsLock.Lock()
+	if old, ok := a.sessions[key]; ok {
+		_ = old.Close()
+	}
+	a.sessions[key] = session
+	a.sessionsLock.Unlock()
+
+	if a.config.OnPeerConnect != nil {
+		a.config.OnPeerConnect(peer.PeerID)
+	}
+
+	go func() {
+		defer func() {
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+			_ = session.Close()
+
+			a.sessionsLock.Lock()
+			if current, ok := a.sessions[key]; ok && current == session {
+				delete(a.sessions, key)
+			}
+			a.sessionsLock.Unlock()
+
+			if a.config.OnPeerDisconnected != nil {
+				a.config.OnPeerDisconnected(peer.PeerID)
+			}
+		}()
+
+		for {
+			stream, err := session.AcceptStream()
+			if err != nil {
+				log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not accept stream, stopping")
+
+				return
+			}
+
+			log.Trace().Str("peerID", peer.PeerID).Uint32("streamID", stream.StreamID()).Msg("Accepted stream")
+
+			select {
+			case <-a.ctx.Done():
+				_ = stream.Close()
+
+				return
+			case a.streams <- &Stream{stream, peer.PeerID, peer.Community}:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// getSession returns the session to a peer in a community, or in any community if it is empty; must be called with the sessions lock held
+func (a *Adapter) getSession(community string, peerID string) (sessionKey, *session, bool) {
+	if community != "" {
+		key := sessionKey{community, peerID}
+		session, ok := a.sessions[key]
+
+		return key, session, ok
+	}
+
+	for key, session := range a.sessions {
+		if key.peerID == peerID {
+			return key, session, true
+		}
+	}
+
+	return sessionKey{}, nil, false
+}
+
+// OpenStream opens a new stream to a peer
+func (a *Adapter) OpenStream(peerID string) (*Stream, error) {
+	return a.OpenCommunityStream("", peerID)
+}
+
+// OpenCommunityStream opens a new stream to a peer in a community (empty uses any community the peer is connected in)
+func (a *Adapter) OpenCommunityStream(community string, peerID string) (*Stream, error) {
+	a.sessionsLock.Lock()
+	key, session, ok := a.getSession(community, peerID)
+	a.sessionsLock.Unlock()
+
+	if !ok {
+		return nil, ErrPeerNotConnected
+	}
+
+	stream, err := session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Trace().Str("peerID", peerID).Str("community", key.community).Uint32("streamID", stream.StreamID()).Msg("Opened stream")
+
+	return &Stream{stream, peerID, key.community}, nil
+}
+
+// AcceptStream waits for a peer to open a stream
+func (a *Adapter) AcceptStream() (*Stream, error) {
+	select {
+	case <-a.ctx.Done():
+		return nil, ErrClosed
+	case stream := <-a.streams:
+		return stream, nil
+	}
+}
+
+// Metadata returns the metadata a peer has supplied during introduction
+func (a *Adapter) Metadata(peerID string) ([]byte, error) {
+	a.sessionsLock.Lock()
+	defer a.sessionsLock.Unlock()
+
+	_, session, ok := a.getSession("", peerID)
+	if !ok {
+		return nil, ErrPeerNotConnected
+	}
+
+	return session.metadata, nil
+}
+
+// Peers returns the IDs of the peers to which a session has been established
+func (a *Adapter) Peers() []string {
+	a.sessionsLock.Lock()
+	defer a.sessionsLock.Unlock()
+
+	peerIDs := []string{}
+	seen := map[string]struct{}{}
+	for key := range a.sessions {
+		if _, ok := seen[key.peerID]; ok {
+			continue
+		}
+		seen[key.peerID] = struct{}{}
+
+		peerIDs = append(peerIDs, key.peerID)
+	}
+
+	return peerIDs
+}
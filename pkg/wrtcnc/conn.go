@@ -0,0 +1,111 @@
+package wrtcnc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/pojntfx/weron/internal/framing"
+)
+
+const (
+	frameHeaderLength = 1 // Length of the frame type
+
+	frameTypeData  byte = 0 // Data of the connection
+	frameTypeClose byte = 1 // The sender has finished writing
+	frameTypeError byte = 2 // The connection could not be established; the payload contains the reason
+	frameTypeDial  byte = 3 // Request to connect to a port; the payload contains the port
+)
+
+var (
+	ErrInvalidFrame = framing.ErrInvalidFrame // The received frame could not be parsed
+)
+
+// Conn is a connection to a port on a peer
+type Conn struct {
+	conn *framing.Conn
+
+	readLock sync.Mutex
+	pending  []byte
+	readErr  error
+}
+
+func newConn(conn io.ReadWriteCloser) *Conn {
+	return &Conn{
+		conn: framing.NewConn(conn, frameHeaderLength),
+	}
+}
+
+func (c *Conn) writeFrame(frameType byte, p []byte) error {
+	return c.conn.WriteFrame([]byte{frameType}, p)
+}
+
+// readFrame reads the next frame; the payload is only valid until the next call
+func (c *Conn) readFrame() (byte, []byte, error) {
+	header, payload, err := c.conn.ReadFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return header[0], payload, nil
+}
+
+func (c *Conn) dial(port uint16) error {
+	p := make([]byte, 2)
+	binary.BigEndian.PutUint16(p, port)
+
+	return c.writeFrame(frameTypeDial, p)
+}
+
+func (c *Conn) fail(reason error) error {
+	return c.writeFrame(frameTypeError, []byte(reason.Error()))
+}
+
+// Read reads data from the remote end of the connection
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+
+		frameType, payload, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		switch frameType {
+		case frameTypeData:
+			c.pending = payload
+		case frameTypeClose:
+			c.readErr = io.EOF
+		case frameTypeError:
+			c.readErr = errors.New(string(payload))
+		default:
+			return 0, ErrInvalidFrame
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+
+	return n, nil
+}
+
+// Write sends data to the remote end of the connection
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.conn.WriteFrames([]byte{frameTypeData}, p)
+}
+
+// CloseWrite signals the remote end that no more data will be written
+func (c *Conn) CloseWrite() error {
+	return c.writeFrame(frameTypeClose, nil)
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,350 @@
+package wrtcnc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrPortNotAllowed = errors.New("port is not allowed") // The server doesn't allow connections to the requested port
+	ErrInvalidPort    = errors.New("invalid port")        // The requested port is outside of the valid range
+	ErrNotAClient     = errors.New("adapter is a server") // Only clients aggregate the services of peers
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.NamedAdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	Server             bool         // Whether to forward connections from peers to local ports
+	Host               string       // Host to forward connections from peers to (default is localhost) (only used when acting as a server)
+	Ports              []int        // Ports which peers may connect to (all ports are allowed if empty) (only used when acting as a server)
+}
+
+// Adapter bridges connections to TCP ports on peers; servers claim a name, and other peers dial ports on them by that name
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.NamedAdapter
+
+	ids chan string
+
+	allowed map[int]struct{}
+
+	// Peers which can be dialed; changed is closed and replaced whenever a peer connects
+	peersLock sync.Mutex
+	peers     map[string]*wrtcconn.Peer
+	changed   chan struct{}
+
+	registry *wrtcconn.Registry
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if strings.TrimSpace(config.Host) == "" {
+		config.Host = "localhost"
+	}
+
+	allowed := map[int]struct{}{}
+	for _, port := range config.Ports {
+		allowed[port] = struct{}{}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		allowed: allowed,
+
+		peers:   map[string]*wrtcconn.Peer{},
+		changed: make(chan struct{}),
+
+		registry: wrtcconn.NewRegistry(),
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewNamedAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.NCPrimary},
+		a.config.NamedAdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	return a.adapter.Close()
+}
+
+// Wait starts handling peers
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			if !a.config.Server {
+				if err := a.registry.Add(peer.PeerID, peer.Metadata); err != nil {
+					log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not parse services of peer, continuing")
+				}
+
+				a.peersLock.Lock()
+				a.peers[peer.PeerID] = peer
+				close(a.changed)
+				a.changed = make(chan struct{})
+				a.peersLock.Unlock()
+
+				continue
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				a.handleConn(peer.PeerID, newConn(peer.Conn))
+			}()
+		}
+	}
+}
+
+// Dial connects to a port on the server with the given name, waiting for the peer to connect if it hasn't already
+func (a *Adapter) Dial(ctx context.Context, peerID string, port int) (*Conn, error) {
+	if port <= 0 || port > 65535 {
+		return nil, ErrInvalidPort
+	}
+
+	for {
+		a.peersLock.Lock()
+		peer, ok := a.peers[peerID]
+		if ok {
+			// Each data channel carries exactly one connection
+			delete(a.peers, peerID)
+		}
+		changed := a.changed
+		a.peersLock.Unlock()
+
+		if ok {
+			c := newConn(peer.Conn)
+			if err := c.dial(uint16(port)); err != nil {
+				_ = c.Close()
+
+				return nil, err
+			}
+
+			return c, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-a.ctx.Done():
+			return nil, a.ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// DialService connects to the port of a service which a server has announced (see wrtcconn.AdapterConfig.Services), waiting for such a server to connect if none has already
+func (a *Adapter) DialService(ctx context.Context, name string) (*Conn, error) {
+	if a.config.Server {
+		return nil, ErrNotAClient
+	}
+
+	for {
+		a.peersLock.Lock()
+		peerID, port := "", 0
+		for _, service := range a.registry.Lookup(name) {
+			if _, ok := a.peers[service.PeerID]; ok && service.Channel == services.NCPrimary && service.Port > 0 {
+				peerID, port = service.PeerID, service.Port
+
+				break
+			}
+		}
+		changed := a.changed
+		a.peersLock.Unlock()
+
+		if peerID != "" {
+			log.Debug().Str("service", name).Str("peerID", peerID).Int("port", port).Msg("Resolved service")
+
+			return a.Dial(ctx, peerID, port)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-a.ctx.Done():
+			return nil, a.ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Services returns the registry of the services which the connected servers have announced
+func (a *Adapter) Services() (*wrtcconn.Registry, error) {
+	if a.config.Server {
+		return nil, ErrNotAClient
+	}
+
+	return a.registry, nil
+}
+
+// handleConn forwards a connection from a peer to the requested local port
+func (a *Adapter) handleConn(peerID string, c *Conn) {
+	defer c.Close()
+
+	frameType, payload, err := c.readFrame()
+	if err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Msg("Could not read from peer, stopping")
+
+		return
+	}
+
+	if frameType != frameTypeDial || len(payload) != 2 {
+		log.Debug().Str("peerID", peerID).Msg("Got unexpected frame instead of dial request, stopping")
+
+		return
+	}
+
+	port := int(binary.BigEndian.Uint16(payload))
+	if _, ok := a.allowed[port]; len(a.allowed) > 0 && !ok {
+		log.Debug().Str("peerID", peerID).Int("port", port).Msg("Peer requested port which is not allowed, stopping")
+
+		if err := c.fail(ErrPortNotAllowed); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, stopping")
+		}
+
+		return
+	}
+
+	addr := net.JoinHostPort(a.config.Host, strconv.Itoa(port))
+
+	var d net.Dialer
+	upstream, err := d.DialContext(a.ctx, "tcp", addr)
+	if err != nil {
+		log.Debug().Err(err).Str("peerID", peerID).Str("addr", addr).Msg("Could not connect to upstream, stopping")
+
+		if err := c.fail(err); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, stopping")
+		}
+
+		return
+	}
+	defer upstream.Close()
+
+	log.Debug().Str("peerID", peerID).Str("addr", addr).Msg("Forwarding connection")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		if _, err := io.Copy(upstream, c); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not copy from peer to upstream, stopping")
+
+			_ = upstream.Close()
+
+			return
+		}
+
+		if cw, ok := upstream.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		if _, err := io.Copy(c, upstream); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not copy from upstream to peer, stopping")
+
+			_ = c.Close()
+
+			return
+		}
+
+		if err := c.CloseWrite(); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not close connection to peer, continuing")
+		}
+	}()
+
+	wg.Wait()
+}
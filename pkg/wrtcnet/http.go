@@ -0,0 +1,25 @@
+package wrtcnet
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Transport returns an HTTP transport which connects to a service on the peer whose ID is the host of the request URL (i.e. http://peerID/ for a service served with http.Serve and Listen), so that peers in a community can reach each other's HTTP services without a VPN interface; the port of the URL is ignored, and community can be empty to use any community the peer is connected in
+func (a *Adapter) Transport(community string, service string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// Requests never leave the mesh, so proxies from the environment don't apply
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		peerID, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return a.Dial(ctx, community, peerID, service)
+	}
+
+	return transport
+}
@@ -0,0 +1,435 @@
+package wrtcnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcmux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	network = "weron" // Network of the addresses of services
+
+	maxServiceLength = 255 // Maximum length of a service name, which is sent with a length prefix of one byte
+
+	statusAccepted byte = 0 // The stream has been passed to a listener
+	statusNotFound byte = 1 // No listener exists for the requested service
+)
+
+var (
+	ErrInvalidService  = errors.New("invalid service name")                 // The service name is empty or longer than 255 bytes
+	ErrAddressInUse    = errors.New("service is already being listened on") // Another listener exists for the service in the community
+	ErrServiceNotFound = errors.New("peer is not listening on the service") // The peer has rejected the stream because it doesn't listen on the service
+	ErrInvalidStatus   = errors.New("received invalid status from peer")    // The peer has sent an unknown status
+	ErrClosed          = errors.New("listener or adapter has been closed")  // The listener or the adapter has been closed
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+}
+
+// Addr is the address of a service on a peer
+type Addr struct {
+	Community string // Community in which the peer is connected
+	PeerID    string // ID of the peer (empty for the local address of a listener which hasn't connected to the signaler yet)
+	Service   string // Name of the service
+}
+
+// Network returns the name of the network
+func (a *Addr) Network() string {
+	return network
+}
+
+// String returns the address in format community/peerID/service
+func (a *Addr) String() string {
+	return a.Community + "/" + a.PeerID + "/" + a.Service
+}
+
+type conn struct {
+	net.Conn
+
+	local  *Addr
+	remote *Addr
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type listenerKey struct {
+	community string
+	service   string
+}
+
+// Listener accepts connections to a service from peers
+type Listener struct {
+	adapter *Adapter
+	key     listenerKey
+
+	conns     chan net.Conn
+	closer    chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for a peer to connect to the service
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case <-l.closer:
+		return nil, ErrClosed
+	case <-l.adapter.ctx.Done():
+		return nil, ErrClosed
+	case c := <-l.conns:
+		return c, nil
+	}
+}
+
+// Close stops accepting connections; established connections are kept open
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		l.adapter.listenersLock.Lock()
+		if current, ok := l.adapter.listeners[l.key]; ok && current == l {
+			delete(l.adapter.listeners, l.key)
+		}
+		l.adapter.listenersLock.Unlock()
+
+		close(l.closer)
+	})
+
+	return nil
+}
+
+// Addr returns the local address of the service
+func (l *Listener) Addr() net.Addr {
+	return &Addr{l.key.community, l.adapter.getID(), l.key.service}
+}
+
+// Adapter provides net.Listener and net.Conn implementations for services on peers, so that existing servers and clients (i.e. net/http or gRPC) can be used without changes; connections are multiplexed streams (see wrtcmux)
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcmux.Adapter
+
+	idLock sync.Mutex
+	id     string
+
+	listenersLock sync.Mutex
+	listeners     map[listenerKey]*Listener
+
+	// changed is closed and replaced whenever a peer connects
+	peersLock sync.Mutex
+	changed   chan struct{}
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.AdapterConfig == nil {
+		config.AdapterConfig = &wrtcconn.AdapterConfig{
+			Timeout: time.Second * 10,
+		}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		listeners: map[listenerKey]*Listener{},
+
+		changed: make(chan struct{}),
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcmux.NewAdapter(
+		a.signaler,
+		a.key,
+		a.ice,
+		&wrtcmux.AdapterConfig{
+			AdapterConfig: a.config.AdapterConfig,
+			OnSignalerConnect: func(id string) {
+				a.idLock.Lock()
+				a.id = id
+				a.idLock.Unlock()
+
+				if a.config.OnSignalerConnect != nil {
+					a.config.OnSignalerConnect(id)
+				}
+			},
+			OnPeerConnect: func(peerID string) {
+				a.peersLock.Lock()
+				close(a.changed)
+				a.changed = make(chan struct{})
+				a.peersLock.Unlock()
+
+				if a.config.OnPeerConnect != nil {
+					a.config.OnPeerConnect(peerID)
+				}
+			},
+			OnPeerDisconnected: a.config.OnPeerDisconnected,
+		},
+		a.ctx,
+	)
+
+	return a.adapter.Open()
+}
+
+// Close disconnects the adapter from the signaler and closes all listeners and connections
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	if a.adapter == nil {
+		return nil
+	}
+
+	return a.adapter.Close()
+}
+
+// Wait starts passing connections from peers to the listeners
+func (a *Adapter) Wait() error {
+	go func() {
+		for {
+			stream, err := a.adapter.AcceptStream()
+			if err != nil {
+				log.Trace().Err(err).Msg("Could not accept stream, stopping")
+
+				return
+			}
+
+			go a.handleStream(stream)
+		}
+	}()
+
+	return a.adapter.Wait()
+}
+
+func (a *Adapter) getID() string {
+	a.idLock.Lock()
+	defer a.idLock.Unlock()
+
+	return a.id
+}
+
+// Listen starts accepting connections to a service from peers in a community (empty accepts connections from all communities)
+func (a *Adapter) Listen(community string, service string) (*Listener, error) {
+	if service == "" || len(service) > maxServiceLength {
+		return nil, ErrInvalidService
+	}
+
+	key := listenerKey{community, service}
+
+	a.listenersLock.Lock()
+	defer a.listenersLock.Unlock()
+
+	if _, ok := a.listeners[key]; ok {
+		return nil, ErrAddressInUse
+	}
+
+	l := &Listener{
+		adapter: a,
+		key:     key,
+
+		conns:  make(chan net.Conn),
+		closer: make(chan struct{}),
+	}
+	a.listeners[key] = l
+
+	return l, nil
+}
+
+// Dial connects to a service on a peer in a community (empty uses any community the peer is connected in), waiting for the peer to connect if it hasn't already
+func (a *Adapter) Dial(ctx context.Context, community string, peerID string, service string) (net.Conn, error) {
+	if service == "" || len(service) > maxServiceLength {
+		return nil, ErrInvalidService
+	}
+
+	for {
+		a.peersLock.Lock()
+		changed := a.changed
+		a.peersLock.Unlock()
+
+		stream, err := a.adapter.OpenCommunityStream(community, peerID)
+		if err == nil {
+			return a.handshake(ctx, stream, service)
+		}
+
+		if err != wrtcmux.ErrPeerNotConnected {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-a.ctx.Done():
+			return nil, ErrClosed
+		case <-changed:
+		}
+	}
+}
+
+// handshake requests a service on a stream and waits for the peer to accept it
+func (a *Adapter) handshake(ctx context.Context, stream *wrtcmux.Stream, service string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := stream.SetDeadline(deadline); err != nil {
+			_ = stream.Close()
+
+			return nil, err
+		}
+	}
+
+	if _, err := stream.Write(append([]byte{byte(len(service))}, []byte(service)...)); err != nil {
+		_ = stream.Close()
+
+		return nil, err
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(stream, status); err != nil {
+		_ = stream.Close()
+
+		return nil, err
+	}
+
+	switch status[0] {
+	case statusAccepted:
+	case statusNotFound:
+		_ = stream.Close()
+
+		return nil, ErrServiceNotFound
+	default:
+		_ = stream.Close()
+
+		return nil, ErrInvalidStatus
+	}
+
+	if err := stream.SetDeadline(time.Time{}); err != nil {
+		_ = stream.Close()
+
+		return nil, err
+	}
+
+	log.Debug().Str("community", stream.Community).Str("peerID", stream.PeerID).Str("service", service).Msg("Connected to service")
+
+	return &conn{
+		stream,
+		&Addr{stream.Community, a.getID(), service},
+		&Addr{stream.Community, stream.PeerID, service},
+	}, nil
+}
+
+// handleStream reads the requested service from a stream and passes it to the listener for the service
+func (a *Adapter) handleStream(stream *wrtcmux.Stream) {
+	if err := stream.SetDeadline(time.Now().Add(a.config.Timeout)); err != nil {
+		log.Debug().Err(err).Str("peerID", stream.PeerID).Msg("Could not set deadline for stream, stopping")
+
+		_ = stream.Close()
+
+		return
+	}
+
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(stream, length); err != nil {
+		log.Debug().Err(err).Str("peerID", stream.PeerID).Msg("Could not read service from peer, stopping")
+
+		_ = stream.Close()
+
+		return
+	}
+
+	name := make([]byte, int(length[0]))
+	if _, err := io.ReadFull(stream, name); err != nil {
+		log.Debug().Err(err).Str("peerID", stream.PeerID).Msg("Could not read service from peer, stopping")
+
+		_ = stream.Close()
+
+		return
+	}
+	service := string(name)
+
+	// Listeners for a community take precedence over listeners for all communities
+	a.listenersLock.Lock()
+	l, ok := a.listeners[listenerKey{stream.Community, service}]
+	if !ok {
+		l, ok = a.listeners[listenerKey{"", service}]
+	}
+	a.listenersLock.Unlock()
+
+	if !ok {
+		log.Debug().Str("peerID", stream.PeerID).Str("service", service).Msg("Peer requested service which is not being listened on, stopping")
+
+		_, _ = stream.Write([]byte{statusNotFound})
+		_ = stream.Close()
+
+		return
+	}
+
+	if _, err := stream.Write([]byte{statusAccepted}); err != nil {
+		log.Debug().Err(err).Str("peerID", stream.PeerID).Msg("Could not write to peer, stopping")
+
+		_ = stream.Close()
+
+		return
+	}
+
+	if err := stream.SetDeadline(time.Time{}); err != nil {
+		log.Debug().Err(err).Str("peerID", stream.PeerID).Msg("Could not clear deadline for stream, stopping")
+
+		_ = stream.Close()
+
+		return
+	}
+
+	c := &conn{
+		stream,
+		&Addr{stream.Community, a.getID(), service},
+		&Addr{stream.Community, stream.PeerID, service},
+	}
+
+	select {
+	case <-l.closer:
+		_ = stream.Close()
+	case <-a.ctx.Done():
+		_ = stream.Close()
+	case l.conns <- c:
+		log.Debug().Str("community", stream.Community).Str("peerID", stream.PeerID).Str("service", service).Msg("Accepted connection to service")
+	}
+}
@@ -0,0 +1,280 @@
+package wrtcpcap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	ErrMissingPath = errors.New("missing path to capture to") // No path was specified when starting a capture
+)
+
+// Status is the state of a capture
+type Status struct {
+	Capturing bool   `json:"capturing"`      // Whether packets are being captured
+	Path      string `json:"path,omitempty"` // Path of the file or named pipe which packets are written to
+	Packets   uint64 `json:"packets"`        // Amount of packets which have been captured since the capture has been started
+}
+
+// WriterConfig configures the writer
+type WriterConfig struct {
+	LinkType   layers.LinkType // Link type of the captured packets (i.e. layers.LinkTypeEthernet for frames or layers.LinkTypeRaw for IP packets) (default is Ethernet)
+	SnapLength uint32          // Maximum amount of bytes to capture per packet (default is 65535)
+}
+
+// Writer writes packets to a pcap file or named pipe (i.e. for Wireshark); captures can be started and stopped at runtime
+type Writer struct {
+	config *WriterConfig
+	ctx    context.Context
+
+	capturing atomic.Bool
+
+	lock       sync.Mutex
+	generation uint64
+	path       string
+	file       *os.File
+	writer     *pcapgo.Writer
+	packets    uint64
+}
+
+// NewWriter creates the writer; no packets are captured until Start is called
+func NewWriter(
+	config *WriterConfig,
+	ctx context.Context,
+) *Writer {
+	if config == nil {
+		config = &WriterConfig{}
+	}
+
+	if config.LinkType == 0 {
+		config.LinkType = layers.LinkTypeEthernet
+	}
+
+	if config.SnapLength <= 0 {
+		config.SnapLength = 65535
+	}
+
+	w := &Writer{
+		config: config,
+		ctx:    ctx,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		if err := w.Stop(); err != nil {
+			log.Debug().Err(err).Msg("Could not stop capture, continuing")
+		}
+	}()
+
+	return w
+}
+
+// Start captures packets to a file or named pipe, stopping the previous capture if there is one; for named pipes, packets are only captured once a reader has opened the pipe
+func (w *Writer) Start(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return ErrMissingPath
+	}
+
+	if err := w.Stop(); err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.generation++
+	w.path = path
+	w.packets = 0
+
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		log.Info().Str("path", path).Msg("Waiting for reader to open named pipe before capturing")
+
+		// Opening a named pipe for writing blocks until it has been opened for reading
+		generation := w.generation
+		go func() {
+			file, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				log.Error().Err(err).Str("path", path).Msg("Could not open named pipe, stopping")
+
+				return
+			}
+
+			w.lock.Lock()
+			defer w.lock.Unlock()
+
+			if w.generation != generation {
+				_ = file.Close()
+
+				return
+			}
+
+			if err := w.open(file); err != nil {
+				log.Error().Err(err).Str("path", path).Msg("Could not start capture, stopping")
+
+				w.path = ""
+			}
+		}()
+
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		w.path = ""
+
+		return err
+	}
+
+	if err := w.open(file); err != nil {
+		w.path = ""
+
+		return err
+	}
+
+	return nil
+}
+
+func (w *Writer) open(file *os.File) error {
+	writer := pcapgo.NewWriter(file)
+	if err := writer.WriteFileHeader(w.config.SnapLength, w.config.LinkType); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	w.file = file
+	w.writer = writer
+	w.capturing.Store(true)
+
+	log.Info().Str("path", w.path).Msg("Started capture")
+
+	return nil
+}
+
+// Stop stops capturing packets and closes the file or named pipe
+func (w *Writer) Stop() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.stop()
+}
+
+func (w *Writer) stop() error {
+	w.generation++
+	w.capturing.Store(false)
+
+	path := w.path
+	w.path = ""
+	w.writer = nil
+
+	if w.file == nil {
+		return nil
+	}
+
+	file := w.file
+	w.file = nil
+
+	log.Info().Str("path", path).Uint64("packets", w.packets).Msg("Stopped capture")
+
+	return file.Close()
+}
+
+// Status returns the state of the capture
+func (w *Writer) Status() Status {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return Status{
+		Capturing: w.writer != nil,
+		Path:      w.path,
+		Packets:   w.packets,
+	}
+}
+
+// Write captures a packet if a capture has been started; if writing fails (i.e. because the reader of a named pipe has exited), the capture is stopped
+func (w *Writer) Write(packet []byte) {
+	if !w.capturing.Load() {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.writer == nil {
+		return
+	}
+
+	length := len(packet)
+	if uint32(length) > w.config.SnapLength {
+		packet = packet[:w.config.SnapLength]
+	}
+
+	if err := w.writer.WritePacket(gopacket.CaptureInfo{
+		Timestamp:     time.Now(),
+		CaptureLength: len(packet),
+		Length:        length,
+	}, packet); err != nil {
+		log.Error().Err(err).Str("path", w.path).Msg("Could not write to capture, stopping")
+
+		if err := w.stop(); err != nil {
+			log.Debug().Err(err).Msg("Could not close capture, continuing")
+		}
+
+		return
+	}
+
+	w.packets++
+}
+
+// ServeHTTP returns the status of the capture on GET, starts a capture to the path in the path query parameter on POST and stops the capture on DELETE
+func (w *Writer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := w.Start(req.URL.Query().Get("path")); err != nil {
+			if errors.Is(err, ErrMissingPath) {
+				rw.WriteHeader(http.StatusUnprocessableEntity)
+
+				return
+			}
+
+			log.Debug().Err(err).Msg("Could not start capture, continuing")
+
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+	case http.MethodDelete:
+		if err := w.Stop(); err != nil {
+			log.Debug().Err(err).Msg("Could not stop capture, continuing")
+
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(w.Status()); err != nil {
+		log.Debug().Err(err).Msg("Could not write capture status, continuing")
+	}
+}
@@ -0,0 +1,522 @@
+package wrtcpubsub
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	seenTTL = time.Minute // Time to remember publications for to prevent delivering them more than once
+)
+
+var (
+	ErrMessageTooLarge = errors.New("message is larger than the maximum message size") // The publication can't be sent because it is too large
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Message is a publication which has been received
+type Message struct {
+	PeerID  string // ID of the peer that has published the message
+	Topic   string // Topic to which the message has been published
+	Payload []byte // Content of the message
+}
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	Hops               int          // Maximum amount of peers a publication travels through (default is 1, which sends publications directly to subscribed peers; higher values gossip publications through peers which aren't connected to each other)
+	Fanout             int          // Amount of random peers to gossip a publication to if it may be forwarded (0 gossips to all peers)
+	MaxMessageSize     int          // Maximum size of a publication in bytes (default is 64 KiB; must be the same on all peers)
+	Buffer             int          // Amount of messages to buffer per subscription before dropping them (default is 128)
+}
+
+type remotePeer struct {
+	conn      io.ReadWriteCloser
+	writeLock sync.Mutex
+	topics    map[string]struct{}
+}
+
+func (p *remotePeer) write(b []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	_, err := p.conn.Write(b)
+
+	return err
+}
+
+// Subscription receives the messages published to a topic
+type Subscription struct {
+	topic    string
+	messages chan Message
+	adapter  *Adapter
+}
+
+// Messages returns a channel on which messages published to the topic will be sent
+func (s *Subscription) Messages() chan Message {
+	return s.messages
+}
+
+// Close stops receiving messages
+func (s *Subscription) Close() error {
+	s.adapter.unsubscribe(s)
+
+	return nil
+}
+
+// Adapter provides a publish/subscribe service
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.Adapter
+
+	ids chan string
+
+	idLock sync.Mutex
+	id     string
+
+	peersLock sync.Mutex
+	peers     map[string]*remotePeer
+
+	subscriptionsLock sync.Mutex
+	subscriptions     map[string]map[*Subscription]struct{}
+
+	seenLock sync.Mutex
+	seen     map[string]time.Time
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.Hops <= 0 {
+		config.Hops = 1
+	}
+
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = 64 * 1024
+	}
+
+	if config.Buffer <= 0 {
+		config.Buffer = 128
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		peers:         map[string]*remotePeer{},
+		subscriptions: map[string]map[*Subscription]struct{}{},
+		seen:          map[string]time.Time{},
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.PubSubPrimary},
+		a.config.AdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		t := time.NewTicker(seenTTL)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-t.C:
+				a.seenLock.Lock()
+				for id, seen := range a.seen {
+					if time.Since(seen) > seenTTL {
+						delete(a.seen, id)
+					}
+				}
+				a.seenLock.Unlock()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.subscriptionsLock.Lock()
+	for _, subscriptions := range a.subscriptions {
+		for subscription := range subscriptions {
+			close(subscription.messages)
+		}
+	}
+	a.subscriptions = map[string]map[*Subscription]struct{}{}
+	a.subscriptionsLock.Unlock()
+
+	return a.adapter.Close()
+}
+
+// Wait starts the transmission loop
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			a.idLock.Lock()
+			a.id = id
+			a.idLock.Unlock()
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			rp := &remotePeer{
+				conn:   peer.Conn,
+				topics: map[string]struct{}{},
+			}
+
+			a.peersLock.Lock()
+			a.peers[peer.PeerID] = rp
+			a.peersLock.Unlock()
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			go func() {
+				defer func() {
+					log.Debug().Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					a.peersLock.Lock()
+					if current, ok := a.peers[peer.PeerID]; ok && current == rp {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+				}()
+
+				// Tell the peer which topics to send publications for
+				a.subscriptionsLock.Lock()
+				topics := []string{}
+				for topic := range a.subscriptions {
+					topics = append(topics, topic)
+				}
+				a.subscriptionsLock.Unlock()
+
+				for _, topic := range topics {
+					if err := a.send(rp, v1.NewSubscribe(topic)); err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not write to peer, stopping")
+
+						return
+					}
+				}
+
+				buf := make([]byte, a.config.MaxMessageSize)
+				for {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not read from peer, stopping")
+
+						return
+					}
+
+					var message v1.Message
+					if err := json.Unmarshal(buf[:n], &message); err != nil {
+						log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal message, continuing")
+
+						continue
+					}
+
+					switch message.Type {
+					case v1.TypeSubscribe, v1.TypeUnsubscribe:
+						var subscription v1.Subscription
+						if err := json.Unmarshal(buf[:n], &subscription); err != nil {
+							log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal subscription, continuing")
+
+							continue
+						}
+
+						log.Trace().Str("peerID", peer.PeerID).Str("topic", subscription.Topic).Str("type", message.Type).Msg("Received subscription")
+
+						a.peersLock.Lock()
+						if message.Type == v1.TypeSubscribe {
+							rp.topics[subscription.Topic] = struct{}{}
+						} else {
+							delete(rp.topics, subscription.Topic)
+						}
+						a.peersLock.Unlock()
+					case v1.TypePublication:
+						var publication v1.Publication
+						if err := json.Unmarshal(buf[:n], &publication); err != nil {
+							log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not unmarshal publication, continuing")
+
+							continue
+						}
+
+						if !a.markSeen(publication.ID) {
+							log.Trace().Str("peerID", peer.PeerID).Str("id", publication.ID).Msg("Discarding publication which has already been received, continuing")
+
+							continue
+						}
+
+						log.Trace().Str("peerID", peer.PeerID).Str("topic", publication.Topic).Msg("Received publication")
+
+						a.deliver(Message{
+							PeerID:  publication.Origin,
+							Topic:   publication.Topic,
+							Payload: publication.Payload,
+						})
+
+						if publication.Hops > 0 {
+							publication.Hops--
+
+							if err := a.forward(&publication, peer.PeerID); err != nil {
+								log.Debug().Err(err).Str("peerID", peer.PeerID).Msg("Could not forward publication, continuing")
+							}
+						}
+					default:
+						log.Debug().Str("peerID", peer.PeerID).Str("type", message.Type).Msg("Got message with unknown type, continuing")
+					}
+				}
+			}()
+		}
+	}
+}
+
+// Subscribe starts receiving messages published to a topic
+func (a *Adapter) Subscribe(topic string) *Subscription {
+	subscription := &Subscription{
+		topic:    topic,
+		messages: make(chan Message, a.config.Buffer),
+		adapter:  a,
+	}
+
+	a.subscriptionsLock.Lock()
+	subscriptions, ok := a.subscriptions[topic]
+	if !ok {
+		subscriptions = map[*Subscription]struct{}{}
+		a.subscriptions[topic] = subscriptions
+	}
+	subscriptions[subscription] = struct{}{}
+	a.subscriptionsLock.Unlock()
+
+	if !ok {
+		a.broadcast(v1.NewSubscribe(topic))
+	}
+
+	return subscription
+}
+
+func (a *Adapter) unsubscribe(subscription *Subscription) {
+	a.subscriptionsLock.Lock()
+	subscriptions, ok := a.subscriptions[subscription.topic]
+	if !ok {
+		a.subscriptionsLock.Unlock()
+
+		return
+	}
+
+	if _, ok := subscriptions[subscription]; !ok {
+		a.subscriptionsLock.Unlock()
+
+		return
+	}
+
+	delete(subscriptions, subscription)
+	close(subscription.messages)
+
+	last := len(subscriptions) == 0
+	if last {
+		delete(a.subscriptions, subscription.topic)
+	}
+	a.subscriptionsLock.Unlock()
+
+	if last {
+		a.broadcast(v1.NewUnsubscribe(subscription.topic))
+	}
+}
+
+// Publish sends a message to all peers which have subscribed to a topic
+func (a *Adapter) Publish(topic string, payload []byte) error {
+	a.idLock.Lock()
+	id := a.id
+	a.idLock.Unlock()
+
+	publication := v1.NewPublication(uuid.NewString(), id, topic, payload, a.config.Hops-1)
+	a.markSeen(publication.ID)
+
+	log.Trace().Str("topic", topic).Int("len", len(payload)).Msg("Publishing message")
+
+	return a.forward(publication, "")
+}
+
+// forward sends a publication to peers other than the one it has been received from
+func (a *Adapter) forward(publication *v1.Publication, from string) error {
+	p, err := json.Marshal(publication)
+	if err != nil {
+		return err
+	}
+
+	if len(p) > a.config.MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	targets := map[string]*remotePeer{}
+	a.peersLock.Lock()
+	for peerID, peer := range a.peers {
+		if peerID == from || peerID == publication.Origin {
+			continue
+		}
+
+		// Peers which may not forward the publication only need it if they have subscribed to its topic
+		if publication.Hops <= 0 {
+			if _, ok := peer.topics[publication.Topic]; !ok {
+				continue
+			}
+		}
+
+		targets[peerID] = peer
+	}
+	a.peersLock.Unlock()
+
+	if publication.Hops > 0 && a.config.Fanout > 0 && len(targets) > a.config.Fanout {
+		peerIDs := []string{}
+		for peerID := range targets {
+			peerIDs = append(peerIDs, peerID)
+		}
+
+		rand.Shuffle(len(peerIDs), func(i, j int) {
+			peerIDs[i], peerIDs[j] = peerIDs[j], peerIDs[i]
+		})
+
+		for _, peerID := range peerIDs[a.config.Fanout:] {
+			delete(targets, peerID)
+		}
+	}
+
+	for peerID, peer := range targets {
+		if err := peer.write(p); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+
+	return nil
+}
+
+func (a *Adapter) broadcast(message interface{}) {
+	a.peersLock.Lock()
+	peers := map[string]*remotePeer{}
+	for peerID, peer := range a.peers {
+		peers[peerID] = peer
+	}
+	a.peersLock.Unlock()
+
+	for peerID, peer := range peers {
+		if err := a.send(peer, message); err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not write to peer, continuing")
+		}
+	}
+}
+
+func (a *Adapter) send(peer *remotePeer, message interface{}) error {
+	p, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return peer.write(p)
+}
+
+// markSeen remembers a publication and returns whether it hasn't been seen before
+func (a *Adapter) markSeen(id string) bool {
+	a.seenLock.Lock()
+	defer a.seenLock.Unlock()
+
+	if _, ok := a.seen[id]; ok {
+		return false
+	}
+
+	a.seen[id] = time.Now()
+
+	return true
+}
+
+func (a *Adapter) deliver(message Message) {
+	a.subscriptionsLock.Lock()
+	defer a.subscriptionsLock.Unlock()
+
+	for subscription := range a.subscriptions[message.Topic] {
+		select {
+		case subscription.messages <- message:
+		default:
+			log.Debug().Str("topic", message.Topic).Str("peerID", message.PeerID).Msg("Could not deliver message because the subscription's buffer is full, dropping")
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package wrtcrly
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/pojntfx/weron/pkg/wrtchealth"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errMissingCommunity = errors.New("missing community")
+	errMissingID        = errors.New("missing ID")
+	errInvalidToken     = errors.New("invalid token")
+)
+
+const (
+	defaultMaxMessageSize  = 256 * 1024 // Default maximum size of a message from a client in bytes
+	defaultSendQueueLength = 1024       // Default maximum amount of messages to queue for a client
+)
+
+// RelayConfig configures the relay
+type RelayConfig struct {
+	Heartbeat       time.Duration // Duration between heartbeats
+	Token           string        // Bearer token which clients must send to connect (empty allows all clients)
+	MaxMessageSize  int64         // Maximum size of a message from a client in bytes; clients which send larger messages are disconnected (0 uses the default of 256 KiB)
+	SendQueueLength int           // Maximum amount of messages to queue for a client; messages to clients which can't keep up are dropped (0 uses the default of 1024)
+	TLSCertFile     string        // Path to the TLS certificate to serve HTTPS with (HTTP is served if empty)
+	TLSKeyFile      string        // Path to the TLS key to serve HTTPS with (HTTP is served if empty)
+
+	OnConnect    func(raddr string, community string, id string)                  // Handler to be called when a client has connected to the relay
+	OnDisconnect func(raddr string, community string, id string, err interface{}) // Handler to be called when a client has disconnected from the relay
+}
+
+type clientKey struct {
+	community string
+	id        string
+}
+
+type client struct {
+	version     string
+	messageType int
+	send        chan []byte
+	closer      chan struct{}
+	closeOnce   sync.Once
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.closer)
+	})
+}
+
+// Relay relays the payloads of channels between peers which can't establish a direct connection; unlike TURN, it relays the messages of channels instead of packets, and clients connect to it over WebSockets (and thus through HTTP proxies and firewalls which only allow HTTPS)
+type Relay struct {
+	laddr  string
+	config *RelayConfig
+	ctx    context.Context
+
+	errs     chan error
+	srv      *http.Server
+	listener net.Listener
+	upgrader websocket.Upgrader
+
+	clientsLock sync.Mutex
+	clients     map[clientKey]*client
+
+	health *wrtchealth.Checker
+}
+
+// NewRelay creates the relay
+func NewRelay(
+	laddr string,
+	config *RelayConfig,
+	ctx context.Context,
+) *Relay {
+	if config == nil {
+		config = &RelayConfig{
+			Heartbeat: time.Second * 10,
+		}
+	}
+
+	if config.Heartbeat <= 0 {
+		config.Heartbeat = time.Second * 10
+	}
+
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = defaultMaxMessageSize
+	}
+
+	if config.SendQueueLength <= 0 {
+		config.SendQueueLength = defaultSendQueueLength
+	}
+
+	return &Relay{
+		laddr:  laddr,
+		config: config,
+		ctx:    ctx,
+
+		errs: make(chan error),
+
+		clients: map[clientKey]*client{},
+
+		health: wrtchealth.NewChecker(wrtchealth.ConditionListening),
+	}
+}
+
+// Open starts listening
+func (r *Relay) Open() error {
+	log.Trace().Msg("Opening relay")
+
+	addr, err := net.ResolveTCPAddr("tcp", r.laddr)
+	if err != nil {
+		return err
+	}
+
+	r.upgrader = websocket.Upgrader{
+		Subprotocols: websocketapi.Versions,
+	}
+
+	r.srv = &http.Server{
+		Addr:    addr.String(),
+		Handler: r,
+	}
+
+	listener, err := net.Listen("tcp", r.srv.Addr)
+	if err != nil {
+		return err
+	}
+	r.listener = listener
+
+	r.health.Set(wrtchealth.ConditionListening, true)
+
+	go func() {
+		var err error
+		if strings.TrimSpace(r.config.TLSCertFile) != "" && strings.TrimSpace(r.config.TLSKeyFile) != "" {
+			err = r.srv.ServeTLS(listener, r.config.TLSCertFile, r.config.TLSKeyFile)
+		} else {
+			err = r.srv.Serve(listener)
+		}
+
+		if err != nil {
+			if err == http.ErrServerClosed {
+				close(r.errs)
+
+				return
+			}
+
+			r.errs <- err
+
+			return
+		}
+	}()
+
+	return nil
+}
+
+// ServeHTTP relays the messages of a client
+func (r *Relay) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if wrtchealth.IsCheck(req) {
+		r.health.ServeHTTP(rw, req)
+
+		return
+	}
+
+	raddr := uuid.NewString()
+
+	community := req.URL.Query().Get("community")
+	id := req.URL.Query().Get("id")
+
+	var err interface{}
+	defer func() {
+		if e := recover(); e != nil {
+			err = e
+		}
+
+		log.Debug().
+			Str("address", raddr).
+			Str("community", community).
+			Str("id", id).
+			Interface("err", err).
+			Msg("Closed connection for client")
+
+		if r.config.OnDisconnect != nil {
+			r.config.OnDisconnect(raddr, community, id, err)
+		}
+	}()
+
+	if strings.TrimSpace(r.config.Token) != "" {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(r.config.Token)) != 1 {
+			http.Error(rw, errInvalidToken.Error(), http.StatusUnauthorized)
+
+			err = errInvalidToken
+
+			return
+		}
+	}
+
+	if strings.TrimSpace(community) == "" {
+		http.Error(rw, errMissingCommunity.Error(), http.StatusUnprocessableEntity)
+
+		err = errMissingCommunity
+
+		return
+	}
+
+	if strings.TrimSpace(id) == "" {
+		http.Error(rw, errMissingID.Error(), http.StatusUnprocessableEntity)
+
+		err = errMissingID
+
+		return
+	}
+
+	conn, e := r.upgrader.Upgrade(rw, req, nil)
+	if e != nil {
+		err = e
+
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(r.config.MaxMessageSize)
+
+	// Clients which don't support version negotiation always use JSON
+	c := &client{
+		version:     conn.Subprotocol(),
+		messageType: websocket.BinaryMessage,
+		send:        make(chan []byte, r.config.SendQueueLength),
+		closer:      make(chan struct{}),
+	}
+	if c.version != websocketapi.VersionBinary {
+		c.version = websocketapi.VersionJSON
+		c.messageType = websocket.TextMessage
+	}
+
+	key := clientKey{community, id}
+
+	// Clients which reconnect replace their old connection
+	r.clientsLock.Lock()
+	if old, ok := r.clients[key]; ok {
+		old.close()
+	}
+	r.clients[key] = c
+	r.clientsLock.Unlock()
+
+	defer func() {
+		r.clientsLock.Lock()
+		if current, ok := r.clients[key]; ok && current == c {
+			delete(r.clients, key)
+		}
+		r.clientsLock.Unlock()
+
+		c.close()
+	}()
+
+	log.Debug().
+		Str("address", raddr).
+		Str("community", community).
+		Str("id", id).
+		Str("version", c.version).
+		Msg("Connected to client")
+
+	if r.config.OnConnect != nil {
+		r.config.OnConnect(raddr, community, id)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(r.config.Heartbeat)); err != nil {
+		panic(err)
+	}
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(r.config.Heartbeat))
+	})
+
+	inputs := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(inputs)
+
+		for {
+			_, p, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			select {
+			case inputs <- p:
+			case <-c.closer:
+				return
+			}
+		}
+	}()
+
+	pings := time.NewTicker(r.config.Heartbeat / 2)
+	defer pings.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-c.closer:
+			return
+		case e := <-errs:
+			err = e
+
+			return
+		case input := <-inputs:
+			r.forward(key, input)
+		case p := <-c.send:
+			if err := conn.SetWriteDeadline(time.Now().Add(r.config.Heartbeat)); err != nil {
+				panic(err)
+			}
+
+			if err := conn.WriteMessage(c.messageType, p); err != nil {
+				panic(err)
+			}
+		case <-pings.C:
+			if err := conn.SetWriteDeadline(time.Now().Add(r.config.Heartbeat)); err != nil {
+				panic(err)
+			}
+
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// forward sends a relayed message to its recipient in the community of the sender
+func (r *Relay) forward(from clientKey, input []byte) {
+	var message websocketapi.Message
+	if err := websocketapi.Unmarshal(input, &message); err != nil {
+		log.Debug().Err(err).Str("id", from.id).Msg("Could not unmarshal message from client, continuing")
+
+		return
+	}
+
+	if message.Type != websocketapi.TypeRelay && message.Type != websocketapi.TypeRelayClose {
+		log.Debug().Str("id", from.id).Str("type", message.Type).Msg("Got message with unknown type from client, continuing")
+
+		return
+	}
+
+	var relay websocketapi.Relay
+	if err := websocketapi.Unmarshal(input, &relay); err != nil {
+		log.Debug().Err(err).Str("id", from.id).Msg("Could not unmarshal relayed payload from client, continuing")
+
+		return
+	}
+
+	// Clients can only send messages as themselves
+	relay.From = from.id
+
+	r.clientsLock.Lock()
+	to, ok := r.clients[clientKey{from.community, relay.To}]
+	r.clientsLock.Unlock()
+
+	if !ok {
+		log.Trace().Str("id", from.id).Str("to", relay.To).Msg("Could not find recipient of relayed payload, dropping")
+
+		return
+	}
+
+	p, err := websocketapi.Marshal(to.version, relay)
+	if err != nil {
+		log.Debug().Err(err).Str("id", from.id).Msg("Could not marshal relayed payload, continuing")
+
+		return
+	}
+
+	select {
+	case to.send <- p:
+	default:
+		log.Debug().Str("id", from.id).Str("to", relay.To).Msg("Could not relay payload because the recipient's queue is full, dropping")
+	}
+}
+
+// Addr returns the address the relay is listening on (i.e. to get the port if it has been chosen by the system)
+func (r *Relay) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Close stops listening and disconnects all clients
+func (r *Relay) Close() error {
+	log.Trace().Msg("Closing relay")
+
+	r.health.Set(wrtchealth.ConditionListening, false)
+
+	r.clientsLock.Lock()
+	for _, c := range r.clients {
+		c.close()
+	}
+	r.clientsLock.Unlock()
+
+	if err := r.srv.Shutdown(r.ctx); err != nil {
+		if err != context.Canceled {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Wait waits for any errors
+func (r *Relay) Wait() error {
+	for err := range r.errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
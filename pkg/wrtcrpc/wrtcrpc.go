@@ -0,0 +1,290 @@
+package wrtcrpc
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "github.com/pojntfx/weron/pkg/api/webrtc/v1"
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcmux"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrAlreadyOpened = errors.New("services can only be registered before the adapter is opened") // The services are advertised during introduction, so they can't change afterwards
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.AdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+}
+
+// Adapter calls functions on peers and serves the registered services to them; calls use JSON-RPC 1.0 (see net/rpc/jsonrpc) over multiplexed streams
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcmux.Adapter
+
+	server *rpc.Server
+
+	servicesLock sync.Mutex
+	services     []string
+	opened       bool
+
+	clientsLock sync.Mutex
+	clients     map[string]*rpc.Client
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if config.AdapterConfig == nil {
+		config.AdapterConfig = &wrtcconn.AdapterConfig{
+			Timeout: time.Second * 10,
+		}
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		server: rpc.NewServer(),
+
+		services: []string{},
+
+		clients: map[string]*rpc.Client{},
+	}
+}
+
+// Register publishes the methods of the receiver as a service (see rpc.Register) and advertises it to peers
+func (a *Adapter) Register(rcvr interface{}) error {
+	return a.register("", rcvr)
+}
+
+// RegisterName publishes the methods of the receiver as a service with a name (see rpc.RegisterName) and advertises it to peers
+func (a *Adapter) RegisterName(name string, rcvr interface{}) error {
+	return a.register(name, rcvr)
+}
+
+func (a *Adapter) register(name string, rcvr interface{}) error {
+	a.servicesLock.Lock()
+	defer a.servicesLock.Unlock()
+
+	if a.opened {
+		return ErrAlreadyOpened
+	}
+
+	if name == "" {
+		if err := a.server.Register(rcvr); err != nil {
+			return err
+		}
+
+		// net/rpc uses the name of the concrete type as the name of the service
+		name = reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	} else if err := a.server.RegisterName(name, rcvr); err != nil {
+		return err
+	}
+
+	a.services = append(a.services, name)
+
+	return nil
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.servicesLock.Lock()
+	a.opened = true
+	for _, service := range a.services {
+		a.config.Services = append(a.config.Services, v1.Service{
+			Name:    service,
+			Channel: services.MuxPrimary,
+		})
+	}
+	a.servicesLock.Unlock()
+
+	a.adapter = wrtcmux.NewAdapter(
+		a.signaler,
+		a.key,
+		a.ice,
+		&wrtcmux.AdapterConfig{
+			AdapterConfig:     a.config.AdapterConfig,
+			OnSignalerConnect: a.config.OnSignalerConnect,
+			OnPeerConnect:     a.config.OnPeerConnect,
+			OnPeerDisconnected: func(peerID string) {
+				a.clientsLock.Lock()
+				if client, ok := a.clients[peerID]; ok {
+					_ = client.Close()
+
+					delete(a.clients, peerID)
+				}
+				a.clientsLock.Unlock()
+
+				if a.config.OnPeerDisconnected != nil {
+					a.config.OnPeerDisconnected(peerID)
+				}
+			},
+		},
+		a.ctx,
+	)
+
+	return a.adapter.Open()
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	a.cancel()
+
+	if a.adapter == nil {
+		return nil
+	}
+
+	return a.adapter.Close()
+}
+
+// Wait starts serving calls from peers
+func (a *Adapter) Wait() error {
+	go func() {
+		for {
+			stream, err := a.adapter.AcceptStream()
+			if err != nil {
+				log.Trace().Err(err).Msg("Could not accept stream, stopping")
+
+				return
+			}
+
+			log.Debug().Str("peerID", stream.PeerID).Msg("Serving calls from peer")
+
+			go a.server.ServeCodec(jsonrpc.NewServerCodec(stream))
+		}
+	}()
+
+	return a.adapter.Wait()
+}
+
+// Call calls a method (in format Service.Method) on a peer and waits for it to return or the context to be cancelled
+func (a *Adapter) Call(ctx context.Context, peerID string, serviceMethod string, args interface{}, reply interface{}) error {
+	client, err := a.getClient(peerID)
+	if err != nil {
+		return err
+	}
+
+	call := client.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.Done:
+		if call.Error == rpc.ErrShutdown {
+			// Open a new stream for the next call
+			a.clientsLock.Lock()
+			if current, ok := a.clients[peerID]; ok && current == client {
+				delete(a.clients, peerID)
+			}
+			a.clientsLock.Unlock()
+		}
+
+		return call.Error
+	}
+}
+
+// getClient returns the client for a peer; all calls to a peer share one stream
+func (a *Adapter) getClient(peerID string) (*rpc.Client, error) {
+	a.clientsLock.Lock()
+	defer a.clientsLock.Unlock()
+
+	if client, ok := a.clients[peerID]; ok {
+		return client, nil
+	}
+
+	stream, err := a.adapter.OpenStream(peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := rpc.NewClientWithCodec(jsonrpc.NewClientCodec(stream))
+	a.clients[peerID] = client
+
+	return client, nil
+}
+
+// Services returns the services a peer has advertised
+func (a *Adapter) Services(peerID string) ([]string, error) {
+	raw, err := a.adapter.Metadata(peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	announced, err := wrtcconn.ParseServices(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, service := range announced {
+		if service.Channel == services.MuxPrimary {
+			names = append(names, service.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// Peers returns the IDs of the connected peers which have advertised a service, sorted by their ID
+func (a *Adapter) Peers(service string) []string {
+	peerIDs := []string{}
+	for _, peerID := range a.adapter.Peers() {
+		services, err := a.Services(peerID)
+		if err != nil {
+			log.Debug().Err(err).Str("peerID", peerID).Msg("Could not get services of peer, skipping")
+
+			continue
+		}
+
+		for _, s := range services {
+			if s == service {
+				peerIDs = append(peerIDs, peerID)
+
+				break
+			}
+		}
+	}
+
+	sort.Strings(peerIDs)
+
+	return peerIDs
+}
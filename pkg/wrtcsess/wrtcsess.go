@@ -0,0 +1,210 @@
+package wrtcsess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	openTimeout = time.Second * 5 // Time to wait for other processes to release the file
+)
+
+var (
+	sessionsBucket = []byte("sessions")
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Session is a connection to a peer from the start of its negotiation until it has been closed
+type Session struct {
+	Community       string     `json:"community"`                 // Community in which the peer has been connected
+	PeerID          string     `json:"peerID"`                    // ID of the peer
+	Name            string     `json:"name,omitempty"`            // Human-readable name of the peer (empty if the peer has not set one)
+	Start           time.Time  `json:"start"`                     // Time at which the negotiation has started
+	ConnectedAt     *time.Time `json:"connectedAt,omitempty"`     // Time at which the connection has been established (nil if it never has)
+	End             time.Time  `json:"end"`                       // Time at which the connection has been closed
+	BytesSent       uint64     `json:"bytesSent"`                 // Total amount of bytes sent to the peer
+	BytesReceived   uint64     `json:"bytesReceived"`             // Total amount of bytes received from the peer
+	LocalCandidate  string     `json:"localCandidate,omitempty"`  // Type of the local candidate of the selected pair (host, srflx, prflx or relay; empty if no pair has been selected)
+	RemoteCandidate string     `json:"remoteCandidate,omitempty"` // Type of the remote candidate of the selected pair
+	Relayed         bool       `json:"relayed,omitempty"`         // Whether payloads have been relayed through the signaler or a data relay
+	Reason          string     `json:"reason"`                    // Reason for which the connection has been closed (see wrtcconn.ReasonDisconnected etc.)
+}
+
+// Duration returns how long the session has been connected for (0 if it never has)
+func (s Session) Duration() time.Duration {
+	if s.ConnectedAt == nil {
+		return 0
+	}
+
+	return s.End.Sub(*s.ConnectedAt)
+}
+
+// Query selects sessions
+type Query struct {
+	Community string    // Community of the sessions (empty matches all communities)
+	Peer      string    // ID or name of the peer (empty matches all peers)
+	Since     time.Time // Earliest end of the sessions (zero matches all sessions)
+	Until     time.Time // Latest end of the sessions (zero matches all sessions)
+}
+
+func (q Query) matches(s Session) bool {
+	if strings.TrimSpace(q.Community) != "" && s.Community != q.Community {
+		return false
+	}
+
+	if strings.TrimSpace(q.Peer) != "" && s.PeerID != q.Peer && s.Name != q.Peer {
+		return false
+	}
+
+	return true
+}
+
+// LogConfig configures the log
+type LogConfig struct {
+	Retention time.Duration // Time to keep sessions for after they have ended (0 keeps them forever)
+}
+
+// Log persists sessions to a bbolt file; the file is only opened while sessions are written or queried, so that other processes can query it while an adapter is running
+type Log struct {
+	path   string
+	config *LogConfig
+
+	lock sync.Mutex
+}
+
+// NewLog creates the log
+func NewLog(
+	path string,
+	config *LogConfig,
+) *Log {
+	if config == nil {
+		config = &LogConfig{}
+	}
+
+	return &Log{
+		path:   path,
+		config: config,
+	}
+}
+
+// Add persists a session and removes the sessions which have expired
+func (l *Log) Add(session Session) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	log.Trace().Str("path", l.path).Str("peerID", session.PeerID).Msg("Recording session")
+
+	db, err := bolt.Open(l.path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(sessionsBucket)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(key(session), value); err != nil {
+			return err
+		}
+
+		if l.config.Retention <= 0 {
+			return nil
+		}
+
+		// Keys start with the end of the session, so the expired sessions are at the beginning of the bucket
+		expired := timeKey(time.Now().Add(-l.config.Retention))
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, expired) < 0; k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Query returns the sessions which match the query, ordered by their end
+func (l *Log) Query(query Query) ([]Session, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// Opening a file which doesn't exist would create it, which fails in read-only mode
+	if _, err := os.Stat(l.path); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(l.path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	sessions := []Session{}
+	if err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sessionsBucket)
+		if b == nil {
+			return nil
+		}
+
+		var until []byte
+		if !query.Until.IsZero() {
+			until = timeKey(query.Until)
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(timeKey(query.Since)); k != nil; k, v = c.Next() {
+			if until != nil && bytes.Compare(k[:len(until)], until) > 0 {
+				break
+			}
+
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				log.Debug().Err(err).Msg("Could not unmarshal session, skipping")
+
+				continue
+			}
+
+			if query.matches(session) {
+				sessions = append(sessions, session)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	if !t.IsZero() {
+		binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	}
+
+	return k
+}
+
+// key orders sessions by their end; the community and peer ID make the keys of sessions which have ended at the same time unique
+func key(session Session) []byte {
+	return append(timeKey(session.End), []byte(session.Community+"/"+session.PeerID)...)
+}
@@ -0,0 +1,268 @@
+package wrtcsgl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pojntfx/go-auth-utils/pkg/authn"
+	"github.com/pojntfx/weron/internal/brokers"
+	"github.com/pojntfx/weron/internal/persisters"
+)
+
+const (
+	ApplyPath = "/apply" // Path of the declarative management API
+
+	ChangeCreate = "create" // The resource doesn't exist yet and is created
+	ChangeUpdate = "update" // The resource exists but differs from the spec and is updated
+	ChangeDelete = "delete" // The resource isn't in the spec and is deleted
+
+	ResourceCommunity = "community" // The change applies to a persistent community
+	ResourceLease     = "lease"     // The change applies to a lease in a persistent community
+)
+
+var (
+	ErrInvalidSpec = errors.New("invalid spec") // The spec is missing IDs or passwords, contains duplicates or contains invalid IPs
+)
+
+// LeaseSpec is the desired state of a lease
+type LeaseSpec struct {
+	ID   string   `json:"id"`   // ID of the peer
+	IPs  []string `json:"ips"`  // IPs to reserve for the peer (in CIDR notation)
+	Name string   `json:"name"` // Name to reserve for the peer
+}
+
+// CommunitySpec is the desired state of a persistent community
+type CommunitySpec struct {
+	ID        string      `json:"id"`                  // ID of the community
+	Password  string      `json:"password"`            // Password for the community; clients which have joined with another password are kicked if it changes
+	ExpiresAt *time.Time  `json:"expiresAt,omitempty"` // Time after which the community is deleted and its peers are kicked (nil if the community never expires)
+	Leases    []LeaseSpec `json:"leases,omitempty"`    // Leases of the community; leases which are not in the spec are deleted (existing leases are kept if nil)
+}
+
+// Spec is the desired state of the persistent communities on a signaler
+type Spec struct {
+	Communities []CommunitySpec `json:"communities"` // Persistent communities to create or update
+	Prune       bool            `json:"prune"`       // Whether to delete persistent communities which are not in the spec
+}
+
+// Change is a difference between the spec and the state of the signaler
+type Change struct {
+	Action    string `json:"action"`       // Action which is taken to reconcile the difference (create, update or delete)
+	Resource  string `json:"resource"`     // Kind of resource which is changed (community or lease)
+	Community string `json:"community"`    // ID of the community
+	ID        string `json:"id,omitempty"` // ID of the lease (empty for communities)
+}
+
+// validate checks that a spec can be applied before any changes are made
+func (s Spec) validate() error {
+	communities := map[string]struct{}{}
+	for _, c := range s.Communities {
+		if strings.TrimSpace(c.ID) == "" || strings.TrimSpace(c.Password) == "" {
+			return ErrInvalidSpec
+		}
+
+		if _, ok := communities[c.ID]; ok {
+			return ErrInvalidSpec
+		}
+		communities[c.ID] = struct{}{}
+
+		leases := map[string]struct{}{}
+		for _, l := range c.Leases {
+			if strings.TrimSpace(l.ID) == "" {
+				return ErrInvalidSpec
+			}
+
+			if _, ok := leases[l.ID]; ok {
+				return ErrInvalidSpec
+			}
+			leases[l.ID] = struct{}{}
+
+			for _, ip := range l.IPs {
+				if _, _, err := net.ParseCIDR(ip); err != nil {
+					return ErrInvalidSpec
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func sameExpiry(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	// Databases don't necessarily store sub-second precision
+	return a.Unix() == b.Unix()
+}
+
+func sameLease(lease persisters.Lease, spec LeaseSpec) bool {
+	if lease.Name != spec.Name || len(lease.IPs) != len(spec.IPs) {
+		return false
+	}
+
+	ips := append([]string{}, lease.IPs...)
+	specIPs := append([]string{}, spec.IPs...)
+	sort.Strings(ips)
+	sort.Strings(specIPs)
+
+	for i := range ips {
+		if ips[i] != specIPs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply reconciles the persistent communities and their leases with a spec and returns the changes which were made; if dryRun is set, the changes are only computed; applying the same spec again makes no changes
+func (s *Signaler) Apply(ctx context.Context, spec Spec, dryRun bool) ([]Change, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	current, err := s.db.GetCommunities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]persisters.Community{}
+	for _, c := range current {
+		existing[c.ID] = c
+	}
+
+	changes := []Change{}
+	for _, c := range spec.Communities {
+		e, ok := existing[c.ID]
+		if !ok {
+			changes = append(changes, Change{ChangeCreate, ResourceCommunity, c.ID, ""})
+
+			if !dryRun {
+				if _, err := s.db.CreatePersistentCommunity(ctx, c.ID, c.Password, c.ExpiresAt); err != nil {
+					return changes, err
+				}
+			}
+
+			for _, l := range c.Leases {
+				changes = append(changes, Change{ChangeCreate, ResourceLease, c.ID, l.ID})
+
+				if !dryRun {
+					if _, err := s.db.CreateLease(ctx, c.ID, l.ID, l.IPs, l.Name); err != nil {
+						return changes, err
+					}
+				}
+			}
+
+			continue
+		}
+
+		passwordChanged := false
+		if err := s.db.ValidatePassword(ctx, c.ID, c.Password); err != nil {
+			if err != authn.ErrWrongPassword {
+				return changes, err
+			}
+
+			passwordChanged = true
+		}
+
+		if passwordChanged || !e.Persistent || !sameExpiry(e.ExpiresAt, c.ExpiresAt) {
+			changes = append(changes, Change{ChangeUpdate, ResourceCommunity, c.ID, ""})
+
+			if !dryRun {
+				if _, err := s.db.UpdatePersistentCommunity(ctx, c.ID, c.Password, c.ExpiresAt); err != nil {
+					return changes, err
+				}
+
+				// Clients which have joined with the old password have to join again with the new one
+				if passwordChanged {
+					if err := s.broker.PublishKick(ctx, brokers.Kick{
+						Community: c.ID,
+					}); err != nil {
+						return changes, err
+					}
+				}
+			}
+		}
+
+		if c.Leases == nil {
+			continue
+		}
+
+		leases, err := s.db.GetLeases(ctx, c.ID)
+		if err != nil {
+			return changes, err
+		}
+
+		existingLeases := map[string]persisters.Lease{}
+		for _, l := range leases {
+			existingLeases[l.ID] = l
+		}
+
+		for _, l := range c.Leases {
+			action := ChangeCreate
+			if el, ok := existingLeases[l.ID]; ok {
+				delete(existingLeases, l.ID)
+
+				if sameLease(el, l) {
+					continue
+				}
+
+				action = ChangeUpdate
+			}
+
+			changes = append(changes, Change{action, ResourceLease, c.ID, l.ID})
+
+			if !dryRun {
+				if _, err := s.db.CreateLease(ctx, c.ID, l.ID, l.IPs, l.Name); err != nil {
+					return changes, err
+				}
+			}
+		}
+
+		for id := range existingLeases {
+			changes = append(changes, Change{ChangeDelete, ResourceLease, c.ID, id})
+
+			if !dryRun {
+				if err := s.db.DeleteLease(ctx, c.ID, id); err != nil && err != sql.ErrNoRows {
+					return changes, err
+				}
+			}
+		}
+	}
+
+	if spec.Prune {
+		desired := map[string]struct{}{}
+		for _, c := range spec.Communities {
+			desired[c.ID] = struct{}{}
+		}
+
+		// Ephemeral communities are owned by their clients, so they are never pruned
+		for _, c := range current {
+			if _, ok := desired[c.ID]; ok || !c.Persistent {
+				continue
+			}
+
+			changes = append(changes, Change{ChangeDelete, ResourceCommunity, c.ID, ""})
+
+			if !dryRun {
+				if err := s.db.DeleteCommunity(ctx, c.ID); err != nil && err != sql.ErrNoRows {
+					return changes, err
+				}
+
+				if err := s.broker.PublishKick(ctx, brokers.Kick{
+					Community: c.ID,
+				}); err != nil {
+					return changes, err
+				}
+			}
+		}
+	}
+
+	return changes, nil
+}
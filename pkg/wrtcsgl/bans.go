@@ -0,0 +1,283 @@
+package wrtcsgl
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+)
+
+var (
+	ErrMissingBanTarget = errors.New("missing IP or peer ID to ban") // Neither an IP nor a peer ID has been given
+	ErrInvalidIP        = errors.New("invalid IP")                   // The IP to ban could not be parsed
+	ErrBanNotFound      = errors.New("ban not found")                // There is no ban for the IP or peer ID
+)
+
+// Ban prevents clients with an IP or peer ID from connecting to the signaler
+type Ban struct {
+	IP        string     `json:"ip"`        // IP of the banned clients
+	PeerID    string     `json:"peerId"`    // ID of the banned peer (only applies to clients which send their ID, i.e. with selective signaling)
+	ExpiresAt *time.Time `json:"expiresAt"` // Time after which the ban is lifted (nil if the ban is permanent)
+}
+
+func (b Ban) key() string {
+	if b.IP != "" {
+		return "ip:" + b.IP
+	}
+
+	return "id:" + b.PeerID
+}
+
+// newBan creates a ban for an IP or, if no IP is given, for a peer ID
+func newBan(ip string, peerID string) (Ban, error) {
+	if strings.TrimSpace(ip) != "" {
+		parsed := net.ParseIP(strings.TrimSpace(ip))
+		if parsed == nil {
+			return Ban{}, ErrInvalidIP
+		}
+
+		return Ban{IP: parsed.String()}, nil
+	}
+
+	if strings.TrimSpace(peerID) != "" {
+		return Ban{PeerID: strings.TrimSpace(peerID)}, nil
+	}
+
+	return Ban{}, ErrMissingBanTarget
+}
+
+func (b Ban) expired() bool {
+	return b.ExpiresAt != nil && time.Now().After(*b.ExpiresAt)
+}
+
+// parseNetworks parses CIDRs; plain IPs are treated as networks with a single address
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	parsed := []*net.IPNet{}
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, ErrInvalidIP
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, n)
+	}
+
+	return parsed, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getClientIP returns the IP of the client which has sent the request; if the request has been sent by a trusted proxy, the address which the proxy has recorded in the Forwarded or X-Forwarded-For header is used instead, skipping further trusted proxies from right to left
+func getClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	hops := getForwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		// Clients can send the headers themselves, so addresses before the first untrusted hop can't be trusted
+		hop := net.ParseIP(hops[i])
+		if hop == nil {
+			return ip
+		}
+
+		ip = hop
+		if !containsIP(trustedProxies, ip) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+// getForwardedFor returns the addresses of the clients and proxies which a request has been forwarded for, from the client to the last proxy; the Forwarded header (RFC 7239) takes precedence over X-Forwarded-For
+func getForwardedFor(header http.Header) []string {
+	hops := []string{}
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+
+			// Obfuscated and unknown addresses are kept, so that they can't be skipped to reach addresses which have been set by the client
+			if h, _, err := net.SplitHostPort(hop); err == nil {
+				hop = h
+			}
+
+			hops = append(hops, strings.Trim(hop, "[]"))
+		}
+
+		return hops
+	}
+
+	for _, forwardedFor := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(forwardedFor, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
+
+// isAllowed returns whether a client may connect; the denied networks and bans take precedence over the allowed networks
+func (s *Signaler) isAllowed(ip net.IP, peerID string) bool {
+	if ip != nil {
+		if containsIP(s.deniedNetworks, ip) {
+			return false
+		}
+
+		if len(s.allowedNetworks) > 0 && !containsIP(s.allowedNetworks, ip) {
+			return false
+		}
+	}
+
+	s.bansLock.Lock()
+	defer s.bansLock.Unlock()
+
+	keys := []string{}
+	if ip != nil {
+		keys = append(keys, Ban{IP: ip.String()}.key())
+	}
+
+	if strings.TrimSpace(peerID) != "" {
+		keys = append(keys, Ban{PeerID: peerID}.key())
+	}
+
+	for _, key := range keys {
+		ban, ok := s.bans[key]
+		if !ok {
+			continue
+		}
+
+		if ban.expired() {
+			delete(s.bans, key)
+
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Ban disconnects the clients with the IP or, if no IP is given, the peer ID and prevents them from connecting again until the ban expires (a ttl of 0 bans them permanently); bans are kept in memory and only apply to this signaler
+func (s *Signaler) Ban(ip string, peerID string, ttl time.Duration) (*Ban, error) {
+	ban, err := newBan(ip, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		e := time.Now().Add(ttl)
+		ban.ExpiresAt = &e
+	}
+
+	s.bansLock.Lock()
+	s.bans[ban.key()] = ban
+	s.bansLock.Unlock()
+
+	s.connectionsLock.Lock()
+	kicked := []connection{}
+	for _, connections := range s.connections {
+		for _, c := range connections {
+			if (ban.IP != "" && c.ip == ban.IP) || (ban.PeerID != "" && c.id == ban.PeerID) {
+				kicked = append(kicked, c)
+			}
+		}
+	}
+	s.connectionsLock.Unlock()
+
+	for _, c := range kicked {
+		c.close(websocketapi.CloseForbidden, websocketapi.ReasonForbidden)
+	}
+
+	return &ban, nil
+}
+
+// Unban lifts the ban of an IP or peer ID
+func (s *Signaler) Unban(ip string, peerID string) error {
+	ban, err := newBan(ip, peerID)
+	if err != nil {
+		return err
+	}
+
+	s.bansLock.Lock()
+	defer s.bansLock.Unlock()
+
+	existing, ok := s.bans[ban.key()]
+	if !ok || existing.expired() {
+		return ErrBanNotFound
+	}
+
+	delete(s.bans, ban.key())
+
+	return nil
+}
+
+// Bans returns the active bans
+func (s *Signaler) Bans() []Ban {
+	s.bansLock.Lock()
+	defer s.bansLock.Unlock()
+
+	bans := []Ban{}
+	for key, ban := range s.bans {
+		if ban.expired() {
+			delete(s.bans, key)
+
+			continue
+		}
+
+		bans = append(bans, ban)
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].key() < bans[j].key()
+	})
+
+	return bans
+}
@@ -0,0 +1,48 @@
+package wrtcsgl
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		header         http.Header
+		trustedProxies []string
+		want           string
+	}{
+		{"direct client", "192.0.2.1:1234", nil, nil, "192.0.2.1"},
+		{"headers of untrusted client", "192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, nil, "192.0.2.1"},
+		{"headers of client which is not a trusted proxy", "192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, []string{"127.0.0.1"}, "192.0.2.1"},
+		{"x-forwarded-for of trusted proxy", "127.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, []string{"127.0.0.1"}, "198.51.100.1"},
+		{"x-forwarded-for of trusted proxy without header", "127.0.0.1:1234", nil, []string{"127.0.0.1"}, "127.0.0.1"},
+		{"x-forwarded-for spoofed by client", "127.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.1, 198.51.100.1"}}, []string{"127.0.0.1"}, "198.51.100.1"},
+		{"x-forwarded-for through chain of trusted proxies", "127.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.1, 198.51.100.1", "10.0.0.2"}}, []string{"127.0.0.1", "10.0.0.0/8"}, "198.51.100.1"},
+		{"x-forwarded-for with invalid hop", "127.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, invalid"}}, []string{"127.0.0.1"}, "127.0.0.1"},
+		{"forwarded of trusted proxy", "127.0.0.1:1234", http.Header{"Forwarded": {"for=198.51.100.1;proto=https"}}, []string{"127.0.0.1"}, "198.51.100.1"},
+		{"forwarded with ipv6 and port", "[::1]:1234", http.Header{"Forwarded": {`for="[2001:db8::1]:4711"`}}, []string{"::1"}, "2001:db8::1"},
+		{"forwarded through chain of trusted proxies", "127.0.0.1:1234", http.Header{"Forwarded": {"for=203.0.113.1, for=198.51.100.1", "For=10.0.0.2;by=127.0.0.1"}}, []string{"127.0.0.1", "10.0.0.0/8"}, "198.51.100.1"},
+		{"forwarded takes precedence over x-forwarded-for", "127.0.0.1:1234", http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"203.0.113.1"}}, []string{"127.0.0.1"}, "198.51.100.1"},
+		{"forwarded with obfuscated hop", "127.0.0.1:1234", http.Header{"Forwarded": {"for=203.0.113.1, for=_hidden"}}, []string{"127.0.0.1"}, "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustedProxies, err := parseNetworks(tt.trustedProxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.header}
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+
+			if got := getClientIP(r, trustedProxies); got.String() != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package wrtcsgl
+
+import (
+	"net/http"
+	"time"
+
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/pojntfx/weron/pkg/wrtchealth"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DrainPath = "/drain" // Path of the drain API
+
+	defaultDrainTimeout = time.Second * 30       // Default maximum time to wait for pending exchanges to complete when draining
+	drainQuietPeriod    = time.Second * 2        // Time without relayed messages after which all pending exchanges are considered to be complete
+	drainCheckInterval  = time.Millisecond * 100 // Time to wait between checks for pending exchanges and disconnected clients
+)
+
+// Drain stops accepting new clients, waits for pending exchanges to complete and disconnects the connected clients with a close code which makes them reconnect immediately, so that the signaler can be closed without interrupting peers which are connecting; signaling messages are end-to-end encrypted, so exchanges are considered to be complete once no messages have been relayed for a short time or the drain timeout has passed
+func (s *Signaler) Drain() {
+	s.drainOnce.Do(func() {
+		defer close(s.drained)
+
+		log.Info().Dur("timeout", s.config.DrainTimeout).Msg("Draining signaler")
+
+		s.draining.Store(true)
+
+		// Load balancers stop sending new clients while the pending exchanges complete
+		s.health.Set(wrtchealth.ConditionListening, false)
+
+		s.lastActivity.Store(time.Now().UnixNano())
+
+		deadline := time.Now().Add(s.config.DrainTimeout)
+
+		t := time.NewTicker(drainCheckInterval)
+		defer t.Stop()
+
+		for s.connectionCount() > 0 {
+			if time.Since(time.Unix(0, s.lastActivity.Load())) >= drainQuietPeriod {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				log.Debug().Msg("Drain timeout passed before pending exchanges completed, continuing")
+
+				break
+			}
+
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+
+		s.connectionsLock.Lock()
+		clients := map[string]connection{}
+		for _, c := range s.connections {
+			for raddr, conn := range c {
+				clients[raddr] = conn
+			}
+		}
+		s.connectionsLock.Unlock()
+
+		for raddr, c := range clients {
+			log.Debug().Str("address", raddr).Msg("Disconnecting client to drain signaler")
+
+			c.close(websocketapi.CloseDraining, websocketapi.ReasonDraining)
+		}
+
+		// The clients are removed from their communities once their connections have been closed
+		for s.connectionCount() > 0 && time.Now().Before(deadline.Add(s.config.Heartbeat)) {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+
+		log.Info().Int("clients", len(clients)).Msg("Drained signaler")
+	})
+
+	<-s.drained
+}
+
+// Draining returns whether the signaler is draining
+func (s *Signaler) Draining() bool {
+	return s.draining.Load()
+}
+
+func (s *Signaler) connectionCount() int {
+	s.connectionsLock.Lock()
+	defer s.connectionsLock.Unlock()
+
+	return len(s.connections)
+}
+
+// recordActivity delays the end of draining, as a message which has just been relayed is likely part of a pending exchange
+func (s *Signaler) recordActivity() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// serveDrain drains and closes the signaler in the background, so that it exits once the connected clients have been disconnected
+func (s *Signaler) serveDrain(rw http.ResponseWriter) {
+	go func() {
+		s.Drain()
+
+		if err := s.Close(); err != nil {
+			log.Debug().Err(err).Msg("Could not close signaler after draining, continuing")
+		}
+	}()
+
+	rw.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,93 @@
+package wrtcsgl
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pojntfx/weron/internal/persisters"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultMailboxLimit = 64        // Default maximum amount of mail to keep per client
+	defaultMaxMailSize  = 16 * 1024 // Default maximum size of mail in bytes
+)
+
+// queueMail stores mail in the mailbox of its recipient if the recipient isn't connected; it returns false if the recipient is connected, in which case the mail should be forwarded to it like any other message
+func (s *Signaler) queueMail(raddr string, community string, to string, p []byte) bool {
+	// Clients which have never been seen in the community are offline, too
+	member, err := s.db.GetMember(s.ctx, community, to)
+	if err != nil && err != sql.ErrNoRows {
+		log.Debug().Err(err).Str("community", community).Str("to", to).Msg("Could not get member to check whether recipient of mail is online, continuing")
+
+		return false
+	}
+
+	if err == nil && member.Online {
+		return false
+	}
+
+	if len(p) > s.config.MaxMailSize {
+		log.Debug().
+			Str("address", raddr).
+			Str("community", community).
+			Str("to", to).
+			Int("len", len(p)).
+			Msg("Could not queue mail for offline client because it is too large, dropping")
+
+		return true
+	}
+
+	if err := s.db.AddMail(s.ctx, community, to, p, time.Now().Add(s.config.MailboxTTL), s.config.MailboxLimit); err != nil {
+		if err == persisters.ErrMailboxFull {
+			log.Debug().
+				Str("address", raddr).
+				Str("community", community).
+				Str("to", to).
+				Msg("Could not queue mail for offline client because its mailbox is full, dropping")
+		} else {
+			log.Debug().
+				Err(err).
+				Str("address", raddr).
+				Str("community", community).
+				Str("to", to).
+				Msg("Could not queue mail for offline client, dropping")
+		}
+
+		return true
+	}
+
+	log.Debug().
+		Str("address", raddr).
+		Str("community", community).
+		Str("to", to).
+		Msg("Queued mail for offline client")
+
+	return true
+}
+
+// deliverMail writes the mail which has been queued for a client which has just connected to it
+func (s *Signaler) deliverMail(raddr string, communities []string, id string, write func(community string, p []byte) error) error {
+	for _, community := range communities {
+		mail, err := s.db.TakeMail(s.ctx, community, id)
+		if err != nil {
+			log.Debug().Err(err).Str("address", raddr).Str("community", community).Msg("Could not get mail for client, continuing")
+
+			continue
+		}
+
+		for _, m := range mail {
+			log.Debug().
+				Str("address", raddr).
+				Str("community", community).
+				Time("createdAt", m.CreatedAt).
+				Msg("Delivering queued mail to client")
+
+			if err := write(community, m.Payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package wrtcsgl
+
+import (
+	"github.com/pojntfx/weron/internal/persisters"
+	"github.com/rs/zerolog/log"
+)
+
+// refreshSuspensions suspends the communities which have exceeded the monthly quota and lifts the suspensions of those which no longer do (i.e. because a new month has started)
+func (s *Signaler) refreshSuspensions() {
+	if s.config.MonthlyQuota <= 0 {
+		return
+	}
+
+	communities, err := s.db.GetCommunities(s.ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not get communities to check quotas, continuing")
+
+		return
+	}
+
+	suspended := map[string]struct{}{}
+	for _, c := range communities {
+		if c.MonthBytes >= s.config.MonthlyQuota {
+			suspended[c.ID] = struct{}{}
+		}
+	}
+
+	s.suspendedLock.Lock()
+	defer s.suspendedLock.Unlock()
+
+	for community := range suspended {
+		if _, ok := s.suspended[community]; !ok {
+			log.Info().Str("community", community).Int64("quota", s.config.MonthlyQuota).Msg("Community has exceeded the monthly quota, suspending it until the next month")
+		}
+	}
+
+	for community := range s.suspended {
+		if _, ok := suspended[community]; !ok {
+			log.Info().Str("community", community).Msg("Community is no longer over the monthly quota, lifting suspension")
+		}
+	}
+
+	s.suspended = suspended
+}
+
+func (s *Signaler) isSuspended(community string) bool {
+	s.suspendedLock.Lock()
+	defer s.suspendedLock.Unlock()
+
+	_, ok := s.suspended[community]
+
+	return ok
+}
+
+// markSuspended sets whether the communities are suspended, which is not stored in the database
+func (s *Signaler) markSuspended(communities []persisters.Community) {
+	for i := range communities {
+		communities[i].Suspended = s.isSuspended(communities[i].ID)
+	}
+}
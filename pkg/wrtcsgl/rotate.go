@@ -0,0 +1,98 @@
+package wrtcsgl
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/pojntfx/weron/internal/brokers"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	RotatePath = "/rotate" // Path of the password rotation API
+
+	rotatedPasswordLength = 32 // Amount of random bytes in a generated password
+)
+
+var (
+	ErrNotPersistent = errors.New("community is not persistent") // Only the passwords of persistent communities can be rotated, as ephemeral communities are owned by their clients
+)
+
+// Rotation is the result of rotating the password of a community
+type Rotation struct {
+	Community string    `json:"community"` // ID of the community
+	Password  string    `json:"password"`  // New password for the community; only its hash is stored, so it can't be queried again
+	KickAt    time.Time `json:"kickAt"`    // Time at which the clients which have joined with the previous password are kicked
+}
+
+// RotatePassword replaces the password of a persistent community with a random one and returns it; clients which have joined with the previous password stay connected for the grace period, so that they can be reconfigured before they have to join again with the new one
+func (s *Signaler) RotatePassword(ctx context.Context, community string, grace time.Duration) (*Rotation, error) {
+	current, err := s.db.GetCommunities(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	found := false
+	for _, c := range current {
+		if c.ID != community {
+			continue
+		}
+
+		if !c.Persistent {
+			return nil, ErrNotPersistent
+		}
+
+		expiresAt = c.ExpiresAt
+		found = true
+
+		break
+	}
+
+	if !found {
+		return nil, sql.ErrNoRows
+	}
+
+	raw := make([]byte, rotatedPasswordLength)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	password := base64.RawURLEncoding.EncodeToString(raw)
+
+	rotatedAt := time.Now()
+	if _, err := s.db.UpdatePersistentCommunity(ctx, community, password, expiresAt); err != nil {
+		return nil, err
+	}
+
+	kick := func() {
+		if err := s.broker.PublishKick(s.ctx, brokers.Kick{
+			Community:    community,
+			JoinedBefore: &rotatedAt,
+		}); err != nil {
+			log.Debug().Err(err).Str("community", community).Msg("Could not kick clients which have joined with the previous password, continuing")
+		}
+	}
+
+	if grace <= 0 {
+		kick()
+	} else {
+		// The kick is lost if the signaler is stopped before the grace period has passed, in which case connected clients are only rejected once they join again
+		go func() {
+			select {
+			case <-s.ctx.Done():
+			case <-time.After(grace):
+				kick()
+			}
+		}()
+	}
+
+	return &Rotation{
+		Community: community,
+		Password:  password,
+		KickAt:    rotatedAt.Add(grace),
+	}, nil
+}
@@ -0,0 +1,118 @@
+package wrtcsgl
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/pojntfx/weron/internal/webtransport"
+)
+
+var (
+	ErrMissingReplicaURL = errors.New("missing URL of this replica") // Sharding is enabled, but the URL of this replica has not been set
+	ErrUnknownReplica    = errors.New("replica is not in the fleet") // The URL of this replica is not in the list of replicas
+)
+
+// ShardOwner returns the replica which owns a community using rendezvous hashing, so that only the communities of a replica which is added or removed move to another one; replicas are compared by host and path, so the same URL can be given with a WebSocket or HTTP scheme
+func ShardOwner(replicas []string, community string) string {
+	owner := ""
+	var max uint64
+	for _, replica := range replicas {
+		h := sha256.Sum256([]byte(getReplicaKey(replica) + "\x00" + community))
+		if weight := binary.BigEndian.Uint64(h[:8]); owner == "" || weight > max {
+			owner = replica
+			max = weight
+		}
+	}
+
+	return owner
+}
+
+func getReplicaKey(replica string) string {
+	u, err := url.Parse(replica)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(replica, "/")
+	}
+
+	return strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/")
+}
+
+// openShards validates the replicas; sharding is disabled if there are none
+func (s *Signaler) openShards() error {
+	if len(s.config.Replicas) == 0 {
+		return nil
+	}
+
+	if strings.TrimSpace(s.config.ReplicaURL) == "" {
+		return ErrMissingReplicaURL
+	}
+
+	for _, replica := range s.config.Replicas {
+		if _, err := url.Parse(replica); err != nil {
+			return err
+		}
+
+		if getReplicaKey(replica) == getReplicaKey(s.config.ReplicaURL) {
+			return nil
+		}
+	}
+
+	return ErrUnknownReplica
+}
+
+// getShard returns the replica which owns the communities if it isn't this one, and whether the communities are owned by different replicas, in which case they can't be joined over one connection
+func (s *Signaler) getShard(communities []string) (string, bool) {
+	if len(s.config.Replicas) == 0 || len(communities) == 0 {
+		return "", false
+	}
+
+	owner := ShardOwner(s.config.Replicas, communities[0])
+	for _, community := range communities[1:] {
+		if ShardOwner(s.config.Replicas, community) != owner {
+			return "", true
+		}
+	}
+
+	if getReplicaKey(owner) == getReplicaKey(s.config.ReplicaURL) {
+		return "", false
+	}
+
+	return owner, false
+}
+
+// redirectToShard redirects the request to the same path and query on the replica which owns its communities; the scheme is chosen based on whether the request is a WebSocket or WebTransport handshake
+func redirectToShard(rw http.ResponseWriter, r *http.Request, owner string) error {
+	u, err := url.Parse(owner)
+	if err != nil {
+		return err
+	}
+
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	if webtransport.IsUpgrade(r) {
+		// WebTransport always uses TLS
+		u.Scheme = "https"
+	} else if websocket.IsWebSocketUpgrade(r) {
+		u.Scheme = "ws"
+		if secure {
+			u.Scheme = "wss"
+		}
+	} else {
+		u.Scheme = "http"
+		if secure {
+			u.Scheme = "https"
+		}
+	}
+
+	u.Path = path.Join("/", u.Path, r.URL.Path)
+	u.RawQuery = r.URL.RawQuery
+
+	rw.Header().Set("Location", u.String())
+	rw.WriteHeader(http.StatusTemporaryRedirect)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package wrtcsgl
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
+	"github.com/pojntfx/weron/internal/dualstack"
+	"github.com/pojntfx/weron/internal/webtransport"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrMissingTLSCertificate = errors.New("missing TLS certificate or key") // WebTransport is enabled, but no TLS certificate and key have been set, which QUIC requires
+)
+
+const (
+	webTransportStreamTimeout = time.Second * 10 // Time to wait for a client to open its stream after the WebTransport session has been established
+)
+
+// signalingConn is a connection to a client over WebSockets or WebTransport
+type signalingConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	Subprotocol() string
+	Close() error
+}
+
+// upgrade completes the WebSocket or WebTransport handshake of a client
+func (s *Signaler) upgrade(rw http.ResponseWriter, r *http.Request) (signalingConn, error) {
+	if webtransport.IsUpgrade(r) {
+		return webtransport.Upgrade(s.wt, rw, r, websocketapi.Versions, webTransportStreamTimeout)
+	}
+
+	conn, err := s.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// unblockWrites makes pending writes to a client fail; the deadlines of WebSocket connections only apply to writes which start after they have been set, so they are set on the underlying connection instead
+func unblockWrites(conn signalingConn) {
+	if c, ok := conn.(interface{ UnderlyingConn() net.Conn }); ok {
+		_ = c.UnderlyingConn().SetWriteDeadline(time.Now())
+
+		return
+	}
+
+	_ = conn.SetWriteDeadline(time.Now())
+}
+
+// openWebTransport starts listening for WebTransport clients, which are served by the same handler as WebSocket clients; WebTransport is disabled if no address has been set
+func (s *Signaler) openWebTransport(handler http.Handler) error {
+	if strings.TrimSpace(s.config.WebTransportAddr) == "" {
+		return nil
+	}
+
+	if strings.TrimSpace(s.config.TLSCertFile) == "" || strings.TrimSpace(s.config.TLSKeyFile) == "" {
+		return ErrMissingTLSCertificate
+	}
+
+	certificate, err := tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+
+	conns, err := dualstack.ListenUDP(s.ctx, s.config.WebTransportAddr)
+	if err != nil {
+		return err
+	}
+	s.wtConns = conns
+
+	s.wt = webtransport.NewServer(conns[0].LocalAddr().String(), handler, []tls.Certificate{certificate}, s.checkOrigin)
+
+	for _, conn := range conns {
+		go func(conn *net.UDPConn) {
+			if err := s.wt.Serve(conn); err != nil && err != http.ErrServerClosed {
+				// The WebSocket listener keeps serving clients
+				log.Debug().Err(err).Str("address", conn.LocalAddr().String()).Msg("Could not serve WebTransport clients, stopping")
+			}
+		}(conn)
+	}
+
+	return nil
+}
+
+// WebTransportAddr returns the address the signaler is listening on for WebTransport clients (the first one if the listening address resolves to multiple ones), or nil if WebTransport is disabled
+func (s *Signaler) WebTransportAddr() net.Addr {
+	if len(s.wtConns) == 0 {
+		return nil
+	}
+
+	return s.wtConns[0].LocalAddr()
+}
+
+func (s *Signaler) closeWebTransport() error {
+	if s.wt == nil {
+		return nil
+	}
+
+	if err := s.wt.Close(); err != nil {
+		return err
+	}
+
+	for _, conn := range s.wtConns {
+		if err := conn.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -20,26 +23,75 @@ import (
 	"github.com/pojntfx/go-auth-utils/pkg/authn"
 	"github.com/pojntfx/go-auth-utils/pkg/authn/basic"
 	"github.com/pojntfx/go-auth-utils/pkg/authn/oidc"
+	websocketapi "github.com/pojntfx/weron/internal/api/websocket"
 	"github.com/pojntfx/weron/internal/brokers"
 	"github.com/pojntfx/weron/internal/brokers/process"
 	"github.com/pojntfx/weron/internal/brokers/redis"
+	"github.com/pojntfx/weron/internal/dualstack"
 	"github.com/pojntfx/weron/internal/persisters"
 	"github.com/pojntfx/weron/internal/persisters/memory"
 	"github.com/pojntfx/weron/internal/persisters/psql"
+	"github.com/pojntfx/weron/internal/webtransport"
+	"github.com/pojntfx/weron/pkg/wrtchealth"
+	wtserver "github.com/quic-go/webtransport-go"
 )
 
 var (
-	errMissingCommunity = errors.New("missing community")
-	errMissingPassword  = errors.New("missing password")
-
-	upgrader = websocket.Upgrader{}
+	errMissingCommunity   = errors.New("missing community")
+	errMissingPassword    = errors.New("missing password")
+	errDuplicateCommunity = errors.New("duplicate community")
+	errMissingID          = errors.New("missing ID")
+	errSlowConsumer       = errors.New("send queue overflowed, client is too slow")
+	errClientClosed       = errors.New("client closed connection")
 
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
+const (
+	LeasesPath  = "/leases"  // Path of the lease management API
+	BansPath    = "/bans"    // Path of the ban management API
+	MembersPath = "/members" // Path of the membership API
+
+	expiryCheckInterval = time.Second * 5 // Time to wait between checks for expired communities
+	usageFlushInterval  = time.Second * 5 // Time to wait before persisting the accumulated usage of communities
+
+	defaultMaxMessageSize  = 1024 * 1024 // Default maximum size of a message from a client in bytes
+	defaultSendQueueLength = 1024        // Default maximum amount of messages to queue for a client
+)
+
 type connection struct {
-	conn   *websocket.Conn
-	closer chan struct{}
+	conn      signalingConn
+	closer    chan struct{}
+	closeOnce *sync.Once
+	rejection *websocketapi.Rejection
+	ip        string
+	id        string
+	joinedAt  time.Time
+}
+
+// close disconnects the client with the code and reason, which are sent to it in a close frame
+func (c connection) close(code int, reason string) {
+	// Connections which joined multiple communities can be kicked multiple times
+	c.closeOnce.Do(func() {
+		*c.rejection = *websocketapi.NewRejection(code, reason)
+
+		close(c.closer)
+	})
+}
+
+type usage struct {
+	messages int64
+	bytes    int64
+}
+
+type communityInput struct {
+	community string
+	input     brokers.Input
+}
+
+type introduction struct {
+	p         []byte // End-to-end encrypted payload, without the envelope of the sender's version
+	createdAt time.Time
 }
 
 // SignalerConfig configures the adapter
@@ -51,6 +103,24 @@ type SignalerConfig struct {
 	APIPassword          string        // Password for the API endpoint; ignored if any of the OIDC parameters are set
 	OIDCIssuer           string        // OpenID Connect issuer
 	OIDCClientID         string        // OpenID Connect client id
+	Compression          bool          // Whether to negotiate permessage-deflate compression with clients
+	AllowedOrigins       []string      // Origins from which browsers may connect and use the management API (i.e. https://example.com); "*" allows all origins; same-origin requests and clients which don't send an origin are always allowed
+	IntroductionWindow   time.Duration // Time to buffer introductions for, so that clients which join shortly after another client still receive its introduction (0 disables buffering; only applies to clients connected to this signaler)
+	MaxMessageSize       int64         // Maximum size of a message from a client in bytes; clients which send larger messages are disconnected (0 uses the default of 1 MiB)
+	SendQueueLength      int           // Maximum amount of messages to queue for a client; clients which can't keep up are disconnected (0 uses the default of 1024)
+	AllowedNetworks      []string      // CIDRs or IPs from which clients may connect and use the management API (i.e. 10.0.0.0/8); empty allows all networks
+	DeniedNetworks       []string      // CIDRs or IPs from which clients may not connect or use the management API; takes precedence over the allowed networks
+	TrustedProxies       []string      // CIDRs or IPs of reverse proxies whose Forwarded and X-Forwarded-For headers determine the IPs of clients for the allowed and denied networks and bans (i.e. 127.0.0.1); the headers of all other clients are ignored
+	MonthlyQuota         int64         // Maximum signaling traffic per community and calendar month (UTC) in bytes; communities which exceed it are suspended until the next month; the usage of ephemeral communities is lost once they are deleted (0 disables the quota)
+	MailboxTTL           time.Duration // Time to keep mail for clients which are offline for; it is delivered once they connect with their ID again (0 disables the mailbox; mail in ephemeral communities is lost once they are deleted)
+	MailboxLimit         int           // Maximum amount of mail to keep per client; further mail is dropped until the client has connected (0 uses the default of 64)
+	MaxMailSize          int           // Maximum size of mail to keep in bytes; larger mail is dropped (0 uses the default of 16 KiB)
+	DrainTimeout         time.Duration // Maximum time to wait for pending exchanges to complete when draining before disconnecting the clients (0 uses the default of 30s)
+	Replicas             []string      // URLs of all replicas of a sharded fleet, including this one (i.e. https://signaler-1.example.com/); communities are sharded across them by rendezvous hashing and clients are redirected to the replica which owns their community, so replicas don't need to share a database or broker (empty disables sharding)
+	ReplicaURL           string        // URL of this replica, which must be one of the replicas (ignored if sharding is disabled)
+	WebTransportAddr     string        // UDP address to listen on for clients which connect over WebTransport (HTTP/3) instead of WebSockets (i.e. :1337); the management API is also served on it (empty disables WebTransport)
+	TLSCertFile          string        // Path to the TLS certificate for WebTransport, which QUIC requires (ignored if WebTransport is disabled)
+	TLSKeyFile           string        // Path to the TLS key for WebTransport (ignored if WebTransport is disabled)
 
 	OnConnect    func(raddr string, community string)                  // Handler to be called when a client has connected to the signaler
 	OnDisconnect func(raddr string, community string, err interface{}) // Handler to be called when a client has disconnected from the signaler
@@ -70,7 +140,37 @@ type Signaler struct {
 	db              persisters.CommunitiesPersister
 	broker          brokers.CommunitiesBroker
 	srv             *http.Server
+	listener        net.Listener
+	upgrader        websocket.Upgrader
+	wt              *wtserver.Server
+	wtConns         []*net.UDPConn
 	closeKicks      func() error
+
+	usageLock sync.Mutex
+	usage     map[string]*usage
+
+	introductionsLock sync.Mutex
+	introductions     map[string]map[string]introduction
+
+	allowedNetworks []*net.IPNet
+	deniedNetworks  []*net.IPNet
+	trustedProxies  []*net.IPNet
+
+	bansLock sync.Mutex
+	bans     map[string]Ban
+
+	suspendedLock sync.Mutex
+	suspended     map[string]struct{}
+
+	health *wrtchealth.Checker
+
+	draining     atomic.Bool
+	drainOnce    sync.Once
+	drained      chan struct{}
+	lastActivity atomic.Int64
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // NewSignaler creates the signaler
@@ -85,6 +185,26 @@ func NewSignaler(
 		config = &SignalerConfig{}
 	}
 
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = defaultMaxMessageSize
+	}
+
+	if config.SendQueueLength <= 0 {
+		config.SendQueueLength = defaultSendQueueLength
+	}
+
+	if config.MailboxLimit <= 0 {
+		config.MailboxLimit = defaultMailboxLimit
+	}
+
+	if config.MaxMailSize <= 0 {
+		config.MaxMailSize = defaultMaxMailSize
+	}
+
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = defaultDrainTimeout
+	}
+
 	return &Signaler{
 		laddr:       laddr,
 		postgresURL: dbURL,
@@ -93,6 +213,18 @@ func NewSignaler(
 		ctx:         ctx,
 
 		errs: make(chan error),
+
+		usage: map[string]*usage{},
+
+		introductions: map[string]map[string]introduction{},
+
+		bans: map[string]Ban{},
+
+		suspended: map[string]struct{}{},
+
+		health: wrtchealth.NewChecker(wrtchealth.ConditionListening),
+
+		drained: make(chan struct{}),
 	}
 }
 
@@ -100,11 +232,32 @@ func NewSignaler(
 func (s *Signaler) Open() error {
 	log.Trace().Msg("Opening signaler")
 
-	addr, err := net.ResolveTCPAddr("tcp", s.laddr)
+	// Hostnames are resolved again when listening, so that all of their addresses are listened on
+	if _, err := net.ResolveTCPAddr("tcp", s.laddr); err != nil {
+		return err
+	}
+
+	var err error
+
+	s.allowedNetworks, err = parseNetworks(s.config.AllowedNetworks)
 	if err != nil {
 		return err
 	}
 
+	s.deniedNetworks, err = parseNetworks(s.config.DeniedNetworks)
+	if err != nil {
+		return err
+	}
+
+	s.trustedProxies, err = parseNetworks(s.config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	if err := s.openShards(); err != nil {
+		return err
+	}
+
 	managementAPIEnabled := true
 	if (strings.TrimSpace(s.config.OIDCIssuer) == "" && strings.TrimSpace(s.config.OIDCClientID) == "") && strings.TrimSpace(s.config.APIPassword) == "" {
 		managementAPIEnabled = false
@@ -128,6 +281,8 @@ func (s *Signaler) Open() error {
 		}
 	}
 
+	s.refreshSuspensions()
+
 	if strings.TrimSpace(s.redisURL) == "" {
 		s.broker = process.NewCommunitiesBroker()
 	} else {
@@ -149,7 +304,13 @@ func (s *Signaler) Open() error {
 		return err
 	}
 
-	s.srv = &http.Server{Addr: addr.String()}
+	s.srv = &http.Server{Addr: s.laddr}
+
+	s.upgrader = websocket.Upgrader{
+		EnableCompression: s.config.Compression,
+		Subprotocols:      websocketapi.Versions,
+		CheckOrigin:       s.checkOrigin,
+	}
 
 	s.connections = map[string]map[string]connection{}
 
@@ -157,39 +318,527 @@ func (s *Signaler) Open() error {
 	s.closeKicks = closeKicks
 
 	s.srv.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Health checks are answered before access control, as they are usually sent by load balancers and orchestrators from outside of the allowed networks
+		if wrtchealth.IsCheck(r) {
+			s.health.ServeHTTP(rw, r)
+
+			return
+		}
+
 		raddr := uuid.New().String()
 
-		defer func() {
-			err := recover()
+		defer func() {
+			err := recover()
+
+			switch err {
+			case nil:
+				log.Debug().
+					Str("address", raddr).
+					Msg("Closed connection for client")
+			case http.StatusUnauthorized:
+				fallthrough
+			case http.StatusNotImplemented:
+				log.Debug().
+					Err(err.(error)).
+					Str("address", raddr).
+					Msg("Closed connection for client")
+			case http.StatusNotFound:
+				fallthrough
+			case http.StatusForbidden:
+				log.Debug().
+					Err(err.(error)).
+					Str("address", raddr).
+					Msg("Closed connection for client")
+			default:
+				rw.WriteHeader(http.StatusInternalServerError)
+
+				log.Debug().
+					Err(err.(error)).
+					Str("address", raddr).
+					Msg("Closed connection for client")
+			}
+		}()
+
+		ip := getClientIP(r, s.trustedProxies)
+		if !s.isAllowed(ip, r.URL.Query().Get("id")) {
+			reject(rw, http.StatusForbidden, websocketapi.CloseForbidden, websocketapi.ReasonForbidden)
+
+			panic(fmt.Errorf("%v", http.StatusForbidden))
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && s.checkOrigin(r) {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			rw.Header().Set("Access-Control-Allow-Methods", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+			rw.Header().Set("Access-Control-Allow-Headers", "Authorization")
+			rw.Header().Add("Vary", "Origin")
+
+			// Answer CORS preflight requests
+			if r.Method == http.MethodOptions {
+				rw.WriteHeader(http.StatusNoContent)
+
+				return
+			}
+		}
+
+		// Requests for communities which are owned by another replica of a sharded fleet are redirected to it; bans, specs and the list of communities are local to each replica
+		if owner, misdirected := s.getShard(r.URL.Query()["community"]); misdirected {
+			reject(rw, http.StatusMisdirectedRequest, websocketapi.CloseMisdirected, websocketapi.ReasonMisdirected)
+
+			panic(fmt.Errorf("%v", http.StatusMisdirectedRequest))
+		} else if owner != "" {
+			log.Debug().
+				Str("address", raddr).
+				Str("replica", owner).
+				Msg("Redirecting client to replica which owns community")
+
+			if err := redirectToShard(rw, r, owner); err != nil {
+				panic(err)
+			}
+
+			return
+		}
+
+		if strings.TrimSuffix(r.URL.Path, "/") == BansPath {
+			if !managementAPIEnabled {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			u, p, ok := r.BasicAuth()
+			if err := auth.Validate(u, p); !ok || err != nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				// List bans
+				j, err := json.Marshal(s.Bans())
+				if err != nil {
+					panic(err)
+				}
+
+				if _, err := fmt.Fprint(rw, string(j)); err != nil {
+					panic(err)
+				}
+			case http.MethodPost:
+				// Ban IP or peer ID
+				var ttl time.Duration
+				if rawTTL := r.URL.Query().Get("ttl"); strings.TrimSpace(rawTTL) != "" {
+					var err error
+					ttl, err = time.ParseDuration(rawTTL)
+					if err != nil {
+						rw.WriteHeader(http.StatusBadRequest)
+
+						panic(err)
+					}
+				}
+
+				b, err := s.Ban(r.URL.Query().Get("ip"), r.URL.Query().Get("peer"), ttl)
+				if err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+
+					panic(err)
+				}
+
+				log.Debug().
+					Str("address", raddr).
+					Str("ip", b.IP).
+					Str("peer", b.PeerID).
+					Msg("Banned client")
+
+				j, err := json.Marshal(b)
+				if err != nil {
+					panic(err)
+				}
+
+				if _, err := fmt.Fprint(rw, string(j)); err != nil {
+					panic(err)
+				}
+			case http.MethodDelete:
+				// Lift ban of IP or peer ID
+				if err := s.Unban(r.URL.Query().Get("ip"), r.URL.Query().Get("peer")); err != nil {
+					if err == ErrBanNotFound {
+						rw.WriteHeader(http.StatusNotFound)
+
+						panic(fmt.Errorf("%v", http.StatusNotFound))
+					} else {
+						rw.WriteHeader(http.StatusBadRequest)
+
+						panic(err)
+					}
+				}
+			default:
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			return
+		}
+
+		if strings.TrimSuffix(r.URL.Path, "/") == ApplyPath {
+			if !managementAPIEnabled {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			u, p, ok := r.BasicAuth()
+			if err := auth.Validate(u, p); !ok || err != nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			}
+
+			if r.Method != http.MethodPost {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			// Reconcile persistent communities with spec
+			var spec Spec
+			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+
+				panic(err)
+			}
+
+			dryRun := false
+			if rawDryRun := r.URL.Query().Get("dryRun"); strings.TrimSpace(rawDryRun) != "" {
+				var err error
+				dryRun, err = strconv.ParseBool(rawDryRun)
+				if err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+
+					panic(err)
+				}
+			}
+
+			changes, err := s.Apply(s.ctx, spec, dryRun)
+			if err != nil {
+				if err == ErrInvalidSpec {
+					rw.WriteHeader(http.StatusBadRequest)
+				}
+
+				panic(err)
+			}
+
+			log.Debug().
+				Str("address", raddr).
+				Bool("dryRun", dryRun).
+				Int("changes", len(changes)).
+				Msg("Applied spec")
+
+			j, err := json.Marshal(changes)
+			if err != nil {
+				panic(err)
+			}
+
+			if _, err := fmt.Fprint(rw, string(j)); err != nil {
+				panic(err)
+			}
+
+			return
+		}
+
+		if strings.TrimSuffix(r.URL.Path, "/") == RotatePath {
+			if !managementAPIEnabled {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			u, p, ok := r.BasicAuth()
+			if err := auth.Validate(u, p); !ok || err != nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			}
+
+			if r.Method != http.MethodPost {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			community := r.URL.Query().Get("community")
+			if strings.TrimSpace(community) == "" {
+				panic(errMissingCommunity)
+			}
+
+			var grace time.Duration
+			if rawGrace := r.URL.Query().Get("grace"); strings.TrimSpace(rawGrace) != "" {
+				var err error
+				grace, err = time.ParseDuration(rawGrace)
+				if err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+
+					panic(err)
+				}
+			}
+
+			// Rotate password
+			rotation, err := s.RotatePassword(s.ctx, community, grace)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					rw.WriteHeader(http.StatusNotFound)
+
+					panic(fmt.Errorf("%v", http.StatusNotFound))
+				} else if err == ErrNotPersistent {
+					rw.WriteHeader(http.StatusBadRequest)
+
+					panic(err)
+				} else {
+					panic(err)
+				}
+			}
+
+			log.Debug().
+				Str("address", raddr).
+				Str("community", community).
+				Dur("grace", grace).
+				Msg("Rotated password of community")
+
+			// The password is only reported once, so it must not be cached
+			rw.Header().Set("Cache-Control", "no-store")
+
+			j, err := json.Marshal(rotation)
+			if err != nil {
+				panic(err)
+			}
+
+			if _, err := fmt.Fprint(rw, string(j)); err != nil {
+				panic(err)
+			}
+
+			return
+		}
+
+		if strings.TrimSuffix(r.URL.Path, "/") == DrainPath {
+			if !managementAPIEnabled {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			u, p, ok := r.BasicAuth()
+			if err := auth.Validate(u, p); !ok || err != nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			}
+
+			if r.Method != http.MethodPost {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			log.Debug().
+				Str("address", raddr).
+				Msg("Received request to drain signaler")
+
+			// Drain and exit
+			s.serveDrain(rw)
+
+			return
+		}
+
+		if strings.TrimSuffix(r.URL.Path, "/") == MembersPath {
+			if !managementAPIEnabled {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			u, p, ok := r.BasicAuth()
+			if err := auth.Validate(u, p); !ok || err != nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			}
+
+			if r.Method != http.MethodGet {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			community := r.URL.Query().Get("community")
+			if strings.TrimSpace(community) == "" {
+				panic(errMissingCommunity)
+			}
+
+			// List members
+			m, err := s.db.GetMembers(s.ctx, community)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					rw.WriteHeader(http.StatusNotFound)
+
+					panic(fmt.Errorf("%v", http.StatusNotFound))
+				} else {
+					panic(err)
+				}
+			}
+
+			j, err := json.Marshal(m)
+			if err != nil {
+				panic(err)
+			}
+
+			if _, err := fmt.Fprint(rw, string(j)); err != nil {
+				panic(err)
+			}
+
+			return
+		}
+
+		if strings.TrimSuffix(r.URL.Path, "/") == LeasesPath {
+			community := r.URL.Query().Get("community")
+			if strings.TrimSpace(community) == "" {
+				panic(errMissingCommunity)
+			}
+
+			id := r.URL.Query().Get("id")
+
+			// Peers can query their own lease with the community password
+			if r.Method == http.MethodGet && strings.TrimSpace(id) != "" {
+				password := r.URL.Query().Get("password")
+				if strings.TrimSpace(password) == "" {
+					panic(errMissingPassword)
+				}
+
+				l, err := s.db.GetLease(s.ctx, community, password, id)
+				if err != nil {
+					if err == authn.ErrWrongPassword {
+						rw.WriteHeader(http.StatusUnauthorized)
+
+						panic(fmt.Errorf("%v", http.StatusUnauthorized))
+					} else if err == sql.ErrNoRows {
+						rw.WriteHeader(http.StatusNotFound)
+
+						panic(fmt.Errorf("%v", http.StatusNotFound))
+					} else {
+						panic(err)
+					}
+				}
+
+				j, err := json.Marshal(l)
+				if err != nil {
+					panic(err)
+				}
+
+				if _, err := fmt.Fprint(rw, string(j)); err != nil {
+					panic(err)
+				}
+
+				return
+			}
+
+			if !managementAPIEnabled {
+				rw.WriteHeader(http.StatusNotImplemented)
+
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
+			}
+
+			u, p, ok := r.BasicAuth()
+			if err := auth.Validate(u, p); !ok || err != nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+
+				panic(fmt.Errorf("%v", http.StatusUnauthorized))
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				// List leases
+				l, err := s.db.GetLeases(s.ctx, community)
+				if err != nil {
+					if err == sql.ErrNoRows {
+						rw.WriteHeader(http.StatusNotFound)
+
+						panic(fmt.Errorf("%v", http.StatusNotFound))
+					} else {
+						panic(err)
+					}
+				}
+
+				j, err := json.Marshal(l)
+				if err != nil {
+					panic(err)
+				}
+
+				if _, err := fmt.Fprint(rw, string(j)); err != nil {
+					panic(err)
+				}
+			case http.MethodPost:
+				// Create or update lease
+				if strings.TrimSpace(id) == "" {
+					panic(errMissingID)
+				}
+
+				ips := r.URL.Query()["ip"]
+				for _, ip := range ips {
+					if _, _, err := net.ParseCIDR(ip); err != nil {
+						rw.WriteHeader(http.StatusBadRequest)
+
+						panic(err)
+					}
+				}
+
+				l, err := s.db.CreateLease(s.ctx, community, id, ips, r.URL.Query().Get("name"))
+				if err != nil {
+					if err == sql.ErrNoRows {
+						rw.WriteHeader(http.StatusNotFound)
+
+						panic(fmt.Errorf("%v", http.StatusNotFound))
+					} else {
+						panic(err)
+					}
+				}
+
+				j, err := json.Marshal(l)
+				if err != nil {
+					panic(err)
+				}
+
+				if _, err := fmt.Fprint(rw, string(j)); err != nil {
+					panic(err)
+				}
+			case http.MethodDelete:
+				// Delete lease
+				if strings.TrimSpace(id) == "" {
+					panic(errMissingID)
+				}
+
+				if err := s.db.DeleteLease(s.ctx, community, id); err != nil {
+					if err == sql.ErrNoRows {
+						rw.WriteHeader(http.StatusNotFound)
 
-			switch err {
-			case nil:
-				log.Debug().
-					Str("address", raddr).
-					Msg("Closed connection for client")
-			case http.StatusUnauthorized:
-				fallthrough
-			case http.StatusNotImplemented:
-				log.Debug().
-					Err(err.(error)).
-					Str("address", raddr).
-					Msg("Closed connection for client")
-			case http.StatusNotFound:
-				log.Debug().
-					Err(err.(error)).
-					Str("address", raddr).
-					Msg("Closed connection for client")
+						panic(fmt.Errorf("%v", http.StatusNotFound))
+					} else {
+						panic(err)
+					}
+				}
 			default:
-				rw.WriteHeader(http.StatusInternalServerError)
+				rw.WriteHeader(http.StatusNotImplemented)
 
-				log.Debug().
-					Err(err.(error)).
-					Str("address", raddr).
-					Msg("Closed connection for client")
+				panic(fmt.Errorf("%v", http.StatusNotImplemented))
 			}
-		}()
 
-		switch r.Method {
+			return
+		}
+
+		// WebTransport handshakes join communities in the same way as WebSocket handshakes
+		method := r.Method
+		if webtransport.IsUpgrade(r) {
+			method = http.MethodGet
+		}
+
+		switch method {
 		case http.MethodGet:
 			community := r.URL.Query().Get("community")
 			if strings.TrimSpace(community) == "" {
@@ -212,6 +861,8 @@ func (s *Signaler) Open() error {
 					panic(err)
 				}
 
+				s.markSuspended(pc)
+
 				j, err := json.Marshal(pc)
 				if err != nil {
 					panic(err)
@@ -224,74 +875,166 @@ func (s *Signaler) Open() error {
 				return
 			}
 
-			// Create ephemeral community
-			password := r.URL.Query().Get("password")
-			if strings.TrimSpace(password) == "" {
+			// Create ephemeral communities; clients can join multiple communities over one connection by repeating the parameters
+			communities := r.URL.Query()["community"]
+			passwords := r.URL.Query()["password"]
+			if len(passwords) != len(communities) {
+				reject(rw, http.StatusBadRequest, websocketapi.CloseInvalidRequest, websocketapi.ReasonInvalidRequest)
+
 				panic(errMissingPassword)
 			}
 
-			if err := s.db.AddClientsToCommunity(s.ctx, community, password, s.config.EphemeralCommunities); err != nil {
-				if err == authn.ErrWrongPassword || err == persisters.ErrEphemeralCommunitiesDisabled {
-					rw.WriteHeader(http.StatusUnauthorized)
+			// Clients which connect while the signaler is draining retry, which load balancers route to another signaler
+			if s.Draining() {
+				rw.Header().Set("Retry-After", "0")
+				reject(rw, http.StatusServiceUnavailable, websocketapi.CloseDraining, websocketapi.ReasonDraining)
 
-					panic(fmt.Errorf("%v", http.StatusUnauthorized))
-				} else {
-					panic(err)
-				}
+				panic(fmt.Errorf("%v", http.StatusServiceUnavailable))
 			}
 
-			defer func() {
-				if err := s.db.RemoveClientFromCommunity(s.ctx, community); err != nil {
-					panic(err)
+			joined := map[string]struct{}{}
+			for i, community := range communities {
+				if strings.TrimSpace(community) == "" {
+					reject(rw, http.StatusBadRequest, websocketapi.CloseInvalidRequest, websocketapi.ReasonInvalidRequest)
+
+					panic(errMissingCommunity)
 				}
-			}()
 
-			conn, err := upgrader.Upgrade(rw, r, nil)
+				if _, ok := joined[community]; ok {
+					reject(rw, http.StatusBadRequest, websocketapi.CloseInvalidRequest, websocketapi.ReasonInvalidRequest)
+
+					panic(errDuplicateCommunity)
+				}
+
+				password := passwords[i]
+				if strings.TrimSpace(password) == "" {
+					reject(rw, http.StatusBadRequest, websocketapi.CloseInvalidRequest, websocketapi.ReasonInvalidRequest)
+
+					panic(errMissingPassword)
+				}
+
+				if s.isSuspended(community) {
+					reject(rw, http.StatusTooManyRequests, websocketapi.CloseQuotaExceeded, websocketapi.ReasonQuotaExceeded)
+
+					panic(fmt.Errorf("%v", http.StatusTooManyRequests))
+				}
+
+				if err := s.db.AddClientsToCommunity(s.ctx, community, password, s.config.EphemeralCommunities); err != nil {
+					if err == authn.ErrWrongPassword {
+						reject(rw, http.StatusUnauthorized, websocketapi.CloseWrongPassword, websocketapi.ReasonWrongPassword)
+
+						panic(fmt.Errorf("%v", http.StatusUnauthorized))
+					} else if err == persisters.ErrEphemeralCommunitiesDisabled {
+						reject(rw, http.StatusUnauthorized, websocketapi.CloseEphemeralCommunitiesDisabled, websocketapi.ReasonEphemeralCommunitiesDisabled)
+
+						panic(fmt.Errorf("%v", http.StatusUnauthorized))
+					} else {
+						panic(err)
+					}
+				}
+
+				joined[community] = struct{}{}
+
+				defer func(community string) {
+					if err := s.db.RemoveClientFromCommunity(s.ctx, community); err != nil {
+						panic(err)
+					}
+				}(community)
+			}
+
+			// Clients which use selective signaling send their ID, so that messages with a recipient are only forwarded to it
+			id := r.URL.Query().Get("id")
+
+			// Messages of clients which joined multiple communities or use selective signaling are wrapped in envelopes
+			multiplexed := len(communities) > 1 || strings.TrimSpace(id) != ""
+
+			conn, err := s.upgrade(rw, r)
 			if err != nil {
 				panic(err)
 			}
 
+			// Answer in the version requested by the client; clients which don't request a version use JSON
+			version := conn.Subprotocol()
+			messageType := websocket.BinaryMessage
+			if version != websocketapi.VersionBinary {
+				version = websocketapi.VersionJSON
+				messageType = websocket.TextMessage
+			}
+
+			closer := make(chan struct{})
+			closeOnce := &sync.Once{}
+			rejection := &websocketapi.Rejection{}
+
 			defer func() {
 				s.connectionsLock.Lock()
-				delete(s.connections[community], raddr)
-				if len(s.connections[community]) <= 0 {
-					delete(s.connections, community)
+				for _, community := range communities {
+					delete(s.connections[community], raddr)
+					if len(s.connections[community]) <= 0 {
+						delete(s.connections, community)
+					}
 				}
 				s.connectionsLock.Unlock()
 
+				s.introductionsLock.Lock()
+				for _, community := range communities {
+					delete(s.introductions[community], raddr)
+					if len(s.introductions[community]) <= 0 {
+						delete(s.introductions, community)
+					}
+				}
+				s.introductionsLock.Unlock()
+
 				log.Debug().
 					Str("address", raddr).
-					Str("community", community).
+					Strs("communities", communities).
 					Msg("Disconnected from client")
 
 				if s.config.OnDisconnect != nil {
-					s.config.OnDisconnect(raddr, community, err)
+					for _, community := range communities {
+						s.config.OnDisconnect(raddr, community, err)
+					}
 				}
 
+				s.recordMember(communities, id, false)
+
 				if err := conn.Close(); err != nil {
 					panic(err)
 				}
 			}()
 
 			s.connectionsLock.Lock()
-			if _, exists := s.connections[community]; !exists {
-				s.connections[community] = map[string]connection{}
-			}
-			s.connections[community][raddr] = connection{
-				conn:   conn,
-				closer: make(chan struct{}),
+			for _, community := range communities {
+				if _, exists := s.connections[community]; !exists {
+					s.connections[community] = map[string]connection{}
+				}
+				s.connections[community][raddr] = connection{
+					conn:      conn,
+					closer:    closer,
+					closeOnce: closeOnce,
+					rejection: rejection,
+					ip:        ip.String(),
+					id:        id,
+					joinedAt:  time.Now(),
+				}
 			}
 			s.connectionsLock.Unlock()
 
 			log.Debug().
 				Str("address", raddr).
-				Str("community", community).
+				Strs("communities", communities).
+				Str("version", conn.Subprotocol()).
 				Msg("Connected from client")
 
 			if s.config.OnConnect != nil {
-				s.config.OnConnect(raddr, community)
+				for _, community := range communities {
+					s.config.OnConnect(raddr, community)
+				}
 			}
 
+			s.recordMember(communities, id, true)
+
+			conn.SetReadLimit(s.config.MaxMessageSize)
+
 			if err := conn.SetReadDeadline(time.Now().Add(s.config.Heartbeat)); err != nil {
 				panic(err)
 			}
@@ -303,67 +1046,286 @@ func (s *Signaler) Open() error {
 			defer pings.Stop()
 
 			errs := make(chan error)
+
+			done := make(chan struct{})
+			defer close(done)
+
+			// Inputs are queued so that a slow client can't block the broker; clients which can't keep up are disconnected
+			inputs := make(chan communityInput, s.config.SendQueueLength)
+			overflow := make(chan struct{})
+			overflowOnce := sync.Once{}
+			for _, community := range communities {
+				communityInputs, closeInputs := s.broker.SubscribeToInputs(s.ctx, errs, community)
+				defer func() {
+					if err := closeInputs(); err != nil {
+						panic(err)
+					}
+				}()
+
+				go func(community string) {
+					for {
+						select {
+						case <-done:
+							return
+						case input, ok := <-communityInputs:
+							if !ok {
+								return
+							}
+
+							select {
+							case <-done:
+								return
+							case inputs <- communityInput{community, input}:
+							default:
+								overflowOnce.Do(func() {
+									log.Debug().
+										Str("address", raddr).
+										Str("community", community).
+										Int("queued", len(inputs)).
+										Msg("Send queue overflowed, disconnecting client")
+
+									close(overflow)
+
+									// Unblock pending writes to the client
+									unblockWrites(conn)
+								})
+
+								// Keep draining the inputs until the client has been disconnected, so that the broker isn't blocked
+							}
+						}
+					}
+				}(community)
+			}
+
+			// Payloads are end-to-end encrypted and have been decoded from the sender's envelope when they were received, so they are framed in the version of this client instead of the sender's
+			write := func(community string, p []byte) error {
+				if multiplexed {
+					var err error
+					p, err = websocketapi.Marshal(version, websocketapi.NewEnvelope(community, p))
+					if err != nil {
+						return err
+					}
+				}
+
+				if err := conn.WriteMessage(messageType, p); err != nil {
+					return err
+				}
+
+				s.recordActivity()
+
+				return conn.SetWriteDeadline(time.Now().Add(s.config.Heartbeat))
+			}
+
+			// Replay the introductions of clients which joined shortly before this client; the client is subscribed at this point, so introductions can't be missed in between
+			replayed := map[string]map[string]struct{}{}
+			if s.config.IntroductionWindow > 0 {
+				for _, community := range communities {
+					replayed[community] = map[string]struct{}{}
+
+					s.introductionsLock.Lock()
+					buffered := map[string]introduction{}
+					for peer, intro := range s.introductions[community] {
+						if time.Since(intro.createdAt) > s.config.IntroductionWindow {
+							delete(s.introductions[community], peer)
+
+							continue
+						}
+
+						buffered[peer] = intro
+					}
+					s.introductionsLock.Unlock()
+
+					for peer, intro := range buffered {
+						log.Debug().
+							Str("address", raddr).
+							Str("community", community).
+							Str("peer", peer).
+							Msg("Replaying introduction to client")
+
+						if err := write(community, intro.p); err != nil {
+							panic(err)
+						}
+
+						replayed[community][peer] = struct{}{}
+					}
+				}
+			}
+
+			// Deliver the mail which has been queued while the client was offline; the client is subscribed at this point, so mail which is sent to it from now on is forwarded instead
+			if s.config.MailboxTTL > 0 && strings.TrimSpace(id) != "" {
+				if err := s.deliverMail(raddr, communities, id, write); err != nil {
+					panic(err)
+				}
+			}
+
+			introduced := map[string]struct{}{}
 			go func() {
 				for {
 					messageType, p, err := conn.ReadMessage()
 					if err != nil {
-						if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived) {
-							errs <- err
+						// Clients which have closed the connection cleanly are disconnected without an error
+						if err != websocket.ErrReadLimit && !websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived) {
+							err = errClientClosed
 						}
 
-						errs <- nil
+						select {
+						case <-done:
+						case errs <- err:
+						}
 
 						return
 					}
 
+					community := communities[0]
+					to := ""
+					mail := false
+					if multiplexed {
+						var envelope websocketapi.Envelope
+						if err := websocketapi.Unmarshal(p, &envelope); err != nil {
+							log.Debug().
+								Str("address", raddr).
+								Msg("Could not unmarshal envelope from client, continuing")
+
+							continue
+						}
+
+						if _, ok := joined[envelope.Community]; !ok {
+							log.Debug().
+								Str("address", raddr).
+								Str("community", envelope.Community).
+								Msg("Discarding message for community which the client has not joined")
+
+							continue
+						}
+
+						community = envelope.Community
+						p = envelope.Payload
+						to = envelope.To
+						mail = envelope.Mail
+					}
+
+					if s.isSuspended(community) {
+						log.Debug().
+							Str("address", raddr).
+							Str("community", community).
+							Msg("Discarding message for community which has exceeded the monthly quota")
+
+						continue
+					}
+
+					if mail && s.config.MailboxTTL > 0 && strings.TrimSpace(to) != "" && s.queueMail(raddr, community, to, p) {
+						s.recordUsage(community, len(p))
+
+						continue
+					}
+
 					log.Debug().
 						Str("address", raddr).
 						Str("community", community).
 						Int("type", messageType).
 						Msg("Received message")
 
-					if err := s.broker.PublishInput(s.ctx, brokers.Input{
+					// The first message of a client in a community is its introduction
+					input := brokers.Input{
 						Raddr:       raddr,
 						MessageType: messageType,
 						P:           p,
-					}, community); err != nil {
-						errs <- err
+						To:          to,
+					}
+					if _, ok := introduced[community]; !ok {
+						introduced[community] = struct{}{}
+
+						input.Introduction = true
+
+						// Clients whose introductions have been replayed will receive an offer from this client, so they must not send one too
+						for peer := range replayed[community] {
+							input.Exclude = append(input.Exclude, peer)
+						}
+
+						if s.config.IntroductionWindow > 0 {
+							s.introductionsLock.Lock()
+							if _, ok := s.introductions[community]; !ok {
+								s.introductions[community] = map[string]introduction{}
+							}
+							s.introductions[community][raddr] = introduction{p, time.Now()}
+							s.introductionsLock.Unlock()
+						}
+					}
+
+					if err := s.broker.PublishInput(s.ctx, input, community); err != nil {
+						select {
+						case <-done:
+						case errs <- err:
+						}
 
 						return
 					}
-				}
-			}()
 
-			inputs, closeInputs := s.broker.SubscribeToInputs(s.ctx, errs, community)
-			defer func() {
-				if err := closeInputs(); err != nil {
-					panic(err)
+					s.recordActivity()
+
+					s.recordUsage(community, len(p))
 				}
 			}()
 
 			for {
 				select {
-				case <-s.connections[community][raddr].closer:
+				case <-closer:
+					log.Debug().
+						Str("address", raddr).
+						Int("code", rejection.Code).
+						Str("reason", rejection.Reason).
+						Msg("Disconnecting client")
+
+					if err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(rejection.Code, rejection.Reason), time.Now().Add(s.config.Heartbeat)); err != nil {
+						log.Debug().Err(err).Str("address", raddr).Msg("Could not send close message to client, continuing")
+					}
+
 					return
+				case <-overflow:
+					panic(errSlowConsumer)
 				case err := <-errs:
+					if err == errClientClosed {
+						return
+					}
+
 					panic(err)
 				case input := <-inputs:
 					// Prevent sending message back to sender
-					if input.Raddr == raddr {
+					if input.input.Raddr == raddr {
 						continue
 					}
 
-					if err := conn.WriteMessage(input.MessageType, input.P); err != nil {
-						panic(err)
+					// Prevent sending messages to clients which aren't the recipient; clients which don't send their ID receive all messages
+					if input.input.To != "" && strings.TrimSpace(id) != "" && input.input.To != id {
+						continue
 					}
 
-					if err := conn.SetWriteDeadline(time.Now().Add(s.config.Heartbeat)); err != nil {
+					// Prevent sending introductions twice if they have already been replayed
+					if _, ok := replayed[input.community][input.input.Raddr]; ok && input.input.Introduction {
+						continue
+					}
+
+					// Prevent both clients from sending offers if this client's introduction has been replayed to the sender
+					excluded := false
+					for _, peer := range input.input.Exclude {
+						if peer == raddr {
+							excluded = true
+
+							break
+						}
+					}
+
+					if excluded {
+						continue
+					}
+
+					if err := write(input.community, input.input.P); err != nil {
 						panic(err)
 					}
 				case <-pings.C:
 					log.Debug().
 						Str("address", raddr).
-						Str("community", community).
+						Strs("communities", communities).
 						Msg("Sending ping to client")
 
 					if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -400,7 +1362,20 @@ func (s *Signaler) Open() error {
 				panic(errMissingCommunity)
 			}
 
-			c, err := s.db.CreatePersistentCommunity(s.ctx, community, password)
+			var expiresAt *time.Time
+			if rawTTL := r.URL.Query().Get("ttl"); strings.TrimSpace(rawTTL) != "" {
+				ttl, err := time.ParseDuration(rawTTL)
+				if err != nil {
+					rw.WriteHeader(http.StatusBadRequest)
+
+					panic(err)
+				}
+
+				e := time.Now().Add(ttl)
+				expiresAt = &e
+			}
+
+			c, err := s.db.CreatePersistentCommunity(s.ctx, community, password, expiresAt)
 			if err != nil {
 				panic(err)
 			}
@@ -409,6 +1384,7 @@ func (s *Signaler) Open() error {
 				ID:         c.ID,
 				Clients:    c.Clients,
 				Persistent: c.Persistent,
+				ExpiresAt:  c.ExpiresAt,
 			}
 
 			j, err := json.Marshal(cc)
@@ -479,13 +1455,73 @@ func (s *Signaler) Open() error {
 			s.connectionsLock.Unlock()
 
 			for _, conn := range c {
-				close(conn.closer)
+				if kick.JoinedBefore != nil && !conn.joinedAt.Before(*kick.JoinedBefore) {
+					continue
+				}
+
+				conn.close(websocketapi.CloseKicked, websocketapi.ReasonKicked)
+			}
+		}
+	}()
+
+	go func() {
+		t := time.NewTicker(expiryCheckInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+				expired, err := s.db.DeleteExpiredCommunities(s.ctx)
+				if err != nil {
+					log.Debug().Err(err).Msg("Could not delete expired communities, continuing")
+
+					continue
+				}
+
+				// Force-disconnect the remaining clients of expired communities
+				for _, community := range expired {
+					log.Debug().Str("community", community).Msg("Deleted expired community")
+
+					if err := s.broker.PublishKick(s.ctx, brokers.Kick{
+						Community: community,
+					}); err != nil {
+						log.Debug().Err(err).Str("community", community).Msg("Could not kick clients of expired community, continuing")
+					}
+				}
+			}
+		}
+	}()
+
+	go func() {
+		t := time.NewTicker(usageFlushInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+				s.flushUsage()
 			}
 		}
 	}()
 
+	if err := s.openWebTransport(s.srv.Handler); err != nil {
+		return err
+	}
+
+	listener, err := dualstack.ListenTCP(s.ctx, s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.health.Set(wrtchealth.ConditionListening, true)
+
 	go func() {
-		if err := s.srv.ListenAndServe(); err != nil {
+		if err := s.srv.Serve(listener); err != nil {
 			if err == http.ErrServerClosed {
 				close(s.errs)
 
@@ -501,10 +1537,101 @@ func (s *Signaler) Open() error {
 	return nil
 }
 
-// Close stops listening and disconnects from the database and broker
+// reject writes the status and a machine-readable rejection, which clients can't read from close frames as the handshake hasn't completed yet
+func reject(rw http.ResponseWriter, status int, code int, reason string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	if err := json.NewEncoder(rw).Encode(websocketapi.NewRejection(code, reason)); err != nil {
+		log.Debug().Err(err).Msg("Could not write rejection, continuing")
+	}
+}
+
+func (s *Signaler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range s.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func (s *Signaler) recordUsage(community string, bytes int) {
+	s.usageLock.Lock()
+	defer s.usageLock.Unlock()
+
+	u, ok := s.usage[community]
+	if !ok {
+		u = &usage{}
+		s.usage[community] = u
+	}
+
+	u.messages++
+	u.bytes += int64(bytes)
+}
+
+// Persist whether a client is connected; the signaler only knows the IDs of clients which send them (i.e. for selective signaling), so other clients aren't recorded
+func (s *Signaler) recordMember(communities []string, id string, online bool) {
+	if strings.TrimSpace(id) == "" {
+		return
+	}
+
+	for _, community := range communities {
+		if err := s.db.RecordMember(s.ctx, community, id, online); err != nil {
+			log.Debug().Err(err).Str("community", community).Str("id", id).Msg("Could not record member of community, continuing")
+		}
+	}
+}
+
+// Persist the usage accumulated since the last flush, which prevents writing to the database for every message
+func (s *Signaler) flushUsage() {
+	s.usageLock.Lock()
+	accumulated := s.usage
+	s.usage = map[string]*usage{}
+	s.usageLock.Unlock()
+
+	for community, u := range accumulated {
+		if err := s.db.RecordUsage(s.ctx, community, u.messages, u.bytes); err != nil {
+			log.Debug().Err(err).Str("community", community).Msg("Could not record usage of community, continuing")
+		}
+	}
+
+	s.refreshSuspensions()
+}
+
+// Addr returns the address the signaler is listening on (i.e. to get the port if it has been chosen by the system); if the listening address resolves to multiple addresses, all of them share the port and the first one is returned
+func (s *Signaler) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops listening and disconnects from the database and broker; it can be called multiple times (i.e. after draining)
 func (s *Signaler) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+
+	return s.closeErr
+}
+
+func (s *Signaler) close() error {
 	log.Trace().Msg("Closing signaler")
 
+	// Load balancers stop sending new clients while the existing ones are disconnected
+	s.health.Set(wrtchealth.ConditionListening, false)
+
+	s.flushUsage()
+
 	s.connectionsLock.Lock()
 	defer s.connectionsLock.Unlock()
 	for c := range s.connections {
@@ -527,6 +1654,10 @@ func (s *Signaler) Close() error {
 		}
 	}
 
+	if err := s.closeWebTransport(); err != nil {
+		return err
+	}
+
 	if err := s.srv.Shutdown(s.ctx); err != nil {
 		if err != context.Canceled {
 			return err
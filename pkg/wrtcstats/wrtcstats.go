@@ -0,0 +1,387 @@
+package wrtcstats
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Sample is the quality of the link to a peer at a point in time
+type Sample struct {
+	Time          time.Time     `json:"time"`              // Time at which the sample has been taken
+	Community     string        `json:"community"`         // Community in which the peer is connected
+	PeerID        string        `json:"peerID"`            // ID of the peer
+	Name          string        `json:"name,omitempty"`    // Human-readable name of the peer (empty if the peer has not set one)
+	State         string        `json:"state"`             // State of the connection to the peer
+	Relayed       bool          `json:"relayed,omitempty"` // Whether the connection is relayed through a TURN server or the signaler
+	Path          string        `json:"path,omitempty"`    // Path of the connection (host, srflx, prflx, relay or signaler)
+	BytesSent     uint64        `json:"bytesSent"`         // Total amount of bytes sent to the peer
+	BytesReceived uint64        `json:"bytesReceived"`     // Total amount of bytes received from the peer
+	SendRate      float64       `json:"sendRate"`          // Bytes per second sent since the previous sample
+	ReceiveRate   float64       `json:"receiveRate"`       // Bytes per second received since the previous sample
+	RTT           time.Duration `json:"rtt,omitempty"`     // Round trip time of the selected candidate pair or of the quality probes (0 if neither are measured)
+	Loss          float64       `json:"loss,omitempty"`    // Fraction of the recent quality probes which have been lost (0 if the quality isn't measured)
+}
+
+// Source returns the current samples of all connected peers
+type Source func() []Sample
+
+// RecorderConfig configures the recorder
+type RecorderConfig struct {
+	Interval  time.Duration // Time between samples (default is 10 seconds)
+	Retention time.Duration // Time to keep samples for (default is 1 hour)
+}
+
+// Recorder periodically samples link quality into a ring buffer and optionally persists it to a file, so that it survives restarts
+type Recorder struct {
+	path   string
+	config *RecorderConfig
+	ctx    context.Context
+
+	cancel context.CancelFunc
+
+	sourcesLock sync.Mutex
+	sources     []Source
+
+	samplesLock sync.Mutex
+	samples     []Sample
+	latest      map[string]Sample
+}
+
+// NewRecorder creates the recorder; an empty path keeps samples in memory only
+func NewRecorder(
+	path string,
+	config *RecorderConfig,
+	ctx context.Context,
+) *Recorder {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &RecorderConfig{}
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Second * 10
+	}
+
+	if config.Retention <= 0 {
+		config.Retention = time.Hour
+	}
+
+	return &Recorder{
+		path:   path,
+		config: config,
+		ctx:    ictx,
+
+		cancel: cancel,
+
+		latest: map[string]Sample{},
+	}
+}
+
+// Open loads the persisted samples and starts sampling
+func (r *Recorder) Open() error {
+	log.Trace().Str("path", r.path).Msg("Opening stats recorder")
+
+	if r.path != "" {
+		if err := r.load(); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		t := time.NewTicker(r.config.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-t.C:
+				r.sample()
+
+				if r.path == "" {
+					continue
+				}
+
+				if err := r.persist(); err != nil {
+					log.Debug().Err(err).Str("path", r.path).Msg("Could not persist stats, continuing")
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// AddSource adds a source to take samples from
+func (r *Recorder) AddSource(source Source) {
+	r.sourcesLock.Lock()
+	defer r.sourcesLock.Unlock()
+
+	r.sources = append(r.sources, source)
+}
+
+func (r *Recorder) sample() {
+	r.sourcesLock.Lock()
+	sources := append([]Source{}, r.sources...)
+	r.sourcesLock.Unlock()
+
+	for _, source := range sources {
+		for _, sample := range source() {
+			r.Record(sample)
+		}
+	}
+}
+
+// Record adds a sample, calculating its rates from the previous sample of the same peer
+func (r *Recorder) Record(sample Sample) {
+	if sample.Time.IsZero() {
+		sample.Time = time.Now()
+	}
+
+	r.samplesLock.Lock()
+	defer r.samplesLock.Unlock()
+
+	key := sample.Community + "/" + sample.PeerID
+	if previous, ok := r.latest[key]; ok {
+		// Counters are reset if the peer has reconnected, in which case no rate can be calculated
+		if elapsed := sample.Time.Sub(previous.Time).Seconds(); elapsed > 0 && sample.BytesSent >= previous.BytesSent && sample.BytesReceived >= previous.BytesReceived {
+			sample.SendRate = float64(sample.BytesSent-previous.BytesSent) / elapsed
+			sample.ReceiveRate = float64(sample.BytesReceived-previous.BytesReceived) / elapsed
+		}
+	}
+
+	r.latest[key] = sample
+	r.samples = append(r.samples, sample)
+
+	r.prune(sample.Time)
+}
+
+// prune removes samples which are older than the retention; must be called with the samples lock held
+func (r *Recorder) prune(now time.Time) {
+	cutoff := now.Add(-r.config.Retention)
+
+	i := sort.Search(len(r.samples), func(i int) bool {
+		return !r.samples[i].Time.Before(cutoff)
+	})
+	if i > 0 {
+		r.samples = append([]Sample{}, r.samples[i:]...)
+	}
+
+	for key, sample := range r.latest {
+		if sample.Time.Before(cutoff) {
+			delete(r.latest, key)
+		}
+	}
+}
+
+// Samples returns all samples which have been taken since a point in time
+func (r *Recorder) Samples(since time.Time) []Sample {
+	r.samplesLock.Lock()
+	defer r.samplesLock.Unlock()
+
+	i := sort.Search(len(r.samples), func(i int) bool {
+		return !r.samples[i].Time.Before(since)
+	})
+
+	return append([]Sample{}, r.samples[i:]...)
+}
+
+// Latest returns the most recent sample of each peer
+func (r *Recorder) Latest() []Sample {
+	r.samplesLock.Lock()
+	defer r.samplesLock.Unlock()
+
+	samples := []Sample{}
+	for _, sample := range r.latest {
+		samples = append(samples, sample)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Community != samples[j].Community {
+			return samples[i].Community < samples[j].Community
+		}
+
+		return samples[i].PeerID < samples[j].PeerID
+	})
+
+	return samples
+}
+
+// ServeHTTP returns the latest sample of each peer, or all samples in the duration specified by the `history` query parameter (i.e. ?history=1h)
+func (r *Recorder) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var samples []Sample
+	if history := req.URL.Query().Get("history"); history != "" {
+		d, err := time.ParseDuration(history)
+		if err != nil {
+			rw.WriteHeader(http.StatusUnprocessableEntity)
+
+			return
+		}
+
+		samples = r.Samples(time.Now().Add(-d))
+	} else {
+		samples = r.Latest()
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(samples); err != nil {
+		log.Debug().Err(err).Msg("Could not write stats, continuing")
+	}
+}
+
+func (r *Recorder) load() error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+	defer f.Close()
+
+	r.samplesLock.Lock()
+	defer r.samplesLock.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			log.Debug().Err(err).Str("path", r.path).Msg("Could not parse persisted sample, skipping")
+
+			continue
+		}
+
+		r.samples = append(r.samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	sort.SliceStable(r.samples, func(i, j int) bool {
+		return r.samples[i].Time.Before(r.samples[j].Time)
+	})
+
+	// Rates are only calculated between samples of the same run, so persisted samples don't become the previous sample
+	r.prune(time.Now())
+	r.latest = map[string]Sample{}
+
+	return nil
+}
+
+// persist replaces the file with the current samples
+func (r *Recorder) persist() error {
+	samples := r.Samples(time.Time{})
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that an interrupted write can't leave a partial file behind
+	f, err := os.CreateTemp(filepath.Dir(r.path), "."+filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	for _, sample := range samples {
+		p, err := json.Marshal(sample)
+		if err != nil {
+			_ = f.Close()
+
+			return err
+		}
+
+		if _, err := w.Write(append(p, '\n')); err != nil {
+			_ = f.Close()
+
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), r.path)
+}
+
+// Close stops sampling and persists the samples
+func (r *Recorder) Close() error {
+	log.Trace().Str("path", r.path).Msg("Closing stats recorder")
+
+	r.cancel()
+
+	if r.path == "" {
+		return nil
+	}
+
+	return r.persist()
+}
+
+// GetSamples fetches the latest sample of each peer from a control API, or all samples in the history if it is not 0
+func GetSamples(ctx context.Context, raddr string, history time.Duration) ([]Sample, error) {
+	u, err := url.Parse(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = "/stats"
+	if history > 0 {
+		q := u.Query()
+		q.Set("history", history.String())
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	samples := []Sample{}
+	if err := json.NewDecoder(res.Body).Decode(&samples); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,129 @@
+package wrtctest
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+)
+
+// AdapterConfig configures the mock adapter
+type AdapterConfig struct {
+	ID        string // ID of the adapter (default is UUID)
+	Community string // Community to report for peers
+	Name      string // Name to report to connected adapters
+	Metadata  []byte // Metadata to report to connected adapters
+}
+
+// Adapter is a mock adapter which connects peers in memory without a signaler or ICE
+type Adapter struct {
+	config *AdapterConfig
+	ctx    context.Context
+
+	cancel context.CancelFunc
+	peers  chan *wrtcconn.Peer
+
+	channelsLock sync.Mutex
+	channels     map[string]chan *wrtcconn.Peer
+}
+
+// NewAdapter creates the mock adapter
+func NewAdapter(
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if strings.TrimSpace(config.ID) == "" {
+		config.ID = uuid.NewString()
+	}
+
+	return &Adapter{
+		config: config,
+		ctx:    ictx,
+
+		cancel: cancel,
+		peers:  make(chan *wrtcconn.Peer),
+
+		channels: map[string]chan *wrtcconn.Peer{},
+	}
+}
+
+// ID returns the ID of the adapter
+func (a *Adapter) ID() string {
+	return a.config.ID
+}
+
+// Connect connects the adapter to a remote adapter on a channel; both adapters receive a peer on Accept
+func (a *Adapter) Connect(remote *Adapter, channelID string) {
+	local, rconn := net.Pipe()
+
+	a.deliver(&wrtcconn.Peer{
+		PeerID:    remote.config.ID,
+		Name:      remote.config.Name,
+		ChannelID: channelID,
+		Conn:      local,
+		Metadata:  remote.config.Metadata,
+		Community: a.config.Community,
+	})
+
+	remote.deliver(&wrtcconn.Peer{
+		PeerID:    a.config.ID,
+		Name:      a.config.Name,
+		ChannelID: channelID,
+		Conn:      rconn,
+		Metadata:  a.config.Metadata,
+		Community: remote.config.Community,
+	})
+}
+
+func (a *Adapter) deliver(p *wrtcconn.Peer) {
+	a.channelsLock.Lock()
+	peers, ok := a.channels[p.ChannelID]
+	if !ok {
+		peers = a.peers
+	}
+	a.channelsLock.Unlock()
+
+	go func() {
+		select {
+		case <-a.ctx.Done():
+			_ = p.Conn.Close()
+		case peers <- p:
+		}
+	}()
+}
+
+// Close stops delivering peers
+func (a *Adapter) Close() error {
+	a.cancel()
+
+	return nil
+}
+
+// Accept returns a channel on which peers will be sent when they connect
+func (a *Adapter) Accept() chan *wrtcconn.Peer {
+	return a.peers
+}
+
+// AcceptChannel returns a channel on which peers will be sent when they connect on a channel; once it has been called, peers on this channel are no longer sent to Accept
+func (a *Adapter) AcceptChannel(channelID string) chan *wrtcconn.Peer {
+	a.channelsLock.Lock()
+	defer a.channelsLock.Unlock()
+
+	peers, ok := a.channels[channelID]
+	if !ok {
+		peers = make(chan *wrtcconn.Peer)
+
+		a.channels[channelID] = peers
+	}
+
+	return peers
+}
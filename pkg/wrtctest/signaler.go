@@ -0,0 +1,73 @@
+package wrtctest
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/pojntfx/weron/pkg/wrtcsgl"
+)
+
+const (
+	Password = "password"                         // Password for communities on the signaler
+	Key      = "0123456789abcdef0123456789abcdef" // Encryption key for adapters created by the signaler
+)
+
+// Signaler is an in-process signaler with ephemeral communities which listens on a random loopback port
+type Signaler struct {
+	*wrtcsgl.Signaler
+}
+
+// NewSignaler creates the signaler
+func NewSignaler(
+	config *wrtcsgl.SignalerConfig,
+	ctx context.Context,
+) *Signaler {
+	if config == nil {
+		config = &wrtcsgl.SignalerConfig{
+			Heartbeat: time.Second * 10,
+		}
+	}
+
+	config.EphemeralCommunities = true
+
+	return &Signaler{
+		Signaler: wrtcsgl.NewSignaler("127.0.0.1:0", "", "", config, ctx),
+	}
+}
+
+// URL returns the address to join a community on the signaler with
+func (s *Signaler) URL(community string) string {
+	q := url.Values{}
+	q.Set("community", community)
+	q.Set("password", Password)
+
+	return (&url.URL{
+		Scheme:   "ws",
+		Host:     s.Addr().String(),
+		Path:     "/",
+		RawQuery: q.Encode(),
+	}).String()
+}
+
+// NewAdapter creates an adapter which joins a community on the signaler and connects to peers without STUN or TURN servers
+func (s *Signaler) NewAdapter(
+	community string,
+	channels []string,
+	config *wrtcconn.AdapterConfig,
+	ctx context.Context,
+) *wrtcconn.Adapter {
+	if config == nil {
+		config = &wrtcconn.AdapterConfig{}
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second * 10
+	}
+
+	// Loopback candidates allow connecting without network access
+	config.IncludeLoopback = true
+
+	return wrtcconn.NewAdapter(s.URL(community), Key, []string{}, channels, config, ctx)
+}
@@ -0,0 +1,166 @@
+package wrtcthr
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	challengeLength = 32   // Length of the challenge which clients have to sign
+	controlLength   = 1024 // Maximum length of handshake messages
+
+	statusDenied = "denied" // The client could not be authenticated
+	statusQueued = "queued" // Another test is running; the client has to wait
+	statusReady  = "ready"  // The client can start the test
+)
+
+var (
+	ErrAccessDenied          = errors.New("access denied")                    // The server has rejected the credentials
+	ErrInvalidAuthorizedUser = errors.New("invalid line in authorized users") // A line in the authorized users is not in the format username,hash
+	ErrUnexpectedStatus      = errors.New("received unexpected status")       // The server has sent a status which is not part of the handshake
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+type challenge struct {
+	Challenge []byte `json:"challenge"`
+}
+
+type response struct {
+	Username string `json:"username"`
+	MAC      []byte `json:"mac"`
+}
+
+type status struct {
+	Status string `json:"status"`
+}
+
+// HashPassword hashes a password in the same way as iperf3, so that its authorized users files can be used
+func HashPassword(username, password string) string {
+	hash := sha256.Sum256([]byte("{" + username + "}" + password))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// ParseAuthorizedUsers parses authorized users in the format of iperf3 (one username,hash pair per line; lines starting with # are ignored)
+func ParseAuthorizedUsers(r io.Reader) (map[string]string, error) {
+	users := map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ",", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, ErrInvalidAuthorizedUser
+		}
+
+		users[strings.TrimSpace(parts[0])] = strings.ToLower(strings.TrimSpace(parts[1]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func sign(hash string, c []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(hash))
+	mac.Write(c)
+
+	return mac.Sum(nil)
+}
+
+func writeMessage(w io.Writer, v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(p)
+
+	return err
+}
+
+func readMessage(r io.Reader, v interface{}) error {
+	buf := make([]byte, controlLength)
+	n, err := r.Read(buf)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf[:n], v)
+}
+
+// authenticate challenges the client to sign a random value with the hash of its password
+func (a *Adapter) authenticate(conn io.ReadWriter) (string, error) {
+	c := make([]byte, challengeLength)
+	if _, err := rand.Read(c); err != nil {
+		return "", err
+	}
+
+	if err := writeMessage(conn, challenge{c}); err != nil {
+		return "", err
+	}
+
+	var res response
+	if err := readMessage(conn, &res); err != nil {
+		return "", err
+	}
+
+	hash, ok := a.config.AuthorizedUsers[res.Username]
+	if !ok || !hmac.Equal(sign(hash, c), res.MAC) {
+		if err := writeMessage(conn, status{statusDenied}); err != nil {
+			return "", err
+		}
+
+		return res.Username, ErrAccessDenied
+	}
+
+	return res.Username, nil
+}
+
+// login answers the server's challenge and waits until the test can be started
+func (a *Adapter) login(conn io.ReadWriter, onQueued func()) error {
+	var c challenge
+	if err := readMessage(conn, &c); err != nil {
+		return err
+	}
+
+	if err := writeMessage(conn, response{
+		Username: a.config.Username,
+		MAC:      sign(HashPassword(a.config.Username, a.config.Password), c.Challenge),
+	}); err != nil {
+		return err
+	}
+
+	for {
+		var s status
+		if err := readMessage(conn, &s); err != nil {
+			return err
+		}
+
+		switch s.Status {
+		case statusReady:
+			return nil
+		case statusQueued:
+			onQueued()
+		case statusDenied:
+			return ErrAccessDenied
+		default:
+			return ErrUnexpectedStatus
+		}
+	}
+}
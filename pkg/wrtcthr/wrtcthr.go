@@ -3,6 +3,7 @@ package wrtcthr
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"math"
 	"strings"
 	"time"
@@ -21,12 +22,17 @@ const (
 // AdapterConfig configures the adapter
 type AdapterConfig struct {
 	*wrtcconn.AdapterConfig
-	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
-	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
-	OnPeerDisconnected func(string) // Handler to be called when the adapter has received a message
-	Server             bool         // Whether to act as the server
-	PacketLength       int          // Length of the packet to measure latency with
-	PacketCount        int          // Amount of packets to send before measuring
+	OnSignalerConnect  func(string)      // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string)      // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string)      // Handler to be called when the adapter has received a message
+	OnPeerQueued       func(string)      // Handler to be called when the server is busy with another test and the test has been queued
+	Server             bool              // Whether to act as the server
+	PacketLength       int               // Length of the packet to measure latency with
+	PacketCount        int               // Amount of packets to send before measuring
+	AuthorizedUsers    map[string]string // Usernames and password hashes of the clients which may run tests; if set, tests are run one after another (only used when acting as a server)
+	MaxDuration        time.Duration     // Time after which a test is stopped (0 disables the limit) (only used when acting as a server with authorized users)
+	Username           string            // Username to authenticate to the server with (empty disables authentication) (only used when acting as a client)
+	Password           string            // Password to authenticate to the server with (only used when acting as a client)
 }
 
 // Totals are the total statistics
@@ -66,6 +72,8 @@ type Adapter struct {
 	acknowledgements chan Acknowledgement
 
 	closer *broadcast.Relay[struct{}]
+
+	tests chan struct{}
 }
 
 // NewAdapter creates the adapter
@@ -94,6 +102,8 @@ func NewAdapter(
 		ids:              make(chan string),
 		totals:           make(chan Totals),
 		acknowledgements: make(chan Acknowledgement),
+
+		tests: make(chan struct{}, 1),
 	}
 }
 
@@ -146,6 +156,8 @@ func (a *Adapter) Wait() error {
 			return nil
 		case err := <-errs:
 			return err
+		case err := <-a.adapter.Err():
+			return err
 		case id := <-a.ids:
 			log.Debug().Str("id", id).Msg("Connected to signaler")
 
@@ -153,7 +165,7 @@ func (a *Adapter) Wait() error {
 				a.config.OnSignalerConnect(id)
 			}
 		case peer := <-a.adapter.Accept():
-			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Connected to peer")
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
 
 			if a.config.Server {
 				go func() {
@@ -169,6 +181,80 @@ func (a *Adapter) Wait() error {
 						a.config.OnPeerConnect(peer.PeerID)
 					}
 
+					if len(a.config.AuthorizedUsers) > 0 {
+						username, err := a.authenticate(peer.Conn)
+						if err != nil {
+							log.Debug().
+								Err(err).
+								Str("channelID", peer.ChannelID).
+								Str("peerID", peer.PeerID).
+								Str("username", username).
+								Msg("Could not authenticate peer, stopping")
+
+							_ = peer.Conn.Close()
+
+							return
+						}
+
+						// Tests are run one after another so that they don't skew each other's results
+						select {
+						case a.tests <- struct{}{}:
+						default:
+							log.Debug().
+								Str("channelID", peer.ChannelID).
+								Str("peerID", peer.PeerID).
+								Str("username", username).
+								Msg("Queueing test because another test is running")
+
+							if err := writeMessage(peer.Conn, status{statusQueued}); err != nil {
+								log.Debug().
+									Err(err).
+									Str("channelID", peer.ChannelID).
+									Str("peerID", peer.PeerID).
+									Msg("Could not write to peer, stopping")
+
+								return
+							}
+
+							select {
+							case <-a.ctx.Done():
+								return
+							case a.tests <- struct{}{}:
+							}
+						}
+						defer func() {
+							<-a.tests
+						}()
+
+						if err := writeMessage(peer.Conn, status{statusReady}); err != nil {
+							log.Debug().
+								Err(err).
+								Str("channelID", peer.ChannelID).
+								Str("peerID", peer.PeerID).
+								Msg("Could not write to peer, stopping")
+
+							return
+						}
+
+						log.Debug().
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Str("username", username).
+							Msg("Starting test")
+
+						if a.config.MaxDuration > 0 {
+							t := time.AfterFunc(a.config.MaxDuration, func() {
+								log.Debug().
+									Str("channelID", peer.ChannelID).
+									Str("peerID", peer.PeerID).
+									Msg("Stopping test because it has reached the maximum duration")
+
+								_ = peer.Conn.Close()
+							})
+							defer t.Stop()
+						}
+					}
+
 					for {
 						read := 0
 						for i := 0; i < a.config.PacketCount; i++ {
@@ -257,6 +343,36 @@ func (a *Adapter) Wait() error {
 						}
 					}()
 
+					if strings.TrimSpace(a.config.Username) != "" {
+						if err := a.login(peer.Conn, func() {
+							log.Debug().
+								Str("channelID", peer.ChannelID).
+								Str("peerID", peer.PeerID).
+								Msg("Waiting for other tests to finish")
+
+							if a.config.OnPeerQueued != nil {
+								a.config.OnPeerQueued(peer.PeerID)
+							}
+						}); err != nil {
+							if errors.Is(err, ErrAccessDenied) {
+								errs <- err
+
+								return
+							}
+
+							log.Debug().
+								Err(err).
+								Str("channelID", peer.ChannelID).
+								Str("peerID", peer.PeerID).
+								Msg("Could not authenticate to peer, stopping")
+
+							return
+						}
+
+						// The test starts once the server is ready, not when the channel has been opened
+						totalStart = time.Now()
+					}
+
 					for {
 						start := time.Now()
 
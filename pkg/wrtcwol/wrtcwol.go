@@ -0,0 +1,300 @@
+package wrtcwol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pojntfx/weron/pkg/services"
+	"github.com/pojntfx/weron/pkg/wrtcconn"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	macLength          = 6  // Length of a MAC address (EUI-48)
+	magicSyncLength    = 6  // Amount of 0xff bytes at the start of a magic packet
+	magicRepeatedCount = 16 // Amount of times the MAC address is repeated in a magic packet
+
+	statusOK    byte = 0 // The magic packet has been sent
+	statusError byte = 1 // The magic packet could not be sent; followed by the error message
+)
+
+var (
+	ErrInvalidMAC = errors.New("invalid MAC address, only EUI-48 addresses are supported") // The MAC address can't be used in a magic packet
+)
+
+// AdapterConfig configures the adapter
+type AdapterConfig struct {
+	*wrtcconn.NamedAdapterConfig
+	OnSignalerConnect  func(string) // Handler to be called when the adapter has connected to the signaler
+	OnPeerConnect      func(string) // Handler to be called when the adapter has connected to a peer
+	OnPeerDisconnected func(string) // Handler to be called when the adapter has disconnected from a peer
+	Server             bool         // Whether to relay wake requests from peers to the local network
+	Broadcast          string       // UDP address to send magic packets to (i.e. 192.168.1.255:9) (default is 255.255.255.255:9)
+}
+
+type wolPeer struct {
+	*wrtcconn.Peer
+
+	lock      sync.Mutex
+	responses chan error
+}
+
+// Adapter provides a Wake-on-LAN relay service
+type Adapter struct {
+	signaler string
+	key      string
+	ice      []string
+	config   *AdapterConfig
+	ctx      context.Context
+
+	cancel  context.CancelFunc
+	adapter *wrtcconn.NamedAdapter
+
+	ids chan string
+
+	peersLock    sync.Mutex
+	peers        map[string]*wolPeer
+	peersChanged chan struct{}
+}
+
+// NewAdapter creates the adapter
+func NewAdapter(
+	signaler string,
+	key string,
+	ice []string,
+	config *AdapterConfig,
+	ctx context.Context,
+) *Adapter {
+	ictx, cancel := context.WithCancel(ctx)
+
+	if config == nil {
+		config = &AdapterConfig{}
+	}
+
+	if strings.TrimSpace(config.Broadcast) == "" {
+		config.Broadcast = "255.255.255.255:9"
+	}
+
+	return &Adapter{
+		signaler: signaler,
+		key:      key,
+		ice:      ice,
+		config:   config,
+		ctx:      ictx,
+
+		cancel: cancel,
+
+		ids: make(chan string),
+
+		peers:        map[string]*wolPeer{},
+		peersChanged: make(chan struct{}),
+	}
+}
+
+// Open connects the adapter to the signaler
+func (a *Adapter) Open() error {
+	log.Trace().Msg("Opening adapter")
+
+	a.adapter = wrtcconn.NewNamedAdapter(
+		a.signaler,
+		a.key,
+		strings.Split(strings.Join(a.ice, ","), ","),
+		[]string{services.WakePrimary},
+		a.config.NamedAdapterConfig,
+		a.ctx,
+	)
+
+	var err error
+	a.ids, err = a.adapter.Open()
+
+	return err
+}
+
+// Close disconnects the adapter from the signaler
+func (a *Adapter) Close() error {
+	log.Trace().Msg("Closing adapter")
+
+	return a.adapter.Close()
+}
+
+// Wait starts handling peers
+func (a *Adapter) Wait() error {
+	for {
+		select {
+		case <-a.ctx.Done():
+			log.Trace().Err(a.ctx.Err()).Msg("Context cancelled")
+
+			if err := a.ctx.Err(); err != context.Canceled {
+				return err
+			}
+
+			return nil
+		case err := <-a.adapter.Err():
+			return err
+		case id := <-a.ids:
+			log.Debug().Str("id", id).Msg("Connected to signaler")
+
+			if a.config.OnSignalerConnect != nil {
+				a.config.OnSignalerConnect(id)
+			}
+		case peer := <-a.adapter.Accept():
+			log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Str("name", peer.Name).Msg("Connected to peer")
+
+			if a.config.OnPeerConnect != nil {
+				a.config.OnPeerConnect(peer.PeerID)
+			}
+
+			p := &wolPeer{
+				Peer: peer,
+
+				responses: make(chan error, 1),
+			}
+
+			a.peersLock.Lock()
+			a.peers[peer.PeerID] = p
+			close(a.peersChanged)
+			a.peersChanged = make(chan struct{})
+			a.peersLock.Unlock()
+
+			go func() {
+				defer func() {
+					log.Debug().Str("channelID", peer.ChannelID).Str("peerID", peer.PeerID).Msg("Disconnected from peer")
+
+					if a.config.OnPeerDisconnected != nil {
+						a.config.OnPeerDisconnected(peer.PeerID)
+					}
+
+					a.peersLock.Lock()
+					if a.peers[peer.PeerID] == p {
+						delete(a.peers, peer.PeerID)
+					}
+					a.peersLock.Unlock()
+				}()
+
+				buf := make([]byte, 1024)
+				for {
+					n, err := peer.Conn.Read(buf)
+					if err != nil {
+						log.Debug().
+							Err(err).
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Msg("Could not read from peer, stopping")
+
+						return
+					}
+
+					if !a.config.Server {
+						if n <= 0 {
+							continue
+						}
+
+						var err error
+						if buf[0] != statusOK {
+							err = errors.New(string(buf[1:n]))
+						}
+
+						select {
+						case p.responses <- err:
+						default:
+						}
+
+						continue
+					}
+
+					res := []byte{statusOK}
+					if err := a.sendMagicPacket(buf[:n]); err != nil {
+						log.Debug().
+							Err(err).
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Msg("Could not send magic packet, continuing")
+
+						res = append([]byte{statusError}, []byte(err.Error())...)
+					} else {
+						log.Debug().
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Str("mac", net.HardwareAddr(buf[:n]).String()).
+							Str("broadcast", a.config.Broadcast).
+							Msg("Sent magic packet")
+					}
+
+					if _, err := peer.Conn.Write(res); err != nil {
+						log.Debug().
+							Err(err).
+							Str("channelID", peer.ChannelID).
+							Str("peerID", peer.PeerID).
+							Msg("Could not write to peer, stopping")
+
+						return
+					}
+				}
+			}()
+		}
+	}
+}
+
+func (a *Adapter) sendMagicPacket(mac []byte) error {
+	if len(mac) != macLength {
+		return ErrInvalidMAC
+	}
+
+	packet := append(bytes.Repeat([]byte{0xff}, magicSyncLength), bytes.Repeat(mac, magicRepeatedCount)...)
+
+	conn, err := net.Dial("udp", a.config.Broadcast)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(packet)
+
+	return err
+}
+
+// Wake asks a peer to send a magic packet for a MAC address to its local network; it blocks until the peer has connected and responded
+func (a *Adapter) Wake(peerID string, mac net.HardwareAddr) error {
+	if len(mac) != macLength {
+		return ErrInvalidMAC
+	}
+
+	var p *wolPeer
+	for {
+		a.peersLock.Lock()
+		candidate, ok := a.peers[peerID]
+		changed := a.peersChanged
+		a.peersLock.Unlock()
+
+		if ok {
+			p = candidate
+
+			break
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return a.ctx.Err()
+		case <-changed:
+		}
+	}
+
+	// Only one request can be in flight per peer, as responses don't reference their request
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, err := p.Conn.Write(mac); err != nil {
+		return err
+	}
+
+	select {
+	case <-a.ctx.Done():
+		return a.ctx.Err()
+	case err := <-p.responses:
+		return err
+	}
+}
@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+	"github.com/pojntfx/weron/pkg/wrtcsgl"
+)
+
+type communityResource struct {
+	manager *wrtcmgr.Manager
+}
+
+type communityResourceModel struct {
+	ID        types.String `tfsdk:"id"`
+	Password  types.String `tfsdk:"password"`
+	ExpiresAt types.String `tfsdk:"expires_at"`
+}
+
+func newCommunityResource() resource.Resource {
+	return &communityResource{}
+}
+
+func (r *communityResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_community"
+}
+
+func (r *communityResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Persistent community, which is not deleted after the last peer leaves. Clients which have joined with the old password are kicked if the password changes.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "ID of the community",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"password": schema.StringAttribute{
+				Description: "Password for the community",
+				Required:    true,
+				Sensitive:   true,
+			},
+			"expires_at": schema.StringAttribute{
+				Description: "Time after which the community is deleted and its peers are kicked (in RFC 3339 format) (i.e. 2030-01-01T00:00:00Z) (the community never expires if unset)",
+				Optional:    true,
+			},
+		},
+	}
+}
+
+func (r *communityResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	r.manager = configureManager(req.ProviderData, &resp.Diagnostics)
+}
+
+// apply creates or updates the community; its leases are managed by the lease resource, so they are kept
+func (r *communityResource) apply(model *communityResourceModel) error {
+	var expiresAt *time.Time
+	if !model.ExpiresAt.IsNull() && model.ExpiresAt.ValueString() != "" {
+		t, err := time.Parse(time.RFC3339, model.ExpiresAt.ValueString())
+		if err != nil {
+			return err
+		}
+
+		expiresAt = &t
+	}
+
+	_, err := r.manager.Apply(wrtcsgl.Spec{
+		Communities: []wrtcsgl.CommunitySpec{
+			{
+				ID:        model.ID.ValueString(),
+				Password:  model.Password.ValueString(),
+				ExpiresAt: expiresAt,
+			},
+		},
+	}, false)
+
+	return err
+}
+
+func (r *communityResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan communityResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.apply(&plan); err != nil {
+		resp.Diagnostics.AddError("Could not create community", err.Error())
+
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *communityResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state communityResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	communities, err := r.manager.ListCommunities()
+	if err != nil {
+		resp.Diagnostics.AddError("Could not list communities", err.Error())
+
+		return
+	}
+
+	for _, c := range communities {
+		if c.ID != state.ID.ValueString() || !c.Persistent {
+			continue
+		}
+
+		// The password is hashed by the signaler, so it can't be read back
+		if c.ExpiresAt == nil {
+			state.ExpiresAt = types.StringNull()
+		} else if current, err := time.Parse(time.RFC3339, state.ExpiresAt.ValueString()); err != nil || !current.Equal(*c.ExpiresAt) {
+			state.ExpiresAt = types.StringValue(c.ExpiresAt.Format(time.RFC3339))
+		}
+
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+
+		return
+	}
+
+	resp.State.RemoveResource(ctx)
+}
+
+func (r *communityResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan communityResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.apply(&plan); err != nil {
+		resp.Diagnostics.AddError("Could not update community", err.Error())
+
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *communityResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state communityResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.manager.DeleteCommunity(state.ID.ValueString()); err != nil && !isNotFound(err) {
+		resp.Diagnostics.AddError("Could not delete community", err.Error())
+	}
+}
+
+// ImportState imports a community by its ID; the password has to be set in the configuration, and is applied on the next run
+func (r *communityResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+)
+
+type leaseResource struct {
+	manager *wrtcmgr.Manager
+}
+
+type leaseResourceModel struct {
+	ID        types.String   `tfsdk:"id"`
+	Community types.String   `tfsdk:"community"`
+	PeerID    types.String   `tfsdk:"peer_id"`
+	IPs       []types.String `tfsdk:"ips"`
+	Name      types.String   `tfsdk:"name"`
+}
+
+func newLeaseResource() resource.Resource {
+	return &leaseResource{}
+}
+
+func (r *leaseResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_lease"
+}
+
+func (r *leaseResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Lease which reserves IPs and a name for a peer in a persistent community.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "ID of the lease (in format community/peer_id)",
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"community": schema.StringAttribute{
+				Description: "ID of the persistent community to create the lease in",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"peer_id": schema.StringAttribute{
+				Description: "ID of the peer (i.e. its hostname)",
+				Required:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"ips": schema.ListAttribute{
+				Description: "IP addresses to reserve for the peer (i.e. [\"2001:db8::1/32\", \"192.0.2.1/24\"])",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"name": schema.StringAttribute{
+				Description: "Name to reserve for the peer",
+				Optional:    true,
+			},
+		},
+	}
+}
+
+func (r *leaseResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	r.manager = configureManager(req.ProviderData, &resp.Diagnostics)
+}
+
+func (r *leaseResource) apply(model *leaseResourceModel) error {
+	ips := []string{}
+	for _, ip := range model.IPs {
+		ips = append(ips, ip.ValueString())
+	}
+
+	if _, err := r.manager.CreateLease(model.Community.ValueString(), model.PeerID.ValueString(), ips, model.Name.ValueString()); err != nil {
+		return err
+	}
+
+	model.ID = types.StringValue(model.Community.ValueString() + "/" + model.PeerID.ValueString())
+
+	return nil
+}
+
+func (r *leaseResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan leaseResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.apply(&plan); err != nil {
+		resp.Diagnostics.AddError("Could not create lease", err.Error())
+
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *leaseResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state leaseResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	leases, err := r.manager.ListLeases(state.Community.ValueString())
+	if err != nil {
+		if isNotFound(err) {
+			resp.State.RemoveResource(ctx)
+
+			return
+		}
+
+		resp.Diagnostics.AddError("Could not list leases", err.Error())
+
+		return
+	}
+
+	for _, l := range leases {
+		if l.ID != state.PeerID.ValueString() {
+			continue
+		}
+
+		// Unset optional attributes are kept unset so that they don't show up as changes
+		if len(l.IPs) > 0 || state.IPs != nil {
+			state.IPs = []types.String{}
+			for _, ip := range l.IPs {
+				state.IPs = append(state.IPs, types.StringValue(ip))
+			}
+		}
+
+		if l.Name != "" || !state.Name.IsNull() {
+			state.Name = types.StringValue(l.Name)
+		}
+
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+
+		return
+	}
+
+	resp.State.RemoveResource(ctx)
+}
+
+func (r *leaseResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan leaseResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.apply(&plan); err != nil {
+		resp.Diagnostics.AddError("Could not update lease", err.Error())
+
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *leaseResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state leaseResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.manager.DeleteLease(state.Community.ValueString(), state.PeerID.ValueString()); err != nil && !isNotFound(err) {
+		resp.Diagnostics.AddError("Could not delete lease", err.Error())
+	}
+}
+
+// ImportState imports a lease by its ID (in format community/peer_id)
+func (r *leaseResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	parts := strings.SplitN(req.ID, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		resp.Diagnostics.AddError("Invalid import ID", "Expected an ID in format community/peer_id.")
+
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), req.ID)...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("community"), parts[0])...)
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("peer_id"), parts[1])...)
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/pojntfx/weron/pkg/wrtcmgr"
+)
+
+const (
+	defaultRaddr       = "https://weron.up.railway.app/"
+	defaultAPIUsername = "admin"
+)
+
+type weronProvider struct{}
+
+type providerModel struct {
+	Raddr       types.String `tfsdk:"raddr"`
+	APIUsername types.String `tfsdk:"api_username"`
+	APIPassword types.String `tfsdk:"api_password"`
+}
+
+// New creates the provider
+func New() provider.Provider {
+	return &weronProvider{}
+}
+
+func (p *weronProvider) Metadata(ctx context.Context, req provider.MetadataRequest, resp *provider.MetadataResponse) {
+	resp.TypeName = "weron"
+}
+
+func (p *weronProvider) Schema(ctx context.Context, req provider.SchemaRequest, resp *provider.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manages persistent communities and their leases on a weron signaler.",
+		Attributes: map[string]schema.Attribute{
+			"raddr": schema.StringAttribute{
+				Description: "Remote address of the signaler (can also be set using the RADDR env variable) (default is " + defaultRaddr + ")",
+				Optional:    true,
+			},
+			"api_username": schema.StringAttribute{
+				Description: "Username for the management API (can also be set using the API_USERNAME env variable) (default is " + defaultAPIUsername + ")",
+				Optional:    true,
+			},
+			"api_password": schema.StringAttribute{
+				Description: "Password for the management API (can also be set using the API_PASSWORD env variable)",
+				Optional:    true,
+				Sensitive:   true,
+			},
+		},
+	}
+}
+
+// getValue returns the value of an attribute, falling back to an env variable and a default value
+func getValue(value types.String, env string, fallback string) string {
+	if !value.IsNull() && !value.IsUnknown() {
+		return value.ValueString()
+	}
+
+	if v := os.Getenv(env); strings.TrimSpace(v) != "" {
+		return v
+	}
+
+	return fallback
+}
+
+func (p *weronProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+	var config providerModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	password := getValue(config.APIPassword, "API_PASSWORD", "")
+	if strings.TrimSpace(password) == "" {
+		resp.Diagnostics.AddError("Missing API password", "Set the api_password attribute or the API_PASSWORD env variable.")
+
+		return
+	}
+
+	manager := wrtcmgr.NewManager(
+		getValue(config.Raddr, "RADDR", defaultRaddr),
+		getValue(config.APIUsername, "API_USERNAME", defaultAPIUsername),
+		password,
+		context.Background(),
+	)
+
+	resp.ResourceData = manager
+	resp.DataSourceData = manager
+}
+
+func (p *weronProvider) Resources(ctx context.Context) []func() resource.Resource {
+	return []func() resource.Resource{
+		newCommunityResource,
+		newLeaseResource,
+	}
+}
+
+func (p *weronProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
+	return nil
+}
+
+// configureManager returns the manager which has been created by the provider
+func configureManager(data any, diags interface{ AddError(string, string) }) *wrtcmgr.Manager {
+	if data == nil {
+		return nil
+	}
+
+	manager, ok := data.(*wrtcmgr.Manager)
+	if !ok {
+		diags.AddError("Unexpected provider data", "The provider has not been configured correctly.")
+
+		return nil
+	}
+
+	return manager
+}
+
+// isNotFound returns whether the signaler has responded that a resource doesn't exist
+func isNotFound(err error) bool {
+	return strings.HasPrefix(err.Error(), "404")
+}
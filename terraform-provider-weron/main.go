@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/pojntfx/weron/terraform-provider-weron/internal/provider"
+)
+
+// terraform-provider-weron manages persistent communities and their leases on a signaler; it is started by Terraform, which talks to it over gRPC
+func main() {
+	debug := flag.Bool("debug", false, "Start the provider in debug mode, so that it can be attached to with a debugger")
+	flag.Parse()
+
+	if err := providerserver.Serve(context.Background(), provider.New, providerserver.ServeOpts{
+		Address: "registry.terraform.io/pojntfx/weron",
+		Debug:   *debug,
+	}); err != nil {
+		panic(err)
+	}
+}